@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/relay"
+	"github.com/okdaichi/qumo/internal/sdn"
+)
+
+// /admin/actions runs routine operations on a running relay. Every action
+// is confirmed in two steps: a POST without a confirmation token describes
+// what would be done and answers 428 with a token, and repeating the POST
+// with the token, within confirmTTL and with the same parameters, runs it.
+
+// confirmTTL is how long a confirmation token stays valid.
+const confirmTTL = time.Minute
+
+// adminAction is an operation /admin/actions can run.
+type adminAction struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Params      []string `json:"params,omitempty"` // all required
+
+	run func(ctx context.Context, params map[string]string) (any, error)
+}
+
+// reopener is a log file the rotate-logs action reopens, such as the
+// summary file.
+type reopener interface {
+	Reopen() error
+}
+
+// relayActions returns the actions available on a relay: those needing an
+// SDN client or log files only when configured. logs are the relay's log
+// files by name.
+func relayActions(sdnClient *sdn.Group, logs map[string]reopener) []*adminAction {
+	actions := []*adminAction{
+		{
+			Name:        "flush-track-cache",
+			Description: "Evict the cached groups of a relayed track but the latest",
+			Params:      []string{"broadcast_path", "track_name"},
+			run: func(_ context.Context, p map[string]string) (any, error) {
+				n, err := relay.FlushTrackCache(p["broadcast_path"], p["track_name"])
+				return map[string]int{"evicted_groups": n}, err
+			},
+		},
+		{
+			Name:        "release-idle",
+			Description: "Collect ended publications and close the upstream subscriptions of tracks nobody reads",
+			run: func(context.Context, map[string]string) (any, error) {
+				return relay.CollectIdle(), nil
+			},
+		},
+	}
+	if sdnClient != nil {
+		actions = append(actions, &adminAction{
+			Name:        "sdn-reregister",
+			Description: "Register the relay and its announces with the SDN controllers again now",
+			run: func(ctx context.Context, _ map[string]string) (any, error) {
+				return map[string]int{"announces": sdnClient.Clients()[0].RegistrationState().Announces}, sdnClient.Reregister(ctx)
+			},
+		})
+	}
+	if len(logs) > 0 {
+		actions = append(actions, &adminAction{
+			Name:        "rotate-logs",
+			Description: "Reopen the log files (" + strings.Join(slices.Sorted(maps.Keys(logs)), ", ") + "), after a log rotation moved them away",
+			run: func(context.Context, map[string]string) (any, error) {
+				reopened := []string{}
+				var errs []error
+				for _, name := range slices.Sorted(maps.Keys(logs)) {
+					if err := logs[name].Reopen(); err != nil {
+						errs = append(errs, fmt.Errorf("%s: %w", name, err))
+						continue
+					}
+					reopened = append(reopened, name)
+				}
+				return map[string][]string{"reopened": reopened}, errors.Join(errs...)
+			},
+		})
+	}
+	return actions
+}
+
+// logFile is a file the relay appends to, such as the TLS key log, that
+// can be reopened after a log rotation moved it away.
+type logFile struct {
+	path string
+	perm os.FileMode
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openLogFile opens path for appending, creating it with perm if needed.
+func openLogFile(path string, perm os.FileMode) (*logFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &logFile{path: path, perm: perm, file: f}, nil
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(p)
+}
+
+// Reopen closes the file and opens its path again. On error writes keep
+// going to the old file.
+func (f *logFile) Reopen() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, f.perm)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	old := f.file
+	f.file = file
+	return old.Close()
+}
+
+func (f *logFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// pendingAction is an action awaiting confirmation.
+type pendingAction struct {
+	action  string
+	params  map[string]string
+	expires time.Time
+}
+
+// actionsHandler serves /admin/actions.
+//
+//	GET  /admin/actions
+//	POST /admin/actions/<name>  {"params": {...}, "confirm": "<token>"}
+type actionsHandler struct {
+	actions map[string]*adminAction
+	now     func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]pendingAction // by confirmation token
+}
+
+func newActionsHandler(actions ...*adminAction) *actionsHandler {
+	h := &actionsHandler{
+		actions: make(map[string]*adminAction, len(actions)),
+		now:     time.Now,
+		pending: make(map[string]pendingAction),
+	}
+	for _, a := range actions {
+		h.actions[a.Name] = a
+	}
+	return h
+}
+
+func (h *actionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/actions"), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		list := slices.SortedFunc(maps.Values(h.actions), func(a, b *adminAction) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+		writeJSON(w, http.StatusOK, map[string]any{"actions": list})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	action, ok := h.actions[name]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown action: " + name})
+		return
+	}
+
+	var body struct {
+		Params  map[string]string `json:"params"`
+		Confirm string            `json:"confirm"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	for _, p := range action.Params {
+		if body.Params[p] == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("%s requires %s", name, strings.Join(action.Params, " and "))})
+			return
+		}
+	}
+
+	if body.Confirm == "" {
+		token := h.issue(name, body.Params)
+		writeJSON(w, http.StatusPreconditionRequired, map[string]any{
+			"action":      name,
+			"description": action.Description,
+			"params":      body.Params,
+			"confirm":     token,
+			"expires_at":  h.now().Add(confirmTTL),
+		})
+		return
+	}
+	if !h.redeem(body.Confirm, name, body.Params) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "confirmation token is invalid, expired or for another action"})
+		return
+	}
+
+	result, err := action.run(r.Context(), body.Params)
+	switch {
+	case errors.Is(err, relay.ErrTrackNotRelayed):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Admin action %s failed: %v", name, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"action": name, "result": result, "error": err.Error()})
+		return
+	}
+	log.Printf("Admin action %s done %v", name, body.Params)
+	writeJSON(w, http.StatusOK, map[string]any{"action": name, "result": result})
+}
+
+// issue returns a confirmation token for running action with params.
+func (h *actionsHandler) issue(action string, params map[string]string) string {
+	token := rand.Text()
+	now := h.now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	maps.DeleteFunc(h.pending, func(_ string, p pendingAction) bool { return now.After(p.expires) })
+	h.pending[token] = pendingAction{action: action, params: params, expires: now.Add(confirmTTL)}
+	return token
+}
+
+// redeem consumes token if it confirms running action with params and has
+// not expired.
+func (h *actionsHandler) redeem(token, action string, params map[string]string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.pending[token]
+	if !ok || p.action != action || !maps.Equal(p.params, params) || h.now().After(p.expires) {
+		return false
+	}
+	delete(h.pending, token)
+	return true
+}
+
+// writeJSON writes v as the JSON body of a status answer.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postAction(t *testing.T, h http.Handler, name, body string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/actions/"+name, strings.NewReader(body)))
+	var resp map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	return rec.Code, resp
+}
+
+func TestActionsHandler_List(t *testing.T) {
+	h := newActionsHandler(relayActions(nil, nil)...)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/actions", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Actions []adminAction `json:"actions"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Actions, 2, "no SDN or summary actions without them configured")
+	assert.Equal(t, "flush-track-cache", resp.Actions[0].Name)
+	assert.Equal(t, []string{"broadcast_path", "track_name"}, resp.Actions[0].Params)
+	assert.Equal(t, "release-idle", resp.Actions[1].Name)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/actions/release-idle", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestActionsHandler_Confirm(t *testing.T) {
+	var runs []map[string]string
+	h := newActionsHandler(&adminAction{
+		Name:   "drain",
+		Params: []string{"path"},
+		run: func(_ context.Context, p map[string]string) (any, error) {
+			runs = append(runs, p)
+			return map[string]int{"drained": 1}, nil
+		},
+	})
+	now := time.Now()
+	h.now = func() time.Time { return now }
+
+	code, resp := postAction(t, h, "drain", `{"params":{"path":"/live/a"}}`)
+	require.Equal(t, http.StatusPreconditionRequired, code)
+	token, _ := resp["confirm"].(string)
+	require.NotEmpty(t, token)
+	assert.Empty(t, runs, "nothing runs before the confirmation")
+
+	code, _ = postAction(t, h, "drain", `{"params":{"path":"/live/b"},"confirm":"`+token+`"}`)
+	assert.Equal(t, http.StatusConflict, code, "a token confirms its parameters only")
+	code, _ = postAction(t, h, "drain", `{"params":{"path":"/live/a"},"confirm":"bogus"}`)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, resp = postAction(t, h, "drain", `{"params":{"path":"/live/a"},"confirm":"`+token+`"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"drained": float64(1)}, resp["result"])
+	assert.Equal(t, []map[string]string{{"path": "/live/a"}}, runs)
+
+	code, _ = postAction(t, h, "drain", `{"params":{"path":"/live/a"},"confirm":"`+token+`"}`)
+	assert.Equal(t, http.StatusConflict, code, "tokens are single use")
+
+	_, resp = postAction(t, h, "drain", `{"params":{"path":"/live/a"}}`)
+	now = now.Add(confirmTTL + time.Second)
+	code, _ = postAction(t, h, "drain", fmt.Sprintf(`{"params":{"path":"/live/a"},"confirm":%q}`, resp["confirm"]))
+	assert.Equal(t, http.StatusConflict, code, "an expired token")
+	assert.Len(t, runs, 1)
+}
+
+func TestActionsHandler_Errors(t *testing.T) {
+	h := newActionsHandler(
+		&adminAction{Name: "needs-path", Params: []string{"path"}, run: func(context.Context, map[string]string) (any, error) {
+			return nil, nil
+		}},
+		&adminAction{Name: "broken", run: func(context.Context, map[string]string) (any, error) {
+			return nil, errors.New("disk full")
+		}},
+		&adminAction{Name: "missing", run: func(context.Context, map[string]string) (any, error) {
+			return nil, relay.ErrTrackNotRelayed
+		}},
+	)
+	confirm := func(name string) (int, map[string]any) {
+		_, resp := postAction(t, h, name, `{}`)
+		return postAction(t, h, name, fmt.Sprintf(`{"confirm":%q}`, resp["confirm"]))
+	}
+
+	code, _ := postAction(t, h, "reboot", `{}`)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = postAction(t, h, "needs-path", `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = postAction(t, h, "needs-path", `{"params":`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, resp := confirm("broken")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "disk full", resp["error"])
+	code, _ = confirm("missing")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRelayActions_RotateLogs(t *testing.T) {
+	dir := t.TempDir()
+	keyLog, err := openLogFile(filepath.Join(dir, "keys.log"), 0o600)
+	require.NoError(t, err)
+	defer keyLog.Close()
+	summaries, err := relay.NewFileSummarySink(filepath.Join(dir, "summaries.jsonl"))
+	require.NoError(t, err)
+	defer summaries.Close()
+
+	var rotate *adminAction
+	for _, a := range relayActions(nil, map[string]reopener{"tls_keylog": keyLog, "summaries": summaries}) {
+		if a.Name == "rotate-logs" {
+			rotate = a
+		}
+	}
+	require.NotNil(t, rotate)
+	assert.Contains(t, rotate.Description, "summaries, tls_keylog")
+
+	// A log rotation moves both files away
+	for _, name := range []string{"keys.log", "summaries.jsonl"} {
+		require.NoError(t, os.Rename(filepath.Join(dir, name), filepath.Join(dir, name+".1")))
+	}
+	result, err := rotate.run(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"reopened": {"summaries", "tls_keylog"}}, result)
+
+	_, err = keyLog.Write([]byte("CLIENT_RANDOM x y\n"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, "keys.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "CLIENT_RANDOM x y\n", string(data))
+	_, err = os.Stat(filepath.Join(dir, "summaries.jsonl"))
+	assert.NoError(t, err)
+}
+
+func TestActionsHandler_RequiresAdminToken(t *testing.T) {
+	h := adminAuth("", writeAuth("", newActionsHandler(relayActions(nil, nil)...)))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/actions", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "listing is harmless")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/actions/release-idle", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusForbidden, rec.Code, "nothing runs without admin.token")
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminAuth protects admin endpoints with a bearer token. An empty token
+// leaves the endpoints open, which is only suitable for trusted networks.
+func adminAuth(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="qumo-admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeAuth protects the requests of an endpoint that change state, such
+// as bandwidth reservations, with the admin token and leaves its reads
+// open. Without a token the changes are refused rather than left open.
+func writeAuth(token string, next http.Handler) http.Handler {
+	protected := adminAuth(token, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			next.ServeHTTP(w, r)
+		case token == "":
+			http.Error(w, "admin.token is not configured", http.StatusForbidden)
+		default:
+			protected.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"no token configured", "", "", http.StatusNoContent},
+		{"valid token", "s3cret", "Bearer s3cret", http.StatusNoContent},
+		{"missing header", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "Bearer nope", http.StatusUnauthorized},
+		{"wrong scheme", "s3cret", "Basic s3cret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/egress-limit", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			adminAuth(tt.token, ok).ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestWriteAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		header string
+		want   int
+	}{
+		{"read without token configured", "", http.MethodGet, "", http.StatusNoContent},
+		{"read without header", "s3cret", http.MethodGet, "", http.StatusNoContent},
+		{"write without token configured", "", http.MethodPost, "", http.StatusForbidden},
+		{"write without header", "s3cret", http.MethodPost, "", http.StatusUnauthorized},
+		{"write with valid token", "s3cret", http.MethodPost, "Bearer s3cret", http.StatusNoContent},
+		{"delete with wrong token", "s3cret", http.MethodDelete, "Bearer nope", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/route", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			writeAuth(tt.token, ok).ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
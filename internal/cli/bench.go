@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/okdaichi/qumo/internal/relay"
+)
+
+// RunBenchInternal runs the relay's hot-path micro-benchmarks with the
+// values from a relay config on this machine and prints recommended
+// group_cache_size, frame_capacity and notify_timeout_ms.
+func RunBenchInternal(args []string) error {
+	return runBenchInternal(args, os.Stdout)
+}
+
+func runBenchInternal(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("bench-internal", flag.ContinueOnError)
+	configFile := fs.String("config", "config.relay.yaml", "relay config to take group_cache_size, frame_capacity and notify_timeout_ms from; built-in defaults if it does not exist")
+	frameSize := fs.Int("frame-size", 0, "typical frame payload in bytes (default: frame_capacity)")
+	framesPerGroup := fs.Int("frames-per-group", 30, "frames per group, e.g. one GOP")
+	subscribers := fs.Int("subscribers", 100, "subscribers per track")
+	cacheMemoryMB := fs.Int("cache-memory-mb", 64, "group cache budget per track in MiB; 0 is unlimited")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := benchConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	cfg.FrameSize = *frameSize
+	if cfg.FrameSize == 0 {
+		cfg.FrameSize = cfg.FrameCapacity
+	}
+	cfg.FramesPerGroup = *framesPerGroup
+	cfg.Subscribers = *subscribers
+	cfg.CacheMemory = int64(*cacheMemoryMB) << 20
+	if cfg.FrameSize <= 0 || cfg.FramesPerGroup <= 0 || cfg.Subscribers <= 0 || cfg.CacheMemory < 0 {
+		return errors.New("-frame-size, -frames-per-group and -subscribers must be positive, -cache-memory-mb not negative")
+	}
+
+	if !*asJSON {
+		fmt.Fprintf(out, "Benchmarking group_cache_size=%d frame_capacity=%d notify_timeout_ms=%d\n",
+			cfg.GroupCacheSize, cfg.FrameCapacity, cfg.NotifyTimeout.Milliseconds())
+		fmt.Fprintf(out, "with %d-byte frames, %d frames per group, %d subscribers per track\n\n",
+			cfg.FrameSize, cfg.FramesPerGroup, cfg.Subscribers)
+	}
+
+	report := relay.RunBenchmarks(cfg)
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return printBenchReport(out, report)
+}
+
+// benchConfig reads the tuning values from the relay config at filename,
+// or uses the relay defaults if there is no such file.
+func benchConfig(filename string) (relay.BenchConfig, error) {
+	cfg := relay.BenchConfig{
+		GroupCacheSize: 100, // loadConfig's defaults
+		FrameCapacity:  1500,
+		NotifyTimeout:  relay.NotifyTimeout,
+	}
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+
+	c, err := loadConfig(filename)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg.GroupCacheSize = c.RelayConfig.GroupCacheSize
+	cfg.FrameCapacity = c.RelayConfig.FrameCapacity
+	if c.NotifyTimeout > 0 {
+		cfg.NotifyTimeout = c.NotifyTimeout
+	}
+	return cfg, nil
+}
+
+func printBenchReport(out io.Writer, report relay.BenchReport) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BENCHMARK\tNS/OP\tB/OP\tALLOCS/OP")
+	for _, r := range report.Results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", r.Name, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "SETTING\tCURRENT\tRECOMMENDED\tWHY")
+	for _, r := range report.Recommendations {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Setting, r.Current, r.Recommended, r.Reason)
+	}
+	return tw.Flush()
+}
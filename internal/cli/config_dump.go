@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/qumo/internal/relay"
+	"github.com/okdaichi/qumo/internal/sdn"
+)
+
+// secretFields are substrings of the field names whose values are always
+// redacted in config dumps, matched case-insensitively.
+var secretFields = []string{"token", "salt", "password", "secret"}
+
+// dumpConfig returns c as a JSON-ready tree keyed by field name, for
+// support to see what a relay actually runs with: the config file with
+// its references resolved, defaults filled in and flag and environment
+// overrides applied. Secrets are redacted: fields named like a token or
+// salt, inline PEM keys, and the credentials and query of URLs. Callbacks
+// and unexported state are left out; a disabled component is null.
+func dumpConfig(c *config) any {
+	return dumpValue("", reflect.ValueOf(c))
+}
+
+// dumpValue converts v, the value of the field name, for dumpConfig.
+func dumpValue(name string, v reflect.Value) any {
+	if v.Type() == reflect.TypeFor[time.Duration]() {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Type() == reflect.TypeFor[moqt.Version]() {
+		return relay.VersionName(moqt.Version(v.Uint()))
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return dumpValue(name, v.Elem())
+	case reflect.Struct:
+		out := make(map[string]any)
+		t := v.Type()
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if !f.IsExported() || f.Type.Kind() == reflect.Func || f.Type.Kind() == reflect.Chan {
+				continue
+			}
+			out[f.Name] = dumpValue(f.Name, v.Field(i))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]any, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			out[fmt.Sprint(iter.Key().Interface())] = dumpValue(name, iter.Value())
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = dumpValue(name, v.Index(i))
+		}
+		return out
+	case reflect.String:
+		return redactDumpString(name, v.String())
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil
+	}
+	return v.Interface()
+}
+
+// redactDumpString redacts s, the value of the field name, if it is or may
+// hold a secret.
+func redactDumpString(name, s string) string {
+	if s == "" {
+		return s
+	}
+	lower := strings.ToLower(name)
+	for _, f := range secretFields {
+		if strings.Contains(lower, f) {
+			return redacted
+		}
+	}
+	if sdn.IsPEM(s) && strings.Contains(lower, "key") {
+		return redacted
+	}
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" && (u.User != nil || u.RawQuery != "") {
+		if u.RawQuery != "" {
+			u.RawQuery = redacted
+		}
+		return u.Redacted()
+	}
+	return s
+}
+
+// writeConfig writes the dump of c to w as indented JSON.
+func writeConfig(w io.Writer, c *config) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dumpConfig(c))
+}
+
+// configHandlerFunc returns an http.HandlerFunc serving the dump of c, as
+// the relay started with it.
+//
+//	GET /admin/config
+func configHandlerFunc(c *config) http.HandlerFunc {
+	dump := dumpConfig(c)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dump)
+	}
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/relay"
+	"github.com/okdaichi/qumo/internal/sdn"
+)
+
+// Listen addresses used by `qumo relay --dev`.
+const (
+	devRelayAddr = "127.0.0.1:4433"
+	devSDNAddr   = "127.0.0.1:8090"
+)
+
+// devCertValidity keeps the generated certificate within the 14-day limit
+// browsers enforce for WebTransport serverCertificateHashes.
+const devCertValidity = 10 * 24 * time.Hour
+
+// devCert is a generated self-signed certificate in PEM form.
+type devCert struct {
+	CertPEM string
+	KeyPEM  string
+
+	// Hash is the lower-case hex SHA-256 of the DER certificate, as
+	// printed by `mage hash`.
+	Hash string
+}
+
+// generateDevCert creates an ECDSA P-256 certificate for localhost that
+// browsers accept through serverCertificateHashes.
+func generateDevCert(now time.Time) (*devCert, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "qumo dev relay"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(devCertValidity - time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(der)
+	return &devCert{
+		CertPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		KeyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		Hash:    hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// devConfig returns the relay configuration for --dev: localhost listeners,
+// the given certificate and auto-announce to the embedded SDN controller.
+func devConfig(cert *devCert) *config {
+	return &config{
+		Address:  devRelayAddr,
+		CertFile: cert.CertPEM,
+		KeyFile:  cert.KeyPEM,
+		RelayConfig: relay.Config{
+			NodeID:         "dev",
+			Region:         "local",
+			FrameCapacity:  1500,
+			GroupCacheSize: 100,
+		},
+		SDNConfig: &sdn.ClientConfig{
+			URL:       "http://" + devSDNAddr,
+			RelayName: "dev",
+			Region:    "local",
+			Address:   devRelayAddr,
+		},
+	}
+}
+
+// startDevSDN serves an in-memory SDN controller on devSDNAddr until ctx
+// is cancelled.
+func startDevSDN(ctx context.Context) error {
+	handler, err := newSDNHandler(ctx, &sdnConfig{ListenAddr: devSDNAddr})
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", devSDNAddr)
+	if err != nil {
+		return fmt.Errorf("failed to start embedded SDN controller: %w", err)
+	}
+	srv := newHTTPServer(devSDNAddr, handler, httpLimits{})
+	go srv.Serve(ln)
+	context.AfterFunc(ctx, func() { srv.Close() })
+
+	slog.Info("embedded SDN controller started", "address", "http://"+devSDNAddr)
+	return nil
+}
+
+// printDevBanner tells a new user how to connect to the dev relay.
+func printDevBanner(cert *devCert) {
+	fmt.Println()
+	fmt.Println("qumo relay running in dev mode (no config file)")
+	fmt.Println("  relay:      https://" + net.JoinHostPort("localhost", portOf(devRelayAddr)))
+	fmt.Println("  SDN:        http://" + devSDNAddr)
+	fmt.Println("  cert hash:  " + cert.Hash)
+	fmt.Println("              (pass as serverCertificateHashes; the certificate is regenerated on every start)")
+	fmt.Println()
+}
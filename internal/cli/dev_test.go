@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateDevCert(t *testing.T) {
+	now := time.Now()
+	cert, err := generateDevCert(now)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode([]byte(cert.CertPEM))
+	require.NotNil(t, block)
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	// serverCertificateHashes requires ECDSA and at most 14 days validity
+	_, ok := parsed.PublicKey.(*ecdsa.PublicKey)
+	assert.True(t, ok)
+	assert.LessOrEqual(t, parsed.NotAfter.Sub(parsed.NotBefore), 14*24*time.Hour)
+	assert.True(t, parsed.NotAfter.After(now))
+	assert.NoError(t, parsed.VerifyHostname("localhost"))
+	assert.NoError(t, parsed.VerifyHostname("127.0.0.1"))
+
+	sum := sha256.Sum256(block.Bytes)
+	assert.Equal(t, hex.EncodeToString(sum[:]), cert.Hash)
+}
+
+func TestDevConfig(t *testing.T) {
+	cert, err := generateDevCert(time.Now())
+	require.NoError(t, err)
+
+	cfg := devConfig(cert)
+	assert.Equal(t, devRelayAddr, cfg.Address)
+	require.NotNil(t, cfg.SDNConfig)
+	assert.Equal(t, "http://"+devSDNAddr, cfg.SDNConfig.URL)
+	assert.Equal(t, devRelayAddr, cfg.SDNConfig.Address)
+
+	// The inline PEM pair loads like a configured certificate
+	tlsConfig, err := setupTLS(cfg.CertFile, cfg.KeyFile)
+	require.NoError(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+}
+
+func TestNewSDNHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := newSDNHandler(ctx, &sdnConfig{ListenAddr: devSDNAddr})
+	require.NoError(t, err)
+
+	for _, path := range []string{"/health", "/graph", "/announce"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+	}
+
+	// Node detail is routed past the registration handler
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/relay/relay-a", strings.NewReader(`{"neighbors":{}}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/relay/relay-a/detail", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"relay":"relay-a"`)
+}
+
+func TestNewSDNHandler_DeregisterDropsStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := newSDNHandler(ctx, &sdnConfig{ListenAddr: devSDNAddr})
+	require.NoError(t, err)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, serve(http.MethodPut, "/relay/relay-a", `{"neighbors":{}}`).Code)
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/stats/relay/relay-a", `{"sessions":3}`).Code)
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/stats/relay/relay-a", "").Code)
+
+	require.Equal(t, http.StatusOK, serve(http.MethodDelete, "/relay/relay-a?reason=shutdown", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/stats/relay/relay-a", "").Code)
+	assert.Contains(t, serve(http.MethodGet, "/stats/cluster", "").Body.String(), `"relays":0`)
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/relay"
+)
+
+const (
+	// deepProbeInterval is the least time between two runs of the deep
+	// checks; probes in between get the previous results, so a tight probe
+	// loop does not turn into load on the SDN and upstream relays.
+	deepProbeInterval = 10 * time.Second
+
+	// deepCheckTimeout bounds each dependency check.
+	deepCheckTimeout = 3 * time.Second
+)
+
+// errNotConfigured is returned by a dependency check with nothing to
+// check, such as the upstream dial of a relay fetching nothing remote.
+var errNotConfigured = errors.New("not configured")
+
+// dependencyCheck actively checks one dependency of the relay.
+type dependencyCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// upstreamCheck returns a check dialing the relays fetcher relays from.
+func upstreamCheck(fetcher *relay.RemoteFetcher) func(context.Context) error {
+	return func(ctx context.Context) error {
+		err := fetcher.CheckUpstreams(ctx)
+		if errors.Is(err, relay.ErrNoUpstreams) {
+			return errNotConfigured
+		}
+		return err
+	}
+}
+
+// dependencyStatus is the result of a dependency check.
+type dependencyStatus struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"` // "ok", "failed" or "skipped"
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// deepProbe runs the dependency checks of /health?probe=ready&deep=true,
+// at most once per deepProbeInterval.
+type deepProbe struct {
+	checks []dependencyCheck
+
+	mu        sync.Mutex // held while checking, so concurrent probes share a run
+	checkedAt time.Time
+	results   []dependencyStatus
+}
+
+// run returns the results of the checks, running them unless they ran
+// within deepProbeInterval, and when they ran. The results are shared, so
+// a probe that gives up waiting does not cut the checks short.
+func (p *deepProbe) run(ctx context.Context) ([]dependencyStatus, time.Time) {
+	ctx = context.WithoutCancel(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.results != nil && time.Since(p.checkedAt) < deepProbeInterval {
+		return p.results, p.checkedAt
+	}
+
+	results := make([]dependencyStatus, len(p.checks))
+	var wg sync.WaitGroup
+	for i, c := range p.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	p.results, p.checkedAt = results, time.Now()
+	return p.results, p.checkedAt
+}
+
+// runCheck runs c within deepCheckTimeout and times it.
+func runCheck(ctx context.Context, c dependencyCheck) dependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, deepCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.check(ctx)
+	status := dependencyStatus{
+		Name:      c.name,
+		Status:    "ok",
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	switch {
+	case errors.Is(err, errNotConfigured):
+		status.Status = "skipped"
+		status.LatencyMs = 0
+	case err != nil:
+		status.Status = "failed"
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// dependenciesHealthy reports whether no check failed.
+func dependenciesHealthy(results []dependencyStatus) bool {
+	for _, r := range results {
+		if r.Status == "failed" {
+			return false
+		}
+	}
+	return true
+}
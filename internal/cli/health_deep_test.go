@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/okdaichi/qumo/internal/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthHandler_DeepReady(t *testing.T) {
+	var sdnCalls atomic.Int32
+	var sdnErr error
+	h := &healthHandler{
+		statusFunc: func() relay.Status { return relay.Status{Status: "healthy"} },
+		deep: &deepProbe{checks: []dependencyCheck{
+			{name: "sdn", check: func(context.Context) error { sdnCalls.Add(1); return sdnErr }},
+			{name: "upstream_relays", check: func(context.Context) error { return errNotConfigured }},
+		}},
+	}
+
+	probe := func() (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health?probe=ready&deep=true", nil))
+		var resp map[string]any
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return rec.Code, resp
+	}
+
+	code, resp := probe()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, resp["ready"])
+	deps := resp["dependencies"].([]any)
+	require.Len(t, deps, 2)
+	assert.Equal(t, "ok", deps[0].(map[string]any)["status"])
+	assert.Equal(t, "skipped", deps[1].(map[string]any)["status"])
+
+	// Within the interval the previous results are served
+	sdnErr = errors.New("connection refused")
+	code, _ = probe()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int32(1), sdnCalls.Load())
+
+	h.deep.results = nil
+	code, resp = probe()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "dependency_failed", resp["reason"])
+	sdn := resp["dependencies"].([]any)[0].(map[string]any)
+	assert.Equal(t, "failed", sdn["status"])
+	assert.Equal(t, "connection refused", sdn["error"])
+
+	// Plain readiness does not run the checks
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health?probe=ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int32(2), sdnCalls.Load())
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Defaults of httpLimits, guarding the plain HTTP listeners against slow
+// or oversized requests.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultMaxHeaderBytes    = 64 << 10
+)
+
+// httpLimits bounds how long and how much the relay's health/admin server
+// and the SDN controller give each request. Zero fields use the defaults
+// above; WriteTimeout defaults to none, so slow scrapes and large exports
+// still complete.
+type httpLimits struct {
+	ReadHeaderTimeout time.Duration // slowloris protection
+	ReadTimeout       time.Duration // headers and body
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration // keep-alive connections
+	MaxHeaderBytes    int
+}
+
+// httpLimitsYAML is the `http` section of the relay and SDN configs.
+type httpLimitsYAML struct {
+	ReadHeaderTimeoutSec int `yaml:"read_header_timeout_sec"`
+	ReadTimeoutSec       int `yaml:"read_timeout_sec"`
+	WriteTimeoutSec      int `yaml:"write_timeout_sec"`
+	IdleTimeoutSec       int `yaml:"idle_timeout_sec"`
+	MaxHeaderBytes       int `yaml:"max_header_bytes"`
+}
+
+// limits validates y and converts it to httpLimits.
+func (y httpLimitsYAML) limits() (httpLimits, error) {
+	if y.ReadHeaderTimeoutSec < 0 || y.ReadTimeoutSec < 0 || y.WriteTimeoutSec < 0 || y.IdleTimeoutSec < 0 || y.MaxHeaderBytes < 0 {
+		return httpLimits{}, fmt.Errorf("http timeouts and max_header_bytes must not be negative")
+	}
+	return httpLimits{
+		ReadHeaderTimeout: time.Duration(y.ReadHeaderTimeoutSec) * time.Second,
+		ReadTimeout:       time.Duration(y.ReadTimeoutSec) * time.Second,
+		WriteTimeout:      time.Duration(y.WriteTimeoutSec) * time.Second,
+		IdleTimeout:       time.Duration(y.IdleTimeoutSec) * time.Second,
+		MaxHeaderBytes:    y.MaxHeaderBytes,
+	}, nil
+}
+
+// newHTTPServer returns a server for handler on addr with limits applied.
+func newHTTPServer(addr string, handler http.Handler, limits httpLimits) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cmp.Or(limits.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		ReadTimeout:       cmp.Or(limits.ReadTimeout, defaultReadTimeout),
+		WriteTimeout:      limits.WriteTimeout,
+		IdleTimeout:       cmp.Or(limits.IdleTimeout, defaultIdleTimeout),
+		MaxHeaderBytes:    cmp.Or(limits.MaxHeaderBytes, defaultMaxHeaderBytes),
+	}
+}
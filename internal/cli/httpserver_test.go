@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPServer_Limits(t *testing.T) {
+	srv := newHTTPServer(":8080", http.NotFoundHandler(), httpLimits{})
+	assert.Equal(t, ":8080", srv.Addr)
+	assert.Equal(t, defaultReadHeaderTimeout, srv.ReadHeaderTimeout)
+	assert.Equal(t, defaultReadTimeout, srv.ReadTimeout)
+	assert.Zero(t, srv.WriteTimeout)
+	assert.Equal(t, defaultIdleTimeout, srv.IdleTimeout)
+	assert.Equal(t, defaultMaxHeaderBytes, srv.MaxHeaderBytes)
+
+	srv = newHTTPServer(":8080", http.NotFoundHandler(), httpLimits{
+		ReadHeaderTimeout: time.Second,
+		ReadTimeout:       2 * time.Second,
+		WriteTimeout:      3 * time.Second,
+		IdleTimeout:       4 * time.Second,
+		MaxHeaderBytes:    4096,
+	})
+	assert.Equal(t, time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 2*time.Second, srv.ReadTimeout)
+	assert.Equal(t, 3*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 4*time.Second, srv.IdleTimeout)
+	assert.Equal(t, 4096, srv.MaxHeaderBytes)
+}
+
+// serveHardened serves a hardened server with limits on a local port and
+// returns its address.
+func serveHardened(t *testing.T, limits httpLimits) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := newHTTPServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), limits)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func TestNewHTTPServer_Slowloris(t *testing.T) {
+	addr := serveHardened(t, httpLimits{ReadHeaderTimeout: 100 * time.Millisecond})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Trickle a header that never ends
+	_, err = conn.Write([]byte("GET /health HTTP/1.1\r\nHost: relay\r\nX-Slow: "))
+	require.NoError(t, err)
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err, "the server closes the connection")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestNewHTTPServer_MaxHeaderBytes(t *testing.T) {
+	addr := serveHardened(t, httpLimits{MaxHeaderBytes: 1024})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: relay\r\nX-Big: " + strings.Repeat("a", 64<<10) + "\r\n\r\n"))
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+}
+
+func TestLoadConfig_HTTPLimits(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("http:\n  read_header_timeout_sec: 5\n  idle_timeout_sec: 30\n  max_header_bytes: 8192\n"), 0644))
+
+	cfg, err := loadConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, httpLimits{ReadHeaderTimeout: 5 * time.Second, IdleTimeout: 30 * time.Second, MaxHeaderBytes: 8192}, cfg.HTTP)
+
+	sdnCfg, err := loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.HTTP, sdnCfg.HTTP)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("http:\n  read_timeout_sec: -1\n"), 0644))
+	_, err = loadConfig(configFile)
+	assert.ErrorContains(t, err, "http")
+	_, err = loadSDNConfig(configFile)
+	assert.ErrorContains(t, err, "http")
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/okdaichi/qumo/internal/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, h http.Handler, accept string) (string, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(body), w.Header().Get("Content-Type")
+}
+
+func TestNewMetricsRegistry(t *testing.T) {
+	reg, handler := newMetricsRegistry(metricsConfig{
+		Namespace: "acme",
+		Labels:    map[string]string{"cluster": "tokyo-1"},
+	})
+	require.NoError(t, version.RegisterMetrics(reg))
+
+	body, _ := scrape(t, handler, "")
+	assert.Contains(t, body, `acme_qumo_build_info{cluster="tokyo-1",`)
+	assert.Contains(t, body, `acme_go_goroutines{cluster="tokyo-1"}`, "runtime collectors are shaped too")
+	assert.NotContains(t, body, "\nqumo_build_info")
+
+	_, contentType := scrape(t, handler, "application/openmetrics-text")
+	assert.NotContains(t, contentType, "openmetrics", "OpenMetrics only with exemplars")
+}
+
+func TestNewMetricsRegistry_Exemplars(t *testing.T) {
+	_, handler := newMetricsRegistry(metricsConfig{Exemplars: true})
+
+	body, contentType := scrape(t, handler, "application/openmetrics-text")
+	assert.Contains(t, contentType, "application/openmetrics-text")
+	assert.Contains(t, body, "go_goroutines")
+	assert.Contains(t, body, "# EOF")
+}
+
+func TestMetricsConfigYAML(t *testing.T) {
+	cfg, err := metricsConfigYAML{Namespace: "acme", Labels: map[string]string{"region": "ap"}, Exemplars: true}.config()
+	require.NoError(t, err)
+	assert.Equal(t, metricsConfig{Namespace: "acme", Labels: map[string]string{"region": "ap"}, Exemplars: true}, cfg)
+
+	for name, y := range map[string]metricsConfigYAML{
+		"namespace":      {Namespace: "acme-prod"},
+		"label":          {Labels: map[string]string{"cluster.name": "a"}},
+		"reserved label": {Labels: map[string]string{"__name__": "a"}},
+	} {
+		_, err := y.config()
+		assert.Error(t, err, name)
+	}
+}
@@ -1,24 +1,31 @@
 package cli
 
 import (
+	"cmp"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"os/signal"
-	"syscall"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/okdaichi/gomoqt/moqt"
 	"github.com/okdaichi/gomoqt/quic"
 	"github.com/okdaichi/qumo/internal/relay"
 	"github.com/okdaichi/qumo/internal/sdn"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/okdaichi/qumo/internal/topology"
+	"github.com/okdaichi/qumo/internal/version"
 	"gopkg.in/yaml.v3"
 )
 
@@ -26,33 +33,324 @@ type config struct {
 	Address     string
 	CertFile    string
 	KeyFile     string
+	ClientCA    string // verifies client certificates; empty leaves sessions anonymous
 	MetricsAddr string
 	AdminAddr   string
-	RelayConfig relay.Config
-	SDNConfig   *sdn.ClientConfig // nil if auto-announce is disabled
+	AdminToken  string           // bearer token for /admin/ endpoints; empty = open
+	ReportFile  string           // optional path for the JSON shutdown report
+	SelfCheck   *selfCheckConfig // nil if the loopback probe is disabled
+	Probe       *probeConfig     // nil if cross-relay probing is disabled
+	Peers       *peersConfig     // nil if peer announce propagation is disabled
+	Prefetch    bool             // run the SDN's replication prefetches
+	Integrity   *integrityConfig // nil if relay-to-relay checksum verification is disabled
+
+	// ChainedFetch is nil if next hops are not asked to fetch along the
+	// SDN's path.
+	ChainedFetch *chainedFetchConfig
+
+	LogSampling relay.LogSampling
+	Summaries   summariesConfig
+	Events      eventsConfig
+
+	ClientMetrics relay.ClientMetrics
+	RelayConfig   relay.Config
+	SDNConfig     *sdn.ClientConfig // the primary controller; nil if auto-announce is disabled
+
+	// SDNSecondaries are the further controllers the relay registers
+	// with, in failover order.
+	SDNSecondaries []*sdn.ClientConfig
+
+	VirtualHosts []virtualHostConfig
+
+	// NotifyTimeout overrides relay.NotifyTimeout when set.
+	NotifyTimeout time.Duration
+
+	// StaleTracks is nil if the stale upstream watchdog is disabled.
+	StaleTracks *relay.StaleTrackWatchdog
+
+	// GoroutineLeaks is nil if the goroutine leak detector is disabled.
+	GoroutineLeaks *relay.GoroutineLeakDetector
+
+	// Resources is nil if the cgroup resource monitor is disabled.
+	Resources *relay.ResourceMonitor
+
+	// Handoff serves on sockets that `qumo upgrade` can hand to a new
+	// process.
+	Handoff bool
+
+	// HandoffDrain is how long the process drains its sessions after
+	// handing off; 0 means defaultHandoffDrain.
+	HandoffDrain time.Duration
+
+	// ListenersPerCore shards the QUIC socket over SO_REUSEPORT listeners,
+	// this many per core; 0 serves on a single socket.
+	ListenersPerCore int
+
+	// UDP sizes the buffers of the QUIC sockets.
+	UDP relay.UDPTuning
+
+	// DisableGSO turns off quic-go's UDP generic segmentation offload.
+	DisableGSO bool
+
+	// Demo serves the embedded demo player at /demo.
+	Demo bool
+
+	// WarmCache is nil if warm cache preloading is disabled.
+	WarmCache *warmCacheConfig
+
+	// Recordings is nil if recording retention is disabled.
+	Recordings *relay.RecordingRetention
+
+	// Compression is nil if no broadcasts are fetched compressed.
+	Compression *relay.TrackCompression
+
+	// HTTP bounds the time and header size of health and admin requests.
+	HTTP httpLimits
+
+	// Metrics shapes the metrics served on /metrics.
+	Metrics metricsConfig
+
+	// Debug is nil unless the developer debug mode is enabled, which only
+	// qumo_debug builds allow.
+	Debug *debugConfig
+}
+
+// debugConfig configures the developer debug mode.
+type debugConfig struct {
+	KeyLogFile string              // TLS key log (SSLKEYLOGFILE format); empty disables it
+	Capture    *relay.DebugCapture // nil if /admin/capture is disabled
+}
+
+// warmCacheConfig configures preloading the remote broadcasts a relay
+// served before a restart.
+type warmCacheConfig struct {
+	File    string // record of the served broadcasts
+	MaxAge  time.Duration
+	Timeout time.Duration
+}
+
+// virtualHostConfig is an additional relay identity served on the same
+// port and selected by SNI.
+type virtualHostConfig struct {
+	Hostname  string // lowercase
+	CertFile  string
+	KeyFile   string
+	SDNConfig *sdn.ClientConfig // nil if the host does not register with the SDN
+}
+
+// selfCheckConfig configures the loopback data-plane probe.
+type selfCheckConfig struct {
+	URL              string
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int
+}
+
+// summariesConfig selects the sinks for session and subscription summary
+// records. Both may be set; empty fields are skipped.
+type summariesConfig struct {
+	File string // JSON lines, appended
+	URL  string // each record POSTed as JSON
+}
+
+// eventsConfig selects the event bus publishers for relay lifecycle
+// events. Both may be set; empty URLs are skipped.
+type eventsConfig struct {
+	NATSURL      string // nats://[user:pass@]host:port or tls://...
+	NATSSubject  string // subject prefix; empty uses relay.DefaultNATSSubject
+	KafkaRESTURL string // Kafka REST Proxy base URL
+	KafkaTopic   string
+}
+
+// peersConfig configures announce propagation straight between relays.
+type peersConfig struct {
+	RelayName string   // name this relay announces under
+	Address   string   // MoQT endpoint peers dial
+	URLs      []string // HTTP base URLs of the peer relays
+	Token     string   // bearer token for /peer/announce, both ways
+	Interval  time.Duration
+}
+
+// integrityConfig configures group checksum verification between relays.
+type integrityConfig struct {
+	Token    string // bearer token for /peer/tracks/, both ways
+	Interval time.Duration
+}
+
+// chainedFetchConfig configures fetching along the SDN's full path.
+type chainedFetchConfig struct {
+	Token string // bearer token for /peer/fetch, both ways; required
+	HTTPS bool   // peers' HTTP listeners are behind TLS; required
+}
+
+// probeConfig configures SDN-coordinated cross-relay probes.
+type probeConfig struct {
+	Interval time.Duration
+	Frames   int
+}
+
+// identityOverrides replace the relay's identity from the config file, for
+// images deployed unchanged to environments where it differs. Empty fields
+// keep the configured values.
+type identityOverrides struct {
+	NodeID        string // relay.node_id, and the name the relay registers with the SDN and peers under
+	Region        string // relay.region, also reported to the SDN
+	AdvertiseAddr string // the MoQT address given to the SDN and peers
+}
+
+// apply writes the overrides into c.
+func (o identityOverrides) apply(c *config) {
+	if o.NodeID != "" {
+		c.RelayConfig.NodeID = o.NodeID
+		for _, sdnCfg := range c.sdnConfigs() {
+			sdnCfg.RelayName = o.NodeID
+		}
+		if c.Peers != nil {
+			c.Peers.RelayName = o.NodeID
+		}
+	}
+	if o.Region != "" {
+		c.RelayConfig.Region = o.Region
+		for _, sdnCfg := range c.sdnConfigs() {
+			sdnCfg.Region = o.Region
+		}
+	}
+	if o.AdvertiseAddr != "" {
+		for _, sdnCfg := range c.sdnConfigs() {
+			sdnCfg.Address = o.AdvertiseAddr
+		}
+		if c.Peers != nil {
+			c.Peers.Address = o.AdvertiseAddr
+		}
+	}
+}
+
+// sdnConfigs returns the controllers the relay registers with, the primary
+// first; none without auto-announce.
+func (c *config) sdnConfigs() []*sdn.ClientConfig {
+	if c.SDNConfig == nil {
+		return nil
+	}
+	return append([]*sdn.ClientConfig{c.SDNConfig}, c.SDNSecondaries...)
 }
 
 func RunRelay(args []string) error {
 	fs := flag.NewFlagSet("relay", flag.ExitOnError)
 	var configFile = fs.String("config", "config.relay.yaml", "path to config file")
+	var dev = fs.Bool("dev", false, "run on localhost with a generated certificate and an embedded SDN controller; no config file")
+	var printConfig = fs.Bool("print-config", false, "print the effective configuration as JSON, secrets redacted, and exit")
+	var identity identityOverrides
+	fs.StringVar(&identity.NodeID, "node-id", os.Getenv("QUMO_NODE_ID"), "override relay.node_id and the SDN and peer relay name (env QUMO_NODE_ID)")
+	fs.StringVar(&identity.Region, "region", os.Getenv("QUMO_REGION"), "override relay.region (env QUMO_REGION)")
+	fs.StringVar(&identity.AdvertiseAddr, "advertise-addr", os.Getenv("QUMO_ADVERTISE_ADDR"), "override the MoQT address advertised to the SDN and peers, e.g. https://relay-1:4433 (env QUMO_ADVERTISE_ADDR)")
 	fs.Parse(args)
 
 	// Load configuration
-	config, err := loadConfig(*configFile)
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+	var config *config
+	var cert *devCert
+	var err error
+	if *dev {
+		cert, err = generateDevCert(time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to generate dev certificate: %w", err)
+		}
+		config = devConfig(cert)
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	} else {
+		config, err = loadConfig(*configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+	identity.apply(config)
+	if *printConfig {
+		return writeConfig(os.Stdout, config)
+	}
+
+	relay.SetLogSampling(config.LogSampling)
+	relay.SetClientMetrics(config.ClientMetrics)
+	if config.NotifyTimeout > 0 {
+		relay.NotifyTimeout = config.NotifyTimeout
+	}
+
+	// Log files the rotate-logs action reopens, by name
+	logs := make(map[string]reopener)
+
+	var summarySinks []relay.SummarySink
+	if config.Summaries.File != "" {
+		sink, err := relay.NewFileSummarySink(config.Summaries.File)
+		if err != nil {
+			return fmt.Errorf("failed to open summary file: %w", err)
+		}
+		defer sink.Close()
+		summarySinks = append(summarySinks, sink)
+		logs["summaries"] = sink
+	}
+	if config.Summaries.URL != "" {
+		summarySinks = append(summarySinks, &relay.HTTPSummarySink{
+			URL:    config.Summaries.URL,
+			Client: &http.Client{Timeout: 5 * time.Second},
+		})
+	}
+	relay.SetSummarySinks(summarySinks...)
+	defer relay.SetSummarySinks() // writes the queued records before the sinks close
+
+	var eventPublishers []relay.EventPublisher
+	if config.Events.NATSURL != "" {
+		nats := &relay.NATSPublisher{
+			URL:     config.Events.NATSURL,
+			Subject: config.Events.NATSSubject,
+		}
+		defer nats.Close()
+		eventPublishers = append(eventPublishers, nats)
+	}
+	if config.Events.KafkaRESTURL != "" {
+		eventPublishers = append(eventPublishers, &relay.KafkaRESTPublisher{
+			URL:    config.Events.KafkaRESTURL,
+			Topic:  config.Events.KafkaTopic,
+			Client: &http.Client{Timeout: 5 * time.Second},
+		})
 	}
+	relay.SetEventPublishers(config.RelayConfig.NodeID, eventPublishers...)
+	defer relay.SetEventPublishers(config.RelayConfig.NodeID) // publishes the queued events before the publishers close
 
 	// Setup TLS
 	tlsConfig, err := setupTLS(config.CertFile, config.KeyFile)
 	if err != nil {
 		return fmt.Errorf("failed to setup TLS: %w", err)
 	}
+	if config.ClientCA != "" {
+		if err := verifyClientCerts(tlsConfig, config.ClientCA); err != nil {
+			return err
+		}
+		log.Printf("Client certificate authentication enabled: %d peer relays", len(config.RelayConfig.PeerIdentities))
+	}
+
+	// Write TLS session secrets for decrypting packet captures
+	var keyLog io.Writer
+	if relay.DebugBuild && config.Debug != nil && config.Debug.KeyLogFile != "" {
+		f, err := openLogFile(config.Debug.KeyLogFile, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open TLS key log: %w", err)
+		}
+		defer f.Close()
+		logs["tls_keylog"] = f
+		keyLog = f
+		tlsConfig.KeyLogWriter = keyLog
+		slog.Warn("TLS key logging enabled; traffic can be decrypted with this file", "file", config.Debug.KeyLogFile)
+	}
 
 	// Setup signal handling for graceful shutdown
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := serviceContext("qumo-relay")
 	defer cancel()
 
+	if *dev {
+		if err := startDevSDN(ctx); err != nil {
+			return err
+		}
+		printDevBanner(cert)
+	}
+
 	// Create relay relayServer
 	trackMux := moqt.NewTrackMux()
 	relayServer := &relay.Server{
@@ -69,52 +367,471 @@ func RunRelay(args []string) error {
 		},
 	}
 
-	// Set up SDN auto-announce client if configured
+	// Own the sockets so a new relay process can take them over
+	var handoff *relay.HandoffListener
+	var httpListener net.Listener
+	if config.Handoff {
+		handoff, httpListener, err = listenHandoff(config.Address)
+		if err != nil {
+			return fmt.Errorf("failed to set up live handoff: %w", err)
+		}
+		handoff.Tune(config.UDP)
+		relayServer.ListenFunc = handoff.ListenFunc
+		log.Printf("Live handoff enabled: generation %d", handoff.Generation())
+	} else {
+		// Own the QUIC sockets so they can be tuned, spreading the traffic
+		// over several of them if configured
+		var sockets *relay.ShardedListener
+		if config.ListenersPerCore > 0 {
+			shards := min(config.ListenersPerCore*runtime.GOMAXPROCS(0), relay.MaxListenerShards)
+			sockets, err = relay.ListenSharded(config.Address, shards)
+			if err != nil {
+				return fmt.Errorf("failed to set up sharded listeners: %w", err)
+			}
+			log.Printf("QUIC socket sharded over %d SO_REUSEPORT listeners", sockets.Shards())
+		} else if sockets, err = relay.ListenUDP(config.Address); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", config.Address, err)
+		}
+		defer sockets.Close()
+		sockets.Tune(config.UDP)
+		relayServer.ListenFunc = sockets.ListenFunc
+	}
+	if config.DisableGSO {
+		// quic-go checks this when it opens a transport
+		os.Setenv("QUIC_GO_DISABLE_GSO", "true")
+	}
+
+	metricsReg, metricsHandler := newMetricsRegistry(config.Metrics)
+
+	// Set up SDN auto-announce clients if configured
+	var sdnClient *sdn.Group
 	if config.SDNConfig != nil {
-		var err error
-		sdnClient, err := sdn.NewClient(*config.SDNConfig)
+		sdnClient, err = startSDN(ctx, relayServer, config.sdnConfigs()...)
 		if err != nil {
-			return fmt.Errorf("failed to create SDN client: %w", err)
+			return err
+		}
+		if err := sdn.RegisterClientMetrics(metricsReg, sdnClient); err != nil {
+			return fmt.Errorf("failed to register SDN client metrics: %w", err)
 		}
-		relayServer.AnnounceRegistrar = sdnClient
-		go sdnClient.Run(ctx)
 
-		// Start remote fetcher to discover and subscribe to remote broadcasts
-		fetcher := &relay.RemoteFetcher{
-			SDNClient:      sdnClient,
-			TrackMux:       trackMux,
-			TLSConfig:      tlsConfig,
-			GroupCacheSize: config.RelayConfig.GroupCacheSize,
+		// Validate the data plane to neighbors on the controller's schedule
+		if config.Probe != nil {
+			prober := &relay.MeshProber{
+				Coordinator:  sdnClient,
+				TrackMux:     trackMux,
+				TLSConfig:    tlsConfig,
+				PollInterval: config.Probe.Interval,
+				Frames:       config.Probe.Frames,
+			}
+			go prober.Run(ctx)
+		}
+	}
+
+	// Propagate announcements to peer relays directly, so discovery survives
+	// an SDN controller outage
+	var peerTable *relay.PeerAnnounceTable
+	if config.Peers != nil {
+		peerTable = startPeerAnnounce(ctx, relayServer, *config.Peers)
+	}
+
+	// Verify relayed groups against the checksums of the relay they came from
+	var integrity *relay.IntegrityVerifier
+	if config.Integrity != nil {
+		integrity = &relay.IntegrityVerifier{
+			Interval: config.Integrity.Interval,
+			Token:    config.Integrity.Token,
 		}
-		go fetcher.Run(ctx)
+		log.Println("Relay-to-relay integrity verification enabled")
+	}
+
+	// Have every relay on the SDN's path fetch from the next one on it
+	var chained *relay.ChainedFetch
+	if config.ChainedFetch != nil {
+		chained = &relay.ChainedFetch{Token: config.ChainedFetch.Token, HTTPS: config.ChainedFetch.HTTPS}
+		log.Println("Chained fetch along SDN paths enabled")
+	}
+
+	// Discover and subscribe to remote broadcasts
+	var fetcher *relay.RemoteFetcher
+	if sdnClient != nil || peerTable != nil {
+		var directory relay.SDNDirectory
+		if sdnClient != nil {
+			directory = sdnClient
+		}
+		fetcher = startRemoteFetcher(ctx, relayServer, directory, peerTable, config.Prefetch, integrity, chained, config.Compression, config.WarmCache)
+	}
+
+	// Serve additional relay identities on the same port, selected by SNI
+	var moqServer relayRunner = relayServer
+	if len(config.VirtualHosts) > 0 {
+		vhosts := &relay.VirtualHosts{
+			Addr:       config.Address,
+			QUICConfig: relayServer.QUICConfig,
+			ListenFunc: relayServer.ListenFunc,
+			Default:    relayServer,
+			Hosts:      make(map[string]*relay.Server, len(config.VirtualHosts)),
+		}
+		for _, vh := range config.VirtualHosts {
+			srv, err := newVirtualHost(ctx, vh, relayServer, config.Prefetch, integrity, chained, config.Compression)
+			if err != nil {
+				return fmt.Errorf("virtual host %s: %w", vh.Hostname, err)
+			}
+			if keyLog != nil {
+				srv.TLSConfig.KeyLogWriter = keyLog
+			}
+			vhosts.Hosts[vh.Hostname] = srv
+			log.Printf("Virtual host %s enabled", vh.Hostname)
+		}
+		moqServer = vhosts
 	}
 
 	// Register WebTransport handler on http.DefaultServeMux so that the
 	// webtransport-go HTTP/3 layer can route browser CONNECT requests to
 	// the relay's HandleWebTransport method.
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if err := relayServer.HandleWebTransport(w, r); err != nil {
+		if err := moqServer.HandleWebTransport(w, r); err != nil {
 			slog.Error("failed to handle web transport", "err", err)
 		}
 	})
 
-	mux := http.NewServeMux()
-	mux.Handle("/health", &healthHandler{
-		statusFunc: relayServer.Status,
+	// Start the loopback probe against this relay's own endpoint
+	var selfCheckFunc func() relay.SelfCheckStatus
+	if config.SelfCheck != nil {
+		selfCheck := &relay.SelfCheck{
+			URL:              config.SelfCheck.URL,
+			TLSConfig:        selfCheckTLS(config.SelfCheck.URL),
+			QUICConfig:       relayServer.QUICConfig,
+			Interval:         config.SelfCheck.Interval,
+			Timeout:          config.SelfCheck.Timeout,
+			FailureThreshold: config.SelfCheck.FailureThreshold,
+		}
+		relayServer.SelfCheck = selfCheck
+		go selfCheck.Run(ctx)
+		selfCheckFunc = selfCheck.Status
+	}
+
+	// Restart through the systemd watchdog if the data plane stays broken
+	go runWatchdog(ctx, func() bool {
+		return selfCheckFunc == nil || selfCheckFunc().Healthy
 	})
-	mux.Handle("/metrics", promhttp.Handler())
 
-	httpServer := &http.Server{
-		Addr:    config.Address,
-		Handler: mux,
+	mux := http.NewServeMux()
+	health := &healthHandler{
+		statusFunc:    relayServer.Status,
+		selfCheckFunc: selfCheckFunc,
+	}
+	var warmed <-chan struct{}
+	if fetcher != nil && config.WarmCache != nil {
+		health.warmingFunc = fetcher.Warming
+		warmed = fetcher.Ready()
+	}
+	if sdnClient != nil {
+		health.registeringFunc = sdnClient.Bootstrapping
+	}
+	var dependencies []dependencyCheck
+	if sdnClient != nil {
+		dependencies = append(dependencies, dependencyCheck{name: "sdn", check: sdnClient.Ping})
+	}
+	if fetcher != nil {
+		dependencies = append(dependencies, dependencyCheck{name: "upstream_relays", check: upstreamCheck(fetcher)})
+	}
+	if len(dependencies) > 0 {
+		health.deep = &deepProbe{checks: dependencies}
+	}
+	mux.Handle("/health", health)
+	mux.Handle("/metrics", metricsHandler)
+	mux.HandleFunc("/statusz", relay.StatuszHandlerFunc(relayServer))
+	mux.HandleFunc("/time", relay.TimeHandlerFunc())
+	if config.Demo {
+		mux.HandleFunc("/demo", relay.DemoHandlerFunc())
+		log.Println("Demo player enabled at /demo")
+	}
+	if err := relay.RegisterMetrics(metricsReg); err != nil {
+		return fmt.Errorf("failed to register metrics: %w", err)
+	}
+	if err := version.RegisterMetrics(metricsReg); err != nil {
+		return fmt.Errorf("failed to register metrics: %w", err)
+	}
+
+	// Runtime administration
+	mux.Handle("/admin/egress-limit", adminAuth(config.AdminToken, relay.EgressLimitHandlerFunc(relayServer)))
+	mux.Handle("/admin/publications", adminAuth(config.AdminToken, relay.PublicationsHandlerFunc()))
+	mux.Handle("/admin/sessions", adminAuth(config.AdminToken, relay.SessionsHandlerFunc(relayServer)))
+	mux.Handle("/admin/subscribers", adminAuth(config.AdminToken, relay.SubscribersHandlerFunc()))
+	mux.Handle("/admin/goroutines", adminAuth(config.AdminToken, relay.GoroutinesHandlerFunc()))
+	mux.Handle("/admin/buildinfo", adminAuth(config.AdminToken, relay.BuildInfoHandlerFunc()))
+	mux.Handle("/admin/config", adminAuth(config.AdminToken, configHandlerFunc(config)))
+	mux.Handle("/admin/tracks/", adminAuth(config.AdminToken, relay.TrackCacheHandlerFunc("/admin/tracks/")))
+	if config.Recordings != nil {
+		mux.Handle("/admin/recordings/", adminAuth(config.AdminToken, writeAuth(config.AdminToken, relay.RecordingsHandlerFunc(config.Recordings, "/admin/recordings/"))))
+	}
+	if sdnClient != nil {
+		mux.Handle("/admin/sdn", adminAuth(config.AdminToken, sdnStateHandlerFunc(sdnClient)))
+	}
+	// Actions change the running relay: refused without an admin token
+	actions := adminAuth(config.AdminToken, writeAuth(config.AdminToken, newActionsHandler(relayActions(sdnClient, logs)...)))
+	mux.Handle("/admin/actions", actions)
+	mux.Handle("/admin/actions/", actions)
+	if relay.DebugBuild && config.Debug != nil && config.Debug.Capture != nil {
+		mux.Handle("/admin/capture", adminAuth(config.AdminToken, relay.DebugCaptureHandlerFunc(config.Debug.Capture)))
+		log.Printf("Track capture enabled at /admin/capture: writing to %s", config.Debug.Capture.Dir)
+	}
+	shutdownTimeout := func() time.Duration { return 10 * time.Second }
+	if handoff != nil {
+		executable, _ := os.Executable()
+		upgrade := handoffUpgrader(handoff, httpListener, executable)
+		var handedOff atomic.Bool
+		drain := func() {
+			// The new process keeps the registrations and serves the
+			// sessions' reconnects, so let them end on their own
+			handedOff.Store(true)
+			if sdnClient != nil {
+				sdnClient.Detach()
+			}
+			cancel()
+		}
+		shutdownTimeout = func() time.Duration {
+			if handedOff.Load() {
+				return cmp.Or(config.HandoffDrain, defaultHandoffDrain)
+			}
+			return 10 * time.Second
+		}
+		mux.Handle("/admin/upgrade", adminAuth(config.AdminToken, upgradeHandlerFunc(upgrade, handoff.Generation(), drain)))
+	}
+
+	// Announcements pushed by peer relays
+	if peerTable != nil {
+		peerHandler := adminAuth(config.Peers.Token, relay.PeerAnnounceHandlerFunc(peerTable))
+		mux.Handle("/peer/announce", peerHandler)
+		mux.Handle("/peer/announce/", peerHandler)
+	}
+
+	// Group checksums for peers verifying what they relay from us
+	if config.Integrity != nil && config.Integrity.Token != "" {
+		mux.Handle(relay.PeerTracksPrefix, adminAuth(config.Integrity.Token, relay.PeerTracksHandlerFunc()))
+	}
+
+	// Fetches requested by the relays downstream on an SDN path
+	if config.ChainedFetch != nil && config.ChainedFetch.Token != "" && fetcher != nil {
+		mux.Handle(relay.PeerFetchPath, adminAuth(config.ChainedFetch.Token, relay.PeerFetchHandlerFunc(fetcher)))
+	}
+
+	// Collect publications whose announcement has ended
+	relay.StartPublicationSweeper(ctx, 30*time.Second)
+
+	// Refuse sessions and shrink caches near the cgroup's limits
+	if config.Resources != nil {
+		go config.Resources.Run(ctx)
+		log.Printf("Resource monitor enabled: cgroup %s", cmp.Or(config.Resources.CgroupDir, "of the process"))
+	}
+
+	// Flag tracks whose upstream stopped sending groups
+	if config.StaleTracks != nil {
+		go config.StaleTracks.Run(ctx)
+		log.Printf("Stale track watchdog enabled: timeout %s", config.StaleTracks.Timeout)
+	}
+
+	// Purge recordings past their retention
+	if config.Recordings != nil {
+		go config.Recordings.Run(ctx)
+		log.Printf("Recording retention enabled: %s, %d policies", config.Recordings.Dir, len(config.Recordings.Policies))
+	}
+
+	// Warn when goroutines grow without new sessions
+	if config.GoroutineLeaks != nil {
+		config.GoroutineLeaks.Sessions = func() int { return int(relayServer.Status().ActiveConnections) }
+		go config.GoroutineLeaks.Run(ctx)
+		log.Printf("Goroutine leak detector enabled: growth %d per %s",
+			cmp.Or(config.GoroutineLeaks.MinGrowth, relay.DefaultLeakMinGrowth),
+			cmp.Or(config.GoroutineLeaks.Interval, relay.DefaultLeakInterval))
+	}
+
+	httpServer := newHTTPServer(config.Address, mux, config.HTTP)
+	var httpRunner serverRunner = httpServer
+	if httpListener != nil {
+		httpRunner = listenerServer{Server: httpServer, ln: httpListener}
 	}
 
 	// Delegate to testable helper that runs servers until ctx is cancelled
-	serveComponents(ctx, relayServer, httpServer, 10*time.Second)
+	serveComponents(ctx, moqServer, httpRunner, warmed, shutdownTimeout)
+
+	if err := reportShutdown(relayServer.ShutdownReport(), sdnClient, config.ReportFile); err != nil {
+		log.Printf("Failed to write shutdown report: %v", err)
+	}
 
 	return nil
 }
 
+// startSDN registers srv with the SDN controllers under cfgs, the
+// primary first.
+func startSDN(ctx context.Context, srv *relay.Server, cfgs ...*sdn.ClientConfig) (*sdn.Group, error) {
+	clients := make([]*sdn.Client, len(cfgs))
+	for i, cfg := range cfgs {
+		cfg := *cfg
+		// Push data-plane summaries for the controller's cluster dashboard
+		cfg.StatsFunc = func() sdn.RelayStats {
+			st := srv.Stats()
+			stats := sdn.RelayStats{
+				Sessions:    int(st.ActiveConnections),
+				EgressBytes: st.EgressBytes,
+				Subscribers: st.Subscribers,
+				Health:      string(topology.HealthHealthy),
+			}
+			if pressure := relay.ResourcePressure(); pressure != "" {
+				stats.Health, stats.HealthReason = string(topology.HealthDegraded), "resource_pressure: "+pressure
+			}
+			return stats
+		}
+
+		client, err := sdn.NewClient(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SDN client: %w", err)
+		}
+		clients[i] = client
+	}
+	group, err := sdn.NewGroup(clients...)
+	if err != nil {
+		return nil, err
+	}
+	srv.AnnounceRegistrar = group
+	srv.SDNState = func() string { return string(group.State()) }
+	go group.Run(ctx)
+
+	if len(clients) > 1 {
+		names := make([]string, len(clients))
+		for i, c := range clients {
+			names[i] = c.ControllerName()
+		}
+		log.Printf("Registering with %d SDN controllers: %s (primary first)", len(clients), strings.Join(names, ", "))
+	}
+	return group, nil
+}
+
+// startPeerAnnounce pushes srv's announcements to the peers in cfg, in
+// addition to its current registrar, and returns the table receiving
+// theirs.
+func startPeerAnnounce(ctx context.Context, srv *relay.Server, cfg peersConfig) *relay.PeerAnnounceTable {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = relay.DefaultPeerAnnounceInterval
+	}
+
+	announcer := &relay.PeerAnnouncer{
+		Next:      srv.AnnounceRegistrar,
+		RelayName: cfg.RelayName,
+		Address:   cfg.Address,
+		Peers:     cfg.URLs,
+		Token:     cfg.Token,
+		Interval:  interval,
+	}
+	srv.AnnounceRegistrar = announcer
+	go announcer.Run(ctx)
+
+	log.Printf("Peer announce propagation enabled: %d peers", len(cfg.URLs))
+	return relay.NewPeerAnnounceTable(3 * interval)
+}
+
+// startRemoteFetcher serves the broadcasts announced to client or peers
+// on srv's TrackMux, running the controller's replication prefetches if
+// prefetch is set, verifying relayed groups with integrity, asking next
+// hops to fetch along the SDN path with chained, fetching the broadcasts
+// selected by compression compressed and preloading the broadcasts
+// recorded by warm if they are not nil. Either of client and peers may be
+// nil.
+func startRemoteFetcher(ctx context.Context, srv *relay.Server, client relay.SDNDirectory, peers *relay.PeerAnnounceTable, prefetch bool, integrity *relay.IntegrityVerifier, chained *relay.ChainedFetch, compression *relay.TrackCompression, warm *warmCacheConfig) *relay.RemoteFetcher {
+	fetcher := &relay.RemoteFetcher{
+		SDNClient:      client,
+		Peers:          peers,
+		TrackMux:       srv.TrackMux,
+		TLSConfig:      srv.TLSConfig,
+		GroupCacheSize: srv.Config.GroupCacheSize,
+		Authorizer:     srv.Authorizer,
+		EgressPool:     srv.EgressPool(),
+		PeerIdentities: srv.Config.PeerIdentities,
+		Prefetch:       prefetch,
+		Integrity:      integrity,
+		ChainedFetch:   chained,
+		Compression:    compression,
+
+		GroupStallTimeout: srv.Config.GroupStallTimeout,
+		GroupBudgets:      srv.Config.GroupBudgets,
+
+		EgressWriteTimeout: srv.Config.EgressWriteTimeout,
+	}
+	if group, ok := client.(*sdn.Group); ok {
+		// Ask the SDN only once the relay is registered with it
+		fetcher.SDNReady = group.Bootstrapped()
+	}
+	if compression != nil {
+		log.Printf("Relay-to-relay compression enabled: %s", strings.Join(compression.Prefixes, ", "))
+	}
+	if warm != nil {
+		fetcher.WarmFile = warm.File
+		fetcher.WarmMaxAge = warm.MaxAge
+		fetcher.WarmTimeout = warm.Timeout
+		log.Printf("Warm cache preloading enabled: %s", warm.File)
+	}
+	go fetcher.Run(ctx)
+	return fetcher
+}
+
+// newVirtualHost returns the relay serving vh, configured like base but
+// with its own certificate, TrackMux and SDN registration.
+func newVirtualHost(ctx context.Context, vh virtualHostConfig, base *relay.Server, prefetch bool, integrity *relay.IntegrityVerifier, chained *relay.ChainedFetch, compression *relay.TrackCompression) (*relay.Server, error) {
+	tlsConfig, err := setupTLS(vh.CertFile, vh.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientAuth, tlsConfig.ClientCAs = base.TLSConfig.ClientAuth, base.TLSConfig.ClientCAs
+
+	srv := &relay.Server{
+		Addr:            base.Addr,
+		TLSConfig:       tlsConfig,
+		QUICConfig:      base.QUICConfig,
+		Config:          base.Config,
+		TrackMux:        moqt.NewTrackMux(),
+		Authorizer:      base.Authorizer,
+		CheckHTTPOrigin: base.CheckHTTPOrigin,
+	}
+	if vh.SDNConfig != nil {
+		client, err := startSDN(ctx, srv, vh.SDNConfig)
+		if err != nil {
+			return nil, err
+		}
+		startRemoteFetcher(ctx, srv, client, nil, prefetch, integrity, chained, compression, nil)
+	}
+	return srv, nil
+}
+
+// reportShutdown logs the relay's shutdown report, completed with the SDN
+// deregistration results, and writes it as JSON to path if set.
+func reportShutdown(report *relay.ShutdownReport, sdnClient *sdn.Group, path string) error {
+	if report == nil {
+		return nil
+	}
+
+	if sdnClient != nil {
+		select {
+		case <-sdnClient.Done():
+			res := sdnClient.DeregisterResult()
+			report.SDN = &res
+		case <-time.After(10 * time.Second):
+			slog.Warn("sdn client did not stop in time; omitting deregistration results")
+		}
+	}
+
+	slog.Info("shutdown report", "report", *report)
+
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
 // serverRunner is a minimal interface implemented by both *relay.Server and
 // *http.Server so we can unit-test the run/shutdown flow with fakes.
 type serverRunner interface {
@@ -122,10 +839,50 @@ type serverRunner interface {
 	Shutdown(ctx context.Context) error
 }
 
+// listenerServer serves an *http.Server on a listener it was given, such
+// as one inherited from the process it took over from.
+type listenerServer struct {
+	*http.Server
+	ln net.Listener
+}
+
+func (s listenerServer) ListenAndServe() error {
+	return s.Serve(s.ln)
+}
+
+// listenHandoff returns the relay's handoff listener for addr and the TCP
+// listener of its HTTP server, both inherited from the previous process
+// after an upgrade.
+func listenHandoff(addr string) (*relay.HandoffListener, net.Listener, error) {
+	h, files, err := relay.ListenHandoff(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		ln, err := net.Listen("tcp", addr)
+		return h, ln, err
+	}
+	for _, f := range files[1:] {
+		f.Close()
+	}
+	ln, err := net.FileListener(files[0])
+	files[0].Close()
+	return h, ln, err
+}
+
+// relayRunner is a serverRunner that also accepts WebTransport upgrades,
+// implemented by *relay.Server and *relay.VirtualHosts.
+type relayRunner interface {
+	serverRunner
+	HandleWebTransport(w http.ResponseWriter, r *http.Request) error
+}
+
 // serveComponents starts the provided servers and blocks until ctx is cancelled.
 // It intentionally mirrors the previous RunRelay behavior: ListenAndServe
-// errors are logged but do not abort the shutdown sequence.
-func serveComponents(ctx context.Context, relaySrv serverRunner, httpSrv serverRunner, shutdownTimeout time.Duration) {
+// errors are logged but do not abort the shutdown sequence. If ready is not
+// nil, the service manager is told the relay is ready once it is closed.
+// The drain is bounded by shutdownTimeout, asked once ctx is cancelled.
+func serveComponents(ctx context.Context, relaySrv serverRunner, httpSrv serverRunner, ready <-chan struct{}, shutdownTimeout func() time.Duration) {
 	// Start servers (errors from ListenAndServe are logged but ignored here)
 	go func() {
 		if err := relaySrv.ListenAndServe(); err != nil {
@@ -144,16 +901,26 @@ func serveComponents(ctx context.Context, relaySrv serverRunner, httpSrv serverR
 
 	log.Println("Server started successfully")
 	log.Println("  /             - WebTransport & MoQ endpoint")
-	log.Println("  /health       - Health check (?probe=live|ready)")
+	log.Println("  /health       - Health check (?probe=live|ready|selfcheck)")
 	log.Println("  /metrics      - Prometheus metrics")
+	log.Println("  /statusz      - Public status page (HTML, ?format=json)")
+	log.Println("  /admin/...    - Runtime administration (bearer token)")
+	if ready != nil {
+		select {
+		case <-ready:
+		case <-ctx.Done():
+		}
+	}
+	serviceReady()
 
 	// Wait for cancellation
 	<-ctx.Done()
+	serviceStopping()
 
 	slog.Info("Shutting down server...")
 
 	// Graceful shutdown with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout())
 	defer shutdownCancel()
 
 	if err := relaySrv.Shutdown(shutdownCtx); err != nil {
@@ -167,31 +934,265 @@ func serveComponents(ctx context.Context, relaySrv serverRunner, httpSrv serverR
 	slog.Info("Server stopped")
 }
 
+// relaySDNYAML is one controller of the relay's `sdn` section.
+type relaySDNYAML struct {
+	Name              string             `yaml:"name"`
+	Primary           bool               `yaml:"primary"`
+	URL               secretString       `yaml:"url"`
+	RelayName         string             `yaml:"relay_name"`
+	HeartbeatInterval int                `yaml:"heartbeat_interval_sec"`
+	TopologyInterval  int                `yaml:"topology_interval_sec"`
+	Address           string             `yaml:"address"`
+	Neighbors         map[string]float64 `yaml:"neighbors"`
+	Symmetric         bool               `yaml:"symmetric"`
+	Zone              string             `yaml:"zone"`
+	Token             secretString       `yaml:"token"`
+	Prefetch          bool               `yaml:"prefetch"`
+	Probe             *struct {
+		Enabled     bool `yaml:"enabled"`
+		IntervalSec int  `yaml:"interval_sec"`
+		Frames      int  `yaml:"frames"`
+	} `yaml:"probe"`
+	Location *struct {
+		Lat float64 `yaml:"lat"`
+		Lon float64 `yaml:"lon"`
+	} `yaml:"location"`
+	TLS *struct {
+		CertFile refString    `yaml:"cert_file"`
+		KeyFile  secretString `yaml:"key_file"`
+		CAFile   refString    `yaml:"ca_file"`
+	} `yaml:"tls"`
+
+	// WaitForRegistration holds readiness until the relay first registered
+	// with this controller.
+	WaitForRegistration bool `yaml:"wait_for_registration"`
+}
+
+// clientConfig returns the client settings for the controller, with the
+// relay's node ID and region filling in its identity.
+func (y relaySDNYAML) clientConfig(nodeID, region string) *sdn.ClientConfig {
+	cfg := &sdn.ClientConfig{
+		URL:       string(y.URL),
+		Name:      y.Name,
+		RelayName: cmp.Or(y.RelayName, nodeID),
+		Region:    region,
+		Address:   y.Address,
+		Neighbors: y.Neighbors,
+		Symmetric: y.Symmetric,
+		Zone:      y.Zone,
+		Token:     string(y.Token),
+
+		WaitForRegistration: y.WaitForRegistration,
+	}
+	if y.Location != nil {
+		cfg.Location = &topology.Location{
+			Lat: y.Location.Lat,
+			Lon: y.Location.Lon,
+		}
+	}
+	if y.HeartbeatInterval > 0 {
+		cfg.HeartbeatInterval = time.Duration(y.HeartbeatInterval) * time.Second
+	}
+	if y.TopologyInterval > 0 {
+		cfg.TopologyInterval = time.Duration(y.TopologyInterval) * time.Second
+	}
+	if y.TLS != nil {
+		cfg.TLS = &sdn.TLSConfig{
+			CertFile: string(y.TLS.CertFile),
+			KeyFile:  string(y.TLS.KeyFile),
+			CAFile:   string(y.TLS.CAFile),
+		}
+	}
+	return cfg
+}
+
+// relaySDNListYAML is the relay's `sdn` section: a single controller, or a
+// list of controllers the relay registers with at once.
+type relaySDNListYAML []relaySDNYAML
+
+func (l *relaySDNListYAML) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		var one relaySDNYAML
+		if err := node.Decode(&one); err != nil {
+			return err
+		}
+		*l = relaySDNListYAML{one}
+		return nil
+	}
+	var many []relaySDNYAML
+	if err := node.Decode(&many); err != nil {
+		return err
+	}
+	*l = many
+	return nil
+}
+
 func loadConfig(filename string) (*config, error) {
 	type yamlConfig struct {
 		Server struct {
-			Address  string `yaml:"address"`
-			CertFile string `yaml:"cert_file"`
-			KeyFile  string `yaml:"key_file"`
+			Address      string       `yaml:"address"`
+			CertFile     refString    `yaml:"cert_file"`
+			KeyFile      secretString `yaml:"key_file"`
+			ClientCAFile refString    `yaml:"client_ca_file"`
+
+			ShutdownReportFile refString `yaml:"shutdown_report_file"`
+
+			Handoff         bool `yaml:"handoff"`
+			HandoffDrainSec int  `yaml:"handoff_drain_sec"`
+
+			ListenersPerCore int `yaml:"listeners_per_core"`
+
+			UDP struct {
+				ReceiveBufferBytes int  `yaml:"receive_buffer_bytes"`
+				SendBufferBytes    int  `yaml:"send_buffer_bytes"`
+				DisableGSO         bool `yaml:"disable_gso"`
+			} `yaml:"udp"`
+
+			Demo bool `yaml:"demo"`
 		} `yaml:"server"`
 		Relay struct {
 			NodeID         string `yaml:"node_id"`
 			Region         string `yaml:"region"`
 			GroupCacheSize int    `yaml:"group_cache_size"`
 			FrameCapacity  int    `yaml:"frame_capacity"`
+
+			AnnounceMetadata map[string]*sdn.AnnounceMetadata `yaml:"announce_metadata"`
+			PeerIdentities   []string                         `yaml:"peer_identities"`
+
+			EgressLimit   int64 `yaml:"egress_limit_bytes_per_sec"`
+			EgressWorkers int   `yaml:"egress_workers"`
+
+			MaxSessions   int `yaml:"max_sessions"`
+			RetryAfterSec int `yaml:"retry_after_sec"`
+
+			Versions []string `yaml:"versions"`
+
+			NotifyTimeoutMs int `yaml:"notify_timeout_ms"`
+
+			EgressWriteTimeoutMs int `yaml:"egress_write_timeout_ms"`
+
+			GroupBudgets []struct {
+				Prefix             string `yaml:"prefix"`
+				Track              string `yaml:"track"`
+				MaxGroupDurationMs int    `yaml:"max_group_duration_ms"`
+			} `yaml:"group_budgets"`
+
+			StaleTrack struct {
+				TimeoutSec  int  `yaml:"timeout_sec"`
+				Resubscribe bool `yaml:"resubscribe"`
+			} `yaml:"stale_track"`
+
+			GoroutineLeaks struct {
+				Enabled     bool `yaml:"enabled"`
+				IntervalSec int  `yaml:"interval_sec"`
+				MinGrowth   int  `yaml:"min_growth"`
+			} `yaml:"goroutine_leaks"`
+
+			Resources struct {
+				Enabled         bool      `yaml:"enabled"`
+				CgroupDir       refString `yaml:"cgroup_dir"`
+				IntervalSec     int       `yaml:"interval_sec"`
+				MemoryThreshold float64   `yaml:"memory_threshold"`
+				CPUThreshold    float64   `yaml:"cpu_threshold"`
+				Sustain         int       `yaml:"sustain_samples"`
+				KeepGroups      int       `yaml:"keep_groups"`
+			} `yaml:"resources"`
+
+			WarmCache struct {
+				File       refString `yaml:"file"`
+				MaxAgeSec  int       `yaml:"max_age_sec"`
+				TimeoutSec int       `yaml:"timeout_sec"`
+			} `yaml:"warm_cache"`
+
+			Recordings struct {
+				Dir         refString `yaml:"dir"`
+				IntervalSec int       `yaml:"interval_sec"`
+				Extensions  []string  `yaml:"extensions"`
+				Retention   []struct {
+					Prefix    string `yaml:"prefix"`
+					MaxAgeSec int    `yaml:"max_age_sec"`
+					MaxBytes  int64  `yaml:"max_bytes"`
+				} `yaml:"retention"`
+			} `yaml:"recordings"`
+
+			Compression struct {
+				Prefixes []string `yaml:"prefixes"`
+			} `yaml:"compression"`
+
+			ClientMetrics struct {
+				TopK int          `yaml:"top_k"`
+				Salt secretString `yaml:"salt"`
+			} `yaml:"client_metrics"`
+
+			Summaries struct {
+				File refString    `yaml:"file"`
+				URL  secretString `yaml:"url"`
+			} `yaml:"summaries"`
+
+			Events struct {
+				NATS struct {
+					URL     secretString `yaml:"url"`
+					Subject string       `yaml:"subject"`
+				} `yaml:"nats"`
+				Kafka struct {
+					RESTURL secretString `yaml:"rest_url"`
+					Topic   string       `yaml:"topic"`
+				} `yaml:"kafka"`
+			} `yaml:"events"`
 		} `yaml:"relay"`
-		SDN *struct {
-			URL               string             `yaml:"url"`
-			RelayName         string             `yaml:"relay_name"`
-			HeartbeatInterval int                `yaml:"heartbeat_interval_sec"`
-			Address           string             `yaml:"address"`
-			Neighbors         map[string]float64 `yaml:"neighbors"`
-			TLS               *struct {
-				CertFile string `yaml:"cert_file"`
-				KeyFile  string `yaml:"key_file"`
-				CAFile   string `yaml:"ca_file"`
-			} `yaml:"tls"`
-		} `yaml:"sdn"`
+		Admin struct {
+			Token secretString `yaml:"token"`
+		} `yaml:"admin"`
+		HTTP    httpLimitsYAML    `yaml:"http"`
+		Metrics metricsConfigYAML `yaml:"metrics"`
+		Logging struct {
+			Sampling struct {
+				Every     int `yaml:"every"`
+				PerSecond int `yaml:"per_second"`
+			} `yaml:"sampling"`
+		} `yaml:"logging"`
+		SelfCheck struct {
+			Enabled          bool      `yaml:"enabled"`
+			URL              refString `yaml:"url"`
+			IntervalSec      int       `yaml:"interval_sec"`
+			TimeoutSec       int       `yaml:"timeout_sec"`
+			FailureThreshold int       `yaml:"failure_threshold"`
+		} `yaml:"selfcheck"`
+		SDN   relaySDNListYAML `yaml:"sdn"`
+		Peers *struct {
+			RelayName   string       `yaml:"relay_name"`
+			Address     string       `yaml:"address"`
+			URLs        []refString  `yaml:"urls"`
+			Token       secretString `yaml:"token"`
+			IntervalSec int          `yaml:"interval_sec"`
+		} `yaml:"peers"`
+		Integrity *struct {
+			Enabled     bool         `yaml:"enabled"`
+			Token       secretString `yaml:"token"`
+			IntervalSec int          `yaml:"interval_sec"`
+		} `yaml:"integrity"`
+		ChainedFetch *struct {
+			Enabled bool         `yaml:"enabled"`
+			Token   secretString `yaml:"token"`
+			HTTPS   bool         `yaml:"https"`
+		} `yaml:"chained_fetch"`
+		Debug *struct {
+			Enabled          bool      `yaml:"enabled"`
+			TLSKeyLogFile    refString `yaml:"tls_keylog_file"`
+			CaptureDir       refString `yaml:"capture_dir"`
+			MaxCaptureGroups int       `yaml:"max_capture_groups"`
+		} `yaml:"debug"`
+		VirtualHosts []struct {
+			Hostname string       `yaml:"hostname"`
+			CertFile refString    `yaml:"cert_file"`
+			KeyFile  secretString `yaml:"key_file"`
+			SDN      *struct {
+				RelayName string             `yaml:"relay_name"`
+				Address   string             `yaml:"address"`
+				Neighbors map[string]float64 `yaml:"neighbors"`
+				Token     secretString       `yaml:"token"`
+			} `yaml:"sdn"`
+		} `yaml:"virtual_hosts"`
 	}
 
 	file, err := os.Open(filename)
@@ -216,46 +1217,366 @@ func loadConfig(filename string) (*config, error) {
 
 	config := &config{
 		Address:  ymlConfig.Server.Address,
-		CertFile: ymlConfig.Server.CertFile,
-		KeyFile:  ymlConfig.Server.KeyFile,
+		CertFile: string(ymlConfig.Server.CertFile),
+		KeyFile:  string(ymlConfig.Server.KeyFile),
+		ClientCA: string(ymlConfig.Server.ClientCAFile),
 		RelayConfig: relay.Config{
 			NodeID:         ymlConfig.Relay.NodeID,
 			Region:         ymlConfig.Relay.Region,
 			FrameCapacity:  ymlConfig.Relay.FrameCapacity,
 			GroupCacheSize: ymlConfig.Relay.GroupCacheSize,
+
+			AnnounceMetadata: ymlConfig.Relay.AnnounceMetadata,
+			PeerIdentities:   ymlConfig.Relay.PeerIdentities,
+			EgressLimit:      ymlConfig.Relay.EgressLimit,
+			EgressWorkers:    ymlConfig.Relay.EgressWorkers,
+			MaxSessions:      ymlConfig.Relay.MaxSessions,
+			RetryAfter:       time.Duration(ymlConfig.Relay.RetryAfterSec) * time.Second,
+
+			EgressWriteTimeout: time.Duration(ymlConfig.Relay.EgressWriteTimeoutMs) * time.Millisecond,
+		},
+		AdminToken:       string(ymlConfig.Admin.Token),
+		ReportFile:       string(ymlConfig.Server.ShutdownReportFile),
+		Handoff:          ymlConfig.Server.Handoff,
+		HandoffDrain:     time.Duration(ymlConfig.Server.HandoffDrainSec) * time.Second,
+		ListenersPerCore: ymlConfig.Server.ListenersPerCore,
+		UDP: relay.UDPTuning{
+			ReceiveBuffer: ymlConfig.Server.UDP.ReceiveBufferBytes,
+			SendBuffer:    ymlConfig.Server.UDP.SendBufferBytes,
+		},
+		DisableGSO:    ymlConfig.Server.UDP.DisableGSO,
+		Demo:          ymlConfig.Server.Demo,
+		NotifyTimeout: time.Duration(ymlConfig.Relay.NotifyTimeoutMs) * time.Millisecond,
+		LogSampling: relay.LogSampling{
+			Every:     ymlConfig.Logging.Sampling.Every,
+			PerSecond: ymlConfig.Logging.Sampling.PerSecond,
+		},
+		ClientMetrics: relay.ClientMetrics{
+			TopK: ymlConfig.Relay.ClientMetrics.TopK,
+			Salt: string(ymlConfig.Relay.ClientMetrics.Salt),
+		},
+		Summaries: summariesConfig{
+			File: string(ymlConfig.Relay.Summaries.File),
+			URL:  string(ymlConfig.Relay.Summaries.URL),
+		},
+		Events: eventsConfig{
+			NATSURL:      string(ymlConfig.Relay.Events.NATS.URL),
+			NATSSubject:  ymlConfig.Relay.Events.NATS.Subject,
+			KafkaRESTURL: string(ymlConfig.Relay.Events.Kafka.RESTURL),
+			KafkaTopic:   ymlConfig.Relay.Events.Kafka.Topic,
 		},
 	}
 
-	// Parse optional SDN auto-announce config
-	if ymlConfig.SDN != nil && ymlConfig.SDN.URL != "" {
-		sdnCfg := &sdn.ClientConfig{
-			URL:       ymlConfig.SDN.URL,
-			RelayName: ymlConfig.SDN.RelayName,
-			Region:    ymlConfig.Relay.Region,
-			Address:   ymlConfig.SDN.Address,
-			Neighbors: ymlConfig.SDN.Neighbors,
+	if len(config.RelayConfig.PeerIdentities) > 0 && config.ClientCA == "" {
+		return nil, fmt.Errorf("relay.peer_identities requires server.client_ca_file to authenticate the peers")
+	}
+
+	// Parse accepted MoQ versions
+	for _, name := range ymlConfig.Relay.Versions {
+		v, err := relay.ParseVersion(name)
+		if err != nil {
+			return nil, fmt.Errorf("relay.versions: %w", err)
 		}
-		if sdnCfg.RelayName == "" {
-			sdnCfg.RelayName = ymlConfig.Relay.NodeID
+		if slices.Contains(config.RelayConfig.Versions, v) {
+			return nil, fmt.Errorf("relay.versions: %s listed twice", name)
 		}
-		if ymlConfig.SDN.HeartbeatInterval > 0 {
-			sdnCfg.HeartbeatInterval = time.Duration(ymlConfig.SDN.HeartbeatInterval) * time.Second
+		config.RelayConfig.Versions = append(config.RelayConfig.Versions, v)
+	}
+
+	// Parse group duration budgets
+	for i, gb := range ymlConfig.Relay.GroupBudgets {
+		if gb.MaxGroupDurationMs <= 0 {
+			return nil, fmt.Errorf("relay.group_budgets[%d].max_group_duration_ms must be positive", i)
+		}
+		config.RelayConfig.GroupBudgets = append(config.RelayConfig.GroupBudgets, relay.GroupBudget{
+			Prefix:           gb.Prefix,
+			Track:            gb.Track,
+			MaxGroupDuration: time.Duration(gb.MaxGroupDurationMs) * time.Millisecond,
+		})
+	}
+
+	// Parse optional stale upstream watchdog
+	st := ymlConfig.Relay.StaleTrack
+	if st.TimeoutSec < 0 {
+		return nil, fmt.Errorf("relay.stale_track.timeout_sec must not be negative")
+	}
+	if st.TimeoutSec > 0 {
+		config.StaleTracks = &relay.StaleTrackWatchdog{
+			Timeout:     time.Duration(st.TimeoutSec) * time.Second,
+			Resubscribe: st.Resubscribe,
 		}
-		if ymlConfig.SDN.TLS != nil {
-			sdnCfg.TLS = &sdn.TLSConfig{
-				CertFile: ymlConfig.SDN.TLS.CertFile,
-				KeyFile:  ymlConfig.SDN.TLS.KeyFile,
-				CAFile:   ymlConfig.SDN.TLS.CAFile,
+	}
+
+	// Parse optional goroutine leak detector
+	if gl := ymlConfig.Relay.GoroutineLeaks; gl.Enabled {
+		if gl.IntervalSec < 0 || gl.MinGrowth < 0 {
+			return nil, fmt.Errorf("relay.goroutine_leaks: interval_sec and min_growth must not be negative")
+		}
+		config.GoroutineLeaks = &relay.GoroutineLeakDetector{
+			Interval:  time.Duration(gl.IntervalSec) * time.Second,
+			MinGrowth: gl.MinGrowth,
+		}
+	}
+
+	// Parse optional cgroup resource monitor
+	if rc := ymlConfig.Relay.Resources; rc.Enabled {
+		if rc.IntervalSec < 0 || rc.Sustain < 0 || rc.KeepGroups < 0 ||
+			rc.MemoryThreshold < 0 || rc.MemoryThreshold > 1 || rc.CPUThreshold < 0 || rc.CPUThreshold > 1 {
+			return nil, fmt.Errorf("relay.resources: thresholds must be within 0..1, other values not negative")
+		}
+		config.Resources = &relay.ResourceMonitor{
+			CgroupDir:       string(rc.CgroupDir),
+			Interval:        time.Duration(rc.IntervalSec) * time.Second,
+			MemoryThreshold: rc.MemoryThreshold,
+			CPUThreshold:    rc.CPUThreshold,
+			Sustain:         rc.Sustain,
+			KeepGroups:      rc.KeepGroups,
+		}
+	}
+
+	// Parse optional warm cache preloading
+	if wc := ymlConfig.Relay.WarmCache; wc.File != "" {
+		if wc.MaxAgeSec < 0 || wc.TimeoutSec < 0 {
+			return nil, fmt.Errorf("relay.warm_cache: max_age_sec and timeout_sec must not be negative")
+		}
+		config.WarmCache = &warmCacheConfig{
+			File:    string(wc.File),
+			MaxAge:  time.Duration(wc.MaxAgeSec) * time.Second,
+			Timeout: time.Duration(wc.TimeoutSec) * time.Second,
+		}
+	}
+
+	// Parse optional recording retention
+	if rc := ymlConfig.Relay.Recordings; rc.Dir != "" {
+		if rc.IntervalSec < 0 {
+			return nil, fmt.Errorf("relay.recordings.interval_sec must not be negative")
+		}
+		for _, ext := range rc.Extensions {
+			if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+				return nil, fmt.Errorf("relay.recordings.extensions: %q must start with a dot", ext)
+			}
+		}
+		retention := &relay.RecordingRetention{
+			Dir:        string(rc.Dir),
+			Interval:   time.Duration(rc.IntervalSec) * time.Second,
+			Extensions: rc.Extensions,
+		}
+		for _, p := range rc.Retention {
+			if !strings.HasPrefix(p.Prefix, "/") {
+				return nil, fmt.Errorf("relay.recordings.retention: prefix %q must start with /", p.Prefix)
 			}
+			if p.MaxAgeSec < 0 || p.MaxBytes < 0 {
+				return nil, fmt.Errorf("relay.recordings.retention %q: max_age_sec and max_bytes must not be negative", p.Prefix)
+			}
+			retention.Policies = append(retention.Policies, relay.RetentionPolicy{
+				Prefix:   p.Prefix,
+				MaxAge:   time.Duration(p.MaxAgeSec) * time.Second,
+				MaxBytes: p.MaxBytes,
+			})
 		}
-		config.SDNConfig = sdnCfg
+		config.Recordings = retention
+	}
+
+	if n := config.ListenersPerCore; n < 0 {
+		return nil, fmt.Errorf("server.listeners_per_core must not be negative, got %d", n)
+	} else if n > 0 && config.Handoff {
+		return nil, fmt.Errorf("server.listeners_per_core cannot be combined with server.handoff")
+	}
+	if config.HandoffDrain < 0 {
+		return nil, fmt.Errorf("server.handoff_drain_sec must not be negative")
+	}
+
+	if config.UDP.ReceiveBuffer < 0 || config.UDP.SendBuffer < 0 {
+		return nil, fmt.Errorf("server.udp: buffer sizes must not be negative")
+	}
+
+	if config.HTTP, err = ymlConfig.HTTP.limits(); err != nil {
+		return nil, err
+	}
+	if config.Metrics, err = ymlConfig.Metrics.config(); err != nil {
+		return nil, err
+	}
+
+	// Parse optional relay-to-relay compression
+	if prefixes := ymlConfig.Relay.Compression.Prefixes; len(prefixes) > 0 {
+		for _, prefix := range prefixes {
+			if !strings.HasPrefix(prefix, "/") {
+				return nil, fmt.Errorf("relay.compression.prefixes: %q must start with /", prefix)
+			}
+		}
+		config.Compression = &relay.TrackCompression{Prefixes: prefixes}
+		config.RelayConfig.Compression = config.Compression
+	}
+
+	// Parse optional loopback probe config
+	if sc := ymlConfig.SelfCheck; sc.Enabled {
+		target := string(sc.URL)
+		if target == "" {
+			target = "https://" + net.JoinHostPort("localhost", portOf(config.Address))
+		}
+		config.SelfCheck = &selfCheckConfig{
+			URL:              target,
+			Interval:         time.Duration(sc.IntervalSec) * time.Second,
+			Timeout:          time.Duration(sc.TimeoutSec) * time.Second,
+			FailureThreshold: sc.FailureThreshold,
+		}
+	}
+
+	// Parse optional SDN auto-announce config: the primary controller,
+	// marked or the first one, and the others in failover order
+	primary := -1
+	names := make(map[string]bool)
+	for i, y := range ymlConfig.SDN {
+		switch {
+		case y.URL == "":
+			continue
+		case len(ymlConfig.SDN) > 1 && y.Name == "":
+			return nil, fmt.Errorf("sdn[%d]: name is required with several controllers", i)
+		case names[y.Name]:
+			return nil, fmt.Errorf("sdn[%d]: duplicate controller name %q", i, y.Name)
+		case y.Primary && primary >= 0 && ymlConfig.SDN[primary].Primary:
+			return nil, fmt.Errorf("sdn[%d]: only one controller can be primary", i)
+		case y.Primary || primary < 0:
+			primary = i
+		}
+		names[y.Name] = true
+	}
+	for i, y := range ymlConfig.SDN {
+		switch {
+		case y.URL == "":
+		case i == primary:
+			config.SDNConfig = y.clientConfig(ymlConfig.Relay.NodeID, ymlConfig.Relay.Region)
+		case y.Prefetch || y.Probe != nil:
+			return nil, fmt.Errorf("sdn[%d]: prefetch and probe are taken from the primary controller only", i)
+		default:
+			config.SDNSecondaries = append(config.SDNSecondaries, y.clientConfig(ymlConfig.Relay.NodeID, ymlConfig.Relay.Region))
+		}
+	}
+	if primary >= 0 {
+		config.Prefetch = ymlConfig.SDN[primary].Prefetch
+
+		if p := ymlConfig.SDN[primary].Probe; p != nil && p.Enabled {
+			config.Probe = &probeConfig{
+				Interval: time.Duration(p.IntervalSec) * time.Second,
+				Frames:   p.Frames,
+			}
+		}
+	}
+
+	// Parse optional peer announce propagation
+	if p := ymlConfig.Peers; p != nil && len(p.URLs) > 0 {
+		peers := &peersConfig{
+			RelayName: p.RelayName,
+			Address:   p.Address,
+			URLs:      refStrings(p.URLs),
+			Token:     string(p.Token),
+			Interval:  time.Duration(p.IntervalSec) * time.Second,
+		}
+		if peers.RelayName == "" && config.SDNConfig != nil {
+			peers.RelayName = config.SDNConfig.RelayName
+		}
+		if peers.RelayName == "" {
+			peers.RelayName = ymlConfig.Relay.NodeID
+		}
+		if peers.Address == "" && config.SDNConfig != nil {
+			peers.Address = config.SDNConfig.Address
+		}
+		if peers.RelayName == "" || peers.Address == "" {
+			return nil, fmt.Errorf("peers: relay_name (or relay.node_id) and address are required")
+		}
+		config.Peers = peers
+	}
+
+	// Parse optional relay-to-relay integrity verification
+	if in := ymlConfig.Integrity; in != nil && in.Enabled {
+		if in.IntervalSec < 0 {
+			return nil, fmt.Errorf("integrity: interval_sec must not be negative")
+		}
+		if in.Token == "" {
+			return nil, fmt.Errorf("integrity requires integrity.token to authenticate the peers")
+		}
+		config.Integrity = &integrityConfig{
+			Token:    string(in.Token),
+			Interval: time.Duration(in.IntervalSec) * time.Second,
+		}
+	}
+
+	// Parse optional chained fetch along SDN paths
+	if cf := ymlConfig.ChainedFetch; cf != nil && cf.Enabled {
+		if cf.Token == "" {
+			return nil, fmt.Errorf("chained_fetch requires chained_fetch.token to authenticate the peers")
+		}
+		if !cf.HTTPS {
+			return nil, fmt.Errorf("chained_fetch.token requires https: true, or it would be sent in clear")
+		}
+		config.ChainedFetch = &chainedFetchConfig{Token: string(cf.Token), HTTPS: cf.HTTPS}
+	}
+
+	// Parse optional developer debug mode
+	if dbg := ymlConfig.Debug; dbg != nil && dbg.Enabled {
+		if !relay.DebugBuild {
+			return nil, fmt.Errorf("debug: this build does not include the debug mode; rebuild with -tags qumo_debug")
+		}
+		if dbg.MaxCaptureGroups < 0 {
+			return nil, fmt.Errorf("debug: max_capture_groups must not be negative")
+		}
+		config.Debug = &debugConfig{
+			KeyLogFile: cmp.Or(string(dbg.TLSKeyLogFile), os.Getenv("SSLKEYLOGFILE")),
+		}
+		if dbg.CaptureDir != "" {
+			config.Debug.Capture = &relay.DebugCapture{
+				Dir:       string(dbg.CaptureDir),
+				MaxGroups: dbg.MaxCaptureGroups,
+			}
+		}
+	}
+
+	// Parse optional virtual hosts
+	seen := make(map[string]bool)
+	for _, vh := range ymlConfig.VirtualHosts {
+		host := strings.ToLower(strings.TrimSuffix(vh.Hostname, "."))
+		if host == "" {
+			return nil, fmt.Errorf("virtual host without hostname")
+		}
+		if seen[host] {
+			return nil, fmt.Errorf("duplicate virtual host %q", host)
+		}
+		seen[host] = true
+		if vh.CertFile == "" || vh.KeyFile == "" {
+			return nil, fmt.Errorf("virtual host %q: cert_file and key_file are required", host)
+		}
+
+		vhc := virtualHostConfig{
+			Hostname: host,
+			CertFile: string(vh.CertFile),
+			KeyFile:  string(vh.KeyFile),
+		}
+		if vh.SDN != nil {
+			if config.SDNConfig == nil {
+				return nil, fmt.Errorf("virtual host %q: sdn requires the top-level sdn.url", host)
+			}
+			if vh.SDN.RelayName == "" {
+				return nil, fmt.Errorf("virtual host %q: sdn.relay_name is required", host)
+			}
+			// Controller, TLS and heartbeat settings are shared; the
+			// identity is the host's own
+			sdnCfg := *config.SDNConfig
+			sdnCfg.RelayName = vh.SDN.RelayName
+			sdnCfg.Address = vh.SDN.Address
+			sdnCfg.Neighbors = vh.SDN.Neighbors
+			sdnCfg.Token = cmp.Or(string(vh.SDN.Token), sdnCfg.Token)
+			vhc.SDNConfig = &sdnCfg
+		}
+		config.VirtualHosts = append(config.VirtualHosts, vhc)
 	}
 
 	return config, nil
 }
 
+// setupTLS loads the server certificate. certFile and keyFile may each be
+// a path or inline PEM data (e.g. resolved from a secret reference).
 func setupTLS(certFile, keyFile string) (*tls.Config, error) {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	cert, err := sdn.LoadKeyPair(certFile, keyFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load TLS certificates: %w", err)
 	}
@@ -266,8 +1587,72 @@ func setupTLS(certFile, keyFile string) (*tls.Config, error) {
 	}, nil
 }
 
+// verifyClientCerts has cfg verify the client certificates sessions
+// present against the CAs in ca, a path or inline PEM. Sessions with a
+// valid one are authenticated as its identity (see
+// relay.CertificateIdentity); sessions without one stay anonymous.
+func verifyClientCerts(cfg *tls.Config, ca string) error {
+	pool, err := sdn.LoadCertPool(ca)
+	if err != nil {
+		return fmt.Errorf("server.client_ca_file: %w", err)
+	}
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	cfg.ClientCAs = pool
+	return nil
+}
+
+// portOf returns the port of a listen address, defaulting to 4433.
+func portOf(addr string) string {
+	if _, port, err := net.SplitHostPort(addr); err == nil && port != "" {
+		return port
+	}
+	return "4433"
+}
+
+// selfCheckTLS returns the client TLS config for the loopback probe.
+// Certificate verification is skipped only when dialing a loopback host,
+// since the relay is then connecting to itself and its certificate rarely
+// names "localhost".
+func selfCheckTLS(rawURL string) *tls.Config {
+	cfg := &tls.Config{NextProtos: []string{"h3", "moq-00"}}
+	if u, err := url.Parse(rawURL); err == nil {
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			cfg.InsecureSkipVerify = true
+		}
+	}
+	return cfg
+}
+
 type healthHandler struct {
 	statusFunc func() relay.Status
+
+	// selfCheckFunc reports the loopback probe; nil when disabled.
+	selfCheckFunc func() relay.SelfCheckStatus
+
+	// warmingFunc reports whether the warm cache is still preloading; nil
+	// when disabled.
+	warmingFunc func() bool
+
+	// registeringFunc reports whether the relay still waits for its first
+	// registration with an SDN controller configured with
+	// wait_for_registration; nil without an SDN.
+	registeringFunc func() bool
+
+	// deep checks the relay's dependencies for ?probe=ready&deep=true;
+	// nil when it has none.
+	deep *deepProbe
+}
+
+// warming reports whether the relay is still preloading its warm cache.
+func (h *healthHandler) warming() bool {
+	return h.warmingFunc != nil && h.warmingFunc()
+}
+
+// registering reports whether the relay still waits to register with the
+// SDN.
+func (h *healthHandler) registering() bool {
+	return h.registeringFunc != nil && h.registeringFunc()
 }
 
 func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -280,6 +1665,28 @@ func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	probe := r.URL.Query().Get("probe")
 
 	switch probe {
+	case "selfcheck":
+		w.Header().Set("Content-Type", "application/json")
+		if h.selfCheckFunc == nil {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method != http.MethodHead {
+				json.NewEncoder(w).Encode(map[string]string{"error": "selfcheck disabled"})
+			}
+			return
+		}
+
+		status := h.selfCheckFunc()
+		statusCode := http.StatusOK
+		if !status.Healthy {
+			statusCode = http.StatusServiceUnavailable
+		}
+		w.WriteHeader(statusCode)
+		if r.Method == http.MethodHead {
+			return
+		}
+		json.NewEncoder(w).Encode(status)
+		return
+
 	case "live":
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -299,6 +1706,26 @@ func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if activeConns < 0 {
 			ready = false
 			reason = "invalid_connection_state"
+		} else if status.ResourcePressure != "" {
+			ready = false
+			reason = "resource_pressure"
+		} else if h.warming() {
+			ready = false
+			reason = "warming_cache"
+		} else if h.registering() {
+			ready = false
+			reason = "sdn_registering"
+		}
+
+		response := map[string]any{}
+		if r.URL.Query().Get("deep") == "true" && h.deep != nil {
+			dependencies, checkedAt := h.deep.run(r.Context())
+			if ready && !dependenciesHealthy(dependencies) {
+				ready = false
+				reason = "dependency_failed"
+			}
+			response["dependencies"] = dependencies
+			response["checked_at"] = checkedAt
 		}
 
 		statusCode := http.StatusOK
@@ -312,7 +1739,7 @@ func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		response := map[string]any{"ready": ready}
+		response["ready"] = ready
 		if !ready {
 			response["reason"] = reason
 		}
@@ -328,6 +1755,15 @@ func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if status.ActiveConnections < 0 {
 			ready = false
 			reason = "invalid_connection_state"
+		} else if status.ResourcePressure != "" {
+			ready = false
+			reason = "resource_pressure"
+		} else if h.warming() {
+			ready = false
+			reason = "warming_cache"
+		} else if h.registering() {
+			ready = false
+			reason = "sdn_registering"
 		}
 
 		response := map[string]any{
@@ -335,9 +1771,13 @@ func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"timestamp":          status.Timestamp,
 			"uptime":             status.Uptime,
 			"active_connections": status.ActiveConnections,
+			"version":            version.Version(),
 			"live":               true,
 			"ready":              ready,
 		}
+		if status.SDN != "" {
+			response["sdn"] = status.SDN
+		}
 		if !ready {
 			response["ready_reason"] = reason
 		}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"flag"
@@ -8,13 +9,14 @@ import (
 	"log"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
-	"os/signal"
-	"syscall"
+	"path/filepath"
 	"time"
 
 	"github.com/okdaichi/qumo/internal/sdn"
 	"github.com/okdaichi/qumo/internal/topology"
+	"github.com/okdaichi/qumo/internal/version"
 	"gopkg.in/yaml.v3"
 )
 
@@ -23,11 +25,90 @@ type sdnConfig struct {
 	DataDir      string
 	PeerURL      string
 	SyncInterval time.Duration
+	SyncStrategy topology.SyncStrategy
 	NodeTTL      time.Duration
+	TombstoneTTL time.Duration
+	GeoIPFile    string
+
+	// SeedFile holds a planned topology loaded at startup; empty starts
+	// from the store or an empty graph.
+	SeedFile string
+
+	// RouterURL enables the external router: route queries are POSTed to
+	// this endpoint, falling back to Dijkstra on failure.
+	RouterURL     string
+	RouterTimeout time.Duration
+
+	// ZoneDiversity selects backup-path computation: "" (off), "prefer"
+	// or "strict". See topology.ZoneDiverseRouter.
+	ZoneDiversity string
+
+	// ProbeInterval is how often each edge is probed by its relays.
+	ProbeInterval time.Duration
+
+	// AdminToken is the bearer token for operator endpoints such as
+	// /override/edge and /route/pin; empty leaves them open.
+	AdminToken string
+
+	// Identities authenticate relays by bearer token, so lookups and
+	// listings return them the private broadcasts they may see.
+	Identities []sdn.RelayIdentity
+
+	// CostModel prices edges from probe RTT/loss, utilization and weight;
+	// nil keeps probe-measured costs.
+	CostModel *topology.WeightedCostModel
+
+	// CostTemplate prices edges relays register without a cost from their
+	// regions; nil keeps the default weight 1.
+	CostTemplate *topology.CostTemplate
+
+	// Validation rejects malformed relay registrations with 400; nil
+	// accepts them as they come.
+	Validation *topology.RegistrationValidation
+
+	// Limits bounds the graph relays can build by registering; nil leaves
+	// it unbounded.
+	Limits *topology.GraphLimits
+
+	// Replica runs the controller as a read replica of a writer; nil runs
+	// it as a writer.
+	Replica *replicaConfig
+
+	// Replication keeps hot broadcasts on several relays; the zero value
+	// only reports coverage.
+	Replication sdn.ReplicationPolicy
+
+	// Health configures the assessment of relay health routes take into
+	// account; probing is off by default.
+	Health healthConfig
+
+	// LoadShedding sheds low-priority API requests under load; nil serves
+	// every request.
+	LoadShedding *sdn.LoadShedder
+
+	// UIDir is the built web dashboard served under /ui/; empty disables it.
+	UIDir string
+
+	// HTTP bounds the time and header size of API requests.
+	HTTP httpLimits
+
+	// Metrics shapes the metrics served on /metrics.
+	Metrics metricsConfig
+}
+
+// healthConfig is the `health` section of the SDN config. Zero durations
+// and counts use the sdn.HealthMonitor defaults.
+type healthConfig struct {
+	Probe            bool
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int
+	DegradedPenalty  float64
 }
 
 const defaultAddr = ":8090"
 const defaultSyncInterval = 10 * time.Second
+const defaultProbeInterval = 60 * time.Second
 
 // RunSDN starts the SDN routing controller.
 func RunSDN(args []string) error {
@@ -40,8 +121,131 @@ func RunSDN(args []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	ctx, cancel := serviceContext("qumo-sdn")
+	defer cancel()
+
+	handler, err := newSDNHandler(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	httpServer := newHTTPServer(cfg.ListenAddr, handler, cfg.HTTP)
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP server error: %v", err)
+		}
+	}()
+
+	log.Printf("SDN routing controller started on %s", cfg.ListenAddr)
+	log.Println("  /relay/<name>   - PUT: register relay (cost+load), DELETE: deregister (?reason=shutdown|admin)")
+	log.Println("  /relay/<name>/detail - GET: node, announces, heartbeat, load and recent events")
+	log.Println("  /relay/<name>/history - GET: deregistration tombstones (reason) and recent events")
+	log.Println("  /relay/<name>/maintenance - GET/PUT/DELETE: maintenance window (bearer token)")
+	log.Println("  /maintenance    - GET: maintenance calendar (?format=ics)")
+	log.Println("  /route          - GET: compute route (?from=X&to=Y), POST: route with bandwidth reservation (bearer token)")
+	log.Println("  /route/reservations - GET: bandwidth reservations and edge load, DELETE: release (?id=X, bearer token)")
+	log.Println("  /route/pin      - GET/POST/DELETE: fixed paths returned by /route (bearer token)")
+	log.Println("  /graph          - GET: current topology")
+	log.Println("  /graph/asymmetries - GET: one-way links")
+	log.Println("  /graph/zones    - GET: failure domains and single-zone impact")
+	log.Println("  /sd/relays      - GET: relays as Prometheus HTTP service discovery targets (?region=X)")
+	log.Println("  /query          - GET: topology query (?q=nodes(region=eu-*) | reachable_from(X))")
+	log.Println("  /override/edge  - GET/POST/DELETE: manual edge overrides (bearer token)")
+	log.Println("  /graph/attributes - POST: edge cost model inputs (bearer token)")
+	log.Println("  /announce/...   - PUT/DELETE: track announcements")
+	log.Println("  /announce/lookup - GET: find relays by track")
+	log.Println("  /announce       - GET: list all announcements")
+	log.Println("  /announce/export - GET: content inventory (?format=csv|json)")
+	log.Println("  /announce/coverage - GET: relays holding each broadcast vs. replication factor")
+	log.Println("  /sync           - GET/PUT: HA topology sync")
+	log.Println("  /sync/announce  - GET: announce table for read replicas (bearer token)")
+	log.Println("  /stats/relay/<name> - POST: relay metric summary")
+	log.Println("  /stats/cluster  - GET: fleet-wide traffic aggregates")
+	log.Println("  /probes/<name>  - GET: probe tasks; /probes/results - POST: probe results (relay identity)")
+	log.Println("  /stats/probes   - GET: per-edge probe latency/loss")
+	log.Println("  /stats/popular  - GET: most looked-up broadcast paths (?window=15m&n=20)")
+	log.Println("  /fleet/health   - GET: healthy, degraded and unreachable relays")
+	log.Println("  /replication/<name> - GET: broadcasts the relay should prefetch")
+	log.Println("  /placement      - POST: pick ingest relay for a publisher")
+	log.Println("  /edge           - GET: nearest relay for a subscriber (?ip=X)")
+	log.Println("  /metrics        - Prometheus metrics")
+	log.Println("  /health         - Health check")
+	if cfg.UIDir != "" {
+		log.Println("  /ui/            - Web dashboard")
+	}
+	if r := cfg.Replica; r != nil {
+		writes := "refused"
+		if r.ForwardWrites {
+			writes = "forwarded to the writer"
+		}
+		log.Printf("Read replica of %s: serving route, graph and announce reads; other requests are %s",
+			sdn.RedactURL(r.WriterURL), writes)
+	}
+	serviceReady()
+	go runWatchdog(ctx, nil)
+
+	<-ctx.Done()
+	serviceStopping()
+
+	slog.Info("Shutting down SDN routing controller...")
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down HTTP server: %v", err)
+	}
+
+	slog.Info("SDN routing controller stopped")
+	return nil
+}
+
+// newSDNHandler builds the controller's HTTP API and starts its background
+// sweepers and peer sync, which run until ctx is cancelled.
+func newSDNHandler(ctx context.Context, cfg *sdnConfig) (http.Handler, error) {
 	topo := &topology.Topology{
-		NodeTTL: cfg.NodeTTL,
+		NodeTTL:      cfg.NodeTTL,
+		TombstoneTTL: cfg.TombstoneTTL,
+		SyncStrategy: cfg.SyncStrategy,
+
+		DegradedPenalty: cfg.Health.DegradedPenalty,
+	}
+	if cfg.CostModel != nil {
+		topo.CostModel = *cfg.CostModel
+		log.Printf("Cost model enabled: rtt=%g loss=%g utilization=%g", cfg.CostModel.RTT, cfg.CostModel.Loss, cfg.CostModel.Utilization)
+	}
+	if ct := cfg.CostTemplate; ct != nil {
+		topo.CostTemplate = ct
+		log.Printf("Cost template enabled: intra-region=%g inter-region=%g, %d region pairs", ct.IntraRegion, ct.InterRegion, len(ct.Pairs))
+	}
+	if v := cfg.Validation; v != nil {
+		topo.Validation = v
+		log.Printf("Strict registration enabled: max %d neighbors, max cost %g",
+			cmp.Or(v.MaxNeighbors, topology.DefaultMaxNeighbors), cmp.Or(v.MaxCost, topology.DefaultMaxCost))
+	}
+
+	if l := cfg.Limits; l != nil {
+		topo.Limits = l
+		log.Printf("Graph limits enabled: max %d nodes, %d edges per node, %d edges (0 = unlimited)", l.MaxNodes, l.MaxEdgesPerNode, l.MaxEdges)
+	}
+
+	// Configure zone-diverse backup paths (optional)
+	var local topology.Router
+	if cfg.ZoneDiversity != "" {
+		local = &topology.ZoneDiverseRouter{Strict: cfg.ZoneDiversity == "strict"}
+		topo.Router = local
+		log.Printf("Zone-diverse backup paths enabled (%s)", cfg.ZoneDiversity)
+	}
+
+	// Configure external router (optional)
+	if cfg.RouterURL != "" {
+		topo.Router = &topology.HTTPRouter{
+			URL:      cfg.RouterURL,
+			Timeout:  cfg.RouterTimeout,
+			Fallback: local,
+		}
+		log.Printf("External router enabled: %s (fallback: local router)", sdn.RedactURL(cfg.RouterURL))
 	}
 
 	// Configure persistence (optional)
@@ -50,34 +254,143 @@ func RunSDN(args []string) error {
 		log.Printf("Persistence enabled: %s/topology.json", cfg.DataDir)
 	}
 
+	// Load planned sites before any relay registers (optional)
+	if cfg.SeedFile != "" {
+		seed, err := topology.LoadSeedFile(cfg.SeedFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load topology seed: %w", err)
+		}
+		nodes, edges := topo.ApplySeed(seed)
+		log.Printf("Topology seeded from %s: %d nodes, %d edges added", cfg.SeedFile, nodes, edges)
+	}
+
 	announceTable := sdn.NewAnnounceTable(90 * time.Second)
+	statsTable := sdn.NewStatsTable(90 * time.Second)
+	topo.OnDeregister = func(name string) { statsTable.Remove(name) }
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
+	probeInterval := cfg.ProbeInterval
+	if probeInterval <= 0 {
+		probeInterval = defaultProbeInterval
+	}
+	probeTable := sdn.NewProbeTable(probeInterval)
+	health := sdn.NewHealthMonitor(topo, statsTable)
+	health.Probe = cfg.Health.Probe
+	health.Interval = cfg.Health.Interval
+	health.Timeout = cfg.Health.Timeout
+	health.FailureThreshold = cfg.Health.FailureThreshold
+	topo.MeasuredCostTTL = 3 * probeInterval // measured costs lapse after three missed probes
+	replicationTable := sdn.NewReplicationTable(cfg.Replication, announceTable, statsTable, topo)
+	replicationTable.Tenants = make(map[string]string)
+	for _, id := range cfg.Identities {
+		replicationTable.Tenants[id.Relay] = id.Tenant
+	}
+	if cfg.Replication.Factor > 0 {
+		log.Printf("Replication policy enabled: factor %d at %d subscribers", cfg.Replication.Factor, cfg.Replication.MinSubscribers)
+	}
+
+	if r := cfg.Replica; r != nil {
+		// Copy the writer's state, which its own sweepers keep current
+		syncInterval := cmp.Or(r.SyncInterval, defaultReplicaSyncInterval)
+		go topology.NewPeerSyncer(r.WriterURL, topo, syncInterval).Run(ctx)
+		go sdn.NewAnnounceMirror(r.WriterURL, r.Token, announceTable, syncInterval).Run(ctx)
+	} else {
+		// Start background sweeper to remove expired announces
+		announceTable.StartSweeper(ctx, 30*time.Second)
 
-	// Start background sweeper to remove expired announces
-	announceTable.StartSweeper(ctx, 30*time.Second)
+		// Drop the stats of relays that stopped reporting
+		statsTable.StartSweeper(ctx, 30*time.Second)
 
-	// Start topology sweeper to remove stale relay nodes
-	topo.StartSweeper(ctx, 30*time.Second)
+		// Start topology sweeper to remove stale relay nodes
+		topo.StartSweeper(ctx, 30*time.Second)
+
+		// Cordon and uncordon relays as their maintenance windows start and end
+		topo.StartMaintenanceScheduler(ctx, 10*time.Second)
+
+		// Route around relays that report or probe unhealthy
+		go health.Run(ctx)
+		if health.Probe {
+			log.Printf("Relay health probes enabled: every %s, unreachable after %d failures",
+				cmp.Or(health.Interval, sdn.DefaultRelayHealthInterval), cmp.Or(health.FailureThreshold, sdn.DefaultRelayHealthFailureThreshold))
+		}
+	}
 
 	mux := http.NewServeMux()
 
 	// Topology + Relay registration routes
 	mux.HandleFunc("/relay/", topology.NewNodeHandlerFunc(topo))
-	mux.HandleFunc("/route", topology.RouteHandlerFunc(topo))
+	mux.HandleFunc("/relay/{name}/detail", sdn.NodeDetailHandlerFunc(topo, announceTable, statsTable))
+	mux.HandleFunc("/relay/{name}/history", topology.RelayHistoryHandlerFunc(topo))
+	mux.Handle("/relay/{name}/maintenance", adminAuth(cfg.AdminToken, topology.MaintenanceHandlerFunc(topo)))
+	mux.HandleFunc("/maintenance", topology.MaintenanceCalendarHandlerFunc(topo))
+	mux.Handle("/route", writeAuth(cfg.AdminToken, topology.RouteHandlerFunc(topo)))
+	mux.Handle("/route/reservations", writeAuth(cfg.AdminToken, topology.ReservationsHandlerFunc(topo)))
+	mux.Handle("/route/pin", adminAuth(cfg.AdminToken, topology.RoutePinHandlerFunc(topo)))
 	mux.HandleFunc("/graph", topology.GraphHandlerFunc(topo))
+	mux.HandleFunc("/graph/asymmetries", topology.AsymmetriesHandlerFunc(topo))
+	mux.HandleFunc("/graph/zones", topology.ZonesHandlerFunc(topo))
+	mux.HandleFunc("/sd/relays", topology.ServiceDiscoveryHandlerFunc(topo))
+	mux.HandleFunc("/query", topology.QueryHandlerFunc(topo))
+	mux.Handle("/override/edge", adminAuth(cfg.AdminToken, topology.OverrideHandlerFunc(topo)))
+	mux.Handle("/graph/attributes", adminAuth(cfg.AdminToken, topology.AttributesHandlerFunc(topo)))
 	mux.HandleFunc("/sync", topology.SyncHandlerFunc(topo))
+	mux.Handle("/sync/announce", adminAuth(cfg.AdminToken, sdn.AnnounceSyncHandlerFunc(announceTable)))
 
 	// Announce table routes
 	mux.HandleFunc("/announce/lookup", sdn.LookupHandlerFunc(announceTable))
+	mux.HandleFunc("/announce/export", sdn.ExportHandlerFunc(announceTable))
+	mux.HandleFunc("/announce/coverage", sdn.CoverageHandlerFunc(replicationTable))
 	mux.HandleFunc("/announce/", sdn.HandlerFunc(announceTable))
 	mux.HandleFunc("/announce", sdn.ListHandlerFunc(announceTable))
 
+	// Fleet metrics routes
+	mux.HandleFunc("/stats/relay/", sdn.RelayStatsHandlerFunc(statsTable))
+	mux.HandleFunc("/stats/cluster", sdn.ClusterStatsHandlerFunc(statsTable))
+	mux.HandleFunc("/stats/popular", sdn.PopularHandlerFunc(announceTable))
+	mux.HandleFunc("/fleet/health", sdn.FleetHealthHandlerFunc(health))
+
+	// Cross-relay data-plane probes
+	mux.HandleFunc("/probes/", sdn.ProbeTasksHandlerFunc(probeTable, topo))
+	mux.HandleFunc("/probes/results", sdn.ProbeResultsHandlerFunc(probeTable, topo))
+	mux.HandleFunc("/stats/probes", sdn.ProbeReportHandlerFunc(probeTable))
+
+	// Replication policy prefetches
+	mux.HandleFunc("/replication/", sdn.PrefetchTasksHandlerFunc(replicationTable))
+
+	// Publisher ingest placement and subscriber steering
+	mux.HandleFunc("/placement", sdn.PlacementHandlerFunc(topo, statsTable))
+
+	var geo sdn.GeoIPResolver
+	if cfg.GeoIPFile != "" {
+		var err error
+		geo, err = sdn.LoadGeoIPFile(cfg.GeoIPFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load geoip database: %w", err)
+		}
+		log.Printf("GeoIP steering enabled: %s", cfg.GeoIPFile)
+	}
+	mux.HandleFunc("/edge", sdn.EdgeHandlerFunc(topo, statsTable, geo))
+
+	metricsReg, metricsHandler := newMetricsRegistry(cfg.Metrics)
+	mux.Handle("/metrics", metricsHandler)
+	if err := sdn.RegisterMetrics(metricsReg, announceTable, topo); err != nil {
+		return nil, fmt.Errorf("failed to register metrics: %w", err)
+	}
+	if err := version.RegisterMetrics(metricsReg); err != nil {
+		return nil, fmt.Errorf("failed to register metrics: %w", err)
+	}
+
+	if cfg.UIDir != "" {
+		if _, err := os.Stat(filepath.Join(cfg.UIDir, "index.html")); err != nil {
+			return nil, fmt.Errorf("ui.dir has no built dashboard (run mage webBuild): %w", err)
+		}
+		mux.Handle("/ui/", http.StripPrefix("/ui", sdn.UIHandler(cfg.UIDir)))
+		log.Printf("Web dashboard enabled: %s", cfg.UIDir)
+	}
+
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok", "version": version.Version()})
 	})
 
 	// P5: Start peer syncer if configured.
@@ -89,55 +402,104 @@ func RunSDN(args []string) error {
 		syncer := topology.NewPeerSyncer(cfg.PeerURL, topo, syncInterval)
 		go syncer.Run(ctx)
 
-		log.Printf("HA peer sync enabled: %s every %s", cfg.PeerURL, syncInterval)
+		log.Printf("HA peer sync enabled: %s every %s (%s)", sdn.RedactURL(cfg.PeerURL), syncInterval, cfg.SyncStrategy.OrDefault())
 	}
 
-	httpServer := &http.Server{
-		Addr:    cfg.ListenAddr,
-		Handler: mux,
+	handler := sdn.CompressHandler(sdn.IdentifyRelays(cfg.Identities, mux))
+	if len(cfg.Identities) > 0 {
+		log.Printf("Relay identities enabled: %d relays", len(cfg.Identities))
 	}
-
-	go func() {
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("HTTP server error: %v", err)
-		}
-	}()
-
-	log.Printf("SDN routing controller started on %s", cfg.ListenAddr)
-	log.Println("  /relay/<name>   - PUT: register relay (cost+load), DELETE: deregister")
-	log.Println("  /route          - GET: compute route (?from=X&to=Y)")
-	log.Println("  /graph          - GET: current topology")
-	log.Println("  /announce/...   - PUT/DELETE: track announcements")
-	log.Println("  /announce/lookup - GET: find relays by track")
-	log.Println("  /announce       - GET: list all announcements")
-	log.Println("  /sync           - GET/PUT: HA topology sync")
-	log.Println("  /health         - Health check")
-
-	<-ctx.Done()
-	cancel()
-
-	slog.Info("Shutting down SDN routing controller...")
-
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer shutdownCancel()
-
-	if err := httpServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Error shutting down HTTP server: %v", err)
+	if ls := cfg.LoadShedding; ls != nil {
+		log.Printf("Load shedding enabled: %d requests in flight", ls.MaxInFlight)
+		handler = ls.Handler(handler)
 	}
-
-	slog.Info("SDN routing controller stopped")
-	return nil
+	if cfg.Replica != nil {
+		return replicaHandler(cfg.Replica, handler)
+	}
+	return handler, nil
 }
 
 func loadSDNConfig(filename string) (*sdnConfig, error) {
 	type yamlConfig struct {
 		Graph struct {
-			ListenAddr   string `yaml:"listen_addr"`
-			DataDir      string `yaml:"data_dir"`
-			PeerURL      string `yaml:"peer_url"`
-			SyncInterval int    `yaml:"sync_interval_sec"`
-			NodeTTLSec   int    `yaml:"node_ttl_sec"`
+			ListenAddr   string       `yaml:"listen_addr"`
+			DataDir      refString    `yaml:"data_dir"`
+			PeerURL      secretString `yaml:"peer_url"`
+			SyncInterval int          `yaml:"sync_interval_sec"`
+			SyncStrategy string       `yaml:"sync_strategy"`
+			NodeTTLSec   int          `yaml:"node_ttl_sec"`
+			TombstoneSec int          `yaml:"tombstone_ttl_sec"`
+			GeoIPFile    refString    `yaml:"geoip_file"`
+			SeedFile     refString    `yaml:"seed_file"`
+
+			ProbeIntervalSec int `yaml:"probe_interval_sec"`
 		} `yaml:"graph"`
+		Router struct {
+			URL       secretString `yaml:"url"`
+			TimeoutMS int          `yaml:"timeout_ms"`
+
+			ZoneDiversity string `yaml:"zone_diversity"`
+		} `yaml:"router"`
+		Admin struct {
+			Token secretString `yaml:"token"`
+		} `yaml:"admin"`
+		Identities []struct {
+			Relay  string       `yaml:"relay"`
+			Tenant string       `yaml:"tenant"`
+			Token  secretString `yaml:"token"`
+		} `yaml:"identities"`
+		CostModel *struct {
+			RTT         float64 `yaml:"rtt"`
+			Loss        float64 `yaml:"loss"`
+			Utilization float64 `yaml:"utilization"`
+		} `yaml:"cost_model"`
+		CostTemplate *struct {
+			IntraRegion float64 `yaml:"intra_region"`
+			InterRegion float64 `yaml:"inter_region"`
+			Pairs       []struct {
+				Regions []string `yaml:"regions"`
+				Cost    float64  `yaml:"cost"`
+			} `yaml:"pairs"`
+		} `yaml:"cost_template"`
+		Registration struct {
+			Strict       bool    `yaml:"strict"`
+			MaxNeighbors int     `yaml:"max_neighbors"`
+			MaxCost      float64 `yaml:"max_cost"`
+		} `yaml:"registration"`
+		Limits *struct {
+			MaxNodes        int `yaml:"max_nodes"`
+			MaxEdgesPerNode int `yaml:"max_edges_per_node"`
+			MaxEdges        int `yaml:"max_edges"`
+		} `yaml:"limits"`
+		Replication struct {
+			Factor         int      `yaml:"factor"`
+			MinSubscribers int      `yaml:"min_subscribers"`
+			MinLookups     int      `yaml:"min_lookups"`
+			Tracks         []string `yaml:"tracks"`
+		} `yaml:"replication"`
+		Health struct {
+			Probe            bool    `yaml:"probe"`
+			IntervalSec      int     `yaml:"interval_sec"`
+			TimeoutSec       int     `yaml:"timeout_sec"`
+			FailureThreshold int     `yaml:"failure_threshold"`
+			DegradedPenalty  float64 `yaml:"degraded_penalty"`
+		} `yaml:"health"`
+		LoadShedding struct {
+			MaxInFlight      int `yaml:"max_in_flight"`
+			LowPriorityLimit int `yaml:"low_priority_limit"`
+			RetryAfterSec    int `yaml:"retry_after_sec"`
+		} `yaml:"load_shedding"`
+		UI struct {
+			Dir refString `yaml:"dir"`
+		} `yaml:"ui"`
+		Replica *struct {
+			WriterURL     secretString `yaml:"writer_url"`
+			Token         secretString `yaml:"token"`
+			SyncInterval  int          `yaml:"sync_interval_sec"`
+			ForwardWrites bool         `yaml:"forward_writes"`
+		} `yaml:"replica"`
+		HTTP    httpLimitsYAML    `yaml:"http"`
+		Metrics metricsConfigYAML `yaml:"metrics"`
 	}
 
 	file, err := os.Open(filename)
@@ -151,16 +513,172 @@ func loadSDNConfig(filename string) (*sdnConfig, error) {
 		return nil, fmt.Errorf("failed to decode config: %w", err)
 	}
 
+	switch ymlCfg.Router.ZoneDiversity {
+	case "", "prefer", "strict":
+	default:
+		return nil, fmt.Errorf("router.zone_diversity must be \"prefer\" or \"strict\", got %q", ymlCfg.Router.ZoneDiversity)
+	}
+
 	listenAddr := ymlCfg.Graph.ListenAddr
 	if listenAddr == "" {
 		listenAddr = ":8090"
 	}
 
+	var costModel *topology.WeightedCostModel
+	if cm := ymlCfg.CostModel; cm != nil {
+		if cm.RTT < 0 || cm.Loss < 0 || cm.Utilization < 0 {
+			return nil, fmt.Errorf("cost_model coefficients must not be negative")
+		}
+		costModel = &topology.WeightedCostModel{RTT: cm.RTT, Loss: cm.Loss, Utilization: cm.Utilization}
+	}
+
+	var costTemplate *topology.CostTemplate
+	if ct := ymlCfg.CostTemplate; ct != nil {
+		if ct.IntraRegion < 0 || ct.InterRegion < 0 {
+			return nil, fmt.Errorf("cost_template costs must not be negative")
+		}
+		costTemplate = &topology.CostTemplate{IntraRegion: ct.IntraRegion, InterRegion: ct.InterRegion}
+		for i, p := range ct.Pairs {
+			if len(p.Regions) != 2 || p.Regions[0] == "" || p.Regions[1] == "" || p.Cost <= 0 {
+				return nil, fmt.Errorf("cost_template.pairs[%d]: regions must name two regions and cost must be positive", i)
+			}
+			costTemplate.Pairs = append(costTemplate.Pairs, topology.RegionPairCost{A: p.Regions[0], B: p.Regions[1], Cost: p.Cost})
+		}
+	}
+
+	var validation *topology.RegistrationValidation
+	if reg := ymlCfg.Registration; reg.Strict {
+		if reg.MaxNeighbors < 0 || reg.MaxCost < 0 {
+			return nil, fmt.Errorf("registration.max_neighbors and registration.max_cost must not be negative")
+		}
+		validation = &topology.RegistrationValidation{MaxNeighbors: reg.MaxNeighbors, MaxCost: reg.MaxCost}
+	}
+
+	syncStrategy, err := topology.ParseSyncStrategy(ymlCfg.Graph.SyncStrategy)
+	if err != nil {
+		return nil, fmt.Errorf("graph.sync_strategy: %w", err)
+	}
+
+	var limits *topology.GraphLimits
+	if l := ymlCfg.Limits; l != nil {
+		if l.MaxNodes < 0 || l.MaxEdgesPerNode < 0 || l.MaxEdges < 0 {
+			return nil, fmt.Errorf("limits must not be negative")
+		}
+		limits = &topology.GraphLimits{MaxNodes: l.MaxNodes, MaxEdgesPerNode: l.MaxEdgesPerNode, MaxEdges: l.MaxEdges}
+	}
+
+	var replica *replicaConfig
+	if r := ymlCfg.Replica; r != nil {
+		u, err := url.Parse(string(r.WriterURL))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("replica.writer_url must be the writer controller's base URL")
+		}
+		if ymlCfg.Graph.PeerURL != "" {
+			return nil, fmt.Errorf("replica.writer_url and graph.peer_url are exclusive: replicas sync from their writer")
+		}
+		if r.SyncInterval < 0 {
+			return nil, fmt.Errorf("replica.sync_interval_sec must not be negative")
+		}
+		replica = &replicaConfig{
+			WriterURL:     string(r.WriterURL),
+			Token:         string(r.Token),
+			SyncInterval:  time.Duration(r.SyncInterval) * time.Second,
+			ForwardWrites: r.ForwardWrites,
+		}
+	}
+
+	rep := ymlCfg.Replication
+	if rep.Factor < 0 || rep.MinSubscribers < 0 || rep.MinLookups < 0 {
+		return nil, fmt.Errorf("replication.factor, replication.min_subscribers and replication.min_lookups must not be negative")
+	}
+	if rep.Factor > 0 && len(rep.Tracks) == 0 {
+		return nil, fmt.Errorf("replication.tracks must name the tracks relays prefetch")
+	}
+
+	httpLimits, err := ymlCfg.HTTP.limits()
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := ymlCfg.Metrics.config()
+	if err != nil {
+		return nil, err
+	}
+
+	var identities []sdn.RelayIdentity
+	tokens := make(map[string]bool)
+	for _, id := range ymlCfg.Identities {
+		if id.Relay == "" || id.Token == "" {
+			return nil, fmt.Errorf("identities: relay and token are required")
+		}
+		if tokens[string(id.Token)] {
+			return nil, fmt.Errorf("identities: relay %q reuses another relay's token", id.Relay)
+		}
+		tokens[string(id.Token)] = true
+		identities = append(identities, sdn.RelayIdentity{Relay: id.Relay, Tenant: id.Tenant, Token: string(id.Token)})
+	}
+
+	hc := ymlCfg.Health
+	if hc.IntervalSec < 0 || hc.TimeoutSec < 0 || hc.FailureThreshold < 0 {
+		return nil, fmt.Errorf("health.interval_sec, health.timeout_sec and health.failure_threshold must not be negative")
+	}
+	if hc.DegradedPenalty != 0 && hc.DegradedPenalty < 1 {
+		return nil, fmt.Errorf("health.degraded_penalty must be at least 1, got %g", hc.DegradedPenalty)
+	}
+
+	var shedder *sdn.LoadShedder
+	if ls := ymlCfg.LoadShedding; ls.MaxInFlight != 0 || ls.LowPriorityLimit != 0 {
+		if ls.MaxInFlight <= 0 || ls.LowPriorityLimit < 0 || ls.RetryAfterSec < 0 {
+			return nil, fmt.Errorf("load_shedding.max_in_flight must be positive, low_priority_limit and retry_after_sec not negative")
+		}
+		shedder = &sdn.LoadShedder{
+			MaxInFlight:      ls.MaxInFlight,
+			LowPriorityLimit: ls.LowPriorityLimit,
+			RetryAfter:       time.Duration(ls.RetryAfterSec) * time.Second,
+		}
+	}
+
 	return &sdnConfig{
 		ListenAddr:   listenAddr,
-		DataDir:      ymlCfg.Graph.DataDir,
-		PeerURL:      ymlCfg.Graph.PeerURL,
+		DataDir:      string(ymlCfg.Graph.DataDir),
+		PeerURL:      string(ymlCfg.Graph.PeerURL),
 		SyncInterval: time.Duration(ymlCfg.Graph.SyncInterval) * time.Second,
+		SyncStrategy: syncStrategy,
 		NodeTTL:      time.Duration(ymlCfg.Graph.NodeTTLSec) * time.Second,
+		TombstoneTTL: time.Duration(ymlCfg.Graph.TombstoneSec) * time.Second,
+		GeoIPFile:    string(ymlCfg.Graph.GeoIPFile),
+		SeedFile:     string(ymlCfg.Graph.SeedFile),
+
+		RouterURL:     string(ymlCfg.Router.URL),
+		RouterTimeout: time.Duration(ymlCfg.Router.TimeoutMS) * time.Millisecond,
+		ZoneDiversity: ymlCfg.Router.ZoneDiversity,
+
+		ProbeInterval: time.Duration(ymlCfg.Graph.ProbeIntervalSec) * time.Second,
+
+		AdminToken: string(ymlCfg.Admin.Token),
+		Identities: identities,
+		CostModel:  costModel,
+
+		CostTemplate: costTemplate,
+		Validation:   validation,
+		Limits:       limits,
+		Replica:      replica,
+
+		Replication: sdn.ReplicationPolicy{
+			Factor:         rep.Factor,
+			MinSubscribers: rep.MinSubscribers,
+			MinLookups:     rep.MinLookups,
+			Tracks:         rep.Tracks,
+		},
+		Health: healthConfig{
+			Probe:            hc.Probe,
+			Interval:         time.Duration(hc.IntervalSec) * time.Second,
+			Timeout:          time.Duration(hc.TimeoutSec) * time.Second,
+			FailureThreshold: hc.FailureThreshold,
+			DegradedPenalty:  hc.DegradedPenalty,
+		},
+		LoadShedding: shedder,
+		UIDir:        string(ymlCfg.UI.Dir),
+		HTTP:         httpLimits,
+		Metrics:      metrics,
 	}, nil
 }
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+)
+
+// replicaConfig runs the controller as a read replica of a writer
+// controller.
+type replicaConfig struct {
+	// WriterURL is the base URL of the writer controller.
+	WriterURL string
+
+	// Token is the writer's admin token, for its /sync/announce.
+	Token string
+
+	// SyncInterval is how often the topology and announce table are
+	// pulled from the writer.
+	SyncInterval time.Duration
+
+	// ForwardWrites proxies the requests the replica does not serve to the
+	// writer; otherwise they are refused with 503.
+	ForwardWrites bool
+}
+
+// defaultReplicaSyncInterval is how often a replica pulls from its writer
+// if replica.sync_interval_sec is unset.
+const defaultReplicaSyncInterval = 2 * time.Second
+
+// replicaReadPaths are the read-only routes a replica serves from its
+// synced topology and announce table.
+var replicaReadPaths = map[string]bool{
+	"/route":             true,
+	"/graph":             true,
+	"/graph/asymmetries": true,
+	"/graph/zones":       true,
+	"/sd/relays":         true,
+	"/query":             true,
+	"/maintenance":       true,
+	"/announce":          true,
+	"/announce/lookup":   true,
+	"/announce/export":   true,
+	"/sync":              true,
+	"/health":            true,
+	"/metrics":           true,
+}
+
+// servedByReplica reports whether a replica serves r itself.
+func servedByReplica(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return replicaReadPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/ui/")
+}
+
+// replicaHandler serves reads with local and sends the rest to the writer,
+// or refuses them if cfg.ForwardWrites is off.
+func replicaHandler(cfg *replicaConfig, local http.Handler) (http.Handler, error) {
+	writer, err := url.Parse(cfg.WriterURL)
+	if err != nil {
+		return nil, err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(writer)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case servedByReplica(r):
+			local.ServeHTTP(w, r)
+		case cfg.ForwardWrites:
+			proxy.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":  "read replica: send this request to the writer controller",
+				"writer": sdn.RedactURL(cfg.WriterURL),
+			})
+		}
+	}), nil
+}
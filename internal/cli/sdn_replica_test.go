@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicaHandler(t *testing.T) {
+	var forwarded []string
+	writer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = append(forwarded, r.Method+" "+r.URL.Path+" "+string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer writer.Close()
+
+	local := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "replica")
+	})
+
+	handler, err := replicaHandler(&replicaConfig{WriterURL: writer.URL, ForwardWrites: true}, local)
+	require.NoError(t, err)
+
+	for _, target := range []string{"/route?from=a&to=b", "/graph", "/announce?since=1", "/announce/lookup?broadcast_path=/x", "/ui/index.html"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, "replica", rec.Header().Get("X-Served-By"), target)
+	}
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/relay/relay-a", strings.NewReader(`{"neighbors":{}}`)),
+		httptest.NewRequest(http.MethodPost, "/route", strings.NewReader(`{"from":"a"}`)),
+		httptest.NewRequest(http.MethodGet, "/probes/relay-a", nil),
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("X-Served-By"))
+	}
+	assert.Equal(t, []string{
+		`PUT /relay/relay-a {"neighbors":{}}`,
+		`POST /route {"from":"a"}`,
+		"GET /probes/relay-a ",
+	}, forwarded)
+
+	// Without forwarding, writes are refused
+	handler, err = replicaHandler(&replicaConfig{WriterURL: writer.URL}, local)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/announce/relay-a/live/x", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "writer")
+	assert.Len(t, forwarded, 3)
+}
+
+func TestLoadSDNConfig_Replica(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	yml := `
+replica:
+  writer_url: "http://sdn-writer:8090"
+  token: secret
+  sync_interval_sec: 1
+  forward_writes: true
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(yml), 0644))
+
+	cfg, err := loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, &replicaConfig{
+		WriterURL:     "http://sdn-writer:8090",
+		Token:         "secret",
+		SyncInterval:  time.Second,
+		ForwardWrites: true,
+	}, cfg.Replica)
+
+	for name, yml := range map[string]string{
+		"no writer":    "replica:\n  forward_writes: true\n",
+		"relative url": "replica:\n  writer_url: sdn-writer:8090\n",
+		"with peer":    "graph:\n  peer_url: http://peer:8090\nreplica:\n  writer_url: http://sdn-writer:8090\n",
+	} {
+		require.NoError(t, os.WriteFile(configFile, []byte(yml), 0644))
+		_, err := loadSDNConfig(configFile)
+		assert.ErrorContains(t, err, "replica", name)
+	}
+}
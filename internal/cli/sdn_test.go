@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/okdaichi/qumo/internal/topology"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSDNConfig_Identities(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	yml := `
+identities:
+  - {relay: brand-a-tokyo, tenant: brand-a, token: token-a}
+  - {relay: partner-osaka, token: token-p}
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(yml), 0644))
+
+	cfg, err := loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, []sdn.RelayIdentity{
+		{Relay: "brand-a-tokyo", Tenant: "brand-a", Token: "token-a"},
+		{Relay: "partner-osaka", Token: "token-p"},
+	}, cfg.Identities)
+
+	for name, yml := range map[string]string{
+		"no token":     "identities:\n  - {relay: a}\n",
+		"reused token": "identities:\n  - {relay: a, token: t}\n  - {relay: b, token: t}\n",
+	} {
+		require.NoError(t, os.WriteFile(configFile, []byte(yml), 0644))
+		_, err := loadSDNConfig(configFile)
+		assert.ErrorContains(t, err, "identities", name)
+	}
+}
+
+func TestLoadSDNConfig_Registration(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("registration:\n  max_neighbors: 8\n"), 0644))
+
+	cfg, err := loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Nil(t, cfg.Validation, "lenient unless strict is set")
+
+	require.NoError(t, os.WriteFile(configFile, []byte("registration:\n  strict: true\n  max_neighbors: 8\n  max_cost: 500\n"), 0644))
+	cfg, err = loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, &topology.RegistrationValidation{MaxNeighbors: 8, MaxCost: 500}, cfg.Validation)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("registration:\n  strict: true\n  max_cost: -1\n"), 0644))
+	_, err = loadSDNConfig(configFile)
+	assert.ErrorContains(t, err, "registration.max_cost")
+}
+
+func TestLoadSDNConfig_Limits(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("limits:\n  max_nodes: 100\n  max_edges: 500\n"), 0644))
+
+	cfg, err := loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, &topology.GraphLimits{MaxNodes: 100, MaxEdges: 500}, cfg.Limits)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("limits:\n  max_edges_per_node: -1\n"), 0644))
+	_, err = loadSDNConfig(configFile)
+	assert.ErrorContains(t, err, "limits")
+}
+
+func TestLoadSDNConfig_SyncStrategy(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("graph:\n  listen_addr: \":8090\"\n"), 0644))
+
+	cfg, err := loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, topology.SyncMerge, cfg.SyncStrategy)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("graph:\n  sync_strategy: replace\n"), 0644))
+	cfg, err = loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, topology.SyncReplace, cfg.SyncStrategy)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("graph:\n  sync_strategy: newest\n"), 0644))
+	_, err = loadSDNConfig(configFile)
+	assert.ErrorContains(t, err, "graph.sync_strategy")
+}
+
+func TestLoadSDNConfig_Health(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	yml := `
+health:
+  probe: true
+  interval_sec: 5
+  failure_threshold: 2
+  degraded_penalty: 3
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(yml), 0644))
+
+	cfg, err := loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, healthConfig{Probe: true, Interval: 5 * time.Second, FailureThreshold: 2, DegradedPenalty: 3}, cfg.Health)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("health:\n  degraded_penalty: 0.5\n"), 0644))
+	_, err = loadSDNConfig(configFile)
+	assert.ErrorContains(t, err, "health.degraded_penalty")
+}
+
+func TestLoadSDNConfig_CostTemplate(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	yml := `
+cost_template:
+  intra_region: 1
+  inter_region: 5
+  pairs:
+    - {regions: [ap, us], cost: 12}
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(yml), 0644))
+
+	cfg, err := loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, &topology.CostTemplate{
+		IntraRegion: 1,
+		InterRegion: 5,
+		Pairs:       []topology.RegionPairCost{{A: "ap", B: "us", Cost: 12}},
+	}, cfg.CostTemplate)
+
+	for name, yml := range map[string]string{
+		"negative":   "cost_template:\n  inter_region: -1\n",
+		"one region": "cost_template:\n  pairs:\n    - {regions: [ap], cost: 3}\n",
+		"zero cost":  "cost_template:\n  pairs:\n    - {regions: [ap, us]}\n",
+	} {
+		require.NoError(t, os.WriteFile(configFile, []byte(yml), 0644))
+		_, err := loadSDNConfig(configFile)
+		assert.ErrorContains(t, err, "cost_template", name)
+	}
+}
+
+func TestLoadSDNConfig_Metrics(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	yml := `
+metrics:
+  namespace: acme
+  labels: {cluster: tokyo-1, region: ap-northeast-1}
+  exemplars: true
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(yml), 0644))
+
+	cfg, err := loadSDNConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, metricsConfig{
+		Namespace: "acme",
+		Labels:    map[string]string{"cluster": "tokyo-1", "region": "ap-northeast-1"},
+		Exemplars: true,
+	}, cfg.Metrics)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("metrics:\n  namespace: 1acme\n"), 0644))
+	_, err = loadSDNConfig(configFile)
+	assert.ErrorContains(t, err, "metrics.namespace")
+}
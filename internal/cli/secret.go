@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values in logs and config dumps.
+const redacted = "[REDACTED]"
+
+// envRefPattern matches ${env:NAME} references.
+var envRefPattern = regexp.MustCompile(`\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveSecretRef resolves references inside a config value:
+//
+//	${env:NAME}   replaced by the value of environment variable NAME
+//	file:/path    replaced by the contents of the file (trailing newline trimmed)
+//
+// Env references may appear anywhere in the value and are expanded first,
+// so "file:${env:SECRETS_DIR}/token" works. Unset variables are an error so
+// that a missing secret fails loudly at startup instead of becoming "".
+func resolveSecretRef(v string) (string, error) {
+	var missing []string
+	v = envRefPattern.ReplaceAllStringFunc(v, func(ref string) string {
+		name := envRefPattern.FindStringSubmatch(ref)[1]
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return val
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+
+	if path, ok := strings.CutPrefix(v, "file:"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return v, nil
+}
+
+// refString is a YAML string that may contain secret references.
+// Use it for values that are not sensitive themselves (e.g. file paths).
+type refString string
+
+func (s *refString) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	v, err := resolveSecretRef(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*s = refString(v)
+	return nil
+}
+
+// refStrings converts resolved references to plain strings.
+func refStrings(refs []refString) []string {
+	out := make([]string, len(refs))
+	for i, r := range refs {
+		out[i] = string(r)
+	}
+	return out
+}
+
+// secretString is a YAML string holding sensitive data. References are
+// resolved like refString, and the value is redacted whenever it is
+// printed, logged, or marshalled.
+type secretString string
+
+func (s *secretString) UnmarshalYAML(node *yaml.Node) error {
+	var r refString
+	if err := r.UnmarshalYAML(node); err != nil {
+		return err
+	}
+	*s = secretString(r)
+	return nil
+}
+
+// String returns a redacted placeholder; use string(s) for the raw value.
+func (s secretString) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// LogValue implements slog.LogValuer.
+func (s secretString) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+func (s secretString) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+func (s secretString) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
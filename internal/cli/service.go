@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Service manager integration. Under systemd (Type=notify) the relay and
+// SDN controller report READY/STOPPING over NOTIFY_SOCKET and ping the
+// watchdog; under the Windows service control manager they report the
+// service state and stop on service control requests. Outside a service
+// manager all of this is a no-op.
+
+// sdNotify sends state to the systemd notify socket. It does nothing when
+// the process was not started by systemd.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// A leading '@' selects the abstract namespace, which net handles.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns the systemd watchdog timeout (WatchdogSec=), or
+// zero if the watchdog is not enabled for this process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// runWatchdog pings the systemd watchdog at half its timeout until ctx is
+// cancelled. Pings are skipped while healthy (nil means always healthy)
+// returns false, so systemd restarts an instance that stays unhealthy for
+// the whole timeout.
+func runWatchdog(ctx context.Context, healthy func() bool) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if healthy != nil && !healthy() {
+				slog.Warn("skipping watchdog ping: instance unhealthy")
+				continue
+			}
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				slog.Debug("watchdog ping failed", "error", err)
+			}
+		}
+	}
+}
+
+// serviceReady tells the service manager that startup finished.
+func serviceReady() {
+	if err := sdNotify("READY=1"); err != nil {
+		slog.Warn("failed to notify systemd", "error", err)
+	}
+	platformReady()
+}
+
+// serviceStopping tells the service manager that shutdown began.
+func serviceStopping() {
+	if err := sdNotify("STOPPING=1"); err != nil {
+		slog.Warn("failed to notify systemd", "error", err)
+	}
+	platformStopping()
+}
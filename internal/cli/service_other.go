@@ -0,0 +1,18 @@
+//go:build !windows
+
+package cli
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// serviceContext returns a context cancelled on SIGINT or SIGTERM.
+func serviceContext(string) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func platformReady()    {}
+func platformStopping() {}
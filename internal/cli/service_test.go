@@ -0,0 +1,88 @@
+//go:build linux
+
+package cli
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenNotify binds a fake systemd notify socket and points NOTIFY_SOCKET
+// at it.
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestSdNotify(t *testing.T) {
+	conn := listenNotify(t)
+
+	serviceReady()
+	assert.Equal(t, "READY=1", readNotify(t, conn))
+
+	serviceStopping()
+	assert.Equal(t, "STOPPING=1", readNotify(t, conn))
+}
+
+func TestSdNotify_NoSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	assert.NoError(t, sdNotify("READY=1"))
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	assert.Zero(t, watchdogInterval())
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "")
+	assert.Equal(t, 30*time.Second, watchdogInterval())
+
+	// Meant for another process
+	t.Setenv("WATCHDOG_PID", "1")
+	assert.Zero(t, watchdogInterval())
+}
+
+func TestRunWatchdog(t *testing.T) {
+	conn := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", strconv.Itoa(int(40*time.Millisecond/time.Microsecond)))
+	t.Setenv("WATCHDOG_PID", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	healthy := make(chan bool, 1)
+	healthy <- false
+	go runWatchdog(ctx, func() bool {
+		select {
+		case h := <-healthy:
+			return h
+		default:
+			return true
+		}
+	})
+
+	// The first tick is skipped as unhealthy; later ticks ping
+	assert.Equal(t, "WATCHDOG=1", readNotify(t, conn))
+	assert.Empty(t, healthy)
+}
@@ -0,0 +1,110 @@
+//go:build windows
+
+package cli
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceStopWait bounds how long the process waits for the service
+// control manager to acknowledge the stop before exiting.
+const serviceStopWait = 5 * time.Second
+
+var (
+	statusMu sync.Mutex
+	status   chan<- svc.Status // nil unless running as a service
+)
+
+// serviceContext returns a context cancelled on Ctrl+C or, when running as
+// a Windows service named name, on a stop or shutdown request. The cancel
+// function reports the service stopped.
+func serviceContext(name string) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	h := &serviceHandler{
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		if err := svc.Run(name, h); err != nil {
+			slog.Error("windows service failed", "service", name, "error", err)
+			cancel()
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			cancel()
+			stop()
+			close(h.stopped)
+			select {
+			case <-exited:
+			case <-time.After(serviceStopWait):
+			}
+		})
+	}
+}
+
+// serviceHandler relays service control requests to the context.
+type serviceHandler struct {
+	cancel  context.CancelFunc
+	stopped chan struct{} // closed when the command returns
+}
+
+func (h *serviceHandler) Execute(_ []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	s <- svc.Status{State: svc.StartPending}
+	statusMu.Lock()
+	status = s
+	statusMu.Unlock()
+
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				platformStopping()
+				h.cancel()
+			}
+		case <-h.stopped:
+			statusMu.Lock()
+			status = nil
+			statusMu.Unlock()
+			return false, 0
+		}
+	}
+}
+
+func setServiceStatus(st svc.Status) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if status != nil {
+		status <- st
+	}
+}
+
+func platformReady() {
+	setServiceStatus(svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown})
+}
+
+func platformStopping() {
+	setServiceStatus(svc.Status{State: svc.StopPending, WaitHint: 15000})
+}
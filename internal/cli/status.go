@@ -0,0 +1,279 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+)
+
+// `qumo status` prints a summary of a running relay from its /health,
+// /statusz and admin endpoints.
+
+// sdnStateHandlerFunc returns an http.HandlerFunc serving the registration
+// state and health of the relay's SDN controllers, the primary first.
+//
+//	GET /admin/sdn
+func sdnStateHandlerFunc(g *sdn.Group) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"controllers": g.Controllers()})
+	}
+}
+
+// errAdminToken is returned for an admin endpoint refusing the token.
+var errAdminToken = errors.New("admin token required")
+
+// nodeStatus is what `qumo status` gathers from a relay. Admin figures are
+// missing when the token is refused.
+type nodeStatus struct {
+	Health struct {
+		Status            string `json:"status"`
+		Uptime            string `json:"uptime"`
+		ActiveConnections int32  `json:"active_connections"`
+		Version           string `json:"version"`
+		Ready             bool   `json:"ready"`
+		ReadyReason       string `json:"ready_reason"`
+	}
+	Public struct {
+		ActiveBroadcasts  int     `json:"active_broadcasts"`
+		EgressBytesPerSec float64 `json:"egress_bytes_per_sec"`
+	}
+
+	Publications    int
+	PublicationsErr error
+
+	SDN struct {
+		Controllers []sdn.ControllerState `json:"controllers"`
+	}
+	SDNErr error // errNotConfigured without an SDN client
+}
+
+// statusClient queries the HTTP endpoint of a relay.
+type statusClient struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+// get decodes the JSON answer of path into v. Answers with a status in ok
+// are decoded; 401 is errAdminToken and 404 is errNotConfigured.
+func (c *statusClient) get(ctx context.Context, path string, v any, ok ...int) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK, slices.Contains(ok, resp.StatusCode):
+	case resp.StatusCode == http.StatusUnauthorized:
+		return errAdminToken
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotConfigured
+	default:
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: %w", path, err)
+	}
+	return nil
+}
+
+// fetch gathers the status of the relay. Only an unreachable /health is
+// an error; the other figures are left out with the reason.
+func (c *statusClient) fetch(ctx context.Context) (*nodeStatus, error) {
+	var st nodeStatus
+	// unhealthy relays answer 503 with the same body
+	if err := c.get(ctx, "/health", &st.Health, http.StatusServiceUnavailable); err != nil {
+		return nil, err
+	}
+	c.get(ctx, "/statusz?format=json", &st.Public, http.StatusServiceUnavailable)
+
+	var pubs struct {
+		Count int `json:"count"`
+	}
+	st.PublicationsErr = c.get(ctx, "/admin/publications", &pubs)
+	st.Publications = pubs.Count
+
+	st.SDNErr = c.get(ctx, "/admin/sdn", &st.SDN)
+	return &st, nil
+}
+
+// printStatus writes the human-readable summary of st.
+func printStatus(out io.Writer, base string, st *nodeStatus, now time.Time) {
+	h := st.Health
+	ready := "ready"
+	if !h.Ready {
+		ready = "not ready: " + cmp.Or(h.ReadyReason, "unknown")
+	}
+	fmt.Fprintf(out, "qumo relay at %s\n", base)
+	fmt.Fprintf(out, "  Status:      %s (%s)\n", h.Status, ready)
+	fmt.Fprintf(out, "  Version:     %s\n", h.Version)
+	fmt.Fprintf(out, "  Uptime:      %s\n", h.Uptime)
+	fmt.Fprintf(out, "  Sessions:    %d\n", h.ActiveConnections)
+
+	broadcasts := fmt.Sprintf("%d active", st.Public.ActiveBroadcasts)
+	if st.PublicationsErr == nil {
+		broadcasts += fmt.Sprintf(", %d registered", st.Publications)
+	}
+	fmt.Fprintf(out, "  Broadcasts:  %s\n", broadcasts)
+	fmt.Fprintf(out, "  Egress:      %.1f Mbit/s\n", st.Public.EgressBytesPerSec*8/1e6)
+	switch controllers := st.SDN.Controllers; {
+	case st.SDNErr != nil:
+		fmt.Fprintf(out, "  SDN:         %s\n", sdnUnavailable(st.SDNErr))
+	case len(controllers) == 1:
+		fmt.Fprintf(out, "  SDN:         %s\n", sdnSummary(controllers[0].RegistrationState, now))
+	default:
+		fmt.Fprintf(out, "  SDN:\n")
+		for _, c := range controllers {
+			fmt.Fprintf(out, "    %s\n", controllerSummary(c, now))
+		}
+	}
+}
+
+// sdnUnavailable describes why the SDN state could not be read.
+func sdnUnavailable(err error) string {
+	if errors.Is(err, errNotConfigured) {
+		return "not configured"
+	}
+	return "unknown (" + err.Error() + ")"
+}
+
+// controllerSummary describes one of several SDN controllers: its name,
+// role and health, then its registration state.
+func controllerSummary(c sdn.ControllerState, now time.Time) string {
+	var role []string
+	if c.Primary {
+		role = append(role, "primary")
+	}
+	if c.Active {
+		role = append(role, "active")
+	}
+	if !c.Healthy {
+		role = append(role, "unhealthy: "+c.HealthError)
+	}
+	name := c.Name
+	if len(role) > 0 {
+		name += " (" + strings.Join(role, ", ") + ")"
+	}
+	return name + ": " + sdnSummary(c.RegistrationState, now)
+}
+
+// sdnSummary describes the registration state s.
+func sdnSummary(s sdn.RegistrationState, now time.Time) string {
+	announces := fmt.Sprintf("%d announces, %d queued", s.Announces, s.QueuedOperations)
+	switch {
+	case !s.Topology && (s.State == "" || s.State == sdn.StateRegistered):
+		return fmt.Sprintf("%s at %s, announces only; %s", s.Relay, s.URL, announces)
+	case !s.Topology:
+		return fmt.Sprintf("%s at %s, announces only, %s: %s; %s", s.Relay, s.URL, s.State, cmp.Or(s.LastError, "pending"), announces)
+	case s.Registered:
+		return fmt.Sprintf("registered as %s at %s %s ago; %s", s.Relay, s.URL,
+			now.Sub(s.LastRegistered).Truncate(time.Second), announces)
+	default:
+		state := "not registered"
+		if s.State != "" {
+			state = string(s.State)
+		}
+		if !s.LastRegistered.IsZero() {
+			state += fmt.Sprintf(" since %s ago", now.Sub(s.LastRegistered).Truncate(time.Second))
+		}
+		return fmt.Sprintf("%s as %s at %s: %s; %s", state, s.Relay, s.URL, cmp.Or(s.LastError, "pending"), announces)
+	}
+}
+
+// RunStatus prints a summary of a running relay, refreshing it with -watch
+// until interrupted.
+func RunStatus(args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return runStatus(ctx, args, os.Stdout)
+}
+
+func runStatus(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	configFile := fs.String("config", "config.relay.yaml", "relay config to take the address and admin token from")
+	addr := fs.String("addr", "", "host:port or base URL of the relay's HTTP endpoint (default: localhost:<server.address port>)")
+	token := fs.String("token", "", "admin bearer token (default: admin.token)")
+	watch := fs.Bool("watch", false, "refresh the summary until interrupted")
+	interval := fs.Duration("interval", 2*time.Second, "refresh interval with -watch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return errors.New("-interval must be positive")
+	}
+
+	if *addr == "" || *token == "" {
+		cfg, err := loadConfig(*configFile)
+		switch {
+		case err == nil:
+			*addr = cmp.Or(*addr, net.JoinHostPort("localhost", portOf(cfg.Address)))
+			*token = cmp.Or(*token, cfg.AdminToken)
+		case *addr == "":
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+	base := strings.TrimSuffix(*addr, "/")
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+
+	c := &statusClient{base: base, token: *token, client: &http.Client{Timeout: 5 * time.Second}}
+	if !*watch {
+		st, err := c.fetch(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(out, base, st, time.Now())
+		return nil
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		st, err := c.fetch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		fmt.Fprint(out, "\033[H\033[2J") // clear the terminal
+		if err != nil {
+			fmt.Fprintf(out, "qumo relay at %s\n  unreachable: %v\n", base, err)
+		} else {
+			printStatus(out, base, st, time.Now())
+		}
+		fmt.Fprintf(out, "\nRefreshing every %s; Ctrl-C to stop\n", *interval)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
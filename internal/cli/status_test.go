@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statusRelay serves the endpoints `qumo status` reads, with admin
+// endpoints behind token.
+func statusRelay(t *testing.T, token string, controllers ...sdn.ControllerState) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"healthy","uptime":"1h2m3s","active_connections":12,"version":"v1.2.3","live":true,"ready":true}`))
+	})
+	mux.HandleFunc("/statusz", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "json", r.URL.Query().Get("format"))
+		w.Write([]byte(`{"status":"healthy","active_broadcasts":3,"egress_bytes_per_sec":250000}`))
+	})
+	mux.Handle("/admin/publications", adminAuth(token, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"publications":[],"count":5}`))
+	})))
+	if len(controllers) > 0 {
+		mux.Handle("/admin/sdn", adminAuth(token, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]any{"controllers": controllers})
+		})))
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRunStatus(t *testing.T) {
+	state := sdn.RegistrationState{
+		Relay:            "relay-a",
+		URL:              "http://sdn:8090",
+		Topology:         true,
+		Registered:       true,
+		LastRegistered:   time.Now().Add(-3 * time.Second),
+		Announces:        4,
+		QueuedOperations: 1,
+	}
+	srv := statusRelay(t, "s3cret", sdn.ControllerState{RegistrationState: state, Name: "sdn:8090", Primary: true, Active: true, Healthy: true})
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+
+	var out bytes.Buffer
+	err := runStatus(t.Context(), []string{"-config", missing, "-addr", strings.TrimPrefix(srv.URL, "http://"), "-token", "s3cret"}, &out)
+	require.NoError(t, err)
+	for _, want := range []string{
+		"healthy (ready)",
+		"v1.2.3",
+		"1h2m3s",
+		"Sessions:    12",
+		"3 active, 5 registered",
+		"2.0 Mbit/s",
+		"registered as relay-a at http://sdn:8090 3s ago; 4 announces, 1 queued",
+	} {
+		assert.Contains(t, out.String(), want)
+	}
+
+	// Without the token the admin figures are left out
+	out.Reset()
+	err = runStatus(t.Context(), []string{"-config", missing, "-addr", srv.URL}, &out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "Broadcasts:  3 active\n")
+	assert.Contains(t, out.String(), "SDN:         unknown (admin token required)")
+}
+
+func TestRunStatus_SDN(t *testing.T) {
+	now := time.Now()
+	tests := map[string]struct {
+		state *sdn.RegistrationState
+		want  string
+	}{
+		"not configured": {want: "SDN:         not configured"},
+		"announces only": {
+			state: &sdn.RegistrationState{Relay: "relay-a", URL: "http://sdn", Announces: 2},
+			want:  "relay-a at http://sdn, announces only; 2 announces, 0 queued",
+		},
+		"failing": {
+			state: &sdn.RegistrationState{Relay: "relay-a", URL: "http://sdn", Topology: true, LastRegistered: now.Add(-time.Minute), LastError: "connection refused"},
+			want:  "not registered since 1m0s ago as relay-a at http://sdn: connection refused",
+		},
+		"unreachable": {
+			state: &sdn.RegistrationState{Relay: "relay-a", URL: "http://sdn", Topology: true, State: sdn.StateUnreachable, LastError: "connection refused"},
+			want:  "unreachable as relay-a at http://sdn: connection refused",
+		},
+		"announces only, connecting": {
+			state: &sdn.RegistrationState{Relay: "relay-a", URL: "http://sdn", State: sdn.StateConnecting, LastError: "503"},
+			want:  "relay-a at http://sdn, announces only, connecting: 503; 0 announces, 0 queued",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var controllers []sdn.ControllerState
+			if tt.state != nil {
+				controllers = append(controllers, sdn.ControllerState{RegistrationState: *tt.state})
+			}
+			srv := statusRelay(t, "", controllers...)
+			var out bytes.Buffer
+			require.NoError(t, runStatus(t.Context(), []string{"-addr", srv.URL, "-token", "x"}, &out))
+			assert.Contains(t, out.String(), tt.want)
+		})
+	}
+}
+
+func TestRunStatus_Controllers(t *testing.T) {
+	srv := statusRelay(t, "",
+		sdn.ControllerState{
+			RegistrationState: sdn.RegistrationState{Relay: "relay-a", URL: "http://prod", Topology: true, LastError: "503"},
+			Name:              "prod",
+			Primary:           true,
+			HealthError:       "connection refused",
+		},
+		sdn.ControllerState{
+			RegistrationState: sdn.RegistrationState{Relay: "relay-a", URL: "http://staging", Announces: 1},
+			Name:              "staging",
+			Active:            true,
+			Healthy:           true,
+		},
+	)
+
+	var out bytes.Buffer
+	require.NoError(t, runStatus(t.Context(), []string{"-addr", srv.URL, "-token", "x"}, &out))
+	assert.Contains(t, out.String(), "  SDN:\n")
+	assert.Contains(t, out.String(), "    prod (primary, unhealthy: connection refused): not registered as relay-a at http://prod: 503")
+	assert.Contains(t, out.String(), "    staging (active): relay-a at http://staging, announces only; 1 announces")
+}
+
+func TestRunStatus_Watch(t *testing.T) {
+	srv := statusRelay(t, "")
+	ctx, cancel := context.WithTimeout(t.Context(), 120*time.Millisecond)
+	defer cancel()
+
+	var out bytes.Buffer
+	err := runStatus(ctx, []string{"-addr", srv.URL, "-token", "x", "-watch", "-interval", "20ms"}, &out)
+	require.NoError(t, err)
+	assert.Greater(t, strings.Count(out.String(), "Status:      healthy"), 1, "the summary is refreshed")
+}
+
+func TestRunStatus_Unreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	err := runStatus(t.Context(), []string{"-addr", srv.URL, "-token", "x"}, &bytes.Buffer{})
+	assert.Error(t, err)
+
+	err = runStatus(t.Context(), []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "failed to load config")
+}
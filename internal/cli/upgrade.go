@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/relay"
+)
+
+// Zero-downtime upgrades. A relay with server.handoff enabled owns its
+// sockets through a relay.HandoffListener; POST /admin/upgrade starts a new
+// relay process on the same sockets and, once it listens, drains this one.
+// `qumo upgrade` sends that request.
+
+// defaultHandoffDrain bounds how long a relay that handed off drains its
+// sessions when server.handoff_drain_sec is unset. Its sessions end as
+// their clients reconnect to the new process, so it is far longer than the
+// drain on a plain shutdown.
+const defaultHandoffDrain = 10 * time.Minute
+
+// upgradeResult is the response of POST /admin/upgrade.
+type upgradeResult struct {
+	PID        int `json:"pid"`
+	Generation int `json:"generation"`
+}
+
+// upgradeFunc starts a new relay process running binary, or the current
+// binary if it is empty, and returns its pid once it listens.
+type upgradeFunc func(ctx context.Context, binary string) (int, error)
+
+// handoffUpgrader returns the upgradeFunc handing h and the HTTP listener
+// ln to a new process started with this process's arguments.
+func handoffUpgrader(h *relay.HandoffListener, ln net.Listener, executable string) upgradeFunc {
+	return func(ctx context.Context, binary string) (int, error) {
+		tcp, ok := ln.(*net.TCPListener)
+		if !ok {
+			return 0, errors.New("HTTP listener cannot be handed off")
+		}
+
+		pid, err := h.Handoff(ctx, cmp.Or(binary, executable), os.Args[1:], tcp)
+		if err != nil {
+			return 0, err
+		}
+		// Let systemd follow the new process (needs NotifyAccess=all)
+		if err := sdNotify(fmt.Sprintf("MAINPID=%d", pid)); err != nil {
+			log.Printf("Failed to report new main PID: %v", err)
+		}
+		return pid, nil
+	}
+}
+
+// upgradeHandlerFunc serves POST /admin/upgrade with an optional JSON body
+// {"binary": "/path/to/qumo"}. It calls drain after the new process took
+// over, so this process stops accepting connections, keeps its SDN
+// registrations for the new process and exits once its sessions have
+// drained.
+func upgradeHandlerFunc(upgrade upgradeFunc, generation int, drain func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body struct {
+			Binary string `json:"binary"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		pid, err := upgrade(ctx, body.Binary)
+		switch {
+		case errors.Is(err, relay.ErrHandedOff):
+			http.Error(w, "upgrade already in progress", http.StatusConflict)
+			return
+		case errors.Is(err, relay.ErrHandoffUnsupported):
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		case err != nil:
+			http.Error(w, "upgrade failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Handed off to pid %d; draining sessions", pid)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(upgradeResult{PID: pid, Generation: generation + 1})
+		drain()
+	}
+}
+
+// RunUpgrade asks a running relay to hand its sockets to a new process and
+// prints the new process's pid.
+func RunUpgrade(args []string) error {
+	return runUpgrade(args, os.Stdout)
+}
+
+func runUpgrade(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+	configFile := fs.String("config", "config.relay.yaml", "relay config to take the address and admin token from")
+	target := fs.String("url", "", "base URL of the relay's HTTP endpoint (default: http://localhost:<server.address port>)")
+	token := fs.String("token", "", "admin bearer token (default: admin.token)")
+	binary := fs.String("binary", "", "binary to start (default: the running relay's)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *target == "" || *token == "" {
+		cfg, err := loadConfig(*configFile)
+		switch {
+		case err == nil:
+			*target = cmp.Or(*target, "http://"+net.JoinHostPort("localhost", portOf(cfg.Address)))
+			*token = cmp.Or(*token, cfg.AdminToken)
+		case *target == "":
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+
+	body, _ := json.Marshal(map[string]string{"binary": *binary})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(*target, "/")+"/admin/upgrade", strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+
+	resp, err := (&http.Client{Timeout: time.Minute}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("upgrade failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var res upgradeResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Relay handed off to pid %d (generation %d); the old process drains its sessions and exits\n", res.PID, res.Generation)
+	return nil
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/okdaichi/qumo/internal/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeHandlerFunc(t *testing.T) {
+	var gotBinary string
+	drained := 0
+	upgrade := func(_ context.Context, binary string) (int, error) {
+		gotBinary = binary
+		return 4242, nil
+	}
+	h := upgradeHandlerFunc(upgrade, 2, func() { drained++ })
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/admin/upgrade", strings.NewReader(`{"binary":"/opt/qumo/bin/qumo"}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res upgradeResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, upgradeResult{PID: 4242, Generation: 3}, res)
+	assert.Equal(t, "/opt/qumo/bin/qumo", gotBinary)
+	assert.Equal(t, 1, drained)
+
+	// The body is optional
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/admin/upgrade", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, gotBinary)
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/admin/upgrade", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/admin/upgrade", strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestUpgradeHandlerFunc_Errors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{relay.ErrHandedOff, http.StatusConflict},
+		{relay.ErrHandoffUnsupported, http.StatusNotImplemented},
+		{errors.New("exec: not found"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			drained := false
+			h := upgradeHandlerFunc(func(context.Context, string) (int, error) {
+				return 0, tt.err
+			}, 0, func() { drained = true })
+
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodPost, "/admin/upgrade", nil))
+			assert.Equal(t, tt.want, rec.Code)
+			assert.False(t, drained, "keeps serving when the upgrade fails")
+		})
+	}
+}
+
+func TestRunUpgrade(t *testing.T) {
+	var gotAuth, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/admin/upgrade", r.URL.Path)
+		gotAuth = r.Header.Get("Authorization")
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+		gotBody = buf.String()
+		json.NewEncoder(w).Encode(upgradeResult{PID: 77, Generation: 1})
+	}))
+	defer srv.Close()
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("admin:\n  token: s3cret\n"), 0644))
+
+	var out bytes.Buffer
+	err := runUpgrade([]string{"-config", configFile, "-url", srv.URL, "-binary", "/usr/local/bin/qumo"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer s3cret", gotAuth, "token from the config")
+	assert.JSONEq(t, `{"binary":"/usr/local/bin/qumo"}`, gotBody)
+	assert.Contains(t, out.String(), "pid 77")
+}
+
+func TestRunUpgrade_Rejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upgrade already in progress", http.StatusConflict)
+	}))
+	defer srv.Close()
+
+	err := runUpgrade([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml"), "-url", srv.URL}, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "upgrade already in progress")
+
+	err = runUpgrade([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "failed to load config")
+}
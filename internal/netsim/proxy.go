@@ -0,0 +1,264 @@
+// Package netsim simulates an impaired network link between in-process
+// relays. A Proxy forwards UDP datagrams, and so QUIC connections, to a
+// target address while adding latency, jitter, packet loss and a bandwidth
+// cap, so tests can exercise route failover, catch-up and backpressure
+// under reproducible conditions.
+//
+//	p, _ := netsim.Listen("127.0.0.1:0", "127.0.0.1:4434", 1) // relay B
+//	defer p.Close()
+//	p.SetImpairment(netsim.Impairment{Latency: 50 * time.Millisecond, Loss: 0.02})
+//	// relay A dials p.Addr() instead of relay B
+package netsim
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxDatagram is the largest datagram the proxy forwards.
+const maxDatagram = 64 << 10
+
+// Impairment describes one direction of a simulated link.
+type Impairment struct {
+	// Latency delays every datagram.
+	Latency time.Duration
+
+	// Jitter adds a uniformly random delay in [0, Jitter) on top of
+	// Latency. Datagrams may be reordered, as on a real network.
+	Jitter time.Duration
+
+	// Loss is the probability in [0, 1] that a datagram is dropped. 1 cuts
+	// the link.
+	Loss float64
+
+	// Bandwidth caps the link in bytes/sec; datagrams queue behind each
+	// other as on a bottleneck link. Zero is unlimited.
+	Bandwidth int64
+
+	// QueueLimit drops datagrams that would wait longer than this for the
+	// bandwidth cap, like a router's tail drop. Zero queues without limit.
+	QueueLimit time.Duration
+}
+
+// Stats counts the datagrams a Proxy handled in one direction.
+type Stats struct {
+	Forwarded uint64 `json:"forwarded"`
+	Dropped   uint64 `json:"dropped"`
+	Bytes     uint64 `json:"bytes"` // forwarded
+}
+
+// Proxy forwards the datagrams of every client that sends to its address
+// to the target and the target's replies back, through an impaired link.
+// Each direction has its own Impairment and Stats.
+type Proxy struct {
+	conn   *net.UDPConn
+	target *net.UDPAddr
+
+	mu      sync.Mutex
+	rng     *rand.Rand
+	up      link // client → target
+	down    link // target → client
+	clients map[string]*net.UDPConn
+	closed  bool
+
+	wg sync.WaitGroup
+}
+
+// link is the state of one direction.
+type link struct {
+	Impairment
+	busyUntil time.Time // when the bandwidth cap frees up
+	stats     Stats
+}
+
+// Listen starts a proxy on the UDP address addr that forwards to target.
+// seed makes the random loss and jitter reproducible.
+func Listen(addr, target string, seed uint64) (*Proxy, error) {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	taddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		conn:    conn,
+		target:  taddr,
+		rng:     rand.New(rand.NewPCG(seed, seed)),
+		clients: make(map[string]*net.UDPConn),
+	}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+// Addr returns the address clients send to.
+func (p *Proxy) Addr() *net.UDPAddr {
+	return p.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// SetImpairment applies imp to both directions.
+func (p *Proxy) SetImpairment(imp Impairment) {
+	p.SetImpairments(imp, imp)
+}
+
+// SetImpairments applies up to datagrams from clients to the target and
+// down to the replies. Datagrams already in flight keep their delay.
+func (p *Proxy) SetImpairments(up, down Impairment) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.up.Impairment = up
+	p.down.Impairment = down
+}
+
+// Stats returns the counts of datagrams sent to the target (up) and back
+// to clients (down).
+func (p *Proxy) Stats() (up, down Stats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.up.stats, p.down.stats
+}
+
+// Close stops the proxy. Datagrams still in flight are dropped.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	for _, c := range p.clients {
+		c.Close()
+	}
+	p.mu.Unlock()
+
+	err := p.conn.Close()
+	p.wg.Wait()
+	return err
+}
+
+// serve reads datagrams from clients and forwards them to the target over
+// a connection per client, so replies can be told apart.
+func (p *Proxy) serve() {
+	defer p.wg.Done()
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, from, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		upstream, err := p.client(from)
+		if err != nil {
+			continue
+		}
+		p.send(&p.up, buf[:n], func(b []byte) { upstream.Write(b) })
+	}
+}
+
+// client returns the connection to the target for the client at addr,
+// dialing it and starting its reply loop on first use.
+func (p *Proxy) client(addr *net.UDPAddr) (*net.UDPConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, net.ErrClosed
+	}
+	if c, ok := p.clients[addr.String()]; ok {
+		return c, nil
+	}
+	c, err := net.DialUDP("udp", nil, p.target)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[addr.String()] = c
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		buf := make([]byte, maxDatagram)
+		for {
+			n, err := c.Read(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			p.send(&p.down, buf[:n], func(b []byte) { p.conn.WriteToUDP(b, addr) })
+		}
+	}()
+	return c, nil
+}
+
+// send passes a copy of b through l and calls deliver with it once the
+// datagram arrives, unless it is lost.
+func (p *Proxy) send(l *link, b []byte, deliver func([]byte)) {
+	p.mu.Lock()
+	now := time.Now()
+	delay, ok := l.schedule(now, len(b), p.rng)
+	if !ok || p.closed {
+		l.stats.Dropped++
+		p.mu.Unlock()
+		return
+	}
+	l.stats.Forwarded++
+	l.stats.Bytes += uint64(len(b))
+	p.mu.Unlock()
+
+	datagram := append([]byte(nil), b...)
+	if delay <= 0 {
+		deliver(datagram)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if !closed {
+			deliver(datagram)
+		}
+	})
+}
+
+// schedule returns how long after now a datagram of size bytes arrives,
+// or false if it is dropped. Caller must hold the proxy's lock.
+func (l *link) schedule(now time.Time, size int, rng *rand.Rand) (time.Duration, bool) {
+	if l.Loss > 0 && rng.Float64() < l.Loss {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if l.Bandwidth > 0 {
+		start := now
+		if l.busyUntil.After(start) {
+			start = l.busyUntil
+		}
+		if l.QueueLimit > 0 && start.Sub(now) > l.QueueLimit {
+			return 0, false
+		}
+		done := start.Add(time.Duration(int64(size) * int64(time.Second) / l.Bandwidth))
+		l.busyUntil = done
+		delay = done.Sub(now)
+	}
+
+	delay += l.Latency
+	if l.Jitter > 0 {
+		delay += time.Duration(rng.Int64N(int64(l.Jitter)))
+	}
+	return delay, true
+}
@@ -0,0 +1,146 @@
+package netsim
+
+import (
+	"math/rand/v2"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer replies to every datagram with the same bytes.
+func echoServer(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxDatagram)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(buf[:n], from)
+		}
+	}()
+	return conn
+}
+
+func newProxy(t *testing.T, seed uint64) (*Proxy, *net.UDPConn) {
+	t.Helper()
+	echo := echoServer(t)
+	p, err := Listen("127.0.0.1:0", echo.LocalAddr().String(), seed)
+	require.NoError(t, err)
+	t.Cleanup(func() { p.Close() })
+
+	client, err := net.DialUDP("udp", nil, p.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return p, client
+}
+
+func roundTrip(t *testing.T, c *net.UDPConn, msg string, timeout time.Duration) (string, bool) {
+	t.Helper()
+	_, err := c.Write([]byte(msg))
+	require.NoError(t, err)
+	c.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 1500)
+	n, err := c.Read(buf)
+	if err != nil {
+		return "", false
+	}
+	return string(buf[:n]), true
+}
+
+func TestProxy_Forwards(t *testing.T) {
+	p, client := newProxy(t, 1)
+
+	got, ok := roundTrip(t, client, "hello", time.Second)
+	require.True(t, ok)
+	assert.Equal(t, "hello", got)
+
+	up, down := p.Stats()
+	assert.Equal(t, Stats{Forwarded: 1, Bytes: 5}, up)
+	assert.Equal(t, Stats{Forwarded: 1, Bytes: 5}, down)
+}
+
+func TestProxy_Latency(t *testing.T) {
+	p, client := newProxy(t, 1)
+	p.SetImpairments(Impairment{Latency: 40 * time.Millisecond}, Impairment{Latency: 20 * time.Millisecond})
+
+	start := time.Now()
+	_, ok := roundTrip(t, client, "ping", time.Second)
+	require.True(t, ok)
+	assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+}
+
+func TestProxy_Partition(t *testing.T) {
+	p, client := newProxy(t, 1)
+	p.SetImpairment(Impairment{Loss: 1})
+
+	_, ok := roundTrip(t, client, "lost", 100*time.Millisecond)
+	assert.False(t, ok)
+	up, _ := p.Stats()
+	assert.Equal(t, uint64(1), up.Dropped)
+
+	// Healing the link restores traffic.
+	p.SetImpairment(Impairment{})
+	got, ok := roundTrip(t, client, "back", time.Second)
+	require.True(t, ok)
+	assert.Equal(t, "back", got)
+}
+
+func TestLink_LossIsReproducible(t *testing.T) {
+	drops := func(seed uint64) []int {
+		l := &link{Impairment: Impairment{Loss: 0.3}}
+		rng := rand.New(rand.NewPCG(seed, seed))
+		var dropped []int
+		for i := range 200 {
+			if _, ok := l.schedule(time.Now(), 100, rng); !ok {
+				dropped = append(dropped, i)
+			}
+		}
+		return dropped
+	}
+
+	a := drops(7)
+	assert.Equal(t, a, drops(7))
+	assert.NotEqual(t, a, drops(8))
+	assert.InDelta(t, 60, len(a), 25)
+}
+
+func TestLink_Jitter(t *testing.T) {
+	l := &link{Impairment: Impairment{Latency: 10 * time.Millisecond, Jitter: 5 * time.Millisecond}}
+	rng := rand.New(rand.NewPCG(1, 1))
+	for range 100 {
+		d, ok := l.schedule(time.Now(), 100, rng)
+		require.True(t, ok)
+		assert.GreaterOrEqual(t, d, 10*time.Millisecond)
+		assert.Less(t, d, 15*time.Millisecond)
+	}
+}
+
+func TestLink_Bandwidth(t *testing.T) {
+	l := &link{Impairment: Impairment{Bandwidth: 1000, QueueLimit: 250 * time.Millisecond}}
+	rng := rand.New(rand.NewPCG(1, 1))
+	now := time.Now()
+
+	// 100-byte datagrams take 100ms each at 1000 B/s and queue back to back.
+	for i, want := range []time.Duration{100, 200, 300} {
+		d, ok := l.schedule(now, 100, rng)
+		require.True(t, ok, i)
+		assert.Equal(t, want*time.Millisecond, d, i)
+	}
+
+	// The fourth would wait 300ms for the link, past the queue limit.
+	_, ok := l.schedule(now, 100, rng)
+	assert.False(t, ok)
+
+	// Once the queue drained, datagrams go straight through again.
+	d, ok := l.schedule(now.Add(time.Second), 100, rng)
+	require.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, d)
+}
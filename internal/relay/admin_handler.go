@@ -0,0 +1,266 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/qumo/internal/version"
+)
+
+// egressLimitBody is the JSON body of GET/PUT /admin/egress-limit.
+type egressLimitBody struct {
+	BytesPerSec int64 `json:"bytes_per_sec"` // 0 = unlimited
+}
+
+// EgressLimitHandlerFunc returns an http.HandlerFunc to inspect and adjust
+// the global egress cap at runtime.
+//
+//	GET /admin/egress-limit
+//	PUT /admin/egress-limit  {"bytes_per_sec": 12500000}
+func EgressLimitHandlerFunc(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var body egressLimitBody
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				jsonError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+				return
+			}
+			if body.BytesPerSec < 0 {
+				jsonError(w, http.StatusBadRequest, "bytes_per_sec must not be negative")
+				return
+			}
+			s.SetEgressLimit(body.BytesPerSec)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(egressLimitBody{BytesPerSec: s.EgressLimit()})
+	}
+}
+
+// PublicationsHandlerFunc returns an http.HandlerFunc that lists the
+// publications registered on the relay's TrackMux. POST runs the
+// publication sweeper immediately and reports how many entries it removed.
+//
+//	GET  /admin/publications
+//	POST /admin/publications  (garbage-collect ended publications)
+func PublicationsHandlerFunc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := map[string]any{}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			resp["collected"] = globalPublications.gc()
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		pubs := Publications()
+		resp["publications"] = pubs
+		resp["count"] = len(pubs)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// SessionsHandlerFunc returns an http.HandlerFunc that lists the MoQ
+// sessions connected to s with their IDs and reconnect chains.
+//
+//	GET /admin/sessions
+func SessionsHandlerFunc(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		_ = s.Configure()
+		sessions := s.peerRegistry.listPeers()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"sessions": sessions,
+			"count":    len(sessions),
+		})
+	}
+}
+
+// SubscribersHandlerFunc returns an http.HandlerFunc that lists the
+// downstream subscriptions of the relayed tracks with how far each is
+// behind live, furthest behind first.
+//
+//	GET /admin/subscribers
+func SubscribersHandlerFunc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		subs := Subscribers()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"subscribers": subs,
+			"count":       len(subs),
+		})
+	}
+}
+
+// BuildInfoHandlerFunc returns an http.HandlerFunc that reports the
+// relay binary's version, commit, build date and Go version.
+//
+//	GET /admin/buildinfo
+func BuildInfoHandlerFunc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(version.Info())
+	}
+}
+
+// TrackCacheHandlerFunc returns an http.HandlerFunc that exposes the group
+// cache of a relayed track for debugging. It is mounted at prefix; the rest
+// of the URL names the broadcast path and track, whose segments may be
+// percent-encoded (a track name containing "/" must be).
+//
+//	GET <prefix><path>/<track>/groups
+//	GET <prefix><path>/<track>/groups/<seq>/frames/<idx>  (raw frame bytes)
+func TrackCacheHandlerFunc(prefix string) http.HandlerFunc {
+	return trackCacheHandlerFunc(prefix, false)
+}
+
+// PeerTracksHandlerFunc returns TrackCacheHandlerFunc(PeerTracksPrefix) for
+// the peers verifying what they relay from this relay, except that private
+// broadcasts are not found: the peers' token must not expose them.
+func PeerTracksHandlerFunc() http.HandlerFunc {
+	return trackCacheHandlerFunc(PeerTracksPrefix, true)
+}
+
+// trackCacheHandlerFunc serves TrackCacheHandlerFunc, hiding private
+// broadcasts if public is set.
+func trackCacheHandlerFunc(prefix string, public bool) http.HandlerFunc {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		req, err := parseTrackCacheRequest(strings.TrimPrefix(r.URL.EscapedPath(), prefix))
+		if err != nil {
+			jsonError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		var d *trackDistributor
+		if h := globalPublications.handler(req.path); h != nil && !(public && h.Visibility != nil) {
+			d = h.distributor(moqt.TrackName(req.track))
+		}
+		if d == nil {
+			jsonError(w, http.StatusNotFound, "track is not being relayed")
+			return
+		}
+
+		if !req.frame {
+			groups := d.ring.list()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{
+				"broadcast_path": req.path,
+				"track_name":     req.track,
+				"groups":         groups,
+				"count":          len(groups),
+			})
+			return
+		}
+
+		cache := d.ring.lookup(moqt.GroupSequence(req.seq))
+		if cache == nil {
+			jsonError(w, http.StatusNotFound, "group is not cached")
+			return
+		}
+		body, ok := cache.frameBody(req.index)
+		if !ok {
+			jsonError(w, http.StatusNotFound, "frame is not cached")
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+// trackCacheRequest is a parsed TrackCacheHandlerFunc URL.
+type trackCacheRequest struct {
+	path, track string
+	frame       bool // a single frame rather than the group listing
+	seq         uint64
+	index       int
+}
+
+// parseTrackCacheRequest parses "<path>/<track>/groups[/<seq>/frames/<idx>]"
+// from the escaped URL path below the handler's prefix.
+func parseTrackCacheRequest(escaped string) (trackCacheRequest, error) {
+	var req trackCacheRequest
+	segs := strings.Split(strings.Trim(escaped, "/"), "/")
+	for i, seg := range segs {
+		s, err := url.PathUnescape(seg)
+		if err != nil {
+			return req, errInvalidCacheURL
+		}
+		segs[i] = s
+	}
+
+	n := len(segs)
+	switch {
+	case n >= 3 && segs[n-1] == "groups":
+		segs = segs[:n-1]
+	case n >= 6 && segs[n-4] == "groups" && segs[n-2] == "frames":
+		seq, err := strconv.ParseUint(segs[n-3], 10, 64)
+		if err != nil {
+			return req, errInvalidCacheURL
+		}
+		idx, err := strconv.Atoi(segs[n-1])
+		if err != nil || idx < 0 {
+			return req, errInvalidCacheURL
+		}
+		req.frame, req.seq, req.index = true, seq, idx
+		segs = segs[:n-4]
+	default:
+		return req, errInvalidCacheURL
+	}
+
+	req.track = segs[len(segs)-1]
+	req.path = "/" + strings.Join(segs[:len(segs)-1], "/")
+	return req, nil
+}
+
+var errInvalidCacheURL = errors.New("expected <path>/<track>/groups or <path>/<track>/groups/<seq>/frames/<idx>")
+
+// jsonError writes a JSON error response.
+func jsonError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,178 @@
+package relay
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/okdaichi/qumo/internal/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEgressLimitHandlerFunc(t *testing.T) {
+	s := &Server{}
+	t.Cleanup(func() { s.SetEgressLimit(0) })
+	handler := EgressLimitHandlerFunc(s)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPut, "/admin/egress-limit", strings.NewReader(`{"bytes_per_sec": 125000}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int64(125000), s.EgressLimit())
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/egress-limit", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body egressLimitBody
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, int64(125000), body.BytesPerSec)
+}
+
+func TestEgressLimitHandlerFunc_Errors(t *testing.T) {
+	handler := EgressLimitHandlerFunc(&Server{})
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"bad method", http.MethodPost, "", http.StatusMethodNotAllowed},
+		{"invalid json", http.MethodPut, "nope", http.StatusBadRequest},
+		{"negative", http.MethodPut, `{"bytes_per_sec": -1}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tt.method, "/admin/egress-limit", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestSessionsHandlerFunc(t *testing.T) {
+	s := &Server{TLSConfig: &tls.Config{}}
+	require.NoError(t, s.Configure())
+	s.peerRegistry.register(nil, "s1", "")
+	s.peerRegistry.register(nil, "s2", "s1")
+	handler := SessionsHandlerFunc(s)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/sessions", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Sessions []peerInfo `json:"sessions"`
+		Count    int        `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.Equal(t, 2, body.Count)
+	assert.Equal(t, "s2", body.Sessions[1].ID)
+	assert.Equal(t, "s1", body.Sessions[1].PreviousID)
+	assert.Equal(t, 1, body.Sessions[1].Reconnects)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/sessions", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestBuildInfoHandlerFunc(t *testing.T) {
+	handler := BuildInfoHandlerFunc()
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/buildinfo", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body version.BuildInfo
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, version.Info(), body)
+	assert.NotEmpty(t, body.GoVersion)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/buildinfo", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestTrackCacheHandlerFunc(t *testing.T) {
+	prev := globalPublications
+	globalPublications = newPublicationRegistry()
+	t.Cleanup(func() { globalPublications = prev })
+
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+	ring.add(&fakeGroupSource{seq: 1, frames: []string{"key", "delta"}, end: io.EOF}, nil)
+	ring.add(&fakeGroupSource{seq: 2, frames: []string{"x"}, end: os.ErrDeadlineExceeded}, nil)
+	h := &RelayHandler{relaying: map[moqt.TrackName]*trackDistributor{"video/hd": {ring: ring}}}
+	globalPublications.add(nil, "/live/room", SourceLocal, "", h, func() bool { return true })
+
+	handler := TrackCacheHandlerFunc("/admin/tracks/")
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/tracks/live/room/video%2Fhd/groups", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Groups []CachedGroup `json:"groups"`
+		Count  int           `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.Equal(t, 2, body.Count)
+	assert.Equal(t, CachedGroup{Sequence: 1, Frames: 2, Bytes: 8, Complete: true, Checksum: "1b1f156a"}, withoutAge(body.Groups[0]))
+	assert.True(t, body.Groups[1].Truncated)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/tracks/live/room/video%2Fhd/groups/1/frames/1", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "delta", rec.Body.String())
+
+	for _, target := range []string{
+		"/admin/tracks/live/room/video%2Fhd/groups/1/frames/2", // no such frame
+		"/admin/tracks/live/room/video%2Fhd/groups/9/frames/0", // no such group
+		"/admin/tracks/live/room/audio/groups",                 // not relayed
+		"/admin/tracks/live/other/video%2Fhd/groups",           // no publication
+		"/admin/tracks/live/room/video%2Fhd",                   // malformed
+		"/admin/tracks/live/room/video%2Fhd/groups/x/frames/0", // malformed
+	} {
+		rec = httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code, target)
+	}
+}
+
+func TestPeerTracksHandlerFunc_Private(t *testing.T) {
+	prev := globalPublications
+	globalPublications = newPublicationRegistry()
+	t.Cleanup(func() { globalPublications = prev })
+
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+	ring.add(&fakeGroupSource{seq: 1, frames: []string{"key"}, end: io.EOF}, nil)
+	relaying := map[moqt.TrackName]*trackDistributor{"video": {ring: ring}}
+	globalPublications.add(nil, "/live/public", SourceLocal, "", &RelayHandler{relaying: relaying}, func() bool { return true })
+	globalPublications.add(nil, "/live/private", SourceLocal, "",
+		&RelayHandler{relaying: relaying, Visibility: &sdn.Visibility{Tenant: "brand-a"}}, func() bool { return true })
+
+	for target, want := range map[string]int{
+		"/peer/tracks/live/public/video/groups":  http.StatusOK,
+		"/peer/tracks/live/private/video/groups": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		PeerTracksHandlerFunc()(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, want, rec.Code, target)
+	}
+
+	// The admin listing still shows it
+	rec := httptest.NewRecorder()
+	TrackCacheHandlerFunc("/admin/tracks/")(rec, httptest.NewRequest(http.MethodGet, "/admin/tracks/live/private/video/groups", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func withoutAge(g CachedGroup) CachedGroup {
+	g.AgeMs = 0
+	return g
+}
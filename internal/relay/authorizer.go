@@ -0,0 +1,146 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// SubscribeRequest describes an incoming subscription to be authorized.
+type SubscribeRequest struct {
+	// Identity is the authenticated subscriber, or "" if anonymous.
+	// See IdentityFromContext.
+	Identity      string
+	BroadcastPath moqt.BroadcastPath
+	TrackName     moqt.TrackName
+}
+
+// Decision is an Authorizer's verdict on a subscription.
+type Decision struct {
+	Allow bool
+
+	// Reason is logged when the subscription is denied.
+	Reason string
+
+	// MaxRenditions limits how many tracks of the same broadcast the
+	// identity may receive concurrently. Zero means unlimited.
+	// Anonymous subscribers are not counted.
+	MaxRenditions int
+
+	// ExpiresAt ends the subscription at the given time. Zero means never.
+	ExpiresAt time.Time
+}
+
+// Authorizer decides whether a subscriber may receive a track. It is invoked
+// for every incoming subscribe before any data is relayed, so
+// implementations should be fast or cache their entitlement lookups.
+type Authorizer interface {
+	AuthorizeSubscribe(ctx context.Context, req SubscribeRequest) Decision
+}
+
+// AuthorizerFunc adapts a function to the Authorizer interface.
+type AuthorizerFunc func(ctx context.Context, req SubscribeRequest) Decision
+
+func (f AuthorizerFunc) AuthorizeSubscribe(ctx context.Context, req SubscribeRequest) Decision {
+	return f(ctx, req)
+}
+
+// AllowAll is the default Authorizer; it accepts every subscription.
+var AllowAll Authorizer = AuthorizerFunc(func(context.Context, SubscribeRequest) Decision {
+	return Decision{Allow: true}
+})
+
+type identityCtxKey struct{}
+
+// WithIdentity returns a context carrying the subscriber identity. Transports
+// that authenticate peers (e.g. via a QUIC ConnContext hook) attach it to the
+// connection context so that it reaches AuthorizeSubscribe.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityCtxKey{}, identity)
+}
+
+// IdentityFromContext returns the identity set by WithIdentity or, failing
+// that, the one of the client certificate the session's QUIC connection
+// presented, if the relay verified it (see CertificateIdentity). It
+// returns "" for anonymous sessions.
+func IdentityFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(identityCtxKey{}).(string); ok {
+		return id
+	}
+	if conn := quicConnFromContext(ctx); conn != nil {
+		return CertificateIdentity(conn.ConnectionState().TLS)
+	}
+	return ""
+}
+
+// CertificateIdentity returns the identity a verified client certificate
+// authenticates: its subject common name, or else its first DNS name. It
+// returns "" if the client sent no certificate or it was not verified
+// against the relay's client CAs.
+func CertificateIdentity(state tls.ConnectionState) string {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	leaf := state.VerifiedChains[0][0]
+	if leaf.Subject.CommonName != "" {
+		return leaf.Subject.CommonName
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0]
+	}
+	return ""
+}
+
+// subscriptionGate applies an Authorizer and enforces the constraints of its
+// decisions for a single broadcast. It is safe for concurrent use.
+type subscriptionGate struct {
+	mu     sync.Mutex
+	active map[string]int // identity → tracks currently served
+}
+
+// admit authorizes req with auth (nil means AllowAll). On success it returns
+// a release function that must be called when the subscription ends.
+func (g *subscriptionGate) admit(ctx context.Context, auth Authorizer, req SubscribeRequest) (Decision, func(), bool) {
+	if auth == nil {
+		auth = AllowAll
+	}
+
+	dec := auth.AuthorizeSubscribe(ctx, req)
+	if !dec.Allow {
+		return dec, nil, false
+	}
+	if !dec.ExpiresAt.IsZero() && !time.Now().Before(dec.ExpiresAt) {
+		dec.Reason = "entitlement expired"
+		return dec, nil, false
+	}
+	if req.Identity == "" {
+		return dec, func() {}, true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if dec.MaxRenditions > 0 && g.active[req.Identity] >= dec.MaxRenditions {
+		dec.Reason = "rendition limit reached"
+		return dec, nil, false
+	}
+	if g.active == nil {
+		g.active = make(map[string]int)
+	}
+	g.active[req.Identity]++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			if g.active[req.Identity]--; g.active[req.Identity] <= 0 {
+				delete(g.active, req.Identity)
+			}
+		})
+	}
+	return dec, release, true
+}
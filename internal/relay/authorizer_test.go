@@ -0,0 +1,109 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionGate_DefaultAllowsAll(t *testing.T) {
+	var g subscriptionGate
+
+	_, release, ok := g.admit(context.Background(), nil, SubscribeRequest{BroadcastPath: "/live/a", TrackName: "video"})
+	require.True(t, ok)
+	release()
+}
+
+func TestSubscriptionGate_Deny(t *testing.T) {
+	var g subscriptionGate
+	auth := AuthorizerFunc(func(_ context.Context, req SubscribeRequest) Decision {
+		return Decision{Allow: req.Identity == "alice", Reason: "not entitled"}
+	})
+
+	ctx := WithIdentity(context.Background(), "bob")
+	dec, _, ok := g.admit(ctx, auth, SubscribeRequest{Identity: IdentityFromContext(ctx)})
+	assert.False(t, ok)
+	assert.Equal(t, "not entitled", dec.Reason)
+
+	_, release, ok := g.admit(ctx, auth, SubscribeRequest{Identity: "alice"})
+	assert.True(t, ok)
+	release()
+}
+
+func TestSubscriptionGate_MaxRenditions(t *testing.T) {
+	var g subscriptionGate
+	auth := AuthorizerFunc(func(context.Context, SubscribeRequest) Decision {
+		return Decision{Allow: true, MaxRenditions: 1}
+	})
+	ctx := context.Background()
+
+	_, release, ok := g.admit(ctx, auth, SubscribeRequest{Identity: "alice", TrackName: "video-1080p"})
+	require.True(t, ok)
+
+	dec, _, ok := g.admit(ctx, auth, SubscribeRequest{Identity: "alice", TrackName: "video-720p"})
+	assert.False(t, ok, "second rendition should be rejected")
+	assert.Equal(t, "rendition limit reached", dec.Reason)
+
+	// Other identities and anonymous subscribers are unaffected.
+	_, _, ok = g.admit(ctx, auth, SubscribeRequest{Identity: "bob"})
+	assert.True(t, ok)
+	_, _, ok = g.admit(ctx, auth, SubscribeRequest{})
+	assert.True(t, ok)
+
+	release()
+	release() // idempotent
+	_, _, ok = g.admit(ctx, auth, SubscribeRequest{Identity: "alice", TrackName: "video-720p"})
+	assert.True(t, ok, "slot should be freed after release")
+}
+
+func TestSubscriptionGate_Expired(t *testing.T) {
+	var g subscriptionGate
+	auth := AuthorizerFunc(func(context.Context, SubscribeRequest) Decision {
+		return Decision{Allow: true, ExpiresAt: time.Now().Add(-time.Second)}
+	})
+
+	dec, _, ok := g.admit(context.Background(), auth, SubscribeRequest{Identity: "alice"})
+	assert.False(t, ok)
+	assert.Equal(t, "entitlement expired", dec.Reason)
+}
+
+func TestIdentityFromContext_Missing(t *testing.T) {
+	assert.Equal(t, "", IdentityFromContext(context.Background()))
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	verified := func(cert *x509.Certificate) tls.ConnectionState {
+		return tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	assert.Equal(t, "relay-osaka-1", CertificateIdentity(verified(&x509.Certificate{Subject: pkix.Name{CommonName: "relay-osaka-1"}, DNSNames: []string{"osaka.example.net"}})))
+	assert.Equal(t, "osaka.example.net", CertificateIdentity(verified(&x509.Certificate{DNSNames: []string{"osaka.example.net"}})))
+
+	// Unverified certificates authenticate nobody
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "relay-osaka-1"}}
+	assert.Empty(t, CertificateIdentity(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}))
+	assert.Empty(t, CertificateIdentity(tls.ConnectionState{}))
+}
+
+func TestIdentityFromContext(t *testing.T) {
+	assert.Empty(t, IdentityFromContext(context.Background()))
+	assert.Equal(t, "alice", IdentityFromContext(WithIdentity(context.Background(), "alice")))
+}
+
+func TestRelayHandler_AllowsSubscriber(t *testing.T) {
+	h := &RelayHandler{Visibility: &sdn.Visibility{Tenant: "brand-a"}, Peers: []string{"relay-osaka-1"}}
+
+	assert.True(t, h.allowsSubscriber("brand-a/viewer"))
+	assert.True(t, h.allowsSubscriber("relay-osaka-1"), "peer relays relay it on")
+	assert.False(t, h.allowsSubscriber("brand-b/viewer"))
+	assert.False(t, h.allowsSubscriber(""))
+
+	assert.True(t, (&RelayHandler{Peers: []string{"relay-osaka-1"}}).allowsSubscriber(""), "public broadcast")
+}
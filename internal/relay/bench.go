@@ -0,0 +1,283 @@
+package relay
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// BenchConfig describes what `qumo bench-internal` measures: the relay's
+// tuning values and the traffic they should suit.
+type BenchConfig struct {
+	GroupCacheSize int
+	FrameCapacity  int
+	NotifyTimeout  time.Duration
+
+	FrameSize      int   // typical frame payload in bytes
+	FramesPerGroup int   // frames per group, e.g. one GOP
+	Subscribers    int   // subscribers per track
+	CacheMemory    int64 // group cache budget per track in bytes; 0 is unlimited
+}
+
+// BenchResult is one micro-benchmark's outcome.
+type BenchResult struct {
+	Name        string `json:"name"`
+	NsPerOp     int64  `json:"ns_per_op"`
+	BytesPerOp  int64  `json:"bytes_per_op"`
+	AllocsPerOp int64  `json:"allocs_per_op"`
+}
+
+// BenchRecommendation suggests a value for a tuning setting.
+type BenchRecommendation struct {
+	Setting     string `json:"setting"`
+	Current     string `json:"current"`
+	Recommended string `json:"recommended"`
+	Reason      string `json:"reason"`
+}
+
+// BenchReport is the outcome of RunBenchmarks.
+type BenchReport struct {
+	Results         []BenchResult         `json:"results"`
+	Recommendations []BenchRecommendation `json:"recommendations"`
+}
+
+// notifyCPUBudget is the share of one core that idle subscribers may spend
+// waking up on NotifyTimeout.
+const notifyCPUBudget = 0.01
+
+// notifyTimeoutSteps are the NotifyTimeout values RunBenchmarks picks from.
+var notifyTimeoutSteps = []time.Duration{
+	1 * time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// RunBenchmarks runs the frame pool, group ring and distributor hot paths
+// with cfg's values on this machine and recommends GroupCacheSize,
+// FrameCapacity and NotifyTimeout. It takes a few seconds.
+func RunBenchmarks(cfg BenchConfig) BenchReport {
+	payload := make([]byte, cfg.FrameSize)
+	fit := frameCapacityFor(cfg.FrameSize)
+
+	pool := NewFramePool(cfg.FrameCapacity)
+	poolGetPut := bench("framepool/get-put", func(n int) {
+		for range n {
+			f := pool.Get()
+			f.Write(payload)
+			pool.Put(f)
+		}
+	})
+	newConfigured := bench(fmt.Sprintf("frame/new cap=%d", cfg.FrameCapacity), func(n int) {
+		for range n {
+			moqt.NewFrame(cfg.FrameCapacity).Write(payload)
+		}
+	})
+	newFit := bench(fmt.Sprintf("frame/new cap=%d", fit), func(n int) {
+		for range n {
+			moqt.NewFrame(fit).Write(payload)
+		}
+	})
+
+	ring := newGroupRing(cfg.GroupCacheSize, pool)
+	ringAdd := bench(fmt.Sprintf("groupring/add frames=%d", cfg.FramesPerGroup), func(n int) {
+		src := &benchGroup{payload: payload}
+		for range n {
+			src.seq++
+			src.left = cfg.FramesPerGroup
+			ring.add(src, nil)
+		}
+	})
+
+	d := &trackDistributor{subscribers: make(map[chan struct{}]struct{})}
+	subs := make([]chan struct{}, cfg.Subscribers)
+	for i := range subs {
+		subs[i] = d.subscribe()
+	}
+	fanout := bench(fmt.Sprintf("distributor/notify subscribers=%d", cfg.Subscribers), func(n int) {
+		for range n {
+			d.notify()
+			for _, ch := range subs {
+				<-ch
+			}
+		}
+	})
+
+	idle := make(chan struct{})
+	wake := bench("notify/timeout-wake", func(n int) {
+		for range n {
+			select {
+			case <-idle:
+			case <-time.After(time.Nanosecond):
+			}
+		}
+	})
+
+	return BenchReport{
+		Results: []BenchResult{poolGetPut, newConfigured, newFit, ringAdd, fanout, wake},
+		Recommendations: []BenchRecommendation{
+			recommendGroupCacheSize(cfg, ringAdd),
+			recommendFrameCapacity(cfg, fit, newConfigured, newFit),
+			recommendNotifyTimeout(cfg, wake),
+		},
+	}
+}
+
+// benchTime is how long bench runs a hot path for.
+const benchTime = time.Second
+
+// bench measures f, which runs a hot path n times, like testing.Benchmark
+// but without linking the testing package into the binary.
+func bench(name string, f func(n int)) BenchResult {
+	return benchFor(name, benchTime, f)
+}
+
+// benchFor is bench running f for d.
+func benchFor(name string, d time.Duration, f func(n int)) BenchResult {
+	f(1) // warm up
+	for n := 1; ; {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		f(n)
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		if elapsed >= d || n >= 1e9 {
+			return BenchResult{
+				Name:        name,
+				NsPerOp:     elapsed.Nanoseconds() / int64(n),
+				BytesPerOp:  int64(after.TotalAlloc-before.TotalAlloc) / int64(n),
+				AllocsPerOp: int64(after.Mallocs-before.Mallocs) / int64(n),
+			}
+		}
+		// Aim 20% past d, growing at most 100-fold per run
+		next := int64(n) * 100
+		if elapsed > 0 {
+			next = min(next, int64(d)*6/5*int64(n)/int64(elapsed))
+		}
+		n = int(max(next, int64(n)+1))
+	}
+}
+
+// benchGroup is a groupSource producing left frames of payload.
+type benchGroup struct {
+	seq     moqt.GroupSequence
+	left    int
+	payload []byte
+}
+
+func (g *benchGroup) GroupSequence() moqt.GroupSequence { return g.seq }
+
+func (g *benchGroup) ReadFrame(frame *moqt.Frame) error {
+	if g.left == 0 {
+		return io.EOF
+	}
+	g.left--
+	frame.Reset()
+	frame.Write(g.payload)
+	return nil
+}
+
+func (g *benchGroup) SetReadDeadline(time.Time) error { return nil }
+
+func (g *benchGroup) CancelRead(moqt.GroupErrorCode) {}
+
+// frameCapacityFor rounds size up to a multiple of 256 bytes.
+func frameCapacityFor(size int) int {
+	return max(256, (size+255)/256*256)
+}
+
+func recommendGroupCacheSize(cfg BenchConfig, add BenchResult) BenchRecommendation {
+	groupBytes := int64(cfg.FramesPerGroup) * int64(max(cfg.FrameCapacity, cfg.FrameSize))
+	rec := BenchRecommendation{
+		Setting:     "group_cache_size",
+		Current:     fmt.Sprint(cfg.GroupCacheSize),
+		Recommended: fmt.Sprint(cfg.GroupCacheSize),
+	}
+
+	perSec := "n/a"
+	if add.NsPerOp > 0 {
+		perSec = fmt.Sprint(int64(time.Second) / add.NsPerOp)
+	}
+	trackBytes := int64(cfg.GroupCacheSize) * groupBytes
+	if cfg.CacheMemory > 0 && trackBytes > cfg.CacheMemory {
+		size := max(1, cfg.CacheMemory/max(1, groupBytes))
+		rec.Recommended = fmt.Sprint(size)
+		rec.Reason = fmt.Sprintf("%d groups use %s per track, over the %s budget; caching one takes %s (%s groups/s)",
+			cfg.GroupCacheSize, formatBytes(trackBytes), formatBytes(cfg.CacheMemory), time.Duration(add.NsPerOp), perSec)
+		return rec
+	}
+	rec.Reason = fmt.Sprintf("%s per track; caching a group takes %s (%s groups/s)",
+		formatBytes(trackBytes), time.Duration(add.NsPerOp), perSec)
+	return rec
+}
+
+func recommendFrameCapacity(cfg BenchConfig, fit int, configured, fitted BenchResult) BenchRecommendation {
+	rec := BenchRecommendation{
+		Setting:     "frame_capacity",
+		Current:     fmt.Sprint(cfg.FrameCapacity),
+		Recommended: fmt.Sprint(cfg.FrameCapacity),
+	}
+	switch {
+	case cfg.FrameCapacity < cfg.FrameSize:
+		rec.Recommended = fmt.Sprint(fit)
+		rec.Reason = fmt.Sprintf("%d-byte frames outgrow %d-byte buffers: a fresh frame costs %s and %d allocs, vs %s and %d allocs at %d",
+			cfg.FrameSize, cfg.FrameCapacity, time.Duration(configured.NsPerOp), configured.AllocsPerOp,
+			time.Duration(fitted.NsPerOp), fitted.AllocsPerOp, fit)
+	case cfg.FrameCapacity > 4*fit:
+		rec.Recommended = fmt.Sprint(fit)
+		rec.Reason = fmt.Sprintf("%d-byte frames leave %d bytes of every buffer unused",
+			cfg.FrameSize, cfg.FrameCapacity-cfg.FrameSize)
+	default:
+		rec.Reason = fmt.Sprintf("fits %d-byte frames; a fresh frame costs %s", cfg.FrameSize, time.Duration(configured.NsPerOp))
+	}
+	return rec
+}
+
+func recommendNotifyTimeout(cfg BenchConfig, wake BenchResult) BenchRecommendation {
+	rec := BenchRecommendation{
+		Setting:     "notify_timeout_ms",
+		Current:     fmt.Sprint(cfg.NotifyTimeout.Milliseconds()),
+		Recommended: fmt.Sprint(cfg.NotifyTimeout.Milliseconds()),
+	}
+
+	// Idle subscribers wake every NotifyTimeout; find the shortest step
+	// that keeps them within the CPU budget.
+	need := time.Duration(float64(cfg.Subscribers) * float64(wake.NsPerOp) / notifyCPUBudget)
+	load := func(d time.Duration) float64 {
+		return 100 * float64(cfg.Subscribers) * float64(wake.NsPerOp) / float64(max(d, 1))
+	}
+	if cfg.NotifyTimeout >= need {
+		rec.Reason = fmt.Sprintf("%d idle subscribers waking every %s use ~%.2f%% of a core",
+			cfg.Subscribers, cfg.NotifyTimeout, load(cfg.NotifyTimeout))
+		return rec
+	}
+
+	next := notifyTimeoutSteps[len(notifyTimeoutSteps)-1]
+	for _, step := range notifyTimeoutSteps {
+		if step >= need {
+			next = step
+			break
+		}
+	}
+	rec.Recommended = fmt.Sprint(next.Milliseconds())
+	rec.Reason = fmt.Sprintf("%d idle subscribers waking every %s use ~%.2f%% of a core; %s brings that to ~%.2f%%",
+		cfg.Subscribers, cfg.NotifyTimeout, load(cfg.NotifyTimeout), next, load(next))
+	return rec
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,59 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecommendGroupCacheSize(t *testing.T) {
+	cfg := BenchConfig{GroupCacheSize: 100, FrameCapacity: 1500, FrameSize: 1000, FramesPerGroup: 10, CacheMemory: 1 << 20}
+	add := BenchResult{NsPerOp: 1000}
+
+	rec := recommendGroupCacheSize(cfg, add)
+	assert.Equal(t, "100", rec.Current)
+	assert.Equal(t, "69", rec.Recommended, "1 MiB / (10 × 1500 B)")
+
+	cfg.CacheMemory = 0
+	assert.Equal(t, "100", recommendGroupCacheSize(cfg, add).Recommended, "no budget")
+}
+
+func TestRecommendFrameCapacity(t *testing.T) {
+	cfg := BenchConfig{FrameCapacity: 1500, FrameSize: 3000}
+	assert.Equal(t, "3072", recommendFrameCapacity(cfg, frameCapacityFor(3000), BenchResult{}, BenchResult{}).Recommended)
+
+	cfg = BenchConfig{FrameCapacity: 65536, FrameSize: 200}
+	assert.Equal(t, "256", recommendFrameCapacity(cfg, frameCapacityFor(200), BenchResult{}, BenchResult{}).Recommended)
+
+	cfg = BenchConfig{FrameCapacity: 1500, FrameSize: 1200}
+	assert.Equal(t, "1500", recommendFrameCapacity(cfg, frameCapacityFor(1200), BenchResult{}, BenchResult{}).Recommended)
+}
+
+func TestRecommendNotifyTimeout(t *testing.T) {
+	wake := BenchResult{NsPerOp: 1000}
+
+	// 100 subscribers × 1µs per wake within 1% of a core: every 10ms.
+	cfg := BenchConfig{NotifyTimeout: time.Millisecond, Subscribers: 100}
+	assert.Equal(t, "10", recommendNotifyTimeout(cfg, wake).Recommended)
+
+	cfg.NotifyTimeout = 20 * time.Millisecond
+	assert.Equal(t, "20", recommendNotifyTimeout(cfg, wake).Recommended, "already within budget")
+
+	cfg.Subscribers = 1000000
+	assert.Equal(t, "100", recommendNotifyTimeout(cfg, wake).Recommended, "capped at the largest step")
+}
+
+var benchSink []byte
+
+func TestBenchFor(t *testing.T) {
+	r := benchFor("alloc", 20*time.Millisecond, func(n int) {
+		for range n {
+			benchSink = make([]byte, 64)
+		}
+	})
+	assert.Equal(t, "alloc", r.Name)
+	assert.Positive(t, r.NsPerOp)
+	assert.EqualValues(t, 1, r.AllocsPerOp)
+	assert.GreaterOrEqual(t, r.BytesPerOp, int64(64))
+}
@@ -0,0 +1,210 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// PeerFetchPath is where a relay accepts chained fetch requests from the
+// relays downstream of it, with PeerFetchHandlerFunc.
+const PeerFetchPath = "/peer/fetch"
+
+// ChainedFetch makes a RemoteFetcher build the distribution tree along the
+// full path the SDN computed instead of relying on the next hop to already
+// relay the broadcast. Before subscribing through a next hop that is not
+// the source relay, the fetcher POSTs a PeerFetchRequest to the next hop's
+// PeerFetchPath endpoint, on the host and port of its MoQT address. A relay
+// that does not relay the broadcast yet looks it up in its own SDN
+// announcements and route, starts fetching it from its own next hop and
+// forwards the request, and so on up to the source relay. Relays that
+// already relay the broadcast keep their upstream. A failed request is
+// logged and the fetch goes ahead, as without ChainedFetch.
+type ChainedFetch struct {
+	// Token is the bearer token for the peers' PeerFetchPath endpoint.
+	// It is required, and only sent over HTTPS.
+	Token string
+
+	// HTTPS sends the requests over HTTPS, to peers whose HTTP listener
+	// is behind a TLS-terminating proxy. It is required: requests are
+	// refused with errPlaintextToken otherwise.
+	HTTPS bool
+
+	// Client sends the requests; nil uses a client with a 5s timeout.
+	Client *http.Client
+}
+
+// PeerFetchRequest asks a relay to fetch a broadcast. The relay resolves
+// the source's announcement and its next hop itself, so a request can
+// neither reach relays its SDN does not route to nor change the
+// broadcast's visibility.
+type PeerFetchRequest struct {
+	BroadcastPath string `json:"broadcast_path"`
+
+	// SourceRelay is the relay the downstream relay fetches from. It is
+	// preferred among the relays announcing the broadcast.
+	SourceRelay string `json:"source_relay"`
+}
+
+var (
+	errPlaintextToken = errors.New("refusing to send the peer token over plain HTTP")
+	errNoPeerToken    = errors.New("chained fetch requires a peer token")
+	errNotAnnounced   = errors.New("broadcast not announced to this relay")
+)
+
+// validate checks that req names a broadcast and its source.
+func (req PeerFetchRequest) validate() error {
+	if req.BroadcastPath == "" || req.SourceRelay == "" {
+		return errors.New("broadcast_path and source_relay are required")
+	}
+	return nil
+}
+
+// request asks the relay at address to fetch a broadcast along req.Path.
+func (c *ChainedFetch) request(ctx context.Context, address string, req PeerFetchRequest) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return errors.New("next hop address has no host")
+	}
+	switch {
+	case c.Token == "":
+		return errNoPeerToken
+	case !c.HTTPS:
+		return errPlaintextToken
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+u.Host+PeerFetchPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.Token)
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("next hop returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// PeerFetchHandlerFunc returns an http.HandlerFunc that makes f fetch the
+// broadcasts downstream relays ask for. It answers 200 if f already relays
+// the broadcast, 404 if f's SDN does not announce it to f, and otherwise
+// 202 and starts fetching it in the background along f's own route: the
+// request may come from a relay that f is itself asking for a broadcast.
+// Callers must authenticate the requests.
+//
+//	POST /peer/fetch
+func PeerFetchHandlerFunc(f *RemoteFetcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req PeerFetchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if err := req.validate(); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		status, code := "relaying", http.StatusOK
+		if ann, _ := f.TrackMux.TrackHandler(moqt.BroadcastPath(req.BroadcastPath)); ann == nil {
+			source, hop, err := f.resolve(r.Context(), req)
+			switch {
+			case errors.Is(err, errNotAnnounced):
+				jsonError(w, http.StatusNotFound, err.Error())
+				return
+			case err != nil:
+				jsonError(w, http.StatusBadGateway, err.Error())
+				return
+			}
+			status, code = "fetching", http.StatusAccepted
+			go f.fetchVia(req.BroadcastPath, source, hop)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"status": status})
+	}
+}
+
+// resolve finds the announcement of req's broadcast that f may relay,
+// preferring req.SourceRelay's, and f's next hop to its source.
+func (f *RemoteFetcher) resolve(ctx context.Context, req PeerFetchRequest) (SourceCandidate, hopRoute, error) {
+	candidates, _, err := f.candidates(ctx)
+	if err != nil {
+		return SourceCandidate{}, hopRoute{}, err
+	}
+	cands := candidates[req.BroadcastPath]
+	if len(cands) == 0 {
+		return SourceCandidate{}, hopRoute{}, errNotAnnounced
+	}
+	source := f.selectSource(req.BroadcastPath, cands)
+	for _, c := range cands {
+		if c.Relay == req.SourceRelay {
+			source = c
+			break
+		}
+	}
+	hop, err := f.nextHop(ctx, source.Relay)
+	if err != nil {
+		return SourceCandidate{}, hopRoute{}, err
+	}
+	return source, hop, nil
+}
+
+// fetchVia starts relaying broadcastPath from source through hop, unless
+// it is already relayed, and keeps it in the poll loop's remote set.
+func (f *RemoteFetcher) fetchVia(broadcastPath string, source SourceCandidate, hop hopRoute) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.runCtx == nil {
+		slog.Warn("remote fetcher: chained fetch requested before start", "broadcast_path", broadcastPath)
+		return
+	}
+	f.chained[broadcastPath] = source
+	if _, ok := f.tracked[broadcastPath]; ok {
+		return
+	}
+	if ann, _ := f.TrackMux.TrackHandler(moqt.BroadcastPath(broadcastPath)); ann != nil {
+		return
+	}
+
+	if err := f.startVia(f.runCtx, broadcastPath, source, hop, f.gcSize, f.pool); err != nil {
+		slog.Warn("remote fetcher: failed to dial next hop",
+			"address", hop.address,
+			"error", err)
+		return
+	}
+	slog.Info("remote fetcher: fetching on request of a downstream relay",
+		"broadcast_path", broadcastPath,
+		"next_hop", hop.name)
+}
@@ -0,0 +1,163 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/okdaichi/qumo/internal/topology"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerFetchRequest_Validate(t *testing.T) {
+	assert.NoError(t, PeerFetchRequest{BroadcastPath: "/live/a", SourceRelay: "c"}.validate())
+	assert.Error(t, PeerFetchRequest{SourceRelay: "c"}.validate())
+	assert.Error(t, PeerFetchRequest{BroadcastPath: "/live/a"}.validate())
+}
+
+func TestChainedFetch_Request(t *testing.T) {
+	var got PeerFetchRequest
+	var auth string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, PeerFetchPath, r.URL.Path)
+		auth = r.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	address := srv.URL
+
+	req := PeerFetchRequest{BroadcastPath: "/live/a", SourceRelay: "c"}
+	c := &ChainedFetch{Token: "secret", HTTPS: true, Client: srv.Client()}
+	require.NoError(t, c.request(context.Background(), address, req))
+	assert.Equal(t, req, got)
+	assert.Equal(t, "Bearer secret", auth)
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	assert.Error(t, c.request(context.Background(), address, req))
+}
+
+func TestChainedFetch_RequestRefused(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	address := "https://" + strings.TrimPrefix(srv.URL, "http://")
+	req := PeerFetchRequest{BroadcastPath: "/live/a", SourceRelay: "c"}
+
+	// The token never goes out in clear, and is always sent
+	c := &ChainedFetch{Token: "secret"}
+	assert.ErrorIs(t, c.request(context.Background(), address, req), errPlaintextToken)
+	c = &ChainedFetch{HTTPS: true}
+	assert.ErrorIs(t, c.request(context.Background(), address, req), errNoPeerToken)
+	assert.Zero(t, requests)
+}
+
+func TestPeerFetchHandlerFunc(t *testing.T) {
+	sdnSrv := mockSDN(t, []testAnnounceEntry{
+		{Relay: "relay-c", BroadcastPath: "/remote/stream"},
+	}, map[string]topology.RouteResult{
+		"relay-c": {From: "relay-b", To: "relay-c", NextHop: "relay-c", NextHopAddress: "https://c:4433"},
+	})
+	defer sdnSrv.Close()
+	sdnClient, err := sdn.NewClient(sdn.ClientConfig{URL: sdnSrv.URL, RelayName: "relay-b", HeartbeatInterval: time.Hour})
+	require.NoError(t, err)
+
+	mux := moqt.NewTrackMux()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mux.Publish(ctx, "/local/stream", moqt.TrackHandlerFunc(func(tw *moqt.TrackWriter) {}))
+	f := &RemoteFetcher{SDNClient: sdnClient, TrackMux: mux}
+	handler := PeerFetchHandlerFunc(f)
+
+	post := func(body string) (int, string) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, PeerFetchPath, strings.NewReader(body)))
+		var resp map[string]string
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec.Code, resp["status"]
+	}
+
+	code, status := post(`{"broadcast_path":"/local/stream","source_relay":"relay-c"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "relaying", status)
+
+	code, status = post(`{"broadcast_path":"/remote/stream","source_relay":"relay-c"}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, "fetching", status)
+
+	// Only broadcasts the relay's own SDN announces to it are fetched
+	code, _ = post(`{"broadcast_path":"/hidden/stream","source_relay":"relay-c"}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = post(`{"broadcast_path":"/remote/stream"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, PeerFetchPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestRemoteFetcher_ResolveChained(t *testing.T) {
+	f := &RemoteFetcher{Peers: NewPeerAnnounceTable(time.Minute)}
+	f.Peers.update("relay-c", PeerAnnouncement{Address: "https://c:4433", Paths: []string{"/live/a"}})
+	f.Peers.update("relay-d", PeerAnnouncement{Address: "https://d:4433", Paths: []string{"/live/a"}})
+
+	source, hop, err := f.resolve(context.Background(), PeerFetchRequest{BroadcastPath: "/live/a", SourceRelay: "relay-d"})
+	require.NoError(t, err)
+	assert.Equal(t, "relay-d", source.Relay)
+	assert.Equal(t, "https://d:4433", hop.address)
+
+	_, _, err = f.resolve(context.Background(), PeerFetchRequest{BroadcastPath: "/live/b", SourceRelay: "relay-c"})
+	assert.ErrorIs(t, err, errNotAnnounced)
+}
+
+func TestRemoteFetcher_KeepChained(t *testing.T) {
+	source := SourceCandidate{Relay: "relay-c"}
+	f := &RemoteFetcher{chained: map[string]SourceCandidate{"/live/a": source}}
+
+	// Kept while the peer announcements stand in for the SDN
+	remoteSet := map[string]SourceCandidate{}
+	f.keepChained(remoteSet, false)
+	assert.Equal(t, source, remoteSet["/live/a"])
+
+	remoteSet = map[string]SourceCandidate{"/live/a": {Relay: "relay-d"}}
+	f.keepChained(remoteSet, true)
+	assert.Equal(t, "relay-d", remoteSet["/live/a"].Relay)
+	assert.Contains(t, f.chained, "/live/a")
+
+	// Forgotten once the SDN stops listing it
+	remoteSet = map[string]SourceCandidate{}
+	f.keepChained(remoteSet, true)
+	assert.Empty(t, remoteSet)
+	assert.Empty(t, f.chained)
+}
+
+func TestRemoteFetcher_NextHopFullPath(t *testing.T) {
+	srv := mockSDN(t, nil, map[string]topology.RouteResult{
+		"relay-c": {
+			From: "relay-a", To: "relay-c", NextHop: "relay-b", NextHopAddress: "https://b:4433",
+			FullPath:          []string{"relay-a", "relay-b", "relay-c"},
+			FullPathAddresses: []string{"https://a:4433", "https://b:4433", "https://c:4433"},
+		},
+	})
+	defer srv.Close()
+	sdnClient, err := sdn.NewClient(sdn.ClientConfig{URL: srv.URL, RelayName: "relay-a", HeartbeatInterval: time.Hour})
+	require.NoError(t, err)
+
+	hop, err := (&RemoteFetcher{SDNClient: sdnClient}).nextHop(context.Background(), "relay-c")
+	require.NoError(t, err)
+	assert.Equal(t, "relay-b", hop.name)
+	assert.Equal(t, []string{"relay-b", "relay-c"}, hop.path)
+}
@@ -0,0 +1,183 @@
+package relay
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// otherClients is the label value that aggregates identities outside the
+// top K.
+const otherClients = "other"
+
+// ClientMetrics configures per-identity subscription metrics.
+type ClientMetrics struct {
+	// TopK is the number of identities exported with their own label; the
+	// rest are aggregated under client="other". Zero disables the metrics.
+	TopK int
+
+	// Salt is mixed into identity hashes so labels cannot be reversed by
+	// hashing known identities.
+	Salt string
+}
+
+// clientStats tracks concurrent streams and egress per hashed identity.
+type clientStats struct {
+	mu      sync.Mutex
+	config  ClientMetrics
+	clients map[string]*clientCounters // hashed identity → counters
+
+	// foldedBytes is egress of idle identities dropped from the map,
+	// kept so the "other" total never decreases.
+	foldedBytes uint64
+}
+
+type clientCounters struct {
+	streams     atomic.Int64
+	egressBytes atomic.Uint64
+}
+
+// globalClientStats is shared by all relay handlers.
+var globalClientStats = &clientStats{}
+
+// SetClientMetrics configures per-identity subscription metrics.
+func SetClientMetrics(cfg ClientMetrics) {
+	globalClientStats.mu.Lock()
+	defer globalClientStats.mu.Unlock()
+	globalClientStats.config = cfg
+	globalClientStats.clients = nil
+	globalClientStats.foldedBytes = 0
+}
+
+// hash returns the label for identity: a truncated salted SHA-256.
+func (s *clientStats) hash(identity string) string {
+	s.mu.Lock()
+	salt := s.config.Salt
+	s.mu.Unlock()
+	return clientHash(salt, identity)
+}
+
+func clientHash(salt, identity string) string {
+	sum := sha256.Sum256([]byte(salt + identity))
+	return hex.EncodeToString(sum[:6])
+}
+
+// acquire counts a new stream for identity and returns its counters, or nil
+// when the metrics are disabled or the subscriber is anonymous. The caller
+// must call release when the stream ends.
+func (s *clientStats) acquire(identity string) *clientCounters {
+	if identity == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.TopK <= 0 {
+		return nil
+	}
+	if s.clients == nil {
+		s.clients = make(map[string]*clientCounters)
+	}
+	key := clientHash(s.config.Salt, identity)
+	c, ok := s.clients[key]
+	if !ok {
+		c = &clientCounters{}
+		s.clients[key] = c
+	}
+	c.streams.Add(1)
+	return c
+}
+
+// release ends a stream acquired with acquire. A nil c is a no-op.
+func (c *clientCounters) release() {
+	if c != nil {
+		c.streams.Add(-1)
+	}
+}
+
+// addEgressBytes records n bytes written to the client. A nil c is a no-op.
+func (c *clientCounters) addEgressBytes(n int) {
+	if c != nil && n > 0 {
+		c.egressBytes.Add(uint64(n))
+	}
+}
+
+// clientSample is one exported label set.
+type clientSample struct {
+	client      string
+	streams     int64
+	egressBytes uint64
+}
+
+// top returns the K identities with the most egress plus an "other"
+// aggregate, and folds idle identities outside the top K into "other".
+func (s *clientStats) top() []clientSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.TopK <= 0 {
+		return nil
+	}
+
+	samples := make([]clientSample, 0, len(s.clients))
+	for key, c := range s.clients {
+		samples = append(samples, clientSample{
+			client:      key,
+			streams:     c.streams.Load(),
+			egressBytes: c.egressBytes.Load(),
+		})
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].egressBytes != samples[j].egressBytes {
+			return samples[i].egressBytes > samples[j].egressBytes
+		}
+		return samples[i].client < samples[j].client
+	})
+
+	other := clientSample{client: otherClients, egressBytes: s.foldedBytes}
+	k := min(s.config.TopK, len(samples))
+	for _, smp := range samples[k:] {
+		other.streams += smp.streams
+		other.egressBytes += smp.egressBytes
+		if smp.streams == 0 {
+			s.foldedBytes += smp.egressBytes
+			delete(s.clients, smp.client)
+		}
+	}
+
+	return append(samples[:k], other)
+}
+
+var (
+	clientStreamsDesc = prometheus.NewDesc(
+		"qumo_relay_client_streams",
+		"Concurrent subscriptions per hashed client identity (top K, rest as \"other\").",
+		[]string{"client"}, nil,
+	)
+
+	clientEgressDesc = prometheus.NewDesc(
+		"qumo_relay_client_egress_bytes_total",
+		"Egress payload bytes per hashed client identity (top K, rest as \"other\").",
+		[]string{"client"}, nil,
+	)
+)
+
+// clientCollector exports globalClientStats.
+type clientCollector struct{}
+
+func (clientCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clientStreamsDesc
+	ch <- clientEgressDesc
+}
+
+func (clientCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, smp := range globalClientStats.top() {
+		ch <- prometheus.MustNewConstMetric(clientStreamsDesc, prometheus.GaugeValue, float64(smp.streams), smp.client)
+		ch <- prometheus.MustNewConstMetric(clientEgressDesc, prometheus.CounterValue, float64(smp.egressBytes), smp.client)
+	}
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientStats_Disabled(t *testing.T) {
+	s := &clientStats{}
+	assert.Nil(t, s.acquire("alice"))
+	assert.Nil(t, s.top())
+
+	// Nil counters are safe to use.
+	var c *clientCounters
+	c.addEgressBytes(10)
+	c.release()
+}
+
+func TestClientStats_Anonymous(t *testing.T) {
+	s := &clientStats{config: ClientMetrics{TopK: 1}}
+	assert.Nil(t, s.acquire(""))
+}
+
+func TestClientStats_TopK(t *testing.T) {
+	s := &clientStats{config: ClientMetrics{TopK: 1, Salt: "pepper"}}
+
+	alice := s.acquire("alice")
+	bob := s.acquire("bob")
+	carol := s.acquire("carol")
+	alice.addEgressBytes(300)
+	bob.addEgressBytes(200)
+	carol.addEgressBytes(100)
+	carol.release()
+
+	samples := s.top()
+	require.Len(t, samples, 2)
+	assert.Equal(t, clientHash("pepper", "alice"), samples[0].client)
+	assert.Equal(t, int64(1), samples[0].streams)
+	assert.Equal(t, uint64(300), samples[0].egressBytes)
+	assert.Equal(t, clientSample{client: otherClients, streams: 1, egressBytes: 300}, samples[1])
+
+	// The idle identity was folded into "other"; its bytes stay counted.
+	assert.Len(t, s.clients, 2)
+	samples = s.top()
+	assert.Equal(t, uint64(300), samples[1].egressBytes)
+}
+
+func TestClientHash(t *testing.T) {
+	h := clientHash("salt", "alice")
+	assert.Len(t, h, 12)
+	assert.Equal(t, h, clientHash("salt", "alice"))
+	assert.NotEqual(t, h, clientHash("other-salt", "alice"))
+	assert.NotContains(t, h, "alice")
+}
+
+func TestClientCollector(t *testing.T) {
+	SetClientMetrics(ClientMetrics{TopK: 5})
+	t.Cleanup(func() { SetClientMetrics(ClientMetrics{}) })
+
+	c := globalClientStats.acquire("alice")
+	c.addEgressBytes(42)
+	defer c.release()
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(clientCollector{}))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	names := map[string]int{}
+	for _, f := range families {
+		names[f.GetName()] = len(f.GetMetric())
+	}
+	assert.Equal(t, 2, names["qumo_relay_client_streams"], "alice + other")
+	assert.Equal(t, 2, names["qumo_relay_client_egress_bytes_total"])
+}
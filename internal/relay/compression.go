@@ -0,0 +1,134 @@
+package relay
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// Compression of tracks on relay-to-relay hops.
+//
+// A relay fetching a broadcast under one of its TrackCompression prefixes
+// subscribes to the compressed variant of each track,
+// CompressedTrackName(track), instead of the track itself. The upstream
+// relay serves it from the same group cache as the plain track, zstd
+// compressing each frame on the way out; the fetching relay decompresses
+// the frames as they arrive, so its cache and its own subscribers only see
+// the original bytes. An upstream relay that does not serve the variant
+// refuses the subscription and the track is fetched plain.
+//
+// Relays serve the variant only under their own TrackCompression prefixes,
+// and only of tracks that exist: any other name ending in the suffix is a
+// track of its own, so publishers are free to use it.
+//
+// It pays off for highly compressible tracks such as captions or telemetry;
+// media is already compressed. Each compressed frame starts with a byte
+// telling how the rest is encoded: frames that zstd does not shrink are
+// sent as they are.
+const compressedTrackSuffix = ".zstd"
+
+// Frame encodings in the first byte of a compressed track's frames.
+const (
+	frameRaw  byte = 0
+	frameZstd byte = 1
+)
+
+// maxDecompressedFrame bounds the size a compressed frame may expand to.
+const maxDecompressedFrame = 64 << 20
+
+var errBadCompressedFrame = errors.New("malformed compressed frame")
+
+// TrackCompression selects the broadcasts whose tracks a relay fetches
+// compressed from other relays.
+type TrackCompression struct {
+	// Prefixes are broadcast path prefixes, e.g. "/captions/". A path
+	// matches a prefix ending in "/" if it starts with it, and any other
+	// prefix if it equals it or continues with "/".
+	Prefixes []string
+}
+
+// Matches reports whether broadcastPath is fetched compressed. A nil
+// TrackCompression matches nothing.
+func (c *TrackCompression) Matches(broadcastPath string) bool {
+	if c == nil {
+		return false
+	}
+	for _, prefix := range c.Prefixes {
+		if strings.HasSuffix(prefix, "/") {
+			if strings.HasPrefix(broadcastPath, prefix) {
+				return true
+			}
+		} else if broadcastPath == prefix || strings.HasPrefix(broadcastPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CompressedTrackName returns the compressed variant of track.
+func CompressedTrackName(track moqt.TrackName) moqt.TrackName {
+	return track + compressedTrackSuffix
+}
+
+// parseCompressedTrackName returns the track whose compressed variant name
+// is.
+func parseCompressedTrackName(name moqt.TrackName) (track moqt.TrackName, ok bool) {
+	base, ok := strings.CutSuffix(string(name), compressedTrackSuffix)
+	return moqt.TrackName(base), ok && base != ""
+}
+
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecompressedFrame))
+		return dec
+	})
+)
+
+// compressFrame writes the compressed encoding of src to dst.
+func compressFrame(dst, src *moqt.Frame) {
+	body := src.Body()
+	encoded := zstdEncoder().EncodeAll(body, []byte{frameZstd})
+
+	dst.Reset()
+	if len(encoded) < 1+len(body) {
+		dst.Write(encoded)
+	} else {
+		dst.Write([]byte{frameRaw})
+		dst.Write(body)
+	}
+	compressionBytes.WithLabelValues("egress", "raw").Add(float64(len(body)))
+	compressionBytes.WithLabelValues("egress", "encoded").Add(float64(dst.Len()))
+}
+
+// decompressFrame writes the original bytes of the compressed frame src to
+// dst.
+func decompressFrame(dst, src *moqt.Frame) error {
+	body := src.Body()
+	if len(body) == 0 {
+		return errBadCompressedFrame
+	}
+
+	dst.Reset()
+	switch body[0] {
+	case frameRaw:
+		dst.Write(body[1:])
+	case frameZstd:
+		decoded, err := zstdDecoder().DecodeAll(body[1:], nil)
+		if err != nil {
+			return errors.Join(errBadCompressedFrame, err)
+		}
+		dst.Write(decoded)
+	default:
+		return errBadCompressedFrame
+	}
+	compressionBytes.WithLabelValues("ingress", "raw").Add(float64(dst.Len()))
+	compressionBytes.WithLabelValues("ingress", "encoded").Add(float64(len(body)))
+	return nil
+}
@@ -0,0 +1,204 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/gomoqt/quic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackCompression_Matches(t *testing.T) {
+	c := &TrackCompression{Prefixes: []string{"/captions/", "/telemetry"}}
+
+	for path, want := range map[string]bool{
+		"/captions/en":       true,
+		"/captions":          false,
+		"/telemetry":         true,
+		"/telemetry/car-1":   true,
+		"/telemetry-archive": false,
+		"/live/video":        false,
+	} {
+		assert.Equal(t, want, c.Matches(path), path)
+	}
+
+	var none *TrackCompression
+	assert.False(t, none.Matches("/captions/en"))
+}
+
+func TestCompressedTrackName(t *testing.T) {
+	name := CompressedTrackName("captions")
+	assert.Equal(t, moqt.TrackName("captions.zstd"), name)
+
+	track, ok := parseCompressedTrackName(name)
+	require.True(t, ok)
+	assert.Equal(t, moqt.TrackName("captions"), track)
+
+	for _, name := range []moqt.TrackName{"captions", ".zstd", "captions.zst"} {
+		_, ok := parseCompressedTrackName(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestRelayHandler_CompressedSource(t *testing.T) {
+	h := &RelayHandler{ServeCompressed: true}
+	track, ok := h.compressedSource("cc.zstd")
+	require.True(t, ok)
+	assert.Equal(t, moqt.TrackName("cc"), track)
+
+	_, ok = h.compressedSource("cc")
+	assert.False(t, ok)
+
+	// Outside the compression prefixes the suffix is part of the name
+	_, ok = (&RelayHandler{}).compressedSource("cc.zstd")
+	assert.False(t, ok)
+}
+
+// compressed returns the compressed encoding of body.
+func compressed(body []byte) []byte {
+	src, dst := moqt.NewFrame(0), moqt.NewFrame(0)
+	src.Write(body)
+	compressFrame(dst, src)
+	return append([]byte(nil), dst.Body()...)
+}
+
+func TestCompressFrame_RoundTrip(t *testing.T) {
+	for name, body := range map[string][]byte{
+		"compressible":   []byte(strings.Repeat(`{"caption":"hello world","lang":"en"}`, 50)),
+		"incompressible": []byte("x7"),
+		"empty":          {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			enc := compressed(body)
+			if name == "compressible" {
+				assert.Less(t, len(enc), len(body)/4)
+				assert.Equal(t, frameZstd, enc[0])
+			} else {
+				assert.Equal(t, append([]byte{frameRaw}, body...), enc, "sent as is")
+			}
+
+			src, dst := moqt.NewFrame(0), moqt.NewFrame(0)
+			src.Write(enc)
+			require.NoError(t, decompressFrame(dst, src))
+			assert.Equal(t, body, append([]byte{}, dst.Body()...))
+		})
+	}
+}
+
+func TestDecompressFrame_Malformed(t *testing.T) {
+	for _, body := range [][]byte{{}, {2, 'a'}, {frameZstd, 'n', 'o', 't'}} {
+		src, dst := moqt.NewFrame(0), moqt.NewFrame(0)
+		src.Write(body)
+		assert.ErrorIs(t, decompressFrame(dst, src), errBadCompressedFrame, body)
+	}
+}
+
+func TestGroupRingAdd_Decompress(t *testing.T) {
+	text := strings.Repeat("telemetry ", 100)
+
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+	ring.decompress = true
+	src := &fakeGroupSource{seq: 1, frames: []string{string(compressed([]byte(text))), string(compressed([]byte("ok")))}, end: io.EOF}
+	cache, reason := ring.add(src, nil)
+	assert.Empty(t, reason)
+	assert.Equal(t, [][]byte{[]byte(text), []byte("ok")}, cache.bodies())
+
+	// A frame that does not decompress truncates the group
+	src = &fakeGroupSource{seq: 2, frames: []string{string(compressed([]byte("ok"))), "\x07junk"}, end: io.EOF}
+	cache, reason = ring.add(src, nil)
+	assert.Equal(t, groupReset, reason)
+	assert.True(t, cache.isTruncated())
+	assert.Len(t, cache.bodies(), 1)
+}
+
+func TestServer_CompressedTrackNames(t *testing.T) {
+	if raceEnabled {
+		t.Skip("gomoqt sessions race on their track readers and writers")
+	}
+	serverTLS, clientTLS := testTLS(t)
+	serverTLS.NextProtos, clientTLS.NextProtos = []string{moqt.NextProtoMOQ}, []string{moqt.NextProtoMOQ}
+
+	addr := freeUDPAddr(t)
+	server := &Server{
+		Addr:       addr,
+		TLSConfig:  serverTLS,
+		QUICConfig: &quic.Config{EnableDatagrams: true},
+		Config:     &Config{Compression: &TrackCompression{Prefixes: []string{"/captions/"}}},
+		TrackMux:   moqt.NewTrackMux(),
+	}
+	go server.ListenAndServe()
+	defer server.Close()
+
+	client := &moqt.Client{TLSConfig: clientTLS, QUICConfig: &quic.Config{EnableDatagrams: true}}
+	defer client.Close()
+
+	// A publisher of tracks named like compressed variants, and of one
+	// track the relay may compress
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	serve := func(tw *moqt.TrackWriter) {
+		if tw.TrackName != "cc" && !strings.HasSuffix(string(tw.TrackName), compressedTrackSuffix) {
+			tw.CloseWithError(moqt.TrackNotFoundErrorCode)
+			return
+		}
+		for {
+			gw, err := tw.OpenGroup()
+			if err != nil {
+				return
+			}
+			frame := moqt.NewFrame(0)
+			frame.Write([]byte(tw.TrackName))
+			gw.WriteFrame(frame)
+			gw.Close()
+			select {
+			case <-tw.Context().Done():
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}
+	mux := moqt.NewTrackMux()
+	mux.PublishFunc(ctx, "/captions/en", serve)
+	mux.PublishFunc(ctx, "/live/video", serve)
+
+	var pub *moqt.Session
+	require.Eventually(t, func() bool {
+		dialCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		var err error
+		pub, err = client.Dial(dialCtx, "moqt://"+addr, mux)
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	defer pub.CloseWithError(moqt.NoError, "done")
+
+	sub, err := client.Dial(ctx, "moqt://"+addr, moqt.NewTrackMux())
+	require.NoError(t, err)
+	defer sub.CloseWithError(moqt.NoError, "done")
+
+	// first returns the body of the first frame of a track
+	first := func(path moqt.BroadcastPath, name moqt.TrackName) []byte {
+		var tr *moqt.TrackReader
+		require.Eventually(t, func() bool {
+			tr, err = sub.Subscribe(path, name, nil)
+			return err == nil
+		}, 5*time.Second, 20*time.Millisecond, "%s %s", path, name)
+		defer tr.Close()
+
+		readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		gr, err := tr.AcceptGroup(readCtx)
+		require.NoError(t, err)
+		frame := moqt.NewFrame(0)
+		require.NoError(t, gr.ReadFrame(frame))
+		return append([]byte(nil), frame.Body()...)
+	}
+
+	assert.Equal(t, compressed([]byte("cc")), first("/captions/en", "cc.zstd"), "the compressed variant")
+	assert.Equal(t, []byte("notes.zstd"), first("/captions/en", "notes.zstd"), "no track to compress")
+	assert.Equal(t, []byte("cc.zstd"), first("/live/video", "cc.zstd"), "not compressed here")
+}
@@ -1,5 +1,13 @@
 package relay
 
+import (
+	"strings"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/qumo/internal/sdn"
+)
+
 type Config struct {
 	// NodeID is the unique identifier for this relay node.
 	NodeID string
@@ -12,15 +20,79 @@ type Config struct {
 
 	// FrameCapacity is the frame buffer size in bytes.
 	FrameCapacity int
+
+	// AnnounceMetadata maps broadcast path prefixes to content metadata
+	// (codecs, bitrate, labels) sent along with SDN announce registrations.
+	// The longest matching prefix wins.
+	AnnounceMetadata map[string]*sdn.AnnounceMetadata
+
+	// EgressLimit caps the total egress bandwidth of the relay in bytes/sec,
+	// shared fairly between tracks. Zero means unlimited. It can be changed
+	// at runtime with Server.SetEgressLimit.
+	EgressLimit int64
+
+	// EgressWorkers, if positive, runs egress in worker-pool mode: this
+	// many workers write the subscribers' frames, serving the tracks in
+	// round-robin weighted by their subscribers. A worker blocked on flow
+	// control is replaced, so stalled subscribers do not hold workers.
+	// Each Server, and so each virtual host, has its own pool; see
+	// EgressPool. Zero keeps a goroutine per subscriber, scheduled by Go
+	// alone.
+	EgressWorkers int
+
+	// MaxSessions caps the number of concurrent MoQ sessions. Further
+	// sessions are refused with OverloadErrorCode, or HTTP 503 on the
+	// WebTransport upgrade. Zero means unlimited.
+	MaxSessions int
+
+	// RetryAfter is the back-off suggested to refused clients, rounded up
+	// to whole seconds. Zero means DefaultRetryAfter.
+	RetryAfter time.Duration
+
+	// Versions are the MoQ versions the relay accepts in session setup, in
+	// its order of preference; see SupportedVersions. Empty accepts all
+	// supported versions.
+	Versions []moqt.Version
+
+	// Compression selects the broadcasts whose tracks are served
+	// compressed to the relays asking for them, as their
+	// RemoteFetcher.Compression does. See CompressedTrackName.
+	Compression *TrackCompression
+
+	// GroupStallTimeout is how long an upstream group may go without a
+	// frame before it is closed as stalled. Zero means
+	// DefaultGroupStallTimeout and a negative value disables the timeout.
+	GroupStallTimeout time.Duration
+
+	// GroupBudgets cap how long the groups of the matching tracks may stay
+	// open; see GroupBudget.
+	GroupBudgets []GroupBudget
+
+	// EgressWriteTimeout bounds how long one frame write to a subscriber
+	// may block. Zero means DefaultEgressWriteTimeout and a negative value
+	// disables the deadline.
+	EgressWriteTimeout time.Duration
+
+	// PeerIdentities are the client certificate identities of the relays
+	// fetching from this one. They are served private broadcasts, which
+	// they only relay on to the subscribers the broadcast allows. See
+	// RelayHandler.Peers.
+	PeerIdentities []string
 }
 
-// AnnounceRegistrar is implemented by sdn.Client and allows the relay
+// AnnounceRegistrar is implemented by sdn.Client and sdn.Group and allows the relay
 // server to push announcement state to the SDN controller.
 type AnnounceRegistrar interface {
 	Register(broadcastPath string)
 	Deregister(broadcastPath string)
 }
 
+// metadataRegistrar is implemented by registrars that can carry announce
+// metadata (sdn.Client and sdn.Group do).
+type metadataRegistrar interface {
+	RegisterWithMetadata(broadcastPath string, md *sdn.AnnounceMetadata)
+}
+
 func (c *Config) groupCacheSize() int {
 	if c != nil && c.GroupCacheSize > 0 {
 		return c.GroupCacheSize
@@ -34,3 +106,63 @@ func (c *Config) frameCapacity() int {
 	}
 	return DefaultNewFrameCapacity
 }
+
+func (c *Config) groupStallTimeout() time.Duration {
+	if c == nil {
+		return DefaultGroupStallTimeout
+	}
+	return groupStallTimeout(c.GroupStallTimeout)
+}
+
+// servesCompressed reports whether the tracks of broadcastPath are served
+// compressed to the relays asking for them.
+func (c *Config) servesCompressed(broadcastPath string) bool {
+	return c != nil && c.Compression.Matches(broadcastPath)
+}
+
+func (c *Config) egressWriteTimeout() time.Duration {
+	if c == nil {
+		return DefaultEgressWriteTimeout
+	}
+	return egressWriteTimeout(c.EgressWriteTimeout)
+}
+
+// groupBudgets returns the group budgets of the relayed tracks.
+func (c *Config) groupBudgets() []GroupBudget {
+	if c == nil {
+		return nil
+	}
+	return c.GroupBudgets
+}
+
+// peerIdentities returns the identities of the peer relays.
+func (c *Config) peerIdentities() []string {
+	if c == nil {
+		return nil
+	}
+	return c.PeerIdentities
+}
+
+// announceVisibility returns the visibility configured for broadcastPath,
+// or nil if it is public.
+func (c *Config) announceVisibility(broadcastPath string) *sdn.Visibility {
+	if md := c.announceMetadata(broadcastPath); md.Private() {
+		return md.Visibility
+	}
+	return nil
+}
+
+// announceMetadata returns the metadata configured for broadcastPath, or nil.
+func (c *Config) announceMetadata(broadcastPath string) *sdn.AnnounceMetadata {
+	if c == nil {
+		return nil
+	}
+	var best *sdn.AnnounceMetadata
+	bestLen := -1
+	for prefix, md := range c.AnnounceMetadata {
+		if strings.HasPrefix(broadcastPath, prefix) && len(prefix) > bestLen {
+			best, bestLen = md, len(prefix)
+		}
+	}
+	return best
+}
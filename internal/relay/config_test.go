@@ -2,6 +2,8 @@ package relay
 
 import (
 	"testing"
+
+	"github.com/okdaichi/qumo/internal/sdn"
 )
 
 // TestConfigDefaults tests default config values
@@ -156,8 +158,8 @@ func TestConfigStructSize(t *testing.T) {
 	cfg := &Config{}
 
 	// This test ensures we're aware if Config grows
-	// Config should have exactly 4 fields as of now
-	expectedFields := 4
+	// Config should have exactly 6 fields as of now
+	expectedFields := 6
 
 	// This is a documentation test - if this fails, update the test
 	// and verify all new fields are tested
@@ -165,6 +167,52 @@ func TestConfigStructSize(t *testing.T) {
 	_ = cfg.Region
 	_ = cfg.GroupCacheSize
 	_ = cfg.FrameCapacity
+	_ = cfg.AnnounceMetadata
+	_ = cfg.EgressLimit
 
 	t.Logf("Config has %d fields - ensure all are tested", expectedFields)
 }
+
+// TestConfigAnnounceMetadata tests longest-prefix metadata lookup
+func TestConfigAnnounceMetadata(t *testing.T) {
+	live := &sdn.AnnounceMetadata{Codecs: []string{"avc1.64001f"}}
+	premium := &sdn.AnnounceMetadata{Labels: []string{"premium"}}
+	cfg := &Config{
+		AnnounceMetadata: map[string]*sdn.AnnounceMetadata{
+			"/live/":         live,
+			"/live/premium/": premium,
+		},
+	}
+
+	if got := cfg.announceMetadata("/live/premium/match"); got != premium {
+		t.Errorf("expected premium metadata, got %+v", got)
+	}
+	if got := cfg.announceMetadata("/live/news"); got != live {
+		t.Errorf("expected live metadata, got %+v", got)
+	}
+	if got := cfg.announceMetadata("/vod/movie"); got != nil {
+		t.Errorf("expected nil metadata, got %+v", got)
+	}
+
+	var nilCfg *Config
+	if nilCfg.announceMetadata("/live/news") != nil {
+		t.Error("nil config should have no metadata")
+	}
+}
+
+func TestConfigAnnounceVisibility(t *testing.T) {
+	private := &sdn.Visibility{Tenant: "brand-a"}
+	cfg := &Config{
+		AnnounceMetadata: map[string]*sdn.AnnounceMetadata{
+			"/live/":         {Labels: []string{"hd"}},
+			"/live/brand-a/": {Visibility: private},
+		},
+	}
+
+	if got := cfg.announceVisibility("/live/brand-a/match"); got != private {
+		t.Errorf("expected private visibility, got %+v", got)
+	}
+	if got := cfg.announceVisibility("/live/news"); got != nil {
+		t.Errorf("expected a public broadcast, got %+v", got)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build qumo_debug
+
+package relay
+
+// DebugBuild reports whether the relay is built with the qumo_debug tag,
+// which compiles in the developer debug mode: TLS key logging and track
+// capture. See DebugCapture.
+const DebugBuild = true
@@ -0,0 +1,225 @@
+package relay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// DefaultMaxCaptureGroups bounds a capture if DebugCapture.MaxGroups is
+// unset.
+const DefaultMaxCaptureGroups = 100
+
+// capturePollInterval is how often a capture checks its track for new
+// groups.
+var capturePollInterval = 10 * time.Millisecond
+
+var errTrackNotRelayed = errors.New("track is not being relayed")
+
+// DebugCapture writes the next groups of a relayed track to disk, for
+// inspecting what a relay received offline. It is part of the developer
+// debug mode, which only qumo_debug builds enable; see DebugBuild.
+//
+// Each capture gets a numbered directory under Dir holding one
+// <sequence>.group file per group: its frames in order, each as a 4-byte
+// big-endian length followed by the payload.
+type DebugCapture struct {
+	Dir string
+
+	// MaxGroups bounds the groups one capture may ask for; 0 means
+	// DefaultMaxCaptureGroups.
+	MaxGroups int
+
+	mu       sync.Mutex
+	captures []*CaptureStatus
+}
+
+// CaptureStatus describes a capture started with DebugCapture.Start.
+type CaptureStatus struct {
+	ID            int       `json:"id"`
+	BroadcastPath string    `json:"broadcast_path"`
+	TrackName     string    `json:"track_name"`
+	Dir           string    `json:"dir"`
+	Groups        int       `json:"groups"`  // requested
+	Written       int       `json:"written"` // so far
+	Done          bool      `json:"done"`
+	Error         string    `json:"error,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+}
+
+// Start captures the next groups groups of track in the broadcast at path,
+// starting with the group being received, and returns the new capture.
+func (c *DebugCapture) Start(path, track string, groups int) (CaptureStatus, error) {
+	maxGroups := c.MaxGroups
+	if maxGroups <= 0 {
+		maxGroups = DefaultMaxCaptureGroups
+	}
+	if groups < 1 || groups > maxGroups {
+		return CaptureStatus{}, fmt.Errorf("groups must be between 1 and %d", maxGroups)
+	}
+
+	h := globalPublications.handler(path)
+	var d *trackDistributor
+	if h != nil {
+		d = h.distributor(moqt.TrackName(track))
+	}
+	if d == nil {
+		return CaptureStatus{}, errTrackNotRelayed
+	}
+
+	c.mu.Lock()
+	st := &CaptureStatus{
+		ID:            len(c.captures) + 1,
+		BroadcastPath: path,
+		TrackName:     track,
+		Groups:        groups,
+		StartedAt:     time.Now(),
+	}
+	st.Dir = filepath.Join(c.Dir, strconv.Itoa(st.ID))
+	c.captures = append(c.captures, st)
+	c.mu.Unlock()
+
+	if err := os.MkdirAll(st.Dir, 0o755); err != nil {
+		c.finish(st, err)
+		return c.status(st), err
+	}
+
+	start := max(d.ring.head(), 1)
+	relayed := func() bool { return h.distributor(moqt.TrackName(track)) == d }
+	go func() { c.finish(st, c.run(st, d.ring, start, relayed)) }()
+	return c.status(st), nil
+}
+
+// run writes st.Groups groups of ring, from position pos on, to st.Dir as
+// they complete. Groups evicted before they could be written are skipped.
+func (c *DebugCapture) run(st *CaptureStatus, ring *groupRing, pos moqt.GroupSequence, relayed func() bool) error {
+	for written := 0; written < st.Groups; {
+		if earliest := ring.earliestAvailable(); pos < earliest {
+			pos = earliest // evicted before it completed
+		}
+		if cache := ring.get(pos); cache != nil && cache.pos == uint64(pos) && cache.isComplete() {
+			if err := writeCapturedGroup(st.Dir, cache); err != nil {
+				return err
+			}
+			written++
+			c.mu.Lock()
+			st.Written = written
+			c.mu.Unlock()
+			pos++
+			continue
+		}
+		if !relayed() {
+			return errTrackNotRelayed
+		}
+		time.Sleep(capturePollInterval)
+	}
+	return nil
+}
+
+// finish records the end of st.
+func (c *DebugCapture) finish(st *CaptureStatus, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st.Done = true
+	if err != nil {
+		st.Error = err.Error()
+	}
+}
+
+// status returns a copy of st.
+func (c *DebugCapture) status(st *CaptureStatus) CaptureStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *st
+}
+
+// List returns every capture, oldest first.
+func (c *DebugCapture) List() []CaptureStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := make([]CaptureStatus, len(c.captures))
+	for i, st := range c.captures {
+		list[i] = *st
+	}
+	return list
+}
+
+// writeCapturedGroup writes the frames of cache to dir/<sequence>.group.
+func writeCapturedGroup(dir string, cache *groupCache) error {
+	f, err := os.Create(filepath.Join(dir, strconv.FormatUint(uint64(cache.seq), 10)+".group"))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, body := range cache.bodies() {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(body)))
+		w.Write(n[:])
+		w.Write(body)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// DebugCaptureHandlerFunc returns an http.HandlerFunc that starts and lists
+// track captures:
+//
+//	GET  /admin/capture  — every capture and its progress
+//	POST /admin/capture  — {"broadcast_path": "/live/room", "track_name": "video", "groups": 10}
+func DebugCaptureHandlerFunc(c *DebugCapture) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			list := c.List()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{
+				"captures": list,
+				"count":    len(list),
+			})
+
+		case http.MethodPost:
+			var req struct {
+				BroadcastPath string `json:"broadcast_path"`
+				TrackName     string `json:"track_name"`
+				Groups        int    `json:"groups"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				jsonError(w, http.StatusBadRequest, "invalid JSON body")
+				return
+			}
+			st, err := c.Start(req.BroadcastPath, req.TrackName, req.Groups)
+			switch {
+			case errors.Is(err, errTrackNotRelayed):
+				jsonError(w, http.StatusNotFound, err.Error())
+				return
+			case err != nil && st.ID == 0:
+				jsonError(w, http.StatusBadRequest, err.Error())
+				return
+			case err != nil:
+				jsonError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(st)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package relay
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugCaptureHandlerFunc(t *testing.T) {
+	prev := globalPublications
+	globalPublications = newPublicationRegistry()
+	t.Cleanup(func() { globalPublications = prev })
+
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+	ring.add(&fakeGroupSource{seq: 7, frames: []string{"key", "delta"}, end: io.EOF}, nil)
+	h := &RelayHandler{relaying: map[moqt.TrackName]*trackDistributor{"video": {ring: ring}}}
+	globalPublications.add(nil, "/live/room", SourceLocal, "", h, func() bool { return true })
+
+	capture := &DebugCapture{Dir: t.TempDir(), MaxGroups: 5}
+	handler := DebugCaptureHandlerFunc(capture)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/admin/capture", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(`{"broadcast_path": "/live/room", "track_name": "video", "groups": 2}`)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	var st CaptureStatus
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&st))
+	assert.Equal(t, 1, st.ID)
+	assert.Equal(t, filepath.Join(capture.Dir, "1"), st.Dir)
+
+	// The group being received is captured, then the next one
+	ring.add(&fakeGroupSource{seq: 8, frames: []string{"x"}, end: io.EOF}, nil)
+	require.Eventually(t, func() bool { return capture.List()[0].Done }, time.Second, 5*time.Millisecond)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/capture", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Captures []CaptureStatus `json:"captures"`
+		Count    int             `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.Equal(t, 1, body.Count)
+	assert.Equal(t, 2, body.Captures[0].Written)
+	assert.Empty(t, body.Captures[0].Error)
+
+	data, err := os.ReadFile(filepath.Join(st.Dir, "7.group"))
+	require.NoError(t, err)
+	assert.Equal(t, "\x00\x00\x00\x03key\x00\x00\x00\x05delta", string(data))
+	data, err = os.ReadFile(filepath.Join(st.Dir, "8.group"))
+	require.NoError(t, err)
+	assert.Equal(t, "\x00\x00\x00\x01x", string(data))
+
+	assert.Equal(t, http.StatusNotFound, post(`{"broadcast_path": "/live/room", "track_name": "audio", "groups": 1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"broadcast_path": "/live/room", "track_name": "video", "groups": 6}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{`).Code)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/admin/capture", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestDebugCapture_TrackStopped(t *testing.T) {
+	prev := globalPublications
+	globalPublications = newPublicationRegistry()
+	t.Cleanup(func() { globalPublications = prev })
+
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+	h := &RelayHandler{relaying: map[moqt.TrackName]*trackDistributor{"video": {ring: ring}}}
+	globalPublications.add(nil, "/live/room", SourceLocal, "", h, func() bool { return true })
+
+	capture := &DebugCapture{Dir: t.TempDir()}
+	_, err := capture.Start("/live/room", "video", 3)
+	require.NoError(t, err)
+
+	h.mu.Lock()
+	delete(h.relaying, "video")
+	h.mu.Unlock()
+
+	require.Eventually(t, func() bool { return capture.List()[0].Done }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, errTrackNotRelayed.Error(), capture.List()[0].Error)
+}
@@ -0,0 +1,33 @@
+package relay
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// demoPage is a single-file player that subscribes to a track of this
+// relay over WebTransport and decodes it with WebCodecs. It loads the MoQ
+// client from esm.sh, so the browser needs internet access.
+//
+//go:embed demo.html
+var demoPage []byte
+
+// DemoHandlerFunc serves the demo player, for checking a deployment by
+// hand: open /demo?path=<broadcast path> on the relay's HTTP port. The page
+// dials the relay on the same host and port over WebTransport, which
+// browsers allow only on localhost or over HTTPS.
+func DemoHandlerFunc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(demoPage)
+		}
+	}
+}
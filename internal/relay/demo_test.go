@@ -0,0 +1,29 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemoHandlerFunc(t *testing.T) {
+	handler := DemoHandlerFunc()
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/demo?path=/live/demo", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rec.Body.String(), "qumo relay demo player")
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodHead, "/demo", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/demo", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
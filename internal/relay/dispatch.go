@@ -0,0 +1,88 @@
+package relay
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dispatchQueueSize bounds values waiting for slow sinks; beyond it values
+// are dropped and counted rather than stalling the data plane.
+const dispatchQueueSize = 1024
+
+// dispatchTimeout bounds a single sink write.
+const dispatchTimeout = 5 * time.Second
+
+// asyncDispatcher delivers values to sinks from a bounded queue on its own
+// goroutine, so slow sinks never block the caller.
+type asyncDispatcher[T any] struct {
+	name    string             // for logs
+	dropped prometheus.Counter // queue full
+	failed  prometheus.Counter // sink returned an error
+
+	mu    sync.Mutex
+	queue chan T
+	done  chan struct{} // closed once the goroutine serving queue returned
+}
+
+// start replaces the sinks. The values queued for the previous sinks are
+// delivered to them first, so those may be closed once start returns. No
+// sinks disables the dispatcher.
+func (d *asyncDispatcher[T]) start(sinks []func(context.Context, T) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.queue != nil {
+		close(d.queue)
+		<-d.done
+		d.queue, d.done = nil, nil
+	}
+	if len(sinks) == 0 {
+		return
+	}
+
+	queue, done := make(chan T, dispatchQueueSize), make(chan struct{})
+	d.queue, d.done = queue, done
+	go func() {
+		defer close(done)
+		d.run(queue, sinks)
+	}()
+}
+
+// enabled reports whether any sink is configured.
+func (d *asyncDispatcher[T]) enabled() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.queue != nil
+}
+
+// send queues v without blocking.
+func (d *asyncDispatcher[T]) send(v T) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.queue == nil {
+		return
+	}
+	select {
+	case d.queue <- v:
+	default:
+		d.dropped.Inc()
+	}
+}
+
+func (d *asyncDispatcher[T]) run(queue <-chan T, sinks []func(context.Context, T) error) {
+	for v := range queue {
+		for _, write := range sinks {
+			ctx, cancel := context.WithTimeout(context.Background(), dispatchTimeout)
+			if err := write(ctx, v); err != nil {
+				d.failed.Inc()
+				slog.Debug("failed to deliver "+d.name, "error", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package relay
+
+import (
+	"cmp"
+	"context"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// DefaultEgressWriteTimeout bounds how long one frame write to a subscriber
+// may block, as it does once a subscriber stops reading and flow control
+// runs out, unless Config.EgressWriteTimeout or
+// RemoteFetcher.EgressWriteTimeout says otherwise. A write that times out
+// marks the subscriber stuck: it is logged with its session and client,
+// counted in qumo_relay_stuck_subscribers_total, and its subscription is
+// closed with StuckSubscriberErrorCode, so the relay stops holding a
+// goroutine and an open group for it.
+const DefaultEgressWriteTimeout = 10 * time.Second
+
+// egressWriteTimeout resolves a configured egress write timeout: zero is
+// DefaultEgressWriteTimeout and a negative value disables the deadline.
+func egressWriteTimeout(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return cmp.Or(d, DefaultEgressWriteTimeout)
+}
+
+// StuckSubscriberErrorCode is the subscribe error code a subscription is
+// closed with when a frame write to it times out.
+const StuckSubscriberErrorCode moqt.SubscribeErrorCode = 0x716d0001
+
+// frameWriter is the part of *moqt.GroupWriter egress writes frames with.
+type frameWriter interface {
+	WriteFrame(frame *moqt.Frame) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// writeFrame writes frame to gw within timeout, or without a deadline if
+// timeout is zero. It reports stuck if the write timed out.
+func writeFrame(gw frameWriter, frame *moqt.Frame, timeout time.Duration) (stuck bool, err error) {
+	if timeout > 0 {
+		gw.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	if err := gw.WriteFrame(frame); err != nil {
+		return isTimeout(err), err
+	}
+	return false, nil
+}
+
+// reportStuck logs and counts a subscriber whose write timed out in the
+// subscription whose context is ctx.
+func (d *trackDistributor) reportStuck(ctx context.Context, ev Event) {
+	stuckSubscribers.Inc()
+	globalEvents.emit(ev.with(EventStuckSubscriber))
+
+	attrs := []any{"timeout", d.writeTimeout}
+	if id, _ := sessionIDFromContext(ctx); id != "" {
+		attrs = append(attrs, "subscriber_session_id", id)
+	}
+	if conn := quicConnFromContext(ctx); conn != nil {
+		attrs = append(attrs, "remote_addr", conn.RemoteAddr().String())
+	}
+	if identity := IdentityFromContext(ctx); identity != "" {
+		attrs = append(attrs, "client", globalClientStats.hash(identity))
+	}
+	d.log().Warn("subscriber stuck, closing its subscription", attrs...)
+}
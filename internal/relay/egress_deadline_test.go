@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFrameWriter blocks each write until its deadline if blocked, then
+// fails it like a QUIC stream would.
+type fakeFrameWriter struct {
+	blocked  bool
+	err      error
+	deadline time.Time
+	frames   int
+}
+
+func (f *fakeFrameWriter) WriteFrame(frame *moqt.Frame) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.blocked {
+		time.Sleep(time.Until(f.deadline))
+		return os.ErrDeadlineExceeded
+	}
+	f.frames++
+	return nil
+}
+
+func (f *fakeFrameWriter) SetWriteDeadline(t time.Time) error {
+	f.deadline = t
+	return nil
+}
+
+func TestWriteFrame(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	frame := moqt.NewFrame(0)
+
+	w := &fakeFrameWriter{}
+	stuck, err := writeFrame(w, frame, timeout)
+	require.NoError(t, err)
+	assert.False(t, stuck)
+	assert.Equal(t, 1, w.frames)
+	assert.WithinDuration(t, time.Now().Add(timeout), w.deadline, 20*time.Millisecond)
+
+	// A subscriber that stops reading is stuck once the deadline passes
+	w = &fakeFrameWriter{blocked: true}
+	start := time.Now()
+	stuck, err = writeFrame(w, frame, timeout)
+	assert.Error(t, err)
+	assert.True(t, stuck)
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	// Other failures are not
+	w = &fakeFrameWriter{err: errors.New("stream reset")}
+	stuck, err = writeFrame(w, frame, timeout)
+	assert.Error(t, err)
+	assert.False(t, stuck)
+
+	// No deadline when disabled
+	w = &fakeFrameWriter{}
+	_, err = writeFrame(w, frame, 0)
+	require.NoError(t, err)
+	assert.True(t, w.deadline.IsZero())
+}
+
+func TestTrackDistributor_ReportStuck(t *testing.T) {
+	d := &trackDistributor{path: "/live/room", track: "video"}
+	before := testutil.ToFloat64(stuckSubscribers)
+
+	d.reportStuck(context.Background(), Event{BroadcastPath: "/live/room", TrackName: "video"})
+	assert.Equal(t, before+1, testutil.ToFloat64(stuckSubscribers))
+}
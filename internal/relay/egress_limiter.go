@@ -0,0 +1,163 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// egressLimiter is a token bucket that caps the relay's total egress rate.
+// When the bucket is empty, waiting writers are served round-robin per
+// track so that a high-bitrate track cannot starve the others. Capacity a
+// track does not use is available to the rest (work-conserving).
+type egressLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes/sec; 0 means unlimited
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	queues map[string][]*egressWaiter // track key → FIFO of waiters
+	ring   []string                   // tracks with waiters, in service order
+	timer  *time.Timer
+
+	// onThrottle is called with the time a writer spent waiting.
+	onThrottle func(time.Duration)
+}
+
+type egressWaiter struct {
+	n     float64
+	ready chan struct{}
+	done  bool // granted or abandoned; guarded by egressLimiter.mu
+}
+
+func newEgressLimiter() *egressLimiter {
+	return &egressLimiter{
+		queues: make(map[string][]*egressWaiter),
+	}
+}
+
+// globalEgressLimiter is shared by all track distributors.
+var globalEgressLimiter = newEgressLimiter()
+
+// setRate changes the cap to bytesPerSec. Zero or negative disables the cap
+// and releases all waiters. The burst allowance is one second of traffic.
+func (l *egressLimiter) setRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	if bytesPerSec <= 0 {
+		l.rate, l.burst, l.tokens = 0, 0, 0
+	} else {
+		if l.rate == 0 {
+			l.tokens = float64(bytesPerSec) // start with a full bucket
+		}
+		l.rate = float64(bytesPerSec)
+		l.burst = l.rate
+		l.tokens = min(l.tokens, l.burst)
+	}
+	l.dispatch()
+}
+
+// limit returns the current cap in bytes/sec, or 0 if unlimited.
+func (l *egressLimiter) limit() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// wait blocks until n bytes may be sent for the given track, or ctx ends.
+func (l *egressLimiter) wait(ctx context.Context, track string, n int) error {
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+
+	l.refill(time.Now())
+	if len(l.ring) == 0 && l.tokens >= min(float64(n), l.burst) {
+		l.tokens -= float64(n)
+		l.mu.Unlock()
+		return nil
+	}
+
+	w := &egressWaiter{n: float64(n), ready: make(chan struct{})}
+	if len(l.queues[track]) == 0 {
+		l.ring = append(l.ring, track)
+	}
+	l.queues[track] = append(l.queues[track], w)
+	l.dispatch()
+	l.mu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		if l.onThrottle != nil {
+			l.onThrottle(time.Since(start))
+		}
+	}()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		granted := w.done
+		w.done = true // dispatch skips abandoned waiters
+		l.mu.Unlock()
+		if granted {
+			return nil
+		}
+		return ctx.Err()
+	}
+}
+
+// refill adds tokens accrued since the last call. Caller must hold l.mu.
+func (l *egressLimiter) refill(now time.Time) {
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst)
+	}
+	l.last = now
+}
+
+// dispatch grants queued waiters round-robin across tracks while tokens
+// last, and arms a timer for the next grant. Caller must hold l.mu.
+func (l *egressLimiter) dispatch() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+
+	for len(l.ring) > 0 {
+		track := l.ring[0]
+		q := l.queues[track]
+		w := q[0]
+
+		if !w.done {
+			if l.rate > 0 && l.tokens < min(w.n, l.burst) {
+				wait := time.Duration((min(w.n, l.burst) - l.tokens) / l.rate * float64(time.Second))
+				l.timer = time.AfterFunc(wait, func() {
+					l.mu.Lock()
+					defer l.mu.Unlock()
+					l.refill(time.Now())
+					l.dispatch()
+				})
+				return
+			}
+			if l.rate > 0 {
+				l.tokens -= w.n // may go negative for frames larger than the burst
+			}
+			w.done = true
+			close(w.ready)
+		}
+
+		// Pop the waiter and rotate the track to the back of the ring.
+		l.ring = l.ring[1:]
+		if q = q[1:]; len(q) == 0 {
+			delete(l.queues, track)
+		} else {
+			l.queues[track] = q
+			l.ring = append(l.ring, track)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEgressLimiter_UnlimitedByDefault(t *testing.T) {
+	l := newEgressLimiter()
+	start := time.Now()
+	for range 100 {
+		require.NoError(t, l.wait(context.Background(), "a", 1<<20))
+	}
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, int64(0), l.limit())
+}
+
+func TestEgressLimiter_EnforcesRate(t *testing.T) {
+	l := newEgressLimiter()
+	var throttled time.Duration
+	l.onThrottle = func(d time.Duration) { throttled += d }
+	l.setRate(10_000) // 10 KB/s, 10 KB burst
+
+	start := time.Now()
+	for range 15 {
+		require.NoError(t, l.wait(context.Background(), "a", 1000))
+	}
+	// 10 KB burst + 5 KB at 10 KB/s ≈ 500ms
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+	assert.Greater(t, throttled, time.Duration(0))
+}
+
+func TestEgressLimiter_FairBetweenTracks(t *testing.T) {
+	l := newEgressLimiter()
+	l.setRate(20_000)
+	require.NoError(t, l.wait(context.Background(), "drain", 20_000)) // empty the bucket
+
+	ctx, cancel := context.WithTimeout(context.Background(), 600*time.Millisecond)
+	defer cancel()
+
+	var mu sync.Mutex
+	sent := map[string]int{}
+	var wg sync.WaitGroup
+	for _, track := range []string{"big", "small"} {
+		size := 4000
+		if track == "small" {
+			size = 500
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l.wait(ctx, track, size) == nil {
+				mu.Lock()
+				sent[track]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Round-robin gives both tracks turns; the small track must not starve.
+	assert.Greater(t, sent["small"], 0)
+	assert.Greater(t, sent["big"], 0)
+}
+
+func TestEgressLimiter_ContextCancel(t *testing.T) {
+	l := newEgressLimiter()
+	l.setRate(1000)
+	require.NoError(t, l.wait(context.Background(), "a", 1000))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.wait(ctx, "a", 1000), context.DeadlineExceeded)
+}
+
+func TestEgressLimiter_DisableReleasesWaiters(t *testing.T) {
+	l := newEgressLimiter()
+	l.setRate(100)
+	require.NoError(t, l.wait(context.Background(), "a", 100))
+
+	done := make(chan error, 1)
+	go func() { done <- l.wait(context.Background(), "a", 10_000) }()
+
+	time.Sleep(20 * time.Millisecond)
+	l.setRate(0)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiter not released after disabling the cap")
+	}
+}
@@ -0,0 +1,381 @@
+package relay
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// EgressPool writes the frames of a relay's egress loops on a fixed set of
+// worker goroutines. Without one, every subscriber's egress writes from its
+// own goroutine and the Go scheduler alone decides which runs; with
+// thousands of tracks, the busiest can crowd out the rest. With a pool, the
+// loops queue their writes per track and the workers serve the tracks in
+// weighted round-robin, each track getting as many turns per round as it
+// has subscribers, so every subscriber keeps getting turns whatever track
+// it follows. Loops waiting for data still park in their own goroutines,
+// which costs nothing; only the writes are pooled.
+//
+// A worker whose write is still blocked after egressSlotHold, as it is
+// once a subscriber stops reading and flow control runs out, no longer
+// counts against the pool: a replacement is started, and the stalled
+// worker exits once its write returns if the pool is full again. Stalled
+// subscribers thus cannot hold the workers the other tracks need; at worst
+// there is a goroutine per stalled write, as without a pool.
+//
+// Each Server has its own pool, so the virtual hosts of a relay do not
+// compete for workers. A nil *EgressPool writes from the egress loops.
+type EgressPool struct {
+	workers int           // workers not stalled the pool keeps running
+	hold    time.Duration // how long a write may run before its worker is replaced; egressSlotHold
+
+	mu      sync.Mutex
+	work    sync.Cond               // signaled when a write is queued or the pool closes
+	tracks  map[string]*egressTrack // track key → its subscribers and queued writes
+	ring    fifo[*egressTrack]      // tracks with queued writes, in service order
+	running map[*egressWorker]bool  // started workers → stalled
+	active  int                     // running workers not stalled
+	closed  bool
+	stop    chan struct{} // closed by Close, ending the supervisor
+}
+
+// egressSlotHold is how long a write may run before its worker is taken
+// to be stalled. Writes that do not block finish well within it.
+const egressSlotHold = 5 * time.Millisecond
+
+// egressTrack is a track served by an EgressPool.
+type egressTrack struct {
+	key         string
+	subscribers int              // its egress loops, the track's weight
+	queue       fifo[*egressJob] // writes waiting for a worker, oldest first
+	credit      int              // turns left in the current round
+	queued      bool             // in the ring
+}
+
+// egressJob is a frame write of one egress loop. Each loop reuses its own,
+// so queuing a write allocates nothing.
+type egressJob struct {
+	gw      frameWriter
+	frame   *moqt.Frame
+	timeout time.Duration // of the write; 0 for no deadline
+	stuck   bool
+	err     error
+	queued  time.Time     // when the write was queued
+	waiting bool          // in its track's queue; guarded by EgressPool.mu
+	done    chan struct{} // receives once the write returned
+}
+
+// egressWorker is the state of a worker goroutine, guarded by
+// EgressPool.mu.
+type egressWorker struct {
+	since time.Time // start of the current write; zero while idle
+}
+
+// NewEgressPool starts a pool of n workers. Zero or negative returns nil,
+// which writes from the egress loops. Close stops the workers.
+func NewEgressPool(n int) *EgressPool {
+	return newEgressPool(n, egressSlotHold)
+}
+
+// newEgressPool is NewEgressPool replacing the workers stalled for hold.
+func newEgressPool(n int, hold time.Duration) *EgressPool {
+	if n <= 0 {
+		return nil
+	}
+	p := &EgressPool{
+		workers: n,
+		hold:    hold,
+		tracks:  make(map[string]*egressTrack),
+		running: make(map[*egressWorker]bool),
+		stop:    make(chan struct{}),
+	}
+	p.work.L = &p.mu
+
+	p.mu.Lock()
+	for range n {
+		p.spawn()
+	}
+	p.mu.Unlock()
+	egressWorkers.Add(float64(n))
+
+	go p.supervise()
+	return p
+}
+
+// Size returns the number of workers, or 0 for a nil pool.
+func (p *EgressPool) Size() int {
+	if p == nil {
+		return 0
+	}
+	return p.workers
+}
+
+// Close stops the workers once the queued writes are done. Writes after
+// Close are made from the egress loops.
+func (p *EgressPool) Close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	p.work.Broadcast()
+	egressWorkers.Sub(float64(p.workers))
+}
+
+// join registers an egress loop of track, whose writes time out after
+// timeout, and returns the queue its writes go through. The loop must call
+// leave when it ends.
+func (p *EgressPool) join(track string, timeout time.Duration) *egressQueue {
+	q := &egressQueue{pool: p, timeout: timeout}
+	if p == nil {
+		return q
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := p.tracks[track]
+	if t == nil {
+		t = &egressTrack{key: track}
+		p.tracks[track] = t
+	}
+	t.subscribers++
+	q.track = t
+	q.job.done = make(chan struct{}, 1)
+	return q
+}
+
+// egressQueue is an egress loop's handle on its pool.
+type egressQueue struct {
+	pool    *EgressPool
+	track   *egressTrack
+	timeout time.Duration // of each write; 0 for no deadline
+	job     egressJob
+}
+
+// leave unregisters the egress loop.
+func (q *egressQueue) leave() {
+	p := q.pool
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := q.track
+	t.subscribers--
+	if t.subscribers == 0 && t.queue.len() == 0 && p.tracks[t.key] == t {
+		delete(p.tracks, t.key)
+	}
+}
+
+// write writes frame to gw on a worker, like writeFrame, waiting for its
+// turn. It returns ctx's error if ctx ends before a worker took the write;
+// once one did, it waits for the write to return, since gw is in use.
+func (q *egressQueue) write(ctx context.Context, gw frameWriter, frame *moqt.Frame) (stuck bool, err error) {
+	p := q.pool
+	if p == nil {
+		return writeFrame(gw, frame, q.timeout)
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return writeFrame(gw, frame, q.timeout)
+	}
+	if err := ctx.Err(); err != nil {
+		p.mu.Unlock()
+		return false, err
+	}
+	j, t := &q.job, q.track
+	j.gw, j.frame, j.timeout, j.stuck, j.err = gw, frame, q.timeout, false, nil
+	j.queued, j.waiting = time.Now(), true
+	t.queue.push(j)
+	if !t.queued {
+		t.queued = true
+		p.ring.push(t)
+	}
+	p.work.Signal()
+	p.mu.Unlock()
+
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		p.mu.Lock()
+		if j.waiting {
+			j.waiting = false
+			t.queue.remove(j)
+			p.mu.Unlock()
+			return false, ctx.Err()
+		}
+		p.mu.Unlock()
+		<-j.done
+	}
+	j.gw, j.frame = nil, nil
+	return j.stuck, j.err
+}
+
+// spawn starts a worker. Caller must hold p.mu.
+func (p *EgressPool) spawn() {
+	w := &egressWorker{}
+	p.running[w] = false
+	p.active++
+	go p.serve(w)
+}
+
+// serve runs queued writes until the pool closes, or until w stalled and
+// was replaced.
+func (p *EgressPool) serve(w *egressWorker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		j := p.next()
+		for j == nil && !p.closed {
+			p.work.Wait()
+			j = p.next()
+		}
+		if j == nil {
+			delete(p.running, w)
+			return
+		}
+
+		now := time.Now()
+		egressSchedulerWaitSeconds.Add(now.Sub(j.queued).Seconds())
+		w.since = now
+		p.mu.Unlock()
+
+		j.stuck, j.err = writeFrame(j.gw, j.frame, j.timeout)
+		j.done <- struct{}{}
+
+		p.mu.Lock()
+		w.since = time.Time{}
+		if p.running[w] {
+			// Stalled and replaced: rejoin the pool only if it is short
+			if p.active >= p.workers || p.closed {
+				delete(p.running, w)
+				return
+			}
+			p.running[w] = false
+			p.active++
+		}
+	}
+}
+
+// next pops the next queued write, serving the tracks in weighted
+// round-robin. It returns nil if no write is queued. Caller must hold p.mu.
+func (p *EgressPool) next() *egressJob {
+	for p.ring.len() > 0 {
+		t := p.ring.peek()
+		if t.queue.len() == 0 {
+			// Its queued writes were abandoned
+			p.ring.pop()
+			t.queued, t.credit = false, 0
+			continue
+		}
+		if t.credit == 0 {
+			t.credit = max(t.subscribers, 1)
+		}
+
+		j := t.queue.pop()
+		j.waiting = false
+		t.credit--
+
+		switch {
+		case t.queue.len() == 0:
+			p.ring.pop()
+			t.queued, t.credit = false, 0
+		case t.credit == 0:
+			// Its turns for the round are used up
+			p.ring.push(p.ring.pop())
+		}
+		return j
+	}
+	return nil
+}
+
+// fifo is a queue reusing its backing array, so that a steady flow through
+// it allocates nothing.
+type fifo[T comparable] struct {
+	items []T
+	head  int
+}
+
+func (q *fifo[T]) len() int { return len(q.items) - q.head }
+
+func (q *fifo[T]) push(v T) {
+	if q.head > 0 && len(q.items) == cap(q.items) {
+		// Reclaim the popped prefix rather than grow
+		n := copy(q.items, q.items[q.head:])
+		clear(q.items[n:])
+		q.items, q.head = q.items[:n], 0
+	}
+	q.items = append(q.items, v)
+}
+
+func (q *fifo[T]) peek() T { return q.items[q.head] }
+
+func (q *fifo[T]) pop() T {
+	var zero T
+	v := q.items[q.head]
+	q.items[q.head] = zero
+	if q.head++; q.head == len(q.items) {
+		q.items, q.head = q.items[:0], 0
+	}
+	return v
+}
+
+// remove drops v from the queue.
+func (q *fifo[T]) remove(v T) {
+	live := q.items[q.head:]
+	if i := slices.Index(live, v); i >= 0 {
+		q.items = slices.Delete(q.items, q.head+i, q.head+i+1)
+		if q.head == len(q.items) {
+			q.items, q.head = q.items[:0], 0
+		}
+	}
+}
+
+// supervise replaces the workers stalled on a write every hold, for as
+// long as writes are waiting, until the pool closes.
+func (p *EgressPool) supervise() {
+	ticker := time.NewTicker(p.hold)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.replaceStalled(time.Now())
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// replaceStalled marks the workers whose write started before now-hold
+// as stalled and starts replacements, if writes are waiting.
+func (p *EgressPool) replaceStalled(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ring.len() == 0 || p.closed {
+		return
+	}
+	for w, stalled := range p.running {
+		if !stalled && !w.since.IsZero() && now.Sub(w.since) >= p.hold {
+			p.running[w] = true
+			p.active--
+		}
+	}
+	for p.active < p.workers {
+		p.spawn()
+	}
+}
@@ -0,0 +1,302 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFrameWriter tracks how many of its writes run at once, each
+// write taking delay.
+type countingFrameWriter struct {
+	delay         time.Duration
+	writing, peak *atomic.Int32
+}
+
+func (w *countingFrameWriter) WriteFrame(frame *moqt.Frame) error {
+	n := w.writing.Add(1)
+	for {
+		p := w.peak.Load()
+		if n <= p || w.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	time.Sleep(w.delay)
+	w.writing.Add(-1)
+	return nil
+}
+
+func (w *countingFrameWriter) SetWriteDeadline(t time.Time) error { return nil }
+
+// poolWorkers returns the number of started workers of p, stalled or not.
+func poolWorkers(p *EgressPool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.running)
+}
+
+func TestEgressPool_NilWritesInline(t *testing.T) {
+	var p *EgressPool
+	assert.Nil(t, NewEgressPool(0))
+	assert.Equal(t, 0, p.Size())
+
+	q := p.join("a", 0)
+	defer q.leave()
+	w := &fakeFrameWriter{}
+	for range 10 {
+		_, err := q.write(context.Background(), w, moqt.NewFrame(0))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 10, w.frames)
+	p.Close()
+}
+
+func TestEgressPool_BoundsConcurrentWrites(t *testing.T) {
+	p := newEgressPool(3, time.Minute) // no write stalls
+	defer p.Close()
+	assert.Equal(t, 3, p.Size())
+
+	var writing, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q := p.join(fmt.Sprint("track-", i%4), 0)
+			defer q.leave()
+			w := &countingFrameWriter{delay: 100 * time.Microsecond, writing: &writing, peak: &peak}
+			for range 10 {
+				_, err := q.write(context.Background(), w, moqt.NewFrame(0))
+				if !assert.NoError(t, err) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, peak.Load(), int32(3))
+	assert.Equal(t, 3, poolWorkers(p))
+	assert.Empty(t, p.tracks, "tracks outlive their subscribers")
+}
+
+func TestEgressPool_WeightedBySubscribers(t *testing.T) {
+	p := newEgressPool(1, time.Minute)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// Fifty subscribers of a hot track against one of a quiet track
+	var mu sync.Mutex
+	sent := map[string]int{}
+	var wg sync.WaitGroup
+	loop := func(track string) {
+		defer wg.Done()
+		q := p.join(track, 0)
+		defer q.leave()
+		var writing, peak atomic.Int32
+		w := &countingFrameWriter{delay: 50 * time.Microsecond, writing: &writing, peak: &peak}
+		for {
+			if _, err := q.write(ctx, w, moqt.NewFrame(0)); err != nil {
+				return
+			}
+			mu.Lock()
+			sent[track]++
+			mu.Unlock()
+		}
+	}
+	for range 50 {
+		wg.Add(1)
+		go loop("hot")
+	}
+	wg.Add(1)
+	go loop("quiet")
+	wg.Wait()
+
+	// The hot track gets a turn per subscriber, and the quiet track's
+	// subscriber about as many as each of the hot track's
+	require.Greater(t, sent["quiet"], 0)
+	assert.Greater(t, sent["hot"], 10*sent["quiet"])
+	assert.Greater(t, sent["quiet"], sent["hot"]/50/3)
+}
+
+func TestEgressPool_ContextCancel(t *testing.T) {
+	p := newEgressPool(1, time.Minute)
+	defer p.Close()
+	frame := moqt.NewFrame(0)
+
+	// A write holds the only worker
+	stalled := &stallingFrameWriter{writing: make(chan struct{}), unblock: make(chan struct{})}
+	a := p.join("a", 0)
+	defer a.leave()
+	stalledDone := make(chan struct{})
+	go func() {
+		defer close(stalledDone)
+		a.write(context.Background(), stalled, frame)
+	}()
+	<-stalled.writing
+
+	b := p.join("b", 0)
+	defer b.leave()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	w := &fakeFrameWriter{}
+	_, err := b.write(ctx, w, frame)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The abandoned write is never made
+	close(stalled.unblock)
+	<-stalledDone
+	_, err = b.write(context.Background(), w, frame)
+	require.NoError(t, err)
+	assert.Equal(t, 1, w.frames)
+}
+
+// stallingFrameWriter blocks every write until unblock is closed, like a
+// subscriber that stopped reading.
+type stallingFrameWriter struct {
+	writing chan struct{} // closed once a write blocks
+	unblock chan struct{}
+}
+
+func (w *stallingFrameWriter) WriteFrame(frame *moqt.Frame) error {
+	close(w.writing)
+	<-w.unblock
+	return nil
+}
+
+func (w *stallingFrameWriter) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestEgressPool_StalledWriteReplacesWorker(t *testing.T) {
+	p := newEgressPool(1, 5*time.Millisecond)
+	defer p.Close()
+	frame := moqt.NewFrame(0)
+
+	stalled := &stallingFrameWriter{writing: make(chan struct{}), unblock: make(chan struct{})}
+	stalledDone := make(chan struct{})
+	go func() {
+		defer close(stalledDone)
+		q := p.join("stalled", 0) // the stalled write never times out
+		defer q.leave()
+		q.write(context.Background(), stalled, frame)
+	}()
+	<-stalled.writing
+
+	// Other tracks keep writing on a replacement worker
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := range 20 {
+		q := p.join(fmt.Sprint("track-", i%2), 0)
+		_, err := q.write(ctx, &fakeFrameWriter{}, frame)
+		q.leave()
+		require.NoError(t, err, "egress frozen by a stalled subscriber")
+	}
+	assert.Equal(t, 2, poolWorkers(p))
+
+	// The stalled worker exits once its write returns
+	close(stalled.unblock)
+	<-stalledDone
+	assert.Eventually(t, func() bool { return poolWorkers(p) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestEgressPool_Close(t *testing.T) {
+	p := newEgressPool(2, time.Minute)
+	q := p.join("a", 0)
+	defer q.leave()
+
+	p.Close()
+	p.Close()
+	assert.Eventually(t, func() bool { return poolWorkers(p) == 0 }, time.Second, time.Millisecond)
+
+	// Writes after Close are made inline
+	w := &fakeFrameWriter{}
+	_, err := q.write(context.Background(), w, moqt.NewFrame(0))
+	require.NoError(t, err)
+	assert.Equal(t, 1, w.frames)
+}
+
+func TestEgressPool_WriteAllocatesNothing(t *testing.T) {
+	p := newEgressPool(1, time.Minute)
+	defer p.Close()
+	q := p.join("a", 0)
+	defer q.leave()
+
+	w := &fakeFrameWriter{}
+	frame := moqt.NewFrame(0)
+	allocs := testing.AllocsPerRun(100, func() {
+		q.write(context.Background(), w, frame)
+	})
+	assert.Zero(t, allocs)
+}
+
+// BenchmarkEgressScheduling compares goroutine-per-egress with worker-pool
+// mode at high track counts. Each track's egress writes its share of b.N
+// frames, a write being a 1 KiB copy. Besides ns/op, it reports spread: how
+// much later the last track finished than the first, relative to the run.
+func BenchmarkEgressScheduling(b *testing.B) {
+	for _, tracks := range []int{100, 1000, 5000} {
+		for _, workers := range []int{0, runtime.GOMAXPROCS(0)} {
+			mode := "goroutines"
+			if workers > 0 {
+				mode = fmt.Sprintf("workers=%d", workers)
+			}
+			b.Run(fmt.Sprintf("%s/tracks=%d", mode, tracks), func(b *testing.B) {
+				benchmarkEgressScheduling(b, tracks, workers)
+			})
+		}
+	}
+}
+
+// copyFrameWriter writes a frame by copying src to dst.
+type copyFrameWriter struct{ src, dst []byte }
+
+func (w *copyFrameWriter) WriteFrame(frame *moqt.Frame) error {
+	copy(w.dst, w.src)
+	return nil
+}
+
+func (w *copyFrameWriter) SetWriteDeadline(t time.Time) error { return nil }
+
+func benchmarkEgressScheduling(b *testing.B, tracks, workers int) {
+	p := NewEgressPool(workers)
+	defer p.Close()
+	frames := max(b.N/tracks, 1)
+	src := make([]byte, 1024)
+	frame := moqt.NewFrame(0)
+
+	finished := make([]time.Duration, tracks)
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	start := time.Now()
+	for i := range tracks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := &copyFrameWriter{src: src, dst: make([]byte, len(src))}
+			q := p.join(fmt.Sprint("track-", i), 0)
+			defer q.leave()
+			for range frames {
+				q.write(context.Background(), w, frame)
+			}
+			finished[i] = time.Since(start)
+		}()
+	}
+	wg.Wait()
+	total := time.Since(start)
+	b.StopTimer()
+
+	first, last := finished[0], finished[0]
+	for _, d := range finished {
+		first, last = min(first, d), max(last, d)
+	}
+	b.ReportMetric(float64(last-first)/float64(total), "spread")
+}
@@ -0,0 +1,109 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EventSchemaVersion is the version of the Event JSON schema. It is bumped
+// on incompatible changes; consumers should ignore unknown fields.
+const EventSchemaVersion = 1
+
+// Event types.
+const (
+	EventBroadcastStart  = "broadcast_start"  // a publisher announced, or a remote broadcast was fetched
+	EventBroadcastStop   = "broadcast_stop"   // the announcement ended
+	EventSubscriberJoin  = "subscriber_join"  // a subscriber started receiving a track
+	EventSubscriberLeave = "subscriber_leave" // the subscriber's track ended
+	EventCatchUp         = "catch_up"         // a subscriber fell behind and skipped ahead
+	EventFailover        = "failover"         // a remote broadcast was re-routed after its session died
+	EventStuckSubscriber = "stuck_subscriber" // a write to the subscriber timed out and its track was closed
+)
+
+// Event is a relay lifecycle or QoE event, published as JSON.
+type Event struct {
+	SchemaVersion int       `json:"schema_version"`
+	Type          string    `json:"type"`
+	Time          time.Time `json:"time"`
+
+	// Relay is the node ID of the relay emitting the event.
+	Relay string `json:"relay,omitempty"`
+
+	SessionID     string `json:"session_id,omitempty"`
+	BroadcastPath string `json:"broadcast_path,omitempty"`
+	TrackName     string `json:"track_name,omitempty"`
+
+	// Client is the hashed subscriber identity, as in client metrics.
+	Client string `json:"client,omitempty"`
+
+	// Source is the relay a remote broadcast is fetched from.
+	Source string `json:"source,omitempty"`
+
+	// NextHop is the address a remote broadcast was fetched through; for
+	// failovers, the hop that was lost.
+	NextHop string `json:"next_hop,omitempty"`
+
+	// Groups and Bytes are sent with subscriber_leave.
+	Groups uint64 `json:"groups,omitempty"`
+	Bytes  uint64 `json:"bytes,omitempty"`
+}
+
+// EventPublisher publishes events to a bus. NATSPublisher and
+// KafkaRESTPublisher are provided.
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, ev Event) error
+}
+
+// eventBus stamps and queues events for the configured publishers.
+type eventBus struct {
+	asyncDispatcher[Event]
+
+	relayMu sync.Mutex
+	relay   string
+}
+
+// globalEvents is shared by all relay handlers and the remote fetcher.
+var globalEvents = &eventBus{asyncDispatcher: asyncDispatcher[Event]{
+	name:    "relay event",
+	dropped: eventsDropped,
+	failed:  eventsFailed,
+}}
+
+// SetEventPublishers configures the event bus. relayID is stamped on every
+// event. No publishers disables events. The events queued for the
+// publishers set before are published first, so those may be closed once
+// it returns.
+func SetEventPublishers(relayID string, pubs ...EventPublisher) {
+	globalEvents.relayMu.Lock()
+	globalEvents.relay = relayID
+	globalEvents.relayMu.Unlock()
+
+	writers := make([]func(context.Context, Event) error, 0, len(pubs))
+	for _, pub := range pubs {
+		writers = append(writers, pub.PublishEvent)
+	}
+	globalEvents.start(writers)
+}
+
+// with returns a copy of ev with the given type.
+func (ev Event) with(typ string) Event {
+	ev.Type = typ
+	return ev
+}
+
+// emit stamps ev and queues it without blocking.
+func (b *eventBus) emit(ev Event) {
+	if !b.enabled() {
+		return
+	}
+	b.relayMu.Lock()
+	ev.Relay = b.relay
+	b.relayMu.Unlock()
+
+	ev.SchemaVersion = EventSchemaVersion
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b.send(ev)
+}
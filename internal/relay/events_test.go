@@ -0,0 +1,229 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingPublisher collects events for tests.
+type recordingPublisher struct {
+	got chan Event
+}
+
+func (p *recordingPublisher) PublishEvent(_ context.Context, ev Event) error {
+	p.got <- ev
+	return nil
+}
+
+func (p *recordingPublisher) wait(t *testing.T) Event {
+	t.Helper()
+	select {
+	case ev := <-p.got:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event delivered")
+		return Event{}
+	}
+}
+
+func TestEventBus_Disabled(t *testing.T) {
+	SetEventPublishers("")
+	assert.False(t, globalEvents.enabled())
+
+	// Must not block or panic
+	globalEvents.emit(Event{Type: EventBroadcastStart})
+}
+
+func TestEventBus_Emit(t *testing.T) {
+	pub := &recordingPublisher{got: make(chan Event, 4)}
+	SetEventPublishers("relay-a", pub)
+	defer SetEventPublishers("")
+
+	globalEvents.emit(Event{Type: EventSubscriberJoin, BroadcastPath: "/live/test", TrackName: "video"})
+
+	ev := pub.wait(t)
+	assert.Equal(t, EventSchemaVersion, ev.SchemaVersion)
+	assert.Equal(t, EventSubscriberJoin, ev.Type)
+	assert.Equal(t, "relay-a", ev.Relay)
+	assert.Equal(t, "/live/test", ev.BroadcastPath)
+	assert.False(t, ev.Time.IsZero())
+}
+
+// fakeNATSServer accepts one connection, checks CONNECT, and returns the
+// published messages as "subject payload".
+func fakeNATSServer(t *testing.T, wantAuth map[string]string) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	msgs := make(chan string, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "CONNECT "):
+				var opts map[string]any
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &opts)
+				for k, v := range wantAuth {
+					if opts[k] != v {
+						conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+						return
+					}
+				}
+			case line == "PING":
+				conn.Write([]byte("PONG\r\n"))
+			case strings.HasPrefix(line, "PUB "):
+				fields := strings.Fields(line)
+				n, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, n+2)
+				if _, err := io.ReadFull(r, payload); err != nil {
+					return
+				}
+				msgs <- fields[1] + " " + string(payload[:n])
+			}
+		}
+	}()
+	return ln.Addr().String(), msgs
+}
+
+func TestNATSPublisher(t *testing.T) {
+	addr, msgs := fakeNATSServer(t, map[string]string{"user": "relay", "pass": "secret"})
+
+	pub := &NATSPublisher{URL: "nats://relay:secret@" + addr}
+	defer pub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, pub.PublishEvent(ctx, Event{SchemaVersion: 1, Type: EventFailover, BroadcastPath: "/live/a"}))
+
+	select {
+	case msg := <-msgs:
+		subject, payload, _ := strings.Cut(msg, " ")
+		assert.Equal(t, DefaultNATSSubject+"."+EventFailover, subject)
+		var ev Event
+		require.NoError(t, json.Unmarshal([]byte(payload), &ev))
+		assert.Equal(t, "/live/a", ev.BroadcastPath)
+		assert.Equal(t, 1, ev.SchemaVersion)
+	case <-time.After(time.Second):
+		t.Fatal("no message published")
+	}
+}
+
+func TestNATSPublisher_DeadlinePerEvent(t *testing.T) {
+	addr, msgs := fakeNATSServer(t, nil)
+
+	pub := &NATSPublisher{URL: "nats://" + addr}
+	defer pub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.NoError(t, pub.PublishEvent(ctx, Event{Type: EventBroadcastStart}))
+	<-msgs
+	<-ctx.Done()
+
+	// The first event's deadline has passed; the next write must not fail
+	// on it (the fake server accepts a single connection)
+	done := make(chan error, 1)
+	go func() { done <- pub.PublishEvent(context.Background(), Event{Type: EventFailover}) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("publish without a deadline hung")
+	}
+	select {
+	case msg := <-msgs:
+		assert.True(t, strings.HasPrefix(msg, DefaultNATSSubject+"."+EventFailover+" "))
+	case <-time.After(time.Second):
+		t.Fatal("no message published")
+	}
+}
+
+func TestNATSPublisher_CloseFlushes(t *testing.T) {
+	addr, msgs := fakeNATSServer(t, nil)
+
+	pub := &NATSPublisher{URL: "nats://" + addr}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for range 3 {
+		require.NoError(t, pub.PublishEvent(ctx, Event{Type: EventBroadcastStart}))
+	}
+	require.NoError(t, pub.Close())
+
+	// Close returned after the server answered the PING it sent behind
+	// the events, so the server has them all
+	assert.Len(t, msgs, 3)
+	require.NoError(t, pub.Close(), "closing twice is a no-op")
+}
+
+func TestNATSPublisher_AuthError(t *testing.T) {
+	addr, _ := fakeNATSServer(t, map[string]string{"auth_token": "right"})
+
+	pub := &NATSPublisher{URL: "nats://wrong@" + addr}
+	defer pub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := pub.PublishEvent(ctx, Event{Type: EventBroadcastStart})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Authorization Violation")
+}
+
+func TestKafkaRESTPublisher(t *testing.T) {
+	var body struct {
+		Records []struct {
+			Key   string `json:"key"`
+			Value Event  `json:"value"`
+		} `json:"records"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/topics/relay-events", r.URL.Path)
+		assert.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	pub := &KafkaRESTPublisher{URL: srv.URL + "/", Topic: "relay-events"}
+	require.NoError(t, pub.PublishEvent(context.Background(), Event{Type: EventSubscriberLeave, BroadcastPath: "/live/b", Bytes: 42}))
+
+	require.Len(t, body.Records, 1)
+	assert.Equal(t, "/live/b", body.Records[0].Key)
+	assert.Equal(t, uint64(42), body.Records[0].Value.Bytes)
+}
+
+func TestKafkaRESTPublisher_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	assert.ErrorIs(t, (&KafkaRESTPublisher{URL: srv.URL}).PublishEvent(context.Background(), Event{}), errKafkaTopic)
+	assert.Error(t, (&KafkaRESTPublisher{URL: srv.URL, Topic: "t"}).PublishEvent(context.Background(), Event{}))
+}
@@ -0,0 +1,336 @@
+package relay
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// Forward error correction on relay-to-relay hops.
+//
+// A relay whose SDN route marks the hop to its next hop as lossy (see
+// topology.EdgeAttributes.FECStripes) subscribes to each relayed track's
+// parity track, FECTrackName(track, stripes), next to the track itself.
+// Unless a real track has that name, the next hop answers it from its own
+// group cache: once a group is complete it sends a group with the same
+// sequence holding one parity frame per stripe, where stripe p covers the
+// frames p, p+stripes, p+2·stripes…
+//
+// QUIC retransmits within a stream, so on a lossy link frames are lost as a
+// group's tail: the stream is reset or stalls past its stall timeout. When
+// that happens the receiving relay waits up to its recovery wait for the
+// group's parity and rebuilds the missing frames, which works while at most
+// one frame per stripe is missing, i.e. up to stripes frames.
+//
+// Parity frame layout (big endian):
+//
+//	u32 frame count of the group
+//	u8  stripes
+//	u8  stripe index p
+//	u32 length of each frame in stripe p, in order
+//	... XOR of the stripe's frames, each zero-padded to the longest
+const fecTrackSuffix = ".fec"
+
+// DefaultFECRecoveryWait is how long a truncated group waits for its
+// parity before it is passed on truncated, unless
+// RemoteFetcher.FECRecoveryWait says otherwise. Later groups queue behind
+// it.
+const DefaultFECRecoveryWait = 250 * time.Millisecond
+
+// fecParityGroups is how many groups of parity a receiver keeps.
+const fecParityGroups = 32
+
+// maxFECStripes mirrors topology.MaxFECStripes.
+const maxFECStripes = 16
+
+// FECTrackName returns the parity track of track with stripes parity frames
+// per group.
+func FECTrackName(track moqt.TrackName, stripes int) moqt.TrackName {
+	return track + moqt.TrackName(fecTrackSuffix+strconv.Itoa(stripes))
+}
+
+// parseFECTrackName splits a parity track name into the protected track
+// and the stripe count.
+func parseFECTrackName(name moqt.TrackName) (track moqt.TrackName, stripes int, ok bool) {
+	i := strings.LastIndex(string(name), fecTrackSuffix)
+	if i <= 0 {
+		return "", 0, false
+	}
+	stripes, err := strconv.Atoi(string(name[i+len(fecTrackSuffix):]))
+	if err != nil || stripes < 1 || stripes > maxFECStripes {
+		return "", 0, false
+	}
+	return name[:i], stripes, true
+}
+
+// encodeParity returns the parity frames of a group's frames: one per
+// stripe that has frames.
+func encodeParity(frames [][]byte, stripes int) [][]byte {
+	parity := make([][]byte, 0, stripes)
+	for p := 0; p < stripes && p < len(frames); p++ {
+		var lengths []byte
+		var xor []byte
+		for i := p; i < len(frames); i += stripes {
+			lengths = binary.BigEndian.AppendUint32(lengths, uint32(len(frames[i])))
+			if n := len(frames[i]); n > len(xor) {
+				xor = append(xor, make([]byte, n-len(xor))...)
+			}
+			for j, b := range frames[i] {
+				xor[j] ^= b
+			}
+		}
+
+		frame := binary.BigEndian.AppendUint32(nil, uint32(len(frames)))
+		frame = append(frame, byte(stripes), byte(p))
+		frame = append(frame, lengths...)
+		parity = append(parity, append(frame, xor...))
+	}
+	return parity
+}
+
+// parityFrame is a decoded parity frame.
+type parityFrame struct {
+	count   int   // frames in the group
+	stripes int   // stripe count
+	stripe  int   // this frame's stripe
+	lengths []int // of the stripe's frames
+	xor     []byte
+}
+
+var errBadParity = errors.New("malformed parity frame")
+
+// decodeParity parses a parity frame.
+func decodeParity(b []byte) (parityFrame, error) {
+	if len(b) < 6 {
+		return parityFrame{}, errBadParity
+	}
+	pf := parityFrame{
+		count:   int(binary.BigEndian.Uint32(b)),
+		stripes: int(b[4]),
+		stripe:  int(b[5]),
+	}
+	if pf.stripes < 1 || pf.stripe >= pf.stripes || pf.stripe >= pf.count {
+		return parityFrame{}, errBadParity
+	}
+	n := (pf.count - pf.stripe + pf.stripes - 1) / pf.stripes // frames in the stripe
+	b = b[6:]
+	if len(b) < 4*n {
+		return parityFrame{}, errBadParity
+	}
+	maxLen := 0
+	for i := range n {
+		l := int(binary.BigEndian.Uint32(b[4*i:]))
+		pf.lengths = append(pf.lengths, l)
+		maxLen = max(maxLen, l)
+	}
+	pf.xor = b[4*n:]
+	if len(pf.xor) != maxLen {
+		return parityFrame{}, errBadParity
+	}
+	return pf, nil
+}
+
+// recoverFrames rebuilds the frames missing from the tail of a group whose
+// first frames were received, using its parity frames keyed by stripe. It
+// reports false unless every missing frame could be rebuilt; a group that
+// turns out to have lost nothing needs no frames.
+func recoverFrames(received [][]byte, parity map[int]parityFrame) ([][]byte, bool) {
+	var count, stripes int
+	for _, pf := range parity {
+		count, stripes = pf.count, pf.stripes
+		break
+	}
+	if len(parity) == 0 || count < len(received) {
+		return nil, false
+	}
+
+	var recovered [][]byte
+	for j := len(received); j < count; j++ {
+		p := j % stripes
+		pf, ok := parity[p]
+		if !ok || j-stripes >= len(received) {
+			return nil, false // no parity, or a second frame of the stripe is missing
+		}
+		frame := append(make([]byte, 0, len(pf.xor)), pf.xor...)
+		for i := p; i < len(received); i += stripes {
+			if len(received[i]) > len(frame) {
+				return nil, false // not the group the parity was computed over
+			}
+			for k, b := range received[i] {
+				frame[k] ^= b
+			}
+		}
+		recovered = append(recovered, frame[:pf.lengths[j/stripes]])
+	}
+	return recovered, true
+}
+
+// fecReceiver collects the parity groups of a relayed track and rebuilds
+// truncated groups from them.
+type fecReceiver struct {
+	stripes int
+	wait    time.Duration
+	stall   time.Duration // how long a parity group may go without a frame; 0 for no limit
+
+	mu      sync.Mutex
+	parity  map[moqt.GroupSequence]map[int]parityFrame
+	order   []moqt.GroupSequence // oldest first
+	arrived chan struct{}        // closed and replaced when parity arrives
+}
+
+func newFECReceiver(stripes int, wait, stall time.Duration) *fecReceiver {
+	return &fecReceiver{
+		stripes: stripes,
+		wait:    wait,
+		stall:   stall,
+		parity:  make(map[moqt.GroupSequence]map[int]parityFrame),
+		arrived: make(chan struct{}),
+	}
+}
+
+// ingest stores the parity groups of src until ctx is cancelled or the
+// subscription ends, and closes src.
+func (r *fecReceiver) ingest(ctx context.Context, src *moqt.TrackReader, logger *slog.Logger) {
+	defer src.Close()
+
+	frame := moqt.NewFrame(0)
+	for {
+		gr, err := src.AcceptGroup(ctx)
+		if err != nil {
+			logger.Debug("fec: parity track ended", "error", err)
+			return
+		}
+		seq := gr.GroupSequence()
+		for {
+			if r.stall > 0 {
+				gr.SetReadDeadline(time.Now().Add(r.stall))
+			}
+			if err := gr.ReadFrame(frame); err != nil {
+				if !errors.Is(err, io.EOF) {
+					gr.CancelRead(moqt.ExpiredGroupErrorCode)
+				}
+				break
+			}
+			pf, err := decodeParity(append([]byte(nil), frame.Body()...))
+			if err != nil {
+				logger.Debug("fec: dropping parity frame", "seq", seq, "error", err)
+				continue
+			}
+			r.store(seq, pf)
+		}
+	}
+}
+
+// store records a parity frame of group seq and wakes waiters.
+func (r *fecReceiver) store(seq moqt.GroupSequence, pf parityFrame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.parity[seq]
+	if !ok {
+		group = make(map[int]parityFrame, r.stripes)
+		r.parity[seq] = group
+		r.order = append(r.order, seq)
+		if len(r.order) > fecParityGroups {
+			delete(r.parity, r.order[0])
+			r.order = r.order[1:]
+		}
+	}
+	group[pf.stripe] = pf
+
+	close(r.arrived)
+	r.arrived = make(chan struct{})
+}
+
+// recover waits up to r.wait for the parity of group seq and returns the
+// frames missing after received, or false if they cannot be rebuilt.
+func (r *fecReceiver) recover(seq moqt.GroupSequence, received [][]byte) ([][]byte, bool) {
+	deadline := time.NewTimer(r.wait)
+	defer deadline.Stop()
+
+	for {
+		r.mu.Lock()
+		group := r.parity[seq]
+		recovered, ok := recoverFrames(received, group)
+		arrived := r.arrived
+		r.mu.Unlock()
+		if ok {
+			return recovered, true
+		}
+
+		select {
+		case <-arrived:
+		case <-deadline.C:
+			return nil, false
+		}
+	}
+}
+
+// egressParity serves the parity track of d to tw: a parity group for each
+// group d completes from now on. Truncated groups get none.
+func (d *trackDistributor) egressParity(tw *moqt.TrackWriter, stripes int) {
+	ctx := tw.Context()
+
+	notify := d.subscribe()
+	defer d.unsubscribe(notify)
+
+	last := d.ring.head()
+	if last > 0 {
+		last--
+	}
+
+	for {
+		if last < d.ring.head() {
+			next := last + 1
+			if next < d.ring.earliestAvailable() {
+				last = d.ring.head() - 1 // fell behind; the skipped groups go unprotected
+				continue
+			}
+			if cache := d.ring.get(next); cache != nil && cache.isComplete() {
+				last = next
+				if !cache.isTruncated() {
+					if err := writeParity(tw, cache, stripes); err != nil {
+						return
+					}
+				}
+				continue
+			}
+		}
+
+		select {
+		case <-notify:
+		case <-time.After(NotifyTimeout):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// writeParity sends the parity group of cache.
+func writeParity(tw *moqt.TrackWriter, cache *groupCache, stripes int) error {
+	gw, err := tw.OpenGroupAt(cache.seq)
+	if err != nil {
+		return err
+	}
+	parity := encodeParity(cache.bodies(), stripes)
+	frame := moqt.NewFrame(0)
+	for _, b := range parity {
+		frame.Reset()
+		frame.Write(b)
+		if err := gw.WriteFrame(frame); err != nil {
+			gw.CancelWrite(moqt.InternalGroupErrorCode)
+			return err
+		}
+		globalTrafficStats.addEgressBytes(len(b))
+	}
+	fecParityFrames.Add(float64(len(parity)))
+	return gw.Close()
+}
@@ -0,0 +1,127 @@
+package relay
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFECTrackName(t *testing.T) {
+	name := FECTrackName("video", 4)
+	assert.Equal(t, moqt.TrackName("video.fec4"), name)
+
+	track, stripes, ok := parseFECTrackName(name)
+	require.True(t, ok)
+	assert.Equal(t, moqt.TrackName("video"), track)
+	assert.Equal(t, 4, stripes)
+
+	for _, name := range []moqt.TrackName{"video", ".fec4", "video.fec", "video.fec0", "video.fec17", "video.fecx"} {
+		_, _, ok := parseFECTrackName(name)
+		assert.False(t, ok, name)
+	}
+}
+
+// parityOf encodes and decodes the parity of frames, keyed by stripe.
+func parityOf(t *testing.T, frames [][]byte, stripes int) map[int]parityFrame {
+	t.Helper()
+	parity := make(map[int]parityFrame)
+	for _, b := range encodeParity(frames, stripes) {
+		pf, err := decodeParity(b)
+		require.NoError(t, err)
+		parity[pf.stripe] = pf
+	}
+	return parity
+}
+
+func TestRecoverFrames(t *testing.T) {
+	frames := [][]byte{[]byte("key"), []byte("a"), []byte("bb"), []byte("ccc"), []byte(""), []byte("dddd")}
+
+	tests := map[string]struct {
+		stripes  int
+		received int
+		ok       bool
+	}{
+		"nothing lost":          {stripes: 2, received: 6, ok: true},
+		"one frame lost":        {stripes: 1, received: 5, ok: true},
+		"tail within stripes":   {stripes: 4, received: 2, ok: true},
+		"whole group lost":      {stripes: 6, received: 0, ok: true},
+		"tail longer than that": {stripes: 2, received: 3, ok: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recovered, ok := recoverFrames(frames[:tt.received], parityOf(t, frames, tt.stripes))
+			require.Equal(t, tt.ok, ok)
+			if ok {
+				assert.Equal(t, frames[tt.received:], append([][]byte{}, recovered...))
+			}
+		})
+	}
+}
+
+func TestRecoverFrames_MissingParity(t *testing.T) {
+	frames := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	parity := parityOf(t, frames, 2)
+	delete(parity, 0)
+
+	_, ok := recoverFrames(frames[:2], parity)
+	assert.False(t, ok, "frame 2 is in the stripe whose parity was lost")
+	_, ok = recoverFrames(frames[:1], nil)
+	assert.False(t, ok)
+}
+
+func TestDecodeParity_Malformed(t *testing.T) {
+	good := encodeParity([][]byte{[]byte("abc"), []byte("de")}, 1)[0]
+
+	for _, b := range [][]byte{nil, good[:5], good[:len(good)-1], append(good, 0)} {
+		_, err := decodeParity(b)
+		assert.ErrorIs(t, err, errBadParity)
+	}
+}
+
+func TestGroupRingAdd_FECRecovery(t *testing.T) {
+	frames := [][]byte{[]byte("a"), []byte("bb"), []byte("ccc")}
+
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+	ring.fec = newFECReceiver(2, DefaultFECRecoveryWait, 0)
+	ring.fec.wait = time.Second
+
+	// The parity arrives while the group is still being read.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		for _, pf := range parityOf(t, frames, 2) {
+			ring.fec.store(1, pf)
+		}
+	}()
+
+	src := &fakeGroupSource{seq: 1, frames: []string{"a"}, end: errors.New("stream reset")}
+	cache, reason := ring.add(src, nil)
+	assert.Empty(t, reason)
+	assert.False(t, cache.isTruncated())
+	assert.Equal(t, frames, cache.bodies())
+}
+
+func TestGroupRingAdd_FECUnrecoverable(t *testing.T) {
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+	ring.fec = newFECReceiver(1, DefaultFECRecoveryWait, 0)
+	ring.fec.wait = 10 * time.Millisecond
+
+	src := &fakeGroupSource{seq: 1, frames: []string{"a"}, end: errors.New("stream reset")}
+	cache, reason := ring.add(src, nil)
+	assert.Equal(t, groupReset, reason, "no parity arrived")
+	assert.True(t, cache.isTruncated())
+}
+
+func TestFECReceiver_KeepsRecentGroups(t *testing.T) {
+	r := newFECReceiver(1, DefaultFECRecoveryWait, 0)
+	pf := parityFrame{count: 1, stripes: 1, lengths: []int{0}}
+	for seq := range moqt.GroupSequence(fecParityGroups + 1) {
+		r.store(seq, pf)
+	}
+
+	assert.Len(t, r.parity, fecParityGroups)
+	assert.NotContains(t, r.parity, moqt.GroupSequence(0))
+}
@@ -0,0 +1,196 @@
+package relay
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Subsystems whose goroutines are accounted by the relay.
+const (
+	GoroutineIngest  = "ingest"  // upstream track and parity readers
+	GoroutineEgress  = "egress"  // subscriber priority followers
+	GoroutineFetcher = "fetcher" // remote fetcher path monitors
+)
+
+// GoroutineInfo describes a live accounted goroutine.
+type GoroutineInfo struct {
+	Subsystem string    `json:"subsystem"`
+	Name      string    `json:"name"` // what it serves, e.g. "/live/a video"
+	StartedAt time.Time `json:"started_at"`
+	AgeSec    float64   `json:"age_sec"`
+}
+
+// goroutineTracker records the goroutines started through it until they
+// return.
+type goroutineTracker struct {
+	mu   sync.Mutex
+	next uint64
+	live map[uint64]GoroutineInfo
+}
+
+// globalGoroutines accounts the relay's per-track and per-path goroutines.
+var globalGoroutines = &goroutineTracker{}
+
+// goSpawn runs fn in a goroutine accounted under subsystem and name.
+func (t *goroutineTracker) goSpawn(subsystem, name string, fn func()) {
+	t.mu.Lock()
+	if t.live == nil {
+		t.live = make(map[uint64]GoroutineInfo)
+	}
+	t.next++
+	id := t.next
+	t.live[id] = GoroutineInfo{Subsystem: subsystem, Name: name, StartedAt: time.Now()}
+	t.mu.Unlock()
+	goroutines.WithLabelValues(subsystem).Inc()
+
+	go func() {
+		defer func() {
+			t.mu.Lock()
+			delete(t.live, id)
+			t.mu.Unlock()
+			goroutines.WithLabelValues(subsystem).Dec()
+		}()
+		fn()
+	}()
+}
+
+// list returns the live goroutines as of now, oldest first.
+func (t *goroutineTracker) list(now time.Time) []GoroutineInfo {
+	t.mu.Lock()
+	list := make([]GoroutineInfo, 0, len(t.live))
+	for _, g := range t.live {
+		list = append(list, g)
+	}
+	t.mu.Unlock()
+
+	for i := range list {
+		list[i].AgeSec = now.Sub(list[i].StartedAt).Seconds()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+	return list
+}
+
+// counts returns the number of live goroutines per subsystem.
+func (t *goroutineTracker) counts() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, g := range t.live {
+		counts[g.Subsystem]++
+	}
+	return counts
+}
+
+// Goroutines returns the relay's accounted goroutines, oldest first.
+func Goroutines() []GoroutineInfo {
+	return globalGoroutines.list(time.Now())
+}
+
+// GoroutinesHandlerFunc returns an http.HandlerFunc listing the relay's
+// accounted goroutines, oldest first, with their counts per subsystem.
+//
+//	GET /admin/goroutines
+func GoroutinesHandlerFunc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		list := Goroutines()
+		counts := make(map[string]int)
+		for _, g := range list {
+			counts[g.Subsystem]++
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"goroutines":   list,
+			"count":        len(list),
+			"by_subsystem": counts,
+		})
+	}
+}
+
+// Defaults for GoroutineLeakDetector.
+const (
+	DefaultLeakInterval  = 30 * time.Second
+	DefaultLeakMinGrowth = 100
+)
+
+// GoroutineLeakDetector warns when the accounted goroutines of a subsystem
+// keep growing while the relay's sessions do not, the signature of
+// goroutines that outlive what they serve. Each subsystem's count is
+// compared with a baseline taken when it last shrank or sessions last
+// grew; a rise of MinGrowth over it is logged and counted in
+// qumo_relay_goroutine_leak_warnings_total, and becomes the new baseline.
+type GoroutineLeakDetector struct {
+	// Interval between samples. Zero uses DefaultLeakInterval.
+	Interval time.Duration
+
+	// MinGrowth is the rise over the baseline that is reported.
+	// Zero uses DefaultLeakMinGrowth.
+	MinGrowth int
+
+	// Sessions returns the relay's current session count.
+	Sessions func() int
+
+	baselines map[string]leakBaseline
+}
+
+// leakBaseline is a subsystem's goroutine count and the session count when
+// it was taken.
+type leakBaseline struct {
+	goroutines, sessions int
+}
+
+// Run samples every Interval until ctx is cancelled.
+func (d *GoroutineLeakDetector) Run(ctx context.Context) {
+	ticker := time.NewTicker(cmp.Or(d.Interval, DefaultLeakInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.check(globalGoroutines.counts(), d.Sessions())
+		}
+	}
+}
+
+// check compares counts, per subsystem, and sessions with the baselines
+// and returns the subsystems reported.
+func (d *GoroutineLeakDetector) check(counts map[string]int, sessions int) []string {
+	minGrowth := cmp.Or(d.MinGrowth, DefaultLeakMinGrowth)
+	if d.baselines == nil {
+		d.baselines = make(map[string]leakBaseline)
+	}
+
+	var reported []string
+	for _, subsystem := range []string{GoroutineIngest, GoroutineEgress, GoroutineFetcher} {
+		now := leakBaseline{goroutines: counts[subsystem], sessions: sessions}
+		base, ok := d.baselines[subsystem]
+		switch {
+		case !ok || now.goroutines < base.goroutines || now.sessions > base.sessions:
+			d.baselines[subsystem] = now
+		case now.goroutines-base.goroutines >= minGrowth:
+			slog.Warn("goroutines growing without new sessions, possible leak",
+				"subsystem", subsystem,
+				"goroutines", now.goroutines,
+				"baseline", base.goroutines,
+				"sessions", now.sessions)
+			goroutineLeakWarnings.WithLabelValues(subsystem).Inc()
+			reported = append(reported, subsystem)
+			d.baselines[subsystem] = now
+		}
+	}
+	return reported
+}
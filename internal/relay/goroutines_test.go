@@ -0,0 +1,79 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoroutineTracker_Spawn(t *testing.T) {
+	tracker := &goroutineTracker{}
+	before := testutil.ToFloat64(goroutines.WithLabelValues(GoroutineFetcher))
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	tracker.goSpawn(GoroutineFetcher, "/live/a", func() { <-release })
+	tracker.goSpawn(GoroutineFetcher, "/live/b", func() { <-release; close(done) })
+
+	list := tracker.list(time.Now())
+	require.Len(t, list, 2)
+	assert.Equal(t, "/live/a", list[0].Name, "oldest first")
+	assert.Equal(t, map[string]int{GoroutineFetcher: 2}, tracker.counts())
+	assert.Equal(t, before+2, testutil.ToFloat64(goroutines.WithLabelValues(GoroutineFetcher)))
+
+	close(release)
+	<-done
+	assert.Eventually(t, func() bool { return len(tracker.counts()) == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, before, testutil.ToFloat64(goroutines.WithLabelValues(GoroutineFetcher)))
+}
+
+func TestGoroutinesHandlerFunc(t *testing.T) {
+	prev := globalGoroutines
+	globalGoroutines = &goroutineTracker{}
+	t.Cleanup(func() { globalGoroutines = prev })
+
+	release := make(chan struct{})
+	defer close(release)
+	globalGoroutines.goSpawn(GoroutineIngest, "/live/a video", func() { <-release })
+	globalGoroutines.goSpawn(GoroutineEgress, "/live/a video", func() { <-release })
+
+	handler := GoroutinesHandlerFunc()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/goroutines", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Goroutines  []GoroutineInfo `json:"goroutines"`
+		Count       int             `json:"count"`
+		BySubsystem map[string]int  `json:"by_subsystem"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, 2, body.Count)
+	assert.Equal(t, GoroutineIngest, body.Goroutines[0].Subsystem)
+	assert.Equal(t, map[string]int{GoroutineIngest: 1, GoroutineEgress: 1}, body.BySubsystem)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/goroutines", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestGoroutineLeakDetector(t *testing.T) {
+	d := &GoroutineLeakDetector{MinGrowth: 10}
+	before := testutil.ToFloat64(goroutineLeakWarnings.WithLabelValues(GoroutineFetcher))
+
+	assert.Empty(t, d.check(map[string]int{GoroutineFetcher: 5}, 2), "first sample sets the baseline")
+	assert.Empty(t, d.check(map[string]int{GoroutineFetcher: 14}, 2), "below MinGrowth")
+	assert.Empty(t, d.check(map[string]int{GoroutineFetcher: 40}, 3), "sessions grew with it")
+	assert.Equal(t, []string{GoroutineFetcher}, d.check(map[string]int{GoroutineFetcher: 50}, 3))
+	assert.Empty(t, d.check(map[string]int{GoroutineFetcher: 55}, 1), "reported growth is the new baseline")
+	assert.Empty(t, d.check(map[string]int{GoroutineFetcher: 20}, 1), "shrinking resets the baseline")
+	assert.Equal(t, []string{GoroutineFetcher}, d.check(map[string]int{GoroutineFetcher: 30}, 1))
+
+	assert.Equal(t, before+2, testutil.ToFloat64(goroutineLeakWarnings.WithLabelValues(GoroutineFetcher)))
+}
@@ -0,0 +1,46 @@
+package relay
+
+import (
+	"strings"
+	"time"
+)
+
+// GroupBudget caps how long an upstream group of the matching tracks may
+// stay open. A group still open at the end of its budget is closed toward
+// subscribers like a stalled one: they get the frames cached so far and
+// the group is cancelled with moqt.ExpiredGroupErrorCode, so one frame a
+// publisher never finishes cannot hold back live delivery. Such groups are
+// counted in qumo_relay_incomplete_groups_total with reason "over_budget".
+type GroupBudget struct {
+	// Prefix selects the broadcast paths; empty matches every path.
+	Prefix string
+
+	// Track selects the track name; empty matches every track.
+	Track string
+
+	// MaxGroupDuration is the time from when a group is first awaited to
+	// when it is closed if the publisher has not finished it.
+	MaxGroupDuration time.Duration
+}
+
+// groupBudgets are the budgets of a handler's tracks.
+type groupBudgets []GroupBudget
+
+// lookup returns the budget of a track, or 0 if it has none. The longest
+// matching prefix wins, and on a tie the budget naming the track.
+func (b groupBudgets) lookup(broadcastPath, track string) time.Duration {
+	var best *GroupBudget
+	for i, gb := range b {
+		if !strings.HasPrefix(broadcastPath, gb.Prefix) || (gb.Track != "" && gb.Track != track) {
+			continue
+		}
+		if best == nil || len(gb.Prefix) > len(best.Prefix) ||
+			(len(gb.Prefix) == len(best.Prefix) && gb.Track != "" && best.Track == "") {
+			best = &b[i]
+		}
+	}
+	if best == nil {
+		return 0
+	}
+	return best.MaxGroupDuration
+}
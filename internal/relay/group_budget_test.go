@@ -0,0 +1,50 @@
+package relay
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupBudgetsLookup(t *testing.T) {
+	b := groupBudgets{
+		{Prefix: "", MaxGroupDuration: 10 * time.Second},
+		{Prefix: "/live/", MaxGroupDuration: 4 * time.Second},
+		{Prefix: "/live/", Track: "video", MaxGroupDuration: 2 * time.Second},
+		{Prefix: "/live/sports/", MaxGroupDuration: time.Second},
+	}
+
+	assert.Equal(t, 10*time.Second, b.lookup("/vod/a", "video"))
+	assert.Equal(t, 4*time.Second, b.lookup("/live/a", "audio"))
+	assert.Equal(t, 2*time.Second, b.lookup("/live/a", "video"), "track named on the same prefix")
+	assert.Equal(t, time.Second, b.lookup("/live/sports/a", "video"), "longest prefix")
+
+	assert.Zero(t, groupBudgets(nil).lookup("/live/a", "video"))
+}
+
+func TestGroupRingAdd_OverBudget(t *testing.T) {
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+	ring.stallTimeout = DefaultGroupStallTimeout
+	ring.maxGroupDuration = time.Millisecond
+
+	src := &fakeGroupSource{seq: 1, frames: []string{"a"}, end: os.ErrDeadlineExceeded}
+	before := time.Now()
+	cache, reason := ring.add(src, nil)
+	assert.Equal(t, groupOverBudget, reason)
+	assert.True(t, cache.isTruncated())
+	assert.Equal(t, [][]byte{[]byte("a")}, cache.bodies())
+	require.NotNil(t, src.canceled)
+	assert.Equal(t, moqt.ExpiredGroupErrorCode, *src.canceled)
+	assert.WithinDuration(t, before.Add(time.Millisecond), src.deadline, 50*time.Millisecond,
+		"the budget ends before the stall timeout")
+
+	// A stall within the budget stays a stall
+	ring.maxGroupDuration = time.Hour
+	src = &fakeGroupSource{seq: 2, end: os.ErrDeadlineExceeded}
+	_, reason = ring.add(src, nil)
+	assert.Equal(t, groupStalled, reason)
+}
@@ -1,20 +1,63 @@
 package relay
 
 import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"log/slog"
+	"net"
+	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/okdaichi/gomoqt/moqt"
 )
 
 const DefaultGroupCacheSize = 8
 
+// DefaultGroupStallTimeout is how long an upstream group may go without a
+// frame before the relay gives up on it, unless Config.GroupStallTimeout or
+// RemoteFetcher.GroupStallTimeout says otherwise. Subscribers get the frames
+// cached so far and the group is cancelled downstream with
+// moqt.ExpiredGroupErrorCode, so they see an explicit skip rather than a
+// silent truncation.
+const DefaultGroupStallTimeout = 5 * time.Second
+
+// groupStallTimeout resolves a configured group stall timeout: zero is
+// DefaultGroupStallTimeout and a negative value disables the timeout.
+func groupStallTimeout(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return cmp.Or(d, DefaultGroupStallTimeout)
+}
+
+// Reasons a group ended before the publisher finished it.
+const (
+	groupStalled    = "stalled"     // no frame within the stall timeout
+	groupReset      = "reset"       // upstream stream reset or failed
+	groupOverBudget = "over_budget" // open longer than the track's GroupBudget
+)
+
+// castagnoli is the CRC-32C table used for group checksums.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
 type groupCache struct {
-	mu       sync.Mutex // Protects frames slice for defensive programming
-	seq      moqt.GroupSequence
-	frames   []*moqt.Frame
-	complete atomic.Bool // True when all frames have been added
+	mu        sync.Mutex // Protects frames slice for defensive programming
+	seq       moqt.GroupSequence
+	pos       uint64 // position in the ring
+	createdAt time.Time
+	frames    []*moqt.Frame
+	complete  atomic.Bool   // True when all frames have been added
+	truncated atomic.Bool   // True if the group ended before the publisher finished it
+	size      atomic.Uint64 // Total frame payload bytes
+	checksum  uint32        // CRC-32C over each frame's length and payload; protected by mu
+	verified  atomic.Bool   // True once compared with the upstream relay's checksum
 }
 
 // isComplete returns true if the group has finished receiving all frames.
@@ -22,6 +65,12 @@ func (gc *groupCache) isComplete() bool {
 	return gc.complete.Load()
 }
 
+// isTruncated reports whether the group was abandoned before it finished.
+// Only meaningful once isComplete returns true.
+func (gc *groupCache) isTruncated() bool {
+	return gc.truncated.Load()
+}
+
 // markComplete marks the group as complete.
 func (gc *groupCache) markComplete() {
 	gc.complete.Store(true)
@@ -40,7 +89,34 @@ func (gc *groupCache) append(f *moqt.Frame) {
 	// This operation never returns an error, so we can ignore it.
 	_, _ = f.WriteTo(clone)
 
+	// Frame lengths are part of the checksum so re-framing is caught too.
+	body := clone.Body()
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(body)))
+	gc.checksum = crc32.Update(gc.checksum, castagnoli, n[:])
+	gc.checksum = crc32.Update(gc.checksum, castagnoli, body)
+
 	gc.frames = append(gc.frames, clone)
+	gc.size.Add(uint64(f.Len()))
+}
+
+// bodies returns copies of the payloads of the frames cached so far.
+func (gc *groupCache) bodies() [][]byte {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	bodies := make([][]byte, len(gc.frames))
+	for i, f := range gc.frames {
+		bodies[i] = append([]byte(nil), f.Body()...)
+	}
+	return bodies
+}
+
+// sum returns the group's checksum as hex.
+func (gc *groupCache) sum() string {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	return fmt.Sprintf("%08x", gc.checksum)
 }
 
 // next returns the frame at the given index.
@@ -55,6 +131,54 @@ func (gc *groupCache) next(index int) *moqt.Frame {
 	return gc.frames[index]
 }
 
+// frameBody returns a copy of the payload of the frame at index, or false
+// if the group has no such frame.
+func (gc *groupCache) frameBody(index int) ([]byte, bool) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if index < 0 || index >= len(gc.frames) {
+		return nil, false
+	}
+	return append([]byte(nil), gc.frames[index].Body()...), true
+}
+
+// CachedGroup describes a group held in a track's cache.
+type CachedGroup struct {
+	Sequence  uint64 `json:"sequence"`
+	Frames    int    `json:"frames"`
+	Bytes     uint64 `json:"bytes"`
+	Complete  bool   `json:"complete"`
+	Truncated bool   `json:"truncated"`          // ended before the publisher finished it
+	AgeMs     int64  `json:"age_ms"`             // since the first frame was awaited
+	Checksum  string `json:"checksum,omitempty"` // CRC-32C of the frames, once complete
+
+	Hints *GroupHints `json:"hints,omitempty"` // from the publisher, if it sent any
+}
+
+// info describes gc as of now.
+func (gc *groupCache) info(now time.Time) CachedGroup {
+	complete := gc.isComplete()
+
+	gc.mu.Lock()
+	frames := len(gc.frames)
+	checksum := gc.checksum
+	gc.mu.Unlock()
+
+	info := CachedGroup{
+		Sequence:  uint64(gc.seq),
+		Frames:    frames,
+		Bytes:     gc.size.Load(),
+		Complete:  complete,
+		Truncated: gc.isTruncated(),
+		AgeMs:     now.Sub(gc.createdAt).Milliseconds(),
+	}
+	if complete {
+		info.Checksum = fmt.Sprintf("%08x", checksum)
+	}
+	return info
+}
+
 func newGroupRing(size int, pool *FramePool) *groupRing {
 	ring := &groupRing{
 		caches: make([]atomic.Pointer[groupCache], size),
@@ -69,23 +193,92 @@ type groupRing struct {
 	pool   *FramePool
 	size   int
 	pos    atomic.Uint64
+	floor  atomic.Uint64 // earliest position kept after a trim
+	logger *slog.Logger  // the track's logger; nil logs to the default
+	fec    *fecReceiver  // parity of the track's groups; nil without FEC
+	hints  *groupHints   // the publisher's hints of the track's groups, while its hints track is relayed; nil in tests
+
+	stallTimeout     time.Duration // how long a group may go without a frame; 0 for no limit
+	maxGroupDuration time.Duration // the track's GroupBudget; 0 for none
+
+	decompress bool // frames arrive compressed; see CompressedTrackName
+}
+
+// groupSource is the part of *moqt.GroupReader the ring reads from.
+type groupSource interface {
+	GroupSequence() moqt.GroupSequence
+	ReadFrame(frame *moqt.Frame) error
+	SetReadDeadline(t time.Time) error
+	CancelRead(code moqt.GroupErrorCode)
 }
 
-func (ring *groupRing) add(group *moqt.GroupReader, onFrame func()) {
-	cache := &groupCache{
-		seq:    group.GroupSequence(),
-		frames: make([]*moqt.Frame, 0, 1),
+// add caches the frames of group as they arrive and returns the cache. The
+// reason is "" when the publisher finished the group, or groupStalled,
+// groupOverBudget or groupReset when it was abandoned; abandoned groups are
+// still marked complete, and truncated. With FEC, a stalled or reset group
+// is first rebuilt from its parity if it arrives within the FEC recovery
+// wait.
+func (ring *groupRing) add(group groupSource, onFrame func()) (cache *groupCache, reason string) {
+	cache = &groupCache{
+		seq:       group.GroupSequence(),
+		createdAt: time.Now(),
+		frames:    make([]*moqt.Frame, 0, 1),
 	}
 
-	idx := int(ring.pos.Add(1) % uint64(ring.size))
+	cache.pos = ring.pos.Add(1)
+	idx := int(cache.pos % uint64(ring.size))
 	ring.caches[idx].Store(cache)
 
 	frame := ring.pool.Get()
+	var plain *moqt.Frame
+	if ring.decompress {
+		plain = moqt.NewFrame(0)
+	}
+
+	var budgetEnd time.Time
+	if ring.maxGroupDuration > 0 {
+		budgetEnd = cache.createdAt.Add(ring.maxGroupDuration)
+	}
 
 	frameCount := 0
-	for frame := range group.Frames(frame) {
+	for {
+		var deadline time.Time
+		if ring.stallTimeout > 0 {
+			deadline = time.Now().Add(ring.stallTimeout)
+		}
+		if !budgetEnd.IsZero() && (deadline.IsZero() || budgetEnd.Before(deadline)) {
+			deadline = budgetEnd
+		}
+		if !deadline.IsZero() {
+			group.SetReadDeadline(deadline)
+		}
+		err := group.ReadFrame(frame)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			reason = groupReset
+			if isTimeout(err) {
+				reason = groupStalled
+				if !budgetEnd.IsZero() && deadline.Equal(budgetEnd) {
+					reason = groupOverBudget
+				}
+				group.CancelRead(moqt.ExpiredGroupErrorCode)
+			}
+			break
+		}
+
+		if plain != nil {
+			if err := decompressFrame(plain, frame); err != nil {
+				reason = groupReset
+				group.CancelRead(moqt.InternalGroupErrorCode)
+				break
+			}
+			cache.append(plain)
+		} else {
+			cache.append(frame)
+		}
 		frameCount++
-		cache.append(frame)
 
 		// Notify subscribers that a new frame is available
 		if onFrame != nil {
@@ -93,27 +286,123 @@ func (ring *groupRing) add(group *moqt.GroupReader, onFrame func()) {
 		}
 	}
 
-	slog.Debug("group cached", "seq", cache.seq, "frames", frameCount)
+	// An over-budget group is still being published, so no parity is coming
+	if (reason == groupStalled || reason == groupReset) && ring.fec != nil {
+		recovered, ok := ring.fec.recover(cache.seq, cache.bodies())
+		if ok {
+			for _, body := range recovered {
+				frame.Reset()
+				frame.Write(body)
+				frameCount++
+				cache.append(frame)
+				if onFrame != nil {
+					onFrame()
+				}
+			}
+			fecRecoveredFrames.Add(float64(len(recovered)))
+			reason = ""
+		} else {
+			fecUnrecoverableGroups.Inc()
+		}
+	}
+
+	logger := ring.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	hotPathLogs.log(logger, slog.LevelDebug, "group cached", "seq", cache.seq, "frames", frameCount)
+	if reason != "" {
+		cache.truncated.Store(true)
+	}
 	cache.markComplete()
 
 	// Final notification for group completion
 	if onFrame != nil {
 		onFrame()
 	}
+	return cache, reason
+}
+
+// isTimeout reports whether err is a read deadline expiry.
+func isTimeout(err error) bool {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
 }
 
 func (ring *groupRing) get(seq moqt.GroupSequence) *groupCache {
 	return ring.caches[uint64(seq)%uint64(ring.size)].Load()
 }
 
+// list describes every cached group, oldest sequence first.
+func (ring *groupRing) list() []CachedGroup {
+	now := time.Now()
+	groups := make([]CachedGroup, 0, ring.size)
+	for i := range ring.caches {
+		if cache := ring.caches[i].Load(); cache != nil {
+			info := cache.info(now)
+			if h, ok := ring.hints.get(cache.seq); ok {
+				info.Hints = &h
+			}
+			groups = append(groups, info)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Sequence < groups[j].Sequence })
+	return groups
+}
+
+// lookup returns the cached group with sequence seq, or nil if it has been
+// evicted or never arrived.
+func (ring *groupRing) lookup(seq moqt.GroupSequence) *groupCache {
+	for i := range ring.caches {
+		if cache := ring.caches[i].Load(); cache != nil && cache.seq == seq {
+			return cache
+		}
+	}
+	return nil
+}
+
 func (ring *groupRing) head() moqt.GroupSequence {
 	return moqt.GroupSequence(ring.pos.Load())
 }
 
 func (ring *groupRing) earliestAvailable() moqt.GroupSequence {
 	head := ring.head()
-	if head <= moqt.GroupSequence(ring.size) {
-		return 1
+	earliest := moqt.GroupSequence(1)
+	if head > moqt.GroupSequence(ring.size) {
+		earliest = head - moqt.GroupSequence(ring.size) + 1
+	}
+	return max(earliest, moqt.GroupSequence(ring.floor.Load()))
+}
+
+// trim evicts all but the keep most recent groups to free memory, and
+// returns how many it evicted. Subscribers behind them catch up as if
+// the ring had wrapped.
+func (ring *groupRing) trim(keep int) int {
+	keep = max(keep, 1)
+	head := ring.pos.Load()
+	if head <= uint64(keep) {
+		return 0
+	}
+	floor := head - uint64(keep) + 1
+	for {
+		old := ring.floor.Load()
+		if old >= floor || ring.floor.CompareAndSwap(old, floor) {
+			break
+		}
+	}
+
+	evicted := 0
+	for i := range ring.caches {
+		cache := ring.caches[i].Load()
+		if cache == nil || cache.pos >= floor {
+			continue
+		}
+		if ring.caches[i].CompareAndSwap(cache, nil) {
+			evicted++
+		}
 	}
-	return head - moqt.GroupSequence(ring.size) + 1
+	return evicted
 }
@@ -1,6 +1,9 @@
 package relay
 
 import (
+	"errors"
+	"io"
+	"os"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -86,8 +89,133 @@ func TestGroupRingAdd(t *testing.T) {
 		t.Errorf("Expected initial head 0, got %d", ring.head())
 	}
 
-	// Note: We can't easily test add() without a real GroupReader
-	// This would require mocking, which is tested in integration tests
+	src := &fakeGroupSource{seq: 1, frames: []string{"a", "b"}, end: io.EOF}
+	notified := 0
+	if _, reason := ring.add(src, func() { notified++ }); reason != "" {
+		t.Errorf("Expected complete group, got reason %q", reason)
+	}
+
+	cache := ring.get(1)
+	if cache == nil || !cache.isComplete() || cache.isTruncated() {
+		t.Fatalf("Expected complete, untruncated cache, got %+v", cache)
+	}
+	if cache.size.Load() != 2 {
+		t.Errorf("Expected 2 payload bytes, got %d", cache.size.Load())
+	}
+	if f := cache.next(1); f == nil || string(f.Body()) != "b" {
+		t.Errorf("Expected second frame %q, got %v", "b", f)
+	}
+	if notified != 3 {
+		t.Errorf("Expected 3 notifications (2 frames + completion), got %d", notified)
+	}
+}
+
+// fakeGroupSource replays frames, then returns end.
+type fakeGroupSource struct {
+	seq      moqt.GroupSequence
+	frames   []string
+	end      error
+	deadline time.Time
+	canceled *moqt.GroupErrorCode
+}
+
+func (f *fakeGroupSource) GroupSequence() moqt.GroupSequence { return f.seq }
+
+func (f *fakeGroupSource) ReadFrame(frame *moqt.Frame) error {
+	if len(f.frames) == 0 {
+		return f.end
+	}
+	frame.Reset()
+	frame.Write([]byte(f.frames[0]))
+	f.frames = f.frames[1:]
+	return nil
+}
+
+func (f *fakeGroupSource) SetReadDeadline(t time.Time) error {
+	f.deadline = t
+	return nil
+}
+
+func (f *fakeGroupSource) CancelRead(code moqt.GroupErrorCode) {
+	f.canceled = &code
+}
+
+// TestGroupRingAddIncomplete tests that stalled and reset groups are
+// marked complete but truncated
+func TestGroupRingAddIncomplete(t *testing.T) {
+	tests := []struct {
+		name       string
+		end        error
+		wantReason string
+		wantCancel bool
+	}{
+		{"stalled", os.ErrDeadlineExceeded, groupStalled, true},
+		{"reset", errors.New("stream reset"), groupReset, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+			src := &fakeGroupSource{seq: 1, frames: []string{"a"}, end: tt.end}
+
+			if _, reason := ring.add(src, nil); reason != tt.wantReason {
+				t.Errorf("Expected reason %q, got %q", tt.wantReason, reason)
+			}
+			cache := ring.get(1)
+			if !cache.isComplete() || !cache.isTruncated() {
+				t.Errorf("Expected complete and truncated cache")
+			}
+			if len(cache.frames) != 1 {
+				t.Errorf("Expected frames received before the failure to be kept, got %d", len(cache.frames))
+			}
+			if got := src.canceled != nil; got != tt.wantCancel {
+				t.Errorf("Expected CancelRead called = %v, got %v", tt.wantCancel, got)
+			}
+			if tt.wantCancel && *src.canceled != moqt.ExpiredGroupErrorCode {
+				t.Errorf("Expected ExpiredGroupErrorCode, got %v", *src.canceled)
+			}
+		})
+	}
+}
+
+// TestGroupRingAddStallTimeout tests the per-frame read deadline
+func TestGroupRingAddStallTimeout(t *testing.T) {
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+
+	ring.stallTimeout = 2 * time.Second
+	src := &fakeGroupSource{seq: 1, end: io.EOF}
+	before := time.Now()
+	ring.add(src, nil)
+	if src.deadline.Before(before.Add(ring.stallTimeout)) {
+		t.Errorf("Expected read deadline at least %v ahead, got %v", ring.stallTimeout, src.deadline.Sub(before))
+	}
+
+	ring.stallTimeout = 0
+	src = &fakeGroupSource{seq: 2, end: io.EOF}
+	ring.add(src, nil)
+	if !src.deadline.IsZero() {
+		t.Errorf("Expected no read deadline when disabled, got %v", src.deadline)
+	}
+}
+
+// TestConfigGroupStallTimeout tests the defaulting of the configured timeout
+func TestConfigGroupStallTimeout(t *testing.T) {
+	tests := map[string]struct {
+		config *Config
+		want   time.Duration
+	}{
+		"nil config": {nil, DefaultGroupStallTimeout},
+		"unset":      {&Config{}, DefaultGroupStallTimeout},
+		"set":        {&Config{GroupStallTimeout: time.Second}, time.Second},
+		"disabled":   {&Config{GroupStallTimeout: -1}, 0},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.config.groupStallTimeout(); got != tt.want {
+				t.Errorf("groupStallTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
 }
 
 // TestGroupRingHead tests head position tracking
@@ -135,6 +263,36 @@ func TestGroupRingEarliestAvailable(t *testing.T) {
 	}
 }
 
+// TestGroupRingTrim tests evicting all but the latest groups
+func TestGroupRingTrim(t *testing.T) {
+	ring := newGroupRing(8, DefaultFramePool)
+	for seq := moqt.GroupSequence(1); seq <= 6; seq++ {
+		ring.add(&fakeGroupSource{seq: seq, frames: []string{"x"}, end: io.EOF}, func() {})
+	}
+
+	if evicted := ring.trim(2); evicted != 4 {
+		t.Errorf("Expected 4 evicted groups, got %d", evicted)
+	}
+	if earliest := ring.earliestAvailable(); earliest != 5 {
+		t.Errorf("Expected earliest=5 after trim, got %d", earliest)
+	}
+	if ring.get(4) != nil {
+		t.Error("Expected group 4 to be evicted")
+	}
+	if ring.get(5) == nil || ring.get(6) == nil {
+		t.Error("Expected latest 2 groups to be kept")
+	}
+
+	// Trimming again evicts nothing; new groups are cached as usual.
+	if evicted := ring.trim(2); evicted != 0 {
+		t.Errorf("Expected nothing evicted, got %d", evicted)
+	}
+	ring.add(&fakeGroupSource{seq: 7, frames: []string{"x"}, end: io.EOF}, func() {})
+	if ring.get(7) == nil {
+		t.Error("Expected group 7 to be cached after trim")
+	}
+}
+
 // TestGroupRingGet tests retrieving cached groups
 func TestGroupRingGet(t *testing.T) {
 	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
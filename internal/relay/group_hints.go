@@ -0,0 +1,170 @@
+package relay
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// Publisher group hints.
+//
+// A publisher may describe the groups of a track on its hints track,
+// HintsTrackName(track), e.g. "video.hints": for each group of the track a
+// group with the same sequence holding one JSON frame of GroupHints. The
+// relay does not subscribe to it on its own: it is relayed like any other
+// track, once a subscriber or a downstream relay asks for it. While a
+// track and its hints track are both relayed, the relay keeps the hints
+// with the track's cached groups. With keyframe hints, new subscribers
+// join at the newest keyframe group instead of the newest group, and
+// subscribers that fell behind catch up to one, so neither starts with
+// undecodable frames.
+const hintsTrackSuffix = ".hints"
+
+// maxHintsFrame bounds the size of a hints frame.
+const maxHintsFrame = 64 << 10
+
+// GroupHints is what a publisher tells the relay about one group of a
+// track.
+type GroupHints struct {
+	// Keyframe is set if the group starts with a keyframe, so decoding can
+	// start at it.
+	Keyframe bool `json:"keyframe,omitempty"`
+
+	// Timestamps are the presentation times of the group's frames in
+	// microseconds, in frame order.
+	Timestamps []int64 `json:"timestamps_us,omitempty"`
+
+	// Bitrate is the bitrate the track is encoded at, in bits/s.
+	Bitrate int64 `json:"bitrate,omitempty"`
+}
+
+// HintsTrackName returns the hints track of track.
+func HintsTrackName(track moqt.TrackName) moqt.TrackName {
+	return track + hintsTrackSuffix
+}
+
+// parseHintsTrackName returns the track a hints track describes.
+func parseHintsTrackName(name moqt.TrackName) (moqt.TrackName, bool) {
+	track, ok := strings.CutSuffix(string(name), hintsTrackSuffix)
+	if !ok || track == "" {
+		return "", false
+	}
+	return moqt.TrackName(track), true
+}
+
+// groupHints holds the hints of a track's latest groups.
+type groupHints struct {
+	limit int // groups kept
+
+	mu        sync.Mutex
+	hints     map[moqt.GroupSequence]GroupHints
+	order     []moqt.GroupSequence // oldest first
+	keyframes bool                 // whether the publisher marks keyframes
+}
+
+func newGroupHints(limit int) *groupHints {
+	return &groupHints{
+		limit: max(limit, 1),
+		hints: make(map[moqt.GroupSequence]GroupHints),
+	}
+}
+
+// follow stores the hints relayed by src, the distributor of the track's
+// hints track, as they arrive, until done or src ends.
+func (gh *groupHints) follow(src *trackDistributor, done <-chan struct{}) {
+	notify := src.subscribe()
+	defer src.unsubscribe(notify)
+
+	pos := src.ring.earliestAvailable()
+	for {
+		for head := src.ring.head(); pos <= head; pos++ {
+			cache := src.ring.get(pos)
+			if cache == nil || cache.pos != uint64(pos) {
+				continue // evicted
+			}
+			frame := cache.next(0)
+			if frame == nil {
+				if !cache.isComplete() {
+					break // its frame is yet to come
+				}
+				continue
+			}
+
+			var h GroupHints
+			if len(frame.Body()) > maxHintsFrame || json.Unmarshal(frame.Body(), &h) != nil {
+				src.log().Debug("dropping malformed group hints", "seq", cache.seq)
+				continue
+			}
+			gh.store(cache.seq, h)
+		}
+
+		select {
+		case <-notify:
+		case <-time.After(NotifyTimeout):
+		case <-src.done:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// store records the hints of group seq.
+func (gh *groupHints) store(seq moqt.GroupSequence, h GroupHints) {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+
+	if _, ok := gh.hints[seq]; !ok {
+		gh.order = append(gh.order, seq)
+	}
+	gh.hints[seq] = h
+	gh.keyframes = gh.keyframes || h.Keyframe
+	for len(gh.order) > gh.limit {
+		delete(gh.hints, gh.order[0])
+		gh.order = gh.order[1:]
+	}
+}
+
+// get returns the hints of group seq.
+func (gh *groupHints) get(seq moqt.GroupSequence) (GroupHints, bool) {
+	if gh == nil {
+		return GroupHints{}, false
+	}
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	h, ok := gh.hints[seq]
+	return h, ok
+}
+
+// marksKeyframes reports whether the publisher marks keyframes, so groups
+// hinted otherwise, or not at all, are not safe to start decoding at.
+func (gh *groupHints) marksKeyframes() bool {
+	if gh == nil {
+		return false
+	}
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	return gh.keyframes
+}
+
+// keyframePosition returns the newest ring position at or before pos, and
+// no older than the oldest cached group, whose group the publisher hinted
+// as a keyframe, or false if there is none or keyframes are not hinted.
+func (ring *groupRing) keyframePosition(pos moqt.GroupSequence) (moqt.GroupSequence, bool) {
+	if !ring.hints.marksKeyframes() {
+		return 0, false
+	}
+	for earliest := ring.earliestAvailable(); pos >= earliest && pos > 0; pos-- {
+		cache := ring.get(pos)
+		if cache == nil || cache.pos != uint64(pos) {
+			continue
+		}
+		if h, ok := ring.hints.get(cache.seq); ok && h.Keyframe {
+			return pos, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,110 @@
+package relay
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHintsTrackName(t *testing.T) {
+	assert.Equal(t, moqt.TrackName("video.hints"), HintsTrackName("video"))
+
+	track, ok := parseHintsTrackName("video.hints")
+	require.True(t, ok)
+	assert.Equal(t, moqt.TrackName("video"), track)
+
+	for _, name := range []moqt.TrackName{"video", ".hints", "video.hint"} {
+		_, ok := parseHintsTrackName(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestGroupHints_Store(t *testing.T) {
+	gh := newGroupHints(2)
+	gh.store(1, GroupHints{Keyframe: true})
+	gh.store(2, GroupHints{})
+	gh.store(3, GroupHints{Bitrate: 2_000_000})
+
+	_, found := gh.get(1)
+	assert.False(t, found, "evicted beyond the limit")
+	h, found := gh.get(3)
+	require.True(t, found)
+	assert.Equal(t, int64(2_000_000), h.Bitrate)
+	assert.True(t, gh.marksKeyframes(), "remembered after the keyframe is evicted")
+
+	gh.store(3, GroupHints{Keyframe: true}) // replaced, not hinted again
+	_, found = gh.get(2)
+	assert.True(t, found)
+}
+
+func TestRelayHandler_PairsHints(t *testing.T) {
+	ingest := make(chan struct{})
+	defer close(ingest)
+	h := &RelayHandler{path: "/live"}
+	h.open = func(name moqt.TrackName, _ *moqt.TrackConfig) (*trackDistributor, func()) {
+		ring := newGroupRing(8, DefaultFramePool)
+		ring.hints = newGroupHints(16)
+		return &trackDistributor{
+			path:        "/live",
+			track:       string(name),
+			ring:        ring,
+			subscribers: make(map[chan struct{}]struct{}),
+			done:        ingest,
+		}, nil
+	}
+
+	// The hints track is only relayed once asked for
+	video := h.relay("video", nil)
+	assert.Nil(t, h.distributor("video.hints"))
+
+	hints := h.relay("video.hints", nil)
+	hints.ring.add(&fakeGroupSource{seq: 7, frames: []string{`{"keyframe":true,"bitrate":1000}`}, end: io.EOF}, hints.notify)
+	hints.ring.add(&fakeGroupSource{seq: 8, frames: []string{`not json`}, end: io.EOF}, hints.notify)
+	hints.ring.add(&fakeGroupSource{seq: 9, frames: []string{`{}`}, end: io.EOF}, hints.notify)
+
+	require.Eventually(t, func() bool {
+		_, ok := video.ring.hints.get(9)
+		return ok
+	}, time.Second, time.Millisecond)
+	got, _ := video.ring.hints.get(7)
+	assert.Equal(t, GroupHints{Keyframe: true, Bitrate: 1000}, got)
+	assert.True(t, video.ring.hints.marksKeyframes())
+	_, ok := video.ring.hints.get(8)
+	assert.False(t, ok, "malformed hints are dropped")
+	_, ok = hints.ring.hints.get(7)
+	assert.False(t, ok, "the hints track has no hints of its own")
+}
+
+func TestGroupRing_KeyframeJoin(t *testing.T) {
+	now := time.Now()
+	ring := newGroupRing(8, DefaultFramePool)
+	for seq := moqt.GroupSequence(1); seq <= 6; seq++ {
+		cache, _ := ring.add(&fakeGroupSource{seq: seq, frames: []string{"x"}, end: io.EOF}, nil)
+		cache.createdAt = now.Add(time.Duration(seq-6) * time.Second)
+	}
+
+	ring.hints = newGroupHints(16)
+	ring.hints.store(6, GroupHints{Bitrate: 1000})
+	assert.Equal(t, moqt.GroupSequence(6), ring.startPosition(TimeShift{}, now), "without keyframe hints, join at live")
+
+	ring.hints.store(2, GroupHints{Keyframe: true})
+	ring.hints.store(4, GroupHints{Keyframe: true})
+	assert.Equal(t, moqt.GroupSequence(4), ring.startPosition(TimeShift{}, now), "newest keyframe group")
+	assert.Equal(t, moqt.GroupSequence(2), ring.startPosition(TimeShift{Groups: 3}, now), "shifted, then back to a keyframe")
+
+	pos, ok := ring.keyframePosition(ring.head())
+	require.True(t, ok)
+	assert.Equal(t, moqt.GroupSequence(4), pos)
+
+	ring.trim(2)
+	assert.Equal(t, moqt.GroupSequence(6), ring.startPosition(TimeShift{}, now), "no keyframe group cached")
+
+	groups := ring.list()
+	require.Len(t, groups, 2)
+	assert.Nil(t, groups[0].Hints)
+	assert.Equal(t, &GroupHints{Bitrate: 1000}, groups[1].Hints)
+}
@@ -2,11 +2,16 @@ package relay
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Optimized timeout for best CPU/latency tradeoff (based on benchmarks)
@@ -22,77 +27,450 @@ type RelayHandler struct {
 
 	FramePool *FramePool
 
+	// GroupStallTimeout is how long an upstream group may go without a
+	// frame before it is closed as stalled. Zero disables the timeout;
+	// see DefaultGroupStallTimeout.
+	GroupStallTimeout time.Duration
+
+	// Authorizer is consulted for every incoming subscribe.
+	// If nil, all subscriptions are allowed.
+	Authorizer Authorizer
+
+	// SessionID identifies the publishing session in logs.
+	SessionID string
+
+	// GroupBudgets cap how long the groups of the matching tracks may stay
+	// open.
+	GroupBudgets []GroupBudget
+
+	// EgressWriteTimeout bounds how long one frame write to a subscriber
+	// may block before the subscriber is closed as stuck. Zero disables
+	// the deadline; see DefaultEgressWriteTimeout.
+	EgressWriteTimeout time.Duration
+
+	// FECStripes, if positive, protects the relayed tracks with FEC: each
+	// upstream subscription is paired with one to its parity track, from
+	// which truncated groups are rebuilt. See FECTrackName.
+	FECStripes int
+
+	// FECRecoveryWait is how long a truncated group waits for its parity
+	// before it is passed on truncated; see DefaultFECRecoveryWait.
+	FECRecoveryWait time.Duration
+
+	// Compressed fetches the compressed variant of each relayed track from
+	// the upstream relay, falling back to the plain track if it does not
+	// serve one. See CompressedTrackName.
+	Compressed bool
+
+	// ServeCompressed serves the compressed variant of each track to the
+	// downstream relays asking for it. Otherwise, and if there is no track
+	// to compress, a name ending in the variant's suffix is a track of its
+	// own.
+	ServeCompressed bool
+
+	// Visibility, if set, makes the broadcast private: only the subscribers
+	// it allows are served, before Authorizer is consulted.
+	Visibility *sdn.Visibility
+
+	// Peers are the identities of the relays fetching from this one. They
+	// are served private broadcasts whatever the Visibility, which they
+	// enforce on their own subscribers.
+	Peers []string
+
+	// path is the broadcast path served when there is no Announcement,
+	// as for handlers RemoteFetcher publishes.
+	path moqt.BroadcastPath
+
+	// withdraw ends the publication of a remote handler, when a local
+	// publisher of its path takes precedence; nil for local handlers.
+	withdraw func()
+
+	session *sessionCounters // publisher session summary; nil if disabled
+
+	egressPool *EgressPool // the frame writes of its subscribers; nil writes from their loops
+
+	gate subscriptionGate
+
+	lastActivity atomic.Int64 // unix nanos of the latest subscribe
+
+	// open opens the upstream subscription of a track, without starting
+	// ingest. Nil uses subscribe. Overridden in tests.
+	open func(moqt.TrackName, *moqt.TrackConfig) (*trackDistributor, func())
+
 	mu       sync.RWMutex
 	relaying map[moqt.TrackName]*trackDistributor
+	opening  map[moqt.TrackName]*pendingTrack // upstream subscriptions being opened
+}
+
+// pendingTrack is an upstream subscription being opened. Subscribers
+// asking for the track meanwhile wait for it rather than open their own.
+type pendingTrack struct {
+	done chan struct{} // closed once d is set
+	d    *trackDistributor
 }
 
 func (h *RelayHandler) ServeTrack(tw *moqt.TrackWriter) {
-	logger := slog.With(
-		"broadcast_path", tw.BroadcastPath,
-		"track_name", tw.TrackName,
-	)
+	logger := trackLogger(string(tw.BroadcastPath), string(tw.TrackName), h.SessionID)
 
-	logger.Info("Relay track started")
+	ctx := tw.Context()
+	identity := IdentityFromContext(ctx)
+	if identity != "" {
+		logger = logger.With("client", globalClientStats.hash(identity)) // never log raw identities
+	}
 
-	h.mu.Lock()
-	if h.relaying == nil {
-		h.relaying = make(map[moqt.TrackName]*trackDistributor)
+	hotPathLogs.log(logger, slog.LevelInfo, "Relay track started")
+
+	h.lastActivity.Store(time.Now().UnixNano())
+
+	// A compressed or a time-shifted variant is served from, and
+	// authorized as, the track it carries. So is a parity track, unless
+	// the publisher has a track of that name.
+	name := tw.TrackName
+	protected, stripes, parity := parseFECTrackName(name)
+	var shift TimeShift
+	var compressed bool
+	if !parity {
+		if base, ok := h.compressedSource(name); ok {
+			name, compressed = base, true
+		} else if base, s, ok := parseTimeShiftTrackName(name); ok {
+			name, shift = base, s
+		}
+	}
+
+	if !h.allowsSubscriber(identity) {
+		logger.Info("Subscription denied", "reason", "private broadcast")
+		privateSubscribesDenied.Inc()
+		tw.CloseWithError(moqt.UnauthorizedSubscribeErrorCode)
+		return
 	}
 
-	tr, ok := h.relaying[tw.TrackName]
+	release, ok := h.authorize(tw, name, logger)
 	if !ok {
-		// Start new track distributor
-		tr = h.subscribe(tw.TrackName)
-		if tr == nil {
-			h.mu.Unlock()
-			tw.CloseWithError(moqt.TrackNotFoundErrorCode)
-			logger.Info("Track not found, closing track writer")
+		return
+	}
+	defer func() { release() }()
+
+	tr := h.relay(name, tw.TrackConfig())
+	parity = parity && tr == nil
+	if tr == nil && (compressed || parity) {
+		// No track to compress: the name is a track of its own. No track
+		// of the parity name: serve the parity of the track it protects.
+		release()
+		if compressed {
+			name, compressed = tw.TrackName, false
+		} else {
+			name = protected
+		}
+		if release, ok = h.authorize(tw, name, logger); !ok {
 			return
 		}
+		tr = h.relay(name, tw.TrackConfig())
+	}
+	if tr == nil {
+		tw.CloseWithError(moqt.TrackNotFoundErrorCode)
+		hotPathLogs.log(logger, slog.LevelInfo, "Track not found, closing track writer")
+		return
+	}
+
+	if parity {
+		hotPathLogs.log(logger, slog.LevelInfo, "Sending FEC parity", "stripes", stripes)
+		tr.egressParity(tw, stripes)
+		return
+	}
+
+	if shift != (TimeShift{}) {
+		hotPathLogs.log(logger, slog.LevelInfo, "Relaying track behind live", "groups", shift.Groups, "duration", shift.Duration)
+	} else {
+		hotPathLogs.log(logger, slog.LevelInfo, "Relaying track")
+	}
+
+	tr.egress(tw, shift, compressed)
+}
+
+// authorize admits the subscription of tw to the track name, closing it
+// if it is denied or once its entitlement expires. The returned function
+// releases the admission.
+func (h *RelayHandler) authorize(tw *moqt.TrackWriter, name moqt.TrackName, logger *slog.Logger) (func(), bool) {
+	dec, release, ok := h.gate.admit(tw.Context(), h.Authorizer, SubscribeRequest{
+		Identity:      IdentityFromContext(tw.Context()),
+		BroadcastPath: tw.BroadcastPath,
+		TrackName:     name,
+	})
+	if !ok {
+		logger.Info("Subscription denied", "reason", dec.Reason)
+		tw.CloseWithError(moqt.UnauthorizedSubscribeErrorCode)
+		return nil, false
+	}
+	if dec.ExpiresAt.IsZero() {
+		return release, true
+	}
+	expiry := time.AfterFunc(time.Until(dec.ExpiresAt), func() {
+		logger.Info("Subscription expired")
+		tw.CloseWithError(moqt.UnauthorizedSubscribeErrorCode)
+	})
+	return func() {
+		expiry.Stop()
+		release()
+	}, true
+}
+
+// lastActive returns the time of the latest subscribe, or the zero time.
+func (h *RelayHandler) lastActive() time.Time {
+	if ns := h.lastActivity.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// distributor returns the distributor relaying name, or nil if the track
+// has no active upstream subscription.
+func (h *RelayHandler) distributor(name moqt.TrackName) *trackDistributor {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.relaying[name]
+}
+
+// prefetch starts relaying name before any subscriber asks for it, so its
+// group cache is warm when one does. It reports whether the track is being
+// relayed.
+func (h *RelayHandler) prefetch(name moqt.TrackName) bool {
+	d := h.relay(name, nil)
+	if d == nil {
+		return false
+	}
+	d.prefetchedAt.CompareAndSwap(0, time.Now().UnixNano())
+	return true
+}
+
+// allowsSubscriber reports whether the broadcast may be served to the
+// subscriber authenticated as identity.
+func (h *RelayHandler) allowsSubscriber(identity string) bool {
+	return h.Visibility.AllowsSubscriber(identity) || (identity != "" && slices.Contains(h.Peers, identity))
+}
+
+// compressedSource returns the track a compressed variant name is served
+// from, when the handler serves compressed variants.
+func (h *RelayHandler) compressedSource(name moqt.TrackName) (moqt.TrackName, bool) {
+	if !h.ServeCompressed {
+		return "", false
+	}
+	return parseCompressedTrackName(name)
+}
+
+// relay returns the distributor relaying name, opening the upstream
+// subscription with config if there is none yet, or nil if the track
+// cannot be subscribed to. Concurrent callers for a track share one
+// upstream subscription: the first opens it, without holding h.mu over
+// the round trip, while the others wait for its outcome.
+func (h *RelayHandler) relay(name moqt.TrackName, config *moqt.TrackConfig) *trackDistributor {
+	h.mu.Lock()
+	if d, ok := h.relaying[name]; ok {
+		h.mu.Unlock()
+		return d
+	}
+	if p, ok := h.opening[name]; ok {
+		h.mu.Unlock()
+		upstreamSubscribesShared.Inc()
+		<-p.done
+		return p.d
+	}
+	if h.opening == nil {
+		h.opening = make(map[moqt.TrackName]*pendingTrack)
+	}
+	p := &pendingTrack{done: make(chan struct{})}
+	h.opening[name] = p
+	h.mu.Unlock()
+
+	open := h.open
+	if open == nil {
+		open = h.subscribe
+	}
+	d, start := open(name, config)
+
+	h.mu.Lock()
+	delete(h.opening, name)
+	if d != nil {
+		if h.relaying == nil {
+			h.relaying = make(map[moqt.TrackName]*trackDistributor)
+		}
+		h.relaying[name] = d
+		h.pairHints(name)
 	}
 	h.mu.Unlock()
 
-	logger.Info("Relaying track")
+	p.d = d
+	close(p.done)
+	if start != nil {
+		start() // once relaying, so that onClose finds it there
+	}
+	return d
+}
 
-	tr.egress(tw)
+// pairHints feeds the hints relayed on a hints track to the track it
+// describes once both are relayed, name being the one just relayed.
+// Caller must hold h.mu.
+func (h *RelayHandler) pairHints(name moqt.TrackName) {
+	track, hints := name, HintsTrackName(name)
+	if base, ok := parseHintsTrackName(name); ok {
+		track, hints = base, name
+	}
+	td, ok := h.relaying[track]
+	if !ok {
+		return
+	}
+	hd, ok := h.relaying[hints]
+	if !ok {
+		return
+	}
+	globalGoroutines.goSpawn(GoroutineIngest, td.path+" "+td.track+" hints", func() {
+		td.ring.hints.follow(hd, td.done)
+	})
 }
 
-func (h *RelayHandler) subscribe(name moqt.TrackName) *trackDistributor {
+// releaseIdle closes the upstream subscriptions of the tracks no subscriber
+// is reading, such as prefetched ones. Their distributors stop and leave
+// relaying once ingest sees the close. It returns how many were released.
+func (h *RelayHandler) releaseIdle() int {
+	return h.release(func(_ moqt.TrackName, d *trackDistributor) bool {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		return len(d.subscribers) == 0
+	})
+}
+
+// releasePrefetched releases like releaseIdle the prefetched tracks no
+// subscriber has read for idle as of now, but those keep reports are still
+// to be prefetched.
+func (h *RelayHandler) releasePrefetched(idle time.Duration, now time.Time, keep func(moqt.TrackName) bool) int {
+	return h.release(func(name moqt.TrackName, d *trackDistributor) bool {
+		i := d.idlePrefetch(now)
+		return i > 0 && i >= idle && !keep(name)
+	})
+}
+
+// release closes the upstream subscriptions of the tracks pick selects.
+func (h *RelayHandler) release(pick func(moqt.TrackName, *trackDistributor) bool) int {
+	h.mu.RLock()
+	var idle []*trackDistributor
+	for name, d := range h.relaying {
+		if pick(name, d) {
+			idle = append(idle, d)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, d := range idle {
+		if src := d.source(); src != nil {
+			src.Close()
+		}
+	}
+	return len(idle)
+}
+
+// subscribe opens the upstream subscription for name, initially with the
+// first downstream subscriber's config. It returns the distributor, or nil,
+// and the function starting its ingest.
+func (h *RelayHandler) subscribe(name moqt.TrackName, config *moqt.TrackConfig) (*trackDistributor, func()) {
 	if h.Session == nil {
-		return nil
+		return nil, nil
 	}
 
-	if h.Announcement == nil {
-		return nil
+	path := h.path
+	if h.Announcement != nil {
+		if !h.Announcement.IsActive() {
+			return nil, nil
+		}
+		path = h.Announcement.BroadcastPath()
 	}
-	if !h.Announcement.IsActive() {
-		return nil
+	if path == "" {
+		return nil, nil
 	}
 
-	src, err := h.Session.Subscribe(h.Announcement.BroadcastPath(), name, nil)
+	if config == nil {
+		config = &moqt.TrackConfig{}
+	}
+	logger := trackLogger(string(path), string(name), h.SessionID)
+
+	upstream := name
+	if h.Compressed {
+		upstream = CompressedTrackName(name)
+	}
+	src, err := h.Session.Subscribe(path, upstream, config)
+	if err != nil && h.Compressed {
+		logger.Debug("compressed track refused, fetching it plain", "error", err)
+		upstream = name
+		src, err = h.Session.Subscribe(path, upstream, config)
+	}
 	if err != nil {
-		return nil
+		return nil, nil
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
+	if h.session != nil {
+		h.session.tracks.Add(1)
+	}
+
+	ring := newGroupRing(h.GroupCacheSize, h.FramePool)
+	ring.logger = logger
+	ring.decompress = upstream != name
+	ring.maxGroupDuration = groupBudgets(h.GroupBudgets).lookup(string(path), string(name))
+	ring.hints = newGroupHints(2 * h.GroupCacheSize) // fed by pairHints; hints may arrive before their group
+
+	// Parity and hints tracks are not protected themselves
+	_, _, isParity := parseFECTrackName(name)
+	_, isHints := parseHintsTrackName(name)
+	var parity *moqt.TrackReader
+	if h.FECStripes > 0 && !isParity && !isHints {
+		parity, err = h.Session.Subscribe(path, FECTrackName(name, h.FECStripes), config)
+		if err != nil {
+			logger.Warn("FEC parity subscription failed, relaying unprotected", "error", err)
+		} else {
+			ring.fec = newFECReceiver(h.FECStripes, h.FECRecoveryWait, h.GroupStallTimeout)
+		}
+	}
+
 	d := &trackDistributor{
-		ring:        newGroupRing(h.GroupCacheSize, h.FramePool),
+		path:        string(path),
+		track:       string(name),
+		sessionID:   h.SessionID,
+		session:     h.session,
+		logger:      logger,
+		ring:        ring,
+		egressPool:  h.egressPool,
 		subscribers: make(map[chan struct{}]struct{}),
-		onClose: func() {
-			// Cancel ingestion context
-			cancel()
-
-			// Remove from relaying map
-			h.mu.Lock()
-			delete(h.relaying, name)
-			h.mu.Unlock()
+		priorities:  make(map[chan struct{}]moqt.TrackPriority),
+		upstream:    config.TrackPriority,
+		update:      src.Update,
+		src:         src,
+		done:        ctx.Done(),
+		open: func(p moqt.TrackPriority) (*moqt.TrackReader, error) {
+			return h.Session.Subscribe(path, upstream, &moqt.TrackConfig{TrackPriority: p})
 		},
+		writeTimeout: h.EgressWriteTimeout,
 	}
+	d.onClose = func() {
+		// Cancel ingestion context
+		cancel()
 
-	go d.ingest(ctx, src)
-
-	return d
+		// Remove from relaying map
+		h.mu.Lock()
+		if h.relaying[name] == d {
+			delete(h.relaying, name)
+		}
+		h.mu.Unlock()
+	}
+	d.lastGroup.Store(time.Now().UnixNano())
+	d.ring.stallTimeout = h.GroupStallTimeout
+
+	return d, func() {
+		if parity != nil {
+			globalGoroutines.goSpawn(GoroutineIngest, string(path)+" "+string(name)+" parity", func() {
+				ring.fec.ingest(ctx, parity, logger)
+			})
+		}
+		globalGoroutines.goSpawn(GoroutineIngest, string(path)+" "+string(name), func() { d.ingest(ctx, src) })
+	}
 }
 
 // func newTrackDistributor(src *moqt.TrackReader, cacheSize int, onClose func()) *trackDistributor {
@@ -102,16 +480,49 @@ func (h *RelayHandler) subscribe(name moqt.TrackName) *trackDistributor {
 type trackDistributor struct {
 	// src *moqt.TrackReader
 
+	path, track string // for incomplete group accounting
+
+	sessionID string           // publishing session, for summaries
+	session   *sessionCounters // publishing session counters; may be nil
+	logger    *slog.Logger     // from trackLogger; nil in tests
+
 	ring *groupRing
 
+	egressPool   *EgressPool   // writes the frames of its egress loops; nil in tests
+	writeTimeout time.Duration // of each frame write; 0 for no deadline
+
 	// Broadcast channel pattern: each subscriber gets its own notification channel
 	mu          sync.RWMutex
 	subscribers map[chan struct{}]struct{}
 
+	// priorities holds each subscriber's requested track priority. The
+	// upstream subscription carries the highest of them so a relay never
+	// deprioritizes a track some end client marked important.
+	priorities map[chan struct{}]moqt.TrackPriority
+	upstream   moqt.TrackPriority
+	progress   map[chan struct{}]*egressProgress // each egress's position, for SubscriberLag
+	updateMu   sync.Mutex                        // serializes upstream updates
+	update     func(*moqt.TrackConfig) error     // updates the upstream subscription; nil in tests
+
+	srcMu sync.Mutex
+	src   *moqt.TrackReader                                   // current upstream subscription; nil in tests
+	open  func(moqt.TrackPriority) (*moqt.TrackReader, error) // opens a new one; nil in tests
+
+	lastGroup      atomic.Int64 // unix nanos of the latest upstream group, or of the subscription
+	resubscribedAt atomic.Int64 // unix nanos of the latest resubscribe attempt
+	stale          atomic.Bool  // set by StaleTrackWatchdog until the next group
+
+	egresses     atomic.Int32 // subscribers being served
+	servedAt     atomic.Int64 // unix nanos the latest subscriber stopped being served
+	prefetchedAt atomic.Int64 // unix nanos of the first prefetch; 0 if never prefetched
+
+	done    <-chan struct{} // closed once ingest stops; nil in tests
 	onClose func()
 }
 
-func (d *trackDistributor) egress(tw *moqt.TrackWriter) {
+// egress sends the track to tw, starting shift behind live and
+// zstd-compressing its frames if compressed.
+func (d *trackDistributor) egress(tw *moqt.TrackWriter, shift TimeShift, compressed bool) {
 	// Get track writer context once and check if it's valid
 	twCtx := tw.Context()
 
@@ -119,7 +530,77 @@ func (d *trackDistributor) egress(tw *moqt.TrackWriter) {
 	notify := d.subscribe()
 	defer d.unsubscribe(notify)
 
-	last := d.ring.head()
+	d.setPriority(notify, tw.TrackConfig().TrackPriority)
+	globalGoroutines.goSpawn(GoroutineEgress, d.path+" "+d.track, func() { d.followUpdates(twCtx, notify, tw) })
+
+	d.egresses.Add(1)
+	defer func() {
+		d.servedAt.Store(time.Now().UnixNano())
+		d.egresses.Add(-1)
+	}()
+
+	bp := string(tw.BroadcastPath)
+	globalTrafficStats.addSubscriber(bp)
+	defer globalTrafficStats.removeSubscriber(bp)
+
+	// Bandwidth under the egress cap and egress workers are shared fairly
+	// per track
+	trackKey := bp + " " + string(tw.TrackName)
+	queue := d.egressPool.join(trackKey, d.writeTimeout)
+	defer queue.leave()
+
+	// A downstream relay asked for the track compressed
+	var encoded *moqt.Frame
+	if compressed {
+		encoded = moqt.NewFrame(0)
+	}
+
+	identity := IdentityFromContext(twCtx)
+	client := globalClientStats.acquire(identity)
+	defer client.release()
+
+	var clientHash string
+	if identity != "" {
+		clientHash = globalClientStats.hash(identity)
+	}
+	progress := d.trackProgress(notify, clientHash)
+
+	var sent SummaryRecord
+	if globalSummaries.enabled() {
+		sent = SummaryRecord{
+			Type:          SummarySubscription,
+			SessionID:     d.sessionID,
+			BroadcastPath: bp,
+			TrackName:     string(tw.TrackName),
+			StartedAt:     time.Now(),
+		}
+		if identity != "" {
+			sent.Client = globalClientStats.hash(identity)
+		}
+		defer func() {
+			sent.EndedAt = time.Now()
+			globalSummaries.emit(sent)
+		}()
+	}
+
+	// Lifecycle events share the subscription's identity
+	ev := Event{
+		SessionID:     d.sessionID,
+		BroadcastPath: bp,
+		TrackName:     string(tw.TrackName),
+	}
+	if identity != "" && globalEvents.enabled() {
+		ev.Client = globalClientStats.hash(identity)
+	}
+	globalEvents.emit(ev.with(EventSubscriberJoin))
+	var sentGroups, sentBytes uint64
+	defer func() {
+		leave := ev.with(EventSubscriberLeave)
+		leave.Groups, leave.Bytes = sentGroups, sentBytes
+		globalEvents.emit(leave)
+	}()
+
+	last := d.ring.startPosition(shift, time.Now())
 	if last > 0 {
 		last--
 	}
@@ -135,8 +616,14 @@ func (d *trackDistributor) egress(tw *moqt.TrackWriter) {
 			if last < earliest {
 				// Subscriber fell behind - catchup
 
-				// Skip to latest available
+				// Skip to the latest keyframe group, or the latest available
 				last = latest - 1
+				if pos, ok := d.ring.keyframePosition(latest); ok {
+					last = pos - 1
+				}
+				sent.CatchUps++
+				hotPathLogs.log(d.log(), slog.LevelDebug, "subscriber fell behind, skipping ahead", "seq", last+1)
+				globalEvents.emit(ev.with(EventCatchUp))
 				continue
 			}
 
@@ -145,21 +632,56 @@ func (d *trackDistributor) egress(tw *moqt.TrackWriter) {
 				last--
 				continue
 			}
+			progress.sending.Store(uint64(last))
 
 			gw, err := tw.OpenGroupAt(cache.seq)
 			if err != nil {
 				return
 			}
+			globalTrafficStats.groupsInFlight.Add(1)
+			sent.Groups++
+			sentGroups++
+			closeGroup := func() {
+				if cache.isComplete() && cache.isTruncated() {
+					// Tell the subscriber the group is incomplete
+					gw.CancelWrite(moqt.ExpiredGroupErrorCode)
+					sent.IncompleteGroups++
+				} else {
+					gw.Close()
+				}
+				globalTrafficStats.groupsInFlight.Add(-1)
+			}
 
 			// Incrementally send frames as they become available
 			frameIdx := 0
 			for {
 				frame := cache.next(frameIdx)
 				if frame != nil {
-					if err := gw.WriteFrame(frame); err != nil {
-						gw.Close()
+					if encoded != nil {
+						compressFrame(encoded, frame)
+						frame = encoded
+					}
+					if err := globalEgressLimiter.wait(twCtx, trackKey, frame.Len()); err != nil {
+						closeGroup()
 						return
 					}
+					stuck, err := queue.write(twCtx, gw, frame)
+					if stuck {
+						gw.CancelWrite(moqt.ExpiredGroupErrorCode)
+						globalTrafficStats.groupsInFlight.Add(-1)
+						sent.Stuck = true
+						d.reportStuck(twCtx, ev)
+						tw.CloseWithError(StuckSubscriberErrorCode)
+						return
+					}
+					if err != nil {
+						closeGroup()
+						return
+					}
+					globalTrafficStats.addEgressBytes(frame.Len())
+					client.addEgressBytes(frame.Len())
+					sent.Bytes += uint64(frame.Len())
+					sentBytes += uint64(frame.Len())
 					frameIdx++
 					continue
 				}
@@ -177,12 +699,12 @@ func (d *trackDistributor) egress(tw *moqt.TrackWriter) {
 				case <-time.After(NotifyTimeout):
 					// Poll timeout
 				case <-twCtx.Done():
-					gw.Close()
+					closeGroup()
 					return
 				}
 			}
 
-			gw.Close()
+			closeGroup()
 			continue
 		}
 
@@ -201,9 +723,26 @@ func (d *trackDistributor) egress(tw *moqt.TrackWriter) {
 
 func (d *trackDistributor) close() {
 	// d.src.Close()
+	incompleteGroups.DeletePartialMatch(prometheus.Labels{"broadcast_path": d.path, "track": d.track})
 	d.onClose()
 }
 
+// servedSince reports whether the track served a subscriber at or after t.
+// Prefetched tracks nobody subscribed to were not served.
+func (d *trackDistributor) servedSince(t time.Time) bool {
+	return d.egresses.Load() > 0 || d.servedAt.Load() >= t.UnixNano()
+}
+
+// idlePrefetch returns how long as of now a prefetched track has gone
+// without a subscriber, or 0 if it is not prefetched or is being read.
+func (d *trackDistributor) idlePrefetch(now time.Time) time.Duration {
+	since := d.prefetchedAt.Load()
+	if since == 0 || d.egresses.Load() > 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, max(since, d.servedAt.Load())))
+}
+
 // subscribe registers a new subscriber and returns its notification channel
 func (d *trackDistributor) subscribe() chan struct{} {
 	d.mu.Lock()
@@ -218,8 +757,74 @@ func (d *trackDistributor) subscribe() chan struct{} {
 // unsubscribe removes a subscriber
 func (d *trackDistributor) unsubscribe(ch chan struct{}) {
 	d.mu.Lock()
-	defer d.mu.Unlock()
 	delete(d.subscribers, ch)
+	delete(d.progress, ch)
+	_, hadPriority := d.priorities[ch]
+	delete(d.priorities, ch)
+	d.mu.Unlock()
+
+	if hadPriority {
+		d.reconcilePriority()
+	}
+}
+
+// setPriority records the priority requested by subscriber ch and
+// propagates a changed maximum upstream.
+func (d *trackDistributor) setPriority(ch chan struct{}, p moqt.TrackPriority) {
+	d.mu.Lock()
+	if d.priorities == nil {
+		d.priorities = make(map[chan struct{}]moqt.TrackPriority)
+	}
+	d.priorities[ch] = p
+	d.mu.Unlock()
+
+	d.reconcilePriority()
+}
+
+// followUpdates applies SUBSCRIBE_UPDATE messages from a downstream
+// subscriber until it goes away.
+func (d *trackDistributor) followUpdates(ctx context.Context, ch chan struct{}, tw *moqt.TrackWriter) {
+	for {
+		select {
+		case _, ok := <-tw.Updated():
+			if !ok {
+				return
+			}
+			d.setPriority(ch, tw.TrackConfig().TrackPriority)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reconcilePriority updates the upstream subscription when the highest
+// requested priority changed. With no subscribers left the upstream keeps
+// its last priority.
+func (d *trackDistributor) reconcilePriority() {
+	d.updateMu.Lock()
+	defer d.updateMu.Unlock()
+
+	d.mu.RLock()
+	if len(d.priorities) == 0 {
+		d.mu.RUnlock()
+		return
+	}
+	var want moqt.TrackPriority
+	for _, p := range d.priorities {
+		want = max(want, p)
+	}
+	d.mu.RUnlock()
+
+	if want == d.upstream {
+		return
+	}
+	if d.update != nil {
+		if err := d.update(&moqt.TrackConfig{TrackPriority: want}); err != nil {
+			d.log().Debug("failed to update upstream track priority", "error", err)
+			return
+		}
+	}
+	d.upstream = want
 }
 
 func (d *trackDistributor) ingest(ctx context.Context, src *moqt.TrackReader) {
@@ -228,22 +833,87 @@ func (d *trackDistributor) ingest(ctx context.Context, src *moqt.TrackReader) {
 	for {
 		gr, err := src.AcceptGroup(ctx)
 		if err != nil {
-			slog.Debug("ingest stopped", "error", err)
+			if next := d.source(); next != src && ctx.Err() == nil {
+				src = next // resubscribed; carry on with the new subscription
+				continue
+			}
+			hotPathLogs.log(d.log(), slog.LevelDebug, "ingest stopped", "error", err)
 			return
 		}
 
+		d.lastGroup.Store(time.Now().UnixNano())
+		if d.stale.Swap(false) {
+			d.log().Info("upstream track recovered")
+		}
+
 		// Pass notification callback to ring.add() for frame-level notifications
-		d.ring.add(gr, func() {
-			// Broadcast notification for each frame (RLock only, non-blocking)
-			d.mu.RLock()
-			for ch := range d.subscribers {
-				select {
-				case ch <- struct{}{}:
-				default:
-					// Channel full, subscriber will wake up on timeout
-				}
-			}
-			d.mu.RUnlock()
-		})
+		cache, reason := d.ring.add(gr, d.notify)
+		d.recordGroup(cache, reason)
+	}
+}
+
+// source returns the current upstream subscription.
+func (d *trackDistributor) source() *moqt.TrackReader {
+	d.srcMu.Lock()
+	defer d.srcMu.Unlock()
+	return d.src
+}
+
+// resubscribe replaces the upstream subscription with a new one on the same
+// session, at the current upstream priority. Ingest moves over to it once
+// the old one is closed.
+func (d *trackDistributor) resubscribe() error {
+	d.updateMu.Lock()
+	defer d.updateMu.Unlock()
+
+	if d.open == nil {
+		return errors.New("track has no upstream session")
+	}
+	d.resubscribedAt.Store(time.Now().UnixNano())
+	src, err := d.open(d.upstream)
+	if err != nil {
+		return err
+	}
+	d.update = src.Update
+
+	d.srcMu.Lock()
+	old := d.src
+	d.src = src
+	d.srcMu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// notify wakes every subscriber after a frame arrived.
+func (d *trackDistributor) notify() {
+	// Broadcast notification for each frame (RLock only, non-blocking)
+	d.mu.RLock()
+	for ch := range d.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// Channel full, subscriber will wake up on timeout
+		}
+	}
+	d.mu.RUnlock()
+}
+
+// recordGroup accounts for an ingested group in the publishing session's
+// summary and, if the group was abandoned, in the incomplete group counter.
+func (d *trackDistributor) recordGroup(cache *groupCache, reason string) {
+	if d.session != nil {
+		d.session.groups.Add(1)
+		d.session.bytes.Add(cache.size.Load())
+		if reason != "" {
+			d.session.incomplete.Add(1)
+		}
+	}
+	if reason != "" {
+		incompleteGroups.WithLabelValues(d.path, d.track, reason).Inc()
+		hotPathLogs.log(d.log(), slog.LevelWarn, "upstream group incomplete, skipping",
+			"seq", cache.seq, "reason", reason)
 	}
 }
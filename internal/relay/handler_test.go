@@ -1,6 +1,7 @@
 package relay
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -781,3 +783,190 @@ func TestTrackDistributor_RingBehavior(t *testing.T) {
 		assert.GreaterOrEqual(t, earliest, uint64(0), "Expected earliest to be non-negative")
 	})
 }
+
+// TestTrackDistributor_PriorityAggregation tests that the upstream
+// subscription follows the highest downstream priority
+func TestTrackDistributor_PriorityAggregation(t *testing.T) {
+	var updates []moqt.TrackPriority
+	dist := &trackDistributor{
+		ring:        newGroupRing(DefaultGroupCacheSize, DefaultFramePool),
+		subscribers: make(map[chan struct{}]struct{}),
+		upstream:    1,
+		update: func(c *moqt.TrackConfig) error {
+			updates = append(updates, c.TrackPriority)
+			return nil
+		},
+	}
+
+	ch1 := dist.subscribe()
+	dist.setPriority(ch1, 1)
+	assert.Empty(t, updates, "first subscriber's priority is already upstream")
+
+	ch2 := dist.subscribe()
+	dist.setPriority(ch2, 5)
+	assert.Equal(t, []moqt.TrackPriority{5}, updates)
+
+	// Lower request from another subscriber does not lower upstream
+	ch3 := dist.subscribe()
+	dist.setPriority(ch3, 3)
+	assert.Equal(t, []moqt.TrackPriority{5}, updates)
+
+	// Highest subscriber leaves: fall back to the next highest
+	dist.unsubscribe(ch2)
+	assert.Equal(t, []moqt.TrackPriority{5, 3}, updates)
+
+	// Subscriber update raises priority
+	dist.setPriority(ch1, 7)
+	assert.Equal(t, []moqt.TrackPriority{5, 3, 7}, updates)
+
+	// Last subscribers leave: upstream keeps its priority
+	dist.unsubscribe(ch1)
+	dist.unsubscribe(ch3)
+	assert.Equal(t, []moqt.TrackPriority{5, 3, 7, 3}, updates)
+	assert.Equal(t, moqt.TrackPriority(3), dist.upstream)
+}
+
+func TestTrackDistributor_PriorityUpdateFailure(t *testing.T) {
+	dist := &trackDistributor{
+		subscribers: make(map[chan struct{}]struct{}),
+		update:      func(*moqt.TrackConfig) error { return errors.New("stream closed") },
+	}
+
+	ch := dist.subscribe()
+	dist.setPriority(ch, 4)
+	assert.Equal(t, moqt.TrackPriority(0), dist.upstream, "failed update is retried on next change")
+}
+
+func TestRelayHandler_Prefetch(t *testing.T) {
+	existing := &trackDistributor{subscribers: make(map[chan struct{}]struct{})}
+	h := &RelayHandler{
+		path:     "/live",
+		relaying: map[moqt.TrackName]*trackDistributor{"video": existing},
+	}
+
+	assert.True(t, h.prefetch("video"), "already relayed")
+	assert.Same(t, existing, h.distributor("video"))
+
+	assert.False(t, h.prefetch("audio"), "no upstream session")
+	assert.Nil(t, h.distributor("audio"))
+}
+
+func TestRelayHandler_ReleaseIdle(t *testing.T) {
+	idle := &trackDistributor{subscribers: make(map[chan struct{}]struct{})}
+	busy := &trackDistributor{subscribers: make(map[chan struct{}]struct{})}
+	busy.subscribe()
+	h := &RelayHandler{
+		path:     "/live",
+		relaying: map[moqt.TrackName]*trackDistributor{"video": idle, "audio": busy},
+	}
+
+	assert.Equal(t, 1, h.releaseIdle(), "only tracks without subscribers are released")
+}
+
+func TestRelayHandler_ReleasePrefetched(t *testing.T) {
+	now := time.Now()
+	newDistributor := func(prefetched, served time.Duration, reading bool) *trackDistributor {
+		d := &trackDistributor{subscribers: make(map[chan struct{}]struct{})}
+		if prefetched > 0 {
+			d.prefetchedAt.Store(now.Add(-prefetched).UnixNano())
+		}
+		if served > 0 {
+			d.servedAt.Store(now.Add(-served).UnixNano())
+		}
+		if reading {
+			d.egresses.Store(1)
+		}
+		return d
+	}
+	h := &RelayHandler{
+		path: "/live",
+		relaying: map[moqt.TrackName]*trackDistributor{
+			"idle":     newDistributor(time.Hour, 0, false),
+			"wanted":   newDistributor(time.Hour, 0, false),
+			"recent":   newDistributor(time.Hour, time.Second, false),
+			"reading":  newDistributor(time.Hour, 0, true),
+			"fresh":    newDistributor(time.Second, 0, false),
+			"relayed":  newDistributor(0, 0, false), // opened by a subscriber
+			"unwanted": newDistributor(10*time.Minute, 6*time.Minute, false),
+		},
+	}
+
+	keep := func(name moqt.TrackName) bool { return name == "wanted" }
+	assert.Equal(t, 2, h.releasePrefetched(5*time.Minute, now, keep), "idle and unwanted")
+}
+
+func TestRelayHandler_RelaySharesUpstreamSubscription(t *testing.T) {
+	var opened atomic.Int32
+	var started atomic.Int32
+	release := make(chan struct{})
+	h := &RelayHandler{path: "/live"}
+	h.open = func(name moqt.TrackName, _ *moqt.TrackConfig) (*trackDistributor, func()) {
+		opened.Add(1)
+		<-release // the round trip to the publisher
+		d := &trackDistributor{track: string(name), subscribers: make(map[chan struct{}]struct{})}
+		return d, func() { started.Add(1) }
+	}
+
+	// A thundering herd of subscribers to a track not relayed yet
+	const subscribers = 10
+	before := testutil.ToFloat64(upstreamSubscribesShared)
+	got := make([]*trackDistributor, subscribers)
+	var wg sync.WaitGroup
+	for i := range subscribers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = h.relay("video", nil)
+		}()
+	}
+
+	// Other tracks are not held up meanwhile
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(upstreamSubscribesShared) == before+subscribers-1
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, h.distributor("audio"))
+
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), opened.Load(), "one upstream subscription")
+	assert.Equal(t, int32(1), started.Load())
+	for _, d := range got {
+		assert.Same(t, h.distributor("video"), d)
+	}
+
+	// Later subscribers get the distributor without waiting
+	assert.Same(t, got[0], h.relay("video", nil))
+	assert.Equal(t, int32(1), opened.Load())
+}
+
+func TestRelayHandler_RelayFailureIsShared(t *testing.T) {
+	var opened atomic.Int32
+	release := make(chan struct{})
+	h := &RelayHandler{path: "/live"}
+	h.open = func(moqt.TrackName, *moqt.TrackConfig) (*trackDistributor, func()) {
+		opened.Add(1)
+		<-release
+		return nil, nil
+	}
+
+	before := testutil.ToFloat64(upstreamSubscribesShared)
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, h.relay("video", nil))
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(upstreamSubscribesShared) == before+2
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), opened.Load())
+
+	// The next subscriber tries again
+	assert.Nil(t, h.relay("video", nil))
+	assert.Equal(t, int32(2), opened.Load())
+}
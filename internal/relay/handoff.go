@@ -0,0 +1,417 @@
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/okdaichi/gomoqt/quic"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// Live handoff lets a new relay process take over the UDP socket of a
+// running one without dropping its sessions. Every process in the chain has
+// a generation, which it encodes in the first byte of the QUIC connection
+// IDs it issues. The newest process reads the socket; packets addressed to a
+// connection ID of another generation are forwarded over a unix socket pair
+// to the process it took over from, which serves them while its sessions
+// drain and forwards older generations in turn. New connections always land
+// on the newest process.
+
+// ErrHandoffUnsupported is returned by Handoff on platforms that cannot pass
+// sockets to a child process.
+var ErrHandoffUnsupported = errors.New("relay: live handoff is not supported on this platform")
+
+// ErrHandedOff is returned by Handoff when the listener already handed its
+// socket to a newer process.
+var ErrHandedOff = errors.New("relay: listener already handed off")
+
+// handoffEnv carries the generation of a process started by Handoff.
+const handoffEnv = "QUMO_HANDOFF"
+
+// handoffCIDLen is the length of the connection IDs every generation
+// issues; short header packets do not carry it.
+const handoffCIDLen = 8
+
+// HandoffListener owns the relay's UDP socket and QUIC transport so the
+// socket can be handed to a new process with Handoff. Its ListenFunc goes
+// into Server.ListenFunc or VirtualHosts.ListenFunc.
+type HandoffListener struct {
+	gen   byte
+	udp   *net.UDPConn
+	conn  *handoffConn
+	tr    *quicgo.Transport
+	ready *os.File // signals the process that started this one; nil if none
+
+	mu        sync.Mutex
+	handedOff bool
+}
+
+// Generation returns the listener's position in the handoff chain, starting
+// at 0 for a process that opened the socket itself.
+func (h *HandoffListener) Generation() int {
+	return int(h.gen)
+}
+
+// Addr returns the address of the UDP socket.
+func (h *HandoffListener) Addr() net.Addr {
+	return h.udp.LocalAddr()
+}
+
+// Tune applies t to the UDP socket. Call it before ListenFunc.
+func (h *HandoffListener) Tune(t UDPTuning) {
+	tuneUDP(h.udp, t)
+}
+
+// newHandoffListener serves QUIC on udp as generation gen, forwarding the
+// packets of older generations to older if it is not nil.
+func newHandoffListener(gen byte, udp *net.UDPConn, older *net.UnixConn, ready *os.File) *HandoffListener {
+	conn := &handoffConn{
+		gen:   gen,
+		udp:   udp,
+		older: older,
+		in:    make(chan handoffPacket, 1024),
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	go conn.readUDP()
+
+	return &HandoffListener{
+		gen:   gen,
+		udp:   udp,
+		conn:  conn,
+		ready: ready,
+		tr: &quicgo.Transport{
+			Conn:                  conn,
+			ConnectionIDGenerator: handoffCIDGenerator{gen: gen},
+			ConnContext:           quicConnContext,
+		},
+	}
+}
+
+// ListenFunc implements quic.ListenAddrFunc over the listener's socket; the
+// address is ignored. Once listening, it tells the process that started
+// this one to stop reading the socket.
+func (h *HandoffListener) ListenFunc(_ string, tlsConfig *tls.Config, quicConfig *quic.Config) (quic.Listener, error) {
+	ln, err := h.tr.ListenEarly(tlsConfig, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	if h.ready != nil {
+		h.ready.Write([]byte{1})
+		h.ready.Close()
+		h.ready = nil
+	}
+	return &handoffQUICListener{ln: ln}, nil
+}
+
+// takeOver makes newer, connected to the process that took the socket over,
+// the only packet source: the listener stops reading the UDP socket.
+func (h *HandoffListener) takeOver(newer *net.UnixConn) {
+	go h.conn.readForwarded(newer)
+	h.conn.stopUDP()
+}
+
+// handoffCIDGenerator issues connection IDs tagged with a generation.
+type handoffCIDGenerator struct {
+	gen byte
+}
+
+func (g handoffCIDGenerator) GenerateConnectionID() (quicgo.ConnectionID, error) {
+	b := make([]byte, handoffCIDLen)
+	b[0] = g.gen
+	if _, err := rand.Read(b[1:]); err != nil {
+		return quicgo.ConnectionID{}, err
+	}
+	return quicgo.ConnectionIDFromBytes(b), nil
+}
+
+func (g handoffCIDGenerator) ConnectionIDLen() int {
+	return handoffCIDLen
+}
+
+// packetGeneration returns the generation a QUIC packet is addressed to,
+// or false for packets any generation may take: Initial and 0-RTT packets,
+// whose destination connection ID the client picked, and anything that does
+// not parse.
+func packetGeneration(p []byte) (byte, bool) {
+	if len(p) == 0 {
+		return 0, false
+	}
+	if p[0]&0x80 == 0 { // short header: the connection ID follows the first byte
+		if len(p) < 1+handoffCIDLen {
+			return 0, false
+		}
+		return p[1], true
+	}
+	// Long header: only Handshake packets carry a connection ID we issued
+	const handshake = 2
+	if len(p) < 6 || (p[0]&0x30)>>4 != handshake {
+		return 0, false
+	}
+	if n := int(p[5]); n != handoffCIDLen || len(p) < 6+n {
+		return 0, false
+	}
+	return p[6], true
+}
+
+// handoffPacket is a datagram queued for quic-go.
+type handoffPacket struct {
+	data []byte
+	addr netip.AddrPort
+}
+
+// handoffConn is the net.PacketConn quic-go uses. Reads come from the UDP
+// socket, or after a handoff from the newer process; packets of other
+// generations are passed on to the older process. Writes always go to the
+// UDP socket, which every generation shares.
+type handoffConn struct {
+	gen   byte
+	udp   *net.UDPConn
+	older *net.UnixConn // nil for generation 0 of the chain
+
+	in       chan handoffPacket
+	wake     chan struct{} // read deadline changed
+	done     chan struct{}
+	closeOne sync.Once
+	deadline atomic.Int64 // unix nanos; 0 is none
+	stopped  atomic.Bool  // no longer reading the UDP socket
+}
+
+func (c *handoffConn) readUDP() {
+	buf := make([]byte, 64<<10)
+	for {
+		n, addr, err := c.udp.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if c.stopped.Load() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		c.route(buf[:n], addr)
+	}
+}
+
+// readForwarded reads the packets a newer process forwarded over newer.
+func (c *handoffConn) readForwarded(newer *net.UnixConn) {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := newer.Read(buf)
+		if err != nil {
+			return
+		}
+		var addr netip.AddrPort
+		if n < 1 || n < 1+int(buf[0]) || addr.UnmarshalBinary(buf[1:1+buf[0]]) != nil {
+			continue
+		}
+		c.route(buf[1+buf[0]:n], addr)
+	}
+}
+
+// route forwards p to the older process if it belongs to another
+// generation, or queues it for quic-go.
+func (c *handoffConn) route(p []byte, addr netip.AddrPort) {
+	if gen, ok := packetGeneration(p); ok && gen != c.gen && c.older != nil {
+		a, _ := addr.MarshalBinary()
+		msg := make([]byte, 0, 1+len(a)+len(p))
+		msg = append(msg, byte(len(a)))
+		msg = append(msg, a...)
+		msg = append(msg, p...)
+		c.older.Write(msg) // the older process may be gone; the packet is lost either way
+		return
+	}
+
+	select {
+	case c.in <- handoffPacket{data: append([]byte(nil), p...), addr: addr}:
+	default: // quic-go is not keeping up; drop like a full socket buffer would
+	}
+}
+
+func (c *handoffConn) stopUDP() {
+	c.stopped.Store(true)
+	c.udp.SetReadDeadline(time.Now())
+}
+
+func (c *handoffConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		var timeout <-chan time.Time
+		if dl := c.deadline.Load(); dl != 0 {
+			d := time.Until(time.Unix(0, dl))
+			if d <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timeout = time.After(d)
+		}
+
+		select {
+		case p := <-c.in:
+			return copy(b, p.data), net.UDPAddrFromAddrPort(p.addr), nil
+		case <-c.done:
+			return 0, nil, net.ErrClosed
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-c.wake:
+		}
+	}
+}
+
+func (c *handoffConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.udp.WriteTo(b, addr)
+}
+
+// Close stops reads; the UDP socket stays open for the other generations.
+func (c *handoffConn) Close() error {
+	c.closeOne.Do(func() { close(c.done) })
+	return nil
+}
+
+func (c *handoffConn) LocalAddr() net.Addr {
+	return c.udp.LocalAddr()
+}
+
+func (c *handoffConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.udp.SetWriteDeadline(t)
+}
+
+func (c *handoffConn) SetReadDeadline(t time.Time) error {
+	var ns int64
+	if !t.IsZero() {
+		ns = t.UnixNano()
+	}
+	c.deadline.Store(ns)
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *handoffConn) SetWriteDeadline(t time.Time) error {
+	return c.udp.SetWriteDeadline(t)
+}
+
+// handoffQUICListener adapts a quic-go listener to gomoqt. Closing it stops
+// accepting connections but leaves the transport, and so the established
+// connections, running.
+type handoffQUICListener struct {
+	ln *quicgo.EarlyListener
+}
+
+func (l *handoffQUICListener) Accept(ctx context.Context) (quic.Connection, error) {
+	conn, err := l.ln.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bindQUICConn(conn)
+	return &handoffQUICConn{conn: conn}, nil
+}
+
+func (l *handoffQUICListener) Addr() net.Addr { return l.ln.Addr() }
+func (l *handoffQUICListener) Close() error   { return l.ln.Close() }
+
+// handoffQUICConn adapts a quic-go connection to gomoqt. Unwrap lets the
+// WebTransport server take over HTTP/3 connections.
+type handoffQUICConn struct {
+	conn *quicgo.Conn
+}
+
+func (c *handoffQUICConn) Unwrap() *quicgo.Conn { return c.conn }
+
+func (c *handoffQUICConn) AcceptStream(ctx context.Context) (quic.Stream, error) {
+	s, err := c.conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &handoffStream{s}, nil
+}
+
+func (c *handoffQUICConn) AcceptUniStream(ctx context.Context) (quic.ReceiveStream, error) {
+	s, err := c.conn.AcceptUniStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &handoffReceiveStream{s}, nil
+}
+
+func (c *handoffQUICConn) CloseWithError(code quic.ApplicationErrorCode, msg string) error {
+	return c.conn.CloseWithError(code, msg)
+}
+
+func (c *handoffQUICConn) ConnectionState() quic.ConnectionState { return c.conn.ConnectionState() }
+func (c *handoffQUICConn) Context() context.Context              { return c.conn.Context() }
+func (c *handoffQUICConn) LocalAddr() net.Addr                   { return c.conn.LocalAddr() }
+func (c *handoffQUICConn) RemoteAddr() net.Addr                  { return c.conn.RemoteAddr() }
+
+func (c *handoffQUICConn) OpenStream() (quic.Stream, error) {
+	s, err := c.conn.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	return &handoffStream{s}, nil
+}
+
+func (c *handoffQUICConn) OpenStreamSync(ctx context.Context) (quic.Stream, error) {
+	s, err := c.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &handoffStream{s}, nil
+}
+
+func (c *handoffQUICConn) OpenUniStream() (quic.SendStream, error) {
+	s, err := c.conn.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	return &handoffSendStream{s}, nil
+}
+
+func (c *handoffQUICConn) OpenUniStreamSync(ctx context.Context) (quic.SendStream, error) {
+	s, err := c.conn.OpenUniStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &handoffSendStream{s}, nil
+}
+
+// Stream wrappers bridge quic-go stream types to gomoqt quic types.
+
+type handoffStream struct {
+	stream *quicgo.Stream
+}
+
+func (s *handoffStream) Read(b []byte) (int, error)         { return s.stream.Read(b) }
+func (s *handoffStream) Write(b []byte) (int, error)        { return s.stream.Write(b) }
+func (s *handoffStream) Close() error                       { return s.stream.Close() }
+func (s *handoffStream) Context() context.Context           { return s.stream.Context() }
+func (s *handoffStream) CancelRead(c quic.StreamErrorCode)  { s.stream.CancelRead(c) }
+func (s *handoffStream) CancelWrite(c quic.StreamErrorCode) { s.stream.CancelWrite(c) }
+func (s *handoffStream) SetDeadline(t time.Time) error      { return s.stream.SetDeadline(t) }
+func (s *handoffStream) SetReadDeadline(t time.Time) error  { return s.stream.SetReadDeadline(t) }
+func (s *handoffStream) SetWriteDeadline(t time.Time) error { return s.stream.SetWriteDeadline(t) }
+
+type handoffReceiveStream struct {
+	stream *quicgo.ReceiveStream
+}
+
+func (s *handoffReceiveStream) Read(b []byte) (int, error)        { return s.stream.Read(b) }
+func (s *handoffReceiveStream) CancelRead(c quic.StreamErrorCode) { s.stream.CancelRead(c) }
+func (s *handoffReceiveStream) SetReadDeadline(t time.Time) error { return s.stream.SetReadDeadline(t) }
+
+type handoffSendStream struct {
+	stream *quicgo.SendStream
+}
+
+func (s *handoffSendStream) Write(b []byte) (int, error)        { return s.stream.Write(b) }
+func (s *handoffSendStream) Close() error                       { return s.stream.Close() }
+func (s *handoffSendStream) Context() context.Context           { return s.stream.Context() }
+func (s *handoffSendStream) CancelWrite(c quic.StreamErrorCode) { s.stream.CancelWrite(c) }
+func (s *handoffSendStream) SetWriteDeadline(t time.Time) error { return s.stream.SetWriteDeadline(t) }
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package relay
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+)
+
+// ListenHandoff returns the listener for addr. Without handoff support it
+// always opens the socket itself.
+func ListenHandoff(addr string) (*HandoffListener, []*os.File, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	udp, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newHandoffListener(0, udp, nil, nil), nil, nil
+}
+
+// Handoff is not supported on this platform.
+func (h *HandoffListener) Handoff(ctx context.Context, binary string, args []string, extra ...syscall.Conn) (int, error) {
+	return 0, ErrHandoffUnsupported
+}
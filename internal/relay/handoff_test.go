@@ -0,0 +1,235 @@
+//go:build unix
+
+package relay
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/quic"
+	quicgo "github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip sends msg on a new stream of client and reads it from the
+// matching server connection.
+func roundTrip(t *testing.T, client *quicgo.Conn, server quic.Connection, msg string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	s, err := client.OpenStreamSync(ctx)
+	require.NoError(t, err)
+	_, err = s.Write([]byte(msg))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	got, err := server.AcceptStream(ctx)
+	require.NoError(t, err)
+	b, err := io.ReadAll(got)
+	require.NoError(t, err)
+	assert.Equal(t, msg, string(b))
+}
+
+func TestHandoffListener_TakeOver(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer udp.Close()
+	addr := udp.LocalAddr().String()
+
+	old := newHandoffListener(0, udp, nil, nil)
+	oldLn, err := old.ListenFunc(addr, serverTLS, &quic.Config{})
+	require.NoError(t, err)
+	defer oldLn.Close()
+
+	before, err := quicgo.DialAddr(ctx, addr, clientTLS, nil)
+	require.NoError(t, err)
+	defer before.CloseWithError(0, "")
+	beforeSrv, err := oldLn.Accept(ctx)
+	require.NoError(t, err)
+	roundTrip(t, before, beforeSrv, "before")
+
+	// Hand the socket over as Handoff would, within this process
+	newer, theirs, err := handoffSocketPair()
+	require.NoError(t, err)
+	c, err := net.FileConn(theirs)
+	theirs.Close()
+	require.NoError(t, err)
+	f, err := udp.File()
+	require.NoError(t, err)
+	pc, err := net.FilePacketConn(f)
+	f.Close()
+	require.NoError(t, err)
+	defer pc.Close()
+
+	next := newHandoffListener(1, pc.(*net.UDPConn), c.(*net.UnixConn), nil)
+	nextLn, err := next.ListenFunc(addr, serverTLS, &quic.Config{})
+	require.NoError(t, err)
+	defer nextLn.Close()
+	old.takeOver(newer)
+
+	// Established connections stay on the old generation
+	roundTrip(t, before, beforeSrv, "after")
+
+	// New connections land on the new one
+	after, err := quicgo.DialAddr(ctx, addr, clientTLS, nil)
+	require.NoError(t, err)
+	defer after.CloseWithError(0, "")
+	afterSrv, err := nextLn.Accept(ctx)
+	require.NoError(t, err)
+	roundTrip(t, after, afterSrv, "new")
+}
+
+// handoffChildEnv makes TestHandoffChild act as the process started by
+// Handoff.
+const handoffChildEnv = "QUMO_HANDOFF_TEST_CHILD"
+
+// TestHandoffChild takes over the socket, echoes one stream of the first
+// connection it accepts and exits.
+func TestHandoffChild(t *testing.T) {
+	if os.Getenv(handoffChildEnv) == "" {
+		t.Skip("run by TestHandoffListener_Handoff")
+	}
+	serverTLS, _ := testTLS(t)
+	h, extra, err := ListenHandoff("")
+	require.NoError(t, err)
+	require.Len(t, extra, 1)
+	require.Equal(t, 1, h.Generation())
+
+	ln, err := h.ListenFunc("", serverTLS, &quic.Config{})
+	require.NoError(t, err)
+	conn, err := ln.Accept(t.Context())
+	require.NoError(t, err)
+	s, err := conn.AcceptStream(t.Context())
+	require.NoError(t, err)
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	_, err = s.Write(b)
+	require.NoError(t, err)
+	s.Close()
+	<-conn.Context().Done()
+}
+
+func TestHandoffListener_Handoff(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	h, _, err := ListenHandoff("127.0.0.1:0")
+	require.NoError(t, err)
+	defer h.udp.Close()
+	addr := h.Addr().String()
+	ln, err := h.ListenFunc(addr, serverTLS, &quic.Config{})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	before, err := quicgo.DialAddr(ctx, addr, clientTLS, nil)
+	require.NoError(t, err)
+	defer before.CloseWithError(0, "")
+	beforeSrv, err := ln.Accept(ctx)
+	require.NoError(t, err)
+
+	tcp, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer tcp.Close()
+
+	t.Setenv(handoffChildEnv, "1")
+	pid, err := h.Handoff(ctx, os.Args[0], []string{"-test.run=^TestHandoffChild$"}, tcp)
+	require.NoError(t, err)
+	assert.NotZero(t, pid)
+
+	_, err = h.Handoff(ctx, os.Args[0], nil)
+	assert.ErrorIs(t, err, ErrHandedOff)
+
+	// The old connection is still served here
+	roundTrip(t, before, beforeSrv, "old")
+
+	// A new connection is served by the child
+	clientTLS = clientTLS.Clone()
+	clientTLS.InsecureSkipVerify = true
+	after, err := quicgo.DialAddr(ctx, addr, clientTLS, nil)
+	require.NoError(t, err)
+	defer after.CloseWithError(0, "")
+	s, err := after.OpenStreamSync(ctx)
+	require.NoError(t, err)
+	_, err = s.Write([]byte("new"))
+	require.NoError(t, err)
+	s.Close()
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(b))
+}
+
+func TestHandoffListener_HandoffTwice(t *testing.T) {
+	h, _, err := ListenHandoff("127.0.0.1:0")
+	require.NoError(t, err)
+	defer h.udp.Close()
+	assert.Zero(t, h.Generation())
+
+	h.handedOff = true
+	_, err = h.Handoff(t.Context(), "/nonexistent", nil)
+	assert.ErrorIs(t, err, ErrHandedOff)
+}
+
+func TestHandoffListener_HandoffFails(t *testing.T) {
+	h, _, err := ListenHandoff("127.0.0.1:0")
+	require.NoError(t, err)
+	defer h.udp.Close()
+
+	// A process that exits without listening leaves the listener as it was
+	_, err = h.Handoff(t.Context(), "/bin/sh", []string{"-c", "exit 0"})
+	assert.Error(t, err)
+	assert.False(t, h.handedOff)
+	assert.False(t, h.conn.stopped.Load())
+}
+
+func TestPacketGeneration(t *testing.T) {
+	cid := []byte{7, 1, 2, 3, 4, 5, 6, 8}
+	short := append([]byte{0x40}, cid...)
+	handshake := append([]byte{0xe0, 0, 0, 0, 1, handoffCIDLen}, cid...)
+	initial := append([]byte{0xc0, 0, 0, 0, 1, handoffCIDLen}, cid...)
+	foreign := append([]byte{0xe0, 0, 0, 0, 1, 4}, cid[:4]...)
+
+	tests := []struct {
+		name   string
+		packet []byte
+		gen    byte
+		ok     bool
+	}{
+		{"short header", short, 7, true},
+		{"handshake", handshake, 7, true},
+		{"initial stays local", initial, 0, false},
+		{"foreign connection ID length", foreign, 0, false},
+		{"truncated", short[:4], 0, false},
+		{"empty", nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, ok := packetGeneration(tt.packet)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.gen, gen)
+		})
+	}
+}
+
+func TestHandoffCIDGenerator(t *testing.T) {
+	g := handoffCIDGenerator{gen: 3}
+	a, err := g.GenerateConnectionID()
+	require.NoError(t, err)
+	b, err := g.GenerateConnectionID()
+	require.NoError(t, err)
+
+	assert.Equal(t, handoffCIDLen, g.ConnectionIDLen())
+	assert.Equal(t, handoffCIDLen, a.Len())
+	assert.Equal(t, byte(3), a.Bytes()[0])
+	assert.NotEqual(t, a, b)
+}
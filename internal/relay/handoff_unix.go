@@ -0,0 +1,245 @@
+//go:build unix
+
+package relay
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Files passed to a process started by Handoff: its end of the handoff
+// socket pair and the readiness pipe. The sockets themselves follow over the
+// socket pair, because passing them as files would switch them to blocking
+// mode in this process as well.
+const (
+	handoffFdOlder = 3 + iota
+	handoffFdReady
+)
+
+// ListenHandoff returns the listener for addr. In a process started by
+// Handoff it takes over the socket of the previous process, along with the
+// extra sockets that process passed on, as files, and addr is ignored;
+// otherwise it opens the socket itself.
+func ListenHandoff(addr string) (*HandoffListener, []*os.File, error) {
+	env := os.Getenv(handoffEnv)
+	if env == "" {
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		udp, err := net.ListenUDP("udp", udpAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newHandoffListener(0, udp, nil, nil), nil, nil
+	}
+	os.Unsetenv(handoffEnv)
+
+	gen, err := strconv.ParseUint(env, 10, 8)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s %q: %w", handoffEnv, env, err)
+	}
+
+	olderFile := os.NewFile(handoffFdOlder, "handoff-older")
+	c, err := net.FileConn(olderFile)
+	olderFile.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("inherit handoff socket: %w", err)
+	}
+	older, ok := c.(*net.UnixConn)
+	if !ok {
+		c.Close()
+		return nil, nil, errors.New("inherited handoff socket is not a unix socket")
+	}
+
+	files, err := receiveHandoffFiles(older)
+	if err != nil {
+		older.Close()
+		return nil, nil, fmt.Errorf("receive sockets: %w", err)
+	}
+	pc, err := net.FilePacketConn(files[0])
+	files[0].Close()
+	if err != nil {
+		older.Close()
+		return nil, nil, fmt.Errorf("inherit UDP socket: %w", err)
+	}
+	udp, ok := pc.(*net.UDPConn)
+	if !ok {
+		pc.Close()
+		older.Close()
+		return nil, nil, errors.New("inherited socket is not UDP")
+	}
+
+	ready := os.NewFile(handoffFdReady, "handoff-ready")
+	return newHandoffListener(byte(gen), udp, older, ready), files[1:], nil
+}
+
+// Handoff starts binary with args as the next generation, passing it the
+// UDP socket and extra, and returns its pid once it listens. From then on
+// the new process accepts every new connection, and this listener only
+// serves the connections it already has, which the caller should drain. If
+// the new process fails to start listening, or ctx ends first, it is killed
+// and the listener keeps serving as before.
+func (h *HandoffListener) Handoff(ctx context.Context, binary string, args []string, extra ...syscall.Conn) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.handedOff {
+		return 0, ErrHandedOff
+	}
+	if h.gen == 255 {
+		return 0, errors.New("relay: handoff generations exhausted")
+	}
+
+	newer, theirs, err := handoffSocketPair()
+	if err != nil {
+		return 0, fmt.Errorf("handoff socket pair: %w", err)
+	}
+	defer theirs.Close()
+	if err := sendHandoffFiles(newer, append([]syscall.Conn{h.udp}, extra...)); err != nil {
+		newer.Close()
+		return 0, fmt.Errorf("send sockets: %w", err)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		newer.Close()
+		return 0, err
+	}
+	defer readyR.Close()
+
+	env := make([]string, 0, len(os.Environ())+1)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, handoffEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, fmt.Sprintf("%s=%d", handoffEnv, h.gen+1))
+
+	cmd := exec.Command(binary, args...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{theirs, readyW}
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		newer.Close()
+		return 0, err
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(readyR, make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		newer.Close()
+		return 0, fmt.Errorf("new process did not start listening: %w", err)
+	}
+	go cmd.Wait()
+
+	h.handedOff = true
+	h.takeOver(newer)
+	return cmd.Process.Pid, nil
+}
+
+// sendHandoffFiles sends duplicates of the descriptors of conns over c.
+func sendHandoffFiles(c *net.UnixConn, conns []syscall.Conn) error {
+	fds := make([]int, 0, len(conns))
+	defer func() {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+	}()
+	for _, conn := range conns {
+		raw, err := conn.SyscallConn()
+		if err != nil {
+			return err
+		}
+		var dupErr error
+		err = raw.Control(func(fd uintptr) {
+			syscall.ForkLock.RLock()
+			defer syscall.ForkLock.RUnlock()
+			var nfd int
+			if nfd, dupErr = syscall.Dup(int(fd)); dupErr == nil {
+				syscall.CloseOnExec(nfd)
+				fds = append(fds, nfd)
+			}
+		})
+		if err = cmp.Or(err, dupErr); err != nil {
+			return err
+		}
+	}
+	_, _, err := c.WriteMsgUnix([]byte("qumo-handoff"), syscall.UnixRights(fds...), nil)
+	return err
+}
+
+// receiveHandoffFiles receives the descriptors sent by sendHandoffFiles.
+func receiveHandoffFiles(c *net.UnixConn) ([]*os.File, error) {
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer c.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, 64)
+	oob := make([]byte, syscall.CmsgSpace(16*4))
+	_, oobn, _, _, err := c.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	var files []*os.File
+	for _, m := range msgs {
+		fds, err := syscall.ParseUnixRights(&m)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			syscall.CloseOnExec(fd)
+			files = append(files, os.NewFile(uintptr(fd), "handoff-"+strconv.Itoa(len(files))))
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no sockets received")
+	}
+	return files, nil
+}
+
+// handoffSocketPair returns the two ends of a datagram socket pair
+// connecting a process to the one taking over from it: the connection it
+// reads forwarded packets from, and the file to pass to the new process.
+func handoffSocketPair() (*net.UnixConn, *os.File, error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	syscall.CloseOnExec(fds[0])
+	syscall.CloseOnExec(fds[1])
+	ours := os.NewFile(uintptr(fds[0]), "handoff-newer")
+	theirs := os.NewFile(uintptr(fds[1]), "handoff-older")
+
+	c, err := net.FileConn(ours)
+	ours.Close()
+	if err != nil {
+		theirs.Close()
+		return nil, nil, err
+	}
+	return c.(*net.UnixConn), theirs, nil
+}
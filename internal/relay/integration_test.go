@@ -0,0 +1,340 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/gomoqt/quic"
+	"github.com/okdaichi/qumo/internal/netsim"
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/okdaichi/qumo/internal/topology"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Integration tests: in-process relays and clients talking QUIC over
+// loopback, with the links under test running through netsim proxies.
+// The proxies are seeded, so a link drops the same datagrams on every run;
+// the assertions leave room for the scheduler's timing.
+
+// testMesh starts relays and the proxies between them, all stopped with
+// the test.
+type testMesh struct {
+	t                    *testing.T
+	ctx                  context.Context
+	serverTLS, clientTLS *tls.Config
+	client               *moqt.Client
+}
+
+func newTestMesh(t *testing.T) *testMesh {
+	if raceEnabled {
+		t.Skip("gomoqt sessions race on their track readers and writers")
+	}
+	serverTLS, clientTLS := testTLS(t)
+	serverTLS.NextProtos, clientTLS.NextProtos = []string{moqt.NextProtoMOQ}, []string{moqt.NextProtoMOQ}
+	client := &moqt.Client{TLSConfig: clientTLS, QUICConfig: &quic.Config{EnableDatagrams: true}}
+	t.Cleanup(func() { client.Close() })
+	return &testMesh{t: t, ctx: t.Context(), serverTLS: serverTLS, clientTLS: clientTLS, client: client}
+}
+
+// relay starts a relay with config and, if fetcher is set, fetching
+// remote broadcasts with it. It returns the relay's address.
+func (m *testMesh) relay(config *Config, fetcher *RemoteFetcher) string {
+	addr := freeUDPAddr(m.t)
+	server := &Server{
+		Addr:       addr,
+		TLSConfig:  m.serverTLS,
+		QUICConfig: &quic.Config{EnableDatagrams: true},
+		Config:     config,
+		TrackMux:   moqt.NewTrackMux(),
+	}
+	go server.ListenAndServe()
+	m.t.Cleanup(func() {
+		// gomoqt's Server.Close may miss its listener's exit and wait for
+		// it forever; the test is over either way
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			server.Close()
+		}()
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	if fetcher != nil {
+		fetcher.TrackMux = server.TrackMux
+		fetcher.TLSConfig = m.clientTLS
+		ctx, cancel := context.WithCancel(m.ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fetcher.Run(ctx)
+		}()
+		m.t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+	}
+	return addr
+}
+
+// link starts a proxy forwarding to the relay at addr. seed fixes the
+// datagrams it drops.
+func (m *testMesh) link(addr string, seed uint64) *netsim.Proxy {
+	p, err := netsim.Listen("127.0.0.1:0", addr, seed)
+	require.NoError(m.t, err)
+	m.t.Cleanup(func() { p.Close() })
+	return p
+}
+
+// dial opens a session to the relay at addr once it is up.
+func (m *testMesh) dial(addr string, mux *moqt.TrackMux) *moqt.Session {
+	var sess *moqt.Session
+	require.Eventually(m.t, func() bool {
+		ctx, cancel := context.WithTimeout(m.ctx, time.Second)
+		defer cancel()
+		var err error
+		sess, err = m.client.Dial(ctx, "moqt://"+addr, mux)
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	m.t.Cleanup(func() { sess.CloseWithError(moqt.NoError, "done") })
+	return sess
+}
+
+// publish publishes path on the relay at addr. Each of its tracks gets a
+// group of one size byte frame every interval.
+func (m *testMesh) publish(addr string, path moqt.BroadcastPath, interval time.Duration, size int) {
+	mux := moqt.NewTrackMux()
+	mux.PublishFunc(m.ctx, path, func(tw *moqt.TrackWriter) {
+		payload := make([]byte, size)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			gw, err := tw.OpenGroup()
+			if err != nil {
+				return
+			}
+			frame := moqt.NewFrame(size)
+			frame.Write(payload)
+			gw.WriteFrame(frame)
+			gw.Close()
+			select {
+			case <-tw.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	m.dial(addr, mux)
+}
+
+// follow subscribes to a track over sess until the test ends, subscribing
+// again whenever the subscription fails or goes quiet, and records the
+// groups it reads.
+func (m *testMesh) follow(sess *moqt.Session, path moqt.BroadcastPath, name moqt.TrackName) *groupLog {
+	log := &groupLog{}
+	ctx, cancel := context.WithCancel(m.ctx)
+	done := make(chan struct{})
+	m.t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+		frame := moqt.NewFrame(0)
+		for ctx.Err() == nil {
+			tr, err := sess.Subscribe(path, name, nil)
+			if err != nil {
+				select {
+				case <-ctx.Done():
+				case <-time.After(20 * time.Millisecond):
+				}
+				continue
+			}
+			for {
+				readCtx, stop := context.WithTimeout(ctx, time.Second)
+				gr, err := tr.AcceptGroup(readCtx)
+				stop()
+				if err != nil {
+					break
+				}
+				for gr.ReadFrame(frame) == nil {
+				}
+				log.add(gr.GroupSequence())
+			}
+			tr.Close()
+		}
+	}()
+	return log
+}
+
+// groupLog records the groups a subscriber read, in order.
+type groupLog struct {
+	mu   sync.Mutex
+	seqs []moqt.GroupSequence
+}
+
+func (l *groupLog) add(seq moqt.GroupSequence) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seqs = append(l.seqs, seq)
+}
+
+// read returns the groups read so far.
+func (l *groupLog) read() []moqt.GroupSequence {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.seqs)
+}
+
+// last returns the latest group read, or 0 for none.
+func (l *groupLog) last() moqt.GroupSequence {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.seqs) == 0 {
+		return 0
+	}
+	return l.seqs[len(l.seqs)-1]
+}
+
+// testDirectory is an SDN announcing broadcasts of one relay, routed to
+// it over a next hop the test moves, as the SDN would once its probes
+// of the current one fail.
+type testDirectory struct {
+	entries []sdn.AnnounceEntry
+
+	mu      sync.Mutex
+	nextHop string // address
+}
+
+func (d *testDirectory) ListAll(ctx context.Context) ([]sdn.AnnounceEntry, error) {
+	return d.entries, nil
+}
+
+func (d *testDirectory) Route(ctx context.Context, to string) (topology.RouteResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return topology.RouteResult{To: to, NextHop: to, NextHopAddress: d.nextHop, FullPath: []string{"edge", to}}, nil
+}
+
+func (d *testDirectory) PrefetchTasks(ctx context.Context) ([]sdn.PrefetchTask, *topology.MaintenanceWindow, error) {
+	return nil, nil, nil
+}
+
+func (d *testDirectory) route(via *netsim.Proxy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nextHop = "moqt://" + via.Addr().String()
+}
+
+// edgeFetcher returns a fetcher relaying the origin's broadcasts as dir
+// routes them, quick to notice a dead next hop.
+func edgeFetcher(dir SDNDirectory) *RemoteFetcher {
+	return &RemoteFetcher{
+		SDNClient:    dir,
+		PollInterval: 50 * time.Millisecond,
+		QUICConfig: &quic.Config{
+			EnableDatagrams: true,
+			MaxIdleTimeout:  500 * time.Millisecond,
+			KeepAlivePeriod: 100 * time.Millisecond,
+		},
+	}
+}
+
+func TestIntegration_RouteFailover(t *testing.T) {
+	m := newTestMesh(t)
+	origin := m.relay(&Config{}, nil)
+	m.publish(origin, "/live/cam", 20*time.Millisecond, 1000)
+
+	primary, backup := m.link(origin, 1), m.link(origin, 2)
+	primary.SetImpairment(netsim.Impairment{Latency: 10 * time.Millisecond, Jitter: 5 * time.Millisecond, Loss: 0.02})
+	dir := &testDirectory{entries: []sdn.AnnounceEntry{{Relay: "origin", BroadcastPath: "/live/cam"}}}
+	dir.route(primary)
+	edge := m.relay(&Config{}, edgeFetcher(dir))
+
+	got := m.follow(m.dial(edge, moqt.NewTrackMux()), "/live/cam", "video")
+	require.Eventually(t, func() bool { return got.last() > 0 }, 10*time.Second, 20*time.Millisecond,
+		"no group over the primary link")
+
+	// Cut the primary link and route over the backup
+	primary.SetImpairment(netsim.Impairment{Loss: 1})
+	dir.route(backup)
+	cut := got.last()
+
+	require.Eventually(t, func() bool { return got.last() > cut+10 }, 10*time.Second, 20*time.Millisecond,
+		"the edge did not fail over to the backup link")
+	_, down := backup.Stats()
+	assert.Positive(t, down.Forwarded, "nothing came over the backup link")
+}
+
+func TestIntegration_CatchUp(t *testing.T) {
+	m := newTestMesh(t)
+	origin := m.relay(&Config{}, nil)
+	m.publish(origin, "/live/cam", 10*time.Millisecond, 20000)
+
+	// A lossy relay link, and a subscriber link far slower than the track
+	upstream := m.link(origin, 1)
+	upstream.SetImpairment(netsim.Impairment{Latency: 10 * time.Millisecond, Jitter: 5 * time.Millisecond, Loss: 0.01})
+	dir := &testDirectory{entries: []sdn.AnnounceEntry{{Relay: "origin", BroadcastPath: "/live/cam"}}}
+	dir.route(upstream)
+	fetcher := edgeFetcher(dir)
+	fetcher.GroupCacheSize = 8
+	edge := m.relay(&Config{}, fetcher)
+
+	slow := m.link(edge, 3)
+	slow.SetImpairments(netsim.Impairment{}, netsim.Impairment{Bandwidth: 200 << 10, QueueLimit: 50 * time.Millisecond})
+	got := m.follow(m.dial(slow.Addr().String(), moqt.NewTrackMux()), "/live/cam", "video")
+
+	// The subscriber gets a few groups a second out of the hundred
+	// published, so it must skip ahead to stay within the edge's cache
+	require.Eventually(t, func() bool { return len(got.read()) >= 10 }, 15*time.Second, 50*time.Millisecond,
+		"the subscriber read too few groups")
+	seqs := got.read()
+	skipped := false
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] > seqs[i-1]+1 {
+			skipped = true
+		}
+	}
+	assert.True(t, skipped, "the subscriber never skipped ahead: %v", seqs)
+	assert.Greater(t, seqs[len(seqs)-1]-seqs[0], moqt.GroupSequence(len(seqs)),
+		"the subscriber fell further behind instead of catching up")
+}
+
+func TestIntegration_Backpressure(t *testing.T) {
+	m := newTestMesh(t)
+	origin := m.relay(&Config{EgressWriteTimeout: 300 * time.Millisecond}, nil)
+	m.publish(origin, "/live/cam", 10*time.Millisecond, 4000)
+
+	// One edge relays the track over a link about to stall, while a
+	// subscriber reads it from the origin directly
+	stalling := m.link(origin, 1)
+	dir := &testDirectory{entries: []sdn.AnnounceEntry{{Relay: "origin", BroadcastPath: "/live/cam"}}}
+	dir.route(stalling)
+	edge := m.relay(&Config{}, edgeFetcher(dir))
+	downstream := m.follow(m.dial(edge, moqt.NewTrackMux()), "/live/cam", "video")
+	direct := m.follow(m.dial(origin, moqt.NewTrackMux()), "/live/cam", "video")
+
+	require.Eventually(t, func() bool { return downstream.last() > 0 && direct.last() > 0 },
+		10*time.Second, 20*time.Millisecond, "no group reached the subscribers")
+
+	// The edge stops acknowledging: the origin's writes to it block until
+	// the write timeout closes its subscription as stuck
+	before := testutil.ToFloat64(stuckSubscribers)
+	stalling.SetImpairments(netsim.Impairment{Loss: 1}, netsim.Impairment{})
+	stalled := direct.last()
+
+	require.Eventually(t, func() bool { return testutil.ToFloat64(stuckSubscribers) > before },
+		10*time.Second, 20*time.Millisecond, "the stalled edge was not closed as stuck")
+	require.Eventually(t, func() bool { return direct.last() > stalled+50 }, 10*time.Second, 20*time.Millisecond,
+		"the stalled edge held back the other subscriber")
+}
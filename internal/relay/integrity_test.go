@@ -0,0 +1,96 @@
+package relay
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cachedRing returns a ring holding one complete group per entry of groups.
+func cachedRing(t *testing.T, groups ...[]string) *groupRing {
+	t.Helper()
+	ring := newGroupRing(8, DefaultFramePool)
+	for i, frames := range groups {
+		ring.add(&fakeGroupSource{seq: moqt.GroupSequence(i + 1), frames: frames, end: io.EOF}, nil)
+	}
+	return ring
+}
+
+func TestGroupCache_Checksum(t *testing.T) {
+	a := cachedRing(t, []string{"key", "delta"}).list()
+	b := cachedRing(t, []string{"key", "delta"}).list()
+	c := cachedRing(t, []string{"keydelta"}).list()
+
+	require.Len(t, a, 1)
+	assert.NotEmpty(t, a[0].Checksum)
+	assert.Equal(t, a[0].Checksum, b[0].Checksum, "same frames, same checksum")
+	assert.NotEqual(t, a[0].Checksum, c[0].Checksum, "frame boundaries are covered")
+
+	// Incomplete groups report no checksum yet
+	gc := &groupCache{seq: 1}
+	assert.Empty(t, gc.info(gc.createdAt).Checksum)
+}
+
+func TestIntegrityVerifier_Verify(t *testing.T) {
+	upstream := cachedRing(t, []string{"a", "b"}, []string{"c"}, []string{"d"}).list()
+	upstream[1].Checksum = "deadbeef" // corrupted on the way
+	upstream = upstream[:2]           // group 3 already evicted upstream
+
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(map[string]any{"groups": upstream})
+	}))
+	defer srv.Close()
+
+	v := &IntegrityVerifier{Token: "secret"}
+	target := integrityTarget{
+		upstream: strings.Replace(srv.URL, "http://", "https://", 1),
+		path:     "/live/cam",
+		track:    "video",
+		ring:     cachedRing(t, []string{"a", "b"}, []string{"c"}, []string{"d"}),
+	}
+
+	checked, mismatched, err := v.verify(t.Context(), srv.Client(), target)
+	require.NoError(t, err)
+	assert.Equal(t, 2, checked)
+	assert.Equal(t, 1, mismatched)
+	assert.Equal(t, "/peer/tracks/live/cam/video/groups", gotPath)
+	assert.Equal(t, "Bearer secret", gotAuth)
+
+	// Each group is checked once
+	checked, _, err = v.verify(t.Context(), srv.Client(), target)
+	require.NoError(t, err)
+	assert.Zero(t, checked)
+}
+
+func TestIntegrityVerifier_NotRelayed(t *testing.T) {
+	srv := httptest.NewServer(TrackCacheHandlerFunc(PeerTracksPrefix))
+	defer srv.Close()
+
+	v := &IntegrityVerifier{}
+	checked, _, err := v.verify(t.Context(), srv.Client(), integrityTarget{
+		upstream: srv.URL,
+		path:     "/gone",
+		track:    "video",
+		ring:     cachedRing(t, []string{"a"}),
+	})
+	assert.NoError(t, err, "a track the next hop stopped relaying is skipped")
+	assert.Zero(t, checked)
+}
+
+func TestPeerTracksURL(t *testing.T) {
+	u, err := peerTracksURL("https://relay-b:4433", "/live/a b", "cam/1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://relay-b:4433/peer/tracks/live/a%20b/cam%2F1/groups", u)
+
+	_, err = peerTracksURL("relay-b", "/live", "video")
+	assert.Error(t, err)
+}
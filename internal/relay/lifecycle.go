@@ -0,0 +1,143 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// ServerState is a stage in a Server's lifecycle:
+//
+//	New → Configured → Running → Draining → Stopped
+//
+// Shutdown drains from any state before Draining; Close stops from any
+// state. Stopped is final.
+type ServerState int32
+
+const (
+	StateNew        ServerState = iota // fields may still be set
+	StateConfigured                    // validated; Config is frozen
+	StateRunning                       // accepting sessions
+	StateDraining                      // Shutdown in progress; new sessions are refused
+	StateStopped                       // closed or drained
+)
+
+func (st ServerState) String() string {
+	switch st {
+	case StateNew:
+		return "new"
+	case StateConfigured:
+		return "configured"
+	case StateRunning:
+		return "running"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("ServerState(%d)", int32(st))
+}
+
+// ErrNoTLSConfig is returned when configuring a Server without a TLSConfig.
+var ErrNoTLSConfig = errors.New("relay: server has no TLS config")
+
+// ErrConfigChanged is returned by ListenAndServe when Server.Config was
+// replaced or modified after the server was configured.
+var ErrConfigChanged = errors.New("relay: Config changed after the server was configured")
+
+// StateError is returned when a Server is asked to do something its
+// lifecycle state does not allow.
+type StateError struct {
+	Op    string
+	State ServerState
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("relay: cannot %s a %s server", e.Op, e.State)
+}
+
+// State returns the server's lifecycle state.
+func (s *Server) State() ServerState {
+	return ServerState(s.state.Load())
+}
+
+// Configure validates the server, fills in defaults and freezes Config,
+// moving it from StateNew to StateConfigured. It is called by
+// ListenAndServe and is a no-op once the server is configured. Changes to
+// Config after Configure are not applied; ListenAndServe rejects them with
+// ErrConfigChanged.
+func (s *Server) Configure() error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	// Status, Stats and the admin endpoints work in every state, even if
+	// validation fails below.
+	if s.statusHandler == nil {
+		s.statusHandler = newStatusHandler()
+		s.peerRegistry = newPeerRegistry()
+	}
+
+	if s.State() != StateNew {
+		return nil
+	}
+	if s.TLSConfig == nil {
+		return ErrNoTLSConfig
+	}
+
+	if s.TrackMux == nil {
+		s.TrackMux = moqt.DefaultMux
+	}
+
+	s.configured = s.Config
+	if s.Config != nil {
+		frozen := *s.Config
+		if err := s.Config.validateVersions(); err != nil {
+			return err
+		}
+		frozen.AnnounceMetadata = maps.Clone(s.Config.AnnounceMetadata)
+		frozen.Versions = slices.Clone(s.Config.Versions)
+		s.config = &frozen
+
+		if frozen.EgressLimit > 0 {
+			globalEgressLimiter.setRate(frozen.EgressLimit)
+		}
+		s.egress = NewEgressPool(frozen.EgressWorkers)
+	}
+
+	s.setState(StateConfigured)
+	return nil
+}
+
+// configChanged reports whether Config differs from what Configure froze.
+func (s *Server) configChanged() bool {
+	if s.Config != s.configured {
+		return true
+	}
+	return s.Config != nil && !reflect.DeepEqual(*s.Config, *s.config)
+}
+
+// transition moves the server to state to if it is in one of from, and
+// fails with a StateError naming op otherwise.
+func (s *Server) transition(op string, to ServerState, from ...ServerState) error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if cur := s.State(); !slices.Contains(from, cur) {
+		return &StateError{Op: op, State: cur}
+	}
+	s.setState(to)
+	return nil
+}
+
+// setState records the move to st. Caller must hold s.stateMu.
+func (s *Server) setState(st ServerState) {
+	if prev := s.State(); prev != StateNew {
+		serverStates.WithLabelValues(prev.String()).Dec()
+	}
+	serverStates.WithLabelValues(st.String()).Inc()
+	s.state.Store(int32(st))
+}
@@ -0,0 +1,61 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Lifecycle(t *testing.T) {
+	s := &Server{TLSConfig: &tls.Config{}, Config: &Config{MaxSessions: 10}}
+	assert.Equal(t, StateNew, s.State())
+
+	require.NoError(t, s.Configure())
+	assert.Equal(t, StateConfigured, s.State())
+	assert.Equal(t, "configured", s.Status().State)
+
+	// Not serving yet
+	err := s.HandleWebTransport(httptest.NewRecorder(), httptest.NewRequest(http.MethodConnect, "/", nil))
+	var stateErr *StateError
+	require.ErrorAs(t, err, &stateErr)
+	assert.Equal(t, StateConfigured, stateErr.State)
+
+	// The frozen config is used, not later edits
+	s.Config.MaxSessions = 0
+	s.statusHandler.incrementConnections()
+	defer s.statusHandler.decrementConnections()
+	assert.Equal(t, 10, s.config.MaxSessions)
+	assert.ErrorIs(t, s.start(context.Background()), ErrConfigChanged)
+	s.Config.MaxSessions = 10
+
+	require.NoError(t, s.start(context.Background()))
+	assert.Equal(t, StateRunning, s.State())
+	require.ErrorAs(t, s.start(context.Background()), &stateErr, "already running")
+
+	require.NoError(t, s.Close())
+	assert.Equal(t, StateStopped, s.State())
+	require.NoError(t, s.Shutdown(context.Background()), "stopped is final")
+	assert.Equal(t, StateStopped, s.State())
+	assert.Nil(t, s.ShutdownReport())
+}
+
+func TestServer_ShutdownState(t *testing.T) {
+	s := &Server{TLSConfig: &tls.Config{}}
+	require.NoError(t, s.Configure())
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, StateStopped, s.State())
+
+	reason, _ := s.overloaded("/")
+	assert.Equal(t, overloadDraining, reason, "a stopped server refuses sessions")
+}
+
+func TestServerState_String(t *testing.T) {
+	assert.Equal(t, "draining", StateDraining.String())
+	assert.Equal(t, "ServerState(9)", ServerState(9).String())
+}
@@ -0,0 +1,103 @@
+package relay
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// LogSampling limits how often hot-path log sites (per-track and per-group
+// events) emit. Limits apply per site; the zero value logs everything.
+type LogSampling struct {
+	// Every logs the first and then every Nth event. 0 or 1 logs all.
+	Every int
+
+	// PerSecond caps the events logged per second. 0 means no cap.
+	PerSecond int
+}
+
+// logSampler decides which hot-path events are logged. A logged event
+// carries the number of events suppressed since the previous one.
+type logSampler struct {
+	mu     sync.Mutex
+	config LogSampling
+	sites  map[string]*sampleState
+}
+
+type sampleState struct {
+	seen        uint64
+	windowStart time.Time
+	inWindow    int
+	suppressed  int
+}
+
+// hotPathLogs samples the relay's per-track and per-group log sites.
+var hotPathLogs = &logSampler{}
+
+// SetLogSampling configures sampling of the relay's hot-path logs.
+func SetLogSampling(cfg LogSampling) {
+	hotPathLogs.mu.Lock()
+	defer hotPathLogs.mu.Unlock()
+	hotPathLogs.config = cfg
+	hotPathLogs.sites = nil
+}
+
+// allow reports whether the next event at site should be logged and how
+// many events were suppressed since the last logged one.
+func (s *logSampler) allow(site string, now time.Time) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.Every <= 1 && s.config.PerSecond <= 0 {
+		return true, 0
+	}
+
+	if s.sites == nil {
+		s.sites = make(map[string]*sampleState)
+	}
+	st, ok := s.sites[site]
+	if !ok {
+		st = &sampleState{}
+		s.sites[site] = st
+	}
+
+	st.seen++
+	if every := uint64(s.config.Every); every > 1 && (st.seen-1)%every != 0 {
+		st.suppressed++
+		return false, 0
+	}
+
+	if s.config.PerSecond > 0 {
+		if now.Sub(st.windowStart) >= time.Second {
+			st.windowStart = now
+			st.inWindow = 0
+		}
+		if st.inWindow >= s.config.PerSecond {
+			st.suppressed++
+			return false, 0
+		}
+		st.inWindow++
+	}
+
+	suppressed := st.suppressed
+	st.suppressed = 0
+	return true, suppressed
+}
+
+// log emits msg through logger at level unless sampled out. The message
+// is the sampling key.
+func (s *logSampler) log(logger *slog.Logger, level slog.Level, msg string, args ...any) {
+	ctx := context.Background()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	ok, suppressed := s.allow(msg, time.Now())
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		args = append(args, "suppressed", suppressed)
+	}
+	logger.Log(ctx, level, msg, args...)
+}
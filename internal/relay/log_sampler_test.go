@@ -0,0 +1,72 @@
+package relay
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogSampler_Disabled(t *testing.T) {
+	s := &logSampler{}
+	for range 5 {
+		ok, suppressed := s.allow("site", time.Now())
+		assert.True(t, ok)
+		assert.Zero(t, suppressed)
+	}
+}
+
+func TestLogSampler_Every(t *testing.T) {
+	s := &logSampler{config: LogSampling{Every: 3}}
+	now := time.Now()
+
+	var allowed []int
+	var suppressed []int
+	for i := range 7 {
+		if ok, n := s.allow("site", now); ok {
+			allowed = append(allowed, i)
+			suppressed = append(suppressed, n)
+		}
+	}
+	assert.Equal(t, []int{0, 3, 6}, allowed)
+	assert.Equal(t, []int{0, 2, 2}, suppressed)
+
+	// Sites are sampled independently.
+	ok, _ := s.allow("other", now)
+	assert.True(t, ok)
+}
+
+func TestLogSampler_PerSecond(t *testing.T) {
+	s := &logSampler{config: LogSampling{PerSecond: 2}}
+	now := time.Now()
+
+	ok1, _ := s.allow("site", now)
+	ok2, _ := s.allow("site", now.Add(10*time.Millisecond))
+	ok3, _ := s.allow("site", now.Add(20*time.Millisecond))
+	assert.True(t, ok1)
+	assert.True(t, ok2)
+	assert.False(t, ok3)
+
+	ok, suppressed := s.allow("site", now.Add(time.Second))
+	assert.True(t, ok, "new window")
+	assert.Equal(t, 1, suppressed)
+}
+
+func TestLogSampler_Log(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	s := &logSampler{config: LogSampling{Every: 2}}
+
+	for range 3 {
+		s.log(logger, slog.LevelInfo, "Relay track started", "track_name", "video")
+	}
+	s.log(logger, slog.LevelDebug, "group cached")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.NotContains(t, lines[0], "suppressed")
+	assert.Contains(t, lines[1], "suppressed=1")
+}
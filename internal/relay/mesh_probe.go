@@ -0,0 +1,216 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/gomoqt/quic"
+	"github.com/okdaichi/qumo/internal/sdn"
+)
+
+// ProbeCoordinator hands out cross-relay probe tasks and collects results.
+// *sdn.Client and *sdn.Group implement it.
+type ProbeCoordinator interface {
+	RelayName() string
+	ProbeTasks(ctx context.Context) ([]sdn.ProbeTask, error)
+	ReportProbe(ctx context.Context, res sdn.ProbeResult) error
+}
+
+var (
+	_ ProbeCoordinator = (*sdn.Client)(nil)
+	_ ProbeCoordinator = (*sdn.Group)(nil)
+)
+
+// MeshProber validates the data plane between neighboring relays. It
+// publishes this relay's synthetic probe broadcast on the local TrackMux,
+// runs the probe tasks the SDN controller schedules (subscribing to a
+// neighbor's probe broadcast), and reports latency and loss back so the
+// controller can adjust edge costs.
+type MeshProber struct {
+	Coordinator ProbeCoordinator
+
+	// TrackMux is where this relay's probe broadcast is published.
+	TrackMux *moqt.TrackMux
+
+	TLSConfig  *tls.Config
+	QUICConfig *quic.Config
+
+	// PollInterval is how often tasks are fetched. Zero uses 30s.
+	PollInterval time.Duration
+
+	// Frames is the number of frames the probe broadcast carries per
+	// subscription. Zero uses 10.
+	Frames int
+
+	// FrameInterval is the spacing between probe frames. Zero uses 20ms.
+	FrameInterval time.Duration
+
+	// runTask runs one probe task. Overridden in tests.
+	runTask func(ctx context.Context, task sdn.ProbeTask) sdn.ProbeResult
+}
+
+// Run publishes the probe broadcast and executes scheduled tasks until ctx
+// is cancelled.
+func (p *MeshProber) Run(ctx context.Context) {
+	interval := p.PollInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	if p.TrackMux != nil {
+		path := moqt.BroadcastPath(sdn.ProbePathPrefix + p.Coordinator.RelayName())
+		p.TrackMux.PublishFunc(ctx, path, p.serveProbe)
+	}
+
+	slog.Info("mesh prober started", "poll_interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.poll(ctx)
+		}
+	}
+}
+
+// poll fetches pending tasks, runs them and reports the results.
+func (p *MeshProber) poll(ctx context.Context) {
+	tasks, err := p.Coordinator.ProbeTasks(ctx)
+	if err != nil {
+		slog.Warn("mesh prober: failed to fetch tasks", "error", err)
+		return
+	}
+
+	run := p.runTask
+	if run == nil {
+		run = p.probe
+	}
+
+	for _, task := range tasks {
+		res := run(ctx, task)
+		if err := p.Coordinator.ReportProbe(ctx, res); err != nil {
+			slog.Warn("mesh prober: failed to report result", "to", task.To, "error", err)
+		}
+	}
+}
+
+// frames returns the configured frame count and spacing.
+func (p *MeshProber) frames() (int, time.Duration) {
+	n, gap := p.Frames, p.FrameInterval
+	if n <= 0 {
+		n = 10
+	}
+	if gap <= 0 {
+		gap = 20 * time.Millisecond
+	}
+	return n, gap
+}
+
+// serveProbe writes the probe frames, one group each, to a subscriber.
+// Each frame carries its sequence number, so the prober can tell which
+// frames were sent whatever its own Frames setting.
+func (p *MeshProber) serveProbe(tw *moqt.TrackWriter) {
+	n, gap := p.frames()
+	frame := moqt.NewFrame(probeFrameSize)
+	for seq := range n {
+		gw, err := tw.OpenGroup()
+		if err != nil {
+			return
+		}
+		frame.Reset()
+		frame.Write(appendProbeFrame(nil, uint64(seq)))
+		gw.WriteFrame(frame)
+		gw.Close()
+
+		select {
+		case <-tw.Context().Done():
+			return
+		case <-time.After(gap):
+		}
+	}
+}
+
+// probeFrameSize is the size of a probe frame: its big-endian sequence
+// number.
+const probeFrameSize = 8
+
+// appendProbeFrame appends the probe frame with sequence number seq to b.
+func appendProbeFrame(b []byte, seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(b, seq)
+}
+
+// parseProbeFrame returns the sequence number of a probe frame.
+func parseProbeFrame(body []byte) (seq uint64, ok bool) {
+	if len(body) != probeFrameSize {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(body), true
+}
+
+// probe subscribes to task.Path at task.Address and counts the frames that
+// arrive before the probe window closes. Sent counts the frames the probed
+// relay is known to have sent: up to the highest sequence number received,
+// since a later frame shows the earlier ones were sent. Nothing counts as
+// sent if the probe could not subscribe.
+func (p *MeshProber) probe(ctx context.Context, task sdn.ProbeTask) sdn.ProbeResult {
+	n, gap := p.frames()
+	res := sdn.ProbeResult{ID: task.ID, From: task.From, To: task.To}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(n)*gap+5*time.Second)
+	defer cancel()
+
+	client := &moqt.Client{
+		TLSConfig:  p.TLSConfig,
+		QUICConfig: p.QUICConfig,
+	}
+	defer client.Close()
+
+	sess, err := client.Dial(ctx, task.Address, moqt.NewTrackMux())
+	if err != nil {
+		res.Error = fmt.Sprintf("dial: %v", err)
+		return res
+	}
+	defer sess.CloseWithError(moqt.NoError, "probe done")
+
+	start := time.Now()
+	tr, err := sess.Subscribe(moqt.BroadcastPath(task.Path), selfCheckTrack, nil)
+	if err != nil {
+		res.Error = fmt.Sprintf("subscribe: %v", err)
+		return res
+	}
+	defer tr.Close()
+
+	frame := moqt.NewFrame(probeFrameSize)
+	for res.Received < n {
+		gr, err := tr.AcceptGroup(ctx)
+		if err != nil {
+			break // window closed
+		}
+		if err := gr.ReadFrame(frame); err != nil {
+			continue
+		}
+		seq, ok := parseProbeFrame(frame.Body())
+		if !ok {
+			continue
+		}
+		if res.Received == 0 {
+			res.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		}
+		res.Received++
+		res.Sent = max(res.Sent, int(seq)+1)
+	}
+
+	if res.Received == 0 {
+		res.Error = "no probe frames received"
+	}
+	return res
+}
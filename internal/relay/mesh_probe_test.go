@@ -0,0 +1,82 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCoordinator struct {
+	tasks    []sdn.ProbeTask
+	err      error
+	reported []sdn.ProbeResult
+}
+
+func (f *fakeCoordinator) RelayName() string { return "relay-a" }
+
+func (f *fakeCoordinator) ProbeTasks(ctx context.Context) ([]sdn.ProbeTask, error) {
+	return f.tasks, f.err
+}
+
+func (f *fakeCoordinator) ReportProbe(ctx context.Context, res sdn.ProbeResult) error {
+	f.reported = append(f.reported, res)
+	return nil
+}
+
+func TestMeshProber_Poll(t *testing.T) {
+	coord := &fakeCoordinator{tasks: []sdn.ProbeTask{
+		{ID: "1", From: "relay-a", To: "relay-b"},
+		{ID: "2", From: "relay-a", To: "relay-c"},
+	}}
+	p := &MeshProber{
+		Coordinator: coord,
+		runTask: func(ctx context.Context, task sdn.ProbeTask) sdn.ProbeResult {
+			return sdn.ProbeResult{ID: task.ID, From: task.From, To: task.To, LatencyMs: 5, Sent: 10, Received: 10}
+		},
+	}
+
+	p.poll(context.Background())
+
+	assert.Len(t, coord.reported, 2)
+	assert.Equal(t, "relay-b", coord.reported[0].To)
+	assert.Equal(t, "relay-c", coord.reported[1].To)
+}
+
+func TestMeshProber_Poll_TaskFetchError(t *testing.T) {
+	coord := &fakeCoordinator{err: errors.New("sdn down")}
+	p := &MeshProber{
+		Coordinator: coord,
+		runTask: func(ctx context.Context, task sdn.ProbeTask) sdn.ProbeResult {
+			t.Fatal("no task should run")
+			return sdn.ProbeResult{}
+		},
+	}
+
+	p.poll(context.Background())
+	assert.Empty(t, coord.reported)
+}
+
+func TestMeshProber_Probe_DialFailure(t *testing.T) {
+	p := &MeshProber{Frames: 3}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res := p.probe(ctx, sdn.ProbeTask{ID: "1", From: "relay-a", To: "relay-b", Address: "https://127.0.0.1:1"})
+	assert.Equal(t, "1", res.ID)
+	assert.Zero(t, res.Sent, "nothing was sent")
+	assert.Zero(t, res.Received)
+	assert.NotEmpty(t, res.Error)
+	assert.Equal(t, 1.0, res.Loss())
+}
+
+func TestProbeFrame(t *testing.T) {
+	seq, ok := parseProbeFrame(appendProbeFrame(nil, 7))
+	assert.True(t, ok)
+	assert.EqualValues(t, 7, seq)
+
+	_, ok = parseProbeFrame([]byte{1, 2, 3})
+	assert.False(t, ok)
+}
@@ -0,0 +1,386 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	egressThrottledSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "egress_throttled_seconds_total",
+		Help:      "Total time egress writers spent waiting on the global bandwidth cap.",
+	})
+
+	egressLimitBytes = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "egress_limit_bytes_per_second",
+		Help:      "Configured global egress cap in bytes/sec (0 = unlimited).",
+	}, func() float64 {
+		return float64(globalEgressLimiter.limit())
+	})
+
+	egressSchedulerWaitSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "egress_scheduler_wait_seconds_total",
+		Help:      "Total time egress writers spent waiting for a worker in worker-pool mode.",
+	})
+
+	egressWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "egress_workers",
+		Help:      "Configured egress workers across all virtual hosts (0 = a goroutine per subscriber).",
+	})
+
+	stuckSubscribers = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "stuck_subscribers_total",
+		Help:      "Subscriptions closed because a frame write blocked beyond the egress write timeout.",
+	})
+
+	selfCheckHealthy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "selfcheck_healthy",
+		Help:      "1 if the loopback data-plane probe is healthy, 0 otherwise.",
+	})
+
+	selfCheckLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "selfcheck_latency_seconds",
+		Help:      "Loop latency of successful loopback probes.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12),
+	})
+
+	selfCheckFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "selfcheck_failures_total",
+		Help:      "Failed loopback probes.",
+	})
+
+	sessionsRefused = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "sessions_refused_total",
+		Help:      "Sessions refused with a retry-after, by reason (draining, session_limit, resource_pressure).",
+	}, []string{"reason"})
+
+	serverStates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "servers",
+		Help:      "Relay servers by lifecycle state (configured, running, draining, stopped).",
+	}, []string{"state"})
+
+	sessionReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "session_reconnects_total",
+		Help:      "Sessions whose client presented a previous session ID.",
+	})
+
+	sessionsByVersion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "sessions_by_version",
+		Help:      "Sessions being relayed, by negotiated MoQ version.",
+	}, []string{"version"})
+
+	sessionRTT = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "session_rtt_seconds",
+		Help:      "Smoothed QUIC RTT of the relay's sessions, sampled every 10s.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12),
+	})
+
+	quicPackets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "quic_packets_total",
+		Help:      "QUIC packets of the relay's sessions, by direction (sent, received, lost). The frames of lost packets are retransmitted in new ones.",
+	}, []string{"direction"})
+
+	quicLostBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "quic_lost_bytes_total",
+		Help:      "Bytes of the relay's sessions in QUIC packets declared lost.",
+	})
+
+	incompleteGroups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "incomplete_groups_total",
+		Help:      "Upstream groups abandoned before completion, by reason (stalled, reset). Series are dropped when the track stops relaying.",
+	}, []string{"broadcast_path", "track", "reason"})
+
+	staleTracks = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "stale_tracks",
+		Help:      "Relayed tracks whose upstream sent no group within the stale track timeout.",
+	}, func() float64 {
+		return float64(len(DegradedTracks()))
+	})
+
+	staleTrackResubscribes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "stale_track_resubscribes_total",
+		Help:      "Upstream subscriptions of stale tracks replaced by the watchdog.",
+	})
+
+	integrityChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "integrity_checks_total",
+		Help:      "Relayed groups whose checksum was compared with the next hop's, by result (match, mismatch).",
+	}, []string{"result"})
+
+	summariesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "summary_records_dropped_total",
+		Help:      "Session and subscription summary records dropped because the sink queue was full.",
+	})
+
+	summariesFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "summary_records_failed_total",
+		Help:      "Summary record writes that a sink rejected.",
+	})
+
+	eventsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "events_dropped_total",
+		Help:      "Relay events dropped because the event bus queue was full.",
+	})
+
+	eventsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "events_failed_total",
+		Help:      "Relay events an event bus publisher failed to deliver.",
+	})
+
+	publicationsDesc = prometheus.NewDesc(
+		"qumo_relay_publications",
+		"Publications registered on the track mux and not yet collected.",
+		[]string{"source"}, nil,
+	)
+
+	publicationsCollected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "publications_collected_total",
+		Help:      "Ended publications removed by the publication sweeper.",
+	}, []string{"source"})
+
+	publicationsLeaked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "publications_leaked_total",
+		Help:      "Ended publications still routed by the track mux when collected.",
+	}, []string{"source"})
+)
+
+// publicationsCollector exports the live publication count per source.
+type publicationsCollector struct{}
+
+func (publicationsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- publicationsDesc
+}
+
+func (publicationsCollector) Collect(ch chan<- prometheus.Metric) {
+	for source, n := range globalPublications.count() {
+		ch <- prometheus.MustNewConstMetric(publicationsDesc, prometheus.GaugeValue, float64(n), string(source))
+	}
+}
+
+var (
+	resourcePressureGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "resource_pressure",
+		Help:      "1 while the resource monitor finds the relay under sustained pressure, by resource (memory, cpu).",
+	}, []string{"resource"})
+
+	resourcePressureActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "resource_pressure_actions_total",
+		Help:      "Actions taken under resource pressure (reject_sessions, not_ready, shrink_caches).",
+	}, []string{"action"})
+
+	cacheGroupsShed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "cache_groups_shed_total",
+		Help:      "Cached groups evicted early to relieve memory pressure.",
+	})
+
+	upstreamSubscribesShared = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "upstream_subscribes_shared_total",
+		Help:      "Subscriptions that waited for an upstream subscription another subscriber was opening instead of opening their own.",
+	})
+
+	publicationConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "publication_conflicts_total",
+		Help:      "Paths published both locally and remotely, by resolution: remote_withdrawn (a local publisher took over a remotely fetched path) or remote_suppressed (a remote fetch refused for a locally published path).",
+	}, []string{"resolution"})
+
+	privateSubscribesDenied = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "private_subscribes_denied_total",
+		Help:      "Subscriptions to private broadcasts refused because the subscriber is not allowed.",
+	})
+
+	fecParityFrames = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "fec_parity_frames_total",
+		Help:      "FEC parity frames sent to next-hop relays.",
+	})
+
+	fecRecoveredFrames = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "fec_recovered_frames_total",
+		Help:      "Frames of truncated upstream groups rebuilt from FEC parity.",
+	})
+
+	fecUnrecoverableGroups = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "fec_unrecoverable_groups_total",
+		Help:      "Truncated upstream groups on FEC-protected tracks that parity could not rebuild.",
+	})
+
+	recordingsPurgedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "recordings_purged_bytes_total",
+		Help:      "Disk space reclaimed by purging recordings, by reason (age, size, manual).",
+	}, []string{"reason"})
+
+	recordingsPurgedFiles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "recordings_purged_files_total",
+		Help:      "Recording files purged, by reason (age, size, manual).",
+	}, []string{"reason"})
+
+	// compressionBytes counts the frames of compressed relay-to-relay
+	// tracks before ("raw") and after ("encoded") compression, sent
+	// ("egress") or received ("ingress"). raw/encoded is the ratio.
+	compressionBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "compression_bytes_total",
+		Help:      "Frame bytes of compressed relay-to-relay tracks, raw and encoded, by direction.",
+	}, []string{"direction", "stage"})
+
+	listenerShardConnections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "listener_shard_connections_total",
+		Help:      "QUIC connections accepted by each SO_REUSEPORT listener shard.",
+	}, []string{"shard"})
+	goroutines = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "goroutines",
+		Help:      "Live goroutines started by the relay per subsystem.",
+	}, []string{"subsystem"})
+
+	goroutineLeakWarnings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "qumo",
+		Subsystem: "relay",
+		Name:      "goroutine_leak_warnings_total",
+		Help:      "Times a subsystem's goroutines grew without new sessions.",
+	}, []string{"subsystem"})
+)
+
+func init() {
+	selfCheckHealthy.Set(1)
+	globalEgressLimiter.onThrottle = func(d time.Duration) {
+		egressThrottledSeconds.Add(d.Seconds())
+	}
+	globalPublications.onCollect = func(source PublicationSource, leaked bool) {
+		publicationsCollected.WithLabelValues(string(source)).Inc()
+		if leaked {
+			publicationsLeaked.WithLabelValues(string(source)).Inc()
+		}
+	}
+}
+
+// RegisterMetrics registers the relay's Prometheus collectors with reg.
+func RegisterMetrics(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		egressThrottledSeconds,
+		egressLimitBytes,
+		egressSchedulerWaitSeconds,
+		egressWorkers,
+		stuckSubscribers,
+		publicationsCollector{},
+		publicationsCollected,
+		publicationsLeaked,
+		selfCheckHealthy,
+		selfCheckLatency,
+		selfCheckFailures,
+		clientCollector{},
+		subscriberCollector{},
+		udpSocketCollector{},
+		serverStates,
+		sessionReconnects,
+		sessionsByVersion,
+		sessionRTT,
+		quicPackets,
+		quicLostBytes,
+		sessionsRefused,
+		incompleteGroups,
+		integrityChecks,
+		staleTracks,
+		staleTrackResubscribes,
+		summariesDropped,
+		summariesFailed,
+		eventsDropped,
+		eventsFailed,
+		resourcePressureGauge,
+		resourcePressureActions,
+		cacheGroupsShed,
+		fecParityFrames,
+		fecRecoveredFrames,
+		fecUnrecoverableGroups,
+		recordingsPurgedBytes,
+		recordingsPurgedFiles,
+		compressionBytes,
+		listenerShardConnections,
+		privateSubscribesDenied,
+		upstreamSubscribesShared,
+		publicationConflicts,
+		goroutines,
+		goroutineLeakWarnings,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
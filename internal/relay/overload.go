@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/gomoqt/quic"
+)
+
+// OverloadErrorCode is the session error code a relay rejects a MoQ setup
+// with when it is draining, at its session limit or under resource
+// pressure. The low 16 bits carry how many seconds the client should wait
+// before retrying; RetryAfter decodes them.
+const OverloadErrorCode moqt.SessionErrorCode = 0x716d0000
+
+// DefaultRetryAfter is the back-off suggested to rejected clients when
+// Config.RetryAfter is unset.
+const DefaultRetryAfter = 5 * time.Second
+
+// Reasons a session is refused.
+const (
+	overloadDraining         = "draining"
+	overloadSessionLimit     = "session_limit"
+	overloadResourcePressure = "resource_pressure"
+)
+
+// overloadErrorCode encodes retryAfter, rounded up to whole seconds, into
+// OverloadErrorCode.
+func overloadErrorCode(retryAfter time.Duration) moqt.SessionErrorCode {
+	return OverloadErrorCode | moqt.SessionErrorCode(retryAfterSeconds(retryAfter))
+}
+
+// retryAfterSeconds rounds d up to whole seconds, clamped to 1..0xffff.
+func retryAfterSeconds(d time.Duration) int {
+	secs := int((d + time.Second - 1) / time.Second)
+	return max(1, min(secs, 0xffff))
+}
+
+// RetryAfter reports how long a relay that refused a session with
+// OverloadErrorCode asked the client to wait. ok is false if err is not
+// such a refusal.
+func RetryAfter(err error) (d time.Duration, ok bool) {
+	var code uint64
+	var se *quic.StreamError
+	var ae *quic.ApplicationError
+	switch {
+	case errors.As(err, &se):
+		code = uint64(se.ErrorCode)
+	case errors.As(err, &ae):
+		code = uint64(ae.ErrorCode)
+	default:
+		return 0, false
+	}
+	if code&^0xffff != uint64(OverloadErrorCode) {
+		return 0, false
+	}
+	return time.Duration(code&0xffff) * time.Second, true
+}
+
+// overloaded returns why the relay cannot take another session dialed to
+// path and how long the client should wait, or "" if it can. The session
+// limit is soft: sessions admitted concurrently may overshoot it slightly.
+// Sessions of the loopback probe are only refused while draining, so the
+// relay's own selfcheck keeps working while it sheds load.
+func (s *Server) overloaded(path string) (reason string, retryAfter time.Duration) {
+	retryAfter = DefaultRetryAfter
+	if s.config != nil && s.config.RetryAfter > 0 {
+		retryAfter = s.config.RetryAfter
+	}
+
+	switch {
+	case s.State() >= StateDraining:
+		return overloadDraining, retryAfter
+	case s.SelfCheck.owns(path):
+		return "", 0
+	case s.config != nil && s.config.MaxSessions > 0 &&
+		int(s.statusHandler.activeConnections.Load()) >= s.config.MaxSessions:
+		return overloadSessionLimit, retryAfter
+	case ResourcePressure() != "":
+		return overloadResourcePressure, retryAfter
+	}
+	return "", 0
+}
+
+// admitSetup rejects the MoQ setup behind w with OverloadErrorCode if the
+// relay is overloaded and reports whether the session may proceed.
+func (s *Server) admitSetup(w moqt.SetupResponseWriter, r *moqt.SetupRequest) bool {
+	reason, retryAfter := s.overloaded(r.Path)
+	if reason == "" {
+		return true
+	}
+	sessionsRefused.WithLabelValues(reason).Inc()
+	_ = w.Reject(overloadErrorCode(retryAfter))
+	return false
+}
+
+// admitWebTransport answers a WebTransport upgrade with 503 Service
+// Unavailable and a Retry-After header if the relay is overloaded, and
+// reports whether the upgrade may proceed.
+func (s *Server) admitWebTransport(w http.ResponseWriter, r *http.Request) bool {
+	reason, retryAfter := s.overloaded(r.URL.Path)
+	if reason == "" {
+		return true
+	}
+	sessionsRefused.WithLabelValues(reason).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	jsonError(w, http.StatusServiceUnavailable, "relay unavailable: "+reason)
+	return false
+}
@@ -0,0 +1,100 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/gomoqt/quic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryAfter(t *testing.T) {
+	err := fmt.Errorf("dial: %w", &quic.StreamError{
+		ErrorCode: quic.StreamErrorCode(overloadErrorCode(1500 * time.Millisecond)),
+		Remote:    true,
+	})
+	d, ok := RetryAfter(err)
+	require.True(t, ok)
+	assert.Equal(t, 2*time.Second, d, "rounded up")
+
+	_, ok = RetryAfter(&quic.StreamError{ErrorCode: quic.StreamErrorCode(moqt.SetupFailedErrorCode)})
+	assert.False(t, ok)
+	_, ok = RetryAfter(context.Canceled)
+	assert.False(t, ok)
+
+	assert.Equal(t, OverloadErrorCode|0xffff, overloadErrorCode(100*time.Hour), "clamped")
+}
+
+// rejectRecorder is a moqt.SetupResponseWriter that records rejections.
+type rejectRecorder struct {
+	moqt.SetupResponseWriter
+	code *moqt.SessionErrorCode
+}
+
+func (r *rejectRecorder) Reject(code moqt.SessionErrorCode) error {
+	r.code = &code
+	return nil
+}
+
+func TestServer_Overload(t *testing.T) {
+	s := &Server{TLSConfig: &tls.Config{}, Config: &Config{MaxSessions: 1, RetryAfter: 30 * time.Second}}
+	require.NoError(t, s.Configure())
+
+	w := &rejectRecorder{}
+	assert.True(t, s.admitSetup(w, &moqt.SetupRequest{Path: "/"}))
+	assert.Nil(t, w.code)
+
+	// At the session limit
+	s.statusHandler.incrementConnections()
+
+	assert.False(t, s.admitSetup(w, &moqt.SetupRequest{Path: "/"}))
+	require.NotNil(t, w.code)
+	assert.Equal(t, OverloadErrorCode|30, *w.code)
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, s.HandleWebTransport(rec, httptest.NewRequest(http.MethodConnect, "/", nil)))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), overloadSessionLimit)
+
+	// The loopback probe is exempt from the limit, but only with its path
+	s.SelfCheck = &SelfCheck{}
+	probePath := s.SelfCheck.sessionPath()
+	assert.True(t, s.admitSetup(w, &moqt.SetupRequest{Path: probePath}))
+	assert.False(t, s.admitSetup(w, &moqt.SetupRequest{Path: SelfCheckPathPrefix}))
+	assert.NotEqual(t, probePath, (&SelfCheck{}).sessionPath(), "paths are secret per probe")
+	rec = httptest.NewRecorder()
+	assert.True(t, s.admitWebTransport(rec, httptest.NewRequest(http.MethodConnect, probePath, nil)))
+
+	// Draining refuses regardless of the limit
+	s.statusHandler.decrementConnections()
+	reason, _ := s.overloaded("/")
+	assert.Empty(t, reason)
+	require.NoError(t, s.Shutdown(context.Background()))
+	reason, retryAfter := s.overloaded("/")
+	assert.Equal(t, overloadDraining, reason)
+	assert.Equal(t, 30*time.Second, retryAfter)
+	reason, _ = s.overloaded(probePath)
+	assert.Equal(t, overloadDraining, reason, "the probe is refused while draining")
+}
+
+func TestRemoteFetcher_HonorsRetryAfter(t *testing.T) {
+	f := &RemoteFetcher{
+		sessions: make(map[string]*remoteSession),
+		backoff:  map[string]time.Time{"relay-b:4433": time.Now().Add(time.Minute)},
+		client:   &moqt.Client{},
+	}
+
+	f.mu.Lock()
+	_, err := f.getOrDialSession(context.Background(), "relay-b:4433")
+	f.mu.Unlock()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "retrying in")
+}
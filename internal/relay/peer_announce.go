@@ -0,0 +1,314 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+)
+
+// DefaultPeerAnnounceInterval is how often a PeerAnnouncer re-sends its
+// announcements when PeerAnnouncer.Interval is unset.
+const DefaultPeerAnnounceInterval = 10 * time.Second
+
+// PeerAnnouncement is the set of broadcasts a relay announces to its
+// peers, sent as the body of PUT /peer/announce/<relay>. Each push replaces
+// the previous one.
+type PeerAnnouncement struct {
+	Address  string                           `json:"address"` // MoQT endpoint peers dial
+	Paths    []string                         `json:"paths"`
+	Metadata map[string]*sdn.AnnounceMetadata `json:"metadata,omitempty"` // by path
+}
+
+// PeerAnnouncer propagates the relay's local announcements directly to
+// peer relays, so content discovery keeps working while the SDN controller
+// is unavailable. It wraps the relay's AnnounceRegistrar: announcements are
+// passed on to Next and pushed to every peer, immediately on change and
+// every Interval.
+//
+// Propagation is a single hop: a relay only pushes the broadcasts its own
+// publishers announced, so peers that should discover each other must list
+// each other.
+type PeerAnnouncer struct {
+	// Next receives every announcement as well; nil if the relay has no
+	// SDN controller.
+	Next AnnounceRegistrar
+
+	RelayName string   // name peers know this relay by
+	Address   string   // MoQT endpoint peers dial, e.g. "https://relay-a:4433"
+	Peers     []string // HTTP base URLs of peer relays
+	Token     string   // bearer token for the peers' /peer/announce endpoint
+
+	// Interval is how often announcements are re-sent so peers can expire
+	// those of a relay that went away. Zero means DefaultPeerAnnounceInterval.
+	Interval time.Duration
+
+	// Client sends the pushes; nil uses a client with a 5s timeout.
+	Client *http.Client
+
+	mu       sync.Mutex
+	paths    map[string]*sdn.AnnounceMetadata
+	changed  chan struct{}
+	initOnce sync.Once
+}
+
+func (a *PeerAnnouncer) init() {
+	a.initOnce.Do(func() {
+		a.paths = make(map[string]*sdn.AnnounceMetadata)
+		a.changed = make(chan struct{}, 1)
+		if a.Client == nil {
+			a.Client = &http.Client{Timeout: 5 * time.Second}
+		}
+	})
+}
+
+// Register implements AnnounceRegistrar.
+func (a *PeerAnnouncer) Register(broadcastPath string) {
+	if a.Next != nil {
+		a.Next.Register(broadcastPath)
+	}
+	a.set(broadcastPath, nil, true)
+}
+
+// RegisterWithMetadata passes md on to Next if it accepts metadata and to
+// the peers.
+func (a *PeerAnnouncer) RegisterWithMetadata(broadcastPath string, md *sdn.AnnounceMetadata) {
+	if mr, ok := a.Next.(metadataRegistrar); ok {
+		mr.RegisterWithMetadata(broadcastPath, md)
+	} else if a.Next != nil {
+		a.Next.Register(broadcastPath)
+	}
+	a.set(broadcastPath, md, true)
+}
+
+// Deregister implements AnnounceRegistrar.
+func (a *PeerAnnouncer) Deregister(broadcastPath string) {
+	if a.Next != nil {
+		a.Next.Deregister(broadcastPath)
+	}
+	a.set(broadcastPath, nil, false)
+}
+
+func (a *PeerAnnouncer) set(broadcastPath string, md *sdn.AnnounceMetadata, announced bool) {
+	a.init()
+
+	a.mu.Lock()
+	if announced {
+		a.paths[broadcastPath] = md
+	} else {
+		delete(a.paths, broadcastPath)
+	}
+	a.mu.Unlock()
+
+	select {
+	case a.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Run pushes announcements to the peers until ctx is cancelled, then
+// withdraws them.
+func (a *PeerAnnouncer) Run(ctx context.Context) {
+	a.init()
+
+	interval := a.Interval
+	if interval <= 0 {
+		interval = DefaultPeerAnnounceInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	a.pushAll(ctx, a.snapshot())
+	for {
+		select {
+		case <-ctx.Done():
+			withdrawCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			a.pushAll(withdrawCtx, PeerAnnouncement{Address: a.Address, Paths: []string{}})
+			cancel()
+			return
+		case <-a.changed:
+		case <-ticker.C:
+		}
+		a.pushAll(ctx, a.snapshot())
+	}
+}
+
+func (a *PeerAnnouncer) snapshot() PeerAnnouncement {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ann := PeerAnnouncement{Address: a.Address, Paths: []string{}}
+	for _, bp := range slices.Sorted(maps.Keys(a.paths)) {
+		md := a.paths[bp]
+		if md.Private() {
+			continue // peers are not identified; private broadcasts go through the SDN only
+		}
+		ann.Paths = append(ann.Paths, bp)
+		if md != nil {
+			if ann.Metadata == nil {
+				ann.Metadata = make(map[string]*sdn.AnnounceMetadata)
+			}
+			ann.Metadata[bp] = md
+		}
+	}
+	return ann
+}
+
+func (a *PeerAnnouncer) pushAll(ctx context.Context, ann PeerAnnouncement) {
+	body, err := json.Marshal(ann)
+	if err != nil {
+		return
+	}
+	for _, peer := range a.Peers {
+		if err := a.push(ctx, peer, body); err != nil {
+			slog.Warn("peer announce: push failed", "peer", peer, "error", err)
+		}
+	}
+}
+
+func (a *PeerAnnouncer) push(ctx context.Context, peer string, body []byte) error {
+	u := strings.TrimSuffix(peer, "/") + "/peer/announce/" + url.PathEscape(a.RelayName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("peer returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// PeerAnnounceTable holds the announcements peer relays pushed to this
+// relay. RemoteFetcher falls back to it when the SDN controller is
+// unavailable. Entries expire after TTL without a push.
+type PeerAnnounceTable struct {
+	TTL time.Duration
+
+	mu    sync.RWMutex
+	peers map[string]peerAnnounceEntry // relay → latest push
+}
+
+type peerAnnounceEntry struct {
+	PeerAnnouncement
+	Relay      string    `json:"relay"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// NewPeerAnnounceTable creates an empty table whose entries expire after
+// ttl; zero keeps them until replaced.
+func NewPeerAnnounceTable(ttl time.Duration) *PeerAnnounceTable {
+	return &PeerAnnounceTable{
+		TTL:   ttl,
+		peers: make(map[string]peerAnnounceEntry),
+	}
+}
+
+func (t *PeerAnnounceTable) update(relay string, ann PeerAnnouncement) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(ann.Paths) == 0 {
+		delete(t.peers, relay)
+		return
+	}
+	t.peers[relay] = peerAnnounceEntry{PeerAnnouncement: ann, Relay: relay, ReceivedAt: time.Now()}
+}
+
+// entries returns the unexpired entries sorted by relay.
+func (t *PeerAnnounceTable) entries() []peerAnnounceEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	now := time.Now()
+	entries := make([]peerAnnounceEntry, 0, len(t.peers))
+	for _, e := range t.peers {
+		if t.TTL > 0 && now.Sub(e.ReceivedAt) > t.TTL {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b peerAnnounceEntry) int { return strings.Compare(a.Relay, b.Relay) })
+	return entries
+}
+
+// candidates groups the announced broadcasts by path.
+func (t *PeerAnnounceTable) candidates() map[string][]SourceCandidate {
+	candidates := make(map[string][]SourceCandidate)
+	for _, e := range t.entries() {
+		for _, bp := range e.Paths {
+			candidates[bp] = append(candidates[bp], SourceCandidate{Relay: e.Relay, Metadata: e.Metadata[bp]})
+		}
+	}
+	return candidates
+}
+
+// address returns the MoQT endpoint of relay, if it pushed one recently.
+func (t *PeerAnnounceTable) address(relay string) (string, bool) {
+	for _, e := range t.entries() {
+		if e.Relay == relay && e.Address != "" {
+			return e.Address, true
+		}
+	}
+	return "", false
+}
+
+// PeerAnnounceHandlerFunc returns an http.HandlerFunc receiving peer
+// announcements.
+//
+//	PUT /peer/announce/<relay>  — replace <relay>'s announcements (empty paths withdraw)
+//	GET /peer/announce          — list current peer announcements
+func PeerAnnounceHandlerFunc(table *PeerAnnounceTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			entries := table.entries()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{
+				"peers": entries,
+				"count": len(entries),
+			})
+
+		case http.MethodPut:
+			relay := strings.TrimPrefix(r.URL.Path, "/peer/announce/")
+			if relay == "" || relay == r.URL.Path || strings.Contains(relay, "/") {
+				jsonError(w, http.StatusBadRequest, "path must be /peer/announce/<relay>")
+				return
+			}
+			var ann PeerAnnouncement
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&ann); err != nil {
+				jsonError(w, http.StatusBadRequest, "invalid JSON body")
+				return
+			}
+			if len(ann.Paths) > 0 && ann.Address == "" {
+				jsonError(w, http.StatusBadRequest, "address is required")
+				return
+			}
+			table.update(relay, ann)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
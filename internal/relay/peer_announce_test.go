@@ -0,0 +1,176 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingRegistrar struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (r *recordingRegistrar) Register(bp string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paths = append(r.paths, "+"+bp)
+}
+
+func (r *recordingRegistrar) Deregister(bp string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paths = append(r.paths, "-"+bp)
+}
+
+func TestPeerAnnouncer_Propagates(t *testing.T) {
+	table := NewPeerAnnounceTable(time.Minute)
+	handler := PeerAnnounceHandlerFunc(table)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		handler(w, r)
+	}))
+	defer peer.Close()
+
+	next := &recordingRegistrar{}
+	a := &PeerAnnouncer{
+		Next:      next,
+		RelayName: "relay-a",
+		Address:   "https://relay-a:4433",
+		Peers:     []string{peer.URL},
+		Token:     "secret",
+		Interval:  time.Hour,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+
+	a.Register("/live/a")
+	a.RegisterWithMetadata("/live/b", &sdn.AnnounceMetadata{Labels: []string{"hd"}})
+	a.Deregister("/live/a")
+
+	require.Eventually(t, func() bool {
+		c := table.candidates()
+		return len(c) == 1 && len(c["/live/b"]) == 1
+	}, time.Second, 10*time.Millisecond)
+	c := table.candidates()["/live/b"][0]
+	assert.Equal(t, "relay-a", c.Relay)
+	assert.True(t, c.Metadata.HasLabel("hd"))
+	addr, ok := table.address("relay-a")
+	assert.True(t, ok)
+	assert.Equal(t, "https://relay-a:4433", addr)
+
+	next.mu.Lock()
+	assert.Equal(t, []string{"+/live/a", "+/live/b", "-/live/a"}, next.paths, "announcements pass through")
+	next.mu.Unlock()
+
+	// Stopping withdraws the announcements
+	cancel()
+	<-done
+	assert.Empty(t, table.candidates())
+}
+
+func TestPeerAnnouncer_SkipsPrivate(t *testing.T) {
+	a := &PeerAnnouncer{Address: "https://relay-a:4433"}
+	a.Register("/live/public")
+	a.RegisterWithMetadata("/live/private", &sdn.AnnounceMetadata{Visibility: &sdn.Visibility{Tenant: "brand-a"}})
+
+	ann := a.snapshot()
+	assert.Equal(t, []string{"/live/public"}, ann.Paths)
+	assert.Empty(t, ann.Metadata)
+}
+
+func TestPeerAnnounceTable_Expiry(t *testing.T) {
+	table := NewPeerAnnounceTable(time.Minute)
+	table.update("relay-b", PeerAnnouncement{Address: "https://b:4433", Paths: []string{"/x"}})
+
+	table.mu.Lock()
+	e := table.peers["relay-b"]
+	e.ReceivedAt = time.Now().Add(-2 * time.Minute)
+	table.peers["relay-b"] = e
+	table.mu.Unlock()
+
+	assert.Empty(t, table.candidates())
+	_, ok := table.address("relay-b")
+	assert.False(t, ok)
+}
+
+func TestPeerAnnounceHandlerFunc(t *testing.T) {
+	table := NewPeerAnnounceTable(0)
+	handler := PeerAnnounceHandlerFunc(table)
+
+	put := func(path, body string) int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPut, path, strings.NewReader(body)))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusNoContent, put("/peer/announce/relay-b", `{"address":"https://b:4433","paths":["/x"]}`))
+	assert.Equal(t, http.StatusBadRequest, put("/peer/announce/", `{}`))
+	assert.Equal(t, http.StatusBadRequest, put("/peer/announce/relay-c", `{"paths":["/y"]}`), "address required")
+	assert.Equal(t, http.StatusBadRequest, put("/peer/announce/relay-c", `not json`))
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/peer/announce", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp struct {
+		Peers []peerAnnounceEntry `json:"peers"`
+		Count int                 `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, 1, resp.Count)
+	assert.Equal(t, "relay-b", resp.Peers[0].Relay)
+	assert.Equal(t, []string{"/x"}, resp.Peers[0].Paths)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/peer/announce/relay-b", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestRemoteFetcher_PeerFallback(t *testing.T) {
+	peers := NewPeerAnnounceTable(time.Minute)
+	peers.update("relay-b", PeerAnnouncement{Address: "https://b:4433", Paths: []string{"/remote/stream"}})
+
+	// SDN controller down
+	sdnSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer sdnSrv.Close()
+	sdnClient, err := sdn.NewClient(sdn.ClientConfig{URL: sdnSrv.URL, RelayName: "relay-a", HeartbeatInterval: time.Hour})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for name, f := range map[string]*RemoteFetcher{
+		"sdn unavailable": {SDNClient: sdnClient, Peers: peers},
+		"no sdn":          {Peers: peers},
+	} {
+		t.Run(name, func(t *testing.T) {
+			candidates, _, err := f.candidates(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []SourceCandidate{{Relay: "relay-b"}}, candidates["/remote/stream"])
+
+			hop, err := f.nextHop(ctx, "relay-b")
+			require.NoError(t, err)
+			assert.Equal(t, "relay-b", hop.name)
+			assert.Equal(t, "https://b:4433", hop.address)
+			assert.Zero(t, hop.fecStripes)
+
+			_, err = f.nextHop(ctx, "relay-x")
+			assert.Error(t, err)
+		})
+	}
+
+	_, _, err = (&RemoteFetcher{SDNClient: sdnClient}).candidates(ctx)
+	assert.Error(t, err, "no fallback without peers")
+}
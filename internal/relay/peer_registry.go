@@ -1,51 +1,92 @@
 package relay
 
 import (
-	"fmt"
+	"sort"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/okdaichi/gomoqt/moqt"
 )
 
+// endedSessionTTL is how long an ended session is remembered so a client
+// reconnecting with its ID can be correlated.
+const endedSessionTTL = 10 * time.Minute
+
 // peerInfo holds metadata about a connected peer.
 type peerInfo struct {
-	ID          string    `json:"peer_id"`
-	ConnectedAt time.Time `json:"connected_at"`
+	ID          string     `json:"session_id"`
+	PreviousID  string     `json:"previous_session_id,omitempty"`
+	Reconnects  int        `json:"reconnects"` // length of the reconnect chain ending here
+	ConnectedAt time.Time  `json:"connected_at"`
+	Version     string     `json:"version,omitempty"` // negotiated MoQ version
+	QUIC        *QUICStats `json:"quic,omitempty"`    // nil for connections of other listeners
 	session     *moqt.Session
 }
 
-// peerCounter generates unique peer IDs.
-var peerCounter atomic.Uint64
+// endedSession is what the registry remembers of a closed session.
+type endedSession struct {
+	reconnects int
+	endedAt    time.Time
+}
 
 // peerRegistry tracks connected peers in a thread-safe manner.
 type peerRegistry struct {
 	mu    sync.RWMutex
 	peers map[string]*peerInfo
+	ended map[string]endedSession
 }
 
 // newPeerRegistry creates a new peer registry.
 func newPeerRegistry() *peerRegistry {
 	return &peerRegistry{
 		peers: make(map[string]*peerInfo),
+		ended: make(map[string]endedSession),
 	}
 }
 
-// register adds a peer from the given session and returns the peer ID.
-func (r *peerRegistry) register(sess *moqt.Session) string {
-	id := fmt.Sprintf("peer-%d", peerCounter.Add(1))
+// register adds a peer with session ID id. previous is the ID the client
+// presented from an earlier session, or "". It returns the registered
+// peer.
+func (r *peerRegistry) register(sess *moqt.Session, id, previous string) peerInfo {
+	now := time.Now()
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.peers[id] = &peerInfo{
+	for eid, e := range r.ended {
+		if now.Sub(e.endedAt) > endedSessionTTL {
+			delete(r.ended, eid)
+		}
+	}
+
+	p := &peerInfo{
 		ID:          id,
-		ConnectedAt: time.Now(),
+		PreviousID:  previous,
+		ConnectedAt: now,
 		session:     sess,
 	}
+	if previous != "" {
+		// The prior session may still be draining, or it may have ended
+		// on this relay or elsewhere.
+		p.Reconnects = 1
+		if prior, ok := r.peers[previous]; ok {
+			p.Reconnects = prior.Reconnects + 1
+		} else if prior, ok := r.ended[previous]; ok {
+			p.Reconnects = prior.reconnects + 1
+		}
+	}
+	r.peers[id] = p
 
-	return id
+	return *p
+}
+
+// setVersion records the MoQ version negotiated for peer id.
+func (r *peerRegistry) setVersion(id, version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.peers[id]; ok {
+		p.Version = version
+	}
 }
 
 // deregister removes a peer by its ID.
@@ -53,21 +94,36 @@ func (r *peerRegistry) deregister(id string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if p, ok := r.peers[id]; ok {
+		r.ended[id] = endedSession{reconnects: p.Reconnects, endedAt: time.Now()}
+	}
 	delete(r.peers, id)
 }
 
-// listPeers returns a snapshot of all currently connected peers.
+// listPeers returns a snapshot of all currently connected peers, oldest
+// first.
 func (r *peerRegistry) listPeers() []peerInfo {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	peers := make([]peerInfo, 0, len(r.peers))
 	for _, p := range r.peers {
-		peers = append(peers, peerInfo{
+		info := peerInfo{
 			ID:          p.ID,
+			PreviousID:  p.PreviousID,
+			Reconnects:  p.Reconnects,
 			ConnectedAt: p.ConnectedAt,
-		})
+			Version:     p.Version,
+		}
+		if p.session != nil {
+			if conn := quicConnFromContext(p.session.Context()); conn != nil {
+				stats := newQUICStats(conn.ConnectionStats())
+				info.QUIC = &stats
+			}
+		}
+		peers = append(peers, info)
 	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
 	return peers
 }
 
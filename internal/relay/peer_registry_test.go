@@ -113,3 +113,35 @@ func TestPeerRegistry_ListPeersSnapshot(t *testing.T) {
 		t.Error("ListPeers should return a copy, not a reference")
 	}
 }
+
+func TestPeerRegistry_ReconnectChain(t *testing.T) {
+	r := newPeerRegistry()
+
+	first := r.register(nil, "s1", "")
+	if first.Reconnects != 0 {
+		t.Fatalf("expected 0 reconnects, got %d", first.Reconnects)
+	}
+	r.deregister("s1")
+
+	second := r.register(nil, "s2", "s1")
+	if second.Reconnects != 1 || second.PreviousID != "s1" {
+		t.Fatalf("unexpected second session: %+v", second)
+	}
+
+	// Reconnect while the previous session is still registered.
+	third := r.register(nil, "s3", "s2")
+	if third.Reconnects != 2 {
+		t.Fatalf("expected 2 reconnects, got %d", third.Reconnects)
+	}
+
+	// A previous ID the registry never saw still counts as a reconnect.
+	other := r.register(nil, "s4", "elsewhere")
+	if other.Reconnects != 1 {
+		t.Fatalf("expected 1 reconnect, got %d", other.Reconnects)
+	}
+
+	peers := r.listPeers()
+	if len(peers) != 3 || peers[0].ID != "s2" || peers[1].ID != "s3" {
+		t.Fatalf("unexpected peers: %+v", peers)
+	}
+}
@@ -0,0 +1,330 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// PublicationSource tells where a publication registered on the TrackMux
+// came from.
+type PublicationSource string
+
+const (
+	// SourceLocal is a broadcast announced by a publisher connected to
+	// this relay.
+	SourceLocal PublicationSource = "local"
+
+	// SourceRemote is a broadcast published by RemoteFetcher on behalf of
+	// another relay.
+	SourceRemote PublicationSource = "remote"
+)
+
+// Publication describes one handler registered on the TrackMux.
+type Publication struct {
+	BroadcastPath string            `json:"broadcast_path"`
+	Source        PublicationSource `json:"source"`
+	SourceRelay   string            `json:"source_relay,omitempty"` // remote only
+	CreatedAt     time.Time         `json:"created_at"`
+	LastActivity  time.Time         `json:"last_activity"` // last subscribe, or CreatedAt
+	Active        bool              `json:"active"`
+}
+
+// publicationEntry is the registry's record of a publication.
+type publicationEntry struct {
+	id          uint64
+	path        string
+	source      PublicationSource
+	sourceRelay string
+	createdAt   time.Time
+
+	mux     *moqt.TrackMux
+	handler *RelayHandler
+	alive   func() bool
+}
+
+// publicationRegistry tracks every publication the relay puts on a TrackMux
+// so leaked handlers can be audited and collected.
+type publicationRegistry struct {
+	nextID atomic.Uint64
+
+	mu      sync.Mutex
+	entries map[uint64]*publicationEntry
+
+	// claimMu serializes claims with the mux registrations they guard.
+	claimMu sync.Mutex
+
+	// onCollect is called for every dead entry removed by gc, with leaked
+	// set when the mux still routed the path to the dead handler.
+	onCollect func(source PublicationSource, leaked bool)
+}
+
+// globalPublications is shared by Server and RemoteFetcher.
+var globalPublications = newPublicationRegistry()
+
+func newPublicationRegistry() *publicationRegistry {
+	return &publicationRegistry{
+		entries: make(map[uint64]*publicationEntry),
+	}
+}
+
+// add records a publication and returns its id. alive reports whether the
+// publication's announcement is still active.
+func (r *publicationRegistry) add(mux *moqt.TrackMux, path string, source PublicationSource, sourceRelay string, handler *RelayHandler, alive func() bool) uint64 {
+	e := &publicationEntry{
+		id:          r.nextID.Add(1),
+		path:        path,
+		source:      source,
+		sourceRelay: sourceRelay,
+		createdAt:   time.Now(),
+		mux:         mux,
+		handler:     handler,
+		alive:       alive,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[e.id] = e
+	return e.id
+}
+
+// claim arbitrates between local and remote publications of path on mux,
+// before one is registered: a local publisher takes precedence, so its
+// claim withdraws the live remote publications of the path, and a remote
+// claim is refused while a local publication is live. Until release is
+// called, after registering on the mux and recording the publication with
+// add, other claims wait.
+func (r *publicationRegistry) claim(mux *moqt.TrackMux, path string, source PublicationSource) (ok bool, release func()) {
+	r.claimMu.Lock()
+	release = r.claimMu.Unlock
+
+	r.mu.Lock()
+	var remote []*publicationEntry
+	local := false
+	for _, e := range r.entries {
+		if e.mux != mux || e.path != path || !e.alive() {
+			continue
+		}
+		switch e.source {
+		case SourceLocal:
+			local = true
+		case SourceRemote:
+			remote = append(remote, e)
+		}
+	}
+	r.mu.Unlock()
+
+	if source == SourceRemote {
+		if local {
+			slog.Warn("publication conflict: path is published locally, not fetching it remotely",
+				"broadcast_path", path)
+			publicationConflicts.WithLabelValues("remote_suppressed").Inc()
+			return false, release
+		}
+		return true, release
+	}
+
+	for _, e := range remote {
+		slog.Warn("publication conflict: local publisher takes over a remotely fetched path",
+			"broadcast_path", path,
+			"source_relay", e.sourceRelay)
+		publicationConflicts.WithLabelValues("remote_withdrawn").Inc()
+		if e.handler.withdraw != nil {
+			e.handler.withdraw()
+		}
+	}
+	return true, release
+}
+
+// list returns all known publications sorted by broadcast path.
+func (r *publicationRegistry) list() []Publication {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pubs := make([]Publication, 0, len(r.entries))
+	for _, e := range r.entries {
+		last := e.createdAt
+		if t := e.handler.lastActive(); t.After(last) {
+			last = t
+		}
+		pubs = append(pubs, Publication{
+			BroadcastPath: e.path,
+			Source:        e.source,
+			SourceRelay:   e.sourceRelay,
+			CreatedAt:     e.createdAt,
+			LastActivity:  last,
+			Active:        e.alive(),
+		})
+	}
+	sort.Slice(pubs, func(i, j int) bool {
+		if pubs[i].BroadcastPath != pubs[j].BroadcastPath {
+			return pubs[i].BroadcastPath < pubs[j].BroadcastPath
+		}
+		return pubs[i].CreatedAt.Before(pubs[j].CreatedAt)
+	})
+	return pubs
+}
+
+// handler returns the handler of the newest live publication of path, or
+// nil if there is none.
+func (r *publicationRegistry) handler(path string) *RelayHandler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var newest *publicationEntry
+	for _, e := range r.entries {
+		if e.path != path || !e.alive() {
+			continue
+		}
+		if newest == nil || e.createdAt.After(newest.createdAt) {
+			newest = e
+		}
+	}
+	if newest == nil {
+		return nil
+	}
+	return newest.handler
+}
+
+// distributors returns the tracks relayed by live publications.
+func (r *publicationRegistry) distributors() []*trackDistributor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ds []*trackDistributor
+	for _, e := range r.entries {
+		if !e.alive() {
+			continue
+		}
+		e.handler.mu.RLock()
+		for _, d := range e.handler.relaying {
+			ds = append(ds, d)
+		}
+		e.handler.mu.RUnlock()
+	}
+	return ds
+}
+
+// count returns the number of registered publications per source.
+func (r *publicationRegistry) count() map[PublicationSource]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := map[PublicationSource]int{SourceLocal: 0, SourceRemote: 0}
+	for _, e := range r.entries {
+		counts[e.source]++
+	}
+	return counts
+}
+
+// gc removes entries whose announcement has ended and returns how many
+// were removed. A dead entry whose handler is still routed by the mux is a
+// leak; it is logged and reported through onCollect.
+func (r *publicationRegistry) gc() int {
+	r.mu.Lock()
+	var dead []*publicationEntry
+	for id, e := range r.entries {
+		if !e.alive() {
+			dead = append(dead, e)
+			delete(r.entries, id)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, e := range dead {
+		leaked := false
+		if e.mux != nil {
+			_, h := e.mux.TrackHandler(moqt.BroadcastPath(e.path))
+			leaked = h == moqt.TrackHandler(e.handler)
+		}
+		if leaked {
+			slog.Warn("publication leaked on track mux",
+				"broadcast_path", e.path,
+				"source", e.source,
+				"age", time.Since(e.createdAt))
+		}
+		if r.onCollect != nil {
+			r.onCollect(e.source, leaked)
+		}
+	}
+	return len(dead)
+}
+
+// StartPublicationSweeper runs a background goroutine that garbage-collects
+// ended publications every interval. It stops when ctx is cancelled.
+func StartPublicationSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				globalPublications.gc()
+			}
+		}
+	}()
+}
+
+// Publications returns every publication the relay has registered on its
+// TrackMux that has not yet been garbage-collected.
+func Publications() []Publication {
+	return globalPublications.list()
+}
+
+// handlers returns the handlers of live publications.
+func (r *publicationRegistry) handlers() []*RelayHandler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var hs []*RelayHandler
+	for _, e := range r.entries {
+		if e.alive() {
+			hs = append(hs, e.handler)
+		}
+	}
+	return hs
+}
+
+// IdleCollection reports what CollectIdle released.
+type IdleCollection struct {
+	Publications int `json:"publications"` // ended publications removed
+	Tracks       int `json:"tracks"`       // upstream subscriptions closed
+}
+
+// CollectIdle garbage-collects ended publications, as the publication
+// sweeper does, and closes the upstream subscriptions of relayed tracks no
+// subscriber is reading, such as prefetched ones.
+func CollectIdle() IdleCollection {
+	c := IdleCollection{Publications: globalPublications.gc()}
+	for _, h := range globalPublications.handlers() {
+		c.Tracks += h.releaseIdle()
+	}
+	return c
+}
+
+// ErrTrackNotRelayed is returned by FlushTrackCache for a track the relay
+// is not relaying.
+var ErrTrackNotRelayed = errors.New("track is not being relayed")
+
+// FlushTrackCache evicts the cached groups of a relayed track but the
+// latest, which may still be arriving, and returns how many it evicted.
+// Subscribers behind the evicted groups skip ahead to the latest.
+func FlushTrackCache(path, track string) (int, error) {
+	h := globalPublications.handler(path)
+	if h == nil {
+		return 0, ErrTrackNotRelayed
+	}
+	d := h.distributor(moqt.TrackName(track))
+	if d == nil {
+		return 0, ErrTrackNotRelayed
+	}
+	return d.ring.trim(1), nil
+}
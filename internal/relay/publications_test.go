@@ -0,0 +1,221 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicationRegistry_ListAndCount(t *testing.T) {
+	r := newPublicationRegistry()
+	local := &RelayHandler{}
+	r.add(nil, "/live/b", SourceLocal, "", local, func() bool { return true })
+	r.add(nil, "/live/a", SourceRemote, "relay-tokyo", &RelayHandler{}, func() bool { return false })
+
+	local.lastActivity.Store(time.Now().Add(time.Hour).UnixNano())
+
+	pubs := r.list()
+	require.Len(t, pubs, 2)
+	assert.Equal(t, "/live/a", pubs[0].BroadcastPath)
+	assert.Equal(t, SourceRemote, pubs[0].Source)
+	assert.Equal(t, "relay-tokyo", pubs[0].SourceRelay)
+	assert.False(t, pubs[0].Active)
+	assert.Equal(t, pubs[0].CreatedAt, pubs[0].LastActivity, "no subscribe yet")
+	assert.True(t, pubs[1].Active)
+	assert.True(t, pubs[1].LastActivity.After(pubs[1].CreatedAt))
+
+	assert.Equal(t, map[PublicationSource]int{SourceLocal: 1, SourceRemote: 1}, r.count())
+}
+
+func TestPublicationRegistry_GC(t *testing.T) {
+	mux := moqt.NewTrackMux()
+	r := newPublicationRegistry()
+
+	type collected struct {
+		source PublicationSource
+		leaked bool
+	}
+	var got []collected
+	r.onCollect = func(s PublicationSource, leaked bool) {
+		got = append(got, collected{s, leaked})
+	}
+
+	// Ended and removed from the mux: a clean collection.
+	ctx, cancel := context.WithCancel(context.Background())
+	clean := &RelayHandler{}
+	mux.Publish(ctx, "/live/clean", clean)
+	r.add(mux, "/live/clean", SourceRemote, "relay-a", clean, func() bool { return ctx.Err() == nil })
+	cancel()
+
+	// Reported dead but still routed by the mux: a leak.
+	leakCtx, leakCancel := context.WithCancel(context.Background())
+	defer leakCancel()
+	leaked := &RelayHandler{}
+	mux.Publish(leakCtx, "/live/leaked", leaked)
+	r.add(mux, "/live/leaked", SourceLocal, "", leaked, func() bool { return false })
+
+	// Still alive: kept.
+	r.add(mux, "/live/alive", SourceLocal, "", &RelayHandler{}, func() bool { return true })
+
+	require.Eventually(t, func() bool {
+		ann, _ := mux.TrackHandler("/live/clean")
+		return ann == nil
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 2, r.gc())
+	assert.ElementsMatch(t, []collected{{SourceRemote, false}, {SourceLocal, true}}, got)
+
+	pubs := r.list()
+	require.Len(t, pubs, 1)
+	assert.Equal(t, "/live/alive", pubs[0].BroadcastPath)
+	assert.Equal(t, 0, r.gc())
+}
+
+func TestPublicationsHandlerFunc(t *testing.T) {
+	prev := globalPublications
+	globalPublications = newPublicationRegistry()
+	t.Cleanup(func() { globalPublications = prev })
+
+	globalPublications.add(nil, "/live/a", SourceLocal, "", &RelayHandler{}, func() bool { return true })
+	globalPublications.add(nil, "/live/b", SourceRemote, "relay-b", &RelayHandler{}, func() bool { return false })
+
+	handler := PublicationsHandlerFunc()
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/publications", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Publications []Publication `json:"publications"`
+		Count        int           `json:"count"`
+		Collected    *int          `json:"collected"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, 2, body.Count)
+	assert.Nil(t, body.Collected)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/publications", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body.Collected = nil
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, 1, body.Count)
+	require.NotNil(t, body.Collected)
+	assert.Equal(t, 1, *body.Collected)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/admin/publications", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestCollectIdle(t *testing.T) {
+	prev := globalPublications
+	globalPublications = newPublicationRegistry()
+	t.Cleanup(func() { globalPublications = prev })
+
+	busy := &trackDistributor{subscribers: make(map[chan struct{}]struct{})}
+	busy.subscribe()
+	h := &RelayHandler{relaying: map[moqt.TrackName]*trackDistributor{
+		"video": busy,
+		"audio": {subscribers: make(map[chan struct{}]struct{})},
+	}}
+	globalPublications.add(nil, "/live/alive", SourceLocal, "", h, func() bool { return true })
+	globalPublications.add(nil, "/live/ended", SourceRemote, "relay-a", &RelayHandler{}, func() bool { return false })
+
+	assert.Equal(t, IdleCollection{Publications: 1, Tracks: 1}, CollectIdle())
+}
+
+func TestFlushTrackCache(t *testing.T) {
+	prev := globalPublications
+	globalPublications = newPublicationRegistry()
+	t.Cleanup(func() { globalPublications = prev })
+
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+	for seq := range 3 {
+		ring.add(&fakeGroupSource{seq: moqt.GroupSequence(seq + 1), frames: []string{"x"}, end: io.EOF}, nil)
+	}
+	h := &RelayHandler{relaying: map[moqt.TrackName]*trackDistributor{"video": {ring: ring}}}
+	globalPublications.add(nil, "/live/room", SourceLocal, "", h, func() bool { return true })
+
+	n, err := FlushTrackCache("/live/room", "video")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.Len(t, ring.list(), 1)
+	assert.Equal(t, uint64(3), ring.list()[0].Sequence)
+
+	_, err = FlushTrackCache("/live/room", "audio")
+	assert.ErrorIs(t, err, ErrTrackNotRelayed)
+	_, err = FlushTrackCache("/live/other", "video")
+	assert.ErrorIs(t, err, ErrTrackNotRelayed)
+}
+
+func TestPublicationRegistry_ClaimLocalAfterRemote(t *testing.T) {
+	reg := newPublicationRegistry()
+	mux := moqt.NewTrackMux()
+
+	// RemoteFetcher publishes /live/room on behalf of relay-b...
+	ok, release := reg.claim(mux, "/live/room", SourceRemote)
+	require.True(t, ok)
+	pathCtx, withdraw := context.WithCancel(context.Background())
+	defer withdraw()
+	remote := &RelayHandler{path: "/live/room", withdraw: withdraw}
+	mux.Publish(pathCtx, "/live/room", remote)
+	reg.add(mux, "/live/room", SourceRemote, "relay-b", remote, func() bool { return pathCtx.Err() == nil })
+	release()
+
+	// ... when a publisher announces it here
+	before := testutil.ToFloat64(publicationConflicts.WithLabelValues("remote_withdrawn"))
+	ann, end := moqt.NewAnnouncement(context.Background(), "/live/room")
+	defer end()
+	local := &RelayHandler{Announcement: ann}
+	ok, release = reg.claim(mux, "/live/room", SourceLocal)
+	require.True(t, ok)
+	mux.Announce(ann, local)
+	reg.add(mux, "/live/room", SourceLocal, "", local, ann.IsActive)
+	release()
+
+	assert.Error(t, pathCtx.Err(), "the remote publication is withdrawn")
+	assert.Equal(t, before+1, testutil.ToFloat64(publicationConflicts.WithLabelValues("remote_withdrawn")))
+	_, h := mux.TrackHandler("/live/room")
+	assert.Same(t, local, h)
+	assert.Same(t, local, reg.handler("/live/room"))
+}
+
+func TestPublicationRegistry_ClaimRemoteAfterLocal(t *testing.T) {
+	reg := newPublicationRegistry()
+	mux := moqt.NewTrackMux()
+
+	ann, end := moqt.NewAnnouncement(context.Background(), "/live/room")
+	local := &RelayHandler{Announcement: ann}
+	_, release := reg.claim(mux, "/live/room", SourceLocal)
+	mux.Announce(ann, local)
+	reg.add(mux, "/live/room", SourceLocal, "", local, ann.IsActive)
+	release()
+
+	before := testutil.ToFloat64(publicationConflicts.WithLabelValues("remote_suppressed"))
+	ok, release := reg.claim(mux, "/live/room", SourceRemote)
+	release()
+	assert.False(t, ok, "a remote fetch must not replace a local publisher")
+	assert.Equal(t, before+1, testutil.ToFloat64(publicationConflicts.WithLabelValues("remote_suppressed")))
+	_, h := mux.TrackHandler("/live/room")
+	assert.Same(t, local, h)
+
+	// Once the publisher leaves, the path may be fetched remotely again
+	end()
+	ok, release = reg.claim(mux, "/live/room", SourceRemote)
+	release()
+	assert.True(t, ok)
+
+	// Claims are per mux: another virtual host is unaffected
+	ok, release = reg.claim(moqt.NewTrackMux(), "/live/room", SourceRemote)
+	release()
+	assert.True(t, ok)
+}
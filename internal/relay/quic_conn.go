@@ -0,0 +1,41 @@
+package relay
+
+import (
+	"context"
+	"sync/atomic"
+
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// quicConnKey is the context key of a connection's quicConnSlot.
+type quicConnKey struct{}
+
+// quicConnSlot makes a QUIC connection reachable from the contexts derived
+// from its own, such as the context of the MoQ session it carries. The
+// transport puts an empty slot into the connection's context before the
+// connection exists; the listener fills it on accept.
+type quicConnSlot struct {
+	conn atomic.Pointer[quicgo.Conn]
+}
+
+// quicConnContext is the quicgo.Transport ConnContext of the relay's
+// listeners.
+func quicConnContext(ctx context.Context, _ *quicgo.ClientInfo) (context.Context, error) {
+	return context.WithValue(ctx, quicConnKey{}, &quicConnSlot{}), nil
+}
+
+// bindQUICConn fills the slot in conn's context, if any.
+func bindQUICConn(conn *quicgo.Conn) {
+	if slot, ok := conn.Context().Value(quicConnKey{}).(*quicConnSlot); ok {
+		slot.conn.Store(conn)
+	}
+}
+
+// quicConnFromContext returns the QUIC connection whose context ctx derives
+// from, or nil if the relay's listeners did not accept it.
+func quicConnFromContext(ctx context.Context) *quicgo.Conn {
+	if slot, ok := ctx.Value(quicConnKey{}).(*quicConnSlot); ok {
+		return slot.conn.Load()
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package relay
+
+import (
+	"context"
+	"time"
+
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// quicStatsInterval is how often the QUIC stats of each session are
+// sampled into the metrics.
+const quicStatsInterval = 10 * time.Second
+
+// QUICStats are the transport figures of a session's QUIC connection, as
+// listed in /admin/sessions. QUIC never retransmits a packet: the frames
+// of lost packets are sent again in new ones, so PacketsLost also counts
+// the retransmissions.
+type QUICStats struct {
+	MinRTTMs      float64 `json:"min_rtt_ms"`
+	SmoothedRTTMs float64 `json:"smoothed_rtt_ms"`
+	LatestRTTMs   float64 `json:"latest_rtt_ms"`
+	RTTVarMs      float64 `json:"rtt_var_ms"`
+
+	BytesSent       uint64 `json:"bytes_sent"`
+	BytesReceived   uint64 `json:"bytes_received"`
+	BytesLost       uint64 `json:"bytes_lost"`
+	PacketsSent     uint64 `json:"packets_sent"`
+	PacketsReceived uint64 `json:"packets_received"`
+	PacketsLost     uint64 `json:"packets_lost"`
+}
+
+// newQUICStats converts the stats quic-go keeps for a connection.
+func newQUICStats(s quicgo.ConnectionStats) QUICStats {
+	return QUICStats{
+		MinRTTMs:        durationMs(s.MinRTT),
+		SmoothedRTTMs:   durationMs(s.SmoothedRTT),
+		LatestRTTMs:     durationMs(s.LatestRTT),
+		RTTVarMs:        durationMs(s.MeanDeviation),
+		BytesSent:       s.BytesSent,
+		BytesReceived:   s.BytesReceived,
+		BytesLost:       s.BytesLost,
+		PacketsSent:     s.PacketsSent,
+		PacketsReceived: s.PacketsReceived,
+		PacketsLost:     s.PacketsLost,
+	}
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// quicStatsSampler feeds the stats of a connection into the metrics.
+type quicStatsSampler struct {
+	conn *quicgo.Conn
+	last quicgo.ConnectionStats
+}
+
+// run samples every interval until ctx is cancelled, then once more.
+func (s *quicStatsSampler) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer s.sample()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sample()
+		}
+	}
+}
+
+// sample observes the connection's RTT and counts the packets sent and
+// lost since the last sample.
+func (s *quicStatsSampler) sample() {
+	stats := s.conn.ConnectionStats()
+	if stats.SmoothedRTT > 0 {
+		sessionRTT.Observe(stats.SmoothedRTT.Seconds())
+	}
+	quicPackets.WithLabelValues("sent").Add(float64(stats.PacketsSent - s.last.PacketsSent))
+	quicPackets.WithLabelValues("received").Add(float64(stats.PacketsReceived - s.last.PacketsReceived))
+	quicPackets.WithLabelValues("lost").Add(float64(stats.PacketsLost - s.last.PacketsLost))
+	quicLostBytes.Add(float64(stats.BytesLost - s.last.BytesLost))
+	s.last = stats
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/quic"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	quicgo "github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQUICStats(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	sockets, err := ListenUDP("127.0.0.1:0")
+	require.NoError(t, err)
+	defer sockets.Close()
+	ln, err := sockets.ListenFunc("", serverTLS, &quic.Config{})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	client, err := quicgo.DialAddr(ctx, sockets.Addr().String(), clientTLS, nil)
+	require.NoError(t, err)
+	defer client.CloseWithError(0, "")
+	server, err := ln.Accept(ctx)
+	require.NoError(t, err)
+	roundTrip(t, client, server, "stats")
+
+	// The connection is reachable from contexts derived from its own
+	conn := quicConnFromContext(context.WithValue(server.Context(), sessionIDKey{}, nil))
+	require.NotNil(t, conn)
+
+	stats := newQUICStats(conn.ConnectionStats())
+	assert.Positive(t, stats.SmoothedRTTMs)
+	assert.Positive(t, stats.PacketsSent)
+	assert.Positive(t, stats.BytesReceived)
+
+	sent := testutil.ToFloat64(quicPackets.WithLabelValues("sent"))
+	sampler := &quicStatsSampler{conn: conn}
+	sampler.sample()
+	assert.Equal(t, float64(sampler.last.PacketsSent), testutil.ToFloat64(quicPackets.WithLabelValues("sent"))-sent)
+
+	assert.Nil(t, quicConnFromContext(context.Background()))
+}
@@ -0,0 +1,321 @@
+package relay
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recording retention. Recorded and archived broadcasts are kept below
+// RecordingRetention.Dir, one directory per broadcast path: the recording
+// of "/live/cam1" is everything below Dir/live/cam1. A background purger
+// applies the retention policy of the longest matching path prefix to each
+// recording file, and DELETE /admin/recordings/<path> purges a recording on
+// demand. Only files in a recording format are ever removed; anything else
+// kept below Dir is left alone. Reclaimed space is counted in
+// qumo_relay_recordings_purged_bytes_total.
+
+// DefaultRetentionInterval is how often RecordingRetention enforces its
+// policies by default.
+const DefaultRetentionInterval = time.Minute
+
+// DefaultRecordingExtensions are the file extensions of recording files if
+// RecordingRetention.Extensions is unset: groups stored as written by
+// DebugCapture, one <sequence>.group file each.
+var DefaultRecordingExtensions = []string{".group"}
+
+// RetentionPolicy limits the recordings below a broadcast path prefix.
+type RetentionPolicy struct {
+	// Prefix selects the broadcast paths the policy applies to, on path
+	// segment boundaries: "/live" matches "/live/cam1" but not "/lively".
+	// "/" matches every path.
+	Prefix string
+
+	// MaxAge purges recording files last written longer ago. Zero keeps
+	// them regardless of age.
+	MaxAge time.Duration
+
+	// MaxBytes caps the total size of the recordings the policy applies
+	// to; the oldest files are purged first. Zero is unlimited.
+	MaxBytes int64
+}
+
+// RecordingRetention enforces retention policies on the recordings below
+// Dir.
+type RecordingRetention struct {
+	// Dir is the root of the recordings.
+	Dir string
+
+	// Policies are matched to each recording file by the longest prefix of
+	// its broadcast path. Files no policy matches are kept.
+	Policies []RetentionPolicy
+
+	// Interval is how often the policies are enforced. Zero uses
+	// DefaultRetentionInterval.
+	Interval time.Duration
+
+	// Extensions are the file extensions of recording files, such as
+	// ".group". Files with other extensions are never purged. Empty uses
+	// DefaultRecordingExtensions.
+	Extensions []string
+
+	mu sync.Mutex // serializes purges
+}
+
+// PurgeResult reports what a purge removed.
+type PurgeResult struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// recordingFile is a recording file below RecordingRetention.Dir.
+type recordingFile struct {
+	name    string // OS path
+	path    string // broadcast path of the recording it belongs to
+	size    int64
+	modTime time.Time
+}
+
+// Run enforces the retention policies every Interval until ctx is
+// cancelled.
+func (r *RecordingRetention) Run(ctx context.Context) {
+	ticker := time.NewTicker(cmp.Or(r.Interval, DefaultRetentionInterval))
+	defer ticker.Stop()
+
+	for {
+		r.enforce(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enforce purges the files over their policy's age or size limit as of now.
+func (r *RecordingRetention) enforce(now time.Time) (aged, sized PurgeResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, err := r.files(r.Dir)
+	if err != nil {
+		slog.Warn("failed to scan recordings", "dir", r.Dir, "error", err)
+		return
+	}
+
+	// Oldest first, so size limits drop the oldest files
+	slices.SortFunc(files, func(a, b recordingFile) int { return a.modTime.Compare(b.modTime) })
+
+	var dirs []string
+	used := make(map[int]int64, len(r.Policies))
+	for i := len(files) - 1; i >= 0; i-- { // newest first, keeping the newest within MaxBytes
+		f := files[i]
+		p, ok := r.policy(f.path)
+		if !ok {
+			continue
+		}
+		policy := r.Policies[p]
+
+		reason, res := "", (*PurgeResult)(nil)
+		switch {
+		case policy.MaxAge > 0 && now.Sub(f.modTime) > policy.MaxAge:
+			reason, res = "age", &aged
+		case policy.MaxBytes > 0 && used[p]+f.size > policy.MaxBytes:
+			reason, res = "size", &sized
+		default:
+			used[p] += f.size
+			continue
+		}
+		if err := os.Remove(f.name); err != nil {
+			slog.Warn("failed to purge recording file", "file", f.name, "error", err)
+			continue
+		}
+		res.Files++
+		res.Bytes += f.size
+		recordingsPurgedBytes.WithLabelValues(reason).Add(float64(f.size))
+		recordingsPurgedFiles.WithLabelValues(reason).Inc()
+		dirs = append(dirs, filepath.Dir(f.name))
+	}
+	r.pruneDirs(dirs)
+
+	if aged.Files > 0 || sized.Files > 0 {
+		slog.Info("purged recordings",
+			"aged_files", aged.Files, "aged_bytes", aged.Bytes,
+			"sized_files", sized.Files, "sized_bytes", sized.Bytes)
+	}
+	return aged, sized
+}
+
+// Purge removes the recording files of broadcastPath and everything
+// recorded below it, and the directories that leaves empty.
+func (r *RecordingRetention) Purge(broadcastPath string) (PurgeResult, error) {
+	var res PurgeResult
+	name, err := r.recordingDir(broadcastPath)
+	if err != nil {
+		return res, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, err := r.files(name)
+	if err != nil {
+		return res, err
+	}
+	if len(files) == 0 {
+		return res, fs.ErrNotExist
+	}
+	var errs []error
+	dirs := make([]string, 0, len(files))
+	for _, f := range files {
+		if err := os.Remove(f.name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res.Files++
+		res.Bytes += f.size
+		dirs = append(dirs, filepath.Dir(f.name))
+	}
+	recordingsPurgedBytes.WithLabelValues("manual").Add(float64(res.Bytes))
+	recordingsPurgedFiles.WithLabelValues("manual").Add(float64(res.Files))
+	r.pruneDirs(dirs)
+	if err := errors.Join(errs...); err != nil {
+		return res, err
+	}
+
+	slog.Info("purged recording", "broadcast_path", broadcastPath, "files", res.Files, "bytes", res.Bytes)
+	return res, nil
+}
+
+// errInvalidRecordingPath is returned for broadcast paths that do not name
+// a recording below Dir.
+var errInvalidRecordingPath = errors.New("invalid recording path")
+
+// recordingDir returns the OS path of the recording of broadcastPath.
+func (r *RecordingRetention) recordingDir(broadcastPath string) (string, error) {
+	clean := path.Clean("/" + broadcastPath)
+	if clean == "/" || strings.Contains(broadcastPath, "\\") || clean != "/"+strings.Trim(broadcastPath, "/") {
+		return "", errInvalidRecordingPath
+	}
+	return filepath.Join(r.Dir, filepath.FromSlash(clean)), nil
+}
+
+// files returns the recording files below root, which is Dir or a
+// directory below it. A missing root has none.
+func (r *RecordingRetention) files(root string) ([]recordingFile, error) {
+	exts := r.Extensions
+	if len(exts) == 0 {
+		exts = DefaultRecordingExtensions
+	}
+	var files []recordingFile
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || !slices.Contains(exts, filepath.Ext(name)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed meanwhile
+		}
+		rel, err := filepath.Rel(r.Dir, filepath.Dir(name))
+		if err != nil {
+			return err
+		}
+		files = append(files, recordingFile{
+			name:    name,
+			path:    path.Clean("/" + filepath.ToSlash(rel)),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	return files, err
+}
+
+// policy returns the index of the policy with the longest prefix matching
+// broadcastPath.
+func (r *RecordingRetention) policy(broadcastPath string) (int, bool) {
+	best, bestLen := -1, -1
+	for i, p := range r.Policies {
+		prefix := strings.TrimSuffix(p.Prefix, "/")
+		if broadcastPath != prefix && !strings.HasPrefix(broadcastPath, prefix+"/") {
+			continue
+		}
+		if len(prefix) > bestLen {
+			best, bestLen = i, len(prefix)
+		}
+	}
+	return best, best >= 0
+}
+
+// pruneDirs removes the directories purges left empty, up to but not
+// including Dir.
+func (r *RecordingRetention) pruneDirs(dirs []string) {
+	root := filepath.Clean(r.Dir)
+	for _, dir := range dirs {
+		for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			if os.Remove(dir) != nil { // not empty
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+}
+
+// RecordingsHandlerFunc returns an http.HandlerFunc that purges recordings
+// on demand. It is mounted at prefix; the rest of the URL is the broadcast
+// path, whose segments may be percent-encoded.
+//
+//	DELETE <prefix><path>
+func RecordingsHandlerFunc(r *RecordingRetention, prefix string) http.HandlerFunc {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		broadcastPath, err := url.PathUnescape(strings.TrimPrefix(req.URL.EscapedPath(), prefix))
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, errInvalidRecordingPath.Error())
+			return
+		}
+		res, err := r.Purge(broadcastPath)
+		switch {
+		case errors.Is(err, errInvalidRecordingPath):
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, fs.ErrNotExist):
+			jsonError(w, http.StatusNotFound, "no recording at this path")
+			return
+		case err != nil:
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"broadcast_path": path.Clean("/" + broadcastPath),
+			"files":          res.Files,
+			"bytes":          res.Bytes,
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRecording writes a recording file of size bytes, last modified at.
+func writeRecording(t *testing.T, dir, name string, size int, at time.Time) string {
+	t.Helper()
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+	require.NoError(t, os.WriteFile(file, make([]byte, size), 0o644))
+	require.NoError(t, os.Chtimes(file, at, at))
+	return file
+}
+
+func TestRecordingRetention_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := writeRecording(t, dir, "live/cam1/000.group", 100, now.Add(-2*time.Hour))
+	recent := writeRecording(t, dir, "live/cam1/001.group", 100, now.Add(-time.Minute))
+	other := writeRecording(t, dir, "vod/movie/000.group", 100, now.Add(-48*time.Hour))
+	gone := writeRecording(t, dir, "live/cam2/000.group", 50, now.Add(-3*time.Hour))
+	foreign := writeRecording(t, dir, "live/cam3/notes.txt", 10, now.Add(-3*time.Hour))
+
+	r := &RecordingRetention{Dir: dir, Policies: []RetentionPolicy{{Prefix: "/live", MaxAge: time.Hour}}}
+	before := testutil.ToFloat64(recordingsPurgedBytes.WithLabelValues("age"))
+	aged, sized := r.enforce(now)
+
+	assert.Equal(t, PurgeResult{Files: 2, Bytes: 150}, aged)
+	assert.Zero(t, sized)
+	assert.NoFileExists(t, old)
+	assert.NoFileExists(t, gone)
+	assert.NoDirExists(t, filepath.Dir(gone), "emptied recording directories are removed")
+	assert.FileExists(t, recent)
+	assert.FileExists(t, other, "no policy matches /vod")
+	assert.FileExists(t, foreign, "only recording files are purged")
+	assert.Equal(t, 150.0, testutil.ToFloat64(recordingsPurgedBytes.WithLabelValues("age"))-before)
+}
+
+func TestRecordingRetention_MaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	var files []string
+	for i := range 4 {
+		files = append(files, writeRecording(t, dir, "live/cam1/"+string(rune('a'+i))+".group", 100, now.Add(time.Duration(i-4)*time.Minute)))
+	}
+	small := writeRecording(t, dir, "live/special/a.group", 300, now.Add(-time.Hour))
+
+	r := &RecordingRetention{Dir: dir, Policies: []RetentionPolicy{
+		{Prefix: "/", MaxBytes: 250},
+		{Prefix: "/live/special/", MaxBytes: 1000},
+	}}
+	_, sized := r.enforce(now)
+
+	assert.Equal(t, PurgeResult{Files: 2, Bytes: 200}, sized)
+	assert.NoFileExists(t, files[0], "oldest purged first")
+	assert.NoFileExists(t, files[1])
+	assert.FileExists(t, files[2])
+	assert.FileExists(t, files[3])
+	assert.FileExists(t, small, "the longest prefix's policy applies")
+}
+
+func TestRecordingRetention_MissingDir(t *testing.T) {
+	r := &RecordingRetention{Dir: filepath.Join(t.TempDir(), "none"), Policies: []RetentionPolicy{{Prefix: "/", MaxAge: time.Second}}}
+	aged, sized := r.enforce(time.Now())
+	assert.Zero(t, aged)
+	assert.Zero(t, sized)
+}
+
+func TestRecordingsHandler(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeRecording(t, dir, "live/cam1/000.group", 100, now)
+	writeRecording(t, dir, "live/cam1/hd/000.group", 60, now)
+	keep := writeRecording(t, dir, "live/cam10/000.group", 10, now)
+	foreign := writeRecording(t, dir, "live/cam1/hd/index.json", 5, now)
+
+	handler := RecordingsHandlerFunc(&RecordingRetention{Dir: dir}, "/admin/recordings/")
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	before := testutil.ToFloat64(recordingsPurgedBytes.WithLabelValues("manual"))
+	rec := do(http.MethodDelete, "/admin/recordings/live/cam1")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		BroadcastPath string `json:"broadcast_path"`
+		Files         int    `json:"files"`
+		Bytes         int64  `json:"bytes"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, "/live/cam1", body.BroadcastPath)
+	assert.Equal(t, 2, body.Files)
+	assert.EqualValues(t, 160, body.Bytes)
+	assert.Equal(t, 160.0, testutil.ToFloat64(recordingsPurgedBytes.WithLabelValues("manual"))-before)
+	assert.NoFileExists(t, filepath.Join(dir, "live", "cam1", "000.group"))
+	assert.FileExists(t, foreign, "only recording files are purged")
+	assert.FileExists(t, keep)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/admin/recordings/live/cam1").Code)
+	require.NoError(t, os.Remove(foreign))
+	writeRecording(t, dir, "live/cam2/000.mp4", 10, now)
+	rec = do(http.MethodDelete, "/admin/recordings/live/cam2")
+	assert.Equal(t, http.StatusNotFound, rec.Code, "files with other extensions are not recordings")
+
+	r := &RecordingRetention{Dir: dir, Extensions: []string{".mp4"}}
+	res, err := r.Purge("/live/cam2")
+	require.NoError(t, err)
+	assert.Equal(t, PurgeResult{Files: 1, Bytes: 10}, res)
+	assert.NoDirExists(t, filepath.Join(dir, "live", "cam2"), "emptied recording directories are removed")
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodGet, "/admin/recordings/live/cam10").Code)
+	for _, target := range []string{"/admin/recordings/", "/admin/recordings/live/%2E%2E/%2E%2E", "/admin/recordings/live//cam10"} {
+		rec := do(http.MethodDelete, target)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+		assert.True(t, strings.Contains(rec.Body.String(), "invalid recording path"), target)
+	}
+	assert.FileExists(t, keep)
+}
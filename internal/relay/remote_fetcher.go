@@ -1,15 +1,34 @@
 package relay
 
 import (
+	"cmp"
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/okdaichi/gomoqt/moqt"
 	"github.com/okdaichi/gomoqt/quic"
 	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// SDNDirectory answers the RemoteFetcher's questions to the SDN: which
+// relays announce what, how to reach them and what to prefetch.
+// *sdn.Client and *sdn.Group implement it.
+type SDNDirectory interface {
+	ListAll(ctx context.Context) ([]sdn.AnnounceEntry, error)
+	Route(ctx context.Context, to string) (topology.RouteResult, error)
+	PrefetchTasks(ctx context.Context) ([]sdn.PrefetchTask, *topology.MaintenanceWindow, error)
+}
+
+var (
+	_ SDNDirectory = (*sdn.Client)(nil)
+	_ SDNDirectory = (*sdn.Group)(nil)
 )
 
 // RemoteFetcher discovers remote broadcast paths via the SDN controller
@@ -18,10 +37,23 @@ import (
 //
 // It periodically polls the SDN announce table and, for each broadcast
 // path that is not locally available, dials the appropriate relay and
-// subscribes.
+// subscribes. With Peers set, it falls back to the announcements peer
+// relays pushed directly while the SDN controller is unavailable.
 type RemoteFetcher struct {
 	// SDNClient is used to query the SDN controller for announcements and routes.
-	SDNClient *sdn.Client
+	// It may be nil if Peers is set.
+	SDNClient SDNDirectory
+
+	// SDNReady, if set, is closed once the relay first registered with the
+	// SDN. Until then the fetcher asks the SDN nothing and relies on the
+	// peer announcements, if any, so a relay started before its controller
+	// does not fail every poll.
+	SDNReady <-chan struct{}
+
+	// Peers holds announcements pushed by peer relays. Their broadcasts
+	// are fetched straight from the announcing relay. Nil disables the
+	// fallback.
+	Peers *PeerAnnounceTable
 
 	// TrackMux is the local mux where remote handlers are registered.
 	TrackMux *moqt.TrackMux
@@ -33,19 +65,124 @@ type RemoteFetcher struct {
 	QUICConfig *quic.Config
 
 	// PollInterval is how often to query the SDN for new announcements.
-	// Default: 5s.
+	// After the first poll only the changes are transferred (see
+	// sdn.Client.ListAll). Default: 5s.
 	PollInterval time.Duration
 
 	// GroupCacheSize for relay handlers created for remote tracks.
 	GroupCacheSize int
 
+	// GroupStallTimeout is how long a group of a remote track may go
+	// without a frame before it is closed as stalled. Zero means
+	// DefaultGroupStallTimeout and a negative value disables the timeout.
+	GroupStallTimeout time.Duration
+
+	// GroupBudgets cap how long the groups of the matching remote tracks
+	// may stay open; see GroupBudget.
+	GroupBudgets []GroupBudget
+
+	// EgressWriteTimeout bounds how long one frame write to a subscriber
+	// of a remote track may block. Zero means DefaultEgressWriteTimeout
+	// and a negative value disables the deadline.
+	EgressWriteTimeout time.Duration
+
+	// FECRecoveryWait is how long a group truncated on a hop with FEC
+	// waits for its parity before it is passed on truncated. Zero means
+	// DefaultFECRecoveryWait.
+	FECRecoveryWait time.Duration
+
 	// FramePool shared across remote relay handlers.
 	FramePool *FramePool
 
+	// Authorizer is applied to subscribers of remote tracks.
+	// If nil, all subscriptions are allowed.
+	Authorizer Authorizer
+
+	// EgressPool, if set, writes the frames of the remote tracks' subscribers;
+	// see Server.EgressPool.
+	EgressPool *EgressPool
+
+	// PeerIdentities are the downstream relays served private remote
+	// broadcasts; see RelayHandler.Peers.
+	PeerIdentities []string
+
+	// SourcePolicy picks the relay to fetch from when several relays
+	// announce the same broadcast path. It returns an index into candidates,
+	// which are in SDN order and never empty. Nil selects the first one.
+	SourcePolicy func(broadcastPath string, candidates []SourceCandidate) int
+
+	// Prefetch asks the SDN controller on every poll which remote
+	// broadcasts its replication policy wants this relay to hold, and
+	// starts relaying their tracks without waiting for a subscriber.
+	// Prefetched tracks stay cached until the broadcast ends, until the
+	// controller cordons this relay for maintenance, or once the
+	// controller no longer asks for them and no subscriber read them for
+	// PrefetchIdleTimeout (default DefaultPrefetchIdleTimeout).
+	Prefetch            bool
+	PrefetchIdleTimeout time.Duration
+
+	// Integrity, if set, verifies the groups relayed from each next hop
+	// against the checksums it computed.
+	Integrity *IntegrityVerifier
+
+	// Compression, if set, selects the broadcasts whose tracks are fetched
+	// zstd compressed from the next hop.
+	Compression *TrackCompression
+
+	// ChainedFetch, if set, has each relay on the SDN's full path to the
+	// source fetch the broadcast from the next one on it.
+	ChainedFetch *ChainedFetch
+
+	// WarmFile, if set, is where the fetcher records the remote broadcasts
+	// it relayed and their tracks. On start it fetches the ones served
+	// within WarmMaxAge (default DefaultWarmMaxAge) before closing Ready,
+	// waiting at most WarmTimeout (default DefaultWarmTimeout).
+	WarmFile    string
+	WarmMaxAge  time.Duration
+	WarmTimeout time.Duration
+
+	readyInit sync.Once
+	readyDone sync.Once
+	ready     chan struct{}
+
 	mu       sync.Mutex
-	sessions map[string]*remoteSession // address → session
-	tracked  map[string]*trackedPath   // broadcastPath → tracked state
+	sessions map[string]*remoteSession  // address → session
+	tracked  map[string]*trackedPath    // broadcastPath → tracked state
+	chained  map[string]SourceCandidate // broadcastPath → source, fetched on request of a downstream relay
+	backoff  map[string]time.Time       // address → no dial before
 	client   *moqt.Client
+	cordoned bool // in a maintenance window, per the latest prefetch poll
+
+	listFailing atomic.Bool // the last poll failed to list announcements
+
+	// Set by Run for fetches requested by other relays
+	runCtx context.Context
+	gcSize int
+	pool   *FramePool
+
+	warm        map[string]*warmEntry // broadcastPath → record
+	warmSaved   time.Time
+	warmChecked time.Time // previous recordWarm
+}
+
+// SourceCandidate is a relay announcing a broadcast path, as seen by
+// RemoteFetcher.SourcePolicy.
+type SourceCandidate struct {
+	Relay    string
+	Metadata *sdn.AnnounceMetadata // nil if the relay sent none
+}
+
+// PreferLabel returns a SourcePolicy that picks the first candidate carrying
+// label, falling back to the first candidate.
+func PreferLabel(label string) func(string, []SourceCandidate) int {
+	return func(_ string, candidates []SourceCandidate) int {
+		for i, c := range candidates {
+			if c.Metadata.HasLabel(label) {
+				return i
+			}
+		}
+		return 0
+	}
 }
 
 // remoteSession holds a connection to a remote relay.
@@ -54,25 +191,28 @@ type remoteSession struct {
 	refCount int
 }
 
+// hopRoute is where the fetcher dials for a source relay's broadcasts.
+type hopRoute struct {
+	name, address string
+	fecStripes    int // FEC the SDN configured on the hop, 0 for none
+
+	// path continues the route from the next hop to the source relay,
+	// for ChainedFetch; nil if unknown.
+	path []string
+}
+
 // trackedPath holds the state for a single remote broadcast path,
 // enabling route re-computation on failure.
 type trackedPath struct {
 	cancel      context.CancelFunc
 	sourceRelay string
+	visibility  *sdn.Visibility // of the source's announcement; nil if public
 	nextHopAddr string
+	handler     *RelayHandler
 }
 
 // Run starts the periodic poll loop. It blocks until ctx is cancelled.
 func (f *RemoteFetcher) Run(ctx context.Context) {
-	f.mu.Lock()
-	f.sessions = make(map[string]*remoteSession)
-	f.tracked = make(map[string]*trackedPath)
-	f.client = &moqt.Client{
-		TLSConfig:  f.TLSConfig,
-		QUICConfig: f.QUICConfig,
-	}
-	f.mu.Unlock()
-
 	interval := f.PollInterval
 	if interval <= 0 {
 		interval = 5 * time.Second
@@ -88,14 +228,34 @@ func (f *RemoteFetcher) Run(ctx context.Context) {
 		pool = DefaultFramePool
 	}
 
+	f.mu.Lock()
+	f.sessions = make(map[string]*remoteSession)
+	f.tracked = make(map[string]*trackedPath)
+	f.chained = make(map[string]SourceCandidate)
+	f.client = &moqt.Client{
+		TLSConfig:  f.TLSConfig,
+		QUICConfig: f.QUICConfig,
+	}
+	f.runCtx, f.gcSize, f.pool = ctx, gcSize, pool
+	f.mu.Unlock()
+
 	slog.Info("remote fetcher started", "poll_interval", interval)
 
+	if f.Integrity != nil {
+		go f.Integrity.run(ctx, f.integrityTargets)
+	}
+
+	f.preload(ctx, gcSize, pool)
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
+			f.mu.Lock()
+			f.recordWarm(true)
+			f.mu.Unlock()
 			f.cleanup()
 			return
 		case <-ticker.C:
@@ -107,26 +267,41 @@ func (f *RemoteFetcher) Run(ctx context.Context) {
 // poll queries the SDN for all announcements and registers handlers for
 // any broadcast paths not yet locally available.
 func (f *RemoteFetcher) poll(ctx context.Context, gcSize int, pool *FramePool) {
-	entries, err := f.SDNClient.ListAll(ctx)
-	if err != nil {
-		slog.Warn("remote fetcher: failed to list announcements", "error", err)
+	candidates, fromSDN, err := f.candidates(ctx)
+	switch {
+	case errors.Is(err, errSDNNotReady):
+		slog.Debug("remote fetcher: waiting for the SDN registration")
+		return
+	case err != nil:
+		// Warn once per outage rather than on every poll
+		if !f.listFailing.Swap(true) {
+			slog.Warn("remote fetcher: failed to list announcements", "error", err)
+		} else {
+			slog.Debug("remote fetcher: failed to list announcements", "error", err)
+		}
 		return
+	case f.listFailing.Swap(false):
+		slog.Info("remote fetcher: listing announcements again")
 	}
 
 	// Build set of currently announced remote broadcast paths
-	remoteSet := make(map[string]string) // broadcastPath → relay name
-	for _, e := range entries {
-		// Keep the first relay found for each broadcast path
-		if _, exists := remoteSet[e.BroadcastPath]; !exists {
-			remoteSet[e.BroadcastPath] = e.Relay
-		}
+	remoteSet := make(map[string]SourceCandidate, len(candidates)) // broadcastPath → source
+	for bp, cands := range candidates {
+		remoteSet[bp] = f.selectSource(bp, cands)
+	}
+
+	// Asked before taking f.mu, which the round trip must not hold
+	var plan *prefetchPlan
+	if f.Prefetch && f.SDNClient != nil && f.sdnReady() {
+		plan = f.fetchPrefetchPlan(ctx)
 	}
 
 	f.mu.Lock()
-	defer f.mu.Unlock()
+
+	f.keepChained(remoteSet, fromSDN)
 
 	// Register new remote paths
-	for bp, relay := range remoteSet {
+	for bp, source := range remoteSet {
 		if _, already := f.tracked[bp]; already {
 			continue // already tracking
 		}
@@ -139,7 +314,7 @@ func (f *RemoteFetcher) poll(ctx context.Context, gcSize int, pool *FramePool) {
 		}
 
 		// Need to fetch remotely
-		f.startRemoteHandler(ctx, bp, relay, gcSize, pool)
+		f.startRemoteHandler(ctx, bp, source, gcSize, pool)
 	}
 
 	// Remove tracked paths that are no longer in the remote set
@@ -160,81 +335,375 @@ func (f *RemoteFetcher) poll(ctx context.Context, gcSize int, pool *FramePool) {
 				"old_next_hop", tp.nextHopAddr)
 			tp.cancel()
 			delete(f.tracked, bp)
+			globalEvents.emit(Event{
+				Type:          EventFailover,
+				BroadcastPath: bp,
+				Source:        tp.sourceRelay,
+				NextHop:       tp.nextHopAddr,
+			})
 
 			// Re-start with fresh route computation
-			relay := remoteSet[bp]
-			if relay == "" {
-				relay = tp.sourceRelay
+			source, ok := remoteSet[bp]
+			if !ok {
+				source = SourceCandidate{Relay: tp.sourceRelay}
+				if tp.visibility != nil {
+					source.Metadata = &sdn.AnnounceMetadata{Visibility: tp.visibility}
+				}
 			}
-			f.startRemoteHandler(ctx, bp, relay, gcSize, pool)
+			f.startRemoteHandler(ctx, bp, source, gcSize, pool)
+		}
+	}
+
+	var prefetches []prefetchTrack
+	var releases []prefetchRelease
+	if plan != nil {
+		prefetches, releases = f.planPrefetch(plan)
+	}
+
+	f.recordWarm(false)
+	f.mu.Unlock()
+
+	f.runPrefetch(prefetches, releases)
+}
+
+// keepChained adds the broadcasts downstream relays asked for to
+// remoteSet while only the peer announcements are listed, and forgets them
+// once the SDN does not list them anymore. Caller must hold f.mu.
+func (f *RemoteFetcher) keepChained(remoteSet map[string]SourceCandidate, fromSDN bool) {
+	for bp, source := range f.chained {
+		if _, listed := remoteSet[bp]; listed {
+			continue
+		}
+		if fromSDN {
+			delete(f.chained, bp)
+		} else {
+			remoteSet[bp] = source
 		}
 	}
 }
 
+// errSDNNotReady is returned by candidates while the relay has not yet
+// registered with the SDN and has no peers to ask instead.
+var errSDNNotReady = errors.New("not registered with the SDN yet")
+
+// sdnReady reports whether the relay registered with the SDN; see
+// SDNReady.
+func (f *RemoteFetcher) sdnReady() bool {
+	if f.SDNReady == nil {
+		return true
+	}
+	select {
+	case <-f.SDNReady:
+		return true
+	default:
+		return false
+	}
+}
+
+// candidates lists the relays announcing each broadcast path, in SDN
+// order, and reports whether the SDN listed them. Without a reachable SDN
+// controller it uses the peer announcements.
+func (f *RemoteFetcher) candidates(ctx context.Context) (map[string][]SourceCandidate, bool, error) {
+	if f.SDNClient != nil && !f.sdnReady() && f.Peers == nil {
+		return nil, false, errSDNNotReady
+	}
+	if f.SDNClient != nil && f.sdnReady() {
+		entries, err := f.SDNClient.ListAll(ctx)
+		if err == nil {
+			candidates := make(map[string][]SourceCandidate)
+			for _, e := range entries {
+				candidates[e.BroadcastPath] = append(candidates[e.BroadcastPath],
+					SourceCandidate{Relay: e.Relay, Metadata: e.Metadata})
+			}
+			return candidates, true, nil
+		}
+		if f.Peers == nil {
+			return nil, false, err
+		}
+		slog.Warn("remote fetcher: SDN unavailable, using peer announcements", "error", err)
+	}
+	if f.Peers == nil {
+		return nil, false, errors.New("no SDN controller or peers configured")
+	}
+	return f.Peers.candidates(), false, nil
+}
+
+// nextHop returns the relay to dial for sourceRelay's broadcasts: the SDN
+// route's next hop, or sourceRelay itself if a peer announcement says
+// where it is.
+func (f *RemoteFetcher) nextHop(ctx context.Context, sourceRelay string) (hopRoute, error) {
+	if f.SDNClient != nil && f.sdnReady() {
+		route, err := f.SDNClient.Route(ctx, sourceRelay)
+		if err == nil {
+			if route.NextHopAddress == "" {
+				return hopRoute{}, fmt.Errorf("next hop %s has no address", route.NextHop)
+			}
+			hop := hopRoute{name: route.NextHop, address: route.NextHopAddress, fecStripes: route.NextHopFEC}
+			if len(route.FullPath) >= 2 {
+				hop.path = route.FullPath[1:]
+			}
+			return hop, nil
+		}
+		if f.Peers == nil {
+			return hopRoute{}, fmt.Errorf("route query failed: %w", err)
+		}
+	}
+	if f.Peers != nil {
+		if addr, ok := f.Peers.address(sourceRelay); ok {
+			return hopRoute{name: sourceRelay, address: addr}, nil
+		}
+	}
+	return hopRoute{}, fmt.Errorf("no route to %s", sourceRelay)
+}
+
+// DefaultPrefetchIdleTimeout is how long a prefetched track the controller
+// no longer asks for is kept without a subscriber if
+// RemoteFetcher.PrefetchIdleTimeout is unset.
+const DefaultPrefetchIdleTimeout = 5 * time.Minute
+
+// prefetchPlan is the SDN's answer to a prefetch poll.
+type prefetchPlan struct {
+	tasks       []sdn.PrefetchTask
+	maintenance *topology.MaintenanceWindow
+}
+
+// prefetchTrack is a track to start relaying.
+type prefetchTrack struct {
+	handler *RelayHandler
+	path    string
+	name    moqt.TrackName
+}
+
+// prefetchRelease is a handler whose idle tracks are to be released: all
+// of them while cordoned, else the prefetched ones not in keep.
+type prefetchRelease struct {
+	handler *RelayHandler
+	path    string
+	all     bool
+	keep    map[moqt.TrackName]bool
+}
+
+// fetchPrefetchPlan asks the SDN which broadcasts this relay should
+// replicate. It returns nil if the SDN could not be asked.
+func (f *RemoteFetcher) fetchPrefetchPlan(ctx context.Context) *prefetchPlan {
+	tasks, maintenance, err := f.SDNClient.PrefetchTasks(ctx)
+	if err != nil {
+		slog.Warn("remote fetcher: failed to fetch prefetch tasks", "error", err)
+		return nil
+	}
+	return &prefetchPlan{tasks: tasks, maintenance: maintenance}
+}
+
+// planPrefetch turns plan into the tracks to start relaying and the
+// handlers whose idle tracks to release, for runPrefetch to carry out once
+// f.mu is released. While the relay is cordoned for maintenance it
+// releases the tracks nobody reads instead, so the controller can move its
+// prefetches to other relays. Caller must hold f.mu.
+func (f *RemoteFetcher) planPrefetch(plan *prefetchPlan) ([]prefetchTrack, []prefetchRelease) {
+	var releases []prefetchRelease
+	if m := plan.maintenance; m != nil {
+		for bp, tp := range f.tracked {
+			if tp.handler != nil {
+				releases = append(releases, prefetchRelease{handler: tp.handler, path: bp, all: true})
+			}
+		}
+		if !f.cordoned {
+			slog.Info("remote fetcher: relay cordoned for maintenance, releasing prefetches",
+				"until", m.End, "reason", m.Reason)
+		}
+		f.cordoned = true
+		return nil, releases
+	}
+	if f.cordoned {
+		slog.Info("remote fetcher: maintenance ended, resuming prefetches")
+		f.cordoned = false
+	}
+
+	var tracks []prefetchTrack
+	wanted := make(map[string]map[moqt.TrackName]bool)
+	for _, task := range plan.tasks {
+		tp, ok := f.tracked[task.Path]
+		if !ok || tp.handler == nil {
+			continue // local, or not reachable yet
+		}
+		keep := wanted[task.Path]
+		if keep == nil {
+			keep = make(map[moqt.TrackName]bool)
+			wanted[task.Path] = keep
+		}
+		for _, track := range task.Tracks {
+			keep[moqt.TrackName(track)] = true
+			tracks = append(tracks, prefetchTrack{handler: tp.handler, path: task.Path, name: moqt.TrackName(track)})
+		}
+	}
+	for bp, tp := range f.tracked {
+		if tp.handler != nil {
+			releases = append(releases, prefetchRelease{handler: tp.handler, path: bp, keep: wanted[bp]})
+		}
+	}
+	return tracks, releases
+}
+
+// runPrefetch starts relaying tracks and releases the idle tracks of
+// releases, subscribing and unsubscribing upstream without f.mu.
+func (f *RemoteFetcher) runPrefetch(tracks []prefetchTrack, releases []prefetchRelease) {
+	now, idle := time.Now(), cmp.Or(f.PrefetchIdleTimeout, DefaultPrefetchIdleTimeout)
+	for _, r := range releases {
+		var n int
+		if r.all {
+			n = r.handler.releaseIdle()
+		} else {
+			n = r.handler.releasePrefetched(idle, now, func(name moqt.TrackName) bool { return r.keep[name] })
+		}
+		if n > 0 {
+			slog.Info("remote fetcher: released idle prefetches", "broadcast_path", r.path, "tracks", n)
+		}
+	}
+	for _, t := range tracks {
+		if !t.handler.prefetch(t.name) {
+			slog.Debug("remote fetcher: prefetch failed",
+				"broadcast_path", t.path, "track_name", t.name)
+		}
+	}
+}
+
+// selectSource applies SourcePolicy, defaulting to the first candidate.
+func (f *RemoteFetcher) selectSource(broadcastPath string, candidates []SourceCandidate) SourceCandidate {
+	if f.SourcePolicy != nil {
+		if i := f.SourcePolicy(broadcastPath, candidates); i >= 0 && i < len(candidates) {
+			return candidates[i]
+		}
+	}
+	return candidates[0]
+}
+
 // startRemoteHandler dials the source relay (via SDN routing) and registers
-// a relay handler on the local mux. Caller must hold f.mu.
-func (f *RemoteFetcher) startRemoteHandler(ctx context.Context, broadcastPath, sourceRelay string, gcSize int, pool *FramePool) {
-	// Query SDN for route to source relay
-	route, err := f.SDNClient.Route(ctx, sourceRelay)
+// a relay handler on the local mux, serving the broadcast as privately as
+// the source announced it. Caller must hold f.mu.
+func (f *RemoteFetcher) startRemoteHandler(ctx context.Context, broadcastPath string, source SourceCandidate, gcSize int, pool *FramePool) {
+	// Query SDN (or the peer announcements) for the route to the source relay
+	hop, err := f.nextHop(ctx, source.Relay)
 	if err != nil {
-		slog.Warn("remote fetcher: route query failed",
+		slog.Warn("remote fetcher: no next hop",
 			"broadcast_path", broadcastPath,
-			"target", sourceRelay,
+			"target", source.Relay,
 			"error", err)
 		return
 	}
 
-	nextHopAddr := route.NextHopAddress
-	if nextHopAddr == "" {
-		slog.Warn("remote fetcher: next hop has no address",
-			"broadcast_path", broadcastPath,
-			"next_hop", route.NextHop)
-		return
+	if err := f.startVia(ctx, broadcastPath, source, hop, gcSize, pool); err != nil {
+		slog.Warn("remote fetcher: failed to dial next hop",
+			"address", hop.address,
+			"error", err)
+	}
+}
+
+// startVia registers a handler relaying broadcastPath from hop, first
+// asking hop to fetch it along the rest of the path with ChainedFetch.
+// Caller must hold f.mu.
+func (f *RemoteFetcher) startVia(ctx context.Context, broadcastPath string, source SourceCandidate, hop hopRoute, gcSize int, pool *FramePool) error {
+	sourceRelay := source.Relay
+	nextHop, nextHopAddr, fecStripes := hop.name, hop.address, hop.fecStripes
+	var visibility *sdn.Visibility
+	if source.Metadata.Private() {
+		visibility = source.Metadata.Visibility
+	}
+
+	// Have the next hop fetch from its own next hop on the path
+	if f.ChainedFetch != nil && len(hop.path) > 1 {
+		err := f.ChainedFetch.request(ctx, nextHopAddr, PeerFetchRequest{
+			BroadcastPath: broadcastPath,
+			SourceRelay:   sourceRelay,
+		})
+		if err != nil {
+			slog.Warn("remote fetcher: chained fetch request failed",
+				"broadcast_path", broadcastPath,
+				"next_hop", nextHop,
+				"error", err)
+		}
 	}
 
 	// Get or create session to next hop
 	rs, err := f.getOrDialSession(ctx, nextHopAddr)
 	if err != nil {
-		slog.Warn("remote fetcher: failed to dial next hop",
-			"address", nextHopAddr,
-			"error", err)
-		return
+		return err
+	}
+
+	// A local publisher of the path takes precedence
+	ok, release := globalPublications.claim(f.TrackMux, broadcastPath, SourceRemote)
+	defer release()
+	if !ok {
+		if rs.refCount == 0 {
+			rs.session.CloseWithError(moqt.NoError, "no more remote tracks")
+			delete(f.sessions, nextHopAddr)
+		}
+		return nil
 	}
 
 	// Create a child context that we can cancel when this path is removed
 	pathCtx, cancel := context.WithCancel(ctx)
-	f.tracked[broadcastPath] = &trackedPath{
+	tp := &trackedPath{
 		cancel:      cancel,
 		sourceRelay: sourceRelay,
+		visibility:  visibility,
 		nextHopAddr: nextHopAddr,
 	}
+	f.tracked[broadcastPath] = tp
 	rs.refCount++
 
 	// Register a handler on the local mux via Publish.
 	// The handler subscribes to the remote relay on demand (when a subscriber
 	// requests a track name under this broadcast path).
 	handler := &RelayHandler{
-		Session:        rs.session,
-		GroupCacheSize: gcSize,
-		FramePool:      pool,
-		relaying:       make(map[moqt.TrackName]*trackDistributor),
+		Session:         rs.session,
+		GroupCacheSize:  gcSize,
+		FramePool:       pool,
+		Authorizer:      f.Authorizer,
+		FECStripes:      fecStripes,
+		Compressed:      f.Compression.Matches(broadcastPath),
+		ServeCompressed: f.Compression.Matches(broadcastPath),
+		Visibility:      visibility,
+		Peers:           f.PeerIdentities,
+		path:            moqt.BroadcastPath(broadcastPath),
+		egressPool:      f.EgressPool,
+		relaying:        make(map[moqt.TrackName]*trackDistributor),
+		withdraw:        cancel,
+
+		GroupStallTimeout: groupStallTimeout(f.GroupStallTimeout),
+		GroupBudgets:      f.GroupBudgets,
+
+		EgressWriteTimeout: egressWriteTimeout(f.EgressWriteTimeout),
+		FECRecoveryWait:    cmp.Or(f.FECRecoveryWait, DefaultFECRecoveryWait),
 	}
+	tp.handler = handler
 
 	// Publish registers a virtual announcement + handler.
 	// It stays active until pathCtx is cancelled.
 	f.TrackMux.Publish(pathCtx, moqt.BroadcastPath(broadcastPath), handler)
+	globalPublications.add(f.TrackMux, broadcastPath, SourceRemote, sourceRelay, handler,
+		func() bool { return pathCtx.Err() == nil })
 
 	slog.Info("remote fetcher: registered remote handler",
 		"broadcast_path", broadcastPath,
 		"source_relay", sourceRelay,
-		"next_hop", route.NextHop,
-		"next_hop_addr", nextHopAddr)
+		"next_hop", nextHop,
+		"next_hop_addr", nextHopAddr,
+		"fec_stripes", fecStripes,
+		"compressed", handler.Compressed)
+
+	ev := Event{BroadcastPath: broadcastPath, Source: sourceRelay, NextHop: nextHopAddr}
+	globalEvents.emit(ev.with(EventBroadcastStart))
 
 	// Monitor the path context for cleanup
-	go func() {
+	globalGoroutines.goSpawn(GoroutineFetcher, broadcastPath, func() {
 		<-pathCtx.Done()
+		globalEvents.emit(ev.with(EventBroadcastStop))
 		f.mu.Lock()
 		defer f.mu.Unlock()
+		if f.tracked[broadcastPath] == tp {
+			// withdrawn for a local publisher: fetch again once it leaves
+			delete(f.tracked, broadcastPath)
+		}
 		if rs, ok := f.sessions[nextHopAddr]; ok {
 			rs.refCount--
 			if rs.refCount <= 0 {
@@ -242,7 +711,32 @@ func (f *RemoteFetcher) startRemoteHandler(ctx context.Context, broadcastPath, s
 				delete(f.sessions, nextHopAddr)
 			}
 		}
-	}()
+	})
+	return nil
+}
+
+// integrityTargets lists the public tracks relayed from next hops.
+func (f *RemoteFetcher) integrityTargets() []integrityTarget {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var targets []integrityTarget
+	for bp, tp := range f.tracked {
+		if tp.handler == nil || tp.visibility != nil {
+			continue
+		}
+		tp.handler.mu.RLock()
+		for name, d := range tp.handler.relaying {
+			targets = append(targets, integrityTarget{
+				upstream: tp.nextHopAddr,
+				path:     bp,
+				track:    string(name),
+				ring:     d.ring,
+			})
+		}
+		tp.handler.mu.RUnlock()
+	}
+	return targets
 }
 
 // getOrDialSession returns an existing session or dials a new one.
@@ -257,12 +751,28 @@ func (f *RemoteFetcher) getOrDialSession(ctx context.Context, address string) (*
 		delete(f.sessions, address)
 	}
 
-	// Dial new connection — release lock during dial
+	// Honor the retry-after of a relay that refused us
+	if until, ok := f.backoff[address]; ok {
+		if wait := time.Until(until); wait > 0 {
+			return nil, fmt.Errorf("relay refused the last session; retrying in %s", wait.Round(time.Second))
+		}
+		delete(f.backoff, address)
+	}
+
+	// Dial new connection — release lock during dial. The session offers
+	// the next hop nothing: with f.TrackMux, it would announce the next
+	// hop's own broadcasts back to it, which it would then fetch from us.
 	f.mu.Unlock()
-	sess, err := f.client.Dial(ctx, address, f.TrackMux)
+	sess, err := f.client.Dial(ctx, address, moqt.NewTrackMux())
 	f.mu.Lock()
 
 	if err != nil {
+		if wait, ok := RetryAfter(err); ok {
+			if f.backoff == nil {
+				f.backoff = make(map[string]time.Time)
+			}
+			f.backoff[address] = time.Now().Add(wait)
+		}
 		return nil, err
 	}
 
@@ -280,6 +790,44 @@ func (f *RemoteFetcher) getOrDialSession(ctx context.Context, address string) (*
 	return rs, nil
 }
 
+// ErrNoUpstreams is returned by CheckUpstreams when the fetcher relays
+// nothing from other relays.
+var ErrNoUpstreams = errors.New("no upstream relays")
+
+// CheckUpstreams dials a fresh session to each relay the fetcher relays
+// from and closes it again, returning the failures. Unlike the sessions in
+// use, which may linger on a half-dead path, the dial proves that new
+// subscriptions could still be served.
+func (f *RemoteFetcher) CheckUpstreams(ctx context.Context) error {
+	f.mu.Lock()
+	client := f.client
+	addrs := make([]string, 0, len(f.sessions))
+	for addr := range f.sessions {
+		addrs = append(addrs, addr)
+	}
+	f.mu.Unlock()
+	if client == nil || len(addrs) == 0 {
+		return ErrNoUpstreams
+	}
+
+	errs := make([]error, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sess, err := client.Dial(ctx, addr, moqt.NewTrackMux())
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", addr, err)
+				return
+			}
+			sess.CloseWithError(moqt.NoError, "health check")
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
 // cleanup closes all remote sessions. Called when the fetcher is stopping.
 func (f *RemoteFetcher) cleanup() {
 	f.mu.Lock()
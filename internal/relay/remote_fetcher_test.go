@@ -16,7 +16,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-// announceEntry mirrors sdn.announceEntry for test JSON serialization.
+// AnnounceEntry mirrors sdn.AnnounceEntry for test JSON serialization.
 type testAnnounceEntry struct {
 	Relay         string `json:"relay"`
 	BroadcastPath string `json:"broadcast_path"`
@@ -284,3 +284,105 @@ func TestRemoteFetcher_SkipsNoAddress(t *testing.T) {
 	assert.Empty(t, fetcher.tracked, "should not track paths with no next hop address")
 	fetcher.mu.Unlock()
 }
+
+func TestRemoteFetcher_SelectSource(t *testing.T) {
+	candidates := []SourceCandidate{
+		{Relay: "relay-b"},
+		{Relay: "relay-c", Metadata: &sdn.AnnounceMetadata{Labels: []string{"premium"}}},
+	}
+
+	f := &RemoteFetcher{}
+	assert.Equal(t, "relay-b", f.selectSource("/live/x", candidates).Relay, "default picks first")
+
+	f.SourcePolicy = PreferLabel("premium")
+	assert.Equal(t, "relay-c", f.selectSource("/live/x", candidates).Relay)
+
+	f.SourcePolicy = PreferLabel("missing")
+	assert.Equal(t, "relay-b", f.selectSource("/live/x", candidates).Relay)
+
+	f.SourcePolicy = func(string, []SourceCandidate) int { return 7 }
+	assert.Equal(t, "relay-b", f.selectSource("/live/x", candidates).Relay, "out-of-range index falls back")
+}
+
+func TestRemoteFetcher_SDNReady(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	srv := mockSDN(t, []testAnnounceEntry{{Relay: "relay-b", BroadcastPath: "/remote/stream"}}, nil)
+	defer srv.Close()
+	counting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer counting.Close()
+
+	sdnClient, err := sdn.NewClient(sdn.ClientConfig{URL: counting.URL, RelayName: "relay-a", HeartbeatInterval: time.Hour})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	ready := make(chan struct{})
+	f := &RemoteFetcher{SDNClient: sdnClient, SDNReady: ready}
+	_, _, err = f.candidates(ctx)
+	assert.ErrorIs(t, err, errSDNNotReady)
+
+	// Peers answer until the relay is registered
+	peers := NewPeerAnnounceTable(time.Minute)
+	peers.update("relay-c", PeerAnnouncement{Address: "https://c:4433", Paths: []string{"/peer/stream"}})
+	f.Peers = peers
+	candidates, fromSDN, err := f.candidates(ctx)
+	require.NoError(t, err)
+	assert.False(t, fromSDN)
+	assert.Contains(t, candidates, "/peer/stream")
+	hop, err := f.nextHop(ctx, "relay-c")
+	require.NoError(t, err)
+	assert.Equal(t, "https://c:4433", hop.address)
+
+	mu.Lock()
+	assert.Zero(t, requests, "the SDN is not asked before the relay registered")
+	mu.Unlock()
+
+	close(ready)
+	candidates, fromSDN, err = f.candidates(ctx)
+	require.NoError(t, err)
+	assert.True(t, fromSDN)
+	assert.Contains(t, candidates, "/remote/stream")
+	mu.Lock()
+	assert.Equal(t, 1, requests)
+	mu.Unlock()
+}
+
+func TestRemoteFetcher_PlanPrefetch(t *testing.T) {
+	a, b := &RelayHandler{path: "/live/a"}, &RelayHandler{path: "/live/b"}
+	f := &RemoteFetcher{}
+	f.tracked = map[string]*trackedPath{
+		"/live/a":     {handler: a},
+		"/live/b":     {handler: b},
+		"/live/local": {},
+	}
+
+	tracks, releases := f.planPrefetch(&prefetchPlan{tasks: []sdn.PrefetchTask{
+		{Path: "/live/a", Tracks: []string{"video", "audio"}},
+		{Path: "/live/local", Tracks: []string{"video"}},
+		{Path: "/live/gone", Tracks: []string{"video"}},
+	}})
+	require.Len(t, tracks, 2, "only tracked remote broadcasts are prefetched")
+	assert.Same(t, a, tracks[0].handler)
+	assert.Equal(t, moqt.TrackName("video"), tracks[0].name)
+	require.Len(t, releases, 2)
+	for _, r := range releases {
+		assert.False(t, r.all)
+		if r.handler == a {
+			assert.Equal(t, map[moqt.TrackName]bool{"video": true, "audio": true}, r.keep)
+		} else {
+			assert.Empty(t, r.keep, "prefetches of /live/b are no longer wanted")
+		}
+	}
+
+	// Cordoned: nothing is prefetched and every idle track is released
+	tracks, releases = f.planPrefetch(&prefetchPlan{maintenance: &topology.MaintenanceWindow{Relay: "relay-a"}})
+	assert.Empty(t, tracks)
+	require.Len(t, releases, 2)
+	assert.True(t, releases[0].all && releases[1].all)
+	assert.True(t, f.cordoned)
+}
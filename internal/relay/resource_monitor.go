@@ -0,0 +1,414 @@
+package relay
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for ResourceMonitor.
+const (
+	DefaultResourceInterval = 5 * time.Second
+	DefaultMemoryThreshold  = 0.9
+	DefaultCPUThreshold     = 0.95
+	DefaultResourceSustain  = 3
+)
+
+const (
+	defaultCgroupDir = "/sys/fs/cgroup"
+	selfCgroupFile   = "/proc/self/cgroup"
+)
+
+// Resources a ResourceMonitor reports pressure on.
+const (
+	resourcePressureMemory = "memory"
+	resourcePressureCPU    = "cpu"
+)
+
+// ResourceMonitor watches the relay's memory and CPU usage against the
+// limits of its cgroup (v2, or v1 controllers mounted below CgroupDir).
+// Memory is counted as the working set, as the OOM killer sees it: usage
+// less the inactive page cache the kernel reclaims first.
+// When usage stays above a threshold for Sustain samples, the relay is
+// under pressure until it stays below for as many samples: new sessions
+// are refused with reason resource_pressure, Status reports the pressure
+// so the relay turns not ready, and under memory pressure every relayed
+// track's group cache is shrunk to its KeepGroups latest groups on each
+// sample, ahead of the OOM killer. Transitions are logged; actions are
+// counted in qumo_relay_resource_pressure_actions_total.
+type ResourceMonitor struct {
+	// CgroupDir is the relay's cgroup directory. Empty uses the relay's own
+	// cgroup below /sys/fs/cgroup, as /proc/self/cgroup names it.
+	CgroupDir string
+
+	// Interval between samples. Zero uses DefaultResourceInterval.
+	Interval time.Duration
+
+	// MemoryThreshold and CPUThreshold are the fractions of the limits
+	// above which usage counts as pressure. Zero uses
+	// DefaultMemoryThreshold and DefaultCPUThreshold.
+	MemoryThreshold float64
+	CPUThreshold    float64
+
+	// Sustain is how many consecutive samples start or end pressure. Zero
+	// uses DefaultResourceSustain.
+	Sustain int
+
+	// KeepGroups is how many of the latest groups each relayed track keeps
+	// cached under memory pressure. Zero keeps one.
+	KeepGroups int
+
+	dirsOnce sync.Once
+	dirs     cgroupDirs
+
+	mu      sync.Mutex
+	usage   ResourceUsage
+	over    int // consecutive samples over a threshold
+	under   int // consecutive samples under both thresholds
+	lastCPU time.Duration
+	lastAt  time.Time
+}
+
+// ResourceUsage is the latest sample of a ResourceMonitor.
+type ResourceUsage struct {
+	MemoryBytes int64   `json:"memory_bytes"`                 // working set
+	MemoryLimit int64   `json:"memory_limit_bytes,omitempty"` // 0 = unlimited
+	CPUCores    float64 `json:"cpu_cores"`
+	CPULimit    float64 `json:"cpu_limit_cores"` // the host's CPUs if unlimited
+
+	// Pressure is "memory" or "cpu" while the relay is under pressure.
+	Pressure string `json:"pressure,omitempty"`
+}
+
+// resourcePressure holds the resource the ResourceMonitor found under
+// sustained pressure, or "".
+var resourcePressure atomic.Value
+
+// ResourcePressure returns "memory" or "cpu" while a ResourceMonitor finds
+// the relay under sustained pressure, and "" otherwise.
+func ResourcePressure() string {
+	p, _ := resourcePressure.Load().(string)
+	return p
+}
+
+// Run samples usage every Interval until ctx is cancelled. It returns
+// early, without ever reporting pressure, if the cgroup cannot be read.
+func (m *ResourceMonitor) Run(ctx context.Context) {
+	if err := m.sample(time.Now()); err != nil {
+		slog.Warn("resource monitor: cannot read cgroup limits; disabled", "dir", m.cgroup().v2, "error", err)
+		return
+	}
+	defer m.setPressure("")
+
+	ticker := time.NewTicker(cmp.Or(m.Interval, DefaultResourceInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := m.sample(now); err != nil {
+				slog.Debug("resource monitor: sample failed", "error", err)
+			}
+		}
+	}
+}
+
+// Usage returns the latest sample.
+func (m *ResourceMonitor) Usage() ResourceUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// cgroup returns the directories of the monitored cgroup.
+func (m *ResourceMonitor) cgroup() cgroupDirs {
+	m.dirsOnce.Do(func() {
+		if m.CgroupDir != "" {
+			m.dirs = cgroupDirsAt(m.CgroupDir)
+			return
+		}
+		dirs, err := selfCgroupDirs(defaultCgroupDir, selfCgroupFile)
+		if err != nil {
+			slog.Debug("resource monitor: cannot find own cgroup; using the root", "error", err)
+			dirs = cgroupDirsAt(defaultCgroupDir)
+		}
+		m.dirs = dirs
+	})
+	return m.dirs
+}
+
+// sample reads the cgroup's usage and limits and acts on them.
+func (m *ResourceMonitor) sample(now time.Time) error {
+	dirs := m.cgroup()
+	mem, memLimit, err := readCgroupMemory(dirs)
+	if err != nil {
+		return err
+	}
+	cpu, cpuLimit, err := readCgroupCPU(dirs)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := ResourceUsage{MemoryBytes: mem, MemoryLimit: memLimit, CPULimit: cpuLimit, Pressure: m.usage.Pressure}
+	if !m.lastAt.IsZero() && now.After(m.lastAt) {
+		u.CPUCores = float64(cpu-m.lastCPU) / float64(now.Sub(m.lastAt))
+	}
+	m.lastCPU, m.lastAt = cpu, now
+	m.evaluate(u)
+	return nil
+}
+
+// evaluate records u, moving in or out of pressure after Sustain samples
+// and shrinking caches under memory pressure. Caller must hold m.mu.
+func (m *ResourceMonitor) evaluate(u ResourceUsage) {
+	memOver := u.MemoryLimit > 0 &&
+		float64(u.MemoryBytes) >= cmp.Or(m.MemoryThreshold, DefaultMemoryThreshold)*float64(u.MemoryLimit)
+	cpuOver := u.CPULimit > 0 &&
+		u.CPUCores >= cmp.Or(m.CPUThreshold, DefaultCPUThreshold)*u.CPULimit
+	sustain := cmp.Or(m.Sustain, DefaultResourceSustain)
+
+	if memOver || cpuOver {
+		m.over++
+		m.under = 0
+	} else {
+		m.under++
+		m.over = 0
+	}
+
+	switch {
+	case u.Pressure == "" && m.over >= sustain:
+		u.Pressure = resourcePressureCPU
+		if memOver {
+			u.Pressure = resourcePressureMemory
+		}
+		slog.Warn("resource pressure: refusing new sessions and reporting not ready",
+			"resource", u.Pressure, "memory_bytes", u.MemoryBytes, "memory_limit_bytes", u.MemoryLimit,
+			"cpu_cores", math.Round(u.CPUCores*100)/100, "cpu_limit_cores", u.CPULimit)
+		resourcePressureActions.WithLabelValues("reject_sessions").Inc()
+		resourcePressureActions.WithLabelValues("not_ready").Inc()
+	case u.Pressure != "" && m.under >= sustain:
+		slog.Info("resource pressure relieved", "resource", u.Pressure)
+		u.Pressure = ""
+	case u.Pressure != "" && memOver:
+		u.Pressure = resourcePressureMemory
+	}
+
+	if u.Pressure != "" && memOver {
+		m.shrinkCaches()
+	}
+	m.usage = u
+	m.setPressure(u.Pressure)
+}
+
+// setPressure publishes p to ResourcePressure and the pressure gauge.
+func (m *ResourceMonitor) setPressure(p string) {
+	resourcePressure.Store(p)
+	for _, r := range []string{resourcePressureMemory, resourcePressureCPU} {
+		v := 0.0
+		if r == p {
+			v = 1
+		}
+		resourcePressureGauge.WithLabelValues(r).Set(v)
+	}
+}
+
+// shrinkCaches evicts all but the KeepGroups latest groups of every
+// relayed track.
+func (m *ResourceMonitor) shrinkCaches() {
+	evicted := 0
+	for _, d := range globalPublications.distributors() {
+		if d.ring != nil {
+			evicted += d.ring.trim(m.KeepGroups)
+		}
+	}
+	if evicted == 0 {
+		return
+	}
+	debug.FreeOSMemory()
+	resourcePressureActions.WithLabelValues("shrink_caches").Inc()
+	cacheGroupsShed.Add(float64(evicted))
+	slog.Warn("resource pressure: shrank group caches", "evicted_groups", evicted)
+}
+
+// cgroupDirs are the directories holding a cgroup's files: v2 for the
+// unified hierarchy and v1 for each cgroup v1 controller.
+type cgroupDirs struct {
+	v2 string
+	v1 map[string]string // "memory", "cpu" and "cpuacct" → directory
+}
+
+// cgroupDirsAt returns the directories of the cgroup whose hierarchy is
+// mounted at dir, as inside a container's cgroup namespace.
+func cgroupDirsAt(dir string) cgroupDirs {
+	return cgroupDirs{v2: dir, v1: map[string]string{
+		"memory":  filepath.Join(dir, "memory"),
+		"cpu":     filepath.Join(dir, "cpu"),
+		"cpuacct": filepath.Join(dir, "cpuacct"),
+	}}
+}
+
+// selfCgroupDirs returns the directories of the process's own cgroup as
+// listed in procFile (/proc/self/cgroup), below the hierarchy mounted at
+// root. A listed cgroup that is not visible below root, as in a container
+// without its own cgroup namespace, is taken to be mounted at root itself.
+func selfCgroupDirs(root, procFile string) (cgroupDirs, error) {
+	data, err := os.ReadFile(procFile)
+	if err != nil {
+		return cgroupDirs{}, err
+	}
+	dirs := cgroupDirsAt(root)
+	within := func(dir string) bool {
+		_, err := os.Stat(dir)
+		return err == nil
+	}
+	for line := range strings.Lines(string(data)) {
+		// hierarchy-ID:controller-list:cgroup-path
+		f := strings.SplitN(strings.TrimSpace(line), ":", 3)
+		if len(f) != 3 {
+			continue
+		}
+		if f[0] == "0" && f[1] == "" {
+			if dir := filepath.Join(root, f[2]); within(dir) {
+				dirs.v2 = dir
+			}
+			continue
+		}
+		for _, c := range strings.Split(f[1], ",") {
+			if _, ok := dirs.v1[c]; !ok {
+				continue
+			}
+			if dir := filepath.Join(root, c, f[2]); within(dir) {
+				dirs.v1[c] = dir
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// readCgroupMemory returns the cgroup's working set (usage less inactive
+// file pages) and limit in bytes; a limit of 0 means unlimited.
+func readCgroupMemory(dirs cgroupDirs) (usage, limit int64, err error) {
+	if usage, err = readCgroupInt(filepath.Join(dirs.v2, "memory.current")); err == nil {
+		if limit, err = readCgroupInt(filepath.Join(dirs.v2, "memory.max")); err != nil {
+			return 0, 0, err
+		}
+		inactive, err := readCgroupStat(filepath.Join(dirs.v2, "memory.stat"), "inactive_file")
+		return max(0, usage-inactive), limit, err
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, 0, err
+	}
+
+	// cgroup v1
+	dir := dirs.v1["memory"]
+	if usage, err = readCgroupInt(filepath.Join(dir, "memory.usage_in_bytes")); err != nil {
+		return 0, 0, err
+	}
+	if limit, err = readCgroupInt(filepath.Join(dir, "memory.limit_in_bytes")); err != nil {
+		return 0, 0, err
+	}
+	if limit >= math.MaxInt64/2 { // v1 reports "unlimited" as a huge value
+		limit = 0
+	}
+	inactive, err := readCgroupStat(filepath.Join(dir, "memory.stat"), "total_inactive_file")
+	return max(0, usage-inactive), limit, err
+}
+
+// readCgroupStat returns the value of key in a memory.stat file, or 0 if
+// the file or key is missing.
+func readCgroupStat(path, key string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	for line := range strings.Lines(string(data)) {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), key+" "); ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%s: %w", filepath.Base(path), err)
+			}
+			return n, nil
+		}
+	}
+	return 0, nil
+}
+
+// readCgroupCPU returns the cgroup's cumulative CPU time and its limit in
+// cores, which is the host's CPU count if the cgroup has no quota.
+func readCgroupCPU(dirs cgroupDirs) (usage time.Duration, cores float64, err error) {
+	cores = float64(runtime.NumCPU())
+
+	stat, err := os.ReadFile(filepath.Join(dirs.v2, "cpu.stat"))
+	if err == nil {
+		for line := range strings.Lines(string(stat)) {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(line), "usage_usec "); ok {
+				usec, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return 0, 0, fmt.Errorf("cpu.stat: %w", err)
+				}
+				usage = time.Duration(usec) * time.Microsecond
+			}
+		}
+		if cpuMax, err := os.ReadFile(filepath.Join(dirs.v2, "cpu.max")); err == nil {
+			if f := strings.Fields(string(cpuMax)); len(f) == 2 && f[0] != "max" {
+				quota, err1 := strconv.ParseFloat(f[0], 64)
+				period, err2 := strconv.ParseFloat(f[1], 64)
+				if err1 == nil && err2 == nil && period > 0 {
+					cores = quota / period
+				}
+			}
+		}
+		return usage, cores, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, 0, err
+	}
+
+	// cgroup v1
+	ns, err := readCgroupInt(filepath.Join(dirs.v1["cpuacct"], "cpuacct.usage"))
+	if err != nil {
+		return 0, 0, err
+	}
+	quota, err1 := readCgroupInt(filepath.Join(dirs.v1["cpu"], "cpu.cfs_quota_us"))
+	period, err2 := readCgroupInt(filepath.Join(dirs.v1["cpu"], "cpu.cfs_period_us"))
+	if err1 == nil && err2 == nil && quota > 0 && period > 0 {
+		cores = float64(quota) / float64(period)
+	}
+	return time.Duration(ns), cores, nil
+}
+
+// readCgroupInt reads a cgroup file holding one integer, or "max" (= 0).
+func readCgroupInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return n, nil
+}
@@ -0,0 +1,195 @@
+package relay
+
+import (
+	"crypto/tls"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCgroup writes cgroup v2 memory and CPU files to dir.
+func writeCgroup(t *testing.T, dir string, memCurrent int64, memMax string, cpuUsec int64, cpuMax string) {
+	t.Helper()
+	files := map[string]string{
+		"memory.current": strconv.FormatInt(memCurrent, 10) + "\n",
+		"memory.max":     memMax + "\n",
+		"cpu.stat":       "usage_usec " + strconv.FormatInt(cpuUsec, 10) + "\nuser_usec 0\nsystem_usec 0\n",
+		"cpu.max":        cpuMax + "\n",
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644))
+	}
+}
+
+func TestReadCgroup_V2(t *testing.T) {
+	dir := t.TempDir()
+	writeCgroup(t, dir, 512, "1024", 1500000, "200000 100000")
+
+	mem, limit, err := readCgroupMemory(cgroupDirsAt(dir))
+	require.NoError(t, err)
+	assert.Equal(t, int64(512), mem)
+	assert.Equal(t, int64(1024), limit)
+
+	cpu, cores, err := readCgroupCPU(cgroupDirsAt(dir))
+	require.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, cpu)
+	assert.Equal(t, 2.0, cores)
+
+	// Inactive page cache is reclaimable and not counted
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.stat"), []byte("anon 300\ninactive_file 200\nactive_file 12\n"), 0o644))
+	mem, _, err = readCgroupMemory(cgroupDirsAt(dir))
+	require.NoError(t, err)
+	assert.Equal(t, int64(312), mem)
+	require.NoError(t, os.Remove(filepath.Join(dir, "memory.stat")))
+
+	// No limits
+	writeCgroup(t, dir, 512, "max", 0, "max 100000")
+	_, limit, err = readCgroupMemory(cgroupDirsAt(dir))
+	require.NoError(t, err)
+	assert.Zero(t, limit)
+	_, cores, err = readCgroupCPU(cgroupDirsAt(dir))
+	require.NoError(t, err)
+	assert.Positive(t, cores)
+}
+
+func TestReadCgroup_V1(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"memory/memory.usage_in_bytes": "100",
+		"memory/memory.limit_in_bytes": "9223372036854771712",
+		"memory/memory.stat":           "cache 60\ntotal_inactive_file 40",
+		"cpuacct/cpuacct.usage":        "2000000000",
+		"cpu/cpu.cfs_quota_us":         "50000",
+		"cpu/cpu.cfs_period_us":        "100000",
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(data+"\n"), 0o644))
+	}
+
+	mem, limit, err := readCgroupMemory(cgroupDirsAt(dir))
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), mem, "usage less inactive file pages")
+	assert.Zero(t, limit, "v1 reports unlimited as a huge value")
+
+	cpu, cores, err := readCgroupCPU(cgroupDirsAt(dir))
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, cpu)
+	assert.Equal(t, 0.5, cores)
+}
+
+func TestSelfCgroupDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"system.slice/qumo.service", "memory/docker/abc", "cpu,cpuacct/docker/abc"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0o755))
+	}
+	proc := filepath.Join(t.TempDir(), "cgroup")
+
+	// cgroup v2
+	require.NoError(t, os.WriteFile(proc, []byte("0::/system.slice/qumo.service\n"), 0o644))
+	dirs, err := selfCgroupDirs(root, proc)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "system.slice/qumo.service"), dirs.v2)
+
+	// cgroup v1; cpu is not mounted separately, so it stays at the root
+	require.NoError(t, os.WriteFile(proc, []byte("5:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n1:name=systemd:/docker/abc\n"), 0o644))
+	dirs, err = selfCgroupDirs(root, proc)
+	require.NoError(t, err)
+	assert.Equal(t, root, dirs.v2)
+	assert.Equal(t, filepath.Join(root, "memory/docker/abc"), dirs.v1["memory"])
+	assert.Equal(t, filepath.Join(root, "cpu"), dirs.v1["cpu"])
+
+	// A cgroup not visible below the mount, as in a container without a
+	// cgroup namespace, is mounted at the root
+	require.NoError(t, os.WriteFile(proc, []byte("0::/kubepods/pod1/c1\n"), 0o644))
+	dirs, err = selfCgroupDirs(root, proc)
+	require.NoError(t, err)
+	assert.Equal(t, root, dirs.v2)
+
+	_, err = selfCgroupDirs(root, filepath.Join(root, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestReadCgroup_Missing(t *testing.T) {
+	_, _, err := readCgroupMemory(cgroupDirsAt(t.TempDir()))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestResourceMonitor_MemoryPressure(t *testing.T) {
+	t.Cleanup(func() { (&ResourceMonitor{}).setPressure("") })
+
+	ring := newGroupRing(8, DefaultFramePool)
+	for seq := moqt.GroupSequence(1); seq <= 6; seq++ {
+		ring.add(&fakeGroupSource{seq: seq, frames: []string{"x"}, end: io.EOF}, func() {})
+	}
+	ds := publishDistributors(t, "/resources/memory", map[string]time.Time{"video": time.Now()})
+	ds["video"].ring = ring
+
+	s := &Server{TLSConfig: &tls.Config{}, Config: &Config{}}
+	require.NoError(t, s.Configure())
+
+	dir := t.TempDir()
+	m := &ResourceMonitor{CgroupDir: dir, Sustain: 2, KeepGroups: 2}
+	now := time.Now()
+	sample := func(mem int64) {
+		t.Helper()
+		now = now.Add(time.Second)
+		writeCgroup(t, dir, mem, "1000", 0, "max 100000")
+		require.NoError(t, m.sample(now))
+	}
+
+	sample(950)
+	assert.Empty(t, ResourcePressure(), "pressure must be sustained")
+	assert.NotNil(t, ring.get(1))
+
+	sample(950)
+	assert.Equal(t, resourcePressureMemory, ResourcePressure())
+	assert.Equal(t, resourcePressureMemory, m.Usage().Pressure)
+	assert.Equal(t, resourcePressureMemory, s.Status().ResourcePressure)
+	reason, _ := s.overloaded("/")
+	assert.Equal(t, overloadResourcePressure, reason)
+	s.SelfCheck = &SelfCheck{}
+	reason, _ = s.overloaded(s.SelfCheck.sessionPath())
+	assert.Empty(t, reason, "the loopback probe is admitted under pressure")
+
+	assert.Nil(t, ring.get(4), "caches are shrunk under memory pressure")
+	assert.NotNil(t, ring.get(5))
+	assert.NotNil(t, ring.get(6))
+	assert.Equal(t, moqt.GroupSequence(5), ring.earliestAvailable())
+
+	sample(100)
+	assert.Equal(t, resourcePressureMemory, ResourcePressure(), "relief must be sustained")
+	sample(100)
+	assert.Empty(t, ResourcePressure())
+	reason, _ = s.overloaded("/")
+	assert.Empty(t, reason)
+}
+
+func TestResourceMonitor_CPUPressure(t *testing.T) {
+	t.Cleanup(func() { (&ResourceMonitor{}).setPressure("") })
+
+	dir := t.TempDir()
+	m := &ResourceMonitor{CgroupDir: dir, Sustain: 1}
+	now := time.Now()
+
+	// 1 core limit, 0.99 cores used over the last second
+	writeCgroup(t, dir, 0, "max", 0, "100000 100000")
+	require.NoError(t, m.sample(now))
+	assert.Empty(t, ResourcePressure(), "the first sample has no CPU rate")
+
+	writeCgroup(t, dir, 0, "max", 990000, "100000 100000")
+	require.NoError(t, m.sample(now.Add(time.Second)))
+	assert.InDelta(t, 0.99, m.Usage().CPUCores, 0.001)
+	assert.Equal(t, resourcePressureCPU, ResourcePressure())
+
+	writeCgroup(t, dir, 0, "max", 1000000, "100000 100000")
+	require.NoError(t, m.sample(now.Add(2*time.Second)))
+	assert.Empty(t, ResourcePressure())
+}
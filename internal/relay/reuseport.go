@@ -0,0 +1,191 @@
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/okdaichi/gomoqt/quic"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// SO_REUSEPORT sharding spreads the relay's QUIC traffic over several UDP
+// sockets bound to the same address, each with its own quic-go transport,
+// so that reading, decrypting and dispatching packets is no longer limited
+// by a single socket. The shard serving a connection is encoded in the
+// first byte of every connection ID it issues, and a classic BPF program
+// attached to the socket group steers each packet to the socket of the
+// shard its destination connection ID names. A client's Initial packets
+// carry a connection ID it picked, which steers them consistently to some
+// shard; that shard then issues the IDs the rest of the connection uses,
+// including after the client migrates to a new address.
+
+// ErrReusePortUnsupported is returned by ListenSharded on platforms without
+// SO_REUSEPORT steering.
+var ErrReusePortUnsupported = errors.New("relay: SO_REUSEPORT sharding is not supported on this platform")
+
+// MaxListenerShards bounds the sockets of a ShardedListener.
+const MaxListenerShards = 64
+
+// ShardedListener owns the UDP sockets and QUIC transports of a sharded
+// relay listener. Its ListenFunc goes into Server.ListenFunc or
+// VirtualHosts.ListenFunc; Close it once the server has shut down.
+type ShardedListener struct {
+	udps []*net.UDPConn
+	trs  []*quicgo.Transport
+}
+
+// ListenUDP serves QUIC on a single socket bound to addr: a ShardedListener
+// of one shard, which needs no SO_REUSEPORT. It lets the relay tune a socket
+// it would otherwise leave to quic-go.
+func ListenUDP(addr string) (*ShardedListener, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	udp, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return newShardedListener([]*net.UDPConn{udp}), nil
+}
+
+// newShardedListener serves QUIC on udps, which must be in socket group
+// order. A single socket needs no steering, so its connection IDs are left
+// to quic-go.
+func newShardedListener(udps []*net.UDPConn) *ShardedListener {
+	s := &ShardedListener{udps: udps}
+	for i, udp := range udps {
+		tr := &quicgo.Transport{Conn: udp, ConnContext: quicConnContext}
+		if len(udps) > 1 {
+			tr.ConnectionIDGenerator = shardCIDGenerator{shard: byte(i)}
+		}
+		s.trs = append(s.trs, tr)
+	}
+	return s
+}
+
+// Tune applies t to every socket. Call it before ListenFunc.
+func (s *ShardedListener) Tune(t UDPTuning) {
+	for _, udp := range s.udps {
+		tuneUDP(udp, t)
+	}
+}
+
+// Shards returns the number of sockets.
+func (s *ShardedListener) Shards() int {
+	return len(s.udps)
+}
+
+// Addr returns the address the sockets are bound to.
+func (s *ShardedListener) Addr() net.Addr {
+	return s.udps[0].LocalAddr()
+}
+
+// ListenFunc implements quic.ListenAddrFunc over the listener's sockets;
+// the address is ignored. The returned listener accepts the connections of
+// every shard.
+func (s *ShardedListener) ListenFunc(_ string, tlsConfig *tls.Config, quicConfig *quic.Config) (quic.Listener, error) {
+	l := &shardedQUICListener{
+		conns: make(chan *quicgo.Conn),
+		done:  make(chan struct{}),
+	}
+	for i, tr := range s.trs {
+		ln, err := tr.ListenEarly(tlsConfig, quicConfig)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("listen on shard %d: %w", i, err)
+		}
+		l.lns = append(l.lns, ln)
+	}
+	for i, ln := range l.lns {
+		go l.accept(ln, strconv.Itoa(i))
+	}
+	return l, nil
+}
+
+// Close closes the transports and sockets, ending any connection left.
+func (s *ShardedListener) Close() error {
+	var errs []error
+	for _, tr := range s.trs {
+		errs = append(errs, tr.Close())
+	}
+	for _, udp := range s.udps {
+		if err := udp.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// shardedQUICListener merges the connections accepted by each shard.
+type shardedQUICListener struct {
+	lns   []*quicgo.EarlyListener
+	conns chan *quicgo.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+// accept hands the connections of shard ln to Accept until the listener
+// closes.
+func (l *shardedQUICListener) accept(ln *quicgo.EarlyListener, shard string) {
+	for {
+		conn, err := ln.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		listenerShardConnections.WithLabelValues(shard).Inc()
+		select {
+		case l.conns <- conn:
+		case <-l.done:
+			conn.CloseWithError(0, "")
+			return
+		}
+	}
+}
+
+func (l *shardedQUICListener) Accept(ctx context.Context) (quic.Connection, error) {
+	select {
+	case conn := <-l.conns:
+		bindQUICConn(conn)
+		return &handoffQUICConn{conn: conn}, nil
+	case <-l.done:
+		return nil, quicgo.ErrServerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *shardedQUICListener) Addr() net.Addr { return l.lns[0].Addr() }
+
+func (l *shardedQUICListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	var errs []error
+	for _, ln := range l.lns {
+		errs = append(errs, ln.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// shardCIDGenerator issues connection IDs tagged with a shard.
+type shardCIDGenerator struct {
+	shard byte
+}
+
+func (g shardCIDGenerator) GenerateConnectionID() (quicgo.ConnectionID, error) {
+	b := make([]byte, handoffCIDLen)
+	b[0] = g.shard
+	if _, err := rand.Read(b[1:]); err != nil {
+		return quicgo.ConnectionID{}, err
+	}
+	return quicgo.ConnectionIDFromBytes(b), nil
+}
+
+func (g shardCIDGenerator) ConnectionIDLen() int {
+	return handoffCIDLen
+}
@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ListenSharded binds shards UDP sockets to addr with SO_REUSEPORT and
+// steers each QUIC packet to its connection's socket. A port of 0 is picked
+// once, for all of them.
+func ListenSharded(addr string, shards int) (*ShardedListener, error) {
+	if shards < 1 || shards > MaxListenerShards {
+		return nil, fmt.Errorf("relay: shards must be between 1 and %d", MaxListenerShards)
+	}
+
+	lc := net.ListenConfig{Control: func(_, _ string, c syscall.RawConn) error {
+		var opErr error
+		if err := c.Control(func(fd uintptr) {
+			opErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		}); err != nil {
+			return err
+		}
+		return opErr
+	}}
+
+	udps := make([]*net.UDPConn, 0, shards)
+	closeAll := func() {
+		for _, udp := range udps {
+			udp.Close()
+		}
+	}
+	for range shards {
+		pc, err := lc.ListenPacket(context.Background(), "udp", addr)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		udps = append(udps, pc.(*net.UDPConn))
+		addr = pc.LocalAddr().String()
+	}
+
+	if err := attachShardSteering(udps[0], shards); err != nil {
+		closeAll()
+		return nil, fmt.Errorf("attach SO_REUSEPORT steering: %w", err)
+	}
+	return newShardedListener(udps), nil
+}
+
+// attachShardSteering attaches the program picking the socket of a packet
+// to the group of udp: the first byte of the destination connection ID,
+// modulo shards. It is at offset 1 of short header packets and offset 6 of
+// long header ones (1 byte of flags, 4 of version, 1 of length).
+func attachShardSteering(udp *net.UDPConn, shards int) error {
+	prog := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 0},
+		{Code: unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K, Jt: 0, Jf: 2, K: 0x80},
+		{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 6},
+		{Code: unix.BPF_JMP | unix.BPF_JA, K: 1},
+		{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 1},
+		{Code: unix.BPF_ALU | unix.BPF_MOD | unix.BPF_K, K: uint32(shards)},
+		{Code: unix.BPF_RET | unix.BPF_A},
+	}
+
+	raw, err := udp.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var opErr error
+	if err := raw.Control(func(fd uintptr) {
+		opErr = unix.SetsockoptSockFprog(int(fd), unix.SOL_SOCKET, unix.SO_ATTACH_REUSEPORT_CBPF,
+			&unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]})
+	}); err != nil {
+		return err
+	}
+	return opErr
+}
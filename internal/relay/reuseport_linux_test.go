@@ -0,0 +1,115 @@
+package relay
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/quic"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	quicgo "github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenSharded(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Second)
+	defer cancel()
+
+	sharded, err := ListenSharded("127.0.0.1:0", 4)
+	require.NoError(t, err)
+	defer sharded.Close()
+	assert.Equal(t, 4, sharded.Shards())
+	addr := sharded.Addr().String()
+
+	ln, err := sharded.ListenFunc("", serverTLS, &quic.Config{})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	before := make([]float64, 4)
+	for i := range before {
+		before[i] = testutil.ToFloat64(listenerShardConnections.WithLabelValues(strconv.Itoa(i)))
+	}
+
+	// Every connection keeps working after the handshake: its packets are
+	// steered to the socket of the shard that accepted it.
+	for i := range 16 {
+		client, err := quicgo.DialAddr(ctx, addr, clientTLS, nil)
+		require.NoError(t, err)
+		defer client.CloseWithError(0, "")
+		server, err := ln.Accept(ctx)
+		require.NoError(t, err)
+		roundTrip(t, client, server, "conn "+strconv.Itoa(i))
+		roundTrip(t, client, server, "again")
+	}
+
+	used := 0
+	for i := range before {
+		if testutil.ToFloat64(listenerShardConnections.WithLabelValues(strconv.Itoa(i))) > before[i] {
+			used++
+		}
+	}
+	assert.Greater(t, used, 1, "connections are spread over the shards")
+}
+
+func TestListenSharded_InvalidShards(t *testing.T) {
+	for _, n := range []int{0, MaxListenerShards + 1} {
+		_, err := ListenSharded("127.0.0.1:0", n)
+		assert.Error(t, err, n)
+	}
+}
+
+func TestShardedQUICListener_Close(t *testing.T) {
+	serverTLS, _ := testTLS(t)
+	sharded, err := ListenSharded("127.0.0.1:0", 2)
+	require.NoError(t, err)
+	defer sharded.Close()
+
+	ln, err := sharded.ListenFunc("", serverTLS, &quic.Config{})
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+
+	_, err = ln.Accept(t.Context())
+	assert.ErrorIs(t, err, quicgo.ErrServerClosed)
+}
+
+// BenchmarkShardedListener_Handshakes measures accepted handshakes per
+// second with one socket against one per core.
+func BenchmarkShardedListener_Handshakes(b *testing.B) {
+	serverTLS, clientTLS := testTLS(b)
+	for _, shards := range []int{1, 4} {
+		b.Run(strconv.Itoa(shards)+"shards", func(b *testing.B) {
+			sharded, err := ListenSharded("127.0.0.1:0", shards)
+			require.NoError(b, err)
+			defer sharded.Close()
+			ln, err := sharded.ListenFunc("", serverTLS, &quic.Config{})
+			require.NoError(b, err)
+			defer ln.Close()
+			addr := sharded.Addr().String()
+
+			go func() {
+				for {
+					conn, err := ln.Accept(context.Background())
+					if err != nil {
+						return
+					}
+					conn.CloseWithError(0, "")
+				}
+			}()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					conn, err := quicgo.DialAddr(context.Background(), addr, clientTLS, nil)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					conn.CloseWithError(0, "")
+				}
+			})
+		})
+	}
+}
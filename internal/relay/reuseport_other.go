@@ -0,0 +1,8 @@
+//go:build !linux
+
+package relay
+
+// ListenSharded is not supported on this platform.
+func ListenSharded(addr string, shards int) (*ShardedListener, error) {
+	return nil, ErrReusePortUnsupported
+}
@@ -0,0 +1,253 @@
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/gomoqt/quic"
+)
+
+// SelfCheckPathPrefix is the broadcast path prefix used by the loopback
+// probe. Announcements under it are never pushed to the SDN controller.
+const SelfCheckPathPrefix = "/.qumo/selfcheck/"
+
+const selfCheckTrack moqt.TrackName = "probe"
+
+// SelfCheck periodically publishes a tiny synthetic broadcast to the relay
+// itself, subscribes to it through the normal data path and measures the
+// loop latency. Consecutive failures mark the relay unhealthy, catching
+// data-plane breakage that connection-level health checks miss.
+type SelfCheck struct {
+	// URL is the relay's own MoQ endpoint (e.g. "https://localhost:4433").
+	URL string
+
+	TLSConfig  *tls.Config
+	QUICConfig *quic.Config
+
+	// Interval between probes. Zero uses 30s.
+	Interval time.Duration
+
+	// Timeout bounds a single probe. Zero uses 5s.
+	Timeout time.Duration
+
+	// FailureThreshold is the number of consecutive failed probes that
+	// mark the relay unhealthy. Zero uses 3.
+	FailureThreshold int
+
+	// probe runs one loopback round trip. Overridden in tests.
+	probe func(ctx context.Context) (time.Duration, error)
+
+	pathOnce sync.Once
+	path     string // see sessionPath
+
+	mu     sync.Mutex
+	status SelfCheckStatus
+}
+
+// SelfCheckStatus is the latest result of the loopback probe.
+type SelfCheckStatus struct {
+	Healthy             bool          `json:"healthy"`
+	LastCheck           time.Time     `json:"last_check"`
+	LastLatency         time.Duration `json:"last_latency_ns"`
+	LastError           string        `json:"last_error,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+}
+
+// Status returns the latest probe result. Before the first probe the relay
+// is reported healthy.
+func (c *SelfCheck) Status() SelfCheckStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status.LastCheck.IsZero() {
+		return SelfCheckStatus{Healthy: true}
+	}
+	return c.status
+}
+
+// Run probes every Interval until ctx is cancelled.
+func (c *SelfCheck) Run(ctx context.Context) {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	slog.Info("selfcheck started", "url", c.URL, "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.check(ctx)
+		}
+	}
+}
+
+// check runs one probe and records the result.
+func (c *SelfCheck) check(ctx context.Context) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	threshold := c.FailureThreshold
+	if threshold <= 0 {
+		threshold = 3
+	}
+	probe := c.probe
+	if probe == nil {
+		probe = c.loopback
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	latency, err := probe(probeCtx)
+	cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wasHealthy := c.status.LastCheck.IsZero() || c.status.Healthy
+	c.status.LastCheck = time.Now()
+
+	if err != nil {
+		c.status.ConsecutiveFailures++
+		c.status.LastError = err.Error()
+		c.status.Healthy = c.status.ConsecutiveFailures < threshold
+		selfCheckFailures.Inc()
+
+		if wasHealthy && !c.status.Healthy {
+			slog.Error("selfcheck: relay data plane unhealthy",
+				"consecutive_failures", c.status.ConsecutiveFailures,
+				"error", err)
+		} else {
+			slog.Warn("selfcheck: probe failed", "error", err)
+		}
+	} else {
+		c.status.ConsecutiveFailures = 0
+		c.status.LastError = ""
+		c.status.LastLatency = latency
+		c.status.Healthy = true
+		selfCheckLatency.Observe(latency.Seconds())
+
+		if !wasHealthy {
+			slog.Info("selfcheck: relay data plane recovered", "latency", latency)
+		}
+	}
+
+	if c.status.Healthy {
+		selfCheckHealthy.Set(1)
+	} else {
+		selfCheckHealthy.Set(0)
+	}
+}
+
+// loopback publishes a one-frame broadcast carrying the send time over one
+// session and reads it back through the relay over another.
+func (c *SelfCheck) loopback(ctx context.Context) (time.Duration, error) {
+	path := moqt.BroadcastPath(fmt.Sprintf("%s%d", SelfCheckPathPrefix, time.Now().UnixNano()))
+
+	pubCtx, cancelPub := context.WithCancel(ctx)
+	defer cancelPub()
+
+	pubMux := moqt.NewTrackMux()
+	pubMux.PublishFunc(pubCtx, path, func(tw *moqt.TrackWriter) {
+		gw, err := tw.OpenGroup()
+		if err != nil {
+			return
+		}
+		defer gw.Close()
+
+		frame := moqt.NewFrame(8)
+		frame.Write(binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixNano())))
+		gw.WriteFrame(frame)
+	})
+
+	client := &moqt.Client{
+		TLSConfig:  c.TLSConfig,
+		QUICConfig: c.QUICConfig,
+	}
+	defer client.Close()
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return 0, fmt.Errorf("parse url: %w", err)
+	}
+	u.Path = c.sessionPath()
+	target := u.String()
+
+	pub, err := client.Dial(ctx, target, pubMux)
+	if err != nil {
+		return 0, fmt.Errorf("dial publisher: %w", err)
+	}
+	defer pub.CloseWithError(moqt.NoError, "selfcheck done")
+
+	sub, err := client.Dial(ctx, target, moqt.NewTrackMux())
+	if err != nil {
+		return 0, fmt.Errorf("dial subscriber: %w", err)
+	}
+	defer sub.CloseWithError(moqt.NoError, "selfcheck done")
+
+	// The relay learns the announcement asynchronously; retry until the
+	// subscription is accepted.
+	var tr *moqt.TrackReader
+	for {
+		tr, err = sub.Subscribe(path, selfCheckTrack, nil)
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("subscribe: %w", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	defer tr.Close()
+
+	gr, err := tr.AcceptGroup(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("accept group: %w", err)
+	}
+
+	frame := moqt.NewFrame(8)
+	if err := gr.ReadFrame(frame); err != nil {
+		return 0, fmt.Errorf("read frame: %w", err)
+	}
+	if len(frame.Body()) != 8 {
+		return 0, errors.New("malformed probe frame")
+	}
+
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64(frame.Body())))
+	return time.Since(sent), nil
+}
+
+// sessionPath returns the path the probe's sessions dial: a secret under
+// SelfCheckPathPrefix, so the relay can tell them from clients'.
+func (c *SelfCheck) sessionPath() string {
+	c.pathOnce.Do(func() {
+		c.path = SelfCheckPathPrefix + rand.Text()
+	})
+	return c.path
+}
+
+// owns reports whether a session dialed to path is one of the probe's.
+// A nil SelfCheck owns none.
+func (c *SelfCheck) owns(path string) bool {
+	return c != nil && path == c.sessionPath()
+}
+
+// isSelfCheckPath reports whether bp belongs to the loopback probe.
+func isSelfCheckPath(bp string) bool {
+	return strings.HasPrefix(bp, SelfCheckPathPrefix)
+}
@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfCheck_Status_BeforeFirstProbe(t *testing.T) {
+	c := &SelfCheck{}
+	assert.True(t, c.Status().Healthy)
+}
+
+func TestSelfCheck_FailureThreshold(t *testing.T) {
+	var fail bool
+	c := &SelfCheck{
+		FailureThreshold: 2,
+		probe: func(ctx context.Context) (time.Duration, error) {
+			if fail {
+				return 0, errors.New("no frame")
+			}
+			return 3 * time.Millisecond, nil
+		},
+	}
+	ctx := context.Background()
+
+	c.check(ctx)
+	st := c.Status()
+	assert.True(t, st.Healthy)
+	assert.Equal(t, 3*time.Millisecond, st.LastLatency)
+	assert.False(t, st.LastCheck.IsZero())
+
+	fail = true
+	c.check(ctx)
+	st = c.Status()
+	assert.True(t, st.Healthy, "one failure stays below the threshold")
+	assert.Equal(t, 1, st.ConsecutiveFailures)
+	assert.Equal(t, "no frame", st.LastError)
+
+	c.check(ctx)
+	st = c.Status()
+	assert.False(t, st.Healthy)
+	assert.Equal(t, 2, st.ConsecutiveFailures)
+
+	fail = false
+	c.check(ctx)
+	st = c.Status()
+	assert.True(t, st.Healthy)
+	assert.Zero(t, st.ConsecutiveFailures)
+	assert.Empty(t, st.LastError)
+}
+
+func TestSelfCheck_Timeout(t *testing.T) {
+	c := &SelfCheck{
+		Timeout:          20 * time.Millisecond,
+		FailureThreshold: 1,
+		probe: func(ctx context.Context) (time.Duration, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		},
+	}
+
+	c.check(context.Background())
+	st := c.Status()
+	assert.False(t, st.Healthy)
+	assert.Contains(t, st.LastError, "deadline exceeded")
+}
+
+func TestIsSelfCheckPath(t *testing.T) {
+	assert.True(t, isSelfCheckPath(SelfCheckPathPrefix+"123"))
+	assert.False(t, isSelfCheckPath("/live/stream"))
+}
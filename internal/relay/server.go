@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/okdaichi/gomoqt/moqt"
 	"github.com/okdaichi/gomoqt/quic"
@@ -15,7 +17,13 @@ type Server struct {
 	Addr       string
 	TLSConfig  *tls.Config
 	QUICConfig *quic.Config
-	Config     *Config
+
+	// ListenFunc opens the QUIC listener, such as HandoffListener.ListenFunc.
+	// If nil, the server listens on Addr itself.
+	ListenFunc quic.ListenAddrFunc
+
+	// Config is read once, when the server is configured; see Configure.
+	Config *Config
 
 	CheckHTTPOrigin func(r *http.Request) bool
 
@@ -25,90 +33,232 @@ type Server struct {
 	// If nil, auto-announce is disabled.
 	AnnounceRegistrar AnnounceRegistrar
 
+	// SDNState, if set, reports how the relay's registration with the SDN
+	// stands ("connecting", "registered" or "unreachable") for Status.
+	SDNState func() string
+
+	// Authorizer is consulted for every subscribe served by this relay.
+	// If nil, all subscriptions are allowed.
+	Authorizer Authorizer
+
+	// SelfCheck, if set, is the loopback probe dialing this relay. Its
+	// sessions bypass the session limit and resource pressure.
+	SelfCheck *SelfCheck
+
 	server *moqt.Server
 
-	initOnce sync.Once
+	stateMu    sync.Mutex   // serializes state transitions
+	state      atomic.Int32 // ServerState
+	configured *Config      // Config as of Configure
+	config     *Config      // frozen copy of configured; nil if there is none
 
 	statusHandler *statusHandler
 	peerRegistry  *peerRegistry
+	egress        *EgressPool // from Config.EgressWorkers; nil if unset
+
+	reportMu       sync.Mutex
+	shutdownReport *ShutdownReport
 }
 
-func (s *Server) init() {
-	s.initOnce.Do(func() {
-		if s.TLSConfig == nil {
-			panic("no tls config")
-		}
+// SetEgressLimit changes the global egress cap in bytes/sec at runtime.
+// Zero disables the cap.
+func (s *Server) SetEgressLimit(bytesPerSec int64) {
+	globalEgressLimiter.setRate(bytesPerSec)
+}
 
-		if s.TrackMux == nil {
-			s.TrackMux = moqt.DefaultMux
-		}
+// EgressLimit returns the current global egress cap in bytes/sec
+// (0 = unlimited).
+func (s *Server) EgressLimit() int64 {
+	return globalEgressLimiter.limit()
+}
 
-		s.statusHandler = newStatusHandler()
-		s.peerRegistry = newPeerRegistry()
-	})
+// EgressPool returns the worker pool writing the server's egress frames,
+// or nil if Config.EgressWorkers is not set. RemoteFetcher.EgressPool
+// shares it with the broadcasts fetched for the server.
+func (s *Server) EgressPool() *EgressPool {
+	_ = s.Configure()
+	return s.egress
 }
 
 func (s *Server) Status() Status {
-	s.init()
+	_ = s.Configure()
+
+	st := s.statusHandler.getStatus()
+	st.State = s.State().String()
+	st.DegradedTracks = DegradedTracks()
+	st.ResourcePressure = ResourcePressure()
+	if s.SDNState != nil {
+		st.SDN = s.SDNState()
+	}
+	return st
+}
+
+// Stats returns a snapshot of data-plane counters for export.
+func (s *Server) Stats() Stats {
+	_ = s.Configure()
 
-	return s.statusHandler.getStatus()
+	egress, subs := globalTrafficStats.snapshot()
+	return Stats{
+		ActiveConnections: s.statusHandler.activeConnections.Load(),
+		EgressBytes:       egress,
+		GroupsInFlight:    globalTrafficStats.groupsInFlight.Load(),
+		Subscribers:       subs,
+	}
 }
 
+// ListenAndServe configures the server if needed and serves sessions until
+// Close or Shutdown is called. It fails if the server is already running or
+// stopped, or if Config changed after it was configured.
 func (s *Server) ListenAndServe() error {
-	s.init()
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	s.server = &moqt.Server{
+	if err := s.start(ctx); err != nil {
+		return err
+	}
+	defer s.transition("stop", StateStopped, StateRunning)
+
+	// Start server - this will block until server closes
+	return s.server.ListenAndServe()
+}
+
+// start moves the server to StateRunning with a MoQ server relaying
+// sessions until ctx is cancelled.
+func (s *Server) start(ctx context.Context) error {
+	if err := s.Configure(); err != nil {
+		return err
+	}
+	if s.configChanged() {
+		return ErrConfigChanged
+	}
+
+	s.server = s.newMOQServer(ctx)
+	return s.transition("start", StateRunning, StateConfigured)
+}
+
+// newMOQServer returns the MoQ server accepting sessions for s. Sessions
+// are relayed until ctx is cancelled.
+func (s *Server) newMOQServer(ctx context.Context) *moqt.Server {
+	return &moqt.Server{
 		Addr:                      s.Addr,
 		TLSConfig:                 s.TLSConfig,
 		QUICConfig:                s.QUICConfig,
+		ListenFunc:                s.ListenFunc,
 		CheckHTTPOrigin:           s.CheckHTTPOrigin,
 		NewWebtransportServerFunc: newFixedWebTransportServer,
 		SetupHandler: moqt.SetupHandlerFunc(func(w moqt.SetupResponseWriter, r *moqt.SetupRequest) {
+			if !s.admitSetup(w, r) {
+				return
+			}
+			version, ok := s.negotiateVersion(w, r)
+			if !ok {
+				return
+			}
+
+			now := time.Now()
+			id := newSessionID(now)
+			ext := moqt.NewExtension()
+			ext.SetString(SessionIDExtension, id)
+			ext.SetUint(ServerTimeExtension, uint64(now.UnixMicro()))
+			w.SetExtensions(ext)
+
 			downstream, err := moqt.Accept(w, r, s.TrackMux)
 			if err != nil {
-				slog.Error("failed to accept connection", "err", err)
+				slog.Error("failed to accept connection", "session_id", id, "err", err)
 				return
 			}
 
 			defer downstream.CloseWithError(moqt.NoError, moqt.SessionErrorText(moqt.NoError))
 
-			err = s.Relay(ctx, downstream)
+			err = s.Relay(withSessionVersion(WithSessionID(ctx, id, previousSessionID(r)), version), downstream)
 
 			if err != nil {
-				slog.Error("relay session ended", "err", err)
+				slog.Error("relay session ended", "session_id", id, "err", err)
 				return
 			}
 		}),
 	}
-
-	// Start server - this will block until server closes
-	return s.server.ListenAndServe()
 }
 
 func (s *Server) HandleWebTransport(w http.ResponseWriter, r *http.Request) error {
-	s.init()
+	_ = s.Configure()
+
+	if !s.admitWebTransport(w, r) {
+		return nil
+	}
+	if st := s.State(); st != StateRunning {
+		return &StateError{Op: "serve WebTransport on", State: st}
+	}
 
 	return s.server.HandleWebTransport(w, r)
 }
 
+// Close stops the server immediately, from any state.
 func (s *Server) Close() error {
-	//
-	s.init()
+	_ = s.Configure()
 
+	s.transition("close", StateStopped, StateNew, StateConfigured, StateRunning, StateDraining, StateStopped)
 	if s.server != nil {
 		_ = s.server.Close()
 	}
+	s.egress.Close()
 
 	return nil
 }
 
+// Shutdown gracefully drains sessions until ctx ends and records a
+// ShutdownReport describing the drain. New sessions are refused from the
+// start of the drain. Shutting down a stopped server does nothing.
 func (s *Server) Shutdown(ctx context.Context) error {
-	//
-	s.init()
+	_ = s.Configure()
+
+	if s.State() == StateStopped {
+		return nil
+	}
+	if err := s.transition("shut down", StateDraining, StateNew, StateConfigured, StateRunning); err != nil {
+		return err
+	}
+	defer s.transition("stop", StateStopped, StateDraining)
+	defer s.egress.Close()
+
+	start := time.Now()
+	before := s.Stats()
+
+	err := s.shutdown(ctx)
+
+	after := s.Stats()
+	report := ShutdownReport{
+		StartedAt:          start,
+		Duration:           time.Since(start).String(),
+		Uptime:             start.Sub(s.statusHandler.startTime).String(),
+		SessionsAtShutdown: before.ActiveConnections,
+		SessionsDrained:    before.ActiveConnections - after.ActiveConnections,
+		SessionsRemaining:  after.ActiveConnections,
+		GroupsInFlight:     before.GroupsInFlight,
+		GroupsAbandoned:    after.GroupsInFlight,
+		EgressBytes:        after.EgressBytes,
+		Completed:          err == nil && after.ActiveConnections == 0,
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	s.reportMu.Lock()
+	s.shutdownReport = &report
+	s.reportMu.Unlock()
+
+	return err
+}
 
+// ShutdownReport returns the report of the last Shutdown, or nil if the
+// server has not been shut down.
+func (s *Server) ShutdownReport() *ShutdownReport {
+	s.reportMu.Lock()
+	defer s.reportMu.Unlock()
+	return s.shutdownReport
+}
+
+func (s *Server) shutdown(ctx context.Context) error {
 	if s.server != nil {
 		done := make(chan error, 1)
 		go func() {
@@ -134,10 +284,58 @@ func (s *Server) Relay(ctx context.Context, sess *moqt.Session) error {
 		defer s.statusHandler.decrementConnections()
 	}
 
+	id, previous := sessionIDFromContext(ctx)
+	if id == "" {
+		id = newSessionID(time.Now())
+	}
+	logger := slog.With("session_id", id)
+	version, hasVersion := sessionVersionFromContext(ctx)
+	if hasVersion {
+		logger = logger.With("version", VersionName(version))
+		sessionsByVersion.WithLabelValues(VersionName(version)).Inc()
+		defer sessionsByVersion.WithLabelValues(VersionName(version)).Dec()
+	}
+
 	// Register peer for topology tracking
 	if s.peerRegistry != nil {
-		peerID := s.peerRegistry.register(sess)
-		defer s.peerRegistry.deregister(peerID)
+		peer := s.peerRegistry.register(sess, id, previous)
+		if hasVersion {
+			s.peerRegistry.setVersion(id, VersionName(version))
+		}
+		defer s.peerRegistry.deregister(id)
+
+		if previous != "" {
+			sessionReconnects.Inc()
+			logger.Info("session resumed", "previous_session_id", previous, "reconnects", peer.Reconnects)
+		} else {
+			logger.Debug("session started")
+		}
+	}
+
+	// Sample the transport stats of sessions on the relay's own listeners
+	if conn := quicConnFromContext(sess.Context()); conn != nil {
+		statsCtx, stopStats := context.WithCancel(sess.Context())
+		defer stopStats()
+		go (&quicStatsSampler{conn: conn}).run(statsCtx, quicStatsInterval)
+	}
+
+	var counters *sessionCounters
+	if globalSummaries.enabled() {
+		counters = &sessionCounters{}
+		started := time.Now()
+		defer func() {
+			globalSummaries.emit(SummaryRecord{
+				Type:              SummarySession,
+				SessionID:         id,
+				PreviousSessionID: previous,
+				StartedAt:         started,
+				EndedAt:           time.Now(),
+				Tracks:            int(counters.tracks.Load()),
+				Groups:            counters.groups.Load(),
+				Bytes:             counters.bytes.Load(),
+				IncompleteGroups:  counters.incomplete.Load(),
+			})
+		}()
 	}
 
 	// TODO: measure accept time
@@ -148,19 +346,46 @@ func (s *Server) Relay(ctx context.Context, sess *moqt.Session) error {
 
 	for ann := range peer.Announcements(ctx) {
 		// Push to SDN announce table if configured
-		if s.AnnounceRegistrar != nil {
-			s.AnnounceRegistrar.Register(string(ann.BroadcastPath()))
+		if s.AnnounceRegistrar != nil && !isSelfCheckPath(string(ann.BroadcastPath())) {
+			bp := string(ann.BroadcastPath())
+			mr, ok := s.AnnounceRegistrar.(metadataRegistrar)
+			if md := s.config.announceMetadata(bp); ok && md != nil {
+				mr.RegisterWithMetadata(bp, md)
+			} else {
+				s.AnnounceRegistrar.Register(bp)
+			}
 		}
 
 		handler := &RelayHandler{
-			Announcement:   ann,
-			Session:        sess,
-			GroupCacheSize: DefaultGroupCacheSize,
-			FramePool:      DefaultFramePool,
-			relaying:       make(map[moqt.TrackName]*trackDistributor),
+			Announcement:    ann,
+			Session:         sess,
+			GroupCacheSize:  DefaultGroupCacheSize,
+			FramePool:       DefaultFramePool,
+			Authorizer:      s.Authorizer,
+			Visibility:      s.config.announceVisibility(string(ann.BroadcastPath())),
+			Peers:           s.config.peerIdentities(),
+			SessionID:       id,
+			ServeCompressed: s.config.servesCompressed(string(ann.BroadcastPath())),
+			session:         counters,
+			egressPool:      s.egress,
+			relaying:        make(map[moqt.TrackName]*trackDistributor),
+
+			GroupStallTimeout: s.config.groupStallTimeout(),
+			GroupBudgets:      s.config.groupBudgets(),
+
+			EgressWriteTimeout: s.config.egressWriteTimeout(),
 		}
 
+		_, release := globalPublications.claim(s.TrackMux, string(ann.BroadcastPath()), SourceLocal)
 		s.TrackMux.Announce(ann, handler)
+		globalPublications.add(s.TrackMux, string(ann.BroadcastPath()), SourceLocal, "", handler, ann.IsActive)
+		release()
+
+		if globalEvents.enabled() {
+			ev := Event{SessionID: id, BroadcastPath: string(ann.BroadcastPath())}
+			globalEvents.emit(ev.with(EventBroadcastStart))
+			ann.AfterFunc(func() { globalEvents.emit(ev.with(EventBroadcastStop)) })
+		}
 	}
 
 	return nil
@@ -26,22 +26,19 @@ func TestServer_Init(t *testing.T) {
 				t.Errorf("Expected no panic but got: %v", r)
 			}
 		}()
-		server.init()
+		require.NoError(t, server.Configure())
 		require.NotNil(t, server.TrackMux)
 	})
 
-	t.Run("init without TLS config panics", func(t *testing.T) {
+	t.Run("init without TLS config fails", func(t *testing.T) {
 		server := &Server{
 			Addr:      "localhost:4433",
 			TLSConfig: nil,
 		}
 
-		defer func() {
-			if r := recover(); r == nil {
-				t.Error("Expected panic but got none")
-			}
-		}()
-		server.init()
+		assert.ErrorIs(t, server.Configure(), ErrNoTLSConfig)
+		assert.Equal(t, StateNew, server.State())
+		assert.NotPanics(t, func() { server.Status() }, "Status works unconfigured")
 	})
 
 	t.Run("init with custom config", func(t *testing.T) {
@@ -61,7 +58,7 @@ func TestServer_Init(t *testing.T) {
 				t.Errorf("Expected no panic but got: %v", r)
 			}
 		}()
-		server.init()
+		require.NoError(t, server.Configure())
 		require.NotNil(t, server.TrackMux)
 	})
 }
@@ -73,11 +70,11 @@ func TestServer_Init_Idempotent(t *testing.T) {
 		TLSConfig: &tls.Config{},
 	}
 
-	server.init()
+	require.NoError(t, server.Configure())
 	config1 := server.Config
 	mux1 := server.TrackMux
 
-	server.init()
+	require.NoError(t, server.Configure())
 	config2 := server.Config
 	mux2 := server.TrackMux
 
@@ -102,7 +99,7 @@ func TestServer_Close_AfterInit(t *testing.T) {
 		Addr:      "localhost:4433",
 		TLSConfig: &tls.Config{},
 	}
-	server.init()
+	require.NoError(t, server.Configure())
 
 	err := server.Close()
 	require.NoError(t, err, "Close should not error after init")
@@ -126,7 +123,7 @@ func TestServer_Shutdown_AfterInit(t *testing.T) {
 		Addr:      "localhost:4433",
 		TLSConfig: &tls.Config{},
 	}
-	server.init()
+	require.NoError(t, server.Configure())
 	ctx := context.Background()
 
 	err := server.Shutdown(ctx)
@@ -139,7 +136,7 @@ func TestServer_Shutdown_WithTimeout(t *testing.T) {
 		Addr:      "localhost:4433",
 		TLSConfig: &tls.Config{},
 	}
-	server.init()
+	require.NoError(t, server.Configure())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer cancel()
@@ -154,24 +151,19 @@ func TestServer_Muxes_SeparateInstances(t *testing.T) {
 		Addr:      "localhost:4433",
 		TLSConfig: &tls.Config{},
 	}
-	server.init()
+	require.NoError(t, server.Configure())
 
 	require.NotNil(t, server.TrackMux, "TrackMux should be initialized")
 }
 
-// TestServer_Init_WithNilTLSConfig tests that server panics without TLS config
+// TestServer_Init_WithNilTLSConfig tests that server fails to start without TLS config
 func TestServer_Init_WithNilTLSConfig(t *testing.T) {
 	server := &Server{
 		Addr:      "localhost:4433",
 		TLSConfig: nil,
 	}
 
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("Expected panic but got none")
-		}
-	}()
-	server.init()
+	assert.ErrorIs(t, server.ListenAndServe(), ErrNoTLSConfig)
 }
 
 // TestServer_Config_Persistence tests that provided config is preserved
@@ -188,7 +180,7 @@ func TestServer_Config_Persistence(t *testing.T) {
 		TLSConfig: &tls.Config{},
 		Config:    customConfig,
 	}
-	server.init()
+	require.NoError(t, server.Configure())
 
 	assert.Same(t, customConfig, server.Config, "Server should preserve custom config")
 	assert.Equal(t, "node-1", server.Config.NodeID)
@@ -207,7 +199,7 @@ func TestServer_Init_Concurrent(t *testing.T) {
 	done := make(chan bool)
 	for i := 0; i < 10; i++ {
 		go func() {
-			server.init()
+			assert.NoError(t, server.Configure())
 			done <- true
 		}()
 	}
@@ -225,7 +217,7 @@ func TestServer_Close_Idempotent(t *testing.T) {
 		Addr:      "localhost:4433",
 		TLSConfig: &tls.Config{},
 	}
-	server.init()
+	require.NoError(t, server.Configure())
 
 	require.NoError(t, server.Close(), "First Close should not error")
 	require.NoError(t, server.Close(), "Second Close should not error")
@@ -238,7 +230,7 @@ func TestServer_Shutdown_Idempotent(t *testing.T) {
 		Addr:      "localhost:4433",
 		TLSConfig: &tls.Config{},
 	}
-	server.init()
+	require.NoError(t, server.Configure())
 	ctx := context.Background()
 
 	require.NoError(t, server.Shutdown(ctx), "First Shutdown should not error")
@@ -260,7 +252,7 @@ func TestServer_Config_CustomValues(t *testing.T) {
 		TLSConfig: &tls.Config{},
 		Config:    customConfig,
 	}
-	server.init()
+	require.NoError(t, server.Configure())
 
 	assert.Same(t, customConfig, server.Config, "Custom config should be preserved")
 	assert.Equal(t, 500, server.Config.GroupCacheSize, "GroupCacheSize should be preserved")
@@ -273,7 +265,7 @@ func TestServer_Mux_Initialization(t *testing.T) {
 		Addr:      "localhost:4433",
 		TLSConfig: &tls.Config{},
 	}
-	server.init()
+	require.NoError(t, server.Configure())
 
 	require.NotNil(t, server.TrackMux, "TrackMux should be initialized")
 }
@@ -286,7 +278,7 @@ func TestServer_Mux_CustomTrackMux(t *testing.T) {
 		TLSConfig: &tls.Config{},
 	}
 	server.TrackMux = customMux
-	server.init()
+	require.NoError(t, server.Configure())
 
 	assert.Same(t, customMux, server.TrackMux, "Custom TrackMux should be preserved")
 }
@@ -322,7 +314,7 @@ func TestServer_Init_WithQUICConfig(t *testing.T) {
 		TLSConfig: &tls.Config{},
 	}
 	server.QUICConfig = quicConfig
-	server.init()
+	require.NoError(t, server.Configure())
 
 	assert.Same(t, quicConfig, server.QUICConfig, "QUICConfig should be preserved")
 }
@@ -337,22 +329,19 @@ func TestServer_Init_MultipleCallsWithDifferentConfigs(t *testing.T) {
 		},
 	}
 
-	server.init()
+	require.NoError(t, server.Configure())
 	firstMux := server.TrackMux
 
-	// Try to change config and init again
-	// Because of sync.Once, init() does nothing on second call
+	// Configuring again does nothing
 	server.Config = &Config{
 		NodeID: "node-2",
 	}
-	server.init()
-
-	// The config pointer changes because we assigned a new one,
-	// but init() didn't run again (sync.Once)
+	require.NoError(t, server.Configure())
 	assert.Same(t, firstMux, server.TrackMux, "TrackMux should not change on second init call")
 
-	// Config field is not protected by init(), so it changes
-	assert.Equal(t, "node-2", server.Config.NodeID, "Config assignment should work even after init")
+	// The replaced config is rejected rather than half-applied
+	assert.ErrorIs(t, server.ListenAndServe(), ErrConfigChanged)
+	assert.Equal(t, StateConfigured, server.State())
 }
 
 // TestServer_CheckHTTPOrigin tests CheckHTTPOrigin configuration
@@ -368,7 +357,7 @@ func TestServer_CheckHTTPOrigin(t *testing.T) {
 		TLSConfig: &tls.Config{},
 	}
 	server.CheckHTTPOrigin = originFunc
-	server.init()
+	require.NoError(t, server.Configure())
 
 	require.NotNil(t, server.CheckHTTPOrigin, "CheckHTTPOrigin should be preserved")
 
@@ -398,7 +387,7 @@ func TestServer_Address_Formats(t *testing.T) {
 				Addr:      tt.addr,
 				TLSConfig: &tls.Config{},
 			}
-			server.init()
+			require.NoError(t, server.Configure())
 
 			assert.Equal(t, tt.addr, server.Addr, "Address should be preserved")
 		})
@@ -0,0 +1,88 @@
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// Setup extensions carrying session identifiers. The relay returns the
+// session's ID in SessionIDExtension; a reconnecting client presents the
+// ID of its previous session in PreviousSessionIDExtension so the two
+// sessions can be correlated.
+const (
+	SessionIDExtension         moqt.ExtensionKey = 0x71756d6f01
+	PreviousSessionIDExtension moqt.ExtensionKey = 0x71756d6f02
+)
+
+// crockford is the ULID alphabet (Crockford's base32).
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newSessionID returns a ULID: a 48-bit millisecond timestamp followed by
+// 80 random bits, encoded as 26 Crockford base32 characters. IDs sort by
+// creation time.
+func newSessionID(now time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(now.UnixMilli())<<16)
+	rand.Read(b[6:])
+
+	// 128 bits as 26 5-bit digits, most significant first; the first
+	// digit carries only the top 3 bits.
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// validSessionID reports whether id looks like a ULID issued by
+// newSessionID. Client-supplied IDs are checked before being logged.
+func validSessionID(id string) bool {
+	if len(id) != 26 || id[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if !strings.ContainsRune(crockford, rune(id[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// previousSessionID returns the prior session ID a client presented in its
+// setup extensions, or "" if none or malformed.
+func previousSessionID(r *moqt.SetupRequest) string {
+	if r == nil || r.ClientExtensions == nil {
+		return ""
+	}
+	id, err := r.ClientExtensions.GetString(PreviousSessionIDExtension)
+	if err != nil || !validSessionID(id) {
+		return ""
+	}
+	return id
+}
+
+type sessionIDKey struct{}
+
+type sessionIDs struct{ id, previous string }
+
+// WithSessionID returns a context that carries the ID of the session being
+// relayed and the ID the client presented from its previous session.
+// Server.Relay uses them instead of generating a fresh ID.
+func WithSessionID(ctx context.Context, id, previous string) context.Context {
+	return context.WithValue(ctx, sessionIDKey{}, sessionIDs{id, previous})
+}
+
+// sessionIDFromContext returns the IDs stored by WithSessionID.
+func sessionIDFromContext(ctx context.Context) (id, previous string) {
+	ids, _ := ctx.Value(sessionIDKey{}).(sessionIDs)
+	return ids.id, ids.previous
+}
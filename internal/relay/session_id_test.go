@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSessionID(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+
+	id := newSessionID(now)
+	assert.Len(t, id, 26)
+	assert.True(t, validSessionID(id))
+	assert.NotEqual(t, id, newSessionID(now), "random part must differ")
+
+	// The first 10 characters encode the timestamp, so IDs sort by time.
+	later := newSessionID(now.Add(time.Millisecond))
+	assert.Less(t, id[:10], later[:10])
+	assert.Equal(t, "01HF7YAT00", id[:10])
+}
+
+func TestValidSessionID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"01HF4K4Q00ABCDEFGHJKMNPQRS", true},
+		{"", false},
+		{"01HF4K4Q00", false},
+		{"01HF4K4Q00ABCDEFGHJKMNPQRI", false}, // I is not Crockford
+		{"81HF4K4Q00ABCDEFGHJKMNPQRS", false}, // overflows 128 bits
+		{"01hf4k4q00abcdefghjkmnpqrs", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, validSessionID(tt.id), tt.id)
+	}
+}
+
+func TestPreviousSessionID(t *testing.T) {
+	assert.Empty(t, previousSessionID(nil))
+	assert.Empty(t, previousSessionID(&moqt.SetupRequest{}))
+
+	prior := newSessionID(time.Now())
+	ext := moqt.NewExtension()
+	ext.SetString(PreviousSessionIDExtension, prior)
+	assert.Equal(t, prior, previousSessionID(&moqt.SetupRequest{ClientExtensions: ext}))
+
+	ext = moqt.NewExtension()
+	ext.SetString(PreviousSessionIDExtension, "peer-1\nforged log line")
+	assert.Empty(t, previousSessionID(&moqt.SetupRequest{ClientExtensions: ext}))
+}
+
+func TestSessionIDContext(t *testing.T) {
+	id, prev := sessionIDFromContext(context.Background())
+	assert.Empty(t, id)
+	assert.Empty(t, prev)
+
+	ctx := WithSessionID(context.Background(), "a", "b")
+	id, prev = sessionIDFromContext(ctx)
+	assert.Equal(t, "a", id)
+	assert.Equal(t, "b", prev)
+}
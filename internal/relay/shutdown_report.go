@@ -0,0 +1,57 @@
+package relay
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+)
+
+// ShutdownReport summarizes a graceful shutdown for post-incident timelines
+// and for verifying that drains actually completed.
+type ShutdownReport struct {
+	StartedAt time.Time `json:"started_at"`
+	Duration  string    `json:"duration"` // time spent draining
+	Uptime    string    `json:"uptime"`   // process uptime when shutdown began
+
+	SessionsAtShutdown int32 `json:"sessions_at_shutdown"`
+	SessionsDrained    int32 `json:"sessions_drained"`
+	SessionsRemaining  int32 `json:"sessions_remaining"`
+
+	GroupsInFlight  int64 `json:"groups_in_flight"` // when shutdown began
+	GroupsAbandoned int64 `json:"groups_abandoned"` // still open at the end
+
+	EgressBytes uint64 `json:"egress_bytes"` // total since process start
+
+	// SDN holds announce deregistration results, if SDN is configured.
+	SDN *sdn.DeregisterResult `json:"sdn,omitempty"`
+
+	// Completed is true when every session drained before the deadline.
+	Completed bool   `json:"completed"`
+	Error     string `json:"error,omitempty"`
+}
+
+// LogValue implements slog.LogValuer so a report can be logged as a group.
+func (r ShutdownReport) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Time("started_at", r.StartedAt),
+		slog.String("duration", r.Duration),
+		slog.String("uptime", r.Uptime),
+		slog.Int("sessions_at_shutdown", int(r.SessionsAtShutdown)),
+		slog.Int("sessions_drained", int(r.SessionsDrained)),
+		slog.Int("sessions_remaining", int(r.SessionsRemaining)),
+		slog.Int64("groups_in_flight", r.GroupsInFlight),
+		slog.Int64("groups_abandoned", r.GroupsAbandoned),
+		slog.Uint64("egress_bytes", r.EgressBytes),
+		slog.Bool("completed", r.Completed),
+	}
+	if r.SDN != nil {
+		attrs = append(attrs,
+			slog.Int("sdn_deregistered", r.SDN.Deregistered),
+			slog.Int("sdn_failed", r.SDN.Failed))
+	}
+	if r.Error != "" {
+		attrs = append(attrs, slog.String("error", r.Error))
+	}
+	return slog.GroupValue(attrs...)
+}
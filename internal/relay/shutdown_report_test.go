@@ -0,0 +1,50 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"testing"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ShutdownReport(t *testing.T) {
+	server := &Server{
+		Addr:      "localhost:4433",
+		TLSConfig: &tls.Config{},
+	}
+	assert.Nil(t, server.ShutdownReport(), "no report before shutdown")
+
+	require.NoError(t, server.Configure())
+	server.statusHandler.incrementConnections()
+
+	require.NoError(t, server.Shutdown(context.Background()))
+
+	report := server.ShutdownReport()
+	require.NotNil(t, report)
+	assert.Equal(t, int32(1), report.SessionsAtShutdown)
+	assert.Equal(t, int32(1), report.SessionsRemaining)
+	assert.Equal(t, int32(0), report.SessionsDrained)
+	assert.False(t, report.Completed, "a remaining session means the drain did not complete")
+	assert.NotEmpty(t, report.Uptime)
+}
+
+func TestShutdownReport_LogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	logger.Info("shutdown report", "report", ShutdownReport{
+		SessionsDrained: 3,
+		Completed:       true,
+		SDN:             &sdn.DeregisterResult{Deregistered: 2, Failed: 1},
+	})
+
+	out := buf.String()
+	assert.Contains(t, out, "report.sessions_drained=3")
+	assert.Contains(t, out, "report.completed=true")
+	assert.Contains(t, out, "report.sdn_failed=1")
+}
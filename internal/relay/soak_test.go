@@ -0,0 +1,379 @@
+package relay
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/gomoqt/quic"
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Soak mode: TestSoak runs synthetic publish/subscribe churn through an
+// in-process relay and its SDN announce client for -soak, e.g.
+//
+//	go test ./internal/relay -run TestSoak -soak 2h -timeout 0 -v
+//
+// and fails if heap, goroutines or open file descriptors grow faster than
+// the -soak.max-* slopes, fitted over the samples after -soak.warmup.
+var (
+	soakDuration      = flag.Duration("soak", 0, "run TestSoak for this long; zero skips it")
+	soakInterval      = flag.Duration("soak.sample", 30*time.Second, "interval between TestSoak resource samples")
+	soakWarmup        = flag.Duration("soak.warmup", 5*time.Minute, "TestSoak samples left out of the trends")
+	soakPublishers    = flag.Int("soak.publishers", 16, "concurrent TestSoak publishers")
+	soakSubscribers   = flag.Int("soak.subscribers", 64, "concurrent TestSoak subscribers")
+	soakMaxHeap       = flag.Float64("soak.max-heap", 16, "max TestSoak heap growth in MiB per hour")
+	soakMaxGoroutines = flag.Float64("soak.max-goroutines", 50, "max TestSoak goroutine growth per hour")
+	soakMaxFDs        = flag.Float64("soak.max-fds", 10, "max TestSoak open file descriptor growth per hour")
+	soakCSV           = flag.String("soak.csv", "", "write the TestSoak samples to this CSV file")
+)
+
+// soakSample is one reading of the process's resources.
+type soakSample struct {
+	At         time.Duration // since the start of the run
+	HeapMiB    float64       // heap in use after a GC
+	Goroutines int
+	FDs        int // -1 where open descriptors cannot be counted
+}
+
+// sampleResources reads the process's resources after a GC.
+func sampleResources(at time.Duration) soakSample {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	fds := -1
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		fds = len(entries)
+	}
+	return soakSample{
+		At:         at,
+		HeapMiB:    float64(ms.HeapInuse) / (1 << 20),
+		Goroutines: runtime.NumGoroutine(),
+		FDs:        fds,
+	}
+}
+
+// slopePerHour fits a least-squares line through the samples' values and
+// returns its slope per hour, or 0 for fewer than two samples.
+func slopePerHour(samples []soakSample, value func(soakSample) float64) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	var sx, sy float64
+	for _, s := range samples {
+		sx += s.At.Hours()
+		sy += value(s)
+	}
+	n := float64(len(samples))
+	mx, my := sx/n, sy/n
+	var cov, vx float64
+	for _, s := range samples {
+		dx := s.At.Hours() - mx
+		cov += dx * (value(s) - my)
+		vx += dx * dx
+	}
+	if vx == 0 {
+		return 0
+	}
+	return cov / vx
+}
+
+func writeSoakCSV(path string, samples []soakSample) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"seconds", "heap_mib", "goroutines", "fds"})
+	for _, s := range samples {
+		w.Write([]string{
+			strconv.FormatFloat(s.At.Seconds(), 'f', 0, 64),
+			strconv.FormatFloat(s.HeapMiB, 'f', 2, 64),
+			strconv.Itoa(s.Goroutines),
+			strconv.Itoa(s.FDs),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func TestSlopePerHour(t *testing.T) {
+	heap := func(s soakSample) float64 { return s.HeapMiB }
+
+	assert.Zero(t, slopePerHour(nil, heap))
+	assert.Zero(t, slopePerHour([]soakSample{{At: time.Minute, HeapMiB: 5}}, heap))
+
+	flat := []soakSample{{At: 0, HeapMiB: 10}, {At: time.Hour, HeapMiB: 12}, {At: 2 * time.Hour, HeapMiB: 10}}
+	assert.InDelta(t, 0, slopePerHour(flat, heap), 1e-9)
+
+	growing := []soakSample{
+		{At: 0, HeapMiB: 10},
+		{At: 30 * time.Minute, HeapMiB: 14},
+		{At: time.Hour, HeapMiB: 18},
+	}
+	assert.InDelta(t, 8, slopePerHour(growing, heap), 1e-9)
+}
+
+func TestSoak(t *testing.T) {
+	if *soakDuration <= 0 {
+		t.Skip("soak mode: run with -soak <duration>")
+	}
+
+	serverTLS, clientTLS := testTLS(t)
+	serverTLS.NextProtos, clientTLS.NextProtos = []string{moqt.NextProtoMOQ}, []string{moqt.NextProtoMOQ}
+
+	// SDN controller with a real announce table behind the relay's client
+	mux := http.NewServeMux()
+	mux.HandleFunc("/announce/", sdn.HandlerFunc(sdn.NewAnnounceTable(time.Minute)))
+	controller := httptest.NewServer(mux)
+	defer controller.Close()
+
+	announcer, err := sdn.NewClient(sdn.ClientConfig{
+		URL:               controller.URL,
+		RelayName:         "soak",
+		HeartbeatInterval: 5 * time.Second,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go announcer.Run(ctx)
+
+	addr := freeUDPAddr(t)
+	server := &Server{
+		Addr:              addr,
+		TLSConfig:         serverTLS,
+		QUICConfig:        &quic.Config{EnableDatagrams: true},
+		Config:            &Config{},
+		TrackMux:          moqt.NewTrackMux(),
+		AnnounceRegistrar: announcer,
+	}
+	go server.ListenAndServe()
+	defer server.Close()
+
+	client := &moqt.Client{TLSConfig: clientTLS, QUICConfig: &quic.Config{EnableDatagrams: true}}
+	defer client.Close()
+
+	w := &soakWorkload{url: "moqt://" + addr, client: client, paths: make(map[moqt.BroadcastPath]struct{})}
+
+	t.Logf("soak: %v with %d publishers and %d subscribers", *soakDuration, *soakPublishers, *soakSubscribers)
+
+	var wg sync.WaitGroup
+	for i := range *soakPublishers {
+		wg.Go(func() { w.publishLoop(ctx, i) })
+	}
+	for range *soakSubscribers {
+		wg.Go(func() { w.subscribeLoop(ctx) })
+	}
+
+	// Sample until the run is over
+	start := time.Now()
+	var samples []soakSample
+	ticker := time.NewTicker(*soakInterval)
+	deadline := time.After(*soakDuration)
+sampling:
+	for {
+		select {
+		case <-ticker.C:
+			s := sampleResources(time.Since(start))
+			samples = append(samples, s)
+			t.Logf("soak: %v heap=%.1fMiB goroutines=%d fds=%d published=%d received=%d",
+				s.At.Round(time.Second), s.HeapMiB, s.Goroutines, s.FDs, w.published.Load(), w.received.Load())
+		case <-deadline:
+			break sampling
+		}
+	}
+	ticker.Stop()
+	cancel()
+	wg.Wait()
+
+	if *soakCSV != "" {
+		require.NoError(t, writeSoakCSV(*soakCSV, samples))
+	}
+
+	var trend []soakSample
+	for _, s := range samples {
+		if s.At >= *soakWarmup {
+			trend = append(trend, s)
+		}
+	}
+	require.GreaterOrEqual(t, len(trend), 3, "too few samples after the warmup: lengthen -soak or shorten -soak.warmup")
+	assert.Positive(t, w.received.Load(), "no frame made it through the relay")
+
+	heap := slopePerHour(trend, func(s soakSample) float64 { return s.HeapMiB })
+	goroutines := slopePerHour(trend, func(s soakSample) float64 { return float64(s.Goroutines) })
+	t.Logf("soak: trends per hour: heap %+.2fMiB, goroutines %+.1f", heap, goroutines)
+	assert.LessOrEqual(t, heap, *soakMaxHeap, "heap grows by %.2fMiB/h", heap)
+	assert.LessOrEqual(t, goroutines, *soakMaxGoroutines, "goroutines grow by %.1f/h", goroutines)
+
+	if trend[0].FDs >= 0 {
+		fds := slopePerHour(trend, func(s soakSample) float64 { return float64(s.FDs) })
+		t.Logf("soak: trends per hour: fds %+.1f", fds)
+		assert.LessOrEqual(t, fds, *soakMaxFDs, "open file descriptors grow by %.1f/h", fds)
+	}
+}
+
+// soakWorkload churns publishers and subscribers against one relay.
+type soakWorkload struct {
+	url    string
+	client *moqt.Client
+
+	mu    sync.Mutex
+	paths map[moqt.BroadcastPath]struct{} // broadcasts being published
+
+	published, received atomic.Int64 // frames
+}
+
+// publishLoop publishes broadcasts of random lifetimes, one after another,
+// each over a session of its own, until ctx is cancelled.
+func (w *soakWorkload) publishLoop(ctx context.Context, worker int) {
+	for gen := 0; ctx.Err() == nil; gen++ {
+		path := moqt.BroadcastPath(fmt.Sprintf("/soak/%d/%d", worker, gen))
+		w.publish(ctx, path, soakLifetime(10*time.Second, time.Minute))
+	}
+}
+
+func (w *soakWorkload) publish(ctx context.Context, path moqt.BroadcastPath, lifetime time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, lifetime)
+	defer cancel()
+
+	mux := moqt.NewTrackMux()
+	mux.PublishFunc(ctx, path, func(tw *moqt.TrackWriter) {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		payload := make([]byte, 1200)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tw.Context().Done():
+				return
+			case <-ticker.C:
+			}
+			gw, err := tw.OpenGroup()
+			if err != nil {
+				return
+			}
+			for range 3 {
+				frame := moqt.NewFrame(len(payload))
+				frame.Write(payload)
+				if gw.WriteFrame(frame) != nil {
+					break
+				}
+				w.published.Add(1)
+			}
+			gw.Close()
+		}
+	})
+
+	sess, err := w.client.Dial(ctx, w.url, mux)
+	if err != nil {
+		soakBackoff(ctx)
+		return
+	}
+	defer sess.CloseWithError(moqt.NoError, "soak publisher done")
+
+	w.mu.Lock()
+	w.paths[path] = struct{}{}
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.paths, path)
+		w.mu.Unlock()
+	}()
+
+	<-ctx.Done()
+}
+
+// subscribeLoop subscribes to random live broadcasts for random lifetimes,
+// each over a session of its own, until ctx is cancelled.
+func (w *soakWorkload) subscribeLoop(ctx context.Context) {
+	for ctx.Err() == nil {
+		path, ok := w.randomPath()
+		if !ok {
+			soakBackoff(ctx)
+			continue
+		}
+		w.subscribe(ctx, path, soakLifetime(2*time.Second, 30*time.Second))
+	}
+}
+
+func (w *soakWorkload) subscribe(ctx context.Context, path moqt.BroadcastPath, lifetime time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, lifetime)
+	defer cancel()
+
+	sess, err := w.client.Dial(ctx, w.url, moqt.NewTrackMux())
+	if err != nil {
+		soakBackoff(ctx)
+		return
+	}
+	defer sess.CloseWithError(moqt.NoError, "soak subscriber done")
+
+	tr, err := sess.Subscribe(path, "video", nil)
+	if err != nil {
+		return
+	}
+	defer tr.Close()
+
+	frame := moqt.NewFrame(1500)
+	for {
+		gr, err := tr.AcceptGroup(ctx)
+		if err != nil {
+			return
+		}
+		for gr.ReadFrame(frame) == nil {
+			w.received.Add(1)
+		}
+	}
+}
+
+func (w *soakWorkload) randomPath() (moqt.BroadcastPath, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path := range w.paths { // map order is random enough
+		return path, true
+	}
+	return "", false
+}
+
+// soakBackoff waits a second, or until ctx is cancelled.
+func soakBackoff(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+	}
+}
+
+// soakLifetime returns a random duration in [min, max).
+func soakLifetime(min, max time.Duration) time.Duration {
+	return min + rand.N(max-min)
+}
+
+// freeUDPAddr returns a loopback address with a UDP port free to listen on.
+func freeUDPAddr(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := conn.LocalAddr().String()
+	require.NoError(t, conn.Close())
+	return addr
+}
@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+// StaleTrackWatchdog detects upstreams that keep their session alive but
+// stop sending groups, which would otherwise leave subscribers waiting
+// silently. A relayed track that has gone Timeout without a new upstream
+// group is marked degraded: it is logged, reported in Status and counted in
+// qumo_relay_stale_tracks until a group arrives again.
+type StaleTrackWatchdog struct {
+	// Timeout is how long a track may go without a new upstream group. It
+	// must exceed the longest group interval of the relayed content.
+	Timeout time.Duration
+
+	// Resubscribe replaces the upstream subscription of a degraded track
+	// with a new one on the same session, and again every Timeout while it
+	// stays degraded.
+	Resubscribe bool
+}
+
+// DegradedTrack is a relayed track whose upstream stopped sending groups.
+type DegradedTrack struct {
+	BroadcastPath  string `json:"broadcast_path"`
+	TrackName      string `json:"track_name"`
+	LastGroupAgeMs int64  `json:"last_group_age_ms"`
+}
+
+// Run checks every relayed track four times per Timeout until ctx is
+// cancelled.
+func (w *StaleTrackWatchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(w.Timeout/4, 100*time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.check(now)
+		}
+	}
+}
+
+// check marks the tracks that went stale as of now and resubscribes them
+// if enabled.
+func (w *StaleTrackWatchdog) check(now time.Time) {
+	for _, d := range globalPublications.distributors() {
+		age := now.Sub(time.Unix(0, d.lastGroup.Load()))
+		if age < w.Timeout {
+			continue
+		}
+		if !d.stale.Swap(true) {
+			d.log().Warn("upstream track stale, no group received", "last_group_age", age.Round(time.Millisecond))
+		}
+
+		if !w.Resubscribe || now.Sub(time.Unix(0, d.resubscribedAt.Load())) < w.Timeout {
+			continue
+		}
+		if err := d.resubscribe(); err != nil {
+			d.log().Warn("failed to resubscribe stale upstream track", "error", err)
+			continue
+		}
+		staleTrackResubscribes.Inc()
+		d.log().Info("resubscribed stale upstream track")
+	}
+}
+
+// DegradedTracks returns the relayed tracks the StaleTrackWatchdog marked
+// degraded, sorted by broadcast path and track name.
+func DegradedTracks() []DegradedTrack {
+	now := time.Now()
+	var tracks []DegradedTrack
+	for _, d := range globalPublications.distributors() {
+		if !d.stale.Load() {
+			continue
+		}
+		tracks = append(tracks, DegradedTrack{
+			BroadcastPath:  d.path,
+			TrackName:      d.track,
+			LastGroupAgeMs: now.Sub(time.Unix(0, d.lastGroup.Load())).Milliseconds(),
+		})
+	}
+	slices.SortFunc(tracks, func(a, b DegradedTrack) int {
+		return cmp.Or(cmp.Compare(a.BroadcastPath, b.BroadcastPath), cmp.Compare(a.TrackName, b.TrackName))
+	})
+	return tracks
+}
@@ -0,0 +1,89 @@
+package relay
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// publishDistributors registers tracks under path with a last group at the
+// given times, until the test ends.
+func publishDistributors(t *testing.T, path string, lastGroups map[string]time.Time) map[string]*trackDistributor {
+	t.Helper()
+	ds := make(map[string]*trackDistributor)
+	h := &RelayHandler{relaying: make(map[moqt.TrackName]*trackDistributor)}
+	for track, at := range lastGroups {
+		d := &trackDistributor{path: path, track: track}
+		d.lastGroup.Store(at.UnixNano())
+		h.relaying[moqt.TrackName(track)] = d
+		ds[track] = d
+	}
+	var alive atomic.Bool
+	alive.Store(true)
+	t.Cleanup(func() { alive.Store(false) })
+	globalPublications.add(nil, path, SourceLocal, "", h, alive.Load)
+	return ds
+}
+
+func degradedUnder(path string) []DegradedTrack {
+	var tracks []DegradedTrack
+	for _, dt := range DegradedTracks() {
+		if dt.BroadcastPath == path {
+			tracks = append(tracks, dt)
+		}
+	}
+	return tracks
+}
+
+func TestStaleTrackWatchdog_MarksDegraded(t *testing.T) {
+	now := time.Now()
+	ds := publishDistributors(t, "/stale/marks", map[string]time.Time{
+		"audio": now.Add(-time.Second),
+		"video": now.Add(-time.Minute),
+	})
+
+	w := &StaleTrackWatchdog{Timeout: 10 * time.Second}
+	w.check(now)
+
+	assert.True(t, ds["video"].stale.Load())
+	assert.False(t, ds["audio"].stale.Load())
+
+	tracks := degradedUnder("/stale/marks")
+	require.Len(t, tracks, 1)
+	assert.Equal(t, "video", tracks[0].TrackName)
+	assert.GreaterOrEqual(t, tracks[0].LastGroupAgeMs, int64(60000))
+}
+
+func TestStaleTrackWatchdog_Resubscribe(t *testing.T) {
+	now := time.Now()
+	ds := publishDistributors(t, "/stale/resubscribe", map[string]time.Time{"video": now.Add(-time.Minute)})
+
+	var opened []moqt.TrackPriority
+	d := ds["video"]
+	d.upstream = 3
+	d.open = func(p moqt.TrackPriority) (*moqt.TrackReader, error) {
+		opened = append(opened, p)
+		return nil, errors.New("session closed")
+	}
+
+	w := &StaleTrackWatchdog{Timeout: 10 * time.Second, Resubscribe: true}
+	w.check(now)
+	assert.Equal(t, []moqt.TrackPriority{3}, opened, "resubscribes at the upstream priority")
+	assert.True(t, d.stale.Load(), "stays degraded until a group arrives")
+
+	// Attempts are spaced by Timeout
+	w.check(time.Now().Add(time.Second))
+	assert.Len(t, opened, 1)
+	w.check(time.Now().Add(11 * time.Second))
+	assert.Len(t, opened, 2)
+}
+
+func TestTrackDistributor_ResubscribeWithoutUpstream(t *testing.T) {
+	d := &trackDistributor{}
+	assert.Error(t, d.resubscribe())
+}
@@ -0,0 +1,82 @@
+package relay
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Stats is a compact snapshot of the relay's data-plane activity.
+// It is cheap to produce and intended for periodic export (e.g. SDN push).
+type Stats struct {
+	// ActiveConnections is the number of open MoQ sessions.
+	ActiveConnections int32 `json:"active_connections"`
+
+	// EgressBytes is the cumulative number of frame payload bytes written
+	// to subscribers since process start.
+	EgressBytes uint64 `json:"egress_bytes"`
+
+	// GroupsInFlight is the number of groups currently being written to
+	// subscribers.
+	GroupsInFlight int64 `json:"groups_in_flight"`
+
+	// Subscribers maps broadcast path → number of active egress loops.
+	Subscribers map[string]int `json:"subscribers"`
+}
+
+// trafficStats aggregates data-plane counters across all relay handlers in
+// the process, including handlers registered by RemoteFetcher.
+type trafficStats struct {
+	egressBytes    atomic.Uint64
+	groupsInFlight atomic.Int64
+
+	mu          sync.Mutex
+	subscribers map[string]int // broadcastPath → active egress count
+}
+
+// globalTrafficStats is shared by every trackDistributor in the process.
+var globalTrafficStats = newTrafficStats()
+
+func newTrafficStats() *trafficStats {
+	return &trafficStats{
+		subscribers: make(map[string]int),
+	}
+}
+
+// addEgressBytes records n payload bytes written to a subscriber.
+func (s *trafficStats) addEgressBytes(n int) {
+	if n > 0 {
+		s.egressBytes.Add(uint64(n))
+	}
+}
+
+// addSubscriber increments the active subscriber count for a path.
+func (s *trafficStats) addSubscriber(broadcastPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers[broadcastPath]++
+}
+
+// removeSubscriber decrements the active subscriber count for a path and
+// drops the entry when it reaches zero.
+func (s *trafficStats) removeSubscriber(broadcastPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscribers[broadcastPath] <= 1 {
+		delete(s.subscribers, broadcastPath)
+		return
+	}
+	s.subscribers[broadcastPath]--
+}
+
+// snapshot returns the cumulative egress bytes and a copy of the per-path
+// subscriber counts.
+func (s *trafficStats) snapshot() (uint64, map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := make(map[string]int, len(s.subscribers))
+	for bp, n := range s.subscribers {
+		subs[bp] = n
+	}
+	return s.egressBytes.Load(), subs
+}
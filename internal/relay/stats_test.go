@@ -0,0 +1,73 @@
+package relay
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestTrafficStats_Subscribers(t *testing.T) {
+	s := newTrafficStats()
+
+	s.addSubscriber("/live/a")
+	s.addSubscriber("/live/a")
+	s.addSubscriber("/live/b")
+
+	_, subs := s.snapshot()
+	if subs["/live/a"] != 2 || subs["/live/b"] != 1 {
+		t.Fatalf("unexpected subscribers: %v", subs)
+	}
+
+	s.removeSubscriber("/live/a")
+	s.removeSubscriber("/live/b")
+
+	_, subs = s.snapshot()
+	if subs["/live/a"] != 1 {
+		t.Errorf("expected 1 subscriber on /live/a, got %d", subs["/live/a"])
+	}
+	if _, ok := subs["/live/b"]; ok {
+		t.Error("expected /live/b to be dropped at zero")
+	}
+}
+
+func TestTrafficStats_EgressBytes(t *testing.T) {
+	s := newTrafficStats()
+
+	s.addEgressBytes(100)
+	s.addEgressBytes(0)
+	s.addEgressBytes(-5) // ignored
+	s.addEgressBytes(50)
+
+	egress, _ := s.snapshot()
+	if egress != 150 {
+		t.Errorf("expected 150 egress bytes, got %d", egress)
+	}
+}
+
+func TestTrafficStats_SnapshotIsCopy(t *testing.T) {
+	s := newTrafficStats()
+	s.addSubscriber("/live/a")
+
+	_, subs := s.snapshot()
+	subs["/live/a"] = 100
+
+	_, again := s.snapshot()
+	if again["/live/a"] != 1 {
+		t.Errorf("snapshot mutation leaked into stats: %d", again["/live/a"])
+	}
+}
+
+func TestServer_Stats(t *testing.T) {
+	s := &Server{TLSConfig: &tls.Config{}}
+	if err := s.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	s.statusHandler.incrementConnections()
+
+	st := s.Stats()
+	if st.ActiveConnections != 1 {
+		t.Errorf("expected 1 active connection, got %d", st.ActiveConnections)
+	}
+	if st.Subscribers == nil {
+		t.Error("expected non-nil subscribers map")
+	}
+}
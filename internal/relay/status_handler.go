@@ -13,6 +13,19 @@ type Status struct {
 	Timestamp         time.Time `json:"timestamp"`
 	Uptime            string    `json:"uptime"`
 	ActiveConnections int32     `json:"active_connections"`
+	State             string    `json:"state,omitempty"` // Server lifecycle state
+
+	// DegradedTracks lists relayed tracks whose upstream went quiet; see
+	// StaleTrackWatchdog.
+	DegradedTracks []DegradedTrack `json:"degraded_tracks,omitempty"`
+
+	// ResourcePressure is "memory" or "cpu" while a ResourceMonitor finds
+	// the relay under sustained pressure.
+	ResourcePressure string `json:"resource_pressure,omitempty"`
+
+	// SDN is how the relay's registration with the SDN stands:
+	// "connecting", "registered" or "unreachable". Empty without an SDN.
+	SDN string `json:"sdn,omitempty"`
 }
 
 // statusHandler manages health check state
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 )
 
@@ -97,7 +98,7 @@ func TestStatusHandler_NilReceiver(t *testing.T) {
 	h.decrementConnections()
 
 	status := h.getStatus()
-	if status != (Status{}) {
+	if !reflect.DeepEqual(status, Status{}) {
 		t.Error("expected empty status for nil receiver")
 	}
 }
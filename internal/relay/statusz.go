@@ -0,0 +1,136 @@
+package relay
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/version"
+)
+
+// PublicStatus is the body of GET /statusz. It carries aggregate figures
+// only — no broadcast paths, peers or identities — so it is safe to expose
+// publicly.
+type PublicStatus struct {
+	Status            string    `json:"status"`
+	Version           string    `json:"version"`
+	Uptime            string    `json:"uptime"`
+	UptimeSeconds     int64     `json:"uptime_seconds"`
+	ActiveBroadcasts  int       `json:"active_broadcasts"`
+	EgressBytesPerSec float64   `json:"egress_bytes_per_sec"`
+	Timestamp         time.Time `json:"timestamp"`
+}
+
+// rateMeter turns a monotonically increasing counter into a rate averaged
+// over the time between samples, resampling at most once per minGap.
+type rateMeter struct {
+	mu     sync.Mutex
+	minGap time.Duration
+	lastAt time.Time
+	last   uint64
+	rate   float64
+}
+
+// sample records total at now and returns the current rate per second.
+func (m *rateMeter) sample(now time.Time, total uint64) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lastAt.IsZero() {
+		m.lastAt, m.last = now, total
+		return 0
+	}
+	elapsed := now.Sub(m.lastAt)
+	if elapsed < m.minGap {
+		return m.rate
+	}
+	if total >= m.last {
+		m.rate = float64(total-m.last) / elapsed.Seconds()
+	}
+	m.lastAt, m.last = now, total
+	return m.rate
+}
+
+// activeBroadcasts counts registered publications whose announcement is
+// still live.
+func activeBroadcasts() int {
+	n := 0
+	for _, p := range Publications() {
+		if p.Active {
+			n++
+		}
+	}
+	return n
+}
+
+var statuszPage = template.Must(template.New("statusz").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>qumo relay status</title></head>
+<body>
+<h1>qumo relay: {{.Status}}</h1>
+<table>
+<tr><th align="left">Version</th><td>{{.Version}}</td></tr>
+<tr><th align="left">Uptime</th><td>{{.Uptime}}</td></tr>
+<tr><th align="left">Active broadcasts</th><td>{{.ActiveBroadcasts}}</td></tr>
+<tr><th align="left">Egress</th><td>{{printf "%.0f" .EgressBytesPerSec}} bytes/s</td></tr>
+<tr><th align="left">Updated</th><td>{{.Timestamp.Format "2006-01-02T15:04:05Z07:00"}}</td></tr>
+</table>
+</body>
+</html>
+`))
+
+// StatuszHandlerFunc returns an http.HandlerFunc serving a read-only status
+// page for s: HTML by default, JSON with ?format=json or an Accept header
+// preferring application/json. The egress rate is averaged over the time
+// since the previous request (at least one second).
+//
+//	GET /statusz
+func StatuszHandlerFunc(s *Server) http.HandlerFunc {
+	meter := &rateMeter{minGap: time.Second}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		_ = s.Configure()
+		now := time.Now()
+		uptime := now.Sub(s.statusHandler.startTime).Truncate(time.Second)
+		egress, _ := globalTrafficStats.snapshot()
+
+		st := PublicStatus{
+			Status:            s.Status().Status,
+			Version:           version.Version(),
+			Uptime:            uptime.String(),
+			UptimeSeconds:     int64(uptime.Seconds()),
+			ActiveBroadcasts:  activeBroadcasts(),
+			EgressBytesPerSec: meter.sample(now, egress),
+			Timestamp:         now.UTC(),
+		}
+
+		code := http.StatusOK
+		if st.Status != "healthy" {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+
+		if r.URL.Query().Get("format") == "json" || strings.HasPrefix(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			if r.Method == http.MethodGet {
+				json.NewEncoder(w).Encode(st)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		if r.Method == http.MethodGet {
+			statuszPage.Execute(w, st)
+		}
+	}
+}
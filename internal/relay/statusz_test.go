@@ -0,0 +1,56 @@
+package relay
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateMeter(t *testing.T) {
+	m := &rateMeter{minGap: time.Second}
+	start := time.Unix(1000, 0)
+
+	assert.Zero(t, m.sample(start, 100))
+	assert.Zero(t, m.sample(start.Add(500*time.Millisecond), 5000), "within minGap keeps the previous rate")
+	assert.Equal(t, 1000.0, m.sample(start.Add(2*time.Second), 2100))
+	assert.Equal(t, 1000.0, m.sample(start.Add(2500*time.Millisecond), 9999))
+	assert.Equal(t, 1000.0, m.sample(start.Add(4*time.Second), 0), "counter reset keeps the previous rate")
+}
+
+func TestStatuszHandlerFunc(t *testing.T) {
+	handler := StatuszHandlerFunc(&Server{TLSConfig: &tls.Config{}})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/statusz?format=json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	var st PublicStatus
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&st))
+	assert.Equal(t, "healthy", st.Status)
+	assert.Equal(t, "dev", st.Version)
+	assert.NotEmpty(t, st.Uptime)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/statusz", nil)
+	req.Header.Set("Accept", "application/json")
+	handler(rec, req)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/statusz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rec.Body.String(), "qumo relay: healthy")
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/statusz", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
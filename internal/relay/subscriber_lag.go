@@ -0,0 +1,134 @@
+package relay
+
+import (
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SubscriberLag describes how far one downstream subscription, a viewer or
+// a downstream relay, is behind the live edge of its track.
+type SubscriberLag struct {
+	ID            uint64 `json:"id"` // unique per subscription while the relay runs
+	BroadcastPath string `json:"broadcast_path"`
+	TrackName     string `json:"track_name"`
+	Client        string `json:"client,omitempty"` // hashed identity; empty if anonymous
+
+	// LagGroups is the number of groups between the newest one the relay
+	// has and the one being sent to the subscriber; 0 means it is live.
+	LagGroups uint64 `json:"lag_groups"`
+
+	// BehindLiveMs estimates the time behind live: how long the oldest
+	// group the subscriber has yet to start has been cached.
+	BehindLiveMs int64 `json:"behind_live_ms"`
+
+	StartedAt time.Time `json:"started_at"`
+}
+
+// egressProgress is the position of one egress in its track's ring.
+type egressProgress struct {
+	id        uint64
+	client    string
+	startedAt time.Time
+	sending   atomic.Uint64 // ring position of the group being or last sent; 0 before the first
+}
+
+// egressIDs numbers egresses for SubscriberLag.ID.
+var egressIDs atomic.Uint64
+
+// trackProgress registers the progress of the egress notified on ch. It is
+// removed by unsubscribe.
+func (d *trackDistributor) trackProgress(ch chan struct{}, client string) *egressProgress {
+	p := &egressProgress{id: egressIDs.Add(1), client: client, startedAt: time.Now()}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.progress == nil {
+		d.progress = make(map[chan struct{}]*egressProgress)
+	}
+	d.progress[ch] = p
+	return p
+}
+
+// lags returns the lag of each egress of d as of now.
+func (d *trackDistributor) lags(now time.Time) []SubscriberLag {
+	d.mu.RLock()
+	progress := make([]*egressProgress, 0, len(d.progress))
+	for _, p := range d.progress {
+		progress = append(progress, p)
+	}
+	d.mu.RUnlock()
+
+	head := uint64(d.ring.head())
+	lags := make([]SubscriberLag, 0, len(progress))
+	for _, p := range progress {
+		lag := SubscriberLag{
+			ID:            p.id,
+			BroadcastPath: d.path,
+			TrackName:     d.track,
+			Client:        p.client,
+			StartedAt:     p.startedAt,
+		}
+		if sending := p.sending.Load(); sending > 0 && sending < head {
+			lag.LagGroups = head - sending
+			next := max(moqt.GroupSequence(sending+1), d.ring.earliestAvailable())
+			if cache := d.ring.get(next); cache != nil {
+				lag.BehindLiveMs = now.Sub(cache.createdAt).Milliseconds()
+			}
+		}
+		lags = append(lags, lag)
+	}
+	return lags
+}
+
+// Subscribers returns the lag of every downstream subscription of the
+// relayed tracks, furthest behind first.
+func Subscribers() []SubscriberLag {
+	now := time.Now()
+	var lags []SubscriberLag
+	for _, d := range globalPublications.distributors() {
+		lags = append(lags, d.lags(now)...)
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].LagGroups != lags[j].LagGroups {
+			return lags[i].LagGroups > lags[j].LagGroups
+		}
+		return lags[i].ID < lags[j].ID
+	})
+	return lags
+}
+
+var (
+	subscriberLagDesc = prometheus.NewDesc(
+		"qumo_relay_subscriber_lag_groups",
+		"Groups between the newest cached group of a track and the one being sent to a subscriber.",
+		[]string{"broadcast_path", "track", "subscriber", "client"}, nil,
+	)
+
+	subscriberBehindDesc = prometheus.NewDesc(
+		"qumo_relay_subscriber_behind_live_seconds",
+		"Estimated time a subscriber is behind the live edge of its track.",
+		[]string{"broadcast_path", "track", "subscriber", "client"}, nil,
+	)
+)
+
+// subscriberCollector exports Subscribers. Series live as long as their
+// subscription.
+type subscriberCollector struct{}
+
+func (subscriberCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- subscriberLagDesc
+	ch <- subscriberBehindDesc
+}
+
+func (subscriberCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range Subscribers() {
+		labels := []string{s.BroadcastPath, s.TrackName, strconv.FormatUint(s.ID, 10), s.Client}
+		ch <- prometheus.MustNewConstMetric(subscriberLagDesc, prometheus.GaugeValue, float64(s.LagGroups), labels...)
+		ch <- prometheus.MustNewConstMetric(subscriberBehindDesc, prometheus.GaugeValue, float64(s.BehindLiveMs)/1000, labels...)
+	}
+}
@@ -0,0 +1,84 @@
+package relay
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lagDistributor returns a distributor of /live/room video with three
+// cached groups.
+func lagDistributor() *trackDistributor {
+	ring := newGroupRing(DefaultGroupCacheSize, DefaultFramePool)
+	for seq := range moqt.GroupSequence(3) {
+		ring.add(&fakeGroupSource{seq: seq + 1, frames: []string{"f"}, end: io.EOF}, nil)
+	}
+	return &trackDistributor{
+		path:        "/live/room",
+		track:       "video",
+		ring:        ring,
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+}
+
+func TestTrackDistributor_Lags(t *testing.T) {
+	d := lagDistributor()
+	live := d.subscribe()
+	behind := d.subscribe()
+	d.trackProgress(live, "").sending.Store(3)
+	d.trackProgress(behind, "c1").sending.Store(1)
+
+	lags := d.lags(time.Now().Add(time.Second))
+	require.Len(t, lags, 2)
+	byClient := map[string]SubscriberLag{}
+	for _, l := range lags {
+		byClient[l.Client] = l
+	}
+
+	assert.Zero(t, byClient[""].LagGroups)
+	assert.Zero(t, byClient[""].BehindLiveMs)
+	assert.Equal(t, uint64(2), byClient["c1"].LagGroups)
+	assert.GreaterOrEqual(t, byClient["c1"].BehindLiveMs, int64(1000), "group 2 has waited at least a second")
+	assert.Equal(t, "/live/room", byClient["c1"].BroadcastPath)
+	assert.Equal(t, "video", byClient["c1"].TrackName)
+
+	d.unsubscribe(behind)
+	assert.Len(t, d.lags(time.Now()), 1)
+}
+
+func TestSubscribersHandlerFunc(t *testing.T) {
+	prev := globalPublications
+	globalPublications = newPublicationRegistry()
+	t.Cleanup(func() { globalPublications = prev })
+
+	d := lagDistributor()
+	d.trackProgress(d.subscribe(), "").sending.Store(3)
+	d.trackProgress(d.subscribe(), "").sending.Store(2)
+	h := &RelayHandler{relaying: map[moqt.TrackName]*trackDistributor{"video": d}}
+	globalPublications.add(nil, "/live/room", SourceLocal, "", h, func() bool { return true })
+
+	handler := SubscribersHandlerFunc()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/subscribers", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Subscribers []SubscriberLag `json:"subscribers"`
+		Count       int             `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.Equal(t, 2, body.Count)
+	assert.Equal(t, uint64(1), body.Subscribers[0].LagGroups, "furthest behind first")
+	assert.Zero(t, body.Subscribers[1].LagGroups)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/subscribers", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
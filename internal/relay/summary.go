@@ -0,0 +1,190 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Summary record types.
+const (
+	SummarySession      = "session"      // a MoQ session closed
+	SummarySubscription = "subscription" // a subscriber's track ended
+)
+
+// SummaryRecord describes a finished session or subscription for offline
+// QoE analysis. Session records carry what the session published through
+// the relay; subscription records carry what one subscriber received.
+type SummaryRecord struct {
+	Type string `json:"type"`
+
+	// SessionID is the closed session (session records) or the session
+	// publishing the track (subscription records).
+	SessionID         string `json:"session_id,omitempty"`
+	PreviousSessionID string `json:"previous_session_id,omitempty"`
+
+	// Client is the hashed subscriber identity, as in client metrics.
+	Client        string `json:"client,omitempty"`
+	BroadcastPath string `json:"broadcast_path,omitempty"`
+	TrackName     string `json:"track_name,omitempty"`
+
+	StartedAt       time.Time `json:"started_at"`
+	EndedAt         time.Time `json:"ended_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+
+	// Tracks is the number of tracks relayed from the session.
+	Tracks int `json:"tracks,omitempty"`
+
+	// Groups and Bytes count groups and frame payload bytes received from
+	// the publisher (session) or sent to the subscriber (subscription).
+	Groups uint64 `json:"groups"`
+	Bytes  uint64 `json:"bytes"`
+
+	// IncompleteGroups counts groups abandoned before completion.
+	IncompleteGroups uint64 `json:"incomplete_groups,omitempty"`
+
+	// CatchUps counts how often the subscriber fell behind the group cache
+	// and skipped ahead.
+	CatchUps uint64 `json:"catch_ups,omitempty"`
+
+	// Stuck is set when the subscription was closed because a write to the
+	// subscriber timed out; see Config.EgressWriteTimeout.
+	Stuck bool `json:"stuck,omitempty"`
+}
+
+// SummarySink receives summary records. Implementations for other
+// pipelines (e.g. Kafka) only need to satisfy this interface.
+type SummarySink interface {
+	WriteSummary(ctx context.Context, rec SummaryRecord) error
+}
+
+// globalSummaries is shared by all relay handlers.
+var globalSummaries = &summaryExporter{asyncDispatcher[SummaryRecord]{
+	name:    "summary record",
+	dropped: summariesDropped,
+	failed:  summariesFailed,
+}}
+
+// summaryExporter delivers records to the configured sinks off the hot path.
+type summaryExporter struct {
+	asyncDispatcher[SummaryRecord]
+}
+
+// SetSummarySinks configures where session and subscription summaries are
+// written. No sinks disables them. The records queued for the sinks set
+// before are written first, so those may be closed once it returns.
+func SetSummarySinks(sinks ...SummarySink) {
+	writers := make([]func(context.Context, SummaryRecord) error, 0, len(sinks))
+	for _, sink := range sinks {
+		writers = append(writers, sink.WriteSummary)
+	}
+	globalSummaries.start(writers)
+}
+
+// emit queues rec for delivery without blocking.
+func (e *summaryExporter) emit(rec SummaryRecord) {
+	rec.DurationSeconds = rec.EndedAt.Sub(rec.StartedAt).Seconds()
+	e.send(rec)
+}
+
+// FileSummarySink appends records to a file as JSON lines.
+type FileSummarySink struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSummarySink opens path for appending, creating it if needed.
+func NewFileSummarySink(path string) (*FileSummarySink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSummarySink{path: path, file: f}, nil
+}
+
+// Reopen closes the file and opens its path again, so records go to a new
+// file once a log rotation moved the old one away. On error the sink keeps
+// writing to the old file.
+func (s *FileSummarySink) Reopen() error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.file
+	s.file = f
+	return old.Close()
+}
+
+// WriteSummary appends rec as one JSON line.
+func (s *FileSummarySink) WriteSummary(_ context.Context, rec SummaryRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(data)
+	return err
+}
+
+// Close closes the underlying file.
+func (s *FileSummarySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// HTTPSummarySink POSTs each record as JSON to URL.
+type HTTPSummarySink struct {
+	URL    string
+	Client *http.Client // nil uses http.DefaultClient
+}
+
+// WriteSummary posts rec to s.URL.
+func (s *HTTPSummarySink) WriteSummary(ctx context.Context, rec SummaryRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s returned %d", s.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// sessionCounters accumulates what a session publishes through the relay.
+type sessionCounters struct {
+	tracks     atomic.Int64
+	groups     atomic.Uint64
+	bytes      atomic.Uint64
+	incomplete atomic.Uint64
+}
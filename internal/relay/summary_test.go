@@ -0,0 +1,210 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSink collects records for tests.
+type recordingSink struct {
+	mu      sync.Mutex
+	records []SummaryRecord
+	got     chan struct{}
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{got: make(chan struct{}, 16)}
+}
+
+func (s *recordingSink) WriteSummary(_ context.Context, rec SummaryRecord) error {
+	s.mu.Lock()
+	s.records = append(s.records, rec)
+	s.mu.Unlock()
+	s.got <- struct{}{}
+	return nil
+}
+
+func (s *recordingSink) wait(t *testing.T) SummaryRecord {
+	t.Helper()
+	select {
+	case <-s.got:
+	case <-time.After(time.Second):
+		t.Fatal("no summary record delivered")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[len(s.records)-1]
+}
+
+func TestSummaryExporter_Disabled(t *testing.T) {
+	SetSummarySinks()
+	assert.False(t, globalSummaries.enabled())
+
+	// Must not block or panic
+	globalSummaries.emit(SummaryRecord{Type: SummarySession})
+}
+
+func TestSummaryExporter_Emit(t *testing.T) {
+	sink := newRecordingSink()
+	SetSummarySinks(sink)
+	defer SetSummarySinks()
+
+	require.True(t, globalSummaries.enabled())
+
+	start := time.Now()
+	globalSummaries.emit(SummaryRecord{
+		Type:      SummarySubscription,
+		SessionID: "01HF7YAT00AAAAAAAAAAAAAAAA",
+		StartedAt: start,
+		EndedAt:   start.Add(90 * time.Second),
+		Groups:    12,
+		Bytes:     4096,
+		CatchUps:  1,
+	})
+
+	rec := sink.wait(t)
+	assert.Equal(t, SummarySubscription, rec.Type)
+	assert.Equal(t, 90.0, rec.DurationSeconds)
+	assert.Equal(t, uint64(4096), rec.Bytes)
+	assert.Equal(t, uint64(1), rec.CatchUps)
+}
+
+func TestSummaryExporter_DrainsOnStop(t *testing.T) {
+	sink := newRecordingSink()
+	release := make(chan struct{})
+	SetSummarySinks(summarySinkFunc(func(ctx context.Context, rec SummaryRecord) error {
+		<-release // still writing when the sinks are replaced
+		return sink.WriteSummary(ctx, rec)
+	}))
+	for range 3 {
+		globalSummaries.emit(SummaryRecord{Type: SummarySession})
+	}
+
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+	SetSummarySinks()
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	assert.Len(t, sink.records, 3, "queued records are written before the sinks are replaced")
+}
+
+// summarySinkFunc adapts a function to SummarySink.
+type summarySinkFunc func(ctx context.Context, rec SummaryRecord) error
+
+func (f summarySinkFunc) WriteSummary(ctx context.Context, rec SummaryRecord) error {
+	return f(ctx, rec)
+}
+
+func TestFileSummarySink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summaries.jsonl")
+	sink, err := NewFileSummarySink(path)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.WriteSummary(context.Background(), SummaryRecord{Type: SummarySession, SessionID: "a"}))
+	require.NoError(t, sink.WriteSummary(context.Background(), SummaryRecord{Type: SummarySubscription, TrackName: "video"}))
+	require.NoError(t, sink.Close())
+
+	// Reopening appends
+	sink, err = NewFileSummarySink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.WriteSummary(context.Background(), SummaryRecord{Type: SummarySession, SessionID: "b"}))
+	require.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []SummaryRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec SummaryRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	require.Len(t, records, 3)
+	assert.Equal(t, "a", records[0].SessionID)
+	assert.Equal(t, "video", records[1].TrackName)
+	assert.Equal(t, "b", records[2].SessionID)
+}
+
+func TestFileSummarySink_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "summaries.jsonl")
+	sink, err := NewFileSummarySink(path)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.WriteSummary(context.Background(), SummaryRecord{SessionID: "a"}))
+	// logrotate moves the file away, then asks the relay to reopen it
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, sink.Reopen())
+	require.NoError(t, sink.WriteSummary(context.Background(), SummaryRecord{SessionID: "b"}))
+
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Contains(t, string(rotated), `"session_id":"a"`)
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(current), `"session_id":"b"`)
+	assert.NotContains(t, string(current), `"session_id":"a"`)
+
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.Mkdir(path, 0o755))
+	assert.Error(t, sink.Reopen(), "a path that cannot be opened keeps the old file")
+	assert.NoError(t, sink.WriteSummary(context.Background(), SummaryRecord{SessionID: "c"}))
+}
+
+func TestHTTPSummarySink(t *testing.T) {
+	var got SummaryRecord
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink := &HTTPSummarySink{URL: srv.URL}
+	require.NoError(t, sink.WriteSummary(context.Background(), SummaryRecord{Type: SummarySession, Tracks: 3}))
+	assert.Equal(t, 3, got.Tracks)
+}
+
+func TestHTTPSummarySink_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	sink := &HTTPSummarySink{URL: srv.URL}
+	assert.Error(t, sink.WriteSummary(context.Background(), SummaryRecord{Type: SummarySession}))
+}
+
+func TestTrackDistributor_RecordGroup(t *testing.T) {
+	counters := &sessionCounters{}
+	d := &trackDistributor{
+		path:        "/live/test",
+		track:       "video",
+		ring:        newGroupRing(DefaultGroupCacheSize, DefaultFramePool),
+		subscribers: make(map[chan struct{}]struct{}),
+		session:     counters,
+	}
+
+	d.recordGroup(d.ring.add(&fakeGroupSource{seq: 1, frames: []string{"abc", "de"}, end: io.EOF}, nil))
+	d.recordGroup(d.ring.add(&fakeGroupSource{seq: 2, frames: []string{"f"}, end: os.ErrDeadlineExceeded}, nil))
+
+	assert.Equal(t, uint64(2), counters.groups.Load())
+	assert.Equal(t, uint64(6), counters.bytes.Load())
+	assert.Equal(t, uint64(1), counters.incomplete.Load())
+}
@@ -0,0 +1,102 @@
+package relay
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// Time-shifted subscriptions.
+//
+// A subscriber starts behind live by subscribing to
+// TimeShiftTrackName(track, shift) instead of the track, e.g. "video@-3g"
+// for three groups behind the latest or "video@-10s" for the group that was
+// live ten seconds ago. It is served from the track's group cache, then
+// follows the track as usual, so the rewind is bounded by the cache: a
+// shift reaching further back starts at the oldest cached group.
+const timeShiftSeparator = "@-"
+
+// TimeShift is how far behind live a subscription starts. Groups takes
+// precedence over Duration; the zero TimeShift starts at live.
+type TimeShift struct {
+	Groups   int
+	Duration time.Duration
+}
+
+// TimeShiftTrackName returns the variant of track starting shift behind
+// live. Durations are rounded down to whole seconds.
+func TimeShiftTrackName(track moqt.TrackName, shift TimeShift) moqt.TrackName {
+	switch {
+	case shift.Groups > 0:
+		return track + moqt.TrackName(timeShiftSeparator+strconv.Itoa(shift.Groups)+"g")
+	case shift.Duration >= time.Second:
+		return track + moqt.TrackName(timeShiftSeparator+strconv.Itoa(int(shift.Duration/time.Second))+"s")
+	}
+	return track
+}
+
+// parseTimeShiftTrackName splits a time-shifted track name into the track
+// and the shift.
+func parseTimeShiftTrackName(name moqt.TrackName) (track moqt.TrackName, shift TimeShift, ok bool) {
+	i := strings.LastIndex(string(name), timeShiftSeparator)
+	if i <= 0 {
+		return "", TimeShift{}, false
+	}
+	spec := string(name[i+len(timeShiftSeparator):])
+	if len(spec) < 2 {
+		return "", TimeShift{}, false
+	}
+	n, err := strconv.Atoi(spec[:len(spec)-1])
+	if err != nil || n < 1 {
+		return "", TimeShift{}, false
+	}
+	switch spec[len(spec)-1] {
+	case 'g':
+		shift.Groups = n
+	case 's':
+		shift.Duration = time.Duration(n) * time.Second
+	default:
+		return "", TimeShift{}, false
+	}
+	return name[:i], shift, true
+}
+
+// startPosition returns the ring position a subscription shifted by shift
+// starts at: the head for live, otherwise a cached group no older than the
+// oldest one the ring holds. If the publisher hints keyframes, it is moved
+// back to the newest keyframe group at or before it, if one is cached.
+func (ring *groupRing) startPosition(shift TimeShift, now time.Time) moqt.GroupSequence {
+	pos := ring.shiftPosition(shift, now)
+	if key, ok := ring.keyframePosition(pos); ok {
+		return key
+	}
+	return pos
+}
+
+// shiftPosition returns the ring position shift behind live.
+func (ring *groupRing) shiftPosition(shift TimeShift, now time.Time) moqt.GroupSequence {
+	head := ring.head()
+	if head == 0 || (shift.Groups <= 0 && shift.Duration <= 0) {
+		return head
+	}
+	earliest := ring.earliestAvailable()
+
+	if shift.Groups > 0 {
+		if head <= moqt.GroupSequence(shift.Groups) {
+			return earliest
+		}
+		return max(head-moqt.GroupSequence(shift.Groups), earliest)
+	}
+
+	// The newest group that had started by the cutoff was live then
+	cutoff := now.Add(-shift.Duration)
+	for pos := head; pos >= earliest && pos > 0; pos-- {
+		cache := ring.get(pos)
+		if cache != nil && cache.pos == uint64(pos) && !cache.createdAt.After(cutoff) {
+			return pos
+		}
+	}
+	return earliest
+}
@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeShiftTrackName(t *testing.T) {
+	for _, tt := range []struct {
+		shift TimeShift
+		name  moqt.TrackName
+	}{
+		{TimeShift{Groups: 3}, "video@-3g"},
+		{TimeShift{Duration: 10 * time.Second}, "video@-10s"},
+		{TimeShift{Duration: 2500 * time.Millisecond}, "video@-2s"},
+		{TimeShift{}, "video"},
+	} {
+		assert.Equal(t, tt.name, TimeShiftTrackName("video", tt.shift))
+	}
+
+	track, shift, ok := parseTimeShiftTrackName("my@-track@-10s")
+	require.True(t, ok)
+	assert.Equal(t, moqt.TrackName("my@-track"), track)
+	assert.Equal(t, TimeShift{Duration: 10 * time.Second}, shift)
+
+	for _, name := range []moqt.TrackName{"video", "@-3g", "video@-", "video@-g", "video@-0g", "video@--3g", "video@-3m"} {
+		_, _, ok := parseTimeShiftTrackName(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestGroupRingStartPosition(t *testing.T) {
+	now := time.Now()
+	ring := newGroupRing(4, DefaultFramePool)
+	assert.Equal(t, moqt.GroupSequence(0), ring.startPosition(TimeShift{Groups: 2}, now), "empty ring")
+
+	// Six groups a second apart; the ring keeps positions 3-6
+	for seq := moqt.GroupSequence(1); seq <= 6; seq++ {
+		cache, _ := ring.add(&fakeGroupSource{seq: seq, frames: []string{"x"}, end: io.EOF}, nil)
+		cache.createdAt = now.Add(time.Duration(seq-6) * time.Second)
+	}
+
+	for _, tt := range []struct {
+		shift TimeShift
+		want  moqt.GroupSequence
+	}{
+		{TimeShift{}, 6},
+		{TimeShift{Groups: 1}, 5},
+		{TimeShift{Groups: 3}, 3},
+		{TimeShift{Groups: 10}, 3}, // clamped to the cache
+		{TimeShift{Duration: time.Second}, 5},
+		{TimeShift{Duration: 1500 * time.Millisecond}, 4},
+		{TimeShift{Duration: time.Minute}, 3},
+	} {
+		assert.Equal(t, tt.want, ring.startPosition(tt.shift, now), "%+v", tt.shift)
+	}
+
+	ring.trim(2)
+	assert.Equal(t, moqt.GroupSequence(5), ring.startPosition(TimeShift{Groups: 3}, now), "trimmed")
+	assert.Equal(t, moqt.GroupSequence(5), ring.startPosition(TimeShift{Duration: time.Minute}, now), "trimmed")
+}
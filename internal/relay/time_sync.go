@@ -0,0 +1,70 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// ServerTimeExtension is the setup extension in which the relay returns
+// its wall-clock time, in Unix microseconds, when it accepted the session.
+// Together with the client's send and receive times of the setup it gives
+// a first skew estimate without an extra round trip; GET /time refines it.
+const ServerTimeExtension moqt.ExtensionKey = 0x71756d6f03
+
+// ServerTime is the body of GET /time. Its fields follow NTP: a client
+// records ClientTime when it sends the request and its own clock when the
+// response arrives, then passes all four times to ClockSkew.
+type ServerTime struct {
+	// ClientTime echoes the client_time_us query parameter, if given.
+	ClientTime int64 `json:"client_time_us,omitempty"`
+
+	// ReceiveTime and TransmitTime are the relay's clock when the request
+	// arrived and when the response was written, in Unix microseconds.
+	ReceiveTime  int64 `json:"receive_time_us"`
+	TransmitTime int64 `json:"transmit_time_us"`
+}
+
+// TimeHandlerFunc returns the relay's clock, for players and downstream
+// relays estimating their skew to it, so latencies measured across hosts
+// can be corrected. Pass ?client_time_us=<Unix microseconds> to have it
+// echoed back.
+func TimeHandlerFunc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		received := time.Now()
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var resp ServerTime
+		if v := r.URL.Query().Get("client_time_us"); v != "" {
+			t, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || t <= 0 {
+				jsonError(w, http.StatusBadRequest, "client_time_us must be a positive integer")
+				return
+			}
+			resp.ClientTime = t
+		}
+		resp.ReceiveTime = received.UnixMicro()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		resp.TransmitTime = time.Now().UnixMicro()
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// ClockSkew estimates how far a server's clock is ahead of the client's,
+// and the round-trip time excluding the server's processing, from the
+// client's send time t0, the server's receive and transmit times t1 and t2,
+// and the client's receive time t3. The estimate is off by at most half
+// the difference between the two directions' delays.
+func ClockSkew(t0, t1, t2, t3 time.Time) (offset, rtt time.Duration) {
+	offset = (t1.Sub(t0) + t2.Sub(t3)) / 2
+	rtt = t3.Sub(t0) - t2.Sub(t1)
+	return offset, rtt
+}
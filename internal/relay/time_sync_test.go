@@ -0,0 +1,49 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeHandlerFunc(t *testing.T) {
+	h := TimeHandlerFunc()
+
+	before := time.Now().UnixMicro()
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/time?client_time_us=1700000000000000", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	var resp ServerTime
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, int64(1700000000000000), resp.ClientTime)
+	assert.GreaterOrEqual(t, resp.ReceiveTime, before)
+	assert.GreaterOrEqual(t, resp.TransmitTime, resp.ReceiveTime)
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/time?client_time_us=soon", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/time", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestClockSkew(t *testing.T) {
+	t0 := time.UnixMilli(1_700_000_000_000)
+
+	// Server 500ms ahead, 20ms each way, 2ms processing
+	t1 := t0.Add(500*time.Millisecond + 20*time.Millisecond)
+	t2 := t1.Add(2 * time.Millisecond)
+	t3 := t0.Add(42 * time.Millisecond)
+
+	offset, rtt := ClockSkew(t0, t1, t2, t3)
+	assert.Equal(t, 500*time.Millisecond, offset)
+	assert.Equal(t, 40*time.Millisecond, rtt)
+}
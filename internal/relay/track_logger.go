@@ -0,0 +1,23 @@
+package relay
+
+import "log/slog"
+
+// trackLogger returns the logger for a relayed track, bound once to the
+// fields that correlate its log lines: broadcast_path, track_name and, if
+// known, the publishing session's session_id, as logged by Server.Relay.
+func trackLogger(path, track, sessionID string) *slog.Logger {
+	logger := slog.With("broadcast_path", path, "track_name", track)
+	if sessionID != "" {
+		logger = logger.With("session_id", sessionID)
+	}
+	return logger
+}
+
+// log returns the distributor's track logger, or the default logger for
+// distributors built without one.
+func (d *trackDistributor) log() *slog.Logger {
+	if d.logger != nil {
+		return d.logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,39 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackLogger(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	d := &trackDistributor{logger: trackLogger("/live/a", "video", "s-1")}
+	d.recordGroup(&groupCache{seq: 7}, groupStalled)
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "/live/a", line["broadcast_path"])
+	assert.Equal(t, "video", line["track_name"])
+	assert.Equal(t, "s-1", line["session_id"])
+	assert.Equal(t, float64(7), line["seq"])
+
+	buf.Reset()
+	trackLogger("/live/a", "video", "").Info("x")
+	line = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.NotContains(t, line, "session_id")
+}
+
+func TestTrackDistributor_LogDefault(t *testing.T) {
+	d := &trackDistributor{}
+	assert.Same(t, slog.Default(), d.log())
+}
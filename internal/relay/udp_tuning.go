@@ -0,0 +1,106 @@
+package relay
+
+import (
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UDPTuning sizes the kernel buffers of the relay's UDP sockets. A burst of
+// packets larger than the receive buffer is dropped by the kernel before
+// quic-go reads it, which shows up as loss on every connection at once.
+//
+// quic-go raises both buffers to 7 MiB when it opens a transport, so sizes
+// below that have no effect. GSO is left to quic-go, which uses it where the
+// kernel supports it unless QUIC_GO_DISABLE_GSO is set; its receive path
+// reads one packet per datagram, so GRO is not enabled.
+type UDPTuning struct {
+	ReceiveBuffer int // SO_RCVBUF in bytes; 0 leaves it to quic-go
+	SendBuffer    int // SO_SNDBUF in bytes; 0 leaves it to quic-go
+}
+
+// tuneUDP applies t to udp, warning if the kernel caps a buffer below the
+// size asked for, and exports the socket's buffers and drops.
+func tuneUDP(udp *net.UDPConn, t UDPTuning) {
+	if t.ReceiveBuffer > 0 {
+		if got := setUDPBuffer(udp, t.ReceiveBuffer, false); got < t.ReceiveBuffer {
+			slog.Warn("udp: receive buffer capped by the kernel; raise net.core.rmem_max",
+				"wanted", t.ReceiveBuffer, "got", got)
+		}
+	}
+	if t.SendBuffer > 0 {
+		if got := setUDPBuffer(udp, t.SendBuffer, true); got < t.SendBuffer {
+			slog.Warn("udp: send buffer capped by the kernel; raise net.core.wmem_max",
+				"wanted", t.SendBuffer, "got", got)
+		}
+	}
+	globalUDPSockets.add(udp)
+}
+
+// udpSockets are the sockets exported by udpSocketCollector.
+type udpSockets struct {
+	mu    sync.Mutex
+	conns []*net.UDPConn
+}
+
+var globalUDPSockets udpSockets
+
+func (s *udpSockets) add(udp *net.UDPConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns = append(s.conns, udp)
+}
+
+// snapshot returns the sockets in the order they were added.
+func (s *udpSockets) snapshot() []*net.UDPConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*net.UDPConn(nil), s.conns...)
+}
+
+var (
+	udpBufferDesc = prometheus.NewDesc(
+		"qumo_relay_udp_buffer_bytes",
+		"Kernel buffer size of a relay UDP socket.",
+		[]string{"socket", "direction"}, nil,
+	)
+
+	udpDropsDesc = prometheus.NewDesc(
+		"qumo_relay_udp_socket_drops_total",
+		"Packets the kernel dropped on a relay UDP socket, mostly because its receive buffer was full.",
+		[]string{"socket"}, nil,
+	)
+)
+
+// udpSocketCollector exports the buffers and drops of the tuned sockets,
+// labelled by their index. Closed sockets are skipped, and platforms that
+// cannot report them export none.
+type udpSocketCollector struct{}
+
+func (udpSocketCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- udpBufferDesc
+	ch <- udpDropsDesc
+}
+
+func (udpSocketCollector) Collect(ch chan<- prometheus.Metric) {
+	for i, udp := range globalUDPSockets.snapshot() {
+		stats, ok := udpSocketStatsOf(udp)
+		if !ok {
+			continue
+		}
+		socket := strconv.Itoa(i)
+		ch <- prometheus.MustNewConstMetric(udpBufferDesc, prometheus.GaugeValue, float64(stats.receiveBuffer), socket, "receive")
+		ch <- prometheus.MustNewConstMetric(udpBufferDesc, prometheus.GaugeValue, float64(stats.sendBuffer), socket, "send")
+		ch <- prometheus.MustNewConstMetric(udpDropsDesc, prometheus.CounterValue, float64(stats.drops), socket)
+	}
+}
+
+// udpSocketStats are the kernel's figures for a socket.
+type udpSocketStats struct {
+	receiveBuffer int
+	sendBuffer    int
+	drops         uint64
+}
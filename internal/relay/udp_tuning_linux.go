@@ -0,0 +1,100 @@
+package relay
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// setUDPBuffer sets the receive or send buffer of udp to size, forcing it
+// past the sysctl cap if the process has CAP_NET_ADMIN, and returns the
+// size the kernel granted.
+func setUDPBuffer(udp *net.UDPConn, size int, send bool) int {
+	opt, force := unix.SO_RCVBUF, unix.SO_RCVBUFFORCE
+	if send {
+		opt, force = unix.SO_SNDBUF, unix.SO_SNDBUFFORCE
+		udp.SetWriteBuffer(size)
+	} else {
+		udp.SetReadBuffer(size)
+	}
+
+	raw, err := udp.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	got := 0
+	raw.Control(func(fd uintptr) {
+		if got = udpBuffer(int(fd), opt); got < size {
+			unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, force, size)
+			got = udpBuffer(int(fd), opt)
+		}
+	})
+	return got
+}
+
+// udpBuffer returns a buffer size of fd as it was set: the kernel reports
+// twice that to account for its bookkeeping.
+func udpBuffer(fd, opt int) int {
+	n, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, opt)
+	if err != nil {
+		return 0
+	}
+	return n / 2
+}
+
+// udpSocketStatsOf reads the buffers of udp and its drop counter, which
+// /proc/net/udp{,6} lists by socket inode.
+func udpSocketStatsOf(udp *net.UDPConn) (udpSocketStats, bool) {
+	raw, err := udp.SyscallConn()
+	if err != nil {
+		return udpSocketStats{}, false
+	}
+	var stats udpSocketStats
+	var inode uint64
+	var statErr error
+	if err := raw.Control(func(fd uintptr) {
+		stats.receiveBuffer = udpBuffer(int(fd), unix.SO_RCVBUF)
+		stats.sendBuffer = udpBuffer(int(fd), unix.SO_SNDBUF)
+		var st unix.Stat_t
+		statErr = unix.Fstat(int(fd), &st)
+		inode = st.Ino
+	}); err != nil || statErr != nil {
+		return udpSocketStats{}, false
+	}
+
+	for _, table := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+		if drops, ok := procUDPDrops(table, inode); ok {
+			stats.drops = drops
+			break
+		}
+	}
+	return stats, true
+}
+
+// procUDPDrops returns the drops column of the socket with inode in a
+// /proc/net/udp table.
+func procUDPDrops(table string, inode uint64) (uint64, bool) {
+	f, err := os.Open(table)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	want := strconv.FormatUint(inode, 10)
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local rem st tx:rx tr:when retrnsmt uid timeout inode ref pointer drops
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 || fields[9] != want {
+			continue
+		}
+		drops, err := strconv.ParseUint(fields[12], 10, 64)
+		return drops, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,60 @@
+package relay
+
+import (
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTuneUDP(t *testing.T) {
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer udp.Close()
+
+	tuneUDP(udp, UDPTuning{ReceiveBuffer: 64 << 10, SendBuffer: 32 << 10})
+
+	stats, ok := udpSocketStatsOf(udp)
+	require.True(t, ok)
+	assert.Equal(t, 64<<10, stats.receiveBuffer)
+	assert.Equal(t, 32<<10, stats.sendBuffer)
+	assert.Contains(t, globalUDPSockets.snapshot(), udp)
+}
+
+func TestUDPSocketStats_Drops(t *testing.T) {
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer udp.Close()
+	require.NoError(t, udp.SetReadBuffer(4096))
+
+	sender, err := net.DialUDP("udp", nil, udp.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer sender.Close()
+
+	// Nothing reads the socket, so its small buffer overflows.
+	packet := make([]byte, 1200)
+	for range 64 {
+		sender.Write(packet)
+	}
+
+	stats, ok := udpSocketStatsOf(udp)
+	require.True(t, ok)
+	assert.Positive(t, stats.drops)
+}
+
+func TestUDPSocketCollector(t *testing.T) {
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer udp.Close()
+	tuneUDP(udp, UDPTuning{})
+
+	closed, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	tuneUDP(closed, UDPTuning{})
+	closed.Close()
+
+	// Sockets closed by this or other tests are skipped.
+	assert.Equal(t, 3, testutil.CollectAndCount(udpSocketCollector{}))
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package relay
+
+import "net"
+
+// setUDPBuffer sets the receive or send buffer of udp to size. The size
+// granted cannot be read back here, so it is reported as granted.
+func setUDPBuffer(udp *net.UDPConn, size int, send bool) int {
+	if send {
+		udp.SetWriteBuffer(size)
+	} else {
+		udp.SetReadBuffer(size)
+	}
+	return size
+}
+
+// udpSocketStatsOf reports nothing outside Linux.
+func udpSocketStatsOf(*net.UDPConn) (udpSocketStats, bool) {
+	return udpSocketStats{}, false
+}
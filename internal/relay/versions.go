@@ -0,0 +1,124 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// MoQ version negotiation.
+//
+// Clients list the MoQ versions they speak in their session setup; the
+// relay picks the first of its accepted versions, in its order of
+// preference, that the client offered, and refuses the session with
+// UnsupportedVersionErrorCode if there is none. The selected version is
+// logged with the session, listed in /admin/sessions and counted in
+// qumo_relay_sessions_by_version, so operators can tell when the last
+// client of an old version is gone before dropping it from Config.Versions.
+
+// SupportedVersions are the MoQ versions the relay can speak, in its order
+// of preference. gomoqt v0.10 only implements its development version; the
+// MoQ Lite drafts are only named, for the logs of clients offering them.
+var SupportedVersions = []moqt.Version{moqt.Development}
+
+// versionNames names the known versions in configs, logs and metrics.
+var versionNames = map[moqt.Version]string{
+	moqt.Development: "development",
+	moqt.LiteDraft02: "lite-02",
+	moqt.LiteDraft01: "lite-01",
+}
+
+// VersionName returns the name of v, or its number in hex if it has none.
+func VersionName(v moqt.Version) string {
+	if name, ok := versionNames[v]; ok {
+		return name
+	}
+	return "0x" + strconv.FormatUint(uint64(v), 16)
+}
+
+// ParseVersion returns the supported version named name, such as
+// "development", or given by its number, such as "0xfeedbabe".
+func ParseVersion(name string) (moqt.Version, error) {
+	for v, n := range versionNames {
+		if n == name && slices.Contains(SupportedVersions, v) {
+			return v, nil
+		}
+	}
+	if hex, ok := strings.CutPrefix(name, "0x"); ok {
+		if n, err := strconv.ParseUint(hex, 16, 64); err == nil && slices.Contains(SupportedVersions, moqt.Version(n)) {
+			return moqt.Version(n), nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported MoQ version %q", name)
+}
+
+// AcceptedVersions returns the MoQ versions the relay accepts, in order of
+// preference.
+func (c *Config) AcceptedVersions() []moqt.Version {
+	if c != nil && len(c.Versions) > 0 {
+		return c.Versions
+	}
+	return SupportedVersions
+}
+
+// validateVersions checks that the relay can speak every accepted version.
+func (c *Config) validateVersions() error {
+	if c == nil {
+		return nil
+	}
+	for _, v := range c.Versions {
+		if !slices.Contains(SupportedVersions, v) {
+			return fmt.Errorf("relay: unsupported MoQ version %s", VersionName(v))
+		}
+	}
+	return nil
+}
+
+// selectVersion returns the first of accepted that the client offered.
+func selectVersion(offered, accepted []moqt.Version) (moqt.Version, bool) {
+	for _, v := range accepted {
+		if slices.Contains(offered, v) {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// negotiateVersion selects the session's version from the versions the
+// client offered in r, or refuses the session and reports false.
+func (s *Server) negotiateVersion(w moqt.SetupResponseWriter, r *moqt.SetupRequest) (moqt.Version, bool) {
+	v, ok := selectVersion(r.Versions, s.config.AcceptedVersions())
+	if ok {
+		ok = w.SelectVersion(v) == nil
+	}
+	if !ok {
+		offered := make([]string, len(r.Versions))
+		for i, v := range r.Versions {
+			offered[i] = VersionName(v)
+		}
+		sessionsRefused.WithLabelValues("unsupported_version").Inc()
+		slog.Info("refusing session: no common MoQ version", "offered", offered)
+		_ = w.Reject(moqt.UnsupportedVersionErrorCode)
+		return 0, false
+	}
+	return v, true
+}
+
+type sessionVersionKey struct{}
+
+// withSessionVersion returns a context carrying the MoQ version selected
+// for the session being relayed.
+func withSessionVersion(ctx context.Context, v moqt.Version) context.Context {
+	return context.WithValue(ctx, sessionVersionKey{}, v)
+}
+
+// sessionVersionFromContext returns the session's MoQ version, if known.
+func sessionVersionFromContext(ctx context.Context) (moqt.Version, bool) {
+	v, ok := ctx.Value(sessionVersionKey{}).(moqt.Version)
+	return v, ok
+}
@@ -0,0 +1,132 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/gomoqt/quic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, v := range SupportedVersions {
+		parsed, err := ParseVersion(VersionName(v))
+		require.NoError(t, err)
+		assert.Equal(t, v, parsed)
+	}
+
+	v, err := ParseVersion("0xfeedbabe")
+	require.NoError(t, err)
+	assert.Equal(t, moqt.Development, v)
+
+	// gomoqt does not implement the MoQ Lite drafts
+	for _, name := range []string{"", "lite-02", "0xff0dad01", "lite-03", "0xff0dad03", "0xzz"} {
+		_, err := ParseVersion(name)
+		assert.Error(t, err, name)
+	}
+	assert.Equal(t, "lite-02", VersionName(moqt.LiteDraft02))
+	assert.Equal(t, "0xff0dad03", VersionName(0xff0dad03))
+}
+
+func TestSelectVersion(t *testing.T) {
+	accepted := []moqt.Version{moqt.LiteDraft02, moqt.Development}
+
+	v, ok := selectVersion([]moqt.Version{moqt.Development, moqt.LiteDraft02}, accepted)
+	require.True(t, ok)
+	assert.Equal(t, moqt.LiteDraft02, v, "the relay's preference wins")
+
+	v, ok = selectVersion([]moqt.Version{moqt.LiteDraft01, moqt.Development}, accepted)
+	require.True(t, ok)
+	assert.Equal(t, moqt.Development, v)
+
+	_, ok = selectVersion([]moqt.Version{moqt.LiteDraft01}, accepted)
+	assert.False(t, ok)
+	_, ok = selectVersion(nil, accepted)
+	assert.False(t, ok)
+}
+
+func TestServer_ConfigureUnsupportedVersion(t *testing.T) {
+	serverTLS, _ := testTLS(t)
+	s := &Server{TLSConfig: serverTLS, Config: &Config{Versions: []moqt.Version{moqt.Development, moqt.LiteDraft02}}}
+	assert.ErrorContains(t, s.Configure(), "unsupported MoQ version lite-02")
+	assert.Equal(t, StateNew, s.State())
+
+	assert.Equal(t, SupportedVersions, (*Config)(nil).AcceptedVersions())
+}
+
+// setupWriter records the answer to a session setup.
+type setupWriter struct {
+	selected moqt.Version
+	rejected moqt.SessionErrorCode
+}
+
+func (w *setupWriter) SelectVersion(v moqt.Version) error      { w.selected = v; return nil }
+func (w *setupWriter) SetExtensions(*moqt.Extension)           {}
+func (w *setupWriter) Reject(code moqt.SessionErrorCode) error { w.rejected = code; return nil }
+
+func TestServer_NegotiateVersion(t *testing.T) {
+	s := &Server{}
+
+	w := &setupWriter{}
+	v, ok := s.negotiateVersion(w, &moqt.SetupRequest{Versions: []moqt.Version{moqt.LiteDraft02, moqt.Development}})
+	require.True(t, ok)
+	assert.Equal(t, moqt.Development, v)
+	assert.Equal(t, moqt.Development, w.selected)
+
+	w = &setupWriter{}
+	_, ok = s.negotiateVersion(w, &moqt.SetupRequest{Versions: []moqt.Version{moqt.LiteDraft02}})
+	assert.False(t, ok)
+	assert.Equal(t, moqt.UnsupportedVersionErrorCode, w.rejected)
+}
+
+func TestServer_VersionNegotiation(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	serverTLS.NextProtos, clientTLS.NextProtos = []string{moqt.NextProtoMOQ}, []string{moqt.NextProtoMOQ}
+
+	addr := freeUDPAddr(t)
+	server := &Server{
+		Addr:       addr,
+		TLSConfig:  serverTLS,
+		QUICConfig: &quic.Config{EnableDatagrams: true},
+		Config:     &Config{Versions: []moqt.Version{moqt.Development}},
+		TrackMux:   moqt.NewTrackMux(),
+	}
+	go server.ListenAndServe()
+	defer server.Close()
+
+	client := &moqt.Client{TLSConfig: clientTLS, QUICConfig: &quic.Config{EnableDatagrams: true}}
+	defer client.Close()
+	var (
+		sess *moqt.Session
+		err  error
+	)
+	// The server may still be starting
+	for range 50 {
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		sess, err = client.Dial(ctx, "moqt://"+addr, moqt.NewTrackMux())
+		cancel()
+		if err == nil || server.State() == StateRunning {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	defer sess.CloseWithError(moqt.NoError, "done")
+
+	var listing struct {
+		Sessions []peerInfo `json:"sessions"`
+	}
+	require.Eventually(t, func() bool {
+		rec := httptest.NewRecorder()
+		SessionsHandlerFunc(server)(rec, httptest.NewRequest(http.MethodGet, "/admin/sessions", nil))
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&listing))
+		return len(listing.Sessions) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "development", listing.Sessions[0].Version)
+}
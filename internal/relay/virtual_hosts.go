@@ -0,0 +1,168 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/gomoqt/quic"
+	"github.com/okdaichi/gomoqt/quic/quicgo"
+)
+
+// VirtualHosts serves several logical relays from one QUIC listener. Each
+// relay is a *Server with its own TLS certificate, TrackMux and SDN
+// registration; a session is routed to the relay named by the TLS server
+// name (SNI) of its connection, or to Default if no host matches.
+//
+// VirtualHosts implements the same ListenAndServe/Shutdown/
+// HandleWebTransport surface as Server. Process-wide state — metrics,
+// summaries, events, the publication registry and the egress cap — is
+// shared by all hosts.
+type VirtualHosts struct {
+	Addr       string
+	QUICConfig *quic.Config
+
+	// ListenFunc opens the QUIC listener, such as HandoffListener.ListenFunc.
+	// If nil, VirtualHosts listens on Addr itself.
+	ListenFunc quic.ListenAddrFunc
+
+	// Default serves connections whose server name matches no host.
+	Default *Server
+
+	// Hosts maps a hostname to the relay serving it. Lookups are
+	// case-insensitive.
+	Hosts map[string]*Server
+
+	mu       sync.Mutex
+	listener quic.Listener
+}
+
+// server returns the relay serving name.
+func (v *VirtualHosts) server(name string) *Server {
+	if srv, ok := v.Hosts[strings.ToLower(strings.TrimSuffix(name, "."))]; ok {
+		return srv
+	}
+	return v.Default
+}
+
+// servers returns Default followed by every host's relay.
+func (v *VirtualHosts) servers() []*Server {
+	servers := []*Server{v.Default}
+	for _, srv := range v.Hosts {
+		servers = append(servers, srv)
+	}
+	return servers
+}
+
+// tlsConfig returns the listener's TLS config, which hands each client the
+// TLS config of the relay it names.
+func (v *VirtualHosts) tlsConfig() *tls.Config {
+	cfg := v.Default.TLSConfig.Clone()
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		return v.server(hello.ServerName).TLSConfig, nil
+	}
+	return cfg
+}
+
+// ListenAndServe listens on Addr and routes connections to their relay
+// until Shutdown or Close is called.
+func (v *VirtualHosts) ListenAndServe() error {
+	if v.Default == nil {
+		return errors.New("virtual hosts: no default relay")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, srv := range v.servers() {
+		if err := srv.start(ctx); err != nil {
+			return err
+		}
+		defer srv.transition("stop", StateStopped, StateRunning)
+	}
+
+	listen := v.ListenFunc
+	if listen == nil {
+		listen = quicgo.ListenAddrEarly
+	}
+	ln, err := listen(v.Addr, v.tlsConfig(), v.QUICConfig)
+	if err != nil {
+		return fmt.Errorf("failed to start QUIC listener at %s: %w", v.Addr, err)
+	}
+	v.mu.Lock()
+	v.listener = ln
+	v.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept(ctx)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || errors.Is(err, context.Canceled) {
+				return moqt.ErrServerClosed
+			}
+			return fmt.Errorf("failed to accept QUIC connection: %w", err)
+		}
+
+		srv := v.server(conn.ConnectionState().TLS.ServerName)
+		go func() {
+			if err := srv.server.ServeQUICConn(conn); err != nil {
+				slog.Debug("virtual host connection ended", "err", err)
+			}
+		}()
+	}
+}
+
+// HandleWebTransport hands a WebTransport upgrade to the relay named by the
+// request's TLS server name, or its Host header if it arrived without TLS
+// state.
+func (v *VirtualHosts) HandleWebTransport(w http.ResponseWriter, r *http.Request) error {
+	name := r.Host
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		name = r.TLS.ServerName
+	} else if host, _, err := net.SplitHostPort(name); err == nil {
+		name = host
+	}
+	return v.server(name).HandleWebTransport(w, r)
+}
+
+// Close stops accepting connections and closes every relay.
+func (v *VirtualHosts) Close() error {
+	v.closeListener()
+	for _, srv := range v.servers() {
+		srv.Close()
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and drains every relay in parallel.
+// Each relay records its own ShutdownReport.
+func (v *VirtualHosts) Shutdown(ctx context.Context) error {
+	v.closeListener()
+
+	servers := v.servers()
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = srv.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (v *VirtualHosts) closeListener() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.listener != nil {
+		v.listener.Close()
+	}
+}
@@ -0,0 +1,61 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualHosts_Routing(t *testing.T) {
+	def := &Server{TLSConfig: &tls.Config{ServerName: "default"}}
+	brandB := &Server{TLSConfig: &tls.Config{ServerName: "brand-b"}}
+	v := &VirtualHosts{
+		Default: def,
+		Hosts:   map[string]*Server{"live.brand-b.example": brandB},
+	}
+
+	assert.Same(t, brandB, v.server("live.brand-b.example"))
+	assert.Same(t, brandB, v.server("LIVE.Brand-B.example."), "case-insensitive, trailing dot")
+	assert.Same(t, def, v.server("other.example"))
+	assert.Same(t, def, v.server(""))
+
+	// The handshake picks the host's certificate
+	cfg, err := v.tlsConfig().GetConfigForClient(&tls.ClientHelloInfo{ServerName: "live.brand-b.example"})
+	require.NoError(t, err)
+	assert.Same(t, brandB.TLSConfig, cfg)
+}
+
+func TestVirtualHosts_HandleWebTransport(t *testing.T) {
+	// Draining hosts answer upgrades themselves, which shows where a
+	// request was routed without a real WebTransport server.
+	def := &Server{TLSConfig: &tls.Config{}, Config: &Config{RetryAfter: time.Second}}
+	brandB := &Server{TLSConfig: &tls.Config{}, Config: &Config{RetryAfter: 7 * time.Second}}
+	require.NoError(t, def.Shutdown(context.Background()))
+	require.NoError(t, brandB.Shutdown(context.Background()))
+	v := &VirtualHosts{Default: def, Hosts: map[string]*Server{"live.brand-b.example": brandB}}
+
+	for _, tt := range []struct {
+		name      string
+		host, sni string
+		want      string
+	}{
+		{"sni", "ignored.example", "live.brand-b.example", "7"},
+		{"authority", "live.brand-b.example:4433", "", "7"},
+		{"unknown", "other.example", "", "1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodConnect, "/", nil)
+			r.Host = tt.host
+			r.TLS = &tls.ConnectionState{ServerName: tt.sni}
+			rec := httptest.NewRecorder()
+			require.NoError(t, v.HandleWebTransport(rec, r))
+			assert.Equal(t, tt.want, rec.Header().Get("Retry-After"))
+		})
+	}
+}
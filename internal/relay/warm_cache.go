@@ -0,0 +1,242 @@
+package relay
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+)
+
+// Warm cache preloading. With RemoteFetcher.WarmFile set, the fetcher keeps
+// a record of the remote broadcasts it relayed and their tracks. After a
+// restart it fetches them again before reporting ready, so returning
+// viewers find sessions open and group caches filling instead of a cold
+// relay.
+
+// Defaults for RemoteFetcher's warm cache settings.
+const (
+	DefaultWarmMaxAge  = time.Hour
+	DefaultWarmTimeout = 15 * time.Second
+)
+
+// warmSaveInterval is how often an unchanged warm record is rewritten to
+// refresh its LastServed times.
+const warmSaveInterval = time.Minute
+
+// warmEntry is a remote broadcast the relay served, as persisted in
+// RemoteFetcher.WarmFile.
+type warmEntry struct {
+	Path       string    `json:"path"`
+	Tracks     []string  `json:"tracks"`
+	LastServed time.Time `json:"last_served"`
+}
+
+// Ready returns a channel that is closed once Run preloaded the broadcasts
+// recorded in WarmFile, or gave up after WarmTimeout. Without a WarmFile it
+// is closed as soon as Run starts.
+func (f *RemoteFetcher) Ready() <-chan struct{} {
+	f.readyInit.Do(func() { f.ready = make(chan struct{}) })
+	return f.ready
+}
+
+// Warming reports whether the fetcher is still preloading.
+func (f *RemoteFetcher) Warming() bool {
+	select {
+	case <-f.Ready():
+		return false
+	default:
+		return true
+	}
+}
+
+// markReady closes the Ready channel.
+func (f *RemoteFetcher) markReady() {
+	f.Ready()
+	f.readyDone.Do(func() { close(f.ready) })
+}
+
+// preload fetches the broadcasts recorded in WarmFile that were served
+// within WarmMaxAge and starts relaying their tracks, then marks the
+// fetcher ready.
+func (f *RemoteFetcher) preload(ctx context.Context, gcSize int, pool *FramePool) {
+	defer f.markReady()
+	if f.WarmFile == "" {
+		return
+	}
+
+	entries, err := loadWarmEntries(f.WarmFile)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("remote fetcher: failed to load warm cache record", "file", f.WarmFile, "error", err)
+		}
+		return
+	}
+
+	maxAge := cmp.Or(f.WarmMaxAge, DefaultWarmMaxAge)
+	f.mu.Lock()
+	f.warm = make(map[string]*warmEntry, len(entries))
+	for _, e := range entries {
+		if time.Since(e.LastServed) <= maxAge {
+			f.warm[e.Path] = &e
+		}
+	}
+	n := len(f.warm)
+	f.mu.Unlock()
+	if n == 0 {
+		return
+	}
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.poll(ctx, gcSize, pool)
+		f.prefetchWarm()
+	}()
+	select {
+	case <-done:
+	case <-time.After(cmp.Or(f.WarmTimeout, DefaultWarmTimeout)):
+		slog.Warn("remote fetcher: warm cache preload timed out; reporting ready")
+	case <-ctx.Done():
+	}
+	slog.Info("remote fetcher: warm cache preload finished", "broadcasts", n, "duration", time.Since(start))
+}
+
+// prefetchWarm starts relaying the recorded tracks of the warm broadcasts
+// that are being fetched.
+func (f *RemoteFetcher) prefetchWarm() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	paths, tracks := 0, 0
+	for bp, e := range f.warm {
+		tp, ok := f.tracked[bp]
+		if !ok || tp.handler == nil {
+			continue // no longer announced, or local
+		}
+		paths++
+		for _, name := range e.Tracks {
+			if tp.handler.prefetch(moqt.TrackName(name)) {
+				tracks++
+			}
+		}
+	}
+	slog.Info("remote fetcher: preloaded warm broadcasts", "broadcasts", paths, "tracks", tracks)
+}
+
+// recordWarm notes the remote broadcasts whose relayed tracks served
+// subscribers since the previous call, and saves the record to WarmFile
+// when it changed, or at least every warmSaveInterval. force saves it
+// regardless. Tracks relayed only because they were prefetched do not
+// keep a broadcast warm. Caller must hold f.mu.
+func (f *RemoteFetcher) recordWarm(force bool) {
+	if f.WarmFile == "" {
+		return
+	}
+	if f.warm == nil {
+		f.warm = make(map[string]*warmEntry)
+	}
+
+	now := time.Now()
+	since := f.warmChecked
+	f.warmChecked = now
+	changed := false
+	for bp, tp := range f.tracked {
+		if tp.handler == nil {
+			continue
+		}
+		tp.handler.mu.RLock()
+		names := make([]string, 0, len(tp.handler.relaying))
+		for name, d := range tp.handler.relaying {
+			if d.servedSince(since) {
+				names = append(names, string(name))
+			}
+		}
+		tp.handler.mu.RUnlock()
+		if len(names) == 0 {
+			continue
+		}
+
+		e, ok := f.warm[bp]
+		if !ok {
+			e = &warmEntry{Path: bp}
+			f.warm[bp] = e
+			changed = true
+		}
+		for _, name := range names {
+			if !slices.Contains(e.Tracks, name) {
+				e.Tracks = append(e.Tracks, name)
+				changed = true
+			}
+		}
+		e.LastServed = now
+	}
+
+	maxAge := cmp.Or(f.WarmMaxAge, DefaultWarmMaxAge)
+	for bp, e := range f.warm {
+		if now.Sub(e.LastServed) > maxAge {
+			delete(f.warm, bp)
+			changed = true
+		}
+	}
+
+	if !force && !changed && now.Sub(f.warmSaved) < warmSaveInterval {
+		return
+	}
+	if err := saveWarmEntries(f.WarmFile, f.warm); err != nil {
+		slog.Warn("remote fetcher: failed to save warm cache record", "file", f.WarmFile, "error", err)
+		return
+	}
+	f.warmSaved = now
+}
+
+// loadWarmEntries reads a warm cache record.
+func loadWarmEntries(path string) ([]warmEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []warmEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// saveWarmEntries atomically replaces the warm cache record at path.
+func saveWarmEntries(path string, warm map[string]*warmEntry) error {
+	entries := make([]warmEntry, 0, len(warm))
+	for _, e := range warm {
+		cp := *e
+		cp.Tracks = slices.Sorted(slices.Values(e.Tracks))
+		entries = append(entries, cp)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
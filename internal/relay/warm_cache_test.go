@@ -0,0 +1,122 @@
+package relay
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/gomoqt/moqt"
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteFetcher_RecordWarm(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "warm.json")
+	fetcher := &RemoteFetcher{WarmFile: file, WarmMaxAge: time.Hour}
+	serving := &trackDistributor{}
+	serving.egresses.Store(1)
+	ended := &trackDistributor{} // its subscriber left since the previous record
+	ended.servedAt.Store(time.Now().UnixNano())
+	prefetched := &trackDistributor{}
+	fetcher.tracked = map[string]*trackedPath{
+		"/live/a": {handler: &RelayHandler{relaying: map[moqt.TrackName]*trackDistributor{
+			"video": serving, "audio": ended, "captions": prefetched,
+		}}},
+		"/live/b": {handler: &RelayHandler{relaying: map[moqt.TrackName]*trackDistributor{
+			"video": prefetched,
+		}}},
+		"/live/idle":  {handler: &RelayHandler{}}, // nothing relayed
+		"/live/local": {},                         // no handler
+	}
+	stale := time.Now().Add(-time.Minute)
+	fetcher.warm = map[string]*warmEntry{
+		"/live/old": {Path: "/live/old", Tracks: []string{"video"}, LastServed: time.Now().Add(-2 * time.Hour)},
+		"/live/b":   {Path: "/live/b", Tracks: []string{"video"}, LastServed: stale},
+	}
+	fetcher.warmChecked = time.Now().Add(-time.Second)
+
+	fetcher.recordWarm(false)
+
+	entries, err := loadWarmEntries(file)
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "entries past WarmMaxAge are dropped")
+	assert.Equal(t, "/live/a", entries[0].Path)
+	assert.Equal(t, []string{"audio", "video"}, entries[0].Tracks, "prefetched tracks nobody subscribed to are not recorded")
+	assert.WithinDuration(t, time.Now(), entries[0].LastServed, time.Second)
+	assert.Equal(t, "/live/b", entries[1].Path, "only prefetched but still recent")
+	assert.WithinDuration(t, stale, entries[1].LastServed, time.Millisecond, "prefetching does not refresh it")
+}
+
+func TestRemoteFetcher_RecordWarmDisabled(t *testing.T) {
+	fetcher := &RemoteFetcher{}
+	fetcher.tracked = map[string]*trackedPath{
+		"/live/a": {handler: &RelayHandler{relaying: map[moqt.TrackName]*trackDistributor{"video": {}}}},
+	}
+	fetcher.recordWarm(true)
+	assert.Nil(t, fetcher.warm)
+}
+
+func TestRemoteFetcher_PreloadWithoutRecord(t *testing.T) {
+	tests := map[string]func(t *testing.T) string{
+		"disabled": func(t *testing.T) string { return "" },
+		"missing":  func(t *testing.T) string { return filepath.Join(t.TempDir(), "warm.json") },
+		"stale": func(t *testing.T) string {
+			file := filepath.Join(t.TempDir(), "warm.json")
+			require.NoError(t, saveWarmEntries(file, map[string]*warmEntry{
+				"/live/a": {Path: "/live/a", LastServed: time.Now().Add(-2 * time.Hour)},
+			}))
+			return file
+		},
+	}
+
+	for name, file := range tests {
+		t.Run(name, func(t *testing.T) {
+			fetcher := &RemoteFetcher{WarmFile: file(t)}
+			assert.True(t, fetcher.Warming())
+
+			fetcher.preload(context.Background(), DefaultGroupCacheSize, DefaultFramePool)
+
+			assert.False(t, fetcher.Warming())
+			assert.Empty(t, fetcher.warm)
+		})
+	}
+}
+
+func TestRemoteFetcher_PreloadBecomesReady(t *testing.T) {
+	srv := mockSDN(t, []testAnnounceEntry{}, nil)
+	defer srv.Close()
+
+	sdnClient, err := sdn.NewClient(sdn.ClientConfig{
+		URL:               srv.URL,
+		RelayName:         "relay-a",
+		HeartbeatInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "warm.json")
+	require.NoError(t, saveWarmEntries(file, map[string]*warmEntry{
+		"/live/a": {Path: "/live/a", Tracks: []string{"video"}, LastServed: time.Now()},
+	}))
+
+	fetcher := &RemoteFetcher{
+		SDNClient: sdnClient,
+		TrackMux:  moqt.NewTrackMux(),
+		WarmFile:  file,
+	}
+	fetcher.sessions = make(map[string]*remoteSession)
+	fetcher.tracked = make(map[string]*trackedPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetcher.preload(ctx, DefaultGroupCacheSize, DefaultFramePool)
+
+	select {
+	case <-fetcher.Ready():
+	default:
+		t.Fatal("fetcher should be ready after preload")
+	}
+	// The broadcast is no longer announced; its record is kept until it ages out.
+	assert.Contains(t, fetcher.warm, "/live/a")
+}
@@ -0,0 +1,120 @@
+package sdn
+
+import (
+	"sort"
+	"time"
+)
+
+// maxAnnounceChanges is how many changes the announce table keeps for
+// differential listing. Clients further behind get the full list.
+const maxAnnounceChanges = 10000
+
+// AnnounceRef identifies an announcement.
+type AnnounceRef struct {
+	Relay         string `json:"relay"`
+	BroadcastPath string `json:"broadcast_path"`
+}
+
+// AnnounceDelta is the response of GET /announce?since=<version>: the
+// announcements added or changed and the ones removed after since, or the
+// whole table with Full set when the controller no longer has the changes
+// (or never had them, e.g. after a restart).
+type AnnounceDelta struct {
+	Version uint64 `json:"version"`
+	Full    bool   `json:"full,omitempty"`
+
+	Entries []AnnounceEntry `json:"entries,omitempty"` // with Full
+	Added   []AnnounceEntry `json:"added,omitempty"`
+	Removed []AnnounceRef   `json:"removed,omitempty"`
+}
+
+// announceChange is one entry of the announce table's change log.
+type announceChange struct {
+	version uint64
+	removed bool
+	entry   AnnounceEntry
+}
+
+// newAnnounceVersion returns the first version of a new table. It is based
+// on the clock so versions keep increasing across controller restarts and
+// a client's cursor from before a restart resyncs in full.
+func newAnnounceVersion() uint64 {
+	return uint64(time.Now().UnixNano())
+}
+
+// record appends a change and bumps the version, dropping the oldest
+// changes beyond maxAnnounceChanges. Caller must hold the write lock.
+func (at *announceTable) record(e AnnounceEntry, removed bool) {
+	at.version++
+	at.appendChange(announceChange{version: at.version, removed: removed, entry: e})
+}
+
+// appendChange appends c to the change log, dropping the oldest changes
+// beyond maxAnnounceChanges. Caller must hold the write lock.
+func (at *announceTable) appendChange(c announceChange) {
+	at.changes = append(at.changes, c)
+	if n := len(at.changes) - maxAnnounceChanges; n > 0 {
+		at.horizon = at.changes[n-1].version
+		at.changes = append(at.changes[:0], at.changes[n:]...)
+	}
+}
+
+// Snapshot returns all announcements and the version they reflect.
+func (at *announceTable) Snapshot() ([]AnnounceEntry, uint64) {
+	at.mu.RLock()
+	defer at.mu.RUnlock()
+
+	var all []AnnounceEntry
+	for _, entries := range at.entries {
+		all = append(all, entries...)
+	}
+	return all, at.version
+}
+
+// Delta returns the changes after version since, netted per announcement
+// and in the order they last changed, or the full table if the change log
+// does not reach back to since.
+func (at *announceTable) Delta(since uint64) AnnounceDelta {
+	return at.delta(since, func(AnnounceEntry) bool { return true })
+}
+
+// delta is Delta over the announcements that pass visible. The removal of
+// one that does not is left out too.
+func (at *announceTable) delta(since uint64, visible func(AnnounceEntry) bool) AnnounceDelta {
+	at.mu.RLock()
+	defer at.mu.RUnlock()
+
+	if since < at.horizon || since > at.version {
+		d := AnnounceDelta{Version: at.version, Full: true, Entries: []AnnounceEntry{}}
+		for _, entries := range at.entries {
+			for _, e := range entries {
+				if visible(e) {
+					d.Entries = append(d.Entries, e)
+				}
+			}
+		}
+		return d
+	}
+
+	start := sort.Search(len(at.changes), func(i int) bool {
+		return at.changes[i].version > since
+	})
+	last := make(map[AnnounceRef]int) // → index of the latest change
+	for i, c := range at.changes[start:] {
+		last[AnnounceRef{c.entry.Relay, c.entry.BroadcastPath}] = start + i
+	}
+
+	d := AnnounceDelta{Version: at.version}
+	for i, c := range at.changes[start:] {
+		ref := AnnounceRef{c.entry.Relay, c.entry.BroadcastPath}
+		if last[ref] != start+i || !visible(c.entry) {
+			continue
+		}
+		if c.removed {
+			d.Removed = append(d.Removed, ref)
+		} else {
+			d.Added = append(d.Added, c.entry)
+		}
+	}
+	return d
+}
@@ -1,9 +1,16 @@
 package sdn
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
 )
 
 // HandlerFunc returns an http.HandlerFunc for announce resource
@@ -14,6 +21,19 @@ import (
 //	PUT    /announce/<relay>/<broadcast_path>  — register
 //	DELETE /announce/<relay>/<broadcast_path>  — deregister
 //
+// The PUT body may carry {"metadata": {...}} describing the content
+// (codecs, bitrate, labels); an empty body registers without metadata.
+//
+// Clients order their requests with a sequence number, "seq" in the PUT
+// body or ?seq= on DELETE, increasing across the relay's requests. A
+// request older than the latest one applied to the same relay and path is
+// answered 409 and ignored, so a delayed PUT cannot resurrect a deleted
+// announcement. Requests without one are applied as they arrive.
+//
+// The PUT body may also carry "announced_at", when the broadcast was
+// announced on the relay, to measure announce propagation. The trace ID of
+// a W3C traceparent header is attached to the measurement as an exemplar.
+//
 // The broadcast_path may contain slashes (e.g. /live/stream1),
 // so the relay name is the first path segment after /announce/.
 func HandlerFunc(table *announceTable) http.HandlerFunc {
@@ -37,7 +57,19 @@ func HandlerFunc(table *announceTable) http.HandlerFunc {
 
 		switch r.Method {
 		case http.MethodPut:
-			table.Register(relayName, broadcastPath)
+			var body struct {
+				Metadata    *AnnounceMetadata `json:"metadata"`
+				Seq         uint64            `json:"seq"`
+				AnnouncedAt time.Time         `json:"announced_at"`
+			}
+			if err := topology.DecodeJSON(w, r, topology.MaxRequestBytes, &body); err != nil && !errors.Is(err, io.EOF) {
+				jsonError(w, topology.DecodeErrorStatus(err), "invalid JSON: "+err.Error())
+				return
+			}
+			if err := table.registerTraced(relayName, broadcastPath, body.Metadata, body.Seq, body.AnnouncedAt, traceIDFromRequest(r)); err != nil {
+				jsonError(w, http.StatusConflict, err.Error())
+				return
+			}
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(map[string]string{
@@ -47,7 +79,19 @@ func HandlerFunc(table *announceTable) http.HandlerFunc {
 			})
 
 		case http.MethodDelete:
-			removed := table.Deregister(relayName, broadcastPath)
+			var seq uint64
+			if v := r.URL.Query().Get("seq"); v != "" {
+				var err error
+				if seq, err = strconv.ParseUint(v, 10, 64); err != nil {
+					jsonError(w, http.StatusBadRequest, "'seq' must be an unsigned integer")
+					return
+				}
+			}
+			removed, err := table.DeregisterOrdered(relayName, broadcastPath, seq)
+			if err != nil {
+				jsonError(w, http.StatusConflict, err.Error())
+				return
+			}
 			if !removed {
 				jsonError(w, http.StatusNotFound, "announce entry not found")
 				return
@@ -68,7 +112,9 @@ func HandlerFunc(table *announceTable) http.HandlerFunc {
 //
 //	GET /announce/lookup?broadcast_path=X
 //
-// Returns all relays that have announced the specified broadcast path.
+// Returns all relays that have announced the specified broadcast path. A
+// private broadcast is returned only to the relays its visibility allows
+// (see IdentifyRelays).
 func LookupHandlerFunc(table *announceTable) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -82,7 +128,7 @@ func LookupHandlerFunc(table *announceTable) http.HandlerFunc {
 			return
 		}
 
-		entries := table.Lookup(bp)
+		entries := filterEntries(table.Lookup(bp), visibleTo(r.Context()))
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -95,7 +141,10 @@ func LookupHandlerFunc(table *announceTable) http.HandlerFunc {
 
 // ListHandlerFunc returns an http.HandlerFunc that lists all announce entries.
 //
-//	GET /announce
+//	GET /announce                  — all entries and the table version
+//	GET /announce?since=<version>  — an AnnounceDelta since an earlier version
+//
+// Both leave out the private broadcasts the requesting relay may not see.
 func ListHandlerFunc(table *announceTable) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -103,9 +152,22 @@ func ListHandlerFunc(table *announceTable) http.HandlerFunc {
 			return
 		}
 
-		all := table.AllEntries()
+		if since := r.URL.Query().Get("since"); since != "" {
+			v, err := strconv.ParseUint(since, 10, 64)
+			if err != nil {
+				jsonError(w, http.StatusBadRequest, "'since' must be a version returned by GET /announce")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(table.delta(v, visibleTo(r.Context())))
+			return
+		}
+
+		all, version := table.Snapshot()
+		all = filterEntries(all, visibleTo(r.Context()))
 		if all == nil {
-			all = []announceEntry{}
+			all = []AnnounceEntry{}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -113,10 +175,83 @@ func ListHandlerFunc(table *announceTable) http.HandlerFunc {
 		json.NewEncoder(w).Encode(map[string]any{
 			"entries": all,
 			"count":   len(all),
+			"version": version,
 		})
 	}
 }
 
+// ExportHandlerFunc returns an http.HandlerFunc that exports the announce
+// table as a content inventory for BI tools.
+//
+//	GET /announce/export?format=csv|json  (default json)
+//
+// CSV columns: relay, broadcast_path, path_prefix, registered_at,
+// expires_at, codecs, bitrate, labels. Codecs and labels are joined by ";".
+// Private broadcasts are filtered as for GET /announce.
+func ExportHandlerFunc(table *announceTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		entries := filterEntries(table.SortedEntries(), visibleTo(r.Context()))
+
+		switch format := r.URL.Query().Get("format"); format {
+		case "", "json":
+			if entries == nil {
+				entries = []AnnounceEntry{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{
+				"entries": entries,
+				"count":   len(entries),
+			})
+
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="announces.csv"`)
+			w.WriteHeader(http.StatusOK)
+
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"relay", "broadcast_path", "path_prefix", "registered_at", "expires_at", "codecs", "bitrate", "labels"})
+			for _, e := range entries {
+				cw.Write(exportRow(e))
+			}
+			cw.Flush()
+
+		default:
+			jsonError(w, http.StatusBadRequest, "unsupported format: "+format)
+		}
+	}
+}
+
+// exportRow formats an announce entry as a CSV record.
+func exportRow(e AnnounceEntry) []string {
+	var expires, codecs, bitrate, labels string
+	if !e.ExpiresAt.IsZero() {
+		expires = e.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if md := e.Metadata; md != nil {
+		codecs = strings.Join(md.Codecs, ";")
+		labels = strings.Join(md.Labels, ";")
+		if md.Bitrate > 0 {
+			bitrate = strconv.FormatInt(md.Bitrate, 10)
+		}
+	}
+	return []string{
+		e.Relay,
+		e.BroadcastPath,
+		pathPrefix(e.BroadcastPath),
+		e.RegisteredAt.UTC().Format(time.RFC3339),
+		expires,
+		codecs,
+		bitrate,
+		labels,
+	}
+}
+
 // jsonError writes a JSON error response.
 func jsonError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
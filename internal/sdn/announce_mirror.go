@@ -0,0 +1,174 @@
+package sdn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// AnnounceSyncHandlerFunc returns an http.HandlerFunc that exports the
+// announce table to read replicas, private broadcasts included:
+//
+//	GET /sync/announce                  — the whole table
+//	GET /sync/announce?since=<version>  — an AnnounceDelta since an earlier version
+//
+// The response is an AnnounceDelta either way. Protect it like the other
+// operator endpoints.
+func AnnounceSyncHandlerFunc(table *announceTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var since uint64
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+				jsonError(w, http.StatusBadRequest, "'since' must be a version returned by GET /sync/announce")
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(table.Delta(since))
+	}
+}
+
+// AnnounceMirror keeps a read replica's announce table a copy of the
+// writer controller's, pulling the changes from its GET /sync/announce.
+// The mirrored table takes the writer's versions, so relays can list the
+// announcements from the writer and any replica with the same cursor. It
+// must not be written to otherwise, nor swept.
+type AnnounceMirror struct {
+	URL      string // writer base URL, e.g. "http://sdn-writer:8090"
+	Token    string // bearer token for the writer's /sync/announce
+	Table    *announceTable
+	Interval time.Duration
+
+	client *http.Client
+	synced bool // whether Table holds a copy to apply deltas to
+}
+
+// NewAnnounceMirror creates a mirror pulling from the writer at url into
+// table every interval.
+func NewAnnounceMirror(url, token string, table *announceTable, interval time.Duration) *AnnounceMirror {
+	return &AnnounceMirror{
+		URL:      url,
+		Token:    token,
+		Table:    table,
+		Interval: interval,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Run pulls immediately and then every Interval until ctx is cancelled.
+func (m *AnnounceMirror) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Sync(ctx); err != nil {
+			slog.Warn("announce mirror sync failed", "writer", RedactURL(m.URL), "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync pulls the writer's changes since the last sync, or its whole table
+// on the first one, and applies them.
+func (m *AnnounceMirror) Sync(ctx context.Context) error {
+	u := m.URL + "/sync/announce"
+	if m.synced {
+		u += "?since=" + strconv.FormatUint(m.Table.currentVersion(), 10)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if m.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.Token)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", RedactURL(u), resp.StatusCode)
+	}
+
+	var d AnnounceDelta
+	if err := topology.DecodeResponse(resp.Body, topology.MaxSyncBytes, &d); err != nil {
+		return fmt.Errorf("decode announce sync: %w", err)
+	}
+	if !m.synced && !d.Full {
+		return fmt.Errorf("GET %s returned a delta for a full sync", RedactURL(u))
+	}
+	m.Table.mirror(d)
+	m.synced = true
+	return nil
+}
+
+// currentVersion returns the version of the table.
+func (at *announceTable) currentVersion() uint64 {
+	at.mu.RLock()
+	defer at.mu.RUnlock()
+	return at.version
+}
+
+// mirror applies a delta of another table, taking its version. Changes
+// are logged under that version, so deltas of this table line up with the
+// other's; a full delta resets the log.
+func (at *announceTable) mirror(d AnnounceDelta) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if d.Full {
+		at.entries = make(map[string][]AnnounceEntry)
+		for _, e := range d.Entries {
+			at.entries[e.BroadcastPath] = append(at.entries[e.BroadcastPath], e)
+		}
+		at.changes = nil
+		at.version, at.horizon = d.Version, d.Version
+		return
+	}
+
+	for _, ref := range d.Removed {
+		entries := at.entries[ref.BroadcastPath]
+		i := slices.IndexFunc(entries, func(e AnnounceEntry) bool { return e.Relay == ref.Relay })
+		if i < 0 {
+			continue
+		}
+		at.appendChange(announceChange{version: d.Version, removed: true, entry: entries[i]})
+		if entries = slices.Delete(entries, i, i+1); len(entries) == 0 {
+			delete(at.entries, ref.BroadcastPath)
+		} else {
+			at.entries[ref.BroadcastPath] = entries
+		}
+	}
+	for _, e := range d.Added {
+		entries := at.entries[e.BroadcastPath]
+		if i := slices.IndexFunc(entries, func(old AnnounceEntry) bool { return old.Relay == e.Relay }); i >= 0 {
+			entries[i] = e
+		} else {
+			at.entries[e.BroadcastPath] = append(entries, e)
+		}
+		at.appendChange(announceChange{version: d.Version, entry: e})
+	}
+	at.version = max(at.version, d.Version)
+}
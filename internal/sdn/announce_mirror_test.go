@@ -0,0 +1,104 @@
+package sdn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnnounceMirror(t *testing.T) {
+	writer := NewAnnounceTable(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		AnnounceSyncHandlerFunc(writer)(w, r)
+	}))
+	defer srv.Close()
+
+	replica := NewAnnounceTable(0)
+	m := NewAnnounceMirror(srv.URL, "secret", replica, 0)
+	ctx := context.Background()
+
+	private := &AnnounceMetadata{Visibility: &Visibility{Relays: []string{"relay-c"}}}
+	writer.Register("relay-a", "/live/s1")
+	writer.RegisterWithMetadata("relay-b", "/live/private", private)
+	if err := m.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, writerVersion := writer.Snapshot()
+	if all, v := replica.Snapshot(); len(all) != 2 || v != writerVersion {
+		t.Fatalf("expected 2 entries at version %d after the full sync, got %d at %d", writerVersion, len(all), v)
+	}
+	cursor := writerVersion
+
+	writer.Deregister("relay-a", "/live/s1")
+	writer.Register("relay-a", "/live/s2")
+	if err := m.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := replica.Lookup("/live/s1"); len(got) != 0 {
+		t.Errorf("expected /live/s1 to be removed, got %+v", got)
+	}
+	if got := replica.Lookup("/live/s2"); len(got) != 1 || got[0].Relay != "relay-a" {
+		t.Errorf("expected /live/s2 from relay-a, got %+v", got)
+	}
+
+	// A cursor from the writer lists the same changes from the replica
+	d := replica.Delta(cursor)
+	if d.Full || len(d.Added) != 1 || len(d.Removed) != 1 || d.Added[0].BroadcastPath != "/live/s2" {
+		t.Errorf("unexpected delta from the replica: %+v", d)
+	}
+	_, writerVersion = writer.Snapshot()
+	if d.Version != writerVersion {
+		t.Errorf("expected the replica at the writer's version %d, got %d", writerVersion, d.Version)
+	}
+
+	// Private broadcasts are mirrored with their visibility
+	if got := replica.Lookup("/live/private"); len(got) != 1 || !got[0].Metadata.Private() {
+		t.Errorf("expected the private broadcast with its visibility, got %+v", got)
+	}
+}
+
+func TestAnnounceMirror_Unauthorized(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	m := NewAnnounceMirror(srv.URL, "wrong", NewAnnounceTable(0), 0)
+	if err := m.Sync(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestAnnounceSyncHandlerFunc(t *testing.T) {
+	table := NewAnnounceTable(0)
+	table.Register("relay-a", "/live/s1")
+	handler := AnnounceSyncHandlerFunc(table)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/sync/announce", nil))
+	var d AnnounceDelta
+	if err := json.NewDecoder(rec.Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Full || len(d.Entries) != 1 {
+		t.Errorf("expected the full table, got %+v", d)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/sync/announce?since=x", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad version, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/sync/announce", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package sdn
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// announceOp is a pending change to the controller's announce table.
+type announceOp int
+
+const (
+	opRegister announceOp = iota
+	opDeregister
+)
+
+func (op announceOp) String() string {
+	if op == opDeregister {
+		return "deregister"
+	}
+	return "register"
+}
+
+// statusError is returned when the controller answers with an error status.
+type statusError struct {
+	Method string
+	URL    string
+	Code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s returned %d", e.Method, e.URL, e.Code)
+}
+
+// retryable reports whether err may succeed on a later attempt: transport
+// failures, 5xx and 429 are; other 4xx are not.
+func retryable(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	return se.Code >= 500 || se.Code == http.StatusTooManyRequests
+}
+
+// enqueue schedules op for broadcastPath. Operations on the same path are
+// sent in order, each retried with backoff until it succeeds; different
+// paths proceed independently.
+func (c *Client) enqueue(broadcastPath string, op announceOp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.queueCtx.Err() != nil {
+		return // stopped; deregisterAll covers what is left
+	}
+
+	q := c.queue[broadcastPath]
+	// The head may be in flight; only collapse repeats behind it.
+	if len(q) > 1 && q[len(q)-1] == op {
+		return
+	}
+	c.queue[broadcastPath] = append(q, op)
+
+	if len(q) == 0 {
+		go c.drain(broadcastPath)
+	}
+}
+
+// drain sends the queued operations of one path until the queue is empty
+// or the client stops.
+func (c *Client) drain(broadcastPath string) {
+	for {
+		c.mu.Lock()
+		q := c.queue[broadcastPath]
+		if len(q) == 0 {
+			c.mu.Unlock()
+			return
+		}
+		op := q[0]
+		c.mu.Unlock()
+
+		if !c.send(broadcastPath, op) {
+			return // client stopped; stopQueue dropped the queue
+		}
+
+		// Pop and, if empty, release the path in one step so enqueue
+		// starts a new drainer only after this one is done.
+		c.mu.Lock()
+		q = c.queue[broadcastPath]
+		if len(q) > 0 {
+			q = q[1:]
+		}
+		if len(q) == 0 {
+			delete(c.queue, broadcastPath)
+			c.mu.Unlock()
+			return
+		}
+		c.queue[broadcastPath] = q
+		c.mu.Unlock()
+	}
+}
+
+// send performs op, retrying with exponential backoff. It returns false if
+// the client stopped first.
+func (c *Client) send(broadcastPath string, op announceOp) bool {
+	backoff := c.config.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		if c.queueCtx.Err() != nil {
+			return false
+		}
+
+		var err error
+		if op == opDeregister {
+			err = c.delete(c.queueCtx, broadcastPath)
+		} else {
+			err = c.put(c.queueCtx, broadcastPath, true)
+		}
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("sdn announce "+op.String()+" succeeded after retry",
+					"broadcast_path", broadcastPath, "attempts", attempt)
+			}
+			return true
+		}
+		if !retryable(err) {
+			slog.Warn("sdn announce "+op.String()+" failed", "error", err,
+				"broadcast_path", broadcastPath)
+			return true
+		}
+
+		level := slog.LevelDebug
+		if attempt == 1 {
+			level = slog.LevelWarn
+		}
+		slog.Log(c.queueCtx, level, "sdn announce "+op.String()+" failed, will retry", "error", err,
+			"broadcast_path", broadcastPath, "attempt", attempt, "backoff", backoff)
+
+		select {
+		case <-c.queueCtx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, c.config.MaxRetryBackoff)
+	}
+}
+
+// stopQueue cancels pending retries and drops queued operations.
+func (c *Client) stopQueue() {
+	c.queueStop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.queue)
+}
+
+// QueuedOperations returns the number of announce registrations and
+// deregistrations waiting to reach the controller.
+func (c *Client) QueuedOperations() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, q := range c.queue {
+		n += len(q)
+	}
+	return n
+}
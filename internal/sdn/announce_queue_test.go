@@ -0,0 +1,164 @@
+package sdn
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or the deadline passes.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newQueueClient(t *testing.T, url string) *Client {
+	t.Helper()
+	c, err := NewClient(ClientConfig{
+		URL:               url,
+		RelayName:         "relay-a",
+		HeartbeatInterval: time.Hour,
+		RetryBackoff:      5 * time.Millisecond,
+		MaxRetryBackoff:   20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.stopQueue)
+	return c
+}
+
+func TestClient_OfflineQueue_RetriesUntilReachable(t *testing.T) {
+	var up atomic.Bool
+	var puts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		puts.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := newQueueClient(t, srv.URL)
+	c.Register("/live/stream1")
+
+	time.Sleep(30 * time.Millisecond)
+	if n := c.QueuedOperations(); n != 1 {
+		t.Fatalf("expected 1 queued operation while offline, got %d", n)
+	}
+
+	up.Store(true)
+	waitFor(t, func() bool { return c.QueuedOperations() == 0 })
+	if n := puts.Load(); n != 1 {
+		t.Errorf("expected 1 successful PUT, got %d", n)
+	}
+}
+
+func TestClient_OfflineQueue_PreservesOrder(t *testing.T) {
+	var up atomic.Bool
+	var mu sync.Mutex
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := newQueueClient(t, srv.URL)
+	c.Register("/live/stream1")
+	c.Deregister("/live/stream1")
+	c.Deregister("/live/stream1") // collapses into the queued deregister
+	c.Register("/live/stream1")
+
+	if n := c.QueuedOperations(); n != 3 {
+		t.Fatalf("expected 3 queued operations, got %d", n)
+	}
+
+	up.Store(true)
+	waitFor(t, func() bool { return c.QueuedOperations() == 0 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{http.MethodPut, http.MethodDelete, http.MethodPut}
+	if len(methods) != len(want) {
+		t.Fatalf("expected %v, got %v", want, methods)
+	}
+	for i := range want {
+		if methods[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, methods)
+		}
+	}
+}
+
+func TestClient_OfflineQueue_DropsPermanentFailures(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c := newQueueClient(t, srv.URL)
+	c.Register("/live/stream1")
+
+	waitFor(t, func() bool { return c.QueuedOperations() == 0 })
+	time.Sleep(30 * time.Millisecond)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected a single attempt for a 400, got %d", n)
+	}
+}
+
+func TestClient_OfflineQueue_StopDropsPending(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := newQueueClient(t, srv.URL)
+	c.Register("/live/stream1")
+	c.stopQueue()
+
+	if n := c.QueuedOperations(); n != 0 {
+		t.Errorf("expected empty queue after stop, got %d", n)
+	}
+	c.Register("/live/stream2")
+	if n := c.QueuedOperations(); n != 0 {
+		t.Errorf("expected no queueing after stop, got %d", n)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("connection refused"), true},
+		{&statusError{Code: http.StatusServiceUnavailable}, true},
+		{&statusError{Code: http.StatusTooManyRequests}, true},
+		{&statusError{Code: http.StatusBadRequest}, false},
+		{&statusError{Code: http.StatusForbidden}, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -2,35 +2,97 @@ package sdn
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
-// announceEntry records which relay announced a specific broadcast path.
-type announceEntry struct {
+// AnnounceEntry records which relay announced a specific broadcast path.
+type AnnounceEntry struct {
 	Relay         string    `json:"relay"`
 	BroadcastPath string    `json:"broadcast_path"`
 	RegisteredAt  time.Time `json:"registered_at"`
 	ExpiresAt     time.Time `json:"expires_at,omitempty"`
+
+	// AnnouncedAt is when the broadcast was announced on the relay, by the
+	// relay's clock; zero if the relay did not say.
+	AnnouncedAt time.Time `json:"announced_at,omitzero"`
+
+	Metadata *AnnounceMetadata `json:"metadata,omitempty"`
+}
+
+// AnnounceMetadata describes the content behind a broadcast path.
+// All fields are optional; relays fill in what their publishers declare.
+type AnnounceMetadata struct {
+	Codecs  []string `json:"codecs,omitempty"`  // e.g. "avc1.64001f", "opus"
+	Bitrate int64    `json:"bitrate,omitempty"` // nominal bitrate in bits/s
+	Labels  []string `json:"labels,omitempty"`  // free-form tags, e.g. "premium"
+
+	Visibility *Visibility `json:"visibility,omitempty"` // nil for a public broadcast
+}
+
+// HasLabel reports whether md carries the given label. A nil md has no labels.
+func (md *AnnounceMetadata) HasLabel(label string) bool {
+	if md == nil {
+		return false
+	}
+	return slices.Contains(md.Labels, label)
 }
 
 // announceTable manages the central registry of which relays hold which broadcast paths.
 // Thread-safe: all access goes through a RWMutex.
 type announceTable struct {
 	mu      sync.RWMutex
-	entries map[string][]announceEntry // broadcastPath → list of relays
+	entries map[string][]AnnounceEntry // broadcastPath → list of relays
 
 	// TTL is how long an entry stays valid after its last registration.
 	// Zero means entries never expire.
 	TTL time.Duration
+
+	// version counts the changes to entries. Re-registrations that only
+	// refresh an entry's timestamps are not changes. changes holds the most
+	// recent ones, which cover every version after horizon.
+	version uint64
+	horizon uint64
+	changes []announceChange
+
+	// seqs holds the sequence number of the latest ordered request applied
+	// to each (relay, path), so a delayed request cannot undo a newer one.
+	// Those of removed entries are kept for announceSeqRetention.
+	seqs map[[2]string]announceSeq
+
+	// lookups counts Lookup calls per broadcast path for Popular.
+	lookups lookupCounter
 }
 
+// announceSeq is the latest sequence number applied to an entry.
+type announceSeq struct {
+	seq uint64
+	at  time.Time
+}
+
+// announceSeqRetention is how long the sequence number of a removed entry
+// is remembered: longer than a delayed request can plausibly take.
+const announceSeqRetention = 10 * time.Minute
+
+// errStaleAnnounce is returned for an ordered request older than one
+// already applied to the same entry.
+var errStaleAnnounce = errors.New("stale announce request")
+
 // NewAnnounceTable creates an empty announce table.
 // If ttl > 0, entries expire that long after their last registration/heartbeat.
 func NewAnnounceTable(ttl time.Duration) *announceTable {
+	version := newAnnounceVersion()
 	return &announceTable{
-		entries: make(map[string][]announceEntry),
+		entries: make(map[string][]AnnounceEntry),
 		TTL:     ttl,
+		version: version,
+		horizon: version,
 	}
 }
 
@@ -54,9 +116,49 @@ func (at *announceTable) StartSweeper(ctx context.Context, interval time.Duratio
 // Register records that a relay holds the given broadcast path.
 // If the same relay re-announces the same path, it updates the timestamp.
 func (at *announceTable) Register(relay, broadcastPath string) {
+	at.RegisterWithMetadata(relay, broadcastPath, nil)
+}
+
+// RegisterWithMetadata is like Register but also stores metadata for the
+// entry, replacing any previously registered metadata.
+func (at *announceTable) RegisterWithMetadata(relay, broadcastPath string, md *AnnounceMetadata) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	at.register(relay, broadcastPath, md, time.Time{}, "")
+}
+
+// RegisterOrdered is like RegisterWithMetadata for a request carrying the
+// relay's sequence number seq. It returns errStaleAnnounce, and changes
+// nothing, if a request with a higher sequence number was already applied
+// to the entry; replays of the same request are applied again. A zero seq
+// is unordered and always applied.
+func (at *announceTable) RegisterOrdered(relay, broadcastPath string, md *AnnounceMetadata, seq uint64) error {
+	return at.RegisterAnnounced(relay, broadcastPath, md, seq, time.Time{})
+}
+
+// RegisterAnnounced is like RegisterOrdered for a broadcast the relay
+// says was announced at announcedAt; zero if it does not say. A new entry
+// observes how long the announcement took to reach the table.
+func (at *announceTable) RegisterAnnounced(relay, broadcastPath string, md *AnnounceMetadata, seq uint64, announcedAt time.Time) error {
+	return at.registerTraced(relay, broadcastPath, md, seq, announcedAt, "")
+}
+
+// registerTraced is like RegisterAnnounced for a request of the trace
+// traceID, which the observed delay carries as an exemplar; "" if none.
+func (at *announceTable) registerTraced(relay, broadcastPath string, md *AnnounceMetadata, seq uint64, announcedAt time.Time, traceID string) error {
 	at.mu.Lock()
 	defer at.mu.Unlock()
 
+	if err := at.order(relay, broadcastPath, seq); err != nil {
+		return err
+	}
+	at.register(relay, broadcastPath, md, announcedAt, traceID)
+	return nil
+}
+
+// register adds or refreshes an entry. Caller must hold the write lock.
+func (at *announceTable) register(relay, broadcastPath string, md *AnnounceMetadata, announcedAt time.Time, traceID string) {
 	now := time.Now()
 	entries := at.entries[broadcastPath]
 
@@ -68,19 +170,35 @@ func (at *announceTable) Register(relay, broadcastPath string) {
 	// Update existing entry for this relay.
 	for i, e := range entries {
 		if e.Relay == relay {
+			changed := !reflect.DeepEqual(e.Metadata, md)
 			entries[i].RegisteredAt = now
 			entries[i].ExpiresAt = expiresAt
+			entries[i].Metadata = md
+			if !announcedAt.IsZero() {
+				entries[i].AnnouncedAt = announcedAt
+			}
+			if changed {
+				at.record(entries[i], false)
+			}
 			return
 		}
 	}
 
 	// New entry.
-	at.entries[broadcastPath] = append(entries, announceEntry{
+	e := AnnounceEntry{
 		Relay:         relay,
 		BroadcastPath: broadcastPath,
 		RegisteredAt:  now,
 		ExpiresAt:     expiresAt,
-	})
+		AnnouncedAt:   announcedAt,
+		Metadata:      md,
+	}
+	at.entries[broadcastPath] = append(entries, e)
+	at.record(e, false)
+
+	if !announcedAt.IsZero() {
+		observeWithTrace(announceRegisterDelay, max(0, now.Sub(announcedAt).Seconds()), traceID)
+	}
 }
 
 // Deregister removes a specific broadcast path announcement from a relay.
@@ -89,10 +207,30 @@ func (at *announceTable) Deregister(relay, broadcastPath string) bool {
 	at.mu.Lock()
 	defer at.mu.Unlock()
 
+	return at.deregister(relay, broadcastPath)
+}
+
+// DeregisterOrdered is like Deregister for a request carrying the relay's
+// sequence number seq; see RegisterOrdered. The sequence number is
+// remembered even if the entry did not exist, so a register sent before
+// it cannot add the entry when delivered after it.
+func (at *announceTable) DeregisterOrdered(relay, broadcastPath string, seq uint64) (bool, error) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if err := at.order(relay, broadcastPath, seq); err != nil {
+		return false, err
+	}
+	return at.deregister(relay, broadcastPath), nil
+}
+
+// deregister removes an entry. Caller must hold the write lock.
+func (at *announceTable) deregister(relay, broadcastPath string) bool {
 	entries := at.entries[broadcastPath]
 
 	for i, e := range entries {
 		if e.Relay == relay {
+			at.record(e, true)
 			at.entries[broadcastPath] = append(entries[:i], entries[i+1:]...)
 			if len(at.entries[broadcastPath]) == 0 {
 				delete(at.entries, broadcastPath)
@@ -103,6 +241,34 @@ func (at *announceTable) Deregister(relay, broadcastPath string) bool {
 	return false
 }
 
+// order checks seq against the latest request applied to the entry and
+// records it. Caller must hold the write lock.
+func (at *announceTable) order(relay, broadcastPath string, seq uint64) error {
+	if seq == 0 {
+		return nil
+	}
+	key := [2]string{relay, broadcastPath}
+	if last, ok := at.seqs[key]; ok && seq < last.seq {
+		return fmt.Errorf("%w: seq %d is older than %d", errStaleAnnounce, seq, last.seq)
+	}
+	if at.seqs == nil {
+		at.seqs = make(map[[2]string]announceSeq)
+	}
+	at.seqs[key] = announceSeq{seq: seq, at: time.Now()}
+	return nil
+}
+
+// has reports whether relay announces broadcastPath, expired or not.
+// Caller must hold the lock.
+func (at *announceTable) has(relay, broadcastPath string) bool {
+	for _, e := range at.entries[broadcastPath] {
+		if e.Relay == relay {
+			return true
+		}
+	}
+	return false
+}
+
 // DeregisterRelay removes all announcements from a specific relay.
 // Used when a relay is deregistered from the topology.
 func (at *announceTable) DeregisterRelay(relay string) int {
@@ -116,6 +282,7 @@ func (at *announceTable) DeregisterRelay(relay string) int {
 			if e.Relay != relay {
 				filtered = append(filtered, e)
 			} else {
+				at.record(e, true)
 				removed++
 			}
 		}
@@ -129,15 +296,28 @@ func (at *announceTable) DeregisterRelay(relay string) int {
 }
 
 // Lookup finds all relays that have announced the given broadcast path.
-// Expired entries are excluded from results.
-func (at *announceTable) Lookup(broadcastPath string) []announceEntry {
+// Expired entries are excluded from results. The lookup is counted towards
+// the path's popularity, whether or not it is announced.
+func (at *announceTable) Lookup(broadcastPath string) []AnnounceEntry {
+	at.lookups.record(broadcastPath, time.Now())
+	entries := at.lookup(broadcastPath)
+	if entries == nil {
+		announceLookups.WithLabelValues("miss").Inc()
+	} else {
+		announceLookups.WithLabelValues("hit").Inc()
+	}
+	return entries
+}
+
+// lookup is Lookup without counting.
+func (at *announceTable) lookup(broadcastPath string) []AnnounceEntry {
 	at.mu.RLock()
 	defer at.mu.RUnlock()
 
 	entries := at.entries[broadcastPath]
 
 	now := time.Now()
-	var result []announceEntry
+	var result []AnnounceEntry
 	for _, e := range entries {
 		if !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt) {
 			continue // expired
@@ -150,21 +330,58 @@ func (at *announceTable) Lookup(broadcastPath string) []announceEntry {
 // LookupResponse is the JSON response for announce lookup queries.
 type LookupResponse struct {
 	BroadcastPath string          `json:"broadcast_path"`
-	Relays        []announceEntry `json:"relays"`
+	Relays        []AnnounceEntry `json:"relays"`
 }
 
 // AllEntries returns all announcements. Used for debugging / admin views.
-func (at *announceTable) AllEntries() []announceEntry {
+func (at *announceTable) AllEntries() []AnnounceEntry {
+	all, _ := at.Snapshot()
+	return all
+}
+
+// RelayEntries returns the announcements of one relay ordered by broadcast
+// path.
+func (at *announceTable) RelayEntries(relay string) []AnnounceEntry {
 	at.mu.RLock()
 	defer at.mu.RUnlock()
 
-	var all []announceEntry
-	for _, entries := range at.entries {
-		all = append(all, entries...)
+	var entries []AnnounceEntry
+	for _, list := range at.entries {
+		for _, e := range list {
+			if e.Relay == relay {
+				entries = append(entries, e)
+			}
+		}
 	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].BroadcastPath < entries[j].BroadcastPath
+	})
+	return entries
+}
+
+// SortedEntries returns all announcements ordered by broadcast path, then
+// relay, for stable exports.
+func (at *announceTable) SortedEntries() []AnnounceEntry {
+	all := at.AllEntries()
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].BroadcastPath != all[j].BroadcastPath {
+			return all[i].BroadcastPath < all[j].BroadcastPath
+		}
+		return all[i].Relay < all[j].Relay
+	})
 	return all
 }
 
+// pathPrefix returns the first segment of a broadcast path with its
+// slashes ("/live/a/b" → "/live/"), used to bound metric cardinality.
+func pathPrefix(broadcastPath string) string {
+	rest := strings.TrimPrefix(broadcastPath, "/")
+	if i := strings.Index(rest, "/"); i >= 0 {
+		return "/" + rest[:i+1]
+	}
+	return "/" + rest
+}
+
 // Count returns the total number of announce entries.
 func (at *announceTable) Count() int {
 	at.mu.RLock()
@@ -177,22 +394,31 @@ func (at *announceTable) Count() int {
 	return count
 }
 
-// Sweep removes all expired entries from the table. Returns the number removed.
+// Sweep removes all expired entries from the table, and forgets the
+// sequence numbers of entries removed more than announceSeqRetention ago.
+// Returns the number of entries removed.
 func (at *announceTable) Sweep() int {
-	if at.TTL <= 0 {
-		return 0
-	}
-
 	at.mu.Lock()
 	defer at.mu.Unlock()
 
 	now := time.Now()
+	for key, last := range at.seqs {
+		if now.Sub(last.at) > announceSeqRetention && !at.has(key[0], key[1]) {
+			delete(at.seqs, key)
+		}
+	}
+
+	if at.TTL <= 0 {
+		return 0
+	}
+
 	removed := 0
 
 	for bp, entries := range at.entries {
 		filtered := entries[:0]
 		for _, e := range entries {
 			if !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt) {
+				at.record(e, true)
 				removed++
 			} else {
 				filtered = append(filtered, e)
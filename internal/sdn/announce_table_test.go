@@ -1,8 +1,18 @@
 package sdn
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestAnnounceTable_Register(t *testing.T) {
@@ -232,3 +242,403 @@ func TestAnnounceTable_NoTTL_ExpiresAtZero(t *testing.T) {
 		t.Error("expected zero ExpiresAt with no TTL")
 	}
 }
+
+func TestAnnounceTable_RegisterWithMetadata(t *testing.T) {
+	at := NewAnnounceTable(0)
+
+	md := &AnnounceMetadata{Codecs: []string{"opus"}, Bitrate: 128000, Labels: []string{"premium"}}
+	at.RegisterWithMetadata("relay-a", "/live/stream1", md)
+
+	entries := at.Lookup("/live/stream1")
+	if len(entries) != 1 || entries[0].Metadata != md {
+		t.Fatalf("expected entry with metadata, got %+v", entries)
+	}
+	if !entries[0].Metadata.HasLabel("premium") {
+		t.Error("expected premium label")
+	}
+
+	// Re-registering replaces the metadata.
+	at.Register("relay-a", "/live/stream1")
+	if entries := at.Lookup("/live/stream1"); entries[0].Metadata != nil {
+		t.Errorf("expected metadata to be cleared, got %+v", entries[0].Metadata)
+	}
+
+	var nilMD *AnnounceMetadata
+	if nilMD.HasLabel("premium") {
+		t.Error("nil metadata should have no labels")
+	}
+}
+
+func TestPathPrefix(t *testing.T) {
+	tests := map[string]string{
+		"/live/stream1": "/live/",
+		"/live/a/b":     "/live/",
+		"/single":       "/single",
+		"vod/movie":     "/vod/",
+		"/":             "/",
+	}
+	for in, want := range tests {
+		if got := pathPrefix(in); got != want {
+			t.Errorf("pathPrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestExportHandlerFunc_CSV(t *testing.T) {
+	table := NewAnnounceTable(0)
+	table.RegisterWithMetadata("relay-b", "/live/s1", &AnnounceMetadata{
+		Codecs:  []string{"avc1", "opus"},
+		Bitrate: 3000000,
+		Labels:  []string{"premium"},
+	})
+	table.Register("relay-a", "/live/s1")
+
+	rec := httptest.NewRecorder()
+	ExportHandlerFunc(table)(rec, httptest.NewRequest(http.MethodGet, "/announce/export?format=csv", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("expected text/csv, got %q", ct)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header + 2 rows, got %d", len(records))
+	}
+	if records[0][0] != "relay" || records[0][7] != "labels" {
+		t.Errorf("unexpected header: %v", records[0])
+	}
+	if records[1][0] != "relay-a" || records[1][5] != "" {
+		t.Errorf("expected relay-a without metadata first, got %v", records[1])
+	}
+	want := []string{"relay-b", "/live/s1", "/live/", records[2][3], "", "avc1;opus", "3000000", "premium"}
+	for i := range want {
+		if records[2][i] != want[i] {
+			t.Errorf("column %d: got %q, want %q", i, records[2][i], want[i])
+		}
+	}
+}
+
+func TestExportHandlerFunc_Formats(t *testing.T) {
+	table := NewAnnounceTable(0)
+	handler := ExportHandlerFunc(table)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/announce/export", nil))
+	var body struct {
+		Entries []AnnounceEntry `json:"entries"`
+		Count   int             `json:"count"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Entries == nil || body.Count != 0 {
+		t.Errorf("expected empty JSON inventory, got %+v", body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/announce/export?format=xml", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unsupported format, got %d", rec.Code)
+	}
+}
+
+func TestAnnounceCollector(t *testing.T) {
+	table := NewAnnounceTable(0)
+	table.Register("relay-a", "/live/s1")
+	table.Register("relay-a", "/live/s2")
+	table.Register("relay-b", "/vod/m1")
+
+	reg := prometheus.NewRegistry()
+	if err := RegisterMetrics(reg, table, &topology.Topology{}); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, f := range families {
+		if f.GetName() != "qumo_sdn_announce_entries" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			got[labels["relay"]+" "+labels["path_prefix"]] = m.GetGauge().GetValue()
+		}
+	}
+	if got["relay-a /live/"] != 2 || got["relay-b /vod/"] != 1 || len(got) != 2 {
+		t.Errorf("unexpected announce metrics: %v", got)
+	}
+}
+
+func TestAnnounceTable_Delta(t *testing.T) {
+	table := NewAnnounceTable(0)
+	table.Register("relay-a", "/live/s1")
+	_, v0 := table.Snapshot()
+
+	table.Register("relay-b", "/live/s1")
+	table.Register("relay-a", "/live/s1") // refresh only: not a change
+	table.Register("relay-a", "/live/s2")
+	table.Deregister("relay-a", "/live/s2") // added and removed: removed
+	table.Deregister("relay-a", "/live/s1")
+	table.RegisterWithMetadata("relay-b", "/live/s1", &AnnounceMetadata{Bitrate: 1000})
+
+	d := table.Delta(v0)
+	if d.Full || d.Version != v0+5 {
+		t.Fatalf("expected a delta at version %d, got %+v", v0+5, d)
+	}
+	if len(d.Added) != 1 || d.Added[0].Relay != "relay-b" || d.Added[0].Metadata == nil {
+		t.Errorf("unexpected added entries: %+v", d.Added)
+	}
+	want := []AnnounceRef{{"relay-a", "/live/s2"}, {"relay-a", "/live/s1"}}
+	if len(d.Removed) != 2 || d.Removed[0] != want[0] || d.Removed[1] != want[1] {
+		t.Errorf("expected removed %v, got %v", want, d.Removed)
+	}
+
+	if d := table.Delta(d.Version); d.Full || len(d.Added)+len(d.Removed) != 0 {
+		t.Errorf("expected an empty delta at the current version, got %+v", d)
+	}
+
+	// Cursors from another table instance (a restart) get the full list
+	for _, since := range []uint64{0, v0 - 2, d.Version + 1} {
+		if d := table.Delta(since); !d.Full || len(d.Entries) != 1 {
+			t.Errorf("since %d: expected the full list, got %+v", since, d)
+		}
+	}
+}
+
+func TestAnnounceTable_DeltaHorizon(t *testing.T) {
+	table := NewAnnounceTable(0)
+	_, v0 := table.Snapshot()
+	for i := 0; i <= maxAnnounceChanges; i++ {
+		table.Register("relay-a", "/live/"+strconv.Itoa(i))
+	}
+
+	if d := table.Delta(v0); !d.Full || len(d.Entries) != maxAnnounceChanges+1 {
+		t.Errorf("expected the full list past the change log, got %d entries (full %v)", len(d.Entries), d.Full)
+	}
+	if d := table.Delta(v0 + 1); d.Full || len(d.Added) != maxAnnounceChanges {
+		t.Errorf("expected a delta of %d entries, got %d (full %v)", maxAnnounceChanges, len(d.Added), d.Full)
+	}
+}
+
+func TestListHandlerFunc_Since(t *testing.T) {
+	table := NewAnnounceTable(0)
+	table.Register("relay-a", "/live/s1")
+	handler := ListHandlerFunc(table)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/announce", nil))
+	var list struct {
+		Entries []AnnounceEntry `json:"entries"`
+		Version uint64          `json:"version"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Entries) != 1 || list.Version == 0 {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	table.Register("relay-b", "/live/s1")
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/announce?since="+strconv.FormatUint(list.Version, 10), nil))
+	var d AnnounceDelta
+	if err := json.NewDecoder(rec.Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Full || len(d.Added) != 1 || d.Added[0].Relay != "relay-b" || d.Version != list.Version+1 {
+		t.Errorf("unexpected delta: %+v", d)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/announce?since=abc", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid version, got %d", rec.Code)
+	}
+}
+
+func TestAnnounceTable_Ordered(t *testing.T) {
+	at := NewAnnounceTable(0)
+
+	if err := at.RegisterOrdered("relay-a", "/live/x", nil, 10); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := at.DeregisterOrdered("relay-a", "/live/x", 12); err != nil || !removed {
+		t.Fatalf("DeregisterOrdered = %v, %v; want true, nil", removed, err)
+	}
+
+	// The heartbeat PUT sent between them arrives late.
+	if err := at.RegisterOrdered("relay-a", "/live/x", nil, 11); !errors.Is(err, errStaleAnnounce) {
+		t.Fatalf("expected errStaleAnnounce, got %v", err)
+	}
+	if n := len(at.Lookup("/live/x")); n != 0 {
+		t.Fatalf("stale PUT resurrected the announcement: %d entries", n)
+	}
+
+	// A replay and a newer register are applied, as are unordered ones.
+	if _, err := at.DeregisterOrdered("relay-a", "/live/x", 12); err != nil {
+		t.Errorf("replay: %v", err)
+	}
+	if err := at.RegisterOrdered("relay-a", "/live/x", nil, 13); err != nil {
+		t.Fatal(err)
+	}
+	if err := at.RegisterOrdered("relay-a", "/live/x", nil, 0); err != nil {
+		t.Errorf("unordered: %v", err)
+	}
+	if n := len(at.Lookup("/live/x")); n != 1 {
+		t.Fatalf("expected 1 entry, got %d", n)
+	}
+
+	// Other relays are ordered independently.
+	if err := at.RegisterOrdered("relay-b", "/live/x", nil, 1); err != nil {
+		t.Errorf("relay-b: %v", err)
+	}
+}
+
+func TestAnnounceTable_SweepForgetsSeqs(t *testing.T) {
+	at := NewAnnounceTable(0)
+	at.RegisterOrdered("relay-a", "/live/x", nil, 5)
+	at.RegisterOrdered("relay-a", "/live/y", nil, 5)
+	at.DeregisterOrdered("relay-a", "/live/x", 6)
+
+	old := time.Now().Add(-announceSeqRetention - time.Minute)
+	for key, last := range at.seqs {
+		at.seqs[key] = announceSeq{seq: last.seq, at: old}
+	}
+	at.Sweep()
+
+	if _, ok := at.seqs[[2]string{"relay-a", "/live/x"}]; ok {
+		t.Error("expected the removed entry's seq to be forgotten")
+	}
+	if _, ok := at.seqs[[2]string{"relay-a", "/live/y"}]; !ok {
+		t.Error("expected the live entry's seq to be kept")
+	}
+}
+
+func TestHandlerFunc_Ordered(t *testing.T) {
+	at := NewAnnounceTable(0)
+	handler := HandlerFunc(at)
+	serve := func(method, target, body string) int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := serve(http.MethodPut, "/announce/relay-a/live/x", `{"seq":1}`); code != http.StatusOK {
+		t.Fatalf("PUT: expected 200, got %d", code)
+	}
+	if code := serve(http.MethodDelete, "/announce/relay-a/live/x?seq=3", ""); code != http.StatusOK {
+		t.Fatalf("DELETE: expected 200, got %d", code)
+	}
+	if code := serve(http.MethodPut, "/announce/relay-a/live/x", `{"seq":2}`); code != http.StatusConflict {
+		t.Errorf("stale PUT: expected 409, got %d", code)
+	}
+	if code := serve(http.MethodDelete, "/announce/relay-a/live/x?seq=x", ""); code != http.StatusBadRequest {
+		t.Errorf("bad seq: expected 400, got %d", code)
+	}
+	if at.Count() != 0 {
+		t.Errorf("expected empty table, got %d entries", at.Count())
+	}
+}
+
+// histogramCount returns the number of observations of h.
+func histogramCount(t *testing.T, h prometheus.Histogram) uint64 {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(h)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return families[0].GetMetric()[0].GetHistogram().GetSampleCount()
+}
+
+func TestAnnounceTable_RegisterAnnounced(t *testing.T) {
+	table := NewAnnounceTable(0)
+	announcedAt := time.Now().Add(-50 * time.Millisecond)
+	before := histogramCount(t, announceRegisterDelay)
+
+	if err := table.RegisterAnnounced("relay-a", "/live/s1", nil, 1, announcedAt); err != nil {
+		t.Fatal(err)
+	}
+	if n := histogramCount(t, announceRegisterDelay) - before; n != 1 {
+		t.Errorf("expected the new entry to be observed once, got %d", n)
+	}
+
+	// A heartbeat without the announce time keeps it and is not observed
+	if err := table.RegisterAnnounced("relay-a", "/live/s1", nil, 2, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	entries := table.Lookup("/live/s1")
+	if len(entries) != 1 || !entries[0].AnnouncedAt.Equal(announcedAt) {
+		t.Errorf("expected announced_at %v, got %+v", announcedAt, entries)
+	}
+	if n := histogramCount(t, announceRegisterDelay) - before; n != 1 {
+		t.Errorf("expected a refresh not to be observed, got %d observations", n)
+	}
+
+	// Entries registered without an announce time are not observed
+	table.Register("relay-b", "/live/s1")
+	if n := histogramCount(t, announceRegisterDelay) - before; n != 1 {
+		t.Errorf("expected an entry without announced_at not to be observed, got %d observations", n)
+	}
+}
+
+func TestTraceIDFromRequest(t *testing.T) {
+	for header, want := range map[string]string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"":                                "",
+		"00-4bf92f35-00f067aa0ba902b7-01": "",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": "",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01": "",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01": "",
+	} {
+		r := httptest.NewRequest(http.MethodPut, "/announce/relay-a/live", nil)
+		if header != "" {
+			r.Header.Set("traceparent", header)
+		}
+		if got := traceIDFromRequest(r); got != want {
+			t.Errorf("traceparent %q: expected %q, got %q", header, want, got)
+		}
+	}
+}
+
+func TestHandler_TraceExemplar(t *testing.T) {
+	table := NewAnnounceTable(0)
+	handler := HandlerFunc(table)
+
+	body := `{"announced_at":"` + time.Now().Add(-20*time.Millisecond).Format(time.RFC3339Nano) + `"}`
+	req := httptest.NewRequest(http.MethodPut, "/announce/relay-a/live/traced", strings.NewReader(body))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(announceRegisterDelay)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range families[0].GetMetric()[0].GetHistogram().GetBucket() {
+		for _, l := range b.GetExemplar().GetLabel() {
+			if l.GetName() == "trace_id" && l.GetValue() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+				return
+			}
+		}
+	}
+	t.Error("expected the register delay to carry the trace ID as an exemplar")
+}
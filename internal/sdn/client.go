@@ -1,24 +1,27 @@
 // Package sdn provides a client for registering announcements
 // with the SDN controller. When a relay receives a moqt.Announcement,
 // it pushes the BroadcastPath to the central SDN announce table so that
-// other relays can discover which relay holds which content.
+// other relays can discover which relay holds which content. The same
+// client keeps the relay registered in the SDN topology.
 package sdn
 
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/okdaichi/qumo/internal/topology"
+	"github.com/okdaichi/qumo/internal/version"
 )
 
 // ClientConfig holds the settings for the SDN announce client.
@@ -30,14 +33,26 @@ type ClientConfig struct {
 	// RelayName identifies this relay in the announce table.
 	RelayName string
 
+	// Name identifies the controller in logs, metrics and health reports
+	// of a Group. Default: the host of URL.
+	Name string
+
 	// HeartbeatInterval is how often the relay re-PUTs its announces
 	// to keep them alive. Default: 30s.
 	HeartbeatInterval time.Duration
 
+	// TopologyInterval is how often the relay re-registers its topology
+	// info (see RegisterRelay). Default: HeartbeatInterval.
+	TopologyInterval time.Duration
+
 	// Region is the geographic region of this relay (e.g. "ap-northeast-1").
 	// Sent in topology heartbeats.
 	Region string
 
+	// Zone is the failure domain of this relay (e.g. "ap-northeast-1a").
+	// Sent in topology heartbeats for zone-diverse routing.
+	Zone string
+
 	// Address is the MoQT endpoint URL of this relay (e.g. "https://host:4433").
 	// Sent in topology heartbeats so the SDN can populate NextHopAddress.
 	Address string
@@ -46,12 +61,49 @@ type ClientConfig struct {
 	// Sent in topology heartbeats so the SDN keeps the graph alive.
 	Neighbors map[string]float64
 
+	// NeighborsFunc, if set, returns the neighbors and their current costs
+	// for every topology heartbeat instead of Neighbors, so edge costs can
+	// follow live measurements.
+	NeighborsFunc func() map[string]float64
+
+	// Symmetric asks the controller to add reverse edges (neighbor → this
+	// relay) with the same cost, so one-sided configuration still routes.
+	Symmetric bool
+
+	// Location is the optional geographic position of this relay.
+	// Sent in topology heartbeats and used by publisher placement.
+	Location *topology.Location
+
 	// TLS configures mutual TLS for relay→SDN communication.
 	// If nil, plain HTTP is used (suitable for internal networks).
 	TLS *TLSConfig
+
+	// Token, if set, is sent as a bearer token on every request so the
+	// controller can identify this relay and return the private broadcasts
+	// it may see. See IdentifyRelays.
+	Token string
+
+	// StatsFunc returns the relay's current metric summary. If set, the
+	// summary is pushed to POST /stats/relay/<name> on every heartbeat.
+	// EgressMbps is computed by the client from successive EgressBytes.
+	StatsFunc func() RelayStats
+
+	// RetryBackoff is the delay before the first retry of a failed announce
+	// register or deregister; it doubles up to MaxRetryBackoff.
+	// Defaults: 500ms and 30s.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	// WaitForRegistration asks the relay to hold its readiness until the
+	// first registration with this controller succeeded; see
+	// Group.Bootstrapping.
+	WaitForRegistration bool
 }
 
 // TLSConfig holds mTLS settings for relay→SDN communication.
+// CertFile, KeyFile and CAFile may each hold PEM data directly instead of a
+// path, so keys can be injected from secret stores without touching the
+// filesystem.
 type TLSConfig struct {
 	CertFile string
 	KeyFile  string
@@ -65,9 +117,102 @@ type Client struct {
 	client *http.Client
 
 	mu      sync.Mutex
-	entries map[string]struct{} // broadcastPath set
+	entries map[string]*AnnounceMetadata // broadcastPath → metadata (may be nil)
 	cancel  context.CancelFunc
 	done    chan struct{}
+
+	// announcedAt holds when each path was last registered, sent with its
+	// registration so the controller and other relays can measure how long
+	// announcements take to propagate. Protected by mu.
+	announcedAt map[string]time.Time
+
+	// seq numbers announce requests so the controller applies them in
+	// order; it starts at the clock so a restarted relay continues above
+	// its previous run. Protected by mu.
+	seq uint64
+
+	// offline queue: pending announce operations per path, in order
+	queue     map[string][]announceOp
+	queueCtx  context.Context
+	queueStop context.CancelFunc
+
+	// last stats sample, used to derive EgressMbps
+	lastEgressBytes uint64
+	lastStatsAt     time.Time
+
+	// result of the deregistration performed when Run stops
+	deregisterResult DeregisterResult
+
+	// set by Detach: Run leaves the registrations in place when it stops
+	detached atomic.Bool
+
+	// announce table mirrored by ListAll and kept current with deltas
+	listMu      sync.Mutex
+	listVersion uint64                     // zero until the controller reports one
+	listEntries map[string][]AnnounceEntry // broadcastPath → entries, in controller order
+
+	// last route answer per target relay, revalidated with its ETag
+	routeMu sync.Mutex
+	routes  map[string]cachedRoute
+
+	// outcome of the last registration, and the registrations failed
+	// since the last success. Protected by mu.
+	registeredAt time.Time
+	registerErr  error
+	failures     int
+
+	// closed on the first successful registration
+	bootstrapped chan struct{}
+}
+
+// unreachableAfter is how many registrations must fail in a row before a
+// relay that was never registered reports the controller unreachable.
+const unreachableAfter = 3
+
+// ConnectionState is how a relay's registration with a controller stands.
+type ConnectionState string
+
+const (
+	// StateConnecting: the relay has not registered yet and is retrying.
+	StateConnecting ConnectionState = "connecting"
+	// StateRegistered: the last registration succeeded.
+	StateRegistered ConnectionState = "registered"
+	// StateUnreachable: registrations fail, after the relay had been
+	// registered or unreachableAfter times in a row.
+	StateUnreachable ConnectionState = "unreachable"
+)
+
+// RegistrationState reports how the relay's registration with the
+// controller stands.
+type RegistrationState struct {
+	Relay string `json:"relay"`
+	URL   string `json:"url"`
+
+	// Topology is false for relays without neighbors, which register
+	// their announces only. They check that the controller is reachable
+	// with GET /health instead, which then counts as registering.
+	Topology       bool            `json:"topology"`
+	State          ConnectionState `json:"state"`
+	Registered     bool            `json:"registered"`
+	LastRegistered time.Time       `json:"last_registered,omitzero"`
+	LastError      string          `json:"last_error,omitempty"`
+
+	Announces        int `json:"announces"`
+	QueuedOperations int `json:"queued_operations"`
+}
+
+// cachedRoute is a route answer and the ETag the controller sent with it.
+type cachedRoute struct {
+	etag   string
+	result topology.RouteResult
+}
+
+// DeregisterResult reports the announce deregistrations performed when the
+// client stopped.
+type DeregisterResult struct {
+	Deregistered int      `json:"deregistered"`
+	Failed       int      `json:"failed"`
+	Errors       []string `json:"errors,omitempty"`
 }
 
 // NewClient creates a new SDN announce client. Call Run to start the
@@ -79,9 +224,23 @@ func NewClient(cfg ClientConfig) (*Client, error) {
 	if cfg.RelayName == "" {
 		return nil, fmt.Errorf("sdn client: RelayName is required")
 	}
+	if cfg.Name == "" {
+		if u, err := url.Parse(cfg.URL); err == nil {
+			cfg.Name = u.Host
+		}
+	}
 	if cfg.HeartbeatInterval <= 0 {
 		cfg.HeartbeatInterval = 30 * time.Second
 	}
+	if cfg.TopologyInterval <= 0 {
+		cfg.TopologyInterval = cfg.HeartbeatInterval
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxRetryBackoff < cfg.RetryBackoff {
+		cfg.MaxRetryBackoff = max(30*time.Second, cfg.RetryBackoff)
+	}
 
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 
@@ -93,72 +252,72 @@ func NewClient(cfg ClientConfig) (*Client, error) {
 		transport.TLSClientConfig = tlsCfg
 	}
 
+	var rt http.RoundTripper = transport
+	if cfg.Token != "" {
+		rt = bearerTransport{token: cfg.Token, next: transport}
+	}
+
+	queueCtx, queueStop := context.WithCancel(context.Background())
+
 	return &Client{
-		config:  cfg,
-		client:  &http.Client{Transport: transport, Timeout: 10 * time.Second},
-		entries: make(map[string]struct{}),
-		done:    make(chan struct{}),
+		config:      cfg,
+		client:      &http.Client{Transport: rt, Timeout: 10 * time.Second},
+		entries:     make(map[string]*AnnounceMetadata),
+		announcedAt: make(map[string]time.Time),
+		seq:         uint64(time.Now().UnixNano()),
+		done:        make(chan struct{}),
+		queue:       make(map[string][]announceOp),
+		queueCtx:    queueCtx,
+		queueStop:   queueStop,
+
+		bootstrapped: make(chan struct{}),
 	}, nil
 }
 
-func buildTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
-	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
-	if err != nil {
-		return nil, fmt.Errorf("load client cert: %w", err)
-	}
-
-	tlsCfg := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-	}
-
-	if cfg.CAFile != "" {
-		caCert, err := os.ReadFile(cfg.CAFile)
-		if err != nil {
-			return nil, fmt.Errorf("read CA cert: %w", err)
-		}
-		pool := x509.NewCertPool()
-		if !pool.AppendCertsFromPEM(caCert) {
-			return nil, fmt.Errorf("failed to parse CA certificate")
-		}
-		tlsCfg.RootCAs = pool
-	}
+// bearerTransport adds a bearer token to every request.
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
 
-	return tlsCfg, nil
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(req)
 }
 
 // Register adds a broadcast path and immediately pushes it to the SDN
-// controller. Safe for concurrent use.
+// controller. If the controller is unreachable the push is queued and
+// retried with backoff. Safe for concurrent use.
 func (c *Client) Register(broadcastPath string) {
+	c.RegisterWithMetadata(broadcastPath, nil)
+}
+
+// RegisterWithMetadata is like Register but attaches content metadata,
+// which is re-sent with every heartbeat. Safe for concurrent use.
+func (c *Client) RegisterWithMetadata(broadcastPath string, md *AnnounceMetadata) {
 	c.mu.Lock()
-	c.entries[broadcastPath] = struct{}{}
+	c.entries[broadcastPath] = md
+	c.announcedAt[broadcastPath] = time.Now()
 	c.mu.Unlock()
 
-	// Fire-and-forget PUT; errors are logged, not propagated.
-	go func() {
-		if err := c.put(context.Background(), broadcastPath); err != nil {
-			slog.Warn("sdn announce register failed", "error", err,
-				"broadcast_path", broadcastPath)
-		}
-	}()
+	c.enqueue(broadcastPath, opRegister)
 }
 
 // Deregister removes a broadcast path and DELETEs it from the SDN
-// controller. Safe for concurrent use.
+// controller, after any queued operations on the same path. Safe for
+// concurrent use.
 func (c *Client) Deregister(broadcastPath string) {
 	c.mu.Lock()
 	delete(c.entries, broadcastPath)
+	delete(c.announcedAt, broadcastPath)
 	c.mu.Unlock()
 
-	go func() {
-		if err := c.delete(context.Background(), broadcastPath); err != nil {
-			slog.Warn("sdn announce deregister failed", "error", err,
-				"broadcast_path", broadcastPath)
-		}
-	}()
+	c.enqueue(broadcastPath, opDeregister)
 }
 
 // Lookup queries the SDN controller for relays holding the given broadcast path.
-func (c *Client) Lookup(ctx context.Context, broadcastPath string) ([]announceEntry, error) {
+func (c *Client) Lookup(ctx context.Context, broadcastPath string) ([]AnnounceEntry, error) {
 	url := fmt.Sprintf("%s/announce/lookup?broadcast_path=%s", c.config.URL, broadcastPath)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -172,11 +331,11 @@ func (c *Client) Lookup(ctx context.Context, broadcastPath string) ([]announceEn
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("lookup %s returned %d", url, resp.StatusCode)
+		return nil, fmt.Errorf("lookup %s returned %d", RedactURL(url), resp.StatusCode)
 	}
 
 	var result LookupResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := topology.DecodeResponse(resp.Body, topology.MaxSyncBytes, &result); err != nil {
 		return nil, fmt.Errorf("decode lookup response: %w", err)
 	}
 	return result.Relays, nil
@@ -184,6 +343,9 @@ func (c *Client) Lookup(ctx context.Context, broadcastPath string) ([]announceEn
 
 // Route queries the SDN controller for the shortest path from this relay to the target relay.
 // Returns the RouteResult which includes NextHop and NextHopAddress.
+// The last answer for each target is kept and revalidated with
+// If-None-Match, so the controller sends no body while the topology is
+// unchanged.
 func (c *Client) Route(ctx context.Context, to string) (topology.RouteResult, error) {
 	u := fmt.Sprintf("%s/route?from=%s&to=%s",
 		c.config.URL,
@@ -195,28 +357,175 @@ func (c *Client) Route(ctx context.Context, to string) (topology.RouteResult, er
 		return topology.RouteResult{}, err
 	}
 
+	c.routeMu.Lock()
+	cached, ok := c.routes[to]
+	c.routeMu.Unlock()
+	if ok {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return topology.RouteResult{}, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && ok {
+		return cached.result, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		return topology.RouteResult{}, fmt.Errorf("route %s returned %d", u, resp.StatusCode)
+		return topology.RouteResult{}, fmt.Errorf("route %s returned %d", RedactURL(u), resp.StatusCode)
 	}
 
 	var result topology.RouteResult
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return topology.RouteResult{}, fmt.Errorf("decode route response: %w", err)
 	}
+
+	c.routeMu.Lock()
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		if c.routes == nil {
+			c.routes = make(map[string]cachedRoute)
+		}
+		c.routes[to] = cachedRoute{etag: etag, result: result}
+	} else {
+		delete(c.routes, to)
+	}
+	c.routeMu.Unlock()
 	return result, nil
 }
 
+// ProbeTasks fetches the probes this relay should run now from
+// GET /probes/<name>.
+func (c *Client) ProbeTasks(ctx context.Context) ([]ProbeTask, error) {
+	u := fmt.Sprintf("%s/probes/%s", c.config.URL, url.PathEscape(c.config.RelayName))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("probe tasks %s returned %d", RedactURL(u), resp.StatusCode)
+	}
+
+	var body struct {
+		Tasks []ProbeTask `json:"tasks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode probe tasks: %w", err)
+	}
+	return body.Tasks, nil
+}
+
+// PrefetchTasks fetches the broadcasts the controller's replication policy
+// wants this relay to prefetch from GET /replication/<name>. The returned
+// window is non-nil while the relay is cordoned for maintenance.
+func (c *Client) PrefetchTasks(ctx context.Context) ([]PrefetchTask, *topology.MaintenanceWindow, error) {
+	u := fmt.Sprintf("%s/replication/%s", c.config.URL, url.PathEscape(c.config.RelayName))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("prefetch tasks %s returned %d", RedactURL(u), resp.StatusCode)
+	}
+
+	var body struct {
+		Tasks       []PrefetchTask              `json:"tasks"`
+		Maintenance *topology.MaintenanceWindow `json:"maintenance"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, nil, fmt.Errorf("decode prefetch tasks: %w", err)
+	}
+	return body.Tasks, body.Maintenance, nil
+}
+
+// ReportProbe sends a probe result to POST /probes/results.
+func (c *Client) ReportProbe(ctx context.Context, res ProbeResult) error {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	u := fmt.Sprintf("%s/probes/results", c.config.URL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("POST %s returned %d", RedactURL(u), resp.StatusCode)
+	}
+	return nil
+}
+
+// Ping checks that the controller is reachable and healthy with
+// GET /health.
+func (c *Client) Ping(ctx context.Context) error {
+	u := c.config.URL + "/health"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health %s returned %d", RedactURL(u), resp.StatusCode)
+	}
+	return nil
+}
+
+// RelayName returns the name this client registers under.
+func (c *Client) RelayName() string {
+	return c.config.RelayName
+}
+
+// ControllerName returns the name of the controller the client talks to;
+// see ClientConfig.Name.
+func (c *Client) ControllerName() string {
+	return c.config.Name
+}
+
 // ListAll queries the SDN controller for all current announcements.
 // Returns entries grouped by broadcast path. Only entries from other relays
 // (excluding this client's own relay) are included.
-func (c *Client) ListAll(ctx context.Context) ([]announceEntry, error) {
+//
+// The client mirrors the announce table: after the first call it only asks
+// for the changes since the version it has, and falls back to the full list
+// when the controller says so or does not support versions.
+func (c *Client) ListAll(ctx context.Context) ([]AnnounceEntry, error) {
+	c.listMu.Lock()
+	defer c.listMu.Unlock()
+
 	u := fmt.Sprintf("%s/announce", c.config.URL)
+	if c.listVersion != 0 {
+		u += "?since=" + strconv.FormatUint(c.listVersion, 10)
+	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return nil, err
@@ -229,50 +538,94 @@ func (c *Client) ListAll(ctx context.Context) ([]announceEntry, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("list all %s returned %d", u, resp.StatusCode)
+		c.listVersion = 0
+		return nil, fmt.Errorf("list all %s returned %d", RedactURL(u), resp.StatusCode)
 	}
 
-	var result struct {
-		Entries []announceEntry `json:"entries"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	var d AnnounceDelta
+	if err := topology.DecodeResponse(resp.Body, topology.MaxSyncBytes, &d); err != nil {
+		c.listVersion = 0
 		return nil, fmt.Errorf("decode list response: %w", err)
 	}
+	if c.listVersion == 0 || d.Full || d.Version == 0 {
+		c.listEntries = make(map[string][]AnnounceEntry)
+		for _, e := range d.Entries {
+			c.listEntries[e.BroadcastPath] = append(c.listEntries[e.BroadcastPath], e)
+		}
+	} else {
+		c.applyDelta(d)
+	}
+	c.listVersion = d.Version
 
 	// Filter out our own entries
-	filtered := make([]announceEntry, 0, len(result.Entries))
-	for _, e := range result.Entries {
-		if e.Relay != c.config.RelayName {
-			filtered = append(filtered, e)
+	var filtered []AnnounceEntry
+	for _, entries := range c.listEntries {
+		for _, e := range entries {
+			if e.Relay != c.config.RelayName {
+				filtered = append(filtered, e)
+			}
 		}
 	}
 	return filtered, nil
 }
 
+// applyDelta updates the mirrored announce table, observing the discovery
+// latency of the announcements new to it. Caller must hold listMu.
+func (c *Client) applyDelta(d AnnounceDelta) {
+	for _, ref := range d.Removed {
+		entries := slices.DeleteFunc(c.listEntries[ref.BroadcastPath], func(e AnnounceEntry) bool {
+			return e.Relay == ref.Relay
+		})
+		if len(entries) == 0 {
+			delete(c.listEntries, ref.BroadcastPath)
+		} else {
+			c.listEntries[ref.BroadcastPath] = entries
+		}
+	}
+	for _, e := range d.Added {
+		entries := c.listEntries[e.BroadcastPath]
+		i := slices.IndexFunc(entries, func(old AnnounceEntry) bool { return old.Relay == e.Relay })
+		if i >= 0 {
+			entries[i] = e
+		} else {
+			c.listEntries[e.BroadcastPath] = append(entries, e)
+			if e.Relay != c.config.RelayName {
+				observeDiscovery(e, time.Now())
+			}
+		}
+	}
+}
+
 // Run starts the heartbeat loop that periodically re-PUTs all registered
 // announces. It blocks until ctx is cancelled.
 func (c *Client) Run(ctx context.Context) {
 	ctx, c.cancel = context.WithCancel(ctx)
 
 	slog.Info("sdn announce client started",
-		"url", c.config.URL,
+		"url", RedactURL(c.config.URL),
 		"relay", c.config.RelayName,
-		"heartbeat", c.config.HeartbeatInterval)
+		"heartbeat", c.config.HeartbeatInterval,
+		"topology_heartbeat", c.config.TopologyInterval)
 
-	// Perform initial topology registration immediately.
-	c.topologyHeartbeat(ctx)
+	defer close(c.done)
+
+	c.bootstrap(ctx)
 
 	ticker := time.NewTicker(c.config.HeartbeatInterval)
 	defer ticker.Stop()
-	defer close(c.done)
+	topologyTicker := time.NewTicker(c.config.TopologyInterval)
+	defer topologyTicker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
+			c.stopQueue()
 			c.deregisterAll()
 			return
 		case <-ticker.C:
 			c.heartbeat(ctx)
+			c.statsHeartbeat(ctx)
+		case <-topologyTicker.C:
 			c.topologyHeartbeat(ctx)
 		}
 	}
@@ -304,7 +657,7 @@ func (c *Client) heartbeat(ctx context.Context) {
 		if ctx.Err() != nil {
 			return
 		}
-		if err := c.put(ctx, bp); err != nil {
+		if err := c.put(ctx, bp, false); err != nil {
 			slog.Warn("sdn heartbeat failed", "error", err,
 				"broadcast_path", bp)
 		}
@@ -312,53 +665,334 @@ func (c *Client) heartbeat(ctx context.Context) {
 	slog.Debug("sdn heartbeat completed", "entries", len(paths))
 }
 
-// topologyHeartbeat sends a PUT /relay/<name> to keep this node alive in the SDN topology.
-// This also serves as the initial registration on startup.
-func (c *Client) topologyHeartbeat(ctx context.Context) {
-	if c.config.Neighbors == nil {
-		return // no topology info to send
+// registersTopology reports whether the client has topology info to send.
+func (c *Client) registersTopology() bool {
+	return c.config.Neighbors != nil || c.config.NeighborsFunc != nil
+}
+
+// RelayInfo returns the topology registration of this relay, with the
+// current neighbor costs.
+func (c *Client) RelayInfo() topology.RelayInfo {
+	neighbors := c.config.Neighbors
+	if c.config.NeighborsFunc != nil {
+		neighbors = c.config.NeighborsFunc()
 	}
+	return topology.RelayInfo{
+		Name:      c.config.RelayName,
+		Region:    c.config.Region,
+		Zone:      c.config.Zone,
+		Address:   c.config.Address,
+		Location:  c.config.Location,
+		Neighbors: neighbors,
+		Version:   version.Version(),
+		Symmetric: c.config.Symmetric,
+	}
+}
 
-	body, _ := json.Marshal(map[string]any{
-		"region":    c.config.Region,
-		"address":   c.config.Address,
-		"neighbors": c.config.Neighbors,
-	})
+// RegisterRelay registers this relay's RelayInfo in the SDN topology with
+// PUT /relay/<name>, adding the relay or refreshing it and its edges.
+func (c *Client) RegisterRelay(ctx context.Context) error {
+	body, err := json.Marshal(c.RelayInfo())
+	if err != nil {
+		return err
+	}
 
 	u := fmt.Sprintf("%s/relay/%s", c.config.URL, url.PathEscape(c.config.RelayName))
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+	req, err := newJSONRequest(ctx, http.MethodPut, u, body)
 	if err != nil {
-		slog.Warn("sdn topology heartbeat: build request failed", "error", err)
-		return
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		slog.Warn("sdn topology heartbeat failed", "error", err)
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		slog.Warn("sdn topology heartbeat: bad status", "status", resp.StatusCode)
+		return &statusError{Method: http.MethodPut, URL: req.URL.Redacted(), Code: resp.StatusCode}
+	}
+	return nil
+}
+
+// bootstrap registers the relay, retrying with backoff until it succeeds
+// or ctx is cancelled, so a relay started before its controller registers
+// as soon as the controller is up rather than at the next topology
+// heartbeat.
+func (c *Client) bootstrap(ctx context.Context) {
+	backoff := c.config.RetryBackoff
+	for c.topologyHeartbeat(ctx) != nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, c.config.MaxRetryBackoff)
+	}
+}
+
+// topologyHeartbeat registers the relay with RegisterRelay to keep this
+// node alive in the SDN topology, or checks that the controller is
+// reachable with Ping if the relay has no topology info to send, and
+// records the outcome. This also serves as the initial registration on
+// startup.
+func (c *Client) topologyHeartbeat(ctx context.Context) error {
+	var err error
+	if c.registersTopology() {
+		err = c.RegisterRelay(ctx)
+	} else {
+		err = c.Ping(ctx)
+	}
+	if ctx.Err() != nil {
+		return err // shutting down; not the controller's fault
+	}
+
+	c.mu.Lock()
+	prev := c.stateLocked()
+	c.registerErr = err
+	if err == nil {
+		c.registeredAt = time.Now()
+		c.failures = 0
+	} else {
+		c.failures++
+	}
+	state, failures := c.stateLocked(), c.failures
+	if err == nil && !c.isBootstrapped() {
+		close(c.bootstrapped)
+	}
+	c.mu.Unlock()
+
+	switch {
+	case state == prev && err != nil:
+		slog.Debug("sdn registration failed", "controller", c.config.Name, "error", err, "failures", failures)
+	case state == prev:
+		slog.Debug("sdn topology heartbeat completed", "relay", c.config.RelayName)
+	case state == StateRegistered:
+		slog.Info("sdn registration succeeded", "controller", c.config.Name, "relay", c.config.RelayName)
+	case state == StateUnreachable:
+		slog.Warn("sdn controller unreachable; retrying", "controller", c.config.Name, "error", err, "failures", failures)
+	}
+	return err
+}
+
+// stateLocked returns the connection state. Caller must hold mu.
+func (c *Client) stateLocked() ConnectionState {
+	switch {
+	case c.registerErr == nil && !c.registeredAt.IsZero():
+		return StateRegistered
+	case c.registerErr != nil && (!c.registeredAt.IsZero() || c.failures >= unreachableAfter):
+		return StateUnreachable
+	default:
+		return StateConnecting
+	}
+}
+
+// isBootstrapped reports whether the relay registered at least once.
+func (c *Client) isBootstrapped() bool {
+	select {
+	case <-c.bootstrapped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Bootstrapped returns a channel that is closed once the relay first
+// registered with the controller.
+func (c *Client) Bootstrapped() <-chan struct{} {
+	return c.bootstrapped
+}
+
+// State returns how the relay's registration with the controller stands.
+func (c *Client) State() ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stateLocked()
+}
+
+// Reregister registers the relay in the topology, if it has topology
+// info, and PUTs every announce again now rather than at the next
+// heartbeats, as after the controller lost its state.
+func (c *Client) Reregister(ctx context.Context) error {
+	var errs []error
+	c.topologyHeartbeat(ctx)
+	c.mu.Lock()
+	if c.registerErr != nil {
+		errs = append(errs, fmt.Errorf("register relay: %w", c.registerErr))
+	}
+	c.mu.Unlock()
+
+	for _, bp := range c.snapshot() {
+		if err := c.put(ctx, bp, false); err != nil {
+			errs = append(errs, fmt.Errorf("announce %s: %w", bp, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RegistrationState returns the outcome of the last registration and the number of announces the client keeps registered.
+func (c *Client) RegistrationState() RegistrationState {
+	queued := c.QueuedOperations()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st := RegistrationState{
+		Relay:            c.config.RelayName,
+		URL:              RedactURL(c.config.URL),
+		Topology:         c.registersTopology(),
+		State:            c.stateLocked(),
+		Registered:       !c.registeredAt.IsZero() && c.registerErr == nil,
+		LastRegistered:   c.registeredAt,
+		Announces:        len(c.entries),
+		QueuedOperations: queued,
+	}
+	if c.registerErr != nil {
+		st.LastError = c.registerErr.Error()
+	}
+	return st
+}
+
+// statsHeartbeat pushes the relay's metric summary if a StatsFunc is configured.
+func (c *Client) statsHeartbeat(ctx context.Context) {
+	if c.config.StatsFunc == nil {
 		return
 	}
-	slog.Debug("sdn topology heartbeat completed", "relay", c.config.RelayName)
+	if err := c.ReportStats(ctx, c.config.StatsFunc()); err != nil {
+		slog.Warn("sdn stats push failed", "error", err)
+	}
+}
+
+// ReportStats sends a metric summary to POST /stats/relay/<name>.
+// EgressMbps is filled in from the delta against the previous report.
+func (c *Client) ReportStats(ctx context.Context, stats RelayStats) error {
+	now := time.Now()
+
+	c.mu.Lock()
+	if !c.lastStatsAt.IsZero() && stats.EgressBytes >= c.lastEgressBytes {
+		if elapsed := now.Sub(c.lastStatsAt).Seconds(); elapsed > 0 {
+			stats.EgressMbps = float64(stats.EgressBytes-c.lastEgressBytes) * 8 / elapsed / 1e6
+		}
+	}
+	c.lastEgressBytes = stats.EgressBytes
+	c.lastStatsAt = now
+	c.mu.Unlock()
+
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	u := fmt.Sprintf("%s/stats/relay/%s", c.config.URL, url.PathEscape(c.config.RelayName))
+	req, err := newJSONRequest(ctx, http.MethodPost, u, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("POST %s returned %d", RedactURL(u), resp.StatusCode)
+	}
+	return nil
 }
 
 func (c *Client) deregisterAll() {
+	if c.detached.Load() {
+		slog.Info("sdn announce client stopped, registrations left to the new relay process")
+		return
+	}
 	paths := c.snapshot()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	var res DeregisterResult
 	for _, bp := range paths {
 		if err := c.delete(ctx, bp); err != nil {
 			slog.Warn("sdn deregister on shutdown failed", "error", err,
 				"broadcast_path", bp)
+			res.Failed++
+			res.Errors = append(res.Errors, bp+": "+err.Error())
+			continue
 		}
+		res.Deregistered++
 	}
-	slog.Info("sdn announce client stopped", "deregistered", len(paths))
+
+	if c.registersTopology() {
+		if err := c.deregisterNode(ctx); err != nil {
+			slog.Warn("sdn topology deregister on shutdown failed", "error", err)
+			res.Errors = append(res.Errors, "topology: "+err.Error())
+		}
+	}
+
+	c.mu.Lock()
+	c.deregisterResult = res
+	c.mu.Unlock()
+
+	slog.Info("sdn announce client stopped",
+		"deregistered", res.Deregistered, "failed", res.Failed)
+}
+
+// Detach makes Run leave the relay's announces and topology registration in
+// place when it stops, for a new relay process that took over the relay's
+// sockets and keeps registering them.
+func (c *Client) Detach() {
+	c.detached.Store(true)
+}
+
+// deregisterNode removes this relay from the SDN topology with reason
+// shutdown, so the controller's history tells a graceful exit from a crash.
+func (c *Client) deregisterNode(ctx context.Context) error {
+	u := fmt.Sprintf("%s/relay/%s?reason=%s", c.config.URL, url.PathEscape(c.config.RelayName), topology.ReasonShutdown)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 404 is acceptable (already expired)
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound {
+		return &statusError{Method: http.MethodDelete, URL: req.URL.Redacted(), Code: resp.StatusCode}
+	}
+	return nil
+}
+
+// Done returns a channel that is closed once Run has returned and the
+// shutdown deregistration has finished.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// DeregisterResult returns the outcome of the shutdown deregistration.
+// It is only meaningful after Done is closed.
+func (c *Client) DeregisterResult() DeregisterResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deregisterResult
+}
+
+// newJSONRequest builds a request with a JSON body, gzip-compressed when
+// large enough (see CompressHandler).
+func newJSONRequest(ctx context.Context, method, u string, body []byte) (*http.Request, error) {
+	body, encoding := gzipBody(body)
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	return req, nil
 }
 
 // announceURL builds the URL: /announce/<relay>/<broadcast_path>
@@ -370,17 +1004,38 @@ func (c *Client) announceURL(broadcastPath string) string {
 	return fmt.Sprintf("%s/announce/%s/%s", c.config.URL, c.config.RelayName, bp)
 }
 
-func (c *Client) put(ctx context.Context, broadcastPath string) error {
-	body, _ := json.Marshal(map[string]string{
+// put registers broadcastPath with the controller, unless it was
+// deregistered since: the DELETE that follows carries a higher sequence
+// number, so the controller would refuse the PUT anyway. announced sends
+// when the path was registered; heartbeats leave it out, so an entry they
+// recreate on a restarted controller does not count as a slow announce.
+func (c *Client) put(ctx context.Context, broadcastPath string, announced bool) error {
+	c.mu.Lock()
+	md, ok := c.entries[broadcastPath]
+	if !ok {
+		c.mu.Unlock()
+		return nil
+	}
+	c.seq++
+	seq := c.seq
+	announcedAt := c.announcedAt[broadcastPath]
+	c.mu.Unlock()
+
+	payload := map[string]any{
 		"relay":          c.config.RelayName,
 		"broadcast_path": broadcastPath,
-	})
+		"metadata":       md,
+		"seq":            seq,
+	}
+	if announced {
+		payload["announced_at"] = announcedAt
+	}
+	body, _ := json.Marshal(payload)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.announceURL(broadcastPath), bytes.NewReader(body))
+	req, err := newJSONRequest(ctx, http.MethodPut, c.announceURL(broadcastPath), body)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -388,14 +1043,21 @@ func (c *Client) put(ctx context.Context, broadcastPath string) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("PUT %s returned %d", req.URL, resp.StatusCode)
+	// 409: a newer request of ours was applied first
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusConflict {
+		return &statusError{Method: http.MethodPut, URL: req.URL.Redacted(), Code: resp.StatusCode}
 	}
 	return nil
 }
 
 func (c *Client) delete(ctx context.Context, broadcastPath string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.announceURL(broadcastPath), nil)
+	c.mu.Lock()
+	c.seq++
+	seq := c.seq
+	c.mu.Unlock()
+
+	u := c.announceURL(broadcastPath) + "?seq=" + strconv.FormatUint(seq, 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
 	if err != nil {
 		return err
 	}
@@ -406,9 +1068,9 @@ func (c *Client) delete(ctx context.Context, broadcastPath string) error {
 	}
 	defer resp.Body.Close()
 
-	// 404 is acceptable (already removed)
-	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound {
-		return fmt.Errorf("DELETE %s returned %d", req.URL, resp.StatusCode)
+	// 404 is acceptable (already removed), as is 409 (superseded)
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusConflict {
+		return &statusError{Method: http.MethodDelete, URL: req.URL.Redacted(), Code: resp.StatusCode}
 	}
 	return nil
 }
@@ -3,11 +3,17 @@ package sdn
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+	"github.com/okdaichi/qumo/internal/version"
 )
 
 func TestNewClient_RequiresURL(t *testing.T) {
@@ -165,6 +171,48 @@ func TestClient_DeregisterAllOnClose(t *testing.T) {
 	}
 }
 
+func TestClient_DetachKeepsRegistrations(t *testing.T) {
+	var mu sync.Mutex
+	deletes := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			mu.Lock()
+			deletes++
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{
+		URL:               srv.URL,
+		RelayName:         "relay-a",
+		HeartbeatInterval: time.Hour,
+		Neighbors:         map[string]float64{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.Run(ctx)
+
+	c.Register("/live/stream1")
+	time.Sleep(50 * time.Millisecond)
+
+	// A new relay process took over the registrations
+	c.Detach()
+	cancel()
+	<-c.Done()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if deletes != 0 {
+		t.Errorf("expected no DELETEs after Detach, got %d", deletes)
+	}
+}
+
 func TestClient_Snapshot(t *testing.T) {
 	c, err := NewClient(ClientConfig{
 		URL:               "http://localhost:8090",
@@ -176,8 +224,8 @@ func TestClient_Snapshot(t *testing.T) {
 	}
 
 	c.mu.Lock()
-	c.entries["/a"] = struct{}{}
-	c.entries["/b"] = struct{}{}
+	c.entries["/a"] = nil
+	c.entries["/b"] = nil
 	c.mu.Unlock()
 
 	snap := c.snapshot()
@@ -269,6 +317,109 @@ func TestClient_TopologyHeartbeat(t *testing.T) {
 		if neighbors["relay-london"] != 250.0 {
 			t.Errorf("expected neighbor relay-london cost 250, got %v", neighbors["relay-london"])
 		}
+		if body["version"] != version.Version() {
+			t.Errorf("expected version %q, got %v", version.Version(), body["version"])
+		}
+	}
+}
+
+func TestClient_RegisterRelay(t *testing.T) {
+	topo := &topology.Topology{}
+	srv := httptest.NewServer(topology.NewNodeHandlerFunc(topo))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	cost := 10.0
+	c, err := NewClient(ClientConfig{
+		URL:               srv.URL,
+		RelayName:         "relay-a",
+		HeartbeatInterval: time.Hour,
+		TopologyInterval:  20 * time.Millisecond,
+		Region:            "eu",
+		Zone:              "eu-1a",
+		Address:           "https://relay-a:4433",
+		NeighborsFunc: func() map[string]float64 {
+			mu.Lock()
+			defer mu.Unlock()
+			return map[string]float64{"relay-b": cost}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.RegisterRelay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	node := topo.Snapshot().Nodes["relay-a"]
+	if node == nil || node.Region != "eu" || node.Zone != "eu-1a" || node.Address != "https://relay-a:4433" {
+		t.Fatalf("unexpected node: %+v", node)
+	}
+	if len(node.Edges) != 1 || node.Edges[0].To != "relay-b" || node.Edges[0].Cost != 10 {
+		t.Fatalf("unexpected edges: %+v", node.Edges)
+	}
+
+	// Heartbeats on their own interval pick up the live costs
+	mu.Lock()
+	cost = 25
+	mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.Run(ctx)
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if edges := topo.Snapshot().Nodes["relay-a"].Edges; len(edges) == 1 && edges[0].Cost == 25 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if edges := topo.Snapshot().Nodes["relay-a"].Edges; len(edges) != 1 || edges[0].Cost != 25 {
+		t.Errorf("expected the topology heartbeat to update the cost to 25, got %+v", edges)
+	}
+	cancel()
+	<-c.Done()
+
+	if _, ok := topo.Snapshot().Nodes["relay-a"]; ok {
+		t.Error("expected the relay to deregister from the topology on close")
+	}
+}
+
+func TestClient_RegisterRelay_Rejected(t *testing.T) {
+	topo := &topology.Topology{Validation: &topology.RegistrationValidation{}}
+	srv := httptest.NewServer(topology.NewNodeHandlerFunc(topo))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a", Address: "relay-a:4433"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.RegisterRelay(context.Background())
+	var se *statusError
+	if !errors.As(err, &se) || se.Code != http.StatusBadRequest {
+		t.Errorf("expected a 400 status error, got %v", err)
+	}
+}
+
+func TestClient_TopologyHeartbeat_Symmetric(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{
+		URL:       srv.URL,
+		RelayName: "relay-a",
+		Neighbors: map[string]float64{"relay-b": 10},
+		Symmetric: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.topologyHeartbeat(context.Background())
+	if body["symmetric"] != true {
+		t.Errorf("expected symmetric=true in heartbeat, got %v", body["symmetric"])
 	}
 }
 
@@ -298,3 +449,489 @@ func TestClient_TopologyHeartbeat_NoNeighbors_Skips(t *testing.T) {
 		t.Errorf("expected 0 topology heartbeats without neighbors, got %d", putCount)
 	}
 }
+
+func TestClient_RegisterWithMetadata_EndToEnd(t *testing.T) {
+	table := NewAnnounceTable(0)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/announce/lookup", LookupHandlerFunc(table))
+	mux.HandleFunc("/announce/", HandlerFunc(table))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := &AnnounceMetadata{Codecs: []string{"avc1.64001f", "opus"}, Bitrate: 3_000_000, Labels: []string{"premium"}}
+	c.RegisterWithMetadata("/live/stream1", md)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for table.Count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	entries, err := c.Lookup(context.Background(), "/live/stream1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Metadata == nil {
+		t.Fatalf("expected entry with metadata, got %+v", entries)
+	}
+	got := entries[0].Metadata
+	if got.Bitrate != 3_000_000 || len(got.Codecs) != 2 || !got.HasLabel("premium") {
+		t.Errorf("unexpected metadata: %+v", got)
+	}
+}
+
+func TestHandlerFunc_PutInvalidBody(t *testing.T) {
+	handler := HandlerFunc(NewAnnounceTable(0))
+
+	req := httptest.NewRequest(http.MethodPut, "/announce/relay-a/live/x", strings.NewReader("{"))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestClient_DeregisterNodeOnClose(t *testing.T) {
+	topo := &topology.Topology{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/relay/", topology.NewNodeHandlerFunc(topo))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{
+		URL:               srv.URL,
+		RelayName:         "relay-a",
+		HeartbeatInterval: time.Hour,
+		Neighbors:         map[string]float64{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.Run(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	<-c.Done()
+
+	h, ok := topo.History("relay-a")
+	if !ok || h.Live {
+		t.Fatalf("expected relay-a to be deregistered, got %+v", h)
+	}
+	if len(h.Tombstones) != 1 || h.Tombstones[0].Reason != topology.ReasonShutdown {
+		t.Errorf("expected a shutdown tombstone, got %+v", h.Tombstones)
+	}
+	if res := c.DeregisterResult(); len(res.Errors) != 0 {
+		t.Errorf("unexpected errors: %+v", res)
+	}
+}
+
+func TestClient_DeregisterResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete && strings.HasSuffix(r.URL.Path, "/broken") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a", HeartbeatInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.Run(ctx)
+
+	c.Register("/live/ok")
+	c.Register("/live/broken")
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	<-c.Done()
+
+	res := c.DeregisterResult()
+	if res.Deregistered != 1 || res.Failed != 1 || len(res.Errors) != 1 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestClient_ListAllDelta(t *testing.T) {
+	table := NewAnnounceTable(0)
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		ListHandlerFunc(table)(w, r)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := func() map[string]bool {
+		t.Helper()
+		entries, err := c.ListAll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for _, e := range entries {
+			got[e.Relay+" "+e.BroadcastPath] = true
+		}
+		return got
+	}
+
+	table.Register("relay-a", "/live/own")
+	table.Register("relay-b", "/live/s1")
+	table.Register("relay-c", "/live/s1")
+	if got := list(); len(got) != 2 || !got["relay-b /live/s1"] || !got["relay-c /live/s1"] {
+		t.Fatalf("unexpected first list: %v", got)
+	}
+
+	table.Deregister("relay-b", "/live/s1")
+	table.Register("relay-b", "/live/s2")
+	if got := list(); len(got) != 2 || !got["relay-c /live/s1"] || !got["relay-b /live/s2"] {
+		t.Errorf("unexpected list after delta: %v", got)
+	}
+
+	// A restarted controller answers the old cursor with its full table
+	table = NewAnnounceTable(0)
+	table.Register("relay-d", "/live/s3")
+	if got := list(); len(got) != 1 || !got["relay-d /live/s3"] {
+		t.Errorf("unexpected list after restart: %v", got)
+	}
+
+	if queries[0] != "" || !strings.HasPrefix(queries[1], "since=") || !strings.HasPrefix(queries[2], "since=") {
+		t.Errorf("unexpected queries: %v", queries)
+	}
+}
+
+func TestClient_AnnounceDiscovery(t *testing.T) {
+	table := NewAnnounceTable(0)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/announce", ListHandlerFunc(table))
+	mux.HandleFunc("/announce/", HandlerFunc(table))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	a, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first list is a full one, whose entries are not discoveries
+	table.Register("relay-c", "/live/old")
+	if _, err := b.ListAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	before := histogramCount(t, announceDiscovery)
+
+	start := time.Now()
+	a.Register("/live/s1")
+	deadline := time.Now().Add(2 * time.Second)
+	for table.Count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	entries, err := b.ListAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, e := range entries {
+		if e.BroadcastPath == "/live/s1" {
+			found = true
+			if e.AnnouncedAt.Before(start) || e.AnnouncedAt.After(time.Now()) {
+				t.Errorf("unexpected announced_at %v", e.AnnouncedAt)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected relay-b to discover /live/s1, got %+v", entries)
+	}
+	if n := histogramCount(t, announceDiscovery) - before; n != 1 {
+		t.Errorf("expected 1 discovery observation, got %d", n)
+	}
+
+	// Already known entries are not observed again
+	if _, err := b.ListAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := histogramCount(t, announceDiscovery) - before; n != 1 {
+		t.Errorf("expected no further observations, got %d", n)
+	}
+}
+
+func TestClient_AnnounceSeq(t *testing.T) {
+	table := NewAnnounceTable(0)
+	srv := httptest.NewServer(HandlerFunc(table))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a", HeartbeatInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Register("/live/x")
+	c.Deregister("/live/x")
+	time.Sleep(100 * time.Millisecond)
+
+	// A heartbeat that snapshotted the path before Deregister sends nothing.
+	if err := c.put(context.Background(), "/live/x", false); err != nil {
+		t.Fatal(err)
+	}
+	if n := table.Count(); n != 0 {
+		t.Fatalf("expected no announcements, got %d", n)
+	}
+
+	key := [2]string{"relay-a", "/live/x"}
+	if table.seqs[key].seq != c.seq {
+		t.Errorf("expected the controller to have applied seq %d, got %d", c.seq, table.seqs[key].seq)
+	}
+}
+
+func TestClient_Token(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(LookupResponse{})
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-b", Token: "token-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Lookup(t.Context(), "/live/private"); err != nil {
+		t.Fatal(err)
+	}
+	if got != "Bearer token-b" {
+		t.Errorf("Authorization = %q", got)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	healthy := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(t.Context()); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+
+	healthy = false
+	if err := c.Ping(t.Context()); err == nil {
+		t.Error("Ping succeeded against an unhealthy controller")
+	}
+}
+
+func TestClient_RouteConditional(t *testing.T) {
+	topo := &topology.Topology{}
+	topo.Register(topology.RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 1}})
+	topo.Register(topology.RelayInfo{Name: "relay-b", Neighbors: map[string]float64{}})
+
+	var (
+		mu          sync.Mutex
+		notModified int
+	)
+	route := topology.RouteHandlerFunc(topo)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		route(rec, r)
+		mu.Lock()
+		if rec.Code == http.StatusNotModified {
+			notModified++
+		}
+		mu.Unlock()
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		result, err := c.Route(context.Background(), "relay-b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.NextHop != "relay-b" || result.Cost != 1 {
+			t.Fatalf("unexpected route %+v", result)
+		}
+	}
+	mu.Lock()
+	if notModified != 2 {
+		t.Errorf("expected 2 revalidated answers, got %d", notModified)
+	}
+	mu.Unlock()
+
+	// A topology change sends a fresh answer
+	topo.Register(topology.RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 5}})
+	result, err := c.Route(context.Background(), "relay-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Cost != 5 {
+		t.Errorf("expected the new cost 5, got %v", result.Cost)
+	}
+}
+
+func TestClient_RegistrationState(t *testing.T) {
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a", Neighbors: map[string]float64{"relay-b": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := c.RegistrationState(); !st.Topology || st.Registered {
+		t.Fatalf("expected an unregistered topology relay, got %+v", st)
+	}
+
+	c.topologyHeartbeat(t.Context())
+	st := c.RegistrationState()
+	if !st.Registered || st.LastRegistered.IsZero() || st.LastError != "" {
+		t.Errorf("expected a registered relay, got %+v", st)
+	}
+
+	fail = true
+	c.topologyHeartbeat(t.Context())
+	st = c.RegistrationState()
+	if st.Registered || st.LastError == "" {
+		t.Errorf("expected the failed registration, got %+v", st)
+	}
+	if st.LastRegistered.IsZero() {
+		t.Error("the last successful registration was forgotten")
+	}
+}
+
+func TestClient_Bootstrap(t *testing.T) {
+	var failures atomic.Int32
+	failures.Store(4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a", Neighbors: map[string]float64{"relay-b": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []ConnectionState{StateConnecting, StateConnecting, StateUnreachable, StateUnreachable, StateRegistered} {
+		c.topologyHeartbeat(t.Context())
+		if got := c.State(); got != want {
+			t.Errorf("after attempt %d: state %q, want %q", i+1, got, want)
+		}
+	}
+	select {
+	case <-c.Bootstrapped():
+	default:
+		t.Error("Bootstrapped not closed after the first registration")
+	}
+
+	// Once registered, the first failure counts as unreachable
+	failures.Store(1)
+	c.topologyHeartbeat(t.Context())
+	if st := c.RegistrationState(); st.State != StateUnreachable || st.LastError == "" {
+		t.Errorf("expected an unreachable controller, got %+v", st)
+	}
+}
+
+func TestClient_BootstrapRetries(t *testing.T) {
+	var pings atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && pings.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	// Announce-only relays check in with GET /health
+	c, err := NewClient(ClientConfig{
+		URL:               srv.URL,
+		RelayName:         "relay-a",
+		HeartbeatInterval: time.Hour,
+		RetryBackoff:      5 * time.Millisecond,
+		MaxRetryBackoff:   10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	go c.Run(ctx)
+	defer c.Close()
+
+	select {
+	case <-c.Bootstrapped():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the relay did not register once the controller came up")
+	}
+	if got := pings.Load(); got != 3 {
+		t.Errorf("expected 3 pings, got %d", got)
+	}
+	if st := c.RegistrationState(); st.State != StateRegistered || !st.Registered {
+		t.Errorf("expected a registered relay, got %+v", st)
+	}
+	cancel()
+}
+
+func FuzzLookupResponse(f *testing.F) {
+	f.Add([]byte(`{"broadcast_path":"/live/s1","relays":[{"relay":"relay-a","broadcast_path":"/live/s1","registered_at":"2026-01-02T03:04:05Z"}]}`))
+	f.Add([]byte(`{"relays":null}`))
+	f.Add([]byte(`{"relays":[{"metadata":{"codecs":["opus"],"bitrate":-1,"visibility":{}}}]}`))
+	f.Add([]byte(`[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]`))
+
+	var body atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body.Load().([]byte))
+	}))
+	defer srv.Close()
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a"})
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		body.Store(data)
+		entries, err := c.Lookup(context.Background(), "/live/s1")
+		if err != nil && entries != nil {
+			t.Errorf("expected no entries with an error, got %v", entries)
+		}
+	})
+}
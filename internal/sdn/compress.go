@@ -0,0 +1,285 @@
+package sdn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// compressMinSize is the smallest body worth compressing; below it the
+// encoding overhead outweighs the savings.
+const compressMinSize = 1024
+
+// maxRequestBody bounds a request body, encoded or decoded, before any
+// handler reads it: the limit of the largest body an endpoint accepts.
+const maxRequestBody = topology.MaxSyncBytes
+
+// CompressHandler wraps next with transparent HTTP compression:
+//
+//   - request bodies sent with Content-Encoding gzip or deflate are
+//     decoded before next sees them;
+//   - responses of at least compressMinSize bytes are gzip- or
+//     deflate-encoded when the client's Accept-Encoding allows it.
+//
+// Responses that already carry a Content-Encoding (e.g. /metrics) are
+// passed through unchanged. Raw and encoded sizes are counted in
+// qumo_sdn_http_body_bytes_total. Encoded bodies inflating past
+// maxRequestBody fail to read, whatever the handler's own limit.
+func CompressHandler(next http.Handler) http.Handler {
+	return compressHandler(next, maxRequestBody)
+}
+
+// compressHandler is CompressHandler limiting request bodies to limit bytes.
+func compressHandler(next http.Handler, limit int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if enc := r.Header.Get("Content-Encoding"); enc != "" && r.Body != nil {
+			body, err := decodeBody(w, enc, r.Body, limit)
+			if err != nil {
+				jsonError(w, http.StatusUnsupportedMediaType, err.Error())
+				return
+			}
+			r.Body = body
+			r.Header.Del("Content-Encoding")
+			r.ContentLength = -1
+		}
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// decodeBody returns a reader that decodes a request body sent with the
+// given Content-Encoding, counting raw and encoded bytes. Both the body and
+// the decoded stream fail with an *http.MaxBytesError past limit bytes.
+func decodeBody(w http.ResponseWriter, encoding string, body io.ReadCloser, limit int64) (io.ReadCloser, error) {
+	body = http.MaxBytesReader(w, body, limit)
+	encoded := &countingReader{r: body}
+	var dec io.ReadCloser
+	var err error
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		dec, err = gzip.NewReader(encoded)
+	case "deflate":
+		dec, err = zlib.NewReader(encoded)
+	case "identity":
+		return body, nil
+	default:
+		return nil, errUnsupportedEncoding(encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	dec = http.MaxBytesReader(w, dec, limit)
+	return &decodedBody{dec: dec, raw: body, encoded: encoded}, nil
+}
+
+type errUnsupportedEncoding string
+
+func (e errUnsupportedEncoding) Error() string {
+	return "unsupported Content-Encoding: " + string(e)
+}
+
+// decodedBody reads the decoded stream and records sizes on Close.
+type decodedBody struct {
+	dec     io.ReadCloser
+	raw     io.Closer
+	encoded *countingReader
+	decoded int64
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	n, err := b.dec.Read(p)
+	b.decoded += int64(n)
+	return n, err
+}
+
+func (b *decodedBody) Close() error {
+	httpBodyBytes.WithLabelValues("request", "raw").Add(float64(b.decoded))
+	httpBodyBytes.WithLabelValues("request", "encoded").Add(float64(b.encoded.n))
+	b.dec.Close()
+	return b.raw.Close()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip. q=0 excludes an encoding.
+func negotiateEncoding(accept string) string {
+	allowed := map[string]bool{}
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		allowed[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+	switch {
+	case allowed["gzip"]:
+		return "gzip"
+	case allowed["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressWriter buffers the first compressMinSize bytes of a response to
+// decide whether to compress it, then streams through the encoder.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	status      int
+	wroteHeader bool // WriteHeader was called by the handler
+	started     bool // headers sent downstream
+	buf         bytes.Buffer
+	enc         io.WriteCloser
+	counter     *countingWriter
+	raw         int64
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	cw.wroteHeader = true
+	cw.raw += int64(len(p))
+	if cw.started {
+		if cw.enc != nil {
+			return cw.enc.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf.Write(p)
+	if cw.buf.Len() < compressMinSize {
+		return len(p), nil
+	}
+	if err := cw.start(true); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// start sends the headers and the buffered bytes, through the encoder if
+// compress is set and the response is not already encoded.
+func (cw *compressWriter) start(compress bool) error {
+	cw.started = true
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		compress = false
+	}
+
+	if compress {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		cw.counter = &countingWriter{w: cw.ResponseWriter}
+		if cw.encoding == "gzip" {
+			cw.enc = gzip.NewWriter(cw.counter)
+		} else {
+			cw.enc = zlib.NewWriter(cw.counter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	data := cw.buf.Bytes()
+	cw.buf = bytes.Buffer{}
+	if len(data) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(data)
+	} else {
+		_, err = cw.ResponseWriter.Write(data)
+	}
+	return err
+}
+
+// Close flushes the response and records its sizes.
+func (cw *compressWriter) Close() error {
+	if !cw.started {
+		if !cw.wroteHeader {
+			return nil // handler wrote nothing; net/http sends the default
+		}
+		if err := cw.start(false); err != nil {
+			return err
+		}
+	}
+	if cw.enc == nil {
+		return nil
+	}
+	err := cw.enc.Close()
+	httpBodyBytes.WithLabelValues("response", "raw").Add(float64(cw.raw))
+	httpBodyBytes.WithLabelValues("response", "encoded").Add(float64(cw.counter.n))
+	return err
+}
+
+// Flush sends buffered data, starting compression if the body is large
+// enough to warrant it.
+func (cw *compressWriter) Flush() {
+	if !cw.started && cw.wroteHeader {
+		cw.start(cw.buf.Len() >= compressMinSize)
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// gzipBody compresses a request body if it is large enough to benefit.
+// It returns the body and the Content-Encoding to send ("" if unchanged).
+func gzipBody(data []byte) ([]byte, string) {
+	if len(data) < compressMinSize {
+		return data, ""
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes(), "gzip"
+}
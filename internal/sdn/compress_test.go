@@ -0,0 +1,192 @@
+package sdn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate, gzip;q=0.5", "gzip"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"br, GZIP", "gzip"},
+		{"gzip; q=0.0", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.accept); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestCompressHandler_Response(t *testing.T) {
+	large := strings.Repeat(`{"relay":"relay-a"},`, 200)
+	h := CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if r.URL.Path == "/small" {
+			io.WriteString(w, "{}")
+			return
+		}
+		// Write in pieces to cross the buffering threshold mid-stream.
+		io.WriteString(w, large[:100])
+		io.WriteString(w, large[100:])
+	}))
+
+	for _, enc := range []string{"gzip", "deflate"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/graph", nil)
+		req.Header.Set("Accept-Encoding", enc)
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("%s: expected 201, got %d", enc, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != enc {
+			t.Fatalf("expected Content-Encoding %s, got %q", enc, got)
+		}
+		if rec.Body.Len() >= len(large) {
+			t.Errorf("%s: body not compressed (%d bytes)", enc, rec.Body.Len())
+		}
+
+		var r io.Reader
+		var err error
+		if enc == "gzip" {
+			r, err = gzip.NewReader(rec.Body)
+		} else {
+			r, err = zlib.NewReader(rec.Body)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(r)
+		if string(body) != large {
+			t.Errorf("%s: round trip mismatch", enc)
+		}
+	}
+
+	// Small bodies and clients without Accept-Encoding get plain responses.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/small", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "{}" || rec.Code != http.StatusCreated {
+		t.Errorf("small response altered: %d %q %q", rec.Code, rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graph", nil))
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != large {
+		t.Error("response compressed without Accept-Encoding")
+	}
+}
+
+func TestCompressHandler_PreEncodedPassThrough(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 2*compressMinSize)
+	h := CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		w.Write(payload)
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "br" || !bytes.Equal(rec.Body.Bytes(), payload) {
+		t.Error("pre-encoded response was modified")
+	}
+}
+
+func TestCompressHandler_Request(t *testing.T) {
+	var got string
+	h := CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+		if r.Header.Get("Content-Encoding") != "" {
+			t.Error("Content-Encoding should be removed after decoding")
+		}
+	}))
+
+	payload := strings.Repeat(`{"name":"relay-a"}`, 100)
+	body, enc := gzipBody([]byte(payload))
+	if enc != "gzip" {
+		t.Fatalf("expected gzip for %d bytes, got %q", len(payload), enc)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/sync", bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", enc)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got != payload {
+		t.Error("request body not decoded")
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/sync", strings.NewReader("x"))
+	req.Header.Set("Content-Encoding", "br")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for unknown encoding, got %d", rec.Code)
+	}
+
+	if _, enc := gzipBody([]byte("{}")); enc != "" {
+		t.Error("small bodies should not be compressed")
+	}
+}
+
+func TestCompressHandler_RequestBomb(t *testing.T) {
+	h := CompressHandler(topology.SyncHandlerFunc(&topology.Topology{}))
+
+	// A few kilobytes that inflate past the /sync limit
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write([]byte(`{"nodes":["`))
+	zw.Write(make([]byte, topology.MaxSyncBytes))
+	zw.Close()
+
+	req := httptest.NewRequest(http.MethodPut, "/sync", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a body inflating past the limit, got %d", rec.Code)
+	}
+}
+
+func TestCompressHandler_RequestLimit(t *testing.T) {
+	var readErr error
+	h := compressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}), 4096)
+
+	for _, enc := range []string{"gzip", "identity"} {
+		body := make([]byte, 8192)
+		if enc == "gzip" {
+			body, _ = gzipBody(body)
+		}
+		req := httptest.NewRequest(http.MethodPut, "/sync", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", enc)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		var tooLarge *http.MaxBytesError
+		if !errors.As(readErr, &tooLarge) {
+			t.Errorf("%s: reading a body past the limit: err = %v, want *http.MaxBytesError", enc, readErr)
+		}
+	}
+}
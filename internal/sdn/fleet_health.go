@@ -0,0 +1,268 @@
+package sdn
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// Defaults of HealthMonitor.
+const (
+	DefaultRelayHealthInterval         = 10 * time.Second
+	DefaultRelayHealthTimeout          = 2 * time.Second
+	DefaultRelayHealthFailureThreshold = 3
+)
+
+// healthProbeConcurrency bounds the relays a HealthMonitor probes at once.
+const healthProbeConcurrency = 16
+
+// Sources of a RelayHealth.
+const (
+	HealthSourceProbe     = "probe"
+	HealthSourceHeartbeat = "heartbeat"
+)
+
+// RelayHealth is the health of one relay in a FleetHealth.
+type RelayHealth struct {
+	Relay  string          `json:"relay"`
+	Health topology.Health `json:"health"`
+	Reason string          `json:"reason,omitempty"`
+	Source string          `json:"source,omitempty"` // HealthSourceProbe or HealthSourceHeartbeat
+
+	// CheckedAt is when the assessment was made: the last probe, or the
+	// heartbeat's arrival.
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+
+	// Failures counts the probes in a row the relay did not answer.
+	Failures int `json:"consecutive_failures,omitempty"`
+}
+
+// FleetHealth is the summary served by GET /fleet/health.
+type FleetHealth struct {
+	Healthy     int           `json:"healthy"`
+	Degraded    int           `json:"degraded"`
+	Unreachable int           `json:"unreachable"`
+	Unknown     int           `json:"unknown"`
+	Relays      []RelayHealth `json:"relays"` // least healthy first
+	Timestamp   time.Time     `json:"timestamp"`
+}
+
+// HealthMonitor aggregates the health of the registered relays from what
+// they report in their stats heartbeats and, with Probe set, from polling
+// their GET /health?probe=ready, and hands it to the Topology so routes
+// avoid unhealthy relays (see Topology.SetHealth). A relay is as healthy
+// as the worse of the two.
+type HealthMonitor struct {
+	Topo  *topology.Topology
+	Stats *statsTable
+
+	// Probe polls each relay with an address every Interval: a 200 makes
+	// it healthy, another answer degraded, and FailureThreshold probes in a
+	// row without an answer unreachable.
+	Probe            bool
+	Interval         time.Duration // zero uses DefaultRelayHealthInterval
+	Timeout          time.Duration // per probe; zero uses DefaultRelayHealthTimeout
+	FailureThreshold int           // zero uses DefaultRelayHealthFailureThreshold
+
+	client *http.Client
+
+	mu     sync.Mutex
+	probes map[string]RelayHealth // relay → last probe outcome
+}
+
+// NewHealthMonitor creates a monitor of the relays registered with topo.
+func NewHealthMonitor(topo *topology.Topology, stats *statsTable) *HealthMonitor {
+	return &HealthMonitor{
+		Topo:   topo,
+		Stats:  stats,
+		client: &http.Client{},
+		probes: make(map[string]RelayHealth),
+	}
+}
+
+// Run probes the relays, if enabled, and applies their health to the
+// Topology every Interval until ctx is cancelled.
+func (m *HealthMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(cmp.Or(m.Interval, DefaultRelayHealthInterval))
+	defer ticker.Stop()
+
+	for {
+		if m.Probe {
+			m.probeAll(ctx)
+		}
+		m.apply()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// apply hands the current assessment to the Topology.
+func (m *HealthMonitor) apply() {
+	fh := m.Evaluate()
+	health := make(map[string]topology.Health, len(fh.Relays))
+	for _, rh := range fh.Relays {
+		health[rh.Relay] = rh.Health
+	}
+	m.Topo.SetHealth(health)
+
+	for h, n := range map[topology.Health]int{
+		topology.HealthHealthy:     fh.Healthy,
+		topology.HealthDegraded:    fh.Degraded,
+		topology.HealthUnreachable: fh.Unreachable,
+		topology.HealthUnknown:     fh.Unknown,
+	} {
+		fleetRelays.WithLabelValues(string(h)).Set(float64(n))
+	}
+}
+
+// Evaluate assesses every registered relay from its latest heartbeat and
+// probe.
+func (m *HealthMonitor) Evaluate() FleetHealth {
+	now := time.Now()
+	threshold := cmp.Or(m.FailureThreshold, DefaultRelayHealthFailureThreshold)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fh := FleetHealth{Relays: []RelayHealth{}, Timestamp: now}
+	for id, n := range m.Topo.Snapshot().Nodes {
+		if n.LastSeen.IsZero() {
+			continue // named as a neighbor or seeded, but never registered
+		}
+		rh := RelayHealth{Relay: id, Health: topology.HealthUnknown}
+		if e, ok := m.Stats.Get(id); ok && (m.Stats.TTL <= 0 || now.Sub(e.ReceivedAt) <= m.Stats.TTL) {
+			if h := topology.Health(e.Health); h == topology.HealthHealthy || h == topology.HealthDegraded {
+				rh = RelayHealth{Relay: id, Health: h, Reason: e.HealthReason, Source: HealthSourceHeartbeat, CheckedAt: e.ReceivedAt}
+			}
+		}
+		if p, ok := m.probes[id]; ok && m.Probe {
+			if p.Failures > 0 && p.Failures < threshold {
+				p.Health = topology.HealthUnknown // not unreachable yet
+			}
+			if healthRank(p.Health) >= healthRank(rh.Health) {
+				rh = p
+			}
+		}
+
+		switch rh.Health {
+		case topology.HealthHealthy:
+			fh.Healthy++
+		case topology.HealthDegraded:
+			fh.Degraded++
+		case topology.HealthUnreachable:
+			fh.Unreachable++
+		default:
+			fh.Unknown++
+		}
+		fh.Relays = append(fh.Relays, rh)
+	}
+	slices.SortFunc(fh.Relays, func(a, b RelayHealth) int {
+		return cmp.Or(healthRank(b.Health)-healthRank(a.Health), cmp.Compare(a.Relay, b.Relay))
+	})
+	return fh
+}
+
+// healthRank orders health from best to worst.
+func healthRank(h topology.Health) int {
+	switch h {
+	case topology.HealthHealthy:
+		return 1
+	case topology.HealthDegraded:
+		return 2
+	case topology.HealthUnreachable:
+		return 3
+	}
+	return 0
+}
+
+// probeAll probes the registered relays with an address and forgets the
+// probes of relays that left.
+func (m *HealthMonitor) probeAll(ctx context.Context) {
+	targets := make(map[string]string)
+	for id, n := range m.Topo.Snapshot().Nodes {
+		if target := topology.HTTPHostPort(n.Address); target != "" && !n.LastSeen.IsZero() {
+			targets[id] = target
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, healthProbeConcurrency)
+	for id, target := range targets {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			h, reason, err := m.probe(ctx, target)
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			p := RelayHealth{Relay: id, Health: h, Reason: reason, Source: HealthSourceProbe, CheckedAt: time.Now()}
+			if err != nil {
+				p.Health, p.Reason = topology.HealthUnreachable, err.Error()
+				p.Failures = m.probes[id].Failures + 1
+			}
+			m.probes[id] = p
+		})
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.probes {
+		if _, ok := targets[id]; !ok {
+			delete(m.probes, id)
+		}
+	}
+}
+
+// probe asks the relay serving HTTP at target whether it is ready.
+func (m *HealthMonitor) probe(ctx context.Context, target string) (topology.Health, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(m.Timeout, DefaultRelayHealthTimeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+target+"/health?probe=ready", nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return topology.HealthHealthy, "", nil
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if topology.DecodeResponse(resp.Body, topology.MaxRequestBytes, &body) != nil || body.Reason == "" {
+		body.Reason = fmt.Sprintf("health check returned %d", resp.StatusCode)
+	}
+	return topology.HealthDegraded, body.Reason, nil
+}
+
+// FleetHealthHandlerFunc returns an http.HandlerFunc that summarizes the
+// health of the registered relays:
+//
+//	GET /fleet/health
+func FleetHealthHandlerFunc(m *HealthMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(m.Evaluate())
+	}
+}
@@ -0,0 +1,98 @@
+package sdn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+func TestHealthMonitor(t *testing.T) {
+	var ready atomic.Bool
+	ready.Store(true)
+	relayB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || r.URL.Query().Get("probe") != "ready" {
+			t.Errorf("unexpected probe %s", r.URL)
+		}
+		if !ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]any{"ready": false, "reason": "warming_cache"})
+		}
+	}))
+	defer relayB.Close()
+	relayC := httptest.NewServer(http.NotFoundHandler())
+	relayC.Close() // unreachable
+
+	topo := &topology.Topology{}
+	for _, reg := range []topology.RelayInfo{
+		{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 1, "relay-c": 1, "relay-x": 1}},
+		{Name: "relay-b", Address: relayB.URL},
+		{Name: "relay-c", Address: relayC.URL},
+	} {
+		if err := topo.Register(reg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := NewStatsTable(0)
+	stats.Report("relay-a", RelayStats{Health: "degraded", HealthReason: "resource_pressure: memory"})
+
+	m := NewHealthMonitor(topo, stats)
+	m.Probe = true
+	m.FailureThreshold = 2
+	health := func() map[string]RelayHealth {
+		fh := m.Evaluate()
+		byRelay := make(map[string]RelayHealth)
+		for _, rh := range fh.Relays {
+			byRelay[rh.Relay] = rh
+		}
+		if len(byRelay) != fh.Healthy+fh.Degraded+fh.Unreachable+fh.Unknown {
+			t.Errorf("counts do not add up: %+v", fh)
+		}
+		return byRelay
+	}
+
+	m.probeAll(context.Background())
+	h := health()
+	if len(h) != 3 {
+		t.Fatalf("expected the 3 registered relays, not relay-x, got %v", h)
+	}
+	if h["relay-a"].Health != topology.HealthDegraded || h["relay-a"].Source != HealthSourceHeartbeat || h["relay-a"].Reason != "resource_pressure: memory" {
+		t.Errorf("expected relay-a degraded by its heartbeat, got %+v", h["relay-a"])
+	}
+	if h["relay-b"].Health != topology.HealthHealthy || h["relay-b"].Source != HealthSourceProbe {
+		t.Errorf("expected relay-b healthy by probe, got %+v", h["relay-b"])
+	}
+	if h["relay-c"].Health != topology.HealthUnknown || h["relay-c"].Failures != 1 {
+		t.Errorf("expected relay-c unknown after one failed probe, got %+v", h["relay-c"])
+	}
+
+	ready.Store(false)
+	m.probeAll(context.Background())
+	h = health()
+	if h["relay-b"].Health != topology.HealthDegraded || h["relay-b"].Reason != "warming_cache" {
+		t.Errorf("expected relay-b degraded while warming, got %+v", h["relay-b"])
+	}
+	if h["relay-c"].Health != topology.HealthUnreachable || h["relay-c"].Failures != 2 {
+		t.Errorf("expected relay-c unreachable after two failed probes, got %+v", h["relay-c"])
+	}
+	if fh := m.Evaluate(); fh.Relays[0].Relay != "relay-c" {
+		t.Errorf("expected the unreachable relay first, got %+v", fh.Relays)
+	}
+
+	// The assessment reaches routing
+	m.apply()
+	if res, err := topo.Route("relay-a", "relay-c"); err != nil || len(res.FullPath) != 2 {
+		t.Errorf("an unreachable relay is still a destination, got %+v, %v", res, err)
+	}
+
+	rec := httptest.NewRecorder()
+	FleetHealthHandlerFunc(m)(rec, httptest.NewRequest(http.MethodGet, "/fleet/health", nil))
+	var fh FleetHealth
+	if err := json.NewDecoder(rec.Body).Decode(&fh); err != nil || fh.Degraded != 2 || fh.Unreachable != 1 {
+		t.Errorf("expected 2 degraded and 1 unreachable, got %+v, %v", fh, err)
+	}
+}
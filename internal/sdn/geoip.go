@@ -0,0 +1,215 @@
+package sdn
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// GeoIPResolver maps a client IP address to an approximate location.
+// Implementations can wrap MaxMind databases, cloud provider headers, etc.
+type GeoIPResolver interface {
+	// Resolve returns the location for ip, or false if it is unknown.
+	Resolve(ip netip.Addr) (GeoRecord, bool)
+}
+
+// GeoRecord is the location information resolved for an IP address.
+type GeoRecord struct {
+	Region   string             `json:"region,omitempty"`
+	Location *topology.Location `json:"location,omitempty"`
+}
+
+// cidrGeoDB is a GeoIPResolver backed by a list of CIDR prefixes.
+// The most specific matching prefix wins.
+type cidrGeoDB struct {
+	entries []cidrGeoEntry
+}
+
+type cidrGeoEntry struct {
+	prefix netip.Prefix
+	record GeoRecord
+}
+
+// LoadGeoIPFile loads a CSV GeoIP database with the columns
+//
+//	network,latitude,longitude,region
+//
+// Lines starting with '#' are ignored; latitude/longitude may be empty when
+// only the region is known.
+func LoadGeoIPFile(path string) (GeoIPResolver, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open geoip file: %w", err)
+	}
+	defer f.Close()
+
+	return parseGeoIPCSV(f)
+}
+
+func parseGeoIPCSV(r io.Reader) (*cidrGeoDB, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	db := &cidrGeoDB{}
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("geoip line %d: %w", line, err)
+		}
+		if len(rec) < 4 {
+			return nil, fmt.Errorf("geoip line %d: expected 4 columns, got %d", line, len(rec))
+		}
+		if line == 1 && rec[0] == "network" {
+			continue // header
+		}
+
+		prefix, err := netip.ParsePrefix(rec[0])
+		if err != nil {
+			return nil, fmt.Errorf("geoip line %d: %w", line, err)
+		}
+
+		entry := cidrGeoEntry{
+			prefix: prefix.Masked(),
+			record: GeoRecord{Region: strings.TrimSpace(rec[3])},
+		}
+		if rec[1] != "" && rec[2] != "" {
+			lat, err := strconv.ParseFloat(rec[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("geoip line %d: latitude: %w", line, err)
+			}
+			lon, err := strconv.ParseFloat(rec[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("geoip line %d: longitude: %w", line, err)
+			}
+			entry.record.Location = &topology.Location{Lat: lat, Lon: lon}
+		}
+		db.entries = append(db.entries, entry)
+	}
+	return db, nil
+}
+
+// Resolve returns the record of the longest prefix containing ip.
+func (db *cidrGeoDB) Resolve(ip netip.Addr) (GeoRecord, bool) {
+	ip = ip.Unmap()
+	best := -1
+	var rec GeoRecord
+	for _, e := range db.entries {
+		if e.prefix.Bits() > best && e.prefix.Contains(ip) {
+			best = e.prefix.Bits()
+			rec = e.record
+		}
+	}
+	return rec, best >= 0
+}
+
+// EdgeResponse is the JSON response for GET /edge.
+type EdgeResponse struct {
+	ClientIP string     `json:"client_ip"`
+	Client   *GeoRecord `json:"client,omitempty"` // nil if the IP could not be located
+	PlacementResult
+}
+
+// EdgeHandlerFunc returns an http.HandlerFunc that steers a subscriber to the
+// nearest relay based on its IP address.
+//
+//	GET /edge?ip=<client-ip>
+//
+// If ip is omitted, the first X-Forwarded-For entry or the request's remote
+// address is used. When the IP cannot be located (or geo is nil), the least
+// loaded relay is returned. Relays that are cordoned or drained, in an
+// active maintenance window, or reported degraded or unreachable (see
+// Topology.SetHealth) are skipped.
+func EdgeHandlerFunc(topo *topology.Topology, stats *statsTable, geo GeoIPResolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip, err := clientIP(r)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp := EdgeResponse{ClientIP: ip.String()}
+		var req PlacementRequest
+		if geo != nil {
+			if rec, ok := geo.Resolve(ip); ok {
+				resp.Client = &rec
+				req = PlacementRequest{Region: rec.Region, Location: rec.Location}
+			}
+		}
+
+		g := topo.Snapshot()
+		dropUnavailable(g, topo.Unhealthy(), time.Now())
+		resp.PlacementResult, err = Place(g, stats, req)
+		if err != nil {
+			jsonError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// dropUnavailable removes from g the relays reported unhealthy and those in
+// a maintenance window active at now, which the maintenance scheduler may
+// not have cordoned yet. Place skips cordoned relays itself.
+func dropUnavailable(g *topology.Graph, unhealthy map[string]topology.Health, now time.Time) {
+	for id := range unhealthy {
+		delete(g.Nodes, id)
+	}
+	for _, w := range g.Maintenance {
+		if w.Active(now) {
+			delete(g.Nodes, w.Relay)
+		}
+	}
+}
+
+// clientIP extracts the client address from the ip query parameter,
+// X-Forwarded-For, or the connection's remote address, in that order.
+func clientIP(r *http.Request) (netip.Addr, error) {
+	if s := r.URL.Query().Get("ip"); s != "" {
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("invalid 'ip' query parameter: %q", s)
+		}
+		return ip, nil
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		if ip, err := netip.ParseAddr(strings.TrimSpace(first)); err == nil {
+			return ip, nil
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("cannot determine client IP from %q", r.RemoteAddr)
+	}
+	return ip, nil
+}
@@ -0,0 +1,191 @@
+package sdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+const testGeoCSV = `network,latitude,longitude,region
+# coarse ranges
+10.0.0.0/8,51.51,-0.13,europe
+10.1.0.0/16,35.68,139.69,asia
+192.168.0.0/16,,,asia
+`
+
+func TestParseGeoIPCSV_LongestPrefixWins(t *testing.T) {
+	db, err := parseGeoIPCSV(strings.NewReader(testGeoCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, ok := db.Resolve(netip.MustParseAddr("10.1.2.3"))
+	if !ok || rec.Region != "asia" {
+		t.Errorf("expected asia for 10.1.2.3, got %+v (ok=%v)", rec, ok)
+	}
+
+	rec, ok = db.Resolve(netip.MustParseAddr("10.9.9.9"))
+	if !ok || rec.Region != "europe" || rec.Location == nil {
+		t.Errorf("expected europe with location for 10.9.9.9, got %+v", rec)
+	}
+
+	rec, ok = db.Resolve(netip.MustParseAddr("192.168.1.1"))
+	if !ok || rec.Location != nil {
+		t.Errorf("expected region-only record, got %+v", rec)
+	}
+
+	if _, ok := db.Resolve(netip.MustParseAddr("8.8.8.8")); ok {
+		t.Error("expected unknown IP to be unresolved")
+	}
+}
+
+func TestParseGeoIPCSV_Errors(t *testing.T) {
+	tests := map[string]string{
+		"bad prefix":   "not-a-cidr,1,2,x\n",
+		"bad latitude": "10.0.0.0/8,abc,2,x\n",
+		"few columns":  "10.0.0.0/8,1\n",
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseGeoIPCSV(strings.NewReader(input)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadGeoIPFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.csv")
+	if err := os.WriteFile(path, []byte(testGeoCSV), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGeoIPFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGeoIPFile(filepath.Join(t.TempDir(), "missing.csv")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestEdgeHandlerFunc(t *testing.T) {
+	db, err := parseGeoIPCSV(strings.NewReader(testGeoCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := EdgeHandlerFunc(placementTopology(), NewStatsTable(0), db)
+
+	tests := []struct {
+		name      string
+		target    string
+		xff       string
+		wantRelay string
+	}{
+		{"query param asia", "/edge?ip=10.1.0.5", "", "relay-tokyo"},
+		{"query param europe", "/edge?ip=10.200.0.5", "", "relay-london"},
+		{"forwarded header", "/edge", "10.1.0.9, 172.16.0.1", "relay-tokyo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			var resp EdgeResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Relay != tt.wantRelay {
+				t.Errorf("expected %s, got %s", tt.wantRelay, resp.Relay)
+			}
+			if resp.Client == nil {
+				t.Error("expected client geo record")
+			}
+		})
+	}
+}
+
+func TestEdgeHandlerFunc_UnknownIPFallsBack(t *testing.T) {
+	handler := EdgeHandlerFunc(placementTopology(), nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/edge", nil) // RemoteAddr 192.0.2.1
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp EdgeResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.ClientIP != "192.0.2.1" || resp.Client != nil {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp.Relay == "" {
+		t.Error("expected a relay to be selected")
+	}
+}
+
+func TestEdgeHandlerFunc_SkipsUnhealthyNearest(t *testing.T) {
+	db, err := parseGeoIPCSV(strings.NewReader(testGeoCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, health := range []topology.Health{topology.HealthUnreachable, topology.HealthDegraded} {
+		topo := placementTopology()
+		topo.SetHealth(map[string]topology.Health{"relay-tokyo": health})
+		handler := EdgeHandlerFunc(topo, nil, db)
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/edge?ip=10.1.0.5", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", health, rec.Code, rec.Body.String())
+		}
+		var resp EdgeResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Relay != "relay-london" {
+			t.Errorf("%s nearest relay: expected relay-london, got %s", health, resp.Relay)
+		}
+	}
+}
+
+func TestDropUnavailable(t *testing.T) {
+	now := time.Now()
+	g := placementTopology().Snapshot()
+	g.Maintenance = []topology.MaintenanceWindow{
+		{Relay: "relay-tokyo", Start: now.Add(-time.Minute), End: now.Add(time.Hour)},
+		{Relay: "relay-london", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)},
+	}
+
+	dropUnavailable(g, map[string]topology.Health{"relay-stub": topology.HealthUnreachable}, now)
+	if len(g.Nodes) != 1 || g.Nodes["relay-london"] == nil {
+		t.Errorf("expected only relay-london to remain, got %v", g.Nodes)
+	}
+}
+
+func TestEdgeHandlerFunc_InvalidIP(t *testing.T) {
+	handler := EdgeHandlerFunc(placementTopology(), nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/edge?ip=bogus", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,422 @@
+package sdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// DefaultHealthInterval is how often a Group checks its controllers by
+// default.
+const DefaultHealthInterval = 5 * time.Second
+
+// Group registers the relay with several SDN controllers at once, such as
+// the production and staging control planes during a migration. Announces
+// and topology registrations go to every controller; lookups, routes and
+// tasks are asked of the primary, or of the next healthy controller while
+// it is down. A Group of one client behaves like the client.
+// It is safe for concurrent use.
+type Group struct {
+	clients []*Client // failover order, primary first
+
+	// HealthInterval is how often the controllers are pinged.
+	// Default: DefaultHealthInterval.
+	HealthInterval time.Duration
+
+	mu     sync.Mutex
+	health []controllerHealth // by client index
+	active int                // index of the client answering queries
+
+	doneOnce sync.Once
+	done     chan struct{}
+
+	bootstrappedOnce sync.Once
+	bootstrapped     chan struct{}
+}
+
+// controllerHealth is the outcome of the last health check of a
+// controller.
+type controllerHealth struct {
+	checkedAt time.Time
+	err       error
+}
+
+// ControllerState reports the registration and health of one controller
+// of a Group.
+type ControllerState struct {
+	RegistrationState
+
+	Name        string    `json:"name"`
+	Primary     bool      `json:"primary"`
+	Active      bool      `json:"active"` // answers lookups and routes now
+	Healthy     bool      `json:"healthy"`
+	CheckedAt   time.Time `json:"checked_at,omitzero"`
+	HealthError string    `json:"health_error,omitempty"`
+}
+
+// NewGroup returns a Group of clients, the primary first and the others in
+// failover order. Controller names must be unique.
+func NewGroup(clients ...*Client) (*Group, error) {
+	if len(clients) == 0 {
+		return nil, errors.New("sdn group: no clients")
+	}
+	seen := make(map[string]bool)
+	for _, c := range clients {
+		name := c.ControllerName()
+		if seen[name] {
+			return nil, fmt.Errorf("sdn group: duplicate controller name %q", name)
+		}
+		seen[name] = true
+	}
+	return &Group{
+		clients: clients,
+		health:  make([]controllerHealth, len(clients)),
+		done:    make(chan struct{}),
+
+		bootstrapped: make(chan struct{}),
+	}, nil
+}
+
+// Clients returns the clients of the group, the primary first.
+func (g *Group) Clients() []*Client {
+	return g.clients
+}
+
+// Run starts the heartbeat loops of every client and checks the health of
+// the controllers until ctx is cancelled.
+func (g *Group) Run(ctx context.Context) {
+	for _, c := range g.clients {
+		go c.Run(ctx)
+	}
+	if len(g.clients) == 1 {
+		<-ctx.Done() // nothing to fail over to
+		return
+	}
+
+	interval := g.HealthInterval
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.checkHealth(ctx)
+		}
+	}
+}
+
+// checkHealth pings every controller and makes the first healthy one, in
+// failover order, the active one.
+func (g *Group) checkHealth(ctx context.Context) {
+	results := make([]controllerHealth, len(g.clients))
+	var wg sync.WaitGroup
+	for i, c := range g.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+			defer cancel()
+			results[i] = controllerHealth{checkedAt: time.Now(), err: c.Ping(pingCtx)}
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, h := range results {
+		if h.err != nil && g.health[i].err == nil {
+			slog.Warn("sdn controller unhealthy", "controller", g.clients[i].ControllerName(), "error", h.err)
+		} else if h.err == nil && g.health[i].err != nil {
+			slog.Info("sdn controller healthy again", "controller", g.clients[i].ControllerName())
+		}
+	}
+	g.health = results
+
+	active := 0 // the primary while none is healthy
+	for i, h := range results {
+		if h.err == nil {
+			active = i
+			break
+		}
+	}
+	if active != g.active {
+		slog.Warn("sdn queries fail over",
+			"from", g.clients[g.active].ControllerName(),
+			"to", g.clients[active].ControllerName())
+		g.active = active
+	}
+}
+
+// healthy reports whether the last health check of the i-th controller
+// succeeded; controllers count as healthy until checked.
+func (g *Group) healthy(i int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.health[i].err == nil
+}
+
+// order returns the clients to ask, in turn: the active one first, then
+// the other healthy ones in failover order, then the rest.
+func (g *Group) order() []*Client {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	order := make([]*Client, 0, len(g.clients))
+	order = append(order, g.clients[g.active])
+	var unhealthy []*Client
+	for i, c := range g.clients {
+		switch {
+		case i == g.active:
+		case g.health[i].err == nil:
+			order = append(order, c)
+		default:
+			unhealthy = append(unhealthy, c)
+		}
+	}
+	return append(order, unhealthy...)
+}
+
+// failover calls fn with the clients of g in order until it succeeds, and
+// returns the last error if none does.
+func failover[T any](ctx context.Context, g *Group, fn func(*Client) (T, error)) (T, error) {
+	var (
+		result T
+		err    error
+	)
+	for _, c := range g.order() {
+		if result, err = fn(c); err == nil || ctx.Err() != nil {
+			return result, err
+		}
+		if len(g.clients) > 1 {
+			slog.Debug("sdn query failed; trying the next controller", "controller", c.ControllerName(), "error", err)
+		}
+	}
+	return result, err
+}
+
+// Register adds a broadcast path on every controller; see Client.Register.
+func (g *Group) Register(broadcastPath string) {
+	for _, c := range g.clients {
+		c.Register(broadcastPath)
+	}
+}
+
+// RegisterWithMetadata adds a broadcast path and its metadata on every
+// controller; see Client.RegisterWithMetadata.
+func (g *Group) RegisterWithMetadata(broadcastPath string, md *AnnounceMetadata) {
+	for _, c := range g.clients {
+		c.RegisterWithMetadata(broadcastPath, md)
+	}
+}
+
+// Deregister removes a broadcast path from every controller.
+func (g *Group) Deregister(broadcastPath string) {
+	for _, c := range g.clients {
+		c.Deregister(broadcastPath)
+	}
+}
+
+// Reregister registers the relay and its announces again with every
+// controller; see Client.Reregister.
+func (g *Group) Reregister(ctx context.Context) error {
+	var errs []error
+	for _, c := range g.clients {
+		if err := c.Reregister(ctx); err != nil {
+			if len(g.clients) > 1 {
+				err = fmt.Errorf("%s: %w", c.ControllerName(), err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RelayName returns the name the relay registers under with the primary.
+func (g *Group) RelayName() string {
+	return g.clients[0].RelayName()
+}
+
+// ListAll returns the announcements of the other relays; see
+// Client.ListAll.
+func (g *Group) ListAll(ctx context.Context) ([]AnnounceEntry, error) {
+	return failover(ctx, g, func(c *Client) ([]AnnounceEntry, error) {
+		return c.ListAll(ctx)
+	})
+}
+
+// Route returns the route from this relay to the target relay; see
+// Client.Route.
+func (g *Group) Route(ctx context.Context, to string) (topology.RouteResult, error) {
+	return failover(ctx, g, func(c *Client) (topology.RouteResult, error) {
+		return c.Route(ctx, to)
+	})
+}
+
+// PrefetchTasks returns the broadcasts to prefetch; see
+// Client.PrefetchTasks.
+func (g *Group) PrefetchTasks(ctx context.Context) ([]PrefetchTask, *topology.MaintenanceWindow, error) {
+	type answer struct {
+		tasks       []PrefetchTask
+		maintenance *topology.MaintenanceWindow
+	}
+	a, err := failover(ctx, g, func(c *Client) (answer, error) {
+		tasks, maintenance, err := c.PrefetchTasks(ctx)
+		return answer{tasks, maintenance}, err
+	})
+	return a.tasks, a.maintenance, err
+}
+
+// ProbeTasks returns the probes to run now; see Client.ProbeTasks.
+func (g *Group) ProbeTasks(ctx context.Context) ([]ProbeTask, error) {
+	return failover(ctx, g, func(c *Client) ([]ProbeTask, error) {
+		return c.ProbeTasks(ctx)
+	})
+}
+
+// ReportProbe sends a probe result; see Client.ReportProbe.
+func (g *Group) ReportProbe(ctx context.Context, res ProbeResult) error {
+	_, err := failover(ctx, g, func(c *Client) (struct{}, error) {
+		return struct{}{}, c.ReportProbe(ctx, res)
+	})
+	return err
+}
+
+// Ping checks that at least one controller is reachable and healthy.
+func (g *Group) Ping(ctx context.Context) error {
+	_, err := failover(ctx, g, func(c *Client) (struct{}, error) {
+		return struct{}{}, c.Ping(ctx)
+	})
+	return err
+}
+
+// QueuedOperations returns the number of announce operations waiting to
+// reach any controller.
+func (g *Group) QueuedOperations() int {
+	n := 0
+	for _, c := range g.clients {
+		n += c.QueuedOperations()
+	}
+	return n
+}
+
+// Bootstrapped returns a channel that is closed once the relay first
+// registered with any controller, which can then answer lookups and
+// routes; see Client.Bootstrapped.
+func (g *Group) Bootstrapped() <-chan struct{} {
+	g.bootstrappedOnce.Do(func() {
+		var once sync.Once
+		for _, c := range g.clients {
+			go func() {
+				select {
+				case <-c.Bootstrapped():
+					once.Do(func() { close(g.bootstrapped) })
+				case <-c.Done():
+				}
+			}()
+		}
+	})
+	return g.bootstrapped
+}
+
+// Bootstrapping reports whether a controller configured with
+// WaitForRegistration has not been registered with yet.
+func (g *Group) Bootstrapping() bool {
+	for _, c := range g.clients {
+		if c.config.WaitForRegistration && !c.isBootstrapped() {
+			return true
+		}
+	}
+	return false
+}
+
+// State returns the best connection state of the controllers: registered
+// if the relay is registered with any, unreachable if all are.
+func (g *Group) State() ConnectionState {
+	state := StateUnreachable
+	for _, c := range g.clients {
+		switch c.State() {
+		case StateRegistered:
+			return StateRegistered
+		case StateConnecting:
+			state = StateConnecting
+		}
+	}
+	return state
+}
+
+// Controllers reports the registration and health of every controller,
+// the primary first.
+func (g *Group) Controllers() []ControllerState {
+	g.mu.Lock()
+	health := append([]controllerHealth(nil), g.health...)
+	active := g.active
+	g.mu.Unlock()
+
+	states := make([]ControllerState, len(g.clients))
+	for i, c := range g.clients {
+		states[i] = ControllerState{
+			RegistrationState: c.RegistrationState(),
+			Name:              c.ControllerName(),
+			Primary:           i == 0,
+			Active:            i == active,
+			Healthy:           health[i].err == nil,
+			CheckedAt:         health[i].checkedAt,
+		}
+		if err := health[i].err; err != nil {
+			states[i].HealthError = err.Error()
+		}
+	}
+	return states
+}
+
+// Done returns a channel that is closed once every client has stopped; see
+// Client.Done.
+func (g *Group) Done() <-chan struct{} {
+	g.doneOnce.Do(func() {
+		go func() {
+			for _, c := range g.clients {
+				<-c.Done()
+			}
+			close(g.done)
+		}()
+	})
+	return g.done
+}
+
+// Detach detaches every client; see Client.Detach.
+func (g *Group) Detach() {
+	for _, c := range g.clients {
+		c.Detach()
+	}
+}
+
+// DeregisterResult sums the shutdown deregistrations of the clients.
+// With several controllers, errors are prefixed with the controller name.
+func (g *Group) DeregisterResult() DeregisterResult {
+	var res DeregisterResult
+	for _, c := range g.clients {
+		r := c.DeregisterResult()
+		res.Deregistered += r.Deregistered
+		res.Failed += r.Failed
+		for _, e := range r.Errors {
+			if len(g.clients) > 1 {
+				e = c.ControllerName() + ": " + e
+			}
+			res.Errors = append(res.Errors, e)
+		}
+	}
+	return res
+}
@@ -0,0 +1,258 @@
+package sdn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// fakeController serves the announce, route and health endpoints of a
+// controller whose answers name it, and counts announce PUTs.
+type fakeController struct {
+	*httptest.Server
+	name string
+	down atomic.Bool
+
+	mu   sync.Mutex
+	puts map[string]int
+}
+
+func newFakeController(t *testing.T, name string) *fakeController {
+	f := &fakeController{name: name, puts: make(map[string]int)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut:
+			f.mu.Lock()
+			f.puts[r.URL.Path]++
+			f.mu.Unlock()
+		case r.URL.Path == "/route":
+			json.NewEncoder(w).Encode(topology.RouteResult{NextHop: f.name})
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeController) putCount(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.puts[path]
+}
+
+func newTestGroup(t *testing.T, controllers ...*fakeController) *Group {
+	clients := make([]*Client, len(controllers))
+	for i, f := range controllers {
+		c, err := NewClient(ClientConfig{URL: f.URL, Name: f.name, RelayName: "relay-a", HeartbeatInterval: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients[i] = c
+	}
+	g, err := NewGroup(clients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestNewGroup(t *testing.T) {
+	if _, err := NewGroup(); err == nil {
+		t.Error("expected an error without clients")
+	}
+
+	a, _ := NewClient(ClientConfig{URL: "http://sdn:8090", RelayName: "relay-a"})
+	b, _ := NewClient(ClientConfig{URL: "http://sdn:8090", RelayName: "relay-a"})
+	if a.ControllerName() != "sdn:8090" {
+		t.Errorf("expected the URL host as the default name, got %q", a.ControllerName())
+	}
+	if _, err := NewGroup(a, b); err == nil {
+		t.Error("expected an error for duplicate controller names")
+	}
+}
+
+func TestGroup_RegisterEverywhere(t *testing.T) {
+	prod := newFakeController(t, "prod")
+	staging := newFakeController(t, "staging")
+	g := newTestGroup(t, prod, staging)
+
+	g.Register("/live/stream1")
+	deadline := time.Now().Add(time.Second)
+	for prod.putCount("/announce/relay-a/live/stream1") == 0 || staging.putCount("/announce/relay-a/live/stream1") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the announce did not reach both controllers")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if g.QueuedOperations() != 0 {
+		t.Errorf("expected no queued operations, got %d", g.QueuedOperations())
+	}
+}
+
+func TestGroup_RouteFailover(t *testing.T) {
+	prod := newFakeController(t, "prod")
+	staging := newFakeController(t, "staging")
+	g := newTestGroup(t, prod, staging)
+	ctx := context.Background()
+
+	route, err := g.Route(ctx, "relay-b")
+	if err != nil || route.NextHop != "prod" {
+		t.Fatalf("expected the primary's route, got %+v, %v", route, err)
+	}
+
+	// A failed query falls through to the next controller
+	prod.down.Store(true)
+	route, err = g.Route(ctx, "relay-b")
+	if err != nil || route.NextHop != "staging" {
+		t.Fatalf("expected the secondary's route, got %+v, %v", route, err)
+	}
+
+	// Health checks make the secondary active
+	g.checkHealth(ctx)
+	states := g.Controllers()
+	if states[0].Healthy || states[0].Active || states[0].HealthError == "" || !states[0].Primary {
+		t.Errorf("unexpected primary state %+v", states[0])
+	}
+	if !states[1].Healthy || !states[1].Active {
+		t.Errorf("unexpected secondary state %+v", states[1])
+	}
+
+	// ... until the primary recovers
+	prod.down.Store(false)
+	g.checkHealth(ctx)
+	if !g.Controllers()[0].Active {
+		t.Error("expected the recovered primary to be active again")
+	}
+
+	prod.down.Store(true)
+	staging.down.Store(true)
+	if _, err := g.Route(ctx, "relay-b"); err == nil {
+		t.Error("expected an error with every controller down")
+	}
+	if err := g.Ping(ctx); err == nil {
+		t.Error("expected Ping to fail with every controller down")
+	}
+}
+
+func TestGroup_DeregisterResult(t *testing.T) {
+	prod := newFakeController(t, "prod")
+	staging := newFakeController(t, "staging")
+	staging.down.Store(true)
+	g := newTestGroup(t, prod, staging)
+	for _, c := range g.Clients() {
+		c.mu.Lock()
+		c.entries["/live/stream1"] = nil
+		c.mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go g.Run(ctx)
+	cancel()
+	select {
+	case <-g.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("the clients did not stop")
+	}
+
+	res := g.DeregisterResult()
+	if res.Deregistered != 1 || res.Failed != 1 {
+		t.Errorf("expected 1 deregistered and 1 failed, got %+v", res)
+	}
+	if len(res.Errors) != 1 || !strings.HasPrefix(res.Errors[0], "staging: ") {
+		t.Errorf("expected the error prefixed with the controller, got %q", res.Errors)
+	}
+}
+
+func TestGroup_Reregister(t *testing.T) {
+	prod := newFakeController(t, "prod")
+	staging := newFakeController(t, "staging")
+	g := newTestGroup(t, prod, staging)
+	for _, c := range g.Clients() {
+		c.mu.Lock()
+		c.entries["/live/stream1"] = nil
+		c.mu.Unlock()
+	}
+
+	if err := g.Reregister(context.Background()); err != nil {
+		t.Fatalf("Reregister: %v", err)
+	}
+	for _, f := range []*fakeController{prod, staging} {
+		if n := f.putCount("/announce/relay-a/live/stream1"); n != 1 {
+			t.Errorf("expected the announce PUT to %s once, got %d", f.name, n)
+		}
+	}
+
+	staging.down.Store(true)
+	err := g.Reregister(context.Background())
+	if err == nil || !strings.HasPrefix(err.Error(), "staging: ") {
+		t.Errorf("expected an error prefixed with the failing controller, got %v", err)
+	}
+	if n := prod.putCount("/announce/relay-a/live/stream1"); n != 2 {
+		t.Errorf("expected prod to be re-registered regardless, got %d PUTs", n)
+	}
+}
+
+func TestGroup_Bootstrap(t *testing.T) {
+	prod, staging := newFakeController(t, "prod"), newFakeController(t, "staging")
+	staging.down.Store(true)
+
+	clients := make([]*Client, 2)
+	for i, f := range []*fakeController{prod, staging} {
+		c, err := NewClient(ClientConfig{
+			URL:                 f.URL,
+			Name:                f.name,
+			RelayName:           "relay-a",
+			HeartbeatInterval:   time.Hour,
+			RetryBackoff:        5 * time.Millisecond,
+			MaxRetryBackoff:     10 * time.Millisecond,
+			WaitForRegistration: f == staging,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients[i] = c
+	}
+	g, err := NewGroup(clients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.State(); got != StateConnecting {
+		t.Errorf("state before Run: %q", got)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go g.Run(ctx)
+
+	select {
+	case <-g.Bootstrapped():
+	case <-time.After(5 * time.Second):
+		t.Fatal("not bootstrapped with the primary up")
+	}
+	if got := g.State(); got != StateRegistered {
+		t.Errorf("state with the primary up: %q", got)
+	}
+	if !g.Bootstrapping() {
+		t.Error("readiness does not wait for the controller configured to be waited for")
+	}
+
+	staging.down.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for g.Bootstrapping() {
+		if time.Now().After(deadline) {
+			t.Fatal("still bootstrapping after the controller came up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
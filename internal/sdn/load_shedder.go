@@ -0,0 +1,149 @@
+package sdn
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Priority is the class of a controller API request under load shedding.
+type Priority int
+
+// Priority classes, most important first.
+const (
+	// PriorityCritical requests keep the data plane running: relay
+	// heartbeats, announcements, announce listing, routes and steering of
+	// new publishers and subscribers, plus health checks. They are never
+	// shed.
+	PriorityCritical Priority = iota
+
+	// PriorityNormal requests are relays' background reporting and tasks,
+	// HA sync, metrics scrapes and operator changes.
+	PriorityNormal
+
+	// PriorityLow requests are reads for dashboards and operators, such as
+	// /graph, /query and the inventory exports.
+	PriorityLow
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityCritical:
+		return "critical"
+	case PriorityNormal:
+		return "normal"
+	default:
+		return "low"
+	}
+}
+
+// DefaultShedRetryAfter is the back-off suggested to shed clients when
+// LoadShedder.RetryAfter is unset.
+const DefaultShedRetryAfter = time.Second
+
+// ClassifyRequest returns the priority class of a controller API request.
+func ClassifyRequest(r *http.Request) Priority {
+	p := r.URL.Path
+	switch {
+	case p == "/route" && r.Method != http.MethodGet && r.Method != http.MethodHead:
+		return PriorityNormal // a bandwidth reservation
+	case p == "/health", p == "/route", p == "/edge", p == "/placement",
+		p == "/announce", p == "/announce/lookup":
+		return PriorityCritical
+	case strings.HasPrefix(p, "/relay/") && (strings.HasSuffix(p, "/detail") || strings.HasSuffix(p, "/history")):
+		return PriorityLow
+	case strings.HasPrefix(p, "/relay/") && strings.HasSuffix(p, "/maintenance"):
+		return PriorityNormal
+	case strings.HasPrefix(p, "/relay/") && r.Method == http.MethodPut:
+		return PriorityCritical
+	case p == "/announce/export", p == "/announce/coverage":
+		return PriorityLow
+	case strings.HasPrefix(p, "/announce/"):
+		return PriorityCritical
+	case p == "/graph", strings.HasPrefix(p, "/graph/"), p == "/query",
+		p == "/stats/cluster", p == "/stats/probes", p == "/stats/popular":
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			return PriorityLow
+		}
+		return PriorityNormal
+	case p == "/route/reservations" && r.Method == http.MethodGet,
+		p == "/maintenance" && r.Method == http.MethodGet:
+		return PriorityLow
+	case p == "/override/edge" && r.Method == http.MethodGet,
+		strings.HasPrefix(p, "/ui/"):
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+// LoadShedder admits controller API requests by priority class. While more
+// requests are in flight than a class's limit, new requests of that class
+// are refused with 503 Service Unavailable and a Retry-After header, so
+// relays' route queries and heartbeats keep being served when dashboards
+// pile up. Refusals are counted in qumo_sdn_requests_shed_total.
+type LoadShedder struct {
+	// MaxInFlight is the number of concurrent requests above which
+	// PriorityNormal requests are shed. Zero disables shedding.
+	MaxInFlight int
+
+	// LowPriorityLimit is the number of concurrent requests above which
+	// PriorityLow requests are shed. Zero uses half of MaxInFlight.
+	LowPriorityLimit int
+
+	// RetryAfter is suggested to shed clients. Zero uses
+	// DefaultShedRetryAfter.
+	RetryAfter time.Duration
+
+	// Classify assigns requests their priority. Nil uses ClassifyRequest.
+	Classify func(*http.Request) Priority
+
+	inFlight atomic.Int64
+}
+
+// limit returns how many requests may be in flight when one of class p is
+// admitted, or 0 if p is never shed.
+func (s *LoadShedder) limit(p Priority) int {
+	switch {
+	case s.MaxInFlight <= 0 || p == PriorityCritical:
+		return 0
+	case p == PriorityNormal:
+		return s.MaxInFlight
+	case s.LowPriorityLimit > 0:
+		return min(s.LowPriorityLimit, s.MaxInFlight)
+	default:
+		return max(1, s.MaxInFlight/2)
+	}
+}
+
+// Handler wraps next with admission control.
+func (s *LoadShedder) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		classify := s.Classify
+		if classify == nil {
+			classify = ClassifyRequest
+		}
+		p := classify(r)
+
+		n := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		if limit := s.limit(p); limit > 0 && n > int64(limit) {
+			requestsShed.WithLabelValues(p.String()).Inc()
+			retryAfter := s.RetryAfter
+			if retryAfter <= 0 {
+				retryAfter = DefaultShedRetryAfter
+			}
+			secs := max(1, int((retryAfter+time.Second-1)/time.Second))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			jsonError(w, http.StatusServiceUnavailable, "controller overloaded, shedding "+p.String()+" priority requests")
+			return
+		}
+
+		inFlight := requestsInFlight.WithLabelValues(p.String())
+		inFlight.Inc()
+		defer inFlight.Dec()
+		next.ServeHTTP(w, r)
+	})
+}
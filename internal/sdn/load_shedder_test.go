@@ -0,0 +1,134 @@
+package sdn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClassifyRequest(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         Priority
+	}{
+		{http.MethodGet, "/route?from=a&to=b", PriorityCritical},
+		{http.MethodPut, "/relay/relay-a", PriorityCritical},
+		{http.MethodPut, "/announce/relay-a/live/x", PriorityCritical},
+		{http.MethodGet, "/announce?since=5", PriorityCritical},
+		{http.MethodGet, "/announce/lookup?track=video", PriorityCritical},
+		{http.MethodGet, "/edge?ip=192.0.2.1", PriorityCritical},
+		{http.MethodGet, "/health", PriorityCritical},
+		{http.MethodDelete, "/relay/relay-a", PriorityNormal},
+		{http.MethodPost, "/stats/relay/relay-a", PriorityNormal},
+		{http.MethodGet, "/probes/relay-a", PriorityNormal},
+		{http.MethodGet, "/replication/relay-a", PriorityNormal},
+		{http.MethodGet, "/sync", PriorityNormal},
+		{http.MethodPost, "/graph/attributes", PriorityNormal},
+		{http.MethodPost, "/override/edge", PriorityNormal},
+		{http.MethodGet, "/graph", PriorityLow},
+		{http.MethodGet, "/graph/zones", PriorityLow},
+		{http.MethodGet, "/query?q=nodes()", PriorityLow},
+		{http.MethodGet, "/relay/relay-a/detail", PriorityLow},
+		{http.MethodGet, "/announce/export?format=csv", PriorityLow},
+		{http.MethodGet, "/stats/cluster", PriorityLow},
+		{http.MethodGet, "/stats/popular", PriorityLow},
+		{http.MethodGet, "/override/edge", PriorityLow},
+		{http.MethodGet, "/ui/assets/index.js", PriorityLow},
+		{http.MethodPost, "/route", PriorityNormal},
+		{http.MethodGet, "/route/reservations", PriorityLow},
+		{http.MethodDelete, "/route/reservations?id=1", PriorityNormal},
+		{http.MethodPut, "/relay/a/maintenance", PriorityNormal},
+		{http.MethodGet, "/maintenance", PriorityLow},
+		{http.MethodGet, "/relay/a/history", PriorityLow},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := ClassifyRequest(r); got != tt.want {
+			t.Errorf("%s %s: got %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLoadShedder_ShedsLowPriorityFirst(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{}, 10)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("block") {
+			entered <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	s := &LoadShedder{MaxInFlight: 2, LowPriorityLimit: 1, RetryAfter: 3 * time.Second}
+	h := s.Handler(next)
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	// Nothing in flight: every class is served.
+	if rec := serve(http.MethodGet, "/graph"); rec.Code != http.StatusOK {
+		t.Fatalf("idle /graph: got %d", rec.Code)
+	}
+
+	// Hold one normal request in flight.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve(http.MethodGet, "/sync?block")
+	}()
+	<-entered
+
+	shedBefore := testutil.ToFloat64(requestsShed.WithLabelValues("low"))
+	rec := serve(http.MethodGet, "/graph")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("/graph under load: got %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("Retry-After: got %q, want 3", got)
+	}
+	if got := testutil.ToFloat64(requestsShed.WithLabelValues("low")) - shedBefore; got != 1 {
+		t.Errorf("shed low requests: got %v, want 1", got)
+	}
+
+	// A second normal request still fits under MaxInFlight.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve(http.MethodGet, "/sync?block")
+	}()
+	<-entered
+
+	if rec := serve(http.MethodPost, "/stats/relay/relay-a"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("normal request over MaxInFlight: got %d, want 503", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/route?from=a&to=b"); rec.Code != http.StatusOK {
+		t.Errorf("critical request over MaxInFlight: got %d, want 200", rec.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	if rec := serve(http.MethodGet, "/graph"); rec.Code != http.StatusOK {
+		t.Errorf("/graph after load: got %d", rec.Code)
+	}
+}
+
+func TestLoadShedder_Disabled(t *testing.T) {
+	s := &LoadShedder{}
+	for _, p := range []Priority{PriorityCritical, PriorityNormal, PriorityLow} {
+		if limit := s.limit(p); limit != 0 {
+			t.Errorf("%v: limit %d, want none", p, limit)
+		}
+	}
+	s.MaxInFlight = 10
+	if limit := s.limit(PriorityLow); limit != 5 {
+		t.Errorf("default low limit: got %d, want 5", limit)
+	}
+}
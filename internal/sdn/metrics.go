@@ -0,0 +1,213 @@
+package sdn
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var registrationsRejectedDesc = prometheus.NewDesc(
+	"qumo_sdn_registrations_rejected_total",
+	"Relay registrations refused, by reason: invalid, or the graph limit they would exceed.",
+	[]string{"reason"}, nil,
+)
+
+var announceEntriesDesc = prometheus.NewDesc(
+	"qumo_sdn_announce_entries",
+	"Announce table entries by relay and first broadcast path segment.",
+	[]string{"relay", "path_prefix"}, nil,
+)
+
+// httpBodyBytes counts HTTP body sizes before ("raw") and after
+// ("encoded") compression, per direction.
+var httpBodyBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qumo",
+	Subsystem: "sdn",
+	Name:      "http_body_bytes_total",
+	Help:      "Compressed HTTP API bodies: raw and encoded bytes by direction.",
+}, []string{"direction", "stage"})
+
+// requestsShed counts API requests refused by the LoadShedder, by
+// priority class.
+var requestsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qumo",
+	Subsystem: "sdn",
+	Name:      "requests_shed_total",
+	Help:      "API requests refused under load, by priority class.",
+}, []string{"priority"})
+
+// requestsInFlight tracks the API requests the LoadShedder admitted and
+// that are being served, by priority class.
+var requestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "qumo",
+	Subsystem: "sdn",
+	Name:      "requests_in_flight",
+	Help:      "API requests being served under load shedding, by priority class.",
+}, []string{"priority"})
+
+// fleetRelays tracks the registered relays by health, as the
+// HealthMonitor last assessed them.
+var fleetRelays = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "qumo",
+	Subsystem: "sdn",
+	Name:      "fleet_relays",
+	Help:      "Registered relays by health (healthy, degraded, unreachable or unknown).",
+}, []string{"health"})
+
+// announceLookups counts announce lookups by whether any relay had
+// announced the path. Per-path counts are served at /stats/popular.
+var announceLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qumo",
+	Subsystem: "sdn",
+	Name:      "announce_lookups_total",
+	Help:      "Announce lookups by result (hit or miss).",
+}, []string{"result"})
+
+// announceRegisterDelay observes how long new announcements took from the
+// publisher's announce on a relay to the announce table, by the relay's
+// clock against the controller's.
+var announceRegisterDelay = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "qumo",
+	Subsystem: "sdn",
+	Name:      "announce_register_delay_seconds",
+	Help:      "Delay from a broadcast's announce on its relay to its announce table entry.",
+	Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+})
+
+// announceDiscovery observes, on the relays, how long announcements of
+// other relays took from the publisher's announce to their discovery in
+// the announce table: the end-to-end announce propagation latency.
+var announceDiscovery = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "qumo",
+	Subsystem: "sdn_client",
+	Name:      "announce_discovery_seconds",
+	Help:      "Delay from a broadcast's announce on another relay to its discovery by this relay.",
+	Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+})
+
+// observeDiscovery observes the discovery of e at now, if its relay said
+// when it was announced. Clock skew between relays may make the delay
+// negative; it counts as zero.
+func observeDiscovery(e AnnounceEntry, now time.Time) {
+	if !e.AnnouncedAt.IsZero() {
+		announceDiscovery.Observe(max(0, now.Sub(e.AnnouncedAt).Seconds()))
+	}
+}
+
+// announceCollector exports the announce table as a content inventory.
+type announceCollector struct {
+	table *announceTable
+}
+
+func (c announceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- announceEntriesDesc
+}
+
+func (c announceCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := make(map[[2]string]int)
+	for _, e := range c.table.AllEntries() {
+		counts[[2]string{e.Relay, pathPrefix(e.BroadcastPath)}]++
+	}
+	for key, n := range counts {
+		ch <- prometheus.MustNewConstMetric(announceEntriesDesc, prometheus.GaugeValue, float64(n), key[0], key[1])
+	}
+}
+
+// registrationCollector exports the topology's refused registrations.
+type registrationCollector struct {
+	topo *topology.Topology
+}
+
+func (c registrationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- registrationsRejectedDesc
+}
+
+func (c registrationCollector) Collect(ch chan<- prometheus.Metric) {
+	for reason, n := range c.topo.Rejections() {
+		ch <- prometheus.MustNewConstMetric(registrationsRejectedDesc, prometheus.CounterValue, float64(n), reason)
+	}
+}
+
+// RegisterClientMetrics registers the relay-side SDN client metrics of g
+// with reg, with the health of each of its controllers.
+func RegisterClientMetrics(reg prometheus.Registerer, g *Group) error {
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "qumo",
+			Subsystem: "sdn_client",
+			Name:      "queued_operations",
+			Help:      "Announce registrations and deregistrations waiting to reach the controllers.",
+		}, func() float64 {
+			return float64(g.QueuedOperations())
+		}),
+		announceDiscovery,
+	}
+	for i, c := range g.Clients() {
+		collectors = append(collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "qumo",
+			Subsystem:   "sdn_client",
+			Name:        "controller_up",
+			Help:        "Whether the last health check of the SDN controller succeeded.",
+			ConstLabels: prometheus.Labels{"controller": c.ControllerName()},
+		}, func() float64 {
+			if g.healthy(i) {
+				return 1
+			}
+			return 0
+		}))
+	}
+	for _, m := range collectors {
+		if err := reg.Register(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterMetrics registers the controller's Prometheus collectors with reg.
+func RegisterMetrics(reg prometheus.Registerer, announces *announceTable, topo *topology.Topology) error {
+	for _, c := range []prometheus.Collector{
+		announceCollector{table: announces},
+		registrationCollector{topo: topo},
+		httpBodyBytes,
+		announceLookups,
+		announceRegisterDelay,
+		requestsShed,
+		requestsInFlight,
+		fleetRelays,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// traceIDFromRequest returns the trace ID of r's W3C traceparent header,
+// or "" if it carries none or a malformed one.
+func traceIDFromRequest(r *http.Request) string {
+	// version-traceid-parentid-flags, e.g. 00-4bf9...4736-00f0...02b7-01
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 {
+		return ""
+	}
+	id := parts[1]
+	if _, err := hex.DecodeString(id); err != nil || strings.ToLower(id) != id || strings.Trim(id, "0") == "" {
+		return ""
+	}
+	return id
+}
+
+// observeWithTrace observes v on o, with traceID as an exemplar if it is
+// set. Exemplars are exported only to scrapers asking for OpenMetrics.
+func observeWithTrace(o prometheus.Observer, v float64, traceID string) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && traceID != "" {
+		eo.ObserveWithExemplar(v, prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	o.Observe(v)
+}
@@ -0,0 +1,95 @@
+package sdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// NodeDetail is everything the controller knows about one relay, served by
+// GET /relay/<name>/detail so a dashboard needs one request per node.
+type NodeDetail struct {
+	Relay string `json:"relay"`
+
+	// Node is the relay's place in the topology; nil once it was removed.
+	Node *topology.Node `json:"node,omitempty"`
+
+	// LastHeartbeat is when the relay last registered. HeartbeatAgeMs is
+	// measured at response time.
+	LastHeartbeat  *time.Time `json:"last_heartbeat,omitempty"`
+	HeartbeatAgeMs int64      `json:"heartbeat_age_ms,omitempty"`
+
+	Announces []AnnounceEntry `json:"announces"`
+
+	// Load is the relay's latest metric summary. LoadStale is set when it is
+	// older than the stats table TTL and no longer counts in aggregates.
+	Load      *RelayStatsEntry `json:"load,omitempty"`
+	LoadStale bool             `json:"load_stale,omitempty"`
+
+	Events []topology.NodeEvent `json:"events"`
+}
+
+// nodeDetail joins the state of relay name across the controller's tables,
+// listing the announcements that pass visible. It returns false if none of
+// them knows the relay.
+func nodeDetail(name string, topo *topology.Topology, announces *announceTable, stats *statsTable, visible func(AnnounceEntry) bool) (NodeDetail, bool) {
+	now := time.Now()
+	d := NodeDetail{
+		Relay:     name,
+		Announces: filterEntries(announces.RelayEntries(name), visible),
+		Events:    topo.NodeEvents(name),
+	}
+	if node, ok := topo.Node(name); ok {
+		d.Node = &node
+		if !node.LastSeen.IsZero() {
+			d.LastHeartbeat = &node.LastSeen
+			d.HeartbeatAgeMs = now.Sub(node.LastSeen).Milliseconds()
+		}
+	}
+	if load, ok := stats.Get(name); ok {
+		d.Load = &load
+		d.LoadStale = stats.TTL > 0 && now.Sub(load.ReceivedAt) > stats.TTL
+	}
+
+	known := d.Node != nil || d.Load != nil || len(d.Announces) > 0 || len(d.Events) > 0
+	if d.Announces == nil {
+		d.Announces = []AnnounceEntry{}
+	}
+	if d.Events == nil {
+		d.Events = []topology.NodeEvent{}
+	}
+	return d, known
+}
+
+// NodeDetailHandlerFunc returns an http.HandlerFunc serving the aggregated
+// view of one relay: its topology node, current announces, last heartbeat,
+// reported load and recent events.
+//
+//	GET /relay/<name>/detail
+func NodeDetailHandlerFunc(topo *topology.Topology, announces *announceTable, stats *statsTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/relay/"), "/detail")
+		if !ok || name == "" || strings.Contains(name, "/") {
+			jsonError(w, http.StatusBadRequest, "path must be /relay/<name>/detail")
+			return
+		}
+
+		d, known := nodeDetail(name, topo, announces, stats, visibleTo(r.Context()))
+		if !known {
+			jsonError(w, http.StatusNotFound, "relay not found: "+name)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(d)
+	}
+}
@@ -0,0 +1,91 @@
+package sdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+func TestNodeDetailHandlerFunc(t *testing.T) {
+	topo := &topology.Topology{}
+	topo.Register(topology.RelayInfo{Name: "relay-a", Region: "ap", Address: "https://a:4433", Neighbors: map[string]float64{"relay-b": 2}})
+	announces := NewAnnounceTable(0)
+	announces.Register("relay-a", "/live/b")
+	announces.Register("relay-a", "/live/a")
+	announces.Register("relay-b", "/live/c")
+	stats := NewStatsTable(time.Minute)
+	stats.Report("relay-a", RelayStats{Sessions: 4, EgressMbps: 3.5})
+
+	h := NodeDetailHandlerFunc(topo, announces, stats)
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/relay/relay-a/detail", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var d NodeDetail
+	if err := json.NewDecoder(rec.Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Node == nil || d.Node.Region != "ap" || len(d.Node.Edges) != 1 {
+		t.Errorf("unexpected node: %+v", d.Node)
+	}
+	if d.LastHeartbeat == nil {
+		t.Error("expected last_heartbeat")
+	}
+	if len(d.Announces) != 2 || d.Announces[0].BroadcastPath != "/live/a" || d.Announces[1].BroadcastPath != "/live/b" {
+		t.Errorf("expected relay-a's announces sorted by path, got %+v", d.Announces)
+	}
+	if d.Load == nil || d.Load.Sessions != 4 || d.LoadStale {
+		t.Errorf("unexpected load: %+v stale=%v", d.Load, d.LoadStale)
+	}
+	if len(d.Events) != 1 || d.Events[0].Type != topology.EventRegistered {
+		t.Errorf("expected a registered event, got %+v", d.Events)
+	}
+}
+
+func TestNodeDetailHandlerFunc_Removed(t *testing.T) {
+	topo := &topology.Topology{}
+	topo.Register(topology.RelayInfo{Name: "relay-a"})
+	topo.Deregister("relay-a", topology.ReasonAdmin)
+	h := NodeDetailHandlerFunc(topo, NewAnnounceTable(0), NewStatsTable(0))
+
+	// Known only through its events: still served, without a node
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/relay/relay-a/detail", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var d NodeDetail
+	if err := json.NewDecoder(rec.Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Node != nil || len(d.Events) != 2 || d.Announces == nil {
+		t.Errorf("unexpected detail: %+v", d)
+	}
+}
+
+func TestNodeDetailHandlerFunc_Errors(t *testing.T) {
+	h := NodeDetailHandlerFunc(&topology.Topology{}, NewAnnounceTable(0), NewStatsTable(0))
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/relay/unknown/detail", http.StatusNotFound},
+		{http.MethodGet, "/relay//detail", http.StatusBadRequest},
+		{http.MethodGet, "/relay/a/b/detail", http.StatusBadRequest},
+		{http.MethodPost, "/relay/a/detail", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, rec.Code)
+		}
+	}
+}
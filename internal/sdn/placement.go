@@ -0,0 +1,140 @@
+package sdn
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// Placement scoring weights. A candidate's score is the sum of a proximity
+// term and a load term; the lowest score wins.
+const (
+	// placementKmPerPoint converts great-circle distance into score points.
+	placementKmPerPoint = 100.0
+
+	// placementRegionMismatch is the proximity penalty applied when
+	// coordinates are unavailable and the regions differ (~5000 km).
+	placementRegionMismatch = 50.0
+
+	// placementSessionWeight is the load penalty per open session.
+	placementSessionWeight = 1.0
+)
+
+// errNoCandidates is returned when no registered relay can accept publishers.
+var errNoCandidates = errors.New("no relay with an address is registered")
+
+// PlacementRequest describes a publisher looking for an ingest relay.
+type PlacementRequest struct {
+	Region   string             `json:"region,omitempty"`
+	Location *topology.Location `json:"location,omitempty"`
+}
+
+// PlacementResult is the ingest relay selected for a publisher.
+type PlacementResult struct {
+	Relay      string   `json:"relay"`
+	Address    string   `json:"address"`
+	Region     string   `json:"region,omitempty"`
+	Score      float64  `json:"score"`
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+	Sessions   int      `json:"sessions"`
+	Candidates int      `json:"candidates"`
+}
+
+// Place selects the best ingest relay for req from the graph, combining
+// geographic proximity with the latest load reported in stats (may be nil).
+// Only nodes that registered an address and are not cordoned for
+// maintenance are eligible; nodes only planned in a seed are not.
+func Place(g *topology.Graph, stats *statsTable, req PlacementRequest) (PlacementResult, error) {
+	ids := make([]string, 0, len(g.Nodes))
+	for id, n := range g.Nodes {
+		if n.Address != "" && !n.Cordoned && n.Registered() {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return PlacementResult{}, errNoCandidates
+	}
+	sort.Strings(ids) // deterministic tie-breaking
+
+	var best PlacementResult
+	for i, id := range ids {
+		n := g.Nodes[id]
+
+		cand := PlacementResult{
+			Relay:      n.ID,
+			Address:    n.Address,
+			Region:     n.Region,
+			Candidates: len(ids),
+		}
+
+		switch {
+		case req.Location != nil && n.Location != nil:
+			d := haversineKm(*req.Location, *n.Location)
+			cand.DistanceKm = &d
+			cand.Score += d / placementKmPerPoint
+		case req.Region != "" && n.Region != req.Region:
+			cand.Score += placementRegionMismatch
+		}
+
+		if stats != nil {
+			if e, ok := stats.Get(n.ID); ok {
+				cand.Sessions = e.Sessions
+			}
+		}
+		cand.Score += float64(cand.Sessions) * placementSessionWeight
+
+		if i == 0 || cand.Score < best.Score {
+			best = cand
+		}
+	}
+	return best, nil
+}
+
+// haversineKm returns the great-circle distance between two points in km.
+func haversineKm(a, b topology.Location) float64 {
+	const earthRadiusKm = 6371.0
+	rad := math.Pi / 180
+
+	dLat := (b.Lat - a.Lat) * rad
+	dLon := (b.Lon - a.Lon) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.Lat*rad)*math.Cos(b.Lat*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// PlacementHandlerFunc returns an http.HandlerFunc that selects an ingest
+// relay for a publisher. Like EdgeHandlerFunc, it skips relays reported
+// unhealthy and those in an active maintenance window.
+//
+//	POST /placement  {"region": "...", "location": {"lat": .., "lon": ..}}
+func PlacementHandlerFunc(topo *topology.Topology, stats *statsTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req PlacementRequest
+		if err := topology.DecodeJSON(w, r, topology.MaxRequestBytes, &req); err != nil {
+			jsonError(w, topology.DecodeErrorStatus(err), "invalid JSON: "+err.Error())
+			return
+		}
+
+		g := topo.Snapshot()
+		dropUnavailable(g, topo.Unhealthy(), time.Now())
+		result, err := Place(g, stats, req)
+		if err != nil {
+			jsonError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+	}
+}
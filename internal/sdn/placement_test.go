@@ -0,0 +1,203 @@
+package sdn
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+func placementTopology() *topology.Topology {
+	topo := &topology.Topology{}
+	topo.Register(topology.RelayInfo{
+		Name:     "relay-tokyo",
+		Region:   "asia",
+		Address:  "https://tokyo:4433",
+		Location: &topology.Location{Lat: 35.68, Lon: 139.69},
+	})
+	topo.Register(topology.RelayInfo{
+		Name:     "relay-london",
+		Region:   "europe",
+		Address:  "https://london:4433",
+		Location: &topology.Location{Lat: 51.51, Lon: -0.13},
+	})
+	// Stub without an address is never a candidate.
+	topo.Register(topology.RelayInfo{Name: "relay-stub", Region: "asia"})
+	return topo
+}
+
+func TestPlace_PrefersNearestByLocation(t *testing.T) {
+	topo := placementTopology()
+
+	res, err := Place(topo.Snapshot(), nil, PlacementRequest{
+		Location: &topology.Location{Lat: 34.69, Lon: 135.50}, // Osaka
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Relay != "relay-tokyo" {
+		t.Errorf("expected relay-tokyo, got %s", res.Relay)
+	}
+	if res.DistanceKm == nil || *res.DistanceKm > 500 {
+		t.Errorf("expected distance under 500km, got %v", res.DistanceKm)
+	}
+	if res.Candidates != 2 {
+		t.Errorf("expected 2 candidates, got %d", res.Candidates)
+	}
+}
+
+func TestPlace_RegionFallback(t *testing.T) {
+	topo := placementTopology()
+
+	res, err := Place(topo.Snapshot(), nil, PlacementRequest{Region: "europe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Relay != "relay-london" {
+		t.Errorf("expected relay-london, got %s", res.Relay)
+	}
+}
+
+func TestPlace_LoadOutweighsProximity(t *testing.T) {
+	topo := placementTopology()
+	stats := NewStatsTable(0)
+	stats.Report("relay-london", RelayStats{Sessions: 500})
+
+	res, err := Place(topo.Snapshot(), stats, PlacementRequest{Region: "europe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Relay != "relay-tokyo" {
+		t.Errorf("expected overloaded london to lose, got %s", res.Relay)
+	}
+}
+
+func TestPlace_SkipsSeeded(t *testing.T) {
+	topo := placementTopology()
+	topo.ApplySeed(&topology.Seed{Nodes: []topology.SeedNode{{
+		ID:       "relay-osaka",
+		Region:   "asia",
+		Address:  "https://osaka:4433",
+		Location: &topology.Location{Lat: 34.69, Lon: 135.50},
+	}}})
+
+	res, err := Place(topo.Snapshot(), nil, PlacementRequest{
+		Location: &topology.Location{Lat: 34.69, Lon: 135.50},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Relay != "relay-tokyo" || res.Candidates != 2 {
+		t.Errorf("expected the planned relay to be skipped until it registers, got %+v", res)
+	}
+}
+
+func TestPlace_SkipsCordoned(t *testing.T) {
+	topo := placementTopology()
+	now := time.Now()
+	if err := topo.ScheduleMaintenance(topology.MaintenanceWindow{Relay: "relay-tokyo", Start: now, End: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Place(topo.Snapshot(), nil, PlacementRequest{Region: "asia"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Relay != "relay-london" || res.Candidates != 1 {
+		t.Errorf("expected the cordoned relay to be skipped, got %+v", res)
+	}
+}
+
+func TestPlace_NoCandidates(t *testing.T) {
+	topo := &topology.Topology{}
+	topo.Register(topology.RelayInfo{Name: "relay-a"})
+
+	if _, err := Place(topo.Snapshot(), nil, PlacementRequest{}); err == nil {
+		t.Error("expected error when no relay has an address")
+	}
+}
+
+func TestHaversineKm(t *testing.T) {
+	tokyo := topology.Location{Lat: 35.68, Lon: 139.69}
+	london := topology.Location{Lat: 51.51, Lon: -0.13}
+
+	d := haversineKm(tokyo, london)
+	if d < 9400 || d > 9700 {
+		t.Errorf("expected ~9560km Tokyo→London, got %.0f", d)
+	}
+	if haversineKm(tokyo, tokyo) != 0 {
+		t.Error("expected zero distance to self")
+	}
+}
+
+func TestPlacementHandlerFunc(t *testing.T) {
+	topo := placementTopology()
+	handler := PlacementHandlerFunc(topo, NewStatsTable(0))
+
+	body, _ := json.Marshal(PlacementRequest{Region: "asia"})
+	req := httptest.NewRequest(http.MethodPost, "/placement", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var res PlacementResult
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Relay != "relay-tokyo" || res.Address != "https://tokyo:4433" {
+		t.Errorf("unexpected placement: %+v", res)
+	}
+}
+
+func TestPlacementHandlerFunc_SkipsUnhealthy(t *testing.T) {
+	for _, health := range []topology.Health{topology.HealthUnreachable, topology.HealthDegraded} {
+		topo := placementTopology()
+		topo.SetHealth(map[string]topology.Health{"relay-tokyo": health})
+		handler := PlacementHandlerFunc(topo, nil)
+
+		body, _ := json.Marshal(PlacementRequest{Region: "asia"})
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/placement", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", health, rec.Code, rec.Body.String())
+		}
+		var res PlacementResult
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Relay != "relay-london" {
+			t.Errorf("%s ingest relay: expected relay-london, got %s", health, res.Relay)
+		}
+	}
+}
+
+func TestPlacementHandlerFunc_Errors(t *testing.T) {
+	handler := PlacementHandlerFunc(&topology.Topology{}, nil)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"bad method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid json", http.MethodPost, "nope", http.StatusBadRequest},
+		{"empty topology", http.MethodPost, "{}", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/placement", bytes.NewReader([]byte(tt.body)))
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
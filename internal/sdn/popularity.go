@@ -0,0 +1,114 @@
+package sdn
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Lookups are counted per broadcast path in one-minute buckets covering the
+// last hour, so popularity is available over sliding windows of 1 to 60
+// minutes. A window includes the current, partial minute.
+const (
+	popularityBucket  = time.Minute
+	popularityBuckets = 60
+
+	// MaxPopularityWindow is the longest window lookups are counted over.
+	MaxPopularityWindow = popularityBuckets * popularityBucket
+
+	// maxPopularPaths bounds the distinct paths counted per bucket, so
+	// lookups of arbitrary paths cannot grow the controller's memory. Paths
+	// first looked up after a bucket is full go uncounted for its minute.
+	maxPopularPaths = 10000
+)
+
+// PopularPath is a broadcast path's lookup count over a window.
+type PopularPath struct {
+	BroadcastPath string `json:"broadcast_path"`
+	Lookups       uint64 `json:"lookups"`
+	Relays        int    `json:"relays"` // relays announcing it now; 0 if none
+}
+
+// lookupCounter counts lookups per broadcast path.
+type lookupCounter struct {
+	mu      sync.Mutex
+	buckets [popularityBuckets]lookupBucket
+}
+
+// lookupBucket holds the counts of one minute.
+type lookupBucket struct {
+	start  time.Time
+	counts map[string]uint64
+}
+
+// record counts a lookup of broadcastPath at now.
+func (c *lookupCounter) record(broadcastPath string, now time.Time) {
+	start := now.Truncate(popularityBucket)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := &c.buckets[start.Unix()/int64(popularityBucket/time.Second)%popularityBuckets]
+	if !b.start.Equal(start) {
+		*b = lookupBucket{start: start, counts: make(map[string]uint64)}
+	}
+	if _, ok := b.counts[broadcastPath]; ok || len(b.counts) < maxPopularPaths {
+		b.counts[broadcastPath]++
+	}
+}
+
+// total returns the lookups per path over the window ending at now.
+func (c *lookupCounter) total(window time.Duration, now time.Time) map[string]uint64 {
+	oldest := now.Truncate(popularityBucket).Add(popularityBucket - window)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	totals := make(map[string]uint64)
+	for _, b := range c.buckets {
+		if b.start.Before(oldest) || b.start.After(now) {
+			continue
+		}
+		for bp, n := range b.counts {
+			totals[bp] += n
+		}
+	}
+	return totals
+}
+
+// Popular returns the n broadcast paths looked up most over the window
+// ending now, most looked up first. window is clamped to
+// [1m, MaxPopularityWindow]; n <= 0 returns them all. Paths whose
+// announcements visible all rejects are left out, and Relays counts the
+// ones it passes.
+func (at *announceTable) Popular(window time.Duration, n int, visible func(AnnounceEntry) bool) []PopularPath {
+	window = min(max(window, popularityBucket), MaxPopularityWindow)
+
+	totals := at.lookups.total(window, time.Now())
+	popular := make([]PopularPath, 0, len(totals))
+	for bp, count := range totals {
+		entries := at.lookup(bp)
+		shown := filterEntries(entries, visible)
+		if len(entries) > 0 && len(shown) == 0 {
+			continue // private to other relays
+		}
+		popular = append(popular, PopularPath{BroadcastPath: bp, Lookups: count, Relays: len(shown)})
+	}
+	sort.Slice(popular, func(i, j int) bool {
+		if popular[i].Lookups != popular[j].Lookups {
+			return popular[i].Lookups > popular[j].Lookups
+		}
+		return popular[i].BroadcastPath < popular[j].BroadcastPath
+	})
+	if n > 0 && len(popular) > n {
+		popular = popular[:n]
+	}
+	return popular
+}
+
+// LookupCounts returns the lookups of every broadcast path looked up over
+// the window ending now, clamped like Popular's.
+func (at *announceTable) LookupCounts(window time.Duration) map[string]uint64 {
+	window = min(max(window, popularityBucket), MaxPopularityWindow)
+	return at.lookups.total(window, time.Now())
+}
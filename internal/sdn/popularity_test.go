@@ -0,0 +1,120 @@
+package sdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLookupCounter_Windows(t *testing.T) {
+	var c lookupCounter
+	now := time.Date(2026, 1, 1, 12, 30, 20, 0, time.UTC)
+
+	c.record("/old", now.Add(-61*time.Minute))
+	c.record("/a", now.Add(-30*time.Minute))
+	c.record("/a", now.Add(-4*time.Minute))
+	c.record("/b", now.Add(-4*time.Minute))
+	c.record("/b", now.Add(-time.Minute)) // reuses the bucket of /old, an hour on
+	c.record("/b", now)
+	c.record("/b", now)
+
+	tests := []struct {
+		window time.Duration
+		want   map[string]uint64
+	}{
+		{time.Minute, map[string]uint64{"/b": 2}},
+		{5 * time.Minute, map[string]uint64{"/a": 1, "/b": 4}},
+		{time.Hour, map[string]uint64{"/a": 2, "/b": 4}},
+	}
+	for _, tt := range tests {
+		got := c.total(tt.window, now)
+		if len(got) != len(tt.want) {
+			t.Errorf("window %s: expected %v, got %v", tt.window, tt.want, got)
+			continue
+		}
+		for bp, n := range tt.want {
+			if got[bp] != n {
+				t.Errorf("window %s: expected %s=%d, got %v", tt.window, bp, n, got)
+			}
+		}
+	}
+}
+
+func TestLookupCounter_BoundsPaths(t *testing.T) {
+	var c lookupCounter
+	now := time.Now()
+	for i := range maxPopularPaths + 10 {
+		c.record("/p"+strconv.Itoa(i), now)
+	}
+	c.record("/p0", now) // already counted paths keep counting
+
+	got := c.total(time.Minute, now)
+	if len(got) != maxPopularPaths || got["/p0"] != 2 {
+		t.Errorf("expected %d paths with /p0 counted twice, got %d paths, /p0=%d", maxPopularPaths, len(got), got["/p0"])
+	}
+}
+
+func TestAnnounceTable_Popular(t *testing.T) {
+	at := NewAnnounceTable(0)
+	at.Register("relay-a", "/live/a")
+	at.Register("relay-b", "/live/a")
+	for _, bp := range []string{"/live/a", "/live/b", "/live/a", "/live/c", "/live/a", "/live/b"} {
+		at.Lookup(bp)
+	}
+
+	popular := at.Popular(time.Hour, 2, allVisible)
+	if len(popular) != 2 {
+		t.Fatalf("expected the top 2, got %+v", popular)
+	}
+	if popular[0] != (PopularPath{BroadcastPath: "/live/a", Lookups: 3, Relays: 2}) {
+		t.Errorf("expected /live/a first with 3 lookups and 2 relays, got %+v", popular[0])
+	}
+	if popular[1] != (PopularPath{BroadcastPath: "/live/b", Lookups: 2}) {
+		t.Errorf("expected unannounced /live/b second, got %+v", popular[1])
+	}
+	if n := len(at.Popular(time.Hour, 0, allVisible)); n != 3 {
+		t.Errorf("expected all 3 paths without a limit, got %d", n)
+	}
+}
+
+func TestPopularHandlerFunc(t *testing.T) {
+	at := NewAnnounceTable(0)
+	at.Lookup("/live/a")
+	at.Lookup("/live/a")
+	at.Lookup("/live/b")
+	handler := PopularHandlerFunc(at)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/stats/popular?window=5m&n=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Window string        `json:"window"`
+		Paths  []PopularPath `json:"paths"`
+		Count  int           `json:"count"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Window != "5m0s" || resp.Count != 1 || resp.Paths[0].BroadcastPath != "/live/a" || resp.Paths[0].Lookups != 2 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	for _, query := range []string{"window=30s", "window=2h", "window=soon", "n=0", "n=x"} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/stats/popular?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/stats/popular", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
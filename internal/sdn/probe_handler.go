@@ -0,0 +1,108 @@
+package sdn
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// ProbeTasksHandlerFunc returns an http.HandlerFunc that hands out probe
+// tasks to relays.
+//
+//	GET /probes/<relay>  — probes <relay> should run now
+func ProbeTasksHandlerFunc(table *probeTable, topo *topology.Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, "/probes/")
+		if name == "" || name == r.URL.Path || strings.Contains(name, "/") {
+			jsonError(w, http.StatusBadRequest, "path must be /probes/<relay>")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"tasks": table.Tasks(name, topo.Snapshot()),
+		})
+	}
+}
+
+// ProbeResultsHandlerFunc returns an http.HandlerFunc that accepts probe
+// results and feeds the resulting cost back into the topology. Since the
+// results set edge costs, only the relay that ran a probe may report it:
+// the request must carry its identity (see IdentifyRelays).
+//
+//	POST /probes/results
+func ProbeResultsHandlerFunc(table *probeTable, topo *topology.Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, ok := RelayIdentityFromContext(r.Context())
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="qumo-relay"`)
+			jsonError(w, http.StatusUnauthorized, "probe results require a relay identity")
+			return
+		}
+
+		var res ProbeResult
+		if err := topology.DecodeJSON(w, r, topology.MaxRequestBytes, &res); err != nil {
+			jsonError(w, topology.DecodeErrorStatus(err), "invalid JSON: "+err.Error())
+			return
+		}
+		if res.From != id.Relay {
+			jsonError(w, http.StatusForbidden, "relay "+id.Relay+" cannot report probes of "+res.From)
+			return
+		}
+
+		st, ok := table.Record(res)
+		if !ok {
+			jsonError(w, http.StatusNotFound, "unknown probe task: "+res.ID)
+			return
+		}
+
+		if !topo.SetMeasuredCost(st.From, st.To, st.Cost) {
+			slog.Debug("probe result for missing edge", "from", st.From, "to", st.To)
+		} else {
+			// Inputs for a configured cost model, which takes precedence
+			topo.SetEdgeAttributes(st.From, st.To, func(a *topology.EdgeAttributes) {
+				a.RTTMs = st.AvgLatencyMs
+				a.Loss = st.AvgLoss
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(st)
+	}
+}
+
+// ProbeReportHandlerFunc returns an http.HandlerFunc that serves the
+// per-edge probe statistics.
+//
+//	GET /stats/probes
+func ProbeReportHandlerFunc(table *probeTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := table.Report()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"edges": report,
+			"count": len(report),
+		})
+	}
+}
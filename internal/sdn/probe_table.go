@@ -0,0 +1,217 @@
+package sdn
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// ProbePathPrefix is the broadcast path prefix under which every relay
+// publishes its synthetic probe broadcast ("/.qumo/probe/<relay>").
+const ProbePathPrefix = "/.qumo/probe/"
+
+// probeFailureCost is the edge cost assigned when a probe delivers nothing.
+const probeFailureCost = 10000
+
+// probeEWMAWeight is the weight of the newest sample in the moving averages.
+const probeEWMAWeight = 0.3
+
+// ProbeTask asks a relay to subscribe to a neighbor's probe broadcast.
+// Data flows To → From, which is the direction a fetch over the edge
+// From → To carries media.
+type ProbeTask struct {
+	ID      string `json:"id"`
+	From    string `json:"from"`    // probing (subscribing) relay
+	To      string `json:"to"`      // probed (publishing) relay
+	Address string `json:"address"` // MoQT endpoint of To
+	Path    string `json:"path"`    // broadcast path of To's probe
+}
+
+// ProbeResult is what a relay reports after running a ProbeTask.
+type ProbeResult struct {
+	ID        string  `json:"id"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	LatencyMs float64 `json:"latency_ms"` // subscribe → first frame
+	Sent      int     `json:"sent"`       // frames the probed relay is known to have sent
+	Received  int     `json:"received"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Loss returns the fraction of probe frames that were not delivered.
+func (r ProbeResult) Loss() float64 {
+	if r.Sent <= 0 {
+		return 1
+	}
+	if r.Received >= r.Sent {
+		return 0
+	}
+	return 1 - float64(r.Received)/float64(r.Sent)
+}
+
+// ProbeStats aggregates the probe results of one edge.
+type ProbeStats struct {
+	From         string      `json:"from"`
+	To           string      `json:"to"`
+	Samples      int         `json:"samples"`
+	Failures     int         `json:"failures"`
+	AvgLatencyMs float64     `json:"avg_latency_ms"` // moving average of successful probes
+	AvgLoss      float64     `json:"avg_loss"`       // moving average, 0..1
+	Cost         float64     `json:"cost"`           // edge cost fed back to the topology
+	Last         ProbeResult `json:"last"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// probeTable schedules probes between neighboring relays and aggregates
+// their results. Relays pull tasks and push results; the controller never
+// contacts relays (SDN model).
+type probeTable struct {
+	// Interval is the minimum time between two probes of the same edge.
+	Interval time.Duration
+
+	mu      sync.Mutex
+	seq     uint64
+	issued  map[[2]string]time.Time // edge → last task issued
+	pending map[string]ProbeTask    // task id → task
+	stats   map[[2]string]*ProbeStats
+}
+
+// NewProbeTable creates a probe table that probes each edge at most once
+// per interval.
+func NewProbeTable(interval time.Duration) *probeTable {
+	return &probeTable{
+		Interval: interval,
+		issued:   make(map[[2]string]time.Time),
+		pending:  make(map[string]ProbeTask),
+		stats:    make(map[[2]string]*ProbeStats),
+	}
+}
+
+// Tasks returns the probes relay should run now: one per outgoing edge in g
+// whose target has an address and has not been probed within Interval.
+func (p *probeTable) Tasks(relay string, g *topology.Graph) []ProbeTask {
+	node, ok := g.Nodes[relay]
+	if !ok {
+		return []ProbeTask{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	tasks := []ProbeTask{}
+	for _, e := range node.Edges {
+		target, ok := g.Nodes[e.To]
+		if !ok || target.Address == "" {
+			continue
+		}
+		key := [2]string{relay, e.To}
+		if last, ok := p.issued[key]; ok && now.Sub(last) < p.Interval {
+			continue
+		}
+
+		p.seq++
+		task := ProbeTask{
+			ID:      fmt.Sprintf("%d", p.seq),
+			From:    relay,
+			To:      e.To,
+			Address: target.Address,
+			Path:    ProbePathPrefix + e.To,
+		}
+		p.issued[key] = now
+		p.pending[task.ID] = task
+		tasks = append(tasks, task)
+	}
+
+	// Forget tasks that were never reported.
+	for id, t := range p.pending {
+		if now.Sub(p.issued[[2]string{t.From, t.To}]) > 2*p.Interval {
+			delete(p.pending, id)
+		}
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].To < tasks[j].To })
+	return tasks
+}
+
+// Record stores the result of a pending task and returns the updated edge
+// statistics. It returns false if the task is unknown or does not match.
+func (p *probeTable) Record(res ProbeResult) (ProbeStats, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	task, ok := p.pending[res.ID]
+	if !ok || task.From != res.From || task.To != res.To {
+		return ProbeStats{}, false
+	}
+	delete(p.pending, res.ID)
+
+	key := [2]string{res.From, res.To}
+	st, ok := p.stats[key]
+	if !ok {
+		st = &ProbeStats{From: res.From, To: res.To}
+		p.stats[key] = st
+	}
+
+	failed := res.Error != "" || res.Received == 0
+	loss := res.Loss()
+	if failed {
+		loss = 1
+	}
+
+	if st.Samples == 0 {
+		st.AvgLoss = loss
+		if !failed {
+			st.AvgLatencyMs = res.LatencyMs
+		}
+	} else {
+		st.AvgLoss += probeEWMAWeight * (loss - st.AvgLoss)
+		if !failed {
+			if st.AvgLatencyMs == 0 {
+				st.AvgLatencyMs = res.LatencyMs
+			} else {
+				st.AvgLatencyMs += probeEWMAWeight * (res.LatencyMs - st.AvgLatencyMs)
+			}
+		}
+	}
+	st.Samples++
+	if failed {
+		st.Failures++
+	}
+	st.Last = res
+	st.UpdatedAt = time.Now()
+	st.Cost = probeCost(st.AvgLatencyMs, st.AvgLoss)
+
+	return *st, true
+}
+
+// probeCost turns latency and loss into an edge cost in latency units.
+// Loss inflates the cost tenfold per unit; an edge with no successful
+// probe gets probeFailureCost.
+func probeCost(latencyMs, loss float64) float64 {
+	if latencyMs <= 0 || loss >= 1 {
+		return probeFailureCost
+	}
+	return min(max(latencyMs, 1)*(1+10*loss), probeFailureCost)
+}
+
+// Report returns the statistics of every probed edge, sorted by From, To.
+func (p *probeTable) Report() []ProbeStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := make([]ProbeStats, 0, len(p.stats))
+	for _, st := range p.stats {
+		report = append(report, *st)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].From != report[j].From {
+			return report[i].From < report[j].From
+		}
+		return report[i].To < report[j].To
+	})
+	return report
+}
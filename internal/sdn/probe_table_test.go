@@ -0,0 +1,190 @@
+package sdn
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+func probeTopology() *topology.Topology {
+	topo := &topology.Topology{}
+	topo.Register(topology.RelayInfo{Name: "relay-a", Address: "https://a:4433", Neighbors: map[string]float64{"relay-b": 100, "relay-c": 100}})
+	topo.Register(topology.RelayInfo{Name: "relay-b", Address: "https://b:4433", Neighbors: map[string]float64{"relay-a": 100}})
+	// relay-c is an unregistered stub without an address
+	return topo
+}
+
+func TestProbeTable_Tasks(t *testing.T) {
+	topo := probeTopology()
+	pt := NewProbeTable(time.Hour)
+
+	tasks := pt.Tasks("relay-a", topo.Snapshot())
+	if len(tasks) != 1 {
+		t.Fatalf("expected 1 task (relay-c has no address), got %d", len(tasks))
+	}
+	task := tasks[0]
+	if task.From != "relay-a" || task.To != "relay-b" || task.Address != "https://b:4433" {
+		t.Errorf("unexpected task: %+v", task)
+	}
+	if task.Path != ProbePathPrefix+"relay-b" {
+		t.Errorf("expected probe path of relay-b, got %q", task.Path)
+	}
+
+	if again := pt.Tasks("relay-a", topo.Snapshot()); len(again) != 0 {
+		t.Errorf("expected no tasks within the interval, got %d", len(again))
+	}
+	if unknown := pt.Tasks("relay-x", topo.Snapshot()); len(unknown) != 0 {
+		t.Errorf("expected no tasks for unknown relay, got %d", len(unknown))
+	}
+}
+
+func TestProbeTable_Record(t *testing.T) {
+	topo := probeTopology()
+	pt := NewProbeTable(0)
+
+	task := pt.Tasks("relay-a", topo.Snapshot())[0]
+
+	if _, ok := pt.Record(ProbeResult{ID: "999", From: "relay-a", To: "relay-b"}); ok {
+		t.Error("expected unknown task to be rejected")
+	}
+	if _, ok := pt.Record(ProbeResult{ID: task.ID, From: "relay-b", To: "relay-a"}); ok {
+		t.Error("expected mismatched edge to be rejected")
+	}
+
+	st, ok := pt.Record(ProbeResult{ID: task.ID, From: "relay-a", To: "relay-b", LatencyMs: 20, Sent: 10, Received: 10})
+	if !ok {
+		t.Fatal("expected result to be recorded")
+	}
+	if st.AvgLatencyMs != 20 || st.AvgLoss != 0 || st.Cost != 20 {
+		t.Errorf("unexpected stats after first sample: %+v", st)
+	}
+	if _, ok := pt.Record(ProbeResult{ID: task.ID, From: "relay-a", To: "relay-b"}); ok {
+		t.Error("expected a task to be recorded only once")
+	}
+
+	// A failed probe raises loss and cost but keeps the latency average.
+	task = pt.Tasks("relay-a", topo.Snapshot())[0]
+	st, _ = pt.Record(ProbeResult{ID: task.ID, From: "relay-a", To: "relay-b", Sent: 10, Error: "dial: timeout"})
+	if st.Samples != 2 || st.Failures != 1 {
+		t.Errorf("expected 2 samples and 1 failure, got %+v", st)
+	}
+	if st.AvgLatencyMs != 20 {
+		t.Errorf("expected latency average unchanged by failure, got %v", st.AvgLatencyMs)
+	}
+	if st.AvgLoss <= 0 || st.Cost <= 20 {
+		t.Errorf("expected loss to inflate cost, got loss=%v cost=%v", st.AvgLoss, st.Cost)
+	}
+
+	report := pt.Report()
+	if len(report) != 1 || report[0].From != "relay-a" || report[0].To != "relay-b" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestProbeCost(t *testing.T) {
+	tests := []struct {
+		latency, loss, want float64
+	}{
+		{20, 0, 20},
+		{20, 0.1, 40},
+		{0.2, 0, 1},
+		{0, 0, probeFailureCost},
+		{20, 1, probeFailureCost},
+	}
+	for _, tt := range tests {
+		if got := probeCost(tt.latency, tt.loss); got != tt.want {
+			t.Errorf("probeCost(%v, %v) = %v, want %v", tt.latency, tt.loss, got, tt.want)
+		}
+	}
+}
+
+func TestProbeHandlers_FeedEdgeCost(t *testing.T) {
+	topo := probeTopology()
+	pt := NewProbeTable(0)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/probes/", ProbeTasksHandlerFunc(pt, topo))
+	mux.HandleFunc("/probes/results", ProbeResultsHandlerFunc(pt, topo))
+	mux.HandleFunc("/stats/probes", ProbeReportHandlerFunc(pt))
+	srv := httptest.NewServer(IdentifyRelays([]RelayIdentity{
+		{Relay: "relay-a", Token: "token-a"},
+		{Relay: "relay-b", Token: "token-b"},
+	}, mux))
+	defer srv.Close()
+
+	post := func(token string, body []byte) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/probes/results", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	resp, err := http.Get(srv.URL + "/probes/relay-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Tasks []ProbeTask `json:"tasks"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if len(body.Tasks) != 1 {
+		t.Fatalf("expected 1 task, got %d", len(body.Tasks))
+	}
+
+	res, _ := json.Marshal(ProbeResult{ID: body.Tasks[0].ID, From: "relay-a", To: "relay-b", LatencyMs: 7, Sent: 10, Received: 10})
+	if code := post("", res); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a relay identity, got %d", code)
+	}
+	if code := post("token-b", res); code != http.StatusForbidden {
+		t.Errorf("expected 403 for another relay's probe, got %d", code)
+	}
+	if code := post("token-a", res); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	route, err := topo.Route("relay-a", "relay-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.Cost != 7 {
+		t.Errorf("expected measured cost 7 on relay-a → relay-b, got %v", route.Cost)
+	}
+
+	// The measurement survives the relay's next heartbeat.
+	topo.Register(topology.RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 100}})
+	if route, _ = topo.Route("relay-a", "relay-b"); route.Cost != 7 {
+		t.Errorf("expected measured cost to survive re-registration, got %v", route.Cost)
+	}
+
+	resp, err = http.Get(srv.URL + "/stats/probes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Edges []ProbeStats `json:"edges"`
+		Count int          `json:"count"`
+	}
+	json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if report.Count != 1 || report.Edges[0].AvgLatencyMs != 7 {
+		t.Errorf("unexpected probe report: %+v", report)
+	}
+
+	if code := post("token-a", res); code != http.StatusNotFound {
+		t.Errorf("expected 404 for already recorded task, got %d", code)
+	}
+}
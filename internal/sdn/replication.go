@@ -0,0 +1,278 @@
+package sdn
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// ReplicationPolicy keeps hot broadcasts available on several relays so a
+// relay failure or a flash crowd does not depend on a single copy.
+type ReplicationPolicy struct {
+	// Factor is the minimum number of relays that should hold each hot
+	// broadcast. Zero only reports coverage.
+	Factor int
+
+	// MinSubscribers is the cluster-wide subscriber count at which a
+	// broadcast becomes hot. Zero makes every announced broadcast hot.
+	MinSubscribers int
+
+	// MinLookups also makes a broadcast hot once it is looked up that many
+	// times over ReplicationLookupWindow, so trending content is replicated
+	// before its subscribers arrive. Zero disables it.
+	MinLookups int
+
+	// Tracks are the track names relays subscribe to when prefetching.
+	Tracks []string
+}
+
+// ReplicationLookupWindow is the window of ReplicationPolicy.MinLookups.
+const ReplicationLookupWindow = 5 * time.Minute
+
+// PrefetchTask asks a relay to pull a broadcast from its source before any
+// subscriber asks for it.
+type PrefetchTask struct {
+	Path   string   `json:"path"`
+	Source string   `json:"source"` // a relay announcing Path
+	Tracks []string `json:"tracks"`
+}
+
+// Coverage describes which relays hold a broadcast.
+type Coverage struct {
+	Path        string   `json:"path"`
+	Subscribers int      `json:"subscribers"` // cluster-wide
+	Lookups     uint64   `json:"lookups"`     // over ReplicationLookupWindow
+	Hot         bool     `json:"hot"`
+	Sources     []string `json:"sources"`               // announcing relays
+	Serving     []string `json:"serving,omitempty"`     // relays with subscribers
+	Prefetching []string `json:"prefetching,omitempty"` // relays told to prefetch
+	Coverage    int      `json:"coverage"`              // distinct relays above
+	Target      int      `json:"target"`                // Factor when hot, else 0
+	Satisfied   bool     `json:"satisfied"`
+
+	announces []AnnounceEntry // of Sources, in the same order
+}
+
+// visibleTo returns c with only the sources that pass visible, and false
+// if none does.
+func (c Coverage) visibleTo(visible func(AnnounceEntry) bool) (Coverage, bool) {
+	c.announces = filterEntries(c.announces, visible)
+	c.Sources = nil
+	for _, e := range c.announces {
+		c.Sources = append(c.Sources, e.Relay)
+	}
+	return c, len(c.announces) > 0
+}
+
+// replicationTable assigns prefetches so each hot broadcast reaches the
+// policy's replication factor. Like probes, relays pull their tasks; the
+// controller never contacts relays.
+type replicationTable struct {
+	Policy ReplicationPolicy
+
+	// Tenants maps relays to their tenant, as their identities do, so
+	// private broadcasts are only assigned to the relays they allow.
+	Tenants map[string]string
+
+	announces *announceTable
+	stats     *statsTable
+	topo      *topology.Topology
+
+	mu       sync.Mutex
+	assigned map[string]map[string]time.Time // path → relay → assigned at
+}
+
+// NewReplicationTable creates a replication table enforcing policy over the
+// broadcasts in announces, with hotness and holders taken from stats and
+// candidate relays from topo.
+func NewReplicationTable(policy ReplicationPolicy, announces *announceTable, stats *statsTable, topo *topology.Topology) *replicationTable {
+	return &replicationTable{
+		Policy:    policy,
+		announces: announces,
+		stats:     stats,
+		topo:      topo,
+		assigned:  make(map[string]map[string]time.Time),
+	}
+}
+
+// Plan recomputes prefetch assignments and returns the coverage of every
+// announced broadcast, sorted by path. Assignments are kept while their
+// broadcast stays hot and both the relay and a source stay alive and the
+// relay is neither cordoned for maintenance nor unhealthy; new ones go to
+// the healthy relays in the fewest covered regions first, then the least
+// loaded, among those a source's visibility allows. Prefetches of a
+// cordoned or unhealthy relay thereby migrate to other relays.
+func (rt *replicationTable) Plan() []Coverage {
+	now := time.Now()
+	g := rt.topo.Snapshot()
+	unhealthy := rt.topo.Unhealthy()
+
+	sources := make(map[string][]AnnounceEntry)
+	for _, e := range rt.announces.AllEntries() {
+		if !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt) {
+			continue
+		}
+		if strings.HasPrefix(e.BroadcastPath, ProbePathPrefix) {
+			continue
+		}
+		sources[e.BroadcastPath] = append(sources[e.BroadcastPath], e)
+	}
+
+	serving := make(map[string][]string)
+	subscribers := make(map[string]int)
+	sessions := make(map[string]int)
+	for _, r := range rt.stats.fresh() {
+		sessions[r.Relay] = r.Sessions
+		for bp, n := range r.Subscribers {
+			subscribers[bp] += n
+			if n > 0 {
+				serving[bp] = append(serving[bp], r.Relay)
+			}
+		}
+	}
+
+	lookups := rt.announces.LookupCounts(ReplicationLookupWindow)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for bp := range rt.assigned {
+		if _, ok := sources[bp]; !ok {
+			delete(rt.assigned, bp)
+		}
+	}
+
+	coverage := make([]Coverage, 0, len(sources))
+	for bp, srcs := range sources {
+		sort.Slice(srcs, func(i, j int) bool { return srcs[i].Relay < srcs[j].Relay })
+		c := Coverage{
+			Path:        bp,
+			Subscribers: subscribers[bp],
+			Lookups:     lookups[bp],
+			Serving:     serving[bp],
+			announces:   srcs,
+		}
+		for _, e := range srcs {
+			c.Sources = append(c.Sources, e.Relay)
+		}
+		trending := rt.Policy.MinLookups > 0 && c.Lookups >= uint64(rt.Policy.MinLookups)
+		c.Hot = rt.Policy.Factor > 0 && (c.Subscribers >= rt.Policy.MinSubscribers || trending)
+
+		holders := make(map[string]bool)
+		for _, r := range c.Sources {
+			holders[r] = true
+		}
+		for _, r := range serving[bp] {
+			holders[r] = true
+		}
+
+		assigned := rt.assigned[bp]
+		if !c.Hot {
+			delete(rt.assigned, bp)
+			assigned = nil
+		}
+		for r := range assigned {
+			if n, alive := g.Nodes[r]; !alive || n.Cordoned || unhealthy[r] != "" || holders[r] {
+				delete(assigned, r) // gone, in maintenance, unhealthy, or holds it on its own now
+			}
+		}
+
+		if c.Hot && len(holders)+len(assigned) < rt.Policy.Factor {
+			if assigned == nil {
+				assigned = make(map[string]time.Time)
+				rt.assigned[bp] = assigned
+			}
+			for _, r := range replicaCandidates(g, unhealthy, sessions, holders, assigned) {
+				if len(holders)+len(assigned) >= rt.Policy.Factor {
+					break
+				}
+				if _, ok := rt.source(c, r); ok {
+					assigned[r] = now
+				}
+			}
+		}
+
+		for r := range assigned {
+			c.Prefetching = append(c.Prefetching, r)
+		}
+		c.Coverage = len(holders) + len(assigned)
+		if c.Hot {
+			c.Target = rt.Policy.Factor
+		}
+		c.Satisfied = c.Coverage >= c.Target
+
+		sort.Strings(c.Serving)
+		sort.Strings(c.Prefetching)
+		coverage = append(coverage, c)
+	}
+
+	sort.Slice(coverage, func(i, j int) bool { return coverage[i].Path < coverage[j].Path })
+	return coverage
+}
+
+// replicaCandidates orders the relays in g that could take another copy:
+// those with an address, neither cordoned nor unhealthy, that neither hold
+// nor were assigned the broadcast, relays in regions without a copy first,
+// then by sessions and name.
+func replicaCandidates(g *topology.Graph, unhealthy map[string]topology.Health, sessions map[string]int, holders map[string]bool, assigned map[string]time.Time) []string {
+	covered := make(map[string]bool)
+	var ids []string
+	for id, n := range g.Nodes {
+		if _, ok := assigned[id]; ok || holders[id] {
+			covered[n.Region] = true
+		} else if n.Address != "" && !n.Cordoned && unhealthy[id] == "" {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := g.Nodes[ids[i]], g.Nodes[ids[j]]
+		if ca, cb := covered[a.Region], covered[b.Region]; ca != cb {
+			return !ca
+		}
+		if sessions[a.ID] != sessions[b.ID] {
+			return sessions[a.ID] < sessions[b.ID]
+		}
+		return a.ID < b.ID
+	})
+	return ids
+}
+
+// source returns the first source of c whose announcement relay may see.
+func (rt *replicationTable) source(c Coverage, relay string) (string, bool) {
+	for _, e := range c.announces {
+		if !e.Metadata.Private() || e.Metadata.Visibility.AllowsRelay(relay, rt.Tenants[relay]) {
+			return e.Relay, true
+		}
+	}
+	return "", false
+}
+
+// Tasks replans and returns the prefetches assigned to relay whose source
+// announcement passes visible.
+func (rt *replicationTable) Tasks(relay string, visible func(AnnounceEntry) bool) []PrefetchTask {
+	coverage := rt.Plan()
+
+	tasks := []PrefetchTask{}
+	for _, c := range coverage {
+		if !slices.Contains(c.Prefetching, relay) {
+			continue
+		}
+		c, ok := c.visibleTo(visible)
+		if !ok {
+			continue
+		}
+		if source, ok := rt.source(c, relay); ok {
+			tasks = append(tasks, PrefetchTask{
+				Path:   c.Path,
+				Source: source,
+				Tracks: rt.Policy.Tracks,
+			})
+		}
+	}
+	return tasks
+}
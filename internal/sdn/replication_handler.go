@@ -0,0 +1,73 @@
+package sdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// CoverageHandlerFunc returns an http.HandlerFunc that reports how many
+// relays hold each announced broadcast against the replication policy.
+// Private broadcasts are listed only to the relays they allow.
+//
+//	GET /announce/coverage
+//	GET /announce/coverage?unsatisfied=true  — only hot broadcasts below target
+func CoverageHandlerFunc(table *replicationTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		unsatisfied := r.URL.Query().Get("unsatisfied") == "true"
+		visible := visibleTo(r.Context())
+		coverage := []Coverage{}
+		for _, c := range table.Plan() {
+			if c, ok := c.visibleTo(visible); ok && (!unsatisfied || !c.Satisfied) {
+				coverage = append(coverage, c)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"factor":          table.Policy.Factor,
+			"min_subscribers": table.Policy.MinSubscribers,
+			"paths":           coverage,
+			"count":           len(coverage),
+		})
+	}
+}
+
+// PrefetchTasksHandlerFunc returns an http.HandlerFunc that hands out
+// prefetch tasks to relays.
+//
+//	GET /replication/<relay>  — broadcasts <relay> should prefetch
+//
+// While <relay> is in a maintenance window the response also carries the
+// window, telling the relay to release its prefetches; its tasks have
+// already been reassigned.
+func PrefetchTasksHandlerFunc(table *replicationTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, "/replication/")
+		if name == "" || name == r.URL.Path || strings.Contains(name, "/") {
+			jsonError(w, http.StatusBadRequest, "path must be /replication/<relay>")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		resp := map[string]any{
+			"tasks": table.Tasks(name, visibleTo(r.Context())),
+		}
+		if mw, ok := table.topo.ActiveMaintenance(name); ok {
+			resp["maintenance"] = mw
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
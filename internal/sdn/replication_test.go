@@ -0,0 +1,230 @@
+package sdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// replicationFixture announces /live on relay-a (asia) with subscribers on
+// relay-a and relay-b (asia); relay-c and relay-d are idle europe relays,
+// relay-d the busier one.
+func replicationFixture(policy ReplicationPolicy) (*replicationTable, *statsTable) {
+	topo := &topology.Topology{}
+	for _, r := range []struct{ name, region string }{
+		{"relay-a", "asia"}, {"relay-b", "asia"}, {"relay-c", "europe"}, {"relay-d", "europe"},
+	} {
+		topo.Register(topology.RelayInfo{Name: r.name, Region: r.region, Address: "https://" + r.name + ":4433"})
+	}
+
+	at := NewAnnounceTable(time.Hour)
+	at.Register("relay-a", "/live")
+	at.Register("relay-a", ProbePathPrefix+"relay-b")
+
+	st := NewStatsTable(time.Hour)
+	st.Report("relay-a", RelayStats{Sessions: 5, Subscribers: map[string]int{"/live": 5}})
+	st.Report("relay-b", RelayStats{Sessions: 6, Subscribers: map[string]int{"/live": 6}})
+	st.Report("relay-d", RelayStats{Sessions: 9})
+
+	return NewReplicationTable(policy, at, st, topo), st
+}
+
+func TestReplicationTable_Plan(t *testing.T) {
+	rt, st := replicationFixture(ReplicationPolicy{Factor: 3, MinSubscribers: 10, Tracks: []string{"video"}})
+
+	coverage := rt.Plan()
+	if len(coverage) != 1 {
+		t.Fatalf("expected only /live (probe paths skipped), got %+v", coverage)
+	}
+	c := coverage[0]
+	if !c.Hot || c.Subscribers != 11 || c.Target != 3 {
+		t.Errorf("expected hot /live with 11 subscribers and target 3, got %+v", c)
+	}
+	if len(c.Prefetching) != 1 || c.Prefetching[0] != "relay-c" {
+		t.Errorf("expected the idle relay in the uncovered region, got %v", c.Prefetching)
+	}
+	if c.Coverage != 3 || !c.Satisfied {
+		t.Errorf("expected coverage 3 satisfied, got %+v", c)
+	}
+
+	// Assignments are sticky.
+	if again := rt.Plan()[0]; len(again.Prefetching) != 1 || again.Prefetching[0] != "relay-c" {
+		t.Errorf("expected relay-c to keep its assignment, got %v", again.Prefetching)
+	}
+
+	// A cold broadcast is only reported.
+	st.Report("relay-b", RelayStats{Sessions: 6})
+	c = rt.Plan()[0]
+	if c.Hot || len(c.Prefetching) != 0 || c.Target != 0 || !c.Satisfied {
+		t.Errorf("expected cold /live without prefetches, got %+v", c)
+	}
+}
+
+func TestReplicationTable_Trending(t *testing.T) {
+	rt, _ := replicationFixture(ReplicationPolicy{Factor: 3, MinSubscribers: 100, MinLookups: 3, Tracks: []string{"video"}})
+
+	if c := rt.Plan()[0]; c.Hot {
+		t.Fatalf("expected /live cold below both thresholds, got %+v", c)
+	}
+	for range 3 {
+		rt.announces.Lookup("/live")
+	}
+	c := rt.Plan()[0]
+	if !c.Hot || c.Lookups != 3 || len(c.Prefetching) != 1 {
+		t.Errorf("expected /live hot on lookups with a prefetch, got %+v", c)
+	}
+}
+
+func TestReplicationTable_ReportOnly(t *testing.T) {
+	rt, _ := replicationFixture(ReplicationPolicy{})
+
+	c := rt.Plan()[0]
+	if c.Hot || len(c.Prefetching) != 0 || c.Coverage != 2 {
+		t.Errorf("expected a zero factor to only report coverage, got %+v", c)
+	}
+}
+
+func TestReplicationTable_Tasks(t *testing.T) {
+	rt, _ := replicationFixture(ReplicationPolicy{Factor: 4, MinSubscribers: 10, Tracks: []string{"video"}})
+
+	tasks := rt.Tasks("relay-d", allVisible)
+	if len(tasks) != 1 {
+		t.Fatalf("expected relay-d to fill the fourth copy, got %+v", tasks)
+	}
+	if tasks[0].Path != "/live" || tasks[0].Source != "relay-a" || len(tasks[0].Tracks) != 1 {
+		t.Errorf("unexpected task: %+v", tasks[0])
+	}
+	if tasks := rt.Tasks("relay-b", allVisible); len(tasks) != 0 {
+		t.Errorf("expected no tasks for a serving relay, got %+v", tasks)
+	}
+}
+
+func TestReplicationTable_CordonedRelay(t *testing.T) {
+	rt, _ := replicationFixture(ReplicationPolicy{Factor: 3, MinSubscribers: 10, Tracks: []string{"video"}})
+	if tasks := rt.Tasks("relay-c", allVisible); len(tasks) != 1 {
+		t.Fatalf("expected relay-c to prefetch /live, got %+v", tasks)
+	}
+
+	now := time.Now()
+	if err := rt.topo.ScheduleMaintenance(topology.MaintenanceWindow{Relay: "relay-c", Start: now, End: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The prefetch migrates off the cordoned relay.
+	if tasks := rt.Tasks("relay-c", allVisible); len(tasks) != 0 {
+		t.Errorf("expected no tasks for a cordoned relay, got %+v", tasks)
+	}
+	if c := rt.Plan()[0]; len(c.Prefetching) != 1 || c.Prefetching[0] != "relay-d" {
+		t.Errorf("expected relay-d to take over, got %v", c.Prefetching)
+	}
+}
+
+func TestReplicationTable_UnhealthyRelay(t *testing.T) {
+	rt, _ := replicationFixture(ReplicationPolicy{Factor: 3, MinSubscribers: 10, Tracks: []string{"video"}})
+	if c := rt.Plan()[0]; len(c.Prefetching) != 1 || c.Prefetching[0] != "relay-c" {
+		t.Fatalf("expected relay-c to prefetch /live, got %v", c.Prefetching)
+	}
+
+	// The prefetch migrates off the unreachable relay, and a degraded one
+	// is not picked.
+	rt.topo.SetHealth(map[string]topology.Health{"relay-c": topology.HealthUnreachable, "relay-d": topology.HealthDegraded})
+	if c := rt.Plan()[0]; len(c.Prefetching) != 0 || c.Satisfied {
+		t.Errorf("expected no healthy relay to take over, got %+v", c)
+	}
+
+	rt.topo.SetHealth(map[string]topology.Health{"relay-c": topology.HealthUnreachable})
+	if c := rt.Plan()[0]; len(c.Prefetching) != 1 || c.Prefetching[0] != "relay-d" {
+		t.Errorf("expected relay-d to take over, got %v", c.Prefetching)
+	}
+}
+
+func TestCoverageHandlerFunc(t *testing.T) {
+	rt, _ := replicationFixture(ReplicationPolicy{Factor: 5, MinSubscribers: 10, Tracks: []string{"video"}})
+	handler := CoverageHandlerFunc(rt)
+
+	req := httptest.NewRequest(http.MethodGet, "/announce/coverage?unsatisfied=true", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp struct {
+		Factor int        `json:"factor"`
+		Paths  []Coverage `json:"paths"`
+		Count  int        `json:"count"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Factor != 5 || resp.Count != 1 {
+		t.Fatalf("expected /live below factor 5, got %+v", resp)
+	}
+	if c := resp.Paths[0]; c.Coverage != 4 || c.Satisfied {
+		t.Errorf("expected 4 of 5 relays, got %+v", c)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/announce/coverage", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
+
+func TestPrefetchTasksHandlerFunc(t *testing.T) {
+	rt, _ := replicationFixture(ReplicationPolicy{Factor: 3, MinSubscribers: 10, Tracks: []string{"video"}})
+	handler := PrefetchTasksHandlerFunc(rt)
+
+	req := httptest.NewRequest(http.MethodGet, "/replication/relay-c", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	var resp struct {
+		Tasks []PrefetchTask `json:"tasks"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Tasks) != 1 || resp.Tasks[0].Path != "/live" {
+		t.Errorf("expected /live for relay-c, got %+v", resp.Tasks)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/replication/", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a relay name, got %d", w.Code)
+	}
+}
+
+func TestPrefetchTasksHandlerFunc_Maintenance(t *testing.T) {
+	rt, _ := replicationFixture(ReplicationPolicy{Factor: 3, MinSubscribers: 10, Tracks: []string{"video"}})
+	handler := PrefetchTasksHandlerFunc(rt)
+	now := time.Now()
+	if err := rt.topo.ScheduleMaintenance(topology.MaintenanceWindow{Relay: "relay-c", Start: now, End: now.Add(time.Hour), Reason: "rack move"}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/replication/relay-c", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	var resp struct {
+		Tasks       []PrefetchTask              `json:"tasks"`
+		Maintenance *topology.MaintenanceWindow `json:"maintenance"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Tasks) != 0 {
+		t.Errorf("expected no tasks during maintenance, got %+v", resp.Tasks)
+	}
+	if resp.Maintenance == nil || resp.Maintenance.Reason != "rack move" {
+		t.Errorf("expected the active window, got %+v", resp.Maintenance)
+	}
+}
@@ -0,0 +1,124 @@
+package sdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// RelayStatsHandlerFunc returns an http.HandlerFunc that accepts metric
+// summaries pushed by relays.
+//
+//	POST /stats/relay/<name>  — store the latest RelayStats for <name>
+//	GET  /stats/relay/<name>  — return the latest stored report
+func RelayStatsHandlerFunc(table *statsTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/stats/relay/")
+		if name == "" || name == r.URL.Path || strings.Contains(name, "/") {
+			jsonError(w, http.StatusBadRequest, "path must be /stats/relay/<name>")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			var stats RelayStats
+			if err := topology.DecodeJSON(w, r, topology.MaxRequestBytes, &stats); err != nil {
+				jsonError(w, topology.DecodeErrorStatus(err), "invalid JSON: "+err.Error())
+				return
+			}
+			table.Report(name, stats)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status": "recorded",
+				"relay":  name,
+			})
+
+		case http.MethodGet:
+			entry, ok := table.Get(name)
+			if !ok {
+				jsonError(w, http.StatusNotFound, "no stats for relay: "+name)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(entry)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// ClusterStatsHandlerFunc returns an http.HandlerFunc that serves
+// fleet-wide aggregates of the latest relay reports.
+//
+//	GET /stats/cluster
+func ClusterStatsHandlerFunc(table *statsTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(table.Cluster())
+	}
+}
+
+// DefaultPopularWindow and DefaultPopularLimit apply to /stats/popular
+// when the request does not set them.
+const (
+	DefaultPopularWindow = 15 * time.Minute
+	DefaultPopularLimit  = 20
+)
+
+// PopularHandlerFunc returns an http.HandlerFunc that serves the most
+// looked-up broadcast paths, to spot trending content.
+//
+//	GET /stats/popular?window=5m&n=10
+//
+// window is a duration between 1m and 1h, counted in whole minutes
+// including the current one (default 15m); n limits the list (default 20).
+func PopularHandlerFunc(table *announceTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		window := DefaultPopularWindow
+		if v := r.URL.Query().Get("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < time.Minute || d > MaxPopularityWindow {
+				jsonError(w, http.StatusBadRequest, "'window' must be a duration between 1m and 1h")
+				return
+			}
+			window = d.Truncate(time.Minute)
+		}
+		n := DefaultPopularLimit
+		if v := r.URL.Query().Get("n"); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+				jsonError(w, http.StatusBadRequest, "'n' must be a positive integer")
+				return
+			}
+		}
+
+		popular := table.Popular(window, n, visibleTo(r.Context()))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"window": window.String(),
+			"paths":  popular,
+			"count":  len(popular),
+		})
+	}
+}
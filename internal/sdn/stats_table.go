@@ -0,0 +1,178 @@
+package sdn
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RelayStats is the compact metric summary a relay pushes to the controller.
+type RelayStats struct {
+	// Sessions is the number of open MoQ sessions on the relay.
+	Sessions int `json:"sessions"`
+
+	// EgressBytes is the relay's cumulative egress payload byte counter.
+	EgressBytes uint64 `json:"egress_bytes"`
+
+	// EgressMbps is the egress rate observed since the previous report.
+	EgressMbps float64 `json:"egress_mbps"`
+
+	// Subscribers maps broadcast path → active subscriber count on the relay.
+	Subscribers map[string]int `json:"subscribers,omitempty"`
+
+	// Health is "healthy", or "degraded" while the relay is not ready,
+	// for the reason in HealthReason. Empty leaves the relay's health to
+	// probes; see HealthMonitor.
+	Health       string `json:"health,omitempty"`
+	HealthReason string `json:"health_reason,omitempty"`
+}
+
+// RelayStatsEntry is a RelayStats report with bookkeeping metadata.
+type RelayStatsEntry struct {
+	Relay      string    `json:"relay"`
+	ReceivedAt time.Time `json:"received_at"`
+	RelayStats
+}
+
+// ClusterStats is the fleet-wide aggregate served by GET /stats/cluster.
+type ClusterStats struct {
+	Relays           int            `json:"relays"`
+	Sessions         int            `json:"sessions"`
+	EgressMbps       float64        `json:"egress_mbps"`
+	TotalSubscribers int            `json:"total_subscribers"`
+	Subscribers      map[string]int `json:"subscribers"`
+	Timestamp        time.Time      `json:"timestamp"`
+}
+
+// statsTable keeps the latest stats report from each relay.
+// Thread-safe: all access goes through a RWMutex.
+type statsTable struct {
+	mu      sync.RWMutex
+	reports map[string]RelayStatsEntry // relay name → latest report
+
+	// TTL is how long a report contributes to cluster aggregates, and is
+	// kept by Sweep. Zero means reports never go stale.
+	TTL time.Duration
+}
+
+// NewStatsTable creates an empty stats table.
+// If ttl > 0, reports older than ttl are ignored by Cluster and removed by
+// Sweep; a few heartbeat intervals tolerate a missed report or two.
+func NewStatsTable(ttl time.Duration) *statsTable {
+	return &statsTable{
+		reports: make(map[string]RelayStatsEntry),
+		TTL:     ttl,
+	}
+}
+
+// Report stores the latest stats for a relay, replacing any previous report.
+func (st *statsTable) Report(relay string, stats RelayStats) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.reports[relay] = RelayStatsEntry{
+		Relay:      relay,
+		ReceivedAt: time.Now(),
+		RelayStats: stats,
+	}
+}
+
+// Remove drops the stats of a relay. Returns true if a report existed.
+func (st *statsTable) Remove(relay string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.reports[relay]; !ok {
+		return false
+	}
+	delete(st.reports, relay)
+	return true
+}
+
+// StartSweeper runs a background goroutine that removes stale reports at
+// regular intervals. It stops when ctx is cancelled.
+func (st *statsTable) StartSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				st.Sweep()
+			}
+		}
+	}()
+}
+
+// Sweep removes the reports older than TTL, of relays that stopped
+// reporting. Returns the number of reports removed.
+func (st *statsTable) Sweep() int {
+	if st.TTL <= 0 {
+		return 0
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for relay, e := range st.reports {
+		if now.Sub(e.ReceivedAt) > st.TTL {
+			delete(st.reports, relay)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Get returns the latest report for a relay.
+func (st *statsTable) Get(relay string) (RelayStatsEntry, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	e, ok := st.reports[relay]
+	return e, ok
+}
+
+// fresh returns the reports that have not gone stale.
+func (st *statsTable) fresh() []RelayStatsEntry {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	now := time.Now()
+	reports := make([]RelayStatsEntry, 0, len(st.reports))
+	for _, e := range st.reports {
+		if st.TTL > 0 && now.Sub(e.ReceivedAt) > st.TTL {
+			continue
+		}
+		reports = append(reports, e)
+	}
+	return reports
+}
+
+// Cluster aggregates all fresh reports into fleet-wide totals.
+func (st *statsTable) Cluster() ClusterStats {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	now := time.Now()
+	cs := ClusterStats{
+		Subscribers: make(map[string]int),
+		Timestamp:   now,
+	}
+	for _, e := range st.reports {
+		if st.TTL > 0 && now.Sub(e.ReceivedAt) > st.TTL {
+			continue // stale
+		}
+		cs.Relays++
+		cs.Sessions += e.Sessions
+		cs.EgressMbps += e.EgressMbps
+		for bp, n := range e.Subscribers {
+			cs.Subscribers[bp] += n
+			cs.TotalSubscribers += n
+		}
+	}
+	return cs
+}
@@ -0,0 +1,222 @@
+package sdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatsTable_ClusterAggregates(t *testing.T) {
+	st := NewStatsTable(0)
+
+	st.Report("relay-a", RelayStats{
+		Sessions:    3,
+		EgressMbps:  12.5,
+		Subscribers: map[string]int{"/live/a": 2, "/live/b": 1},
+	})
+	st.Report("relay-b", RelayStats{
+		Sessions:    1,
+		EgressMbps:  2.5,
+		Subscribers: map[string]int{"/live/a": 4},
+	})
+
+	cs := st.Cluster()
+	if cs.Relays != 2 {
+		t.Errorf("expected 2 relays, got %d", cs.Relays)
+	}
+	if cs.Sessions != 4 {
+		t.Errorf("expected 4 sessions, got %d", cs.Sessions)
+	}
+	if cs.EgressMbps != 15 {
+		t.Errorf("expected 15 Mbps, got %v", cs.EgressMbps)
+	}
+	if cs.Subscribers["/live/a"] != 6 {
+		t.Errorf("expected 6 subscribers on /live/a, got %d", cs.Subscribers["/live/a"])
+	}
+	if cs.TotalSubscribers != 7 {
+		t.Errorf("expected 7 total subscribers, got %d", cs.TotalSubscribers)
+	}
+}
+
+func TestStatsTable_ReportReplaces(t *testing.T) {
+	st := NewStatsTable(0)
+
+	st.Report("relay-a", RelayStats{Sessions: 3})
+	st.Report("relay-a", RelayStats{Sessions: 1})
+
+	cs := st.Cluster()
+	if cs.Relays != 1 || cs.Sessions != 1 {
+		t.Errorf("expected latest report only, got relays=%d sessions=%d", cs.Relays, cs.Sessions)
+	}
+}
+
+func TestStatsTable_StaleReportsExcluded(t *testing.T) {
+	st := NewStatsTable(50 * time.Millisecond)
+
+	st.Report("relay-a", RelayStats{Sessions: 3})
+	time.Sleep(80 * time.Millisecond)
+	st.Report("relay-b", RelayStats{Sessions: 1})
+
+	cs := st.Cluster()
+	if cs.Relays != 1 || cs.Sessions != 1 {
+		t.Errorf("expected only fresh report, got relays=%d sessions=%d", cs.Relays, cs.Sessions)
+	}
+}
+
+func TestStatsTable_Remove(t *testing.T) {
+	st := NewStatsTable(0)
+	st.Report("relay-a", RelayStats{Sessions: 3})
+
+	if !st.Remove("relay-a") {
+		t.Error("expected removal to succeed")
+	}
+	if st.Remove("relay-a") {
+		t.Error("expected second removal to report false")
+	}
+	if _, ok := st.Get("relay-a"); ok {
+		t.Error("expected no report after removal")
+	}
+}
+
+func TestStatsTable_Sweep(t *testing.T) {
+	st := NewStatsTable(50 * time.Millisecond)
+
+	st.Report("relay-a", RelayStats{Sessions: 3})
+	time.Sleep(80 * time.Millisecond)
+	st.Report("relay-b", RelayStats{Sessions: 1})
+
+	if n := st.Sweep(); n != 1 {
+		t.Errorf("expected 1 stale report swept, got %d", n)
+	}
+	if _, ok := st.Get("relay-a"); ok {
+		t.Error("expected the stale report to be evicted")
+	}
+	if _, ok := st.Get("relay-b"); !ok {
+		t.Error("expected the fresh report to be kept")
+	}
+
+	if n := NewStatsTable(0).Sweep(); n != 0 {
+		t.Errorf("expected nothing swept without a TTL, got %d", n)
+	}
+}
+
+func TestRelayStatsHandlerFunc_PostAndGet(t *testing.T) {
+	st := NewStatsTable(0)
+	handler := RelayStatsHandlerFunc(st)
+
+	body, _ := json.Marshal(RelayStats{Sessions: 2, EgressMbps: 4})
+	req := httptest.NewRequest(http.MethodPost, "/stats/relay/relay-a", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/stats/relay/relay-a", nil)
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+
+	var entry RelayStatsEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Relay != "relay-a" || entry.Sessions != 2 {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestRelayStatsHandlerFunc_BadRequests(t *testing.T) {
+	handler := RelayStatsHandlerFunc(NewStatsTable(0))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"missing name", http.MethodPost, "/stats/relay/", "{}", http.StatusBadRequest},
+		{"invalid json", http.MethodPost, "/stats/relay/relay-a", "nope", http.StatusBadRequest},
+		{"unknown relay", http.MethodGet, "/stats/relay/relay-x", "", http.StatusNotFound},
+		{"bad method", http.MethodDelete, "/stats/relay/relay-a", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.body)))
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestClusterStatsHandlerFunc(t *testing.T) {
+	st := NewStatsTable(0)
+	st.Report("relay-a", RelayStats{Sessions: 2, Subscribers: map[string]int{"/live/a": 5}})
+
+	req := httptest.NewRequest(http.MethodGet, "/stats/cluster", nil)
+	rec := httptest.NewRecorder()
+	ClusterStatsHandlerFunc(st)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var cs ClusterStats
+	if err := json.NewDecoder(rec.Body).Decode(&cs); err != nil {
+		t.Fatal(err)
+	}
+	if cs.Relays != 1 || cs.TotalSubscribers != 5 {
+		t.Errorf("unexpected cluster stats: %+v", cs)
+	}
+}
+
+func TestClient_ReportStats_ComputesRate(t *testing.T) {
+	var mu sync.Mutex
+	var received []RelayStats
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/stats/relay/relay-a" {
+			var rs RelayStats
+			json.NewDecoder(r.Body).Decode(&rs)
+			mu.Lock()
+			received = append(received, rs)
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{URL: srv.URL, RelayName: "relay-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.ReportStats(context.Background(), RelayStats{EgressBytes: 0}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := c.ReportStats(context.Background(), RelayStats{EgressBytes: 1_000_000}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("expected 2 reports, got %d", len(received))
+	}
+	if received[0].EgressMbps != 0 {
+		t.Errorf("expected first report to have no rate, got %v", received[0].EgressMbps)
+	}
+	if received[1].EgressMbps <= 0 {
+		t.Errorf("expected positive rate on second report, got %v", received[1].EgressMbps)
+	}
+}
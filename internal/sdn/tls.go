@@ -0,0 +1,87 @@
+package sdn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// PEM material in configs. A certificate, its key and a CA bundle may each
+// be given as a file path, a "file:" reference or inline PEM data, as
+// resolved from a secret store, independently of one another.
+
+// IsPEM reports whether s holds inline PEM data rather than a file path.
+func IsPEM(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), "-----BEGIN ")
+}
+
+// ReadPEM returns the PEM data s holds inline, or reads it from the file s
+// names, with or without a "file:" prefix.
+func ReadPEM(s string) ([]byte, error) {
+	if IsPEM(s) {
+		return []byte(s), nil
+	}
+	return os.ReadFile(strings.TrimPrefix(s, "file:"))
+}
+
+// LoadKeyPair loads a certificate and its key, each given as a path or as
+// inline PEM.
+func LoadKeyPair(cert, key string) (tls.Certificate, error) {
+	certPEM, err := ReadPEM(cert)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("read certificate: %w", err)
+	}
+	keyPEM, err := ReadPEM(key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("read key: %w", err)
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// LoadCertPool returns a pool of the CA certificates in ca, given as a path
+// or as inline PEM.
+func LoadCertPool(ca string) (*x509.CertPool, error) {
+	caPEM, err := ReadPEM(ca)
+	if err != nil {
+		return nil, fmt.Errorf("read CA cert: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("failed to parse CA certificate")
+	}
+	return pool, nil
+}
+
+// RedactURL masks any password in a URL before it is logged.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+func buildTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	cert, err := LoadKeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client cert: %w", err)
+	}
+
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if cfg.CAFile != "" {
+		pool, err := LoadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	return tlsCfg, nil
+}
@@ -0,0 +1,40 @@
+package sdn
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// UIHandler returns an http.Handler that serves the web dashboard built
+// into dir (`mage webBuild` writes it to solid-deno/dist). Mount it with
+// its prefix stripped. Paths without a file extension that match no file
+// get index.html, so the app's own routes survive a reload. Vite's
+// content-hashed assets under /assets/ are cached for good; everything else
+// is revalidated.
+func UIHandler(dir string) http.Handler {
+	root := http.Dir(dir)
+	files := http.FileServer(root)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		p := path.Clean("/" + r.URL.Path)
+		if f, err := root.Open(p); err == nil {
+			f.Close()
+		} else if path.Ext(p) == "" {
+			r = r.Clone(r.Context())
+			r.URL.Path = "/"
+			p = "/"
+		}
+
+		if strings.HasPrefix(p, "/assets/") {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		files.ServeHTTP(w, r)
+	})
+}
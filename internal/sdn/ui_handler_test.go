@@ -0,0 +1,50 @@
+package sdn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUIHandler(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>dashboard</html>"), 0o644)
+	os.WriteFile(filepath.Join(dir, "assets", "index-abc123.js"), []byte("console.log(1)"), 0o644)
+
+	mux := http.NewServeMux()
+	mux.Handle("/ui/", http.StripPrefix("/ui", UIHandler(dir)))
+
+	tests := []struct {
+		method, target string
+		code           int
+		body, cache    string
+	}{
+		{http.MethodGet, "/ui/", http.StatusOK, "dashboard", "no-cache"},
+		{http.MethodGet, "/ui/assets/index-abc123.js", http.StatusOK, "console.log", "immutable"},
+		{http.MethodGet, "/ui/publish", http.StatusOK, "dashboard", "no-cache"}, // app route
+		{http.MethodGet, "/ui/missing.js", http.StatusNotFound, "", ""},
+		{http.MethodPost, "/ui/", http.StatusMethodNotAllowed, "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != tt.code {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.target, tt.code, rec.Code)
+			continue
+		}
+		if !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("%s: expected body containing %q, got %q", tt.target, tt.body, rec.Body.String())
+		}
+		if cc := rec.Header().Get("Cache-Control"); !strings.Contains(cc, tt.cache) {
+			t.Errorf("%s: expected Cache-Control containing %q, got %q", tt.target, tt.cache, cc)
+		}
+	}
+}
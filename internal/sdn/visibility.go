@@ -0,0 +1,110 @@
+package sdn
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Visibility marks a broadcast private: the controller returns it only to
+// the relays it names or that belong to its tenant, and relays serve it
+// only to the subscribers it allows. Relays declare it in the metadata of
+// their announcements.
+type Visibility struct {
+	Tenant string   `json:"tenant,omitempty" yaml:"tenant"` // relays and subscribers of this tenant
+	Relays []string `json:"relays,omitempty" yaml:"relays"` // relays, or subscriber identities, named here
+}
+
+// Private reports whether md restricts its broadcast. A nil md is public.
+func (md *AnnounceMetadata) Private() bool {
+	return md != nil && md.Visibility != nil && (md.Visibility.Tenant != "" || len(md.Visibility.Relays) > 0)
+}
+
+// AllowsRelay reports whether a relay of tenant may see the broadcast.
+// A nil v allows every relay.
+func (v *Visibility) AllowsRelay(relay, tenant string) bool {
+	if v == nil || (v.Tenant == "" && len(v.Relays) == 0) {
+		return true
+	}
+	return (v.Tenant != "" && v.Tenant == tenant) || (relay != "" && slices.Contains(v.Relays, relay))
+}
+
+// AllowsSubscriber reports whether a subscriber authenticated as identity
+// may receive the broadcast: one named in Relays, or one of the tenant,
+// whose identity is the tenant or starts with "<tenant>/". A nil v allows
+// every subscriber, anonymous ones included.
+func (v *Visibility) AllowsSubscriber(identity string) bool {
+	if v == nil || (v.Tenant == "" && len(v.Relays) == 0) {
+		return true
+	}
+	if identity == "" {
+		return false
+	}
+	if v.Tenant != "" && (identity == v.Tenant || strings.HasPrefix(identity, v.Tenant+"/")) {
+		return true
+	}
+	return slices.Contains(v.Relays, identity)
+}
+
+// RelayIdentity is a relay authenticated to the controller by a bearer
+// token.
+type RelayIdentity struct {
+	Relay  string
+	Tenant string
+	Token  string
+}
+
+type relayIdentityCtxKey struct{}
+
+// IdentifyRelays returns a handler that attaches to each request the
+// identity whose token it carries as "Authorization: Bearer <token>".
+// Requests without one are served anonymously: they see public
+// announcements only.
+func IdentifyRelays(identities []RelayIdentity, next http.Handler) http.Handler {
+	if len(identities) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			for _, id := range identities {
+				if subtle.ConstantTimeCompare([]byte(got), []byte(id.Token)) == 1 {
+					r = r.WithContext(context.WithValue(r.Context(), relayIdentityCtxKey{}, id))
+					break
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RelayIdentityFromContext returns the identity attached by IdentifyRelays.
+func RelayIdentityFromContext(ctx context.Context) (RelayIdentity, bool) {
+	id, ok := ctx.Value(relayIdentityCtxKey{}).(RelayIdentity)
+	return id, ok
+}
+
+// visibleTo returns a filter passing the announcements the requester of
+// ctx may see: public ones, its own, and the private ones it is allowed.
+func visibleTo(ctx context.Context) func(AnnounceEntry) bool {
+	id, _ := RelayIdentityFromContext(ctx)
+	return func(e AnnounceEntry) bool {
+		if !e.Metadata.Private() || (id.Relay != "" && e.Relay == id.Relay) {
+			return true
+		}
+		return e.Metadata.Visibility.AllowsRelay(id.Relay, id.Tenant)
+	}
+}
+
+// filterEntries returns the entries that pass visible, in order, or nil if
+// none does.
+func filterEntries(entries []AnnounceEntry, visible func(AnnounceEntry) bool) []AnnounceEntry {
+	var out []AnnounceEntry
+	for _, e := range entries {
+		if visible(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,205 @@
+package sdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+func TestVisibility_AllowsRelay(t *testing.T) {
+	v := &Visibility{Tenant: "brand-a", Relays: []string{"relay-x"}}
+	tests := []struct {
+		relay, tenant string
+		want          bool
+	}{
+		{"relay-1", "brand-a", true},
+		{"relay-x", "brand-b", true},
+		{"relay-1", "brand-b", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := v.AllowsRelay(tt.relay, tt.tenant); got != tt.want {
+			t.Errorf("AllowsRelay(%q, %q) = %v, want %v", tt.relay, tt.tenant, got, tt.want)
+		}
+	}
+
+	var public *Visibility
+	if !public.AllowsRelay("", "") || !(&Visibility{}).AllowsRelay("", "") {
+		t.Error("a broadcast without visibility should be public")
+	}
+}
+
+func TestVisibility_AllowsSubscriber(t *testing.T) {
+	v := &Visibility{Tenant: "brand-a", Relays: []string{"relay-x"}}
+	for identity, want := range map[string]bool{
+		"brand-a":        true,
+		"brand-a/viewer": true,
+		"relay-x":        true,
+		"brand-ab":       false,
+		"brand-b/viewer": false,
+		"":               false,
+	} {
+		if got := v.AllowsSubscriber(identity); got != want {
+			t.Errorf("AllowsSubscriber(%q) = %v, want %v", identity, got, want)
+		}
+	}
+
+	var public *Visibility
+	if !public.AllowsSubscriber("") {
+		t.Error("a public broadcast should allow anonymous subscribers")
+	}
+}
+
+// allVisible passes every announcement.
+func allVisible(AnnounceEntry) bool { return true }
+
+// privateTable has a public broadcast and one private to tenant brand-a.
+func privateTable() *announceTable {
+	table := NewAnnounceTable(0)
+	table.Register("relay-a", "/live/public")
+	table.RegisterWithMetadata("relay-a", "/live/private", &AnnounceMetadata{Visibility: &Visibility{Tenant: "brand-a"}})
+	return table
+}
+
+var testIdentities = []RelayIdentity{
+	{Relay: "relay-b", Tenant: "brand-a", Token: "token-b"},
+	{Relay: "relay-c", Tenant: "brand-c", Token: "token-c"},
+}
+
+// get serves a GET of target with token as the bearer token, if any.
+func get(t *testing.T, h http.Handler, target, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	IdentifyRelays(testIdentities, h).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", target, rec.Code)
+	}
+	return rec
+}
+
+func TestLookupHandlerFunc_Private(t *testing.T) {
+	h := LookupHandlerFunc(privateTable())
+
+	for token, want := range map[string]int{"token-b": 1, "token-c": 0, "wrong": 0, "": 0} {
+		var resp LookupResponse
+		if err := json.NewDecoder(get(t, h, "/announce/lookup?broadcast_path=/live/private", token).Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Relays) != want {
+			t.Errorf("token %q: got %d relays, want %d", token, len(resp.Relays), want)
+		}
+	}
+}
+
+func TestListHandlerFunc_Private(t *testing.T) {
+	table := privateTable()
+	h := ListHandlerFunc(table)
+
+	var list struct {
+		Entries []AnnounceEntry `json:"entries"`
+		Version uint64          `json:"version"`
+	}
+	if err := json.NewDecoder(get(t, h, "/announce", "token-c").Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Entries) != 1 || list.Entries[0].BroadcastPath != "/live/public" {
+		t.Fatalf("relay of another tenant should only see the public broadcast: %+v", list.Entries)
+	}
+
+	// The private broadcast's changes are left out of deltas too.
+	table.RegisterWithMetadata("relay-a", "/live/private2", &AnnounceMetadata{Visibility: &Visibility{Relays: []string{"relay-b"}}})
+	table.Deregister("relay-a", "/live/private")
+	since := "/announce?since=" + strconv.FormatUint(list.Version, 10)
+
+	var d AnnounceDelta
+	if err := json.NewDecoder(get(t, h, since, "token-c").Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Added) != 0 || len(d.Removed) != 0 {
+		t.Errorf("unexpected delta for relay-c: %+v", d)
+	}
+
+	d = AnnounceDelta{}
+	if err := json.NewDecoder(get(t, h, since, "token-b").Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Added) != 1 || len(d.Removed) != 1 {
+		t.Errorf("unexpected delta for relay-b: %+v", d)
+	}
+}
+
+func TestPopularHandlerFunc_Private(t *testing.T) {
+	table := privateTable()
+	table.Lookup("/live/private")
+	table.Lookup("/live/public")
+	h := PopularHandlerFunc(table)
+
+	for token, want := range map[string]int{"token-b": 2, "token-c": 1, "": 1} {
+		var resp struct {
+			Paths []PopularPath `json:"paths"`
+		}
+		if err := json.NewDecoder(get(t, h, "/stats/popular", token).Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Paths) != want {
+			t.Errorf("token %q: got %+v, want %d paths", token, resp.Paths, want)
+		}
+	}
+}
+
+func TestNodeDetailHandlerFunc_Private(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/relay/{name}/detail", NodeDetailHandlerFunc(&topology.Topology{}, privateTable(), NewStatsTable(0)))
+
+	for token, want := range map[string]int{"token-b": 2, "token-c": 1} {
+		var d NodeDetail
+		if err := json.NewDecoder(get(t, mux, "/relay/relay-a/detail", token).Body).Decode(&d); err != nil {
+			t.Fatal(err)
+		}
+		if len(d.Announces) != want {
+			t.Errorf("token %q: got %+v, want %d announces", token, d.Announces, want)
+		}
+	}
+}
+
+func TestReplication_Private(t *testing.T) {
+	rt, _ := replicationFixture(ReplicationPolicy{Factor: 4, MinSubscribers: 10, Tracks: []string{"video"}})
+	rt.announces.RegisterWithMetadata("relay-a", "/live", &AnnounceMetadata{Visibility: &Visibility{Tenant: "brand-a"}})
+	rt.Tenants = map[string]string{"relay-b": "brand-a", "relay-d": "brand-a"}
+
+	// Only relays of the tenant are assigned the private broadcast
+	if c := rt.Plan()[0]; len(c.Prefetching) != 1 || c.Prefetching[0] != "relay-d" {
+		t.Errorf("expected only relay-d of the tenant to prefetch, got %v", c.Prefetching)
+	}
+
+	h := PrefetchTasksHandlerFunc(rt)
+	for token, want := range map[string]int{"token-b": 1, "token-c": 0, "": 0} {
+		var resp struct {
+			Tasks []PrefetchTask `json:"tasks"`
+		}
+		if err := json.NewDecoder(get(t, h, "/replication/relay-d", token).Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Tasks) != want {
+			t.Errorf("token %q: got %+v, want %d tasks", token, resp.Tasks, want)
+		}
+	}
+
+	var coverage struct {
+		Paths []Coverage `json:"paths"`
+	}
+	if err := json.NewDecoder(get(t, CoverageHandlerFunc(rt), "/announce/coverage", "token-c").Body).Decode(&coverage); err != nil {
+		t.Fatal(err)
+	}
+	if len(coverage.Paths) != 0 {
+		t.Errorf("relay of another tenant should not see the private broadcast: %+v", coverage.Paths)
+	}
+}
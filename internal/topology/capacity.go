@@ -0,0 +1,245 @@
+package topology
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultReservationTTL is how long a bandwidth reservation holds when
+// Reserve is given no TTL.
+const DefaultReservationTTL = time.Hour
+
+// ErrInsufficientCapacity is returned by Reserve when a path exists but
+// every one crosses a link without enough unreserved capacity.
+var ErrInsufficientCapacity = errors.New("insufficient link capacity")
+
+// Reservation is bandwidth reserved along a route, e.g. for a big event's
+// distribution tree. It holds until released or until it expires.
+type Reservation struct {
+	ID        string    `json:"id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Path      []string  `json:"path"`
+	Mbps      float64   `json:"mbps"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// EdgeLoad is the reserved bandwidth of an edge against its capacity.
+type EdgeLoad struct {
+	From         string  `json:"from"`
+	To           string  `json:"to"`
+	CapacityMbps float64 `json:"capacity_mbps,omitempty"` // 0 = unlimited
+	ReservedMbps float64 `json:"reserved_mbps"`
+}
+
+// Reserve computes a route from → to over edges with at least mbps of
+// unreserved capacity and reserves mbps on each of its edges for ttl (zero
+// uses DefaultReservationTTL). Edges without EdgeAttributes.CapacityMbps
+// are unlimited. The result carries the reservation's ID; a backup path, if
+// the router computes one, is not reserved.
+//
+// Reservations are kept in memory only: they are not persisted or synced to
+// HA peers, and they are dropped with the relays on their path. A Router
+// that may block, such as HTTPRouter, is called without holding the lock;
+// if the links fill up meanwhile, Reserve fails with
+// ErrInsufficientCapacity.
+func (t *Topology) Reserve(from, to string, mbps float64, ttl time.Duration) (RouteResult, error) {
+	if mbps <= 0 {
+		return RouteResult{}, errors.New("reservation must be positive")
+	}
+	if ttl <= 0 {
+		ttl = DefaultReservationTTL
+	}
+
+	router := t.Router
+	if router == nil {
+		router = NewDijkstraRouter()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+	t.expireReservations(time.Now())
+
+	// Route over the edges with room for mbps more, around cordoned and
+	// unhealthy relays.
+	g := t.deepCopy()
+	t.routeAround(g, from)
+	for id, node := range g.Nodes {
+		fits := node.Edges[:0]
+		for _, e := range node.Edges {
+			if t.headroom(id, e.To) >= mbps {
+				fits = append(fits, e)
+			}
+		}
+		node.Edges = fits
+	}
+
+	var (
+		result RouteResult
+		err    error
+	)
+	if blocking(router) {
+		t.mu.Unlock()
+		result, err = router.Route(g, from, to)
+		t.mu.Lock()
+
+		t.expireReservations(time.Now())
+		if err == nil && !t.fits(result.FullPath, mbps) {
+			return RouteResult{}, fmt.Errorf("%w: links from %s to %s filled up while routing", ErrInsufficientCapacity, from, to)
+		}
+	} else {
+		result, err = router.Route(g, from, to)
+	}
+	if err != nil {
+		if _, _, unconstrained := shortestPath(t.transitGraph(from), from, to); unconstrained == nil {
+			return RouteResult{}, fmt.Errorf("%w: no path from %s to %s with %g Mbps free", ErrInsufficientCapacity, from, to, mbps)
+		}
+		return RouteResult{}, err
+	}
+
+	now := time.Now()
+	if nh, ok := t.graph.Nodes[result.NextHop]; ok {
+		result.NextHopAddress = nh.Address
+	}
+	result.FullPathAddresses = t.graph.addresses(result.FullPath)
+	result.NextHopFEC = t.graph.Attributes[[2]string{from, result.NextHop}].FECStripes
+
+	if t.reservations == nil {
+		t.reservations = make(map[string]*Reservation)
+		t.reserved = make(map[[2]string]float64)
+	}
+	t.reservationSeq++
+	res := &Reservation{
+		ID:        strconv.FormatUint(t.reservationSeq, 10),
+		From:      from,
+		To:        to,
+		Path:      append([]string(nil), result.FullPath...),
+		Mbps:      mbps,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	t.reservations[res.ID] = res
+	for i := 1; i < len(res.Path); i++ {
+		t.reserved[[2]string{res.Path[i-1], res.Path[i]}] += mbps
+	}
+
+	result.ReservationID = res.ID
+	result.ReservedMbps = mbps
+	return result, nil
+}
+
+// Release frees a reservation. Returns false if it does not exist or
+// already expired.
+func (t *Topology) Release(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expireReservations(time.Now())
+	res, ok := t.reservations[id]
+	if ok {
+		t.releaseLocked(res)
+	}
+	return ok
+}
+
+// Reservations returns the active reservations, oldest first, and the load
+// of every edge that has a capacity or reservations.
+func (t *Topology) Reservations() ([]Reservation, []EdgeLoad) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+	t.expireReservations(time.Now())
+
+	list := make([]Reservation, 0, len(t.reservations))
+	for _, res := range t.reservations {
+		cp := *res
+		cp.Path = append([]string(nil), res.Path...)
+		list = append(list, cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+
+	var loads []EdgeLoad
+	for id, node := range t.graph.Nodes {
+		for _, e := range node.Edges {
+			key := [2]string{id, e.To}
+			capacity := t.graph.Attributes[key].CapacityMbps
+			if capacity <= 0 && t.reserved[key] <= 0 {
+				continue
+			}
+			loads = append(loads, EdgeLoad{From: id, To: e.To, CapacityMbps: capacity, ReservedMbps: t.reserved[key]})
+		}
+	}
+	sort.Slice(loads, func(i, j int) bool {
+		if loads[i].From != loads[j].From {
+			return loads[i].From < loads[j].From
+		}
+		return loads[i].To < loads[j].To
+	})
+	return list, loads
+}
+
+// headroom returns the unreserved capacity of the edge from → to, or +Inf
+// if it has no capacity. Caller must hold the lock.
+func (t *Topology) headroom(from, to string) float64 {
+	key := [2]string{from, to}
+	capacity := t.graph.Attributes[key].CapacityMbps
+	if capacity <= 0 {
+		return math.Inf(1)
+	}
+	return capacity - t.reserved[key]
+}
+
+// fits reports whether every edge of path still exists with at least mbps
+// of unreserved capacity. Caller must hold the lock.
+func (t *Topology) fits(path []string, mbps float64) bool {
+	for i := 1; i < len(path); i++ {
+		node, ok := t.graph.Nodes[path[i-1]]
+		if !ok || !node.hasEdgeTo(path[i]) || t.headroom(path[i-1], path[i]) < mbps {
+			return false
+		}
+	}
+	return true
+}
+
+// expireReservations releases the reservations that expired by now.
+// Caller must hold the write lock.
+func (t *Topology) expireReservations(now time.Time) {
+	for _, res := range t.reservations {
+		if !now.Before(res.ExpiresAt) {
+			t.releaseLocked(res)
+		}
+	}
+}
+
+// dropReservations releases the reservations whose path crosses the named
+// relay. Caller must hold the write lock.
+func (t *Topology) dropReservations(name string) {
+	for _, res := range t.reservations {
+		for _, id := range res.Path {
+			if id == name {
+				t.releaseLocked(res)
+				break
+			}
+		}
+	}
+}
+
+// releaseLocked removes res and returns its bandwidth to its edges.
+// Caller must hold the write lock.
+func (t *Topology) releaseLocked(res *Reservation) {
+	delete(t.reservations, res.ID)
+	for i := 1; i < len(res.Path); i++ {
+		key := [2]string{res.Path[i-1], res.Path[i]}
+		if t.reserved[key] -= res.Mbps; t.reserved[key] <= 1e-9 {
+			delete(t.reserved, key)
+		}
+	}
+}
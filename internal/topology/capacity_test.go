@@ -0,0 +1,127 @@
+package topology
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capacityTopology is A → B → D (cost 2) and A → C → D (cost 4), with
+// 100 Mbps on A → B and 50 Mbps on A → C.
+func capacityTopology(t *testing.T) *Topology {
+	t.Helper()
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "A", Neighbors: map[string]float64{"B": 1, "C": 2}})
+	topo.Register(RelayInfo{Name: "B", Neighbors: map[string]float64{"D": 1}})
+	topo.Register(RelayInfo{Name: "C", Neighbors: map[string]float64{"D": 2}})
+	topo.Register(RelayInfo{Name: "D", Neighbors: map[string]float64{}})
+	require.True(t, topo.SetEdgeAttributes("A", "B", func(a *EdgeAttributes) { a.CapacityMbps = 100 }))
+	require.True(t, topo.SetEdgeAttributes("A", "C", func(a *EdgeAttributes) { a.CapacityMbps = 50 }))
+	return topo
+}
+
+func TestTopology_Reserve(t *testing.T) {
+	topo := capacityTopology(t)
+
+	first, err := topo.Reserve("A", "D", 80, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "B", "D"}, first.FullPath)
+	assert.Equal(t, 80.0, first.ReservedMbps)
+
+	// A → B has 20 Mbps left, so the next reservation takes the longer path.
+	second, err := topo.Reserve("A", "D", 40, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "C", "D"}, second.FullPath)
+
+	// Both links are full.
+	_, err = topo.Reserve("A", "D", 30, 0)
+	assert.ErrorIs(t, err, ErrInsufficientCapacity)
+
+	// No path at all is not a capacity problem.
+	_, err = topo.Reserve("D", "A", 1, 0)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInsufficientCapacity)
+
+	// Plain route queries ignore reservations.
+	route, err := topo.Route("A", "D")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "B", "D"}, route.FullPath)
+
+	reservations, loads := topo.Reservations()
+	require.Len(t, reservations, 2)
+	assert.Equal(t, []EdgeLoad{
+		{From: "A", To: "B", CapacityMbps: 100, ReservedMbps: 80},
+		{From: "A", To: "C", CapacityMbps: 50, ReservedMbps: 40},
+		{From: "B", To: "D", ReservedMbps: 80},
+		{From: "C", To: "D", ReservedMbps: 40},
+	}, loads)
+
+	require.True(t, topo.Release(first.ReservationID))
+	assert.False(t, topo.Release(first.ReservationID))
+	third, err := topo.Reserve("A", "D", 30, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "B", "D"}, third.FullPath)
+}
+
+func TestTopology_ReserveExternalRouter(t *testing.T) {
+	topo := capacityTopology(t)
+
+	// The router runs without the lock, so a reservation can take the
+	// capacity it found while it is computing.
+	var raced bool
+	topo.Router = routerFunc(func(g *Graph, from, to string) (RouteResult, error) {
+		require.True(t, topo.mu.TryLock(), "router called with the topology lock held")
+		topo.mu.Unlock()
+		if raced {
+			topo.Router = nil
+			_, err := topo.Reserve("A", "D", 90, 0)
+			require.NoError(t, err)
+		}
+		return NewDijkstraRouter().Route(g, from, to)
+	})
+
+	res, err := topo.Reserve("A", "D", 80, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "B", "D"}, res.FullPath)
+	require.True(t, topo.Release(res.ReservationID))
+
+	raced = true
+	_, err = topo.Reserve("A", "D", 80, 0)
+	assert.ErrorIs(t, err, ErrInsufficientCapacity, "the route found is full by now")
+}
+
+func TestTopology_ReserveExpires(t *testing.T) {
+	topo := capacityTopology(t)
+
+	_, err := topo.Reserve("A", "B", 100, 10*time.Millisecond)
+	require.NoError(t, err)
+	_, err = topo.Reserve("A", "B", 1, 0)
+	assert.ErrorIs(t, err, ErrInsufficientCapacity)
+
+	time.Sleep(20 * time.Millisecond)
+	reservations, _ := topo.Reservations()
+	assert.Empty(t, reservations)
+	_, err = topo.Reserve("A", "B", 100, 0)
+	assert.NoError(t, err)
+}
+
+func TestTopology_ReserveDroppedWithRelay(t *testing.T) {
+	topo := capacityTopology(t)
+
+	res, err := topo.Reserve("A", "D", 10, 0)
+	require.NoError(t, err)
+	require.True(t, topo.Deregister("B", ReasonAdmin))
+
+	reservations, loads := topo.Reservations()
+	assert.Empty(t, reservations)
+	assert.Equal(t, []EdgeLoad{{From: "A", To: "C", CapacityMbps: 50}}, loads)
+	assert.False(t, topo.Release(res.ReservationID))
+}
+
+func TestTopology_ReserveInvalid(t *testing.T) {
+	topo := capacityTopology(t)
+	_, err := topo.Reserve("A", "D", 0, 0)
+	assert.Error(t, err)
+}
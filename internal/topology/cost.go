@@ -4,3 +4,71 @@ package topology
 // Currently used as uniform weight (1) in SDN topology.
 // Designed to support future weighted edges (RTT, load, etc.).
 type Cost float64
+
+// EdgeAttributes are the per-edge signals a CostModel combines into an
+// effective cost.
+type EdgeAttributes struct {
+	// RTTMs is the subscribe-to-first-frame latency measured by data-plane
+	// probes, roughly one round trip.
+	RTTMs float64 `json:"rtt_ms,omitempty"`
+
+	// Loss is the fraction of probe frames lost, 0..1.
+	Loss float64 `json:"loss,omitempty"`
+
+	// Utilization is the link's load, 0..1, as reported by an operator or
+	// an external monitoring system.
+	Utilization float64 `json:"utilization,omitempty"`
+
+	// Weight is an operator multiplier applied to the whole cost; 0 means 1.
+	Weight float64 `json:"weight,omitempty"`
+
+	// CapacityMbps is the link's bandwidth available for reservations, as
+	// configured by an operator or measured by a monitoring system. It does
+	// not affect the cost; see Topology.Reserve. 0 means unlimited.
+	CapacityMbps float64 `json:"capacity_mbps,omitempty"`
+
+	// FECStripes enables forward error correction on a lossy link, e.g. a
+	// satellite hop: the relay at To sends this many parity frames per group
+	// to the relay at From, which rebuilds up to as many frames lost from a
+	// group's tail. It does not affect the cost. 0 disables FEC.
+	FECStripes int `json:"fec_stripes,omitempty"`
+}
+
+// MaxFECStripes bounds EdgeAttributes.FECStripes.
+const MaxFECStripes = 16
+
+// CostModel computes an edge's effective cost from the cost its relay
+// registered and the edge's attributes. The components break the cost down
+// for debugging in /graph. Implementations must be safe for concurrent use.
+type CostModel interface {
+	EdgeCost(configured Cost, attrs EdgeAttributes) (Cost, map[string]float64)
+}
+
+// WeightedCostModel is a linear cost model:
+//
+//	cost = (configured + RTT·rtt_ms + Loss·loss + Utilization·utilization) · weight
+//
+// Coefficients are in cost units per unit of the signal; a zero coefficient
+// ignores the signal.
+type WeightedCostModel struct {
+	RTT         float64
+	Loss        float64
+	Utilization float64
+}
+
+// EdgeCost implements CostModel.
+func (m WeightedCostModel) EdgeCost(configured Cost, attrs EdgeAttributes) (Cost, map[string]float64) {
+	weight := attrs.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	components := map[string]float64{
+		"configured":  float64(configured),
+		"rtt":         m.RTT * attrs.RTTMs,
+		"loss":        m.Loss * attrs.Loss,
+		"utilization": m.Utilization * attrs.Utilization,
+		"weight":      weight,
+	}
+	sum := components["configured"] + components["rtt"] + components["loss"] + components["utilization"]
+	return Cost(sum * weight), components
+}
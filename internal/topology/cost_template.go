@@ -0,0 +1,61 @@
+package topology
+
+// CostTemplate prices the edges relays register without a cost (0 or
+// omitted) from the regions of the two relays, so pairwise costs need not
+// be configured by hand. Costs a relay registers stay authoritative, and
+// probe-measured costs, the CostModel and overrides apply on top as usual.
+//
+// An edge to a relay whose region is not yet known costs 1 until the
+// registering relay's next heartbeat after that relay has registered.
+type CostTemplate struct {
+	// IntraRegion prices edges between relays of the same region; 0
+	// means 1.
+	IntraRegion float64
+
+	// InterRegion prices edges between relays of different regions; 0
+	// means 1.
+	InterRegion float64
+
+	// Pairs price edges between specific regions instead of InterRegion.
+	Pairs []RegionPairCost
+}
+
+// RegionPairCost is the cost of edges between relays of regions A and B,
+// in either direction.
+type RegionPairCost struct {
+	A, B string
+	Cost float64
+}
+
+// cost returns the template's cost of an edge from a relay in region from
+// to one in region to, or 0 if it has none.
+func (c *CostTemplate) cost(from, to string) float64 {
+	if c == nil || from == "" || to == "" {
+		return 0
+	}
+	if from == to {
+		return c.IntraRegion
+	}
+	for _, p := range c.Pairs {
+		if (p.A == from && p.B == to) || (p.A == to && p.B == from) {
+			return p.Cost
+		}
+	}
+	return c.InterRegion
+}
+
+// defaultCost returns the cost of an edge from → to registered without
+// one: the CostTemplate's, or 1. Caller must hold the lock.
+func (t *Topology) defaultCost(from, to string) Cost {
+	var fromRegion, toRegion string
+	if n, ok := t.graph.Nodes[from]; ok {
+		fromRegion = n.Region
+	}
+	if n, ok := t.graph.Nodes[to]; ok {
+		toRegion = n.Region
+	}
+	if cost := t.CostTemplate.cost(fromRegion, toRegion); cost > 0 {
+		return Cost(cost)
+	}
+	return 1 // default weight
+}
@@ -0,0 +1,46 @@
+package topology
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCostTemplate_Register(t *testing.T) {
+	topo := &Topology{CostTemplate: &CostTemplate{
+		IntraRegion: 2,
+		InterRegion: 5,
+		Pairs:       []RegionPairCost{{A: "us", B: "ap", Cost: 12}},
+	}}
+	topo.Register(RelayInfo{Name: "tokyo", Region: "ap"})
+	topo.Register(RelayInfo{Name: "osaka", Region: "ap"})
+	topo.Register(RelayInfo{Name: "paris", Region: "eu"})
+	topo.Register(RelayInfo{Name: "ohio", Region: "us"})
+
+	topo.Register(RelayInfo{Name: "tokyo", Region: "ap", Neighbors: map[string]float64{
+		"osaka":   0,
+		"paris":   0,
+		"ohio":    0,
+		"unknown": 0,
+	}, Symmetric: true})
+	topo.Register(RelayInfo{Name: "osaka", Region: "ap", Neighbors: map[string]float64{"paris": 7}})
+
+	g := topo.Snapshot()
+	costs := func(from string) map[string]Cost {
+		m := make(map[string]Cost)
+		for _, e := range g.Nodes[from].Edges {
+			m[e.To] = e.Cost
+		}
+		return m
+	}
+	assert.Equal(t, map[string]Cost{"osaka": 2, "paris": 5, "ohio": 12, "unknown": 1}, costs("tokyo"))
+	assert.Equal(t, Cost(12), costs("ohio")["tokyo"], "reverse edge of a symmetric registration")
+	assert.Equal(t, Cost(7), costs("osaka")["paris"], "explicit cost is authoritative")
+}
+
+func TestCostTemplate_Unset(t *testing.T) {
+	topo := &Topology{CostTemplate: &CostTemplate{InterRegion: 5}}
+	topo.Register(RelayInfo{Name: "a", Region: "ap"})
+	topo.Register(RelayInfo{Name: "b", Region: "ap", Neighbors: map[string]float64{"a": 0}})
+	assert.Equal(t, Cost(1), topo.Snapshot().Nodes["b"].Edges[0].Cost, "unset intra_region means 1")
+}
@@ -0,0 +1,92 @@
+package topology
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightedCostModel(t *testing.T) {
+	m := WeightedCostModel{RTT: 1, Loss: 1000, Utilization: 50}
+
+	cost, components := m.EdgeCost(10, EdgeAttributes{RTTMs: 20, Loss: 0.01, Utilization: 0.5})
+	assert.Equal(t, Cost(10+20+10+25), cost)
+	assert.Equal(t, 25.0, components["utilization"])
+	assert.Equal(t, 1.0, components["weight"], "zero weight means 1")
+
+	cost, _ = m.EdgeCost(10, EdgeAttributes{Weight: 3})
+	assert.Equal(t, Cost(30), cost)
+}
+
+func TestTopology_SetEdgeAttributes(t *testing.T) {
+	topo := &Topology{CostModel: WeightedCostModel{RTT: 1, Utilization: 100}}
+	register := func() {
+		topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 10}})
+	}
+	register()
+
+	assert.False(t, topo.SetEdgeAttributes("relay-a", "relay-x", func(*EdgeAttributes) {}), "missing edge")
+
+	require.True(t, topo.SetEdgeAttributes("relay-a", "relay-b", func(a *EdgeAttributes) { a.RTTMs = 5 }))
+	require.True(t, topo.SetEdgeAttributes("relay-a", "relay-b", func(a *EdgeAttributes) { a.Utilization = 0.2 }))
+	assert.Equal(t, Cost(10+5+20), measuredCost(topo), "updates accumulate")
+
+	// The model beats probe-measured costs and survives re-registration.
+	require.True(t, topo.SetMeasuredCost("relay-a", "relay-b", 500))
+	register()
+	assert.Equal(t, Cost(35), measuredCost(topo))
+
+	// The breakdown is surfaced in /graph.
+	resp := topo.Snapshot().ToResponse()
+	require.Len(t, resp.Costs, 1)
+	assert.Equal(t, "relay-b", resp.Costs[0].To)
+	assert.Equal(t, 10.0, resp.Costs[0].Components["configured"])
+	assert.Equal(t, 20.0, resp.Costs[0].Components["utilization"])
+
+	// Overrides pin the cost and drop the breakdown.
+	require.NoError(t, topo.SetOverride(EdgeOverride{From: "relay-a", To: "relay-b", Cost: 1}))
+	assert.Empty(t, topo.Snapshot().ToResponse().Costs)
+	topo.ClearOverride("relay-a", "relay-b")
+
+	// Deregistration forgets attributes.
+	topo.Deregister("relay-b", ReasonAdmin)
+	register()
+	_, ok := topo.EdgeAttributes("relay-a", "relay-b")
+	assert.False(t, ok)
+	assert.Equal(t, Cost(10), measuredCost(topo), "configured cost again")
+}
+
+func TestTopology_EdgeAttributesPersistAndSync(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "topo.json"))
+	topo := &Topology{Store: store}
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 10}})
+	require.True(t, topo.SetEdgeAttributes("relay-a", "relay-b", func(a *EdgeAttributes) {
+		a.Utilization = 0.4
+		a.Weight = 2
+	}))
+	want := EdgeAttributes{Utilization: 0.4, Weight: 2}
+
+	restarted := &Topology{Store: store}
+	got, ok := restarted.EdgeAttributes("relay-a", "relay-b")
+	require.True(t, ok, "attributes restored from the store")
+	assert.Equal(t, want, got)
+
+	peer := &Topology{}
+	peer.Import(topo.Snapshot().ToResponse())
+	got, ok = peer.EdgeAttributes("relay-a", "relay-b")
+	require.True(t, ok, "attributes synced to a peer")
+	assert.Equal(t, want, got)
+}
+
+func TestTopology_SetEdgeAttributes_NoModel(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 10}})
+
+	require.True(t, topo.SetEdgeAttributes("relay-a", "relay-b", func(a *EdgeAttributes) { a.Weight = 4 }))
+	assert.Equal(t, Cost(10), measuredCost(topo), "attributes are inert without a model")
+
+	require.True(t, topo.SetMeasuredCost("relay-a", "relay-b", 7))
+	assert.Equal(t, Cost(7), measuredCost(topo))
+}
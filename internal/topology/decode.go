@@ -0,0 +1,119 @@
+package topology
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Bounds on request bodies, so that malformed or huge bodies cannot
+// exhaust the controller's memory. Bodies sent compressed are bounded
+// after decompression.
+const (
+	// MaxRequestBytes bounds the body of a registration or another small
+	// JSON request.
+	MaxRequestBytes = 1 << 20
+
+	// MaxSyncBytes bounds a topology snapshot pushed to PUT /sync or pulled
+	// from a peer, which carries the whole graph.
+	MaxSyncBytes = 64 << 20
+
+	// MaxJSONDepth bounds the nesting of objects and arrays in a JSON body.
+	// No request of the API nests deeper than a handful of levels.
+	MaxJSONDepth = 32
+)
+
+// ErrBodyTooLarge is returned by DecodeJSON for a body over its limit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// DecodeJSON decodes the JSON body of r into v, reading at most limit
+// bytes and refusing bodies nested deeper than MaxJSONDepth. An empty body
+// is io.EOF, as with json.Decoder.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, limit int64, v any) error {
+	data, err := readBody(w, r, limit)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return io.EOF
+	}
+	return unmarshalJSON(data, v)
+}
+
+// DecodeResponse decodes the JSON response body r into v, reading at most
+// limit bytes and refusing bodies nested deeper than MaxJSONDepth.
+func DecodeResponse(r io.Reader, limit int64, v any) error {
+	data, err := readLimited(r, limit)
+	if err != nil {
+		return err
+	}
+	return unmarshalJSON(data, v)
+}
+
+// DecodeErrorStatus returns the status code answering a DecodeJSON error:
+// 413 for a body over its limit and 400 otherwise.
+func DecodeErrorStatus(err error) int {
+	if errors.Is(err, ErrBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// readBody reads the body of r, at most limit bytes.
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, limit)
+	}
+	return data, err
+}
+
+// readLimited reads at most limit bytes from a response body.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err == nil && int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, limit)
+	}
+	return data, err
+}
+
+// unmarshalJSON decodes data into v once checkJSONDepth accepts it.
+func unmarshalJSON(data []byte, v any) error {
+	if err := checkJSONDepth(data, MaxJSONDepth); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// checkJSONDepth returns an error if objects and arrays in data nest deeper
+// than max. It does not validate data otherwise.
+func checkJSONDepth(data []byte, max int) error {
+	depth := 0
+	inString, escaped := false, false
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			if depth++; depth > max {
+				return fmt.Errorf("JSON nested deeper than %d levels", max)
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return nil
+}
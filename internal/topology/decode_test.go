@@ -0,0 +1,130 @@
+package topology
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	decode := func(body string, limit int64) error {
+		var v map[string]any
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		return DecodeJSON(httptest.NewRecorder(), req, limit, &v)
+	}
+
+	assert.NoError(t, decode(`{"a": [1, {"b": "]]"}]}`, 64))
+	assert.ErrorIs(t, decode(" \n", 64), io.EOF)
+
+	err := decode(`{"a": "`+strings.Repeat("x", 64)+`"}`, 64)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, DecodeErrorStatus(err))
+
+	err = decode(strings.Repeat("[", MaxJSONDepth+1)+strings.Repeat("]", MaxJSONDepth+1), 1<<10)
+	assert.ErrorContains(t, err, "nested deeper")
+	assert.Equal(t, http.StatusBadRequest, DecodeErrorStatus(err))
+}
+
+func TestCheckJSONDepth(t *testing.T) {
+	assert.NoError(t, checkJSONDepth([]byte(`[[["{{{{"]]]`), 3))
+	assert.NoError(t, checkJSONDepth([]byte(`[["\"[[["]]`), 2))
+	assert.Error(t, checkJSONDepth([]byte(`[[[]]]`), 2))
+}
+
+func TestDecodeResponse(t *testing.T) {
+	var v []int
+	require.NoError(t, DecodeResponse(strings.NewReader(`[1,2,3]`), 7, &v))
+	assert.Equal(t, []int{1, 2, 3}, v)
+	assert.ErrorIs(t, DecodeResponse(strings.NewReader(`[1,2,3] `), 7, &v), ErrBodyTooLarge)
+}
+
+func TestNewNodeHandlerFunc_PUT_TooLarge(t *testing.T) {
+	topo := &Topology{}
+	handler := NewNodeHandlerFunc(topo)
+
+	body := `{"region": "` + strings.Repeat("x", MaxRequestBytes) + `"}`
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPut, "/relay/relay-a", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Empty(t, topo.Snapshot().Nodes)
+}
+
+func TestSyncHandlerFunc_PUT_TooDeep(t *testing.T) {
+	topo := &Topology{}
+	handler := SyncHandlerFunc(topo)
+
+	body := `{"nodes": ` + strings.Repeat("[", MaxJSONDepth) + strings.Repeat("]", MaxJSONDepth) + `}`
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPut, "/sync", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// The fuzz targets below check that no body makes the controller panic or
+// answer other than with a success or a client error.
+
+func FuzzRegisterRequest(f *testing.F) {
+	f.Add([]byte(`{"region":"us-east-1","neighbors":{"relay-b":2.5,"relay-c":1}}`))
+	f.Add([]byte(`{"address":"https://a:4433","location":{"lat":35.6,"lon":139.7},"symmetric":true,"reverse_costs":{"relay-b":3}}`))
+	f.Add([]byte(`{"neighbors":{"relay-a":-1,"":0}}`))
+	f.Add([]byte(`[[[[{}]]]]`))
+	f.Add([]byte(`{"neighbors":null}`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		topo := &Topology{}
+		handler := NewNodeHandlerFunc(topo)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPut, "/relay/relay-a", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK && rec.Code/100 != 4 {
+			t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func FuzzGraphResponse(f *testing.F) {
+	seed, err := json.Marshal(sampleGraphResponse())
+	require.NoError(f, err)
+	f.Add(seed)
+	f.Add([]byte(`{"nodes":[{"id":"a"}],"adjacency":{"a":{"b":1},"c":null}}`))
+	f.Add([]byte(`{"overrides":[{"from":"a","to":"b","down":true}],"pins":[{"from":"a","to":"b","path":["a","x","b"]}]}`))
+	f.Add([]byte(`{"nodes":null,"adjacency":{"":{"":-1e308}}}`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		topo := &Topology{}
+		handler := SyncHandlerFunc(topo)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPut, "/sync", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK && rec.Code != http.StatusBadRequest {
+			t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+		}
+		if rec.Code == http.StatusOK {
+			topo.Snapshot().ToResponse() // the restored graph must be usable
+		}
+	})
+}
+
+func FuzzUnmarshalProtobuf(f *testing.F) {
+	f.Add(MarshalProtobuf(sampleGraphResponse()))
+	f.Add([]byte{0x0a, 0x02, 0x0a, 0x00})
+	f.Add([]byte{0x12, 0xff, 0xff, 0xff, 0xff, 0x0f})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		resp, err := UnmarshalProtobuf(data)
+		if err != nil {
+			return
+		}
+		// A decoded snapshot must survive a round trip and a restore
+		if _, err := UnmarshalProtobuf(MarshalProtobuf(resp)); err != nil {
+			t.Fatalf("re-encoded snapshot does not decode: %v", err)
+		}
+		(&Topology{}).Restore(FromResponse(resp))
+	})
+}
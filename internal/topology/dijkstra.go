@@ -77,6 +77,36 @@ func shortestPath(g *Graph, src, dst string) ([]string, Cost, error) {
 	return path, dist[dst], nil
 }
 
+// distances computes the cost of the shortest path from src to every node
+// reachable from it, including src itself at zero cost.
+func distances(g *Graph, src string) map[string]Cost {
+	dist := map[string]Cost{src: 0}
+	if _, ok := g.Nodes[src]; !ok {
+		return dist
+	}
+
+	pq := &priorityQueue{}
+	heap.Push(pq, &pqItem{nodeID: src, cost: 0})
+	for pq.Len() > 0 {
+		item := heap.Pop(pq).(*pqItem)
+		if item.cost > dist[item.nodeID] {
+			continue // stale entry
+		}
+		node, ok := g.Nodes[item.nodeID]
+		if !ok {
+			continue // edge to an unregistered node
+		}
+		for _, edge := range node.Edges {
+			alt := item.cost + edge.Cost
+			if d, seen := dist[edge.To]; !seen || alt < d {
+				dist[edge.To] = alt
+				heap.Push(pq, &pqItem{nodeID: edge.To, cost: alt})
+			}
+		}
+	}
+	return dist
+}
+
 // --- priority queue for Dijkstra ---
 
 type pqItem struct {
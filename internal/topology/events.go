@@ -0,0 +1,92 @@
+package topology
+
+import (
+	"slices"
+	"time"
+)
+
+// maxNodeEvents is how many recent events are kept per relay.
+const maxNodeEvents = 20
+
+// Node event types.
+const (
+	EventRegistered       = "registered"        // first heartbeat, or first after removal
+	EventNeighborsChanged = "neighbors_changed" // heartbeat with a different neighbor set
+	EventDeregistered     = "deregistered"      // detail is the reason
+	EventExpired          = "expired"           // removed by the sweeper after NodeTTL
+	EventOverrideSet      = "override_set"
+	EventOverrideCleared  = "override_cleared"
+	EventSeeded           = "seeded" // added from the seed file, not live yet
+
+	EventMaintenanceScheduled = "maintenance_scheduled"
+	EventMaintenanceCanceled  = "maintenance_canceled"
+	EventCordoned             = "cordoned"   // maintenance window started
+	EventUncordoned           = "uncordoned" // maintenance window ended or canceled
+
+	EventRoutePinned   = "route_pinned"
+	EventRouteUnpinned = "route_unpinned"
+)
+
+// NodeEvent is a change to a relay's place in the topology.
+type NodeEvent struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Node returns a copy of the named relay's node.
+func (t *Topology) Node(name string) (Node, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.init()
+
+	node, ok := t.graph.Nodes[name]
+	if !ok {
+		return Node{}, false
+	}
+	cp := *node
+	cp.Edges = slices.Clone(node.Edges)
+	return cp, true
+}
+
+// NodeEvents returns the recent events of the named relay, newest first.
+// Events outlive the node, so a relay that was removed still shows why.
+// They are kept in memory only and are not synced to peers.
+func (t *Topology) NodeEvents(name string) []NodeEvent {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	events := slices.Clone(t.events[name])
+	slices.Reverse(events)
+	return events
+}
+
+// recordEvent appends an event to name's history, dropping the oldest
+// beyond maxNodeEvents. Caller must hold the write lock.
+func (t *Topology) recordEvent(name, typ, detail string) {
+	if t.events == nil {
+		t.events = make(map[string][]NodeEvent)
+	}
+	events := append(t.events[name], NodeEvent{Time: time.Now(), Type: typ, Detail: detail})
+	if len(events) > maxNodeEvents {
+		events = slices.Clone(events[len(events)-maxNodeEvents:])
+	}
+	t.events[name] = events
+}
+
+// neighborsChanged reports whether the explicit (non-Auto) edges of prev
+// go to a different set of relays than neighbors.
+func neighborsChanged(prev []Edge, neighbors map[string]float64) bool {
+	n := 0
+	for _, e := range prev {
+		if e.Auto {
+			continue
+		}
+		if _, ok := neighbors[e.To]; !ok {
+			return true
+		}
+		n++
+	}
+	return n != len(neighbors)
+}
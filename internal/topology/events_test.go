@@ -0,0 +1,73 @@
+package topology
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func eventTypes(events []NodeEvent) []string {
+	types := make([]string, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+	}
+	return types
+}
+
+func TestTopology_NodeEvents(t *testing.T) {
+	topo := overrideTopo()
+
+	// Heartbeats with the same neighbors record nothing
+	topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 2, "c": 5}})
+	topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1}})
+	require.NoError(t, topo.SetOverride(EdgeOverride{From: "a", To: "b", Down: true, Reason: "maintenance"}))
+	topo.ClearOverride("a", "b")
+	topo.Deregister("a", ReasonAdmin)
+
+	events := topo.NodeEvents("a")
+	assert.Equal(t, []string{
+		EventDeregistered, EventOverrideCleared, EventOverrideSet, EventNeighborsChanged, EventRegistered,
+	}, eventTypes(events), "newest first")
+	assert.Equal(t, "to b: down (maintenance)", events[2].Detail)
+
+	// Neighbor stubs have no events until they register themselves
+	topo.Register(RelayInfo{Name: "x", Neighbors: map[string]float64{"stub": 1}})
+	assert.Empty(t, topo.NodeEvents("stub"))
+	topo.Register(RelayInfo{Name: "stub"})
+	assert.Equal(t, []string{EventRegistered}, eventTypes(topo.NodeEvents("stub")))
+}
+
+func TestTopology_NodeEvents_Expired(t *testing.T) {
+	topo := &Topology{NodeTTL: time.Millisecond}
+	topo.Register(RelayInfo{Name: "a"})
+	time.Sleep(5 * time.Millisecond)
+	topo.SweepStaleNodes()
+
+	_, ok := topo.Node("a")
+	assert.False(t, ok)
+	assert.Equal(t, []string{EventExpired, EventRegistered}, eventTypes(topo.NodeEvents("a")))
+}
+
+func TestTopology_NodeEvents_Bounded(t *testing.T) {
+	topo := &Topology{}
+	for i := range maxNodeEvents + 5 {
+		topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{fmt.Sprint(i): 1}})
+	}
+	events := topo.NodeEvents("a")
+	assert.Len(t, events, maxNodeEvents)
+	assert.Equal(t, EventNeighborsChanged, events[len(events)-1].Type, "oldest dropped")
+}
+
+func TestTopology_Node(t *testing.T) {
+	topo := overrideTopo()
+	node, ok := topo.Node("a")
+	require.True(t, ok)
+	assert.Len(t, node.Edges, 2)
+
+	node.Edges[0].Cost = 99 // a copy
+	again, _ := topo.Node("a")
+	assert.NotEqual(t, Cost(99), again.Edges[0].Cost)
+}
@@ -0,0 +1,161 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Generation returns a counter that advances with every change to what
+// /graph and /route answer from: registrations that change a relay or its
+// edges, deregistrations, overrides, pins, maintenance, cost updates and
+// restores. Heartbeats that change nothing leave it as it is.
+func (t *Topology) Generation() uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.init()
+
+	return t.generation
+}
+
+// ETag returns the weak entity tag of answers computed from the current
+// generation. It is a hash of the state /graph and /route answer from,
+// computed once per generation, so controllers holding the same state hand
+// out the same tags: a restarted controller, and the read replicas synced
+// from one writer behind a load balancer. Read it before computing the
+// answer it tags: an answer newer than its tag is only revalidated once
+// more.
+func (t *Topology) ETag() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.init()
+
+	t.tagMu.Lock()
+	defer t.tagMu.Unlock()
+	if t.tag == "" || t.tagGeneration != t.generation {
+		t.tag, t.tagGeneration = t.stateTag(), t.generation
+	}
+	return t.tag
+}
+
+// stateTag hashes the graph and the relay health, leaving out the
+// heartbeat times, which change nothing answered from them but whether a
+// relay registered. Caller must hold at least a read lock.
+func (t *Topology) stateTag() string {
+	state := struct {
+		Graph      GraphResponse
+		Registered []string
+		Health     map[string]Health
+	}{
+		Graph: t.graph.ToResponse(),
+	}
+	// Empty and missing are the same state, however a controller got there
+	if len(t.health) > 0 {
+		state.Health = t.health
+	}
+	if len(state.Graph.Overrides) == 0 {
+		state.Graph.Overrides = nil
+	}
+	if len(state.Graph.Maintenance) == 0 {
+		state.Graph.Maintenance = nil
+	}
+	if len(state.Graph.Pins) == 0 {
+		state.Graph.Pins = nil
+	}
+	slices.SortFunc(state.Graph.Nodes, func(a, b NodeResponse) int { return strings.Compare(a.ID, b.ID) })
+	for i, n := range state.Graph.Nodes {
+		if !n.LastSeen.IsZero() {
+			state.Registered = append(state.Registered, n.ID)
+		}
+		state.Graph.Nodes[i].LastSeen = time.Time{}
+	}
+
+	h := fnv.New64a()
+	if err := json.NewEncoder(h).Encode(state); err != nil {
+		// Not expected: the graph is what /graph encodes
+		return fmt.Sprintf(`W/"g%d"`, t.generation)
+	}
+	return `W/"` + strconv.FormatUint(h.Sum64(), 36) + `"`
+}
+
+// relayState is what /graph and /route see of one relay: its attributes,
+// the edges from it and those to it from the relays a registration can
+// touch, and the size of the graph around it, which grows when it names
+// new neighbors.
+type relayState struct {
+	node  NodeResponse
+	out   map[string]Edge // to → edge
+	in    map[string]Edge // from → edge
+	nodes int
+}
+
+// relayPeers returns the relays whose edges to reg's relay the
+// registration can change: the neighbors it names, those it has edges to,
+// and the targets of overrides on its edges, which may have removed an edge
+// whose automatic reverse remains. Caller must hold at least a read lock.
+func (t *Topology) relayPeers(reg RelayInfo) []string {
+	peers := make([]string, 0, len(reg.Neighbors))
+	for nb := range reg.Neighbors {
+		peers = append(peers, nb)
+	}
+	if n, ok := t.graph.Nodes[reg.Name]; ok {
+		for _, e := range n.Edges {
+			peers = append(peers, e.To)
+		}
+	}
+	for _, o := range t.graph.Overrides {
+		if o.From == reg.Name {
+			peers = append(peers, o.To)
+		}
+	}
+	return peers
+}
+
+// relayState captures the state of the named relay, with the edges to it
+// from peers, to tell whether a registration changed it. Caller must hold
+// at least a read lock.
+func (t *Topology) relayState(name string, peers []string) relayState {
+	s := relayState{nodes: len(t.graph.Nodes)}
+	if n, ok := t.graph.Nodes[name]; ok {
+		s.node = NodeResponse{
+			ID:       n.ID,
+			Region:   n.Region,
+			Zone:     n.Zone,
+			Address:  n.Address,
+			Location: n.Location,
+			Version:  n.Version,
+			Cordoned: n.Cordoned,
+		}
+		s.out = make(map[string]Edge, len(n.Edges))
+		for _, e := range n.Edges {
+			e.base = 0 // not visible
+			s.out[e.To] = e
+		}
+	}
+	s.in = make(map[string]Edge, len(peers))
+	for _, id := range peers {
+		p, ok := t.graph.Nodes[id]
+		if !ok || id == name {
+			continue
+		}
+		for _, e := range p.Edges {
+			if e.To == name {
+				e.base = 0
+				s.in[id] = e
+				break
+			}
+		}
+	}
+	return s
+}
+
+func (s relayState) equal(other relayState) bool {
+	return reflect.DeepEqual(s, other)
+}
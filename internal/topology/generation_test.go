@@ -0,0 +1,135 @@
+package topology
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopology_Generation(t *testing.T) {
+	topo := &Topology{}
+	reg := RelayInfo{Name: "a", Address: "https://a:4433", Neighbors: map[string]float64{"b": 1, "c": 2}, Symmetric: true}
+	require.NoError(t, topo.Register(reg))
+	gen := topo.Generation()
+	assert.NotZero(t, gen)
+
+	// Heartbeats that change nothing keep the generation
+	for range 5 {
+		require.NoError(t, topo.Register(reg))
+	}
+	assert.Equal(t, gen, topo.Generation())
+
+	changes := map[string]func(){
+		"address":  func() { reg.Address = "https://a:4434"; topo.Register(reg) },
+		"cost":     func() { reg.Neighbors = map[string]float64{"b": 3, "c": 2}; topo.Register(reg) },
+		"neighbor": func() { reg.Neighbors = map[string]float64{"b": 3, "d": 1}; topo.Register(reg) },
+		"reverse":  func() { reg.ReverseCosts = map[string]float64{"b": 7}; topo.Register(reg) },
+		"override": func() { topo.SetOverride(EdgeOverride{From: "a", To: "b", Cost: 9}) },
+		"measured": func() { topo.SetMeasuredCost("b", "a", 4) },
+		"removed":  func() { topo.Deregister("d", "admin") },
+		"restored": func() { topo.Restore(topo.Snapshot()) },
+	}
+	for _, name := range []string{"address", "cost", "neighbor", "reverse", "override", "measured", "removed", "restored"} {
+		changes[name]()
+		assert.Greater(t, topo.Generation(), gen, name)
+		gen = topo.Generation()
+	}
+}
+
+func TestTopology_Generation_ReverseEdgeBehindDownOverride(t *testing.T) {
+	topo := &Topology{}
+	reg := RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1, "c": 1}, Symmetric: true}
+	require.NoError(t, topo.Register(reg))
+	topo.SetOverride(EdgeOverride{From: "a", To: "b", Down: true})
+	gen := topo.Generation()
+
+	// a no longer has an edge to b, but dropping b must still remove b's
+	// automatic edge back to a
+	reg.Neighbors = map[string]float64{"c": 1}
+	require.NoError(t, topo.Register(reg))
+	assert.Greater(t, topo.Generation(), gen)
+	assert.Empty(t, topo.Snapshot().Nodes["b"].Edges)
+}
+
+func TestTopology_ETag(t *testing.T) {
+	topo := &Topology{}
+	tag := topo.ETag()
+	assert.Regexp(t, `^W/"[0-9a-z]+"$`, tag)
+
+	topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1}})
+	assert.NotEqual(t, tag, topo.ETag())
+	tag = topo.ETag()
+
+	// Controllers holding the same state agree, whatever their heartbeats
+	replica := &Topology{}
+	replica.Restore(topo.Snapshot())
+	assert.Equal(t, tag, replica.ETag())
+	topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1}})
+	assert.Equal(t, tag, topo.ETag())
+
+	replica.SetHealth(map[string]Health{"b": HealthUnreachable})
+	assert.NotEqual(t, tag, replica.ETag())
+	replica.SetHealth(nil)
+	assert.Equal(t, tag, replica.ETag())
+}
+
+func TestGraphHandlerFunc_ETag(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "A", Neighbors: map[string]float64{"B": 1}})
+	handler := GraphHandlerFunc(topo)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/graph", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req := httptest.NewRequest(http.MethodGet, "/graph", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, etag, rec.Header().Get("ETag"))
+
+	topo.Register(RelayInfo{Name: "A", Neighbors: map[string]float64{"B": 2}})
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+}
+
+func TestRouteHandlerFunc_ETag(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "A", Neighbors: map[string]float64{"B": 1}})
+	topo.Register(RelayInfo{Name: "B", Neighbors: map[string]float64{}})
+	handler := RouteHandlerFunc(topo)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/route?from=A&to=B", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req := httptest.NewRequest(http.MethodGet, "/route?from=A&to=B", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	// No tag on errors
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/route?from=B&to=A", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Header().Get("ETag"))
+
+	// External routers answer every request
+	topo.Router = &HTTPRouter{URL: "http://127.0.0.1:0/route"}
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("ETag"))
+}
@@ -1,11 +1,28 @@
 package topology
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 // Graph represents a topology graph using adjacency lists.
 // Nodes are indexed by their ID for O(1) lookup.
 type Graph struct {
 	Nodes map[string]*Node
+
+	// Overrides are operator edits applied on top of relay-reported edges.
+	Overrides []EdgeOverride
+
+	// Maintenance are the scheduled and active maintenance windows.
+	Maintenance []MaintenanceWindow
+
+	// Pins are operator-fixed paths returned by Route instead of the
+	// computed ones.
+	Pins []RoutePin
+
+	// Attributes are the cost model inputs of edges, keyed by (from, to);
+	// see Topology.SetEdgeAttributes.
+	Attributes map[[2]string]EdgeAttributes
 }
 
 // newGraph creates an empty graph.
@@ -40,42 +57,106 @@ func (g *Graph) addEdge(src, dst string, cost Cost) {
 type Node struct {
 	ID       string    `json:"id"`
 	Region   string    `json:"region"`
-	Address  string    `json:"address,omitempty"` // MoQT endpoint URL
+	Zone     string    `json:"zone,omitempty"`     // failure domain (e.g. availability zone)
+	Address  string    `json:"address,omitempty"`  // MoQT endpoint URL
+	Location *Location `json:"location,omitempty"` // Optional geographic position
+	Version  string    `json:"version,omitempty"`  // relay build version, from its heartbeats
+	Cordoned bool      `json:"cordoned,omitempty"` // in a maintenance window
 	Edges    []Edge    `json:"edges"`
 	LastSeen time.Time `json:"last_seen"` // Updated on each Register; used by sweeper
 }
 
+// Location is a geographic position in decimal degrees.
+type Location struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
 // Edge represents a directed connection to another node.
 type Edge struct {
 	To   string `json:"to"`
 	Cost Cost   `json:"cost"`
+
+	// Auto marks a reverse edge added on behalf of a relay that registered
+	// with Symmetric set. Explicit registrations override it.
+	Auto bool `json:"auto,omitempty"`
+
+	// Components is the cost model's breakdown of Cost, if one applied.
+	Components map[string]float64 `json:"components,omitempty"`
+
+	// base is the cost the relay registered, before measurements and the
+	// cost model. Zero for edges restored from a snapshot.
+	base Cost
 }
 
 // GraphResponse is the JSON response for the gateway GET /graph endpoint.
 type GraphResponse struct {
 	Nodes     []NodeResponse                `json:"nodes"`
 	Adjacency map[string]map[string]float64 `json:"adjacency"`
+	Overrides []EdgeOverride                `json:"overrides,omitempty"`
+
+	Attributes  []EdgeAttributesResponse `json:"attributes,omitempty"`
+	Maintenance []MaintenanceWindow      `json:"maintenance,omitempty"`
+	Pins        []RoutePin               `json:"pins,omitempty"`
+
+	// TakenAt is when a /sync snapshot was taken; the merge strategy keeps
+	// local nodes heard from since. Zero outside of /sync.
+	TakenAt time.Time `json:"taken_at,omitzero"`
+
+	// Costs breaks down the edges a cost model priced. Informational; it is
+	// not part of the sync snapshot.
+	Costs []EdgeCostResponse `json:"costs,omitempty"`
+}
+
+// EdgeCostResponse is one edge's cost model breakdown in /graph.
+type EdgeCostResponse struct {
+	From       string             `json:"from"`
+	To         string             `json:"to"`
+	Cost       float64            `json:"cost"`
+	Components map[string]float64 `json:"components"`
+}
+
+// EdgeAttributesResponse is one edge's attributes in a graph response.
+type EdgeAttributesResponse struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	EdgeAttributes
 }
 
 // NodeResponse is a node in the graph response.
 type NodeResponse struct {
-	ID      string `json:"id"`
-	Region  string `json:"region"`
-	Address string `json:"address,omitempty"`
+	ID       string    `json:"id"`
+	Region   string    `json:"region"`
+	Zone     string    `json:"zone,omitempty"`
+	Address  string    `json:"address,omitempty"`
+	Location *Location `json:"location,omitempty"`
+	Version  string    `json:"version,omitempty"`
+	Cordoned bool      `json:"cordoned,omitempty"` // derived from Maintenance; not synced
+	LastSeen time.Time `json:"last_seen,omitzero"` // last heartbeat; zero for seeded nodes
 }
 
 // ToResponse converts the graph into a flat response structure.
 func (g *Graph) ToResponse() GraphResponse {
 	resp := GraphResponse{
-		Nodes:     make([]NodeResponse, 0, len(g.Nodes)),
-		Adjacency: make(map[string]map[string]float64),
+		Nodes:      make([]NodeResponse, 0, len(g.Nodes)),
+		Adjacency:  make(map[string]map[string]float64),
+		Overrides:  g.Overrides,
+		Attributes: g.attributeList(),
+
+		Maintenance: g.Maintenance,
+		Pins:        g.Pins,
 	}
 
 	for _, n := range g.Nodes {
 		resp.Nodes = append(resp.Nodes, NodeResponse{
-			ID:      n.ID,
-			Region:  n.Region,
-			Address: n.Address,
+			ID:       n.ID,
+			Region:   n.Region,
+			Zone:     n.Zone,
+			Address:  n.Address,
+			Location: n.Location,
+			Version:  n.Version,
+			Cordoned: n.Cordoned,
+			LastSeen: n.LastSeen,
 		})
 
 		// Build adjacency map (efficient for Dijkstra/routing)
@@ -83,9 +164,24 @@ func (g *Graph) ToResponse() GraphResponse {
 			resp.Adjacency[n.ID] = make(map[string]float64)
 			for _, e := range n.Edges {
 				resp.Adjacency[n.ID][e.To] = float64(e.Cost)
+				if e.Components != nil {
+					resp.Costs = append(resp.Costs, EdgeCostResponse{
+						From:       n.ID,
+						To:         e.To,
+						Cost:       float64(e.Cost),
+						Components: e.Components,
+					})
+				}
 			}
 		}
 	}
+	sort.Slice(resp.Costs, func(i, j int) bool {
+		a, b := resp.Costs[i], resp.Costs[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
 
 	return resp
 }
@@ -98,10 +194,14 @@ func FromResponse(resp GraphResponse) *Graph {
 	// Create nodes.
 	for _, nr := range resp.Nodes {
 		g.addNode(&Node{
-			ID:      nr.ID,
-			Region:  nr.Region,
-			Address: nr.Address,
-			Edges:   []Edge{},
+			ID:       nr.ID,
+			Region:   nr.Region,
+			Zone:     nr.Zone,
+			Address:  nr.Address,
+			Location: nr.Location,
+			Version:  nr.Version,
+			Edges:    []Edge{},
+			LastSeen: nr.LastSeen,
 		})
 	}
 
@@ -118,5 +218,96 @@ func FromResponse(resp GraphResponse) *Graph {
 		}
 	}
 
+	g.Overrides = resp.Overrides
+	g.Maintenance = resp.Maintenance
+	g.Pins = resp.Pins
+	g.setAttributeList(resp.Attributes)
+
 	return g
 }
+
+// attributeList returns the edge attributes sorted by edge, or nil if
+// there are none.
+func (g *Graph) attributeList() []EdgeAttributesResponse {
+	if len(g.Attributes) == 0 {
+		return nil
+	}
+	list := make([]EdgeAttributesResponse, 0, len(g.Attributes))
+	for key, a := range g.Attributes {
+		list = append(list, EdgeAttributesResponse{From: key[0], To: key[1], EdgeAttributes: a})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].From != list[j].From {
+			return list[i].From < list[j].From
+		}
+		return list[i].To < list[j].To
+	})
+	return list
+}
+
+// setAttributeList replaces the edge attributes with list.
+func (g *Graph) setAttributeList(list []EdgeAttributesResponse) {
+	g.Attributes = nil
+	if len(list) == 0 {
+		return
+	}
+	g.Attributes = make(map[[2]string]EdgeAttributes, len(list))
+	for _, a := range list {
+		g.Attributes[[2]string{a.From, a.To}] = a.EdgeAttributes
+	}
+}
+
+// Asymmetry is a one-way link: From has an edge to To, but not the reverse.
+type Asymmetry struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Cost   float64 `json:"cost"`
+	Reason string  `json:"reason"`
+}
+
+// Asymmetries lists every directed edge without a matching reverse edge,
+// sorted by From then To.
+func (g *Graph) Asymmetries() []Asymmetry {
+	result := []Asymmetry{}
+	for _, n := range g.Nodes {
+		for _, e := range n.Edges {
+			target, ok := g.Nodes[e.To]
+			if ok && target.hasEdgeTo(n.ID) {
+				continue
+			}
+			reason := "reverse edge missing"
+			if !ok || target.LastSeen.IsZero() {
+				reason = "target not registered"
+			}
+			result = append(result, Asymmetry{
+				From:   n.ID,
+				To:     e.To,
+				Cost:   float64(e.Cost),
+				Reason: reason,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].From != result[j].From {
+			return result[i].From < result[j].From
+		}
+		return result[i].To < result[j].To
+	})
+	return result
+}
+
+// Registered reports whether the relay has registered or sent a heartbeat,
+// as opposed to a node only planned in a Seed.
+func (n *Node) Registered() bool {
+	return !n.LastSeen.IsZero()
+}
+
+// hasEdgeTo reports whether n has an edge to the given node.
+func (n *Node) hasEdgeTo(id string) bool {
+	for _, e := range n.Edges {
+		if e.To == id {
+			return true
+		}
+	}
+	return false
+}
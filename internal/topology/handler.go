@@ -2,16 +2,21 @@ package topology
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // RelayRegistrationHandler serves the relay registration API (write operations):
 //
 //	PUT    /relay/<name>   — register/update a relay and its neighbors
-//	DELETE /relay/<name>   — remove a relay from the topology
+//	DELETE /relay/<name>   — remove a relay from the topology (?reason=shutdown|admin)
 //
-// Payloads use the RelayRegistration type.
+// Payloads use the RelayRegistration type. A PUT refused by Validation gets
+// 400; by Limits, 413 for too many neighbors or 403 for a full graph.
 type RelayRegistrationHandler struct {
 	Topology *Topology
 }
@@ -20,8 +25,14 @@ type RelayRegistrationHandler struct {
 // Neighbors maps neighbor name → edge cost (0 or omitted defaults to 1).
 type registerRequest struct {
 	Region    string             `json:"region,omitempty"`
+	Zone      string             `json:"zone,omitempty"`    // failure domain
 	Address   string             `json:"address,omitempty"` // MoQT endpoint URL
+	Location  *Location          `json:"location,omitempty"`
 	Neighbors map[string]float64 `json:"neighbors"`
+	Version   string             `json:"version,omitempty"` // relay build version
+
+	Symmetric    bool               `json:"symmetric,omitempty"`
+	ReverseCosts map[string]float64 `json:"reverse_costs,omitempty"`
 }
 
 // NewNodeHandlerFunc returns an http.HandlerFunc for relay registration
@@ -50,17 +61,34 @@ func NewNodeHandlerFunc(topo *Topology) http.HandlerFunc {
 
 func (h *RelayRegistrationHandler) handlePut(w http.ResponseWriter, r *http.Request, name string) {
 	var req registerRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		jsonError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+	if err := DecodeJSON(w, r, MaxRequestBytes, &req); err != nil {
+		jsonError(w, DecodeErrorStatus(err), "invalid JSON: "+err.Error())
 		return
 	}
 
-	h.Topology.Register(RelayInfo{
-		Name:      name,
-		Region:    req.Region,
-		Address:   req.Address,
-		Neighbors: req.Neighbors,
+	err := h.Topology.Register(RelayInfo{
+		Name:         name,
+		Region:       req.Region,
+		Zone:         req.Zone,
+		Address:      req.Address,
+		Location:     req.Location,
+		Neighbors:    req.Neighbors,
+		Version:      req.Version,
+		Symmetric:    req.Symmetric,
+		ReverseCosts: req.ReverseCosts,
 	})
+	var limit *LimitError
+	switch {
+	case errors.As(err, &limit) && limit.Limit == LimitEdgesPerNode:
+		jsonError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case errors.As(err, &limit):
+		jsonError(w, http.StatusForbidden, err.Error())
+		return
+	case err != nil:
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -70,51 +98,181 @@ func (h *RelayRegistrationHandler) handlePut(w http.ResponseWriter, r *http.Requ
 	})
 }
 
-func (h *RelayRegistrationHandler) handleDelete(w http.ResponseWriter, _ *http.Request, name string) {
-	removed := h.Topology.Deregister(name)
+func (h *RelayRegistrationHandler) handleDelete(w http.ResponseWriter, r *http.Request, name string) {
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = ReasonAdmin
+	}
+	if !ValidDeregisterReason(reason) || reason == ReasonTTLExpired {
+		jsonError(w, http.StatusBadRequest, "reason must be shutdown or admin")
+		return
+	}
+
+	removed := h.Topology.Deregister(name, reason)
 	if !removed {
 		jsonError(w, http.StatusNotFound, "relay not found: "+name)
 		return
 	}
+	slog.Info("relay deregistered", "relay", name, "reason", reason)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"status": "deregistered",
 		"relay":  name,
+		"reason": reason,
 	})
 }
 
-// RouteHandlerFunc returns an http.HandlerFunc that computes a route
-// between `from` and `to` using the provided Topology.
-func RouteHandlerFunc(topo *Topology) http.HandlerFunc {
+// RelayHistoryHandlerFunc returns an http.HandlerFunc that serves a relay's
+// tombstones and recent events, including after it left the topology.
+//
+//	GET /relay/<name>/history
+func RelayHistoryHandlerFunc(topo *Topology) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
 
-		from := r.URL.Query().Get("from")
-		to := r.URL.Query().Get("to")
+		name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/relay/"), "/history")
+		if !ok || name == "" || strings.Contains(name, "/") {
+			jsonError(w, http.StatusBadRequest, "path must be /relay/<name>/history")
+			return
+		}
 
-		if from == "" || to == "" {
-			jsonError(w, http.StatusBadRequest, "'from' and 'to' query parameters are required")
+		h, ok := topo.History(name)
+		if !ok {
+			jsonError(w, http.StatusNotFound, "relay not found: "+name)
 			return
 		}
 
-		result, err := topo.Route(from, to)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(h)
+	}
+}
+
+// reserveRequest is the JSON body for POST /route.
+type reserveRequest struct {
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	ReserveMbps float64 `json:"reserve_mbps"`
+	TTLSec      int     `json:"ttl_sec,omitempty"`
+}
+
+// RouteHandlerFunc returns an http.HandlerFunc that computes a route
+// between `from` and `to` using the provided Topology. POST also reserves
+// bandwidth along the route, answering 409 Conflict when the links are
+// full. GET answers carry the Topology's ETag and a GET with a matching
+// If-None-Match gets 304 Not Modified, unless routes come from an
+// HTTPRouter, whose policy may change without the topology.
+//
+//	GET  /route?from=X&to=Y
+//	POST /route  — {"from","to","reserve_mbps": 50, "ttl_sec": 7200}
+func RouteHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			result RouteResult
+			err    error
+			etag   string
+		)
+		switch r.Method {
+		case http.MethodGet:
+			from := r.URL.Query().Get("from")
+			to := r.URL.Query().Get("to")
+
+			if from == "" || to == "" {
+				jsonError(w, http.StatusBadRequest, "'from' and 'to' query parameters are required")
+				return
+			}
+
+			if _, external := topo.Router.(*HTTPRouter); !external {
+				etag = topo.ETag()
+				if notModified(w, r, etag) {
+					return
+				}
+			}
+			result, err = topo.Route(from, to)
+
+		case http.MethodPost:
+			var req reserveRequest
+			if err := DecodeJSON(w, r, MaxRequestBytes, &req); err != nil {
+				jsonError(w, DecodeErrorStatus(err), "invalid JSON: "+err.Error())
+				return
+			}
+			if req.From == "" || req.To == "" || req.ReserveMbps <= 0 || req.TTLSec < 0 {
+				jsonError(w, http.StatusBadRequest, "'from', 'to' and a positive 'reserve_mbps' are required")
+				return
+			}
+
+			result, err = topo.Reserve(req.From, req.To, req.ReserveMbps, time.Duration(req.TTLSec)*time.Second)
+			if errors.Is(err, ErrInsufficientCapacity) {
+				jsonError(w, http.StatusConflict, err.Error())
+				return
+			}
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
 		if err != nil {
 			jsonError(w, http.StatusNotFound, err.Error())
 			return
 		}
 
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(result)
 	}
 }
 
+// ReservationsHandlerFunc returns an http.HandlerFunc that lists the
+// bandwidth reservations with the load of each capacity-limited edge, or
+// releases one.
+//
+//	GET    /route/reservations
+//	DELETE /route/reservations?id=X
+func ReservationsHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			reservations, edges := topo.Reservations()
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{
+				"reservations": reservations,
+				"edges":        edges,
+			})
+
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				jsonError(w, http.StatusBadRequest, "'id' query parameter is required")
+				return
+			}
+			if !topo.Release(id) {
+				jsonError(w, http.StatusNotFound, "no reservation "+id)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "released"})
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
 // GraphHandlerFunc returns an http.HandlerFunc that serves /graph (topology).
+// Answers carry the Topology's ETag; a request with a matching
+// If-None-Match gets 304 Not Modified.
 func GraphHandlerFunc(topo *Topology) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -122,15 +280,458 @@ func GraphHandlerFunc(topo *Topology) http.HandlerFunc {
 			return
 		}
 
+		etag := topo.ETag()
+		if notModified(w, r, etag) {
+			return
+		}
 		g := topo.Snapshot()
 		resp := g.ToResponse()
 
+		w.Header().Set("ETag", etag)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(resp)
 	}
 }
 
+// AsymmetriesHandlerFunc returns an http.HandlerFunc that reports one-way
+// links in the topology, which usually indicate a relay configured with a
+// neighbor that does not list it back.
+//
+//	GET /graph/asymmetries
+func AsymmetriesHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		asym := topo.Snapshot().Asymmetries()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"asymmetries": asym,
+			"count":       len(asym),
+		})
+	}
+}
+
+// ZonesHandlerFunc returns an http.HandlerFunc that summarizes the
+// topology's failure domains and what a single-zone outage would cut off.
+//
+//	GET /graph/zones
+func ZonesHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		g := topo.Snapshot()
+		zones := g.Zones()
+		unzoned := 0
+		for _, n := range g.Nodes {
+			if n.Zone == "" {
+				unzoned++
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"zones":   zones,
+			"count":   len(zones),
+			"unzoned": unzoned,
+		})
+	}
+}
+
+// QueryHandlerFunc returns an http.HandlerFunc that evaluates a topology
+// query (see Graph.Query) against the current snapshot.
+//
+//	GET /query?q=nodes(region=eu-*) | reachable_from(relay-a) | sort(cost)
+func QueryHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query().Get("q")
+		if q == "" {
+			jsonError(w, http.StatusBadRequest, "'q' query parameter is required")
+			return
+		}
+
+		result, err := topo.Snapshot().Query(q)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// overrideRequest is the JSON body for POST /override/edge. Cost is a
+// number or the string "down".
+type overrideRequest struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Cost   json.RawMessage `json:"cost"`
+	Reason string          `json:"reason,omitempty"`
+}
+
+// OverrideHandlerFunc returns an http.HandlerFunc for manual edge
+// overrides, which take precedence over relay-reported edges until cleared.
+//
+//	GET    /override/edge                — list overrides
+//	POST   /override/edge                — {"from","to","cost": N | "down","reason"}
+//	DELETE /override/edge?from=X&to=Y    — clear an override
+func OverrideHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			overrides := topo.Overrides()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{
+				"overrides": overrides,
+				"count":     len(overrides),
+			})
+
+		case http.MethodPost:
+			var req overrideRequest
+			if err := DecodeJSON(w, r, MaxRequestBytes, &req); err != nil {
+				jsonError(w, DecodeErrorStatus(err), "invalid JSON: "+err.Error())
+				return
+			}
+			o := EdgeOverride{From: req.From, To: req.To, Reason: req.Reason}
+			var down string
+			if err := json.Unmarshal(req.Cost, &down); err == nil {
+				if down != "down" {
+					jsonError(w, http.StatusBadRequest, `cost must be a number or "down"`)
+					return
+				}
+				o.Down = true
+			} else if err := json.Unmarshal(req.Cost, &o.Cost); err != nil {
+				jsonError(w, http.StatusBadRequest, `cost must be a number or "down"`)
+				return
+			}
+
+			if err := topo.SetOverride(o); err != nil {
+				status := http.StatusBadRequest
+				if errors.Is(err, errNodeNotFound) {
+					status = http.StatusNotFound
+				}
+				jsonError(w, status, err.Error())
+				return
+			}
+			slog.Info("edge override set", "from", o.From, "to", o.To, "cost", o.Cost, "down", o.Down, "reason", o.Reason)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "overridden"})
+
+		case http.MethodDelete:
+			from := r.URL.Query().Get("from")
+			to := r.URL.Query().Get("to")
+			if from == "" || to == "" {
+				jsonError(w, http.StatusBadRequest, "'from' and 'to' query parameters are required")
+				return
+			}
+			if !topo.ClearOverride(from, to) {
+				jsonError(w, http.StatusNotFound, "no override for "+from+" -> "+to)
+				return
+			}
+			slog.Info("edge override cleared", "from", from, "to", to)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "cleared"})
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// pinRequest is the JSON body for POST /route/pin.
+type pinRequest struct {
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Path   []string `json:"path"`
+	Reason string   `json:"reason,omitempty"`
+}
+
+// RoutePinHandlerFunc returns an http.HandlerFunc for route pins, fixed
+// paths that GET /route returns for a pair until they are removed.
+//
+//	GET    /route/pin                — list pins
+//	POST   /route/pin                — {"from","to","path":[...],"reason"}
+//	DELETE /route/pin?from=X&to=Y    — remove a pin
+func RoutePinHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			pins := topo.Pins()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{
+				"pins":  pins,
+				"count": len(pins),
+			})
+
+		case http.MethodPost:
+			var req pinRequest
+			if err := DecodeJSON(w, r, MaxRequestBytes, &req); err != nil {
+				jsonError(w, DecodeErrorStatus(err), "invalid JSON: "+err.Error())
+				return
+			}
+			if req.From == "" || req.To == "" {
+				jsonError(w, http.StatusBadRequest, "'from' and 'to' are required")
+				return
+			}
+
+			p := RoutePin{From: req.From, To: req.To, Path: req.Path, Reason: req.Reason}
+			if err := topo.PinRoute(p); err != nil {
+				status := http.StatusBadRequest
+				if errors.Is(err, errNodeNotFound) {
+					status = http.StatusNotFound
+				}
+				jsonError(w, status, err.Error())
+				return
+			}
+			slog.Info("route pinned", "from", p.From, "to", p.To, "path", p.Path, "reason", p.Reason)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "pinned"})
+
+		case http.MethodDelete:
+			from := r.URL.Query().Get("from")
+			to := r.URL.Query().Get("to")
+			if from == "" || to == "" {
+				jsonError(w, http.StatusBadRequest, "'from' and 'to' query parameters are required")
+				return
+			}
+			if !topo.UnpinRoute(from, to) {
+				jsonError(w, http.StatusNotFound, "no pin for "+from+" -> "+to)
+				return
+			}
+			slog.Info("route unpinned", "from", from, "to", to)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "unpinned"})
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// maintenanceRequest is the JSON body for PUT /relay/<name>/maintenance.
+// Start defaults to now; End may be given as a duration instead.
+type maintenanceRequest struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	DurationSec int       `json:"duration_sec,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// MaintenanceHandlerFunc returns an http.HandlerFunc that schedules a
+// relay's maintenance window. The relay is cordoned while it lasts.
+//
+//	GET    /relay/<name>/maintenance  — the relay's window
+//	PUT    /relay/<name>/maintenance  — {"start","end" | "duration_sec","reason"}
+//	DELETE /relay/<name>/maintenance  — cancel it and uncordon the relay
+func MaintenanceHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/relay/"), "/maintenance")
+		if !ok || name == "" || strings.Contains(name, "/") {
+			jsonError(w, http.StatusBadRequest, "path must be /relay/<name>/maintenance")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			for _, mw := range topo.Maintenance() {
+				if mw.Relay == name {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(mw)
+					return
+				}
+			}
+			jsonError(w, http.StatusNotFound, "no maintenance scheduled for "+name)
+
+		case http.MethodPut:
+			var req maintenanceRequest
+			if err := DecodeJSON(w, r, MaxRequestBytes, &req); err != nil {
+				jsonError(w, DecodeErrorStatus(err), "invalid JSON: "+err.Error())
+				return
+			}
+			mw := MaintenanceWindow{Relay: name, Start: req.Start, End: req.End, Reason: req.Reason}
+			if mw.Start.IsZero() {
+				mw.Start = time.Now()
+			}
+			if mw.End.IsZero() && req.DurationSec > 0 {
+				mw.End = mw.Start.Add(time.Duration(req.DurationSec) * time.Second)
+			}
+
+			if err := topo.ScheduleMaintenance(mw); err != nil {
+				status := http.StatusBadRequest
+				if errors.Is(err, errNodeNotFound) {
+					status = http.StatusNotFound
+				}
+				jsonError(w, status, err.Error())
+				return
+			}
+			slog.Info("maintenance scheduled", "relay", name, "start", mw.Start, "end", mw.End, "reason", mw.Reason)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "scheduled"})
+
+		case http.MethodDelete:
+			if !topo.CancelMaintenance(name) {
+				jsonError(w, http.StatusNotFound, "no maintenance scheduled for "+name)
+				return
+			}
+			slog.Info("maintenance canceled", "relay", name)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "canceled"})
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// MaintenanceCalendarHandlerFunc returns an http.HandlerFunc that exports
+// every scheduled and active maintenance window.
+//
+//	GET /maintenance             — JSON
+//	GET /maintenance?format=ics  — iCalendar feed
+func MaintenanceCalendarHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		windows := topo.Maintenance()
+		switch r.URL.Query().Get("format") {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{
+				"maintenance": windows,
+				"count":       len(windows),
+			})
+		case "ics":
+			w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			WriteICalendar(w, windows)
+		default:
+			jsonError(w, http.StatusBadRequest, "format must be json or ics")
+		}
+	}
+}
+
+// attributesRequest is the JSON body for POST /graph/attributes. Omitted
+// fields keep their current value.
+type attributesRequest struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	RTTMs       *float64 `json:"rtt_ms,omitempty"`
+	Loss        *float64 `json:"loss,omitempty"`
+	Utilization *float64 `json:"utilization,omitempty"`
+	Weight      *float64 `json:"weight,omitempty"`
+
+	CapacityMbps *float64 `json:"capacity_mbps,omitempty"`
+	FECStripes   *int     `json:"fec_stripes,omitempty"`
+}
+
+// AttributesHandlerFunc returns an http.HandlerFunc that updates the cost
+// model inputs of an edge, e.g. link utilization from a monitoring system
+// or an operator's weight.
+//
+//	POST /graph/attributes  — {"from","to","utilization": 0.7, "weight": 2}
+func AttributesHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req attributesRequest
+		if err := DecodeJSON(w, r, MaxRequestBytes, &req); err != nil {
+			jsonError(w, DecodeErrorStatus(err), "invalid JSON: "+err.Error())
+			return
+		}
+		for _, v := range []*float64{req.RTTMs, req.Loss, req.Utilization, req.Weight, req.CapacityMbps} {
+			if v != nil && *v < 0 {
+				jsonError(w, http.StatusBadRequest, "attributes must not be negative")
+				return
+			}
+		}
+		if req.FECStripes != nil && (*req.FECStripes < 0 || *req.FECStripes > MaxFECStripes) {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("fec_stripes must be 0..%d", MaxFECStripes))
+			return
+		}
+
+		ok := topo.SetEdgeAttributes(req.From, req.To, func(a *EdgeAttributes) {
+			if req.RTTMs != nil {
+				a.RTTMs = *req.RTTMs
+			}
+			if req.Loss != nil {
+				a.Loss = *req.Loss
+			}
+			if req.Utilization != nil {
+				a.Utilization = *req.Utilization
+			}
+			if req.Weight != nil {
+				a.Weight = *req.Weight
+			}
+			if req.CapacityMbps != nil {
+				a.CapacityMbps = *req.CapacityMbps
+			}
+			if req.FECStripes != nil {
+				a.FECStripes = *req.FECStripes
+			}
+		})
+		if !ok {
+			jsonError(w, http.StatusNotFound, "no edge "+req.From+" -> "+req.To)
+			return
+		}
+		attrs, _ := topo.EdgeAttributes(req.From, req.To)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(attrs)
+	}
+}
+
+// notModified reports whether the If-None-Match header of r lists etag,
+// answering 304 Not Modified if so. Tags are compared weakly.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
 // jsonError writes a JSON error response.
 func jsonError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -213,7 +214,7 @@ func TestRouteHandlerFunc_InvalidMethod(t *testing.T) {
 	topo := &Topology{}
 	handler := RouteHandlerFunc(topo)
 
-	req := httptest.NewRequest(http.MethodPost, "/route?from=A&to=B", nil)
+	req := httptest.NewRequest(http.MethodPut, "/route?from=A&to=B", nil)
 	rec := httptest.NewRecorder()
 
 	handler(rec, req)
@@ -221,6 +222,55 @@ func TestRouteHandlerFunc_InvalidMethod(t *testing.T) {
 	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
 }
 
+func TestRouteHandlerFunc_Reserve(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "A", Neighbors: map[string]float64{"B": 1}})
+	topo.Register(RelayInfo{Name: "B", Neighbors: map[string]float64{}})
+	topo.SetEdgeAttributes("A", "B", func(a *EdgeAttributes) { a.CapacityMbps = 100 })
+
+	handler := RouteHandlerFunc(topo)
+	reserve := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/route", bytes.NewBufferString(body)))
+		return rec
+	}
+
+	rec := reserve(`{"from":"A","to":"B","reserve_mbps":80,"ttl_sec":60}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var result RouteResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	assert.NotEmpty(t, result.ReservationID)
+	assert.Equal(t, 80.0, result.ReservedMbps)
+
+	assert.Equal(t, http.StatusConflict, reserve(`{"from":"A","to":"B","reserve_mbps":30}`).Code)
+	assert.Equal(t, http.StatusNotFound, reserve(`{"from":"B","to":"A","reserve_mbps":1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, reserve(`{"from":"A","to":"B"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, reserve(`{`).Code)
+
+	// List, then release
+	list := ReservationsHandlerFunc(topo)
+	rec = httptest.NewRecorder()
+	list(rec, httptest.NewRequest(http.MethodGet, "/route/reservations", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp struct {
+		Reservations []Reservation `json:"reservations"`
+		Edges        []EdgeLoad    `json:"edges"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Reservations, 1)
+	assert.Equal(t, []EdgeLoad{{From: "A", To: "B", CapacityMbps: 100, ReservedMbps: 80}}, resp.Edges)
+
+	rec = httptest.NewRecorder()
+	list(rec, httptest.NewRequest(http.MethodDelete, "/route/reservations?id="+result.ReservationID, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = httptest.NewRecorder()
+	list(rec, httptest.NewRequest(http.MethodDelete, "/route/reservations?id="+result.ReservationID, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	list(rec, httptest.NewRequest(http.MethodPost, "/route/reservations", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
 func TestGraphHandlerFunc(t *testing.T) {
 	topo := &Topology{}
 	topo.Register(RelayInfo{Name: "A", Region: "us-east-1", Neighbors: map[string]float64{"B": 1}})
@@ -279,3 +329,277 @@ func TestJsonError(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "test error message", resp["error"])
 }
+
+func TestAsymmetriesHandlerFunc(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 1}})
+	handler := AsymmetriesHandlerFunc(topo)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/graph/asymmetries", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Asymmetries []Asymmetry `json:"asymmetries"`
+		Count       int         `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, 1, resp.Count)
+	assert.Equal(t, "relay-b", resp.Asymmetries[0].To)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/graph/asymmetries", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestNewNodeHandlerFunc_PUT_Symmetric(t *testing.T) {
+	topo := &Topology{}
+	handler := NewNodeHandlerFunc(topo)
+
+	body := []byte(`{"neighbors": {"relay-b": 3}, "symmetric": true}`)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPut, "/relay/relay-a", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	assert.Empty(t, topo.Snapshot().Asymmetries())
+}
+
+func TestZonesHandlerFunc(t *testing.T) {
+	topo := &Topology{}
+	rec := httptest.NewRecorder()
+	NewNodeHandlerFunc(topo)(rec, httptest.NewRequest(http.MethodPut, "/relay/relay-a",
+		bytes.NewReader([]byte(`{"zone": "az1", "neighbors": {"relay-b": 1}}`))))
+	require.Equal(t, http.StatusOK, rec.Code)
+	handler := ZonesHandlerFunc(topo)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/graph/zones", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Zones   []ZoneSummary `json:"zones"`
+		Count   int           `json:"count"`
+		Unzoned int           `json:"unzoned"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, 1, resp.Count)
+	assert.Equal(t, 1, resp.Unzoned)
+	assert.Equal(t, []string{"relay-a"}, resp.Zones[0].Nodes)
+	assert.Equal(t, []string{"relay-b"}, resp.Zones[0].Isolated)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/graph/zones", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestOverrideHandlerFunc(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 1}})
+	handler := OverrideHandlerFunc(topo)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/override/edge",
+		bytes.NewReader([]byte(`{"from": "relay-a", "to": "relay-b", "cost": "down", "reason": "incident"}`))))
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, ok := edgeTo(topo.Snapshot().Nodes["relay-a"], "relay-b")
+	assert.False(t, ok)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/override/edge", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp struct {
+		Overrides []EdgeOverride `json:"overrides"`
+		Count     int            `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, 1, resp.Count)
+	assert.True(t, resp.Overrides[0].Down)
+	assert.Equal(t, "incident", resp.Overrides[0].Reason)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/override/edge?from=relay-a&to=relay-b", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, topo.Overrides())
+}
+
+func TestOverrideHandlerFunc_Errors(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 1}})
+	handler := OverrideHandlerFunc(topo)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"invalid json", http.MethodPost, "/override/edge", "nope", http.StatusBadRequest},
+		{"bad cost string", http.MethodPost, "/override/edge", `{"from": "relay-a", "to": "relay-b", "cost": "up"}`, http.StatusBadRequest},
+		{"zero cost", http.MethodPost, "/override/edge", `{"from": "relay-a", "to": "relay-b", "cost": 0}`, http.StatusBadRequest},
+		{"unknown relay", http.MethodPost, "/override/edge", `{"from": "relay-a", "to": "relay-z", "cost": 2}`, http.StatusNotFound},
+		{"delete missing params", http.MethodDelete, "/override/edge?from=relay-a", "", http.StatusBadRequest},
+		{"delete unknown", http.MethodDelete, "/override/edge?from=relay-a&to=relay-b", "", http.StatusNotFound},
+		{"bad method", http.MethodPut, "/override/edge", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tt.method, tt.target, bytes.NewReader([]byte(tt.body))))
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestAttributesHandlerFunc(t *testing.T) {
+	topo := &Topology{CostModel: WeightedCostModel{Utilization: 10}}
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 1}})
+	topo.Register(RelayInfo{Name: "relay-b", Neighbors: map[string]float64{}})
+	handler := AttributesHandlerFunc(topo)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/graph/attributes",
+		bytes.NewBufferString(`{"from":"relay-a","to":"relay-b","utilization":0.5}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var attrs EdgeAttributes
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&attrs))
+	assert.Equal(t, 0.5, attrs.Utilization)
+
+	route, err := topo.Route("relay-a", "relay-b")
+	require.NoError(t, err)
+	assert.Equal(t, 6.0, route.Cost)
+	assert.Zero(t, route.NextHopFEC)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/graph/attributes",
+		bytes.NewBufferString(`{"from":"relay-a","to":"relay-b","fec_stripes":4}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	route, err = topo.Route("relay-a", "relay-b")
+	require.NoError(t, err)
+	assert.Equal(t, 4, route.NextHopFEC)
+	assert.Equal(t, 6.0, route.Cost, "FEC does not change the cost")
+
+	for body, want := range map[string]int{
+		`{"from":"relay-a","to":"relay-x","weight":2}`:       http.StatusNotFound,
+		`{"from":"relay-a","to":"relay-b","weight":-1}`:      http.StatusBadRequest,
+		`{"from":"relay-a","to":"relay-b","fec_stripes":17}`: http.StatusBadRequest,
+		`not json`: http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/graph/attributes", bytes.NewBufferString(body)))
+		assert.Equal(t, want, rec.Code, body)
+	}
+}
+
+func TestMaintenanceHandlerFunc(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "A", Neighbors: map[string]float64{}})
+
+	handler := MaintenanceHandlerFunc(topo)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/relay/A/maintenance", "").Code)
+
+	rec := serve(http.MethodPut, "/relay/A/maintenance", `{"duration_sec":3600,"reason":"kernel upgrade"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	node, _ := topo.Node("A")
+	assert.True(t, node.Cordoned, "a window starting now cordons immediately")
+
+	rec = serve(http.MethodGet, "/relay/A/maintenance", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var mw MaintenanceWindow
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&mw))
+	assert.Equal(t, "kernel upgrade", mw.Reason)
+	assert.InDelta(t, time.Hour.Seconds(), mw.End.Sub(mw.Start).Seconds(), 1)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPut, "/relay/X/maintenance", `{"duration_sec":60}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/relay/A/maintenance", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/relay/A/maintenance", `{`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/relay/A/detail", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/relay/A/maintenance", "").Code)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/relay/A/maintenance", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/relay/A/maintenance", "").Code)
+	node, _ = topo.Node("A")
+	assert.False(t, node.Cordoned)
+}
+
+func TestMaintenanceCalendarHandlerFunc(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "A", Neighbors: map[string]float64{}})
+	now := time.Now()
+	require.NoError(t, topo.ScheduleMaintenance(MaintenanceWindow{Relay: "A", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)}))
+
+	handler := MaintenanceCalendarHandlerFunc(topo)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/maintenance", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp struct {
+		Maintenance []MaintenanceWindow `json:"maintenance"`
+		Count       int                 `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, 1, resp.Count)
+	assert.Equal(t, "A", resp.Maintenance[0].Relay)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/maintenance?format=ics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/calendar")
+	assert.Contains(t, rec.Body.String(), "SUMMARY:Maintenance: A\r\n")
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/maintenance?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/maintenance", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestNewNodeHandlerFunc_DELETE_Reason(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "A"})
+	handler := NewNodeHandlerFunc(topo)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/relay/A?reason=crash", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/relay/A?reason=ttl_expired", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "only the sweeper expires relays")
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/relay/A?reason=shutdown", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	history := RelayHistoryHandlerFunc(topo)
+	rec = httptest.NewRecorder()
+	history(rec, httptest.NewRequest(http.MethodGet, "/relay/A/history", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var h RelayHistory
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&h))
+	assert.False(t, h.Live)
+	require.Len(t, h.Tombstones, 1)
+	assert.Equal(t, ReasonShutdown, h.Tombstones[0].Reason)
+
+	// Without a reason the removal is attributed to an operator.
+	topo.Register(RelayInfo{Name: "A"})
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/relay/A", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	h, _ = topo.History("A")
+	assert.Equal(t, ReasonAdmin, h.Tombstones[0].Reason)
+
+	rec = httptest.NewRecorder()
+	history(rec, httptest.NewRequest(http.MethodGet, "/relay/B/history", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	history(rec, httptest.NewRequest(http.MethodPost, "/relay/A/history", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
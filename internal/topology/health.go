@@ -0,0 +1,98 @@
+package topology
+
+import (
+	"log/slog"
+	"maps"
+)
+
+// Health is a relay's health as the controller last assessed it.
+type Health string
+
+const (
+	HealthHealthy     Health = "healthy"
+	HealthDegraded    Health = "degraded"    // answers, but reports it is not ready
+	HealthUnreachable Health = "unreachable" // does not answer health probes
+	HealthUnknown     Health = "unknown"     // neither probed nor reporting
+)
+
+// DefaultDegradedPenalty is the factor the cost of edges into a degraded
+// relay is multiplied by if Topology.DegradedPenalty is unset.
+const DefaultDegradedPenalty = 4
+
+// SetHealth replaces the health of the relays: routes are not transited
+// through unreachable relays, as if cordoned, and prefer others to
+// degraded relays, whose incoming edges cost DegradedPenalty times more.
+// Relays missing from health, or healthy or unknown in it, are routed
+// through normally. Health is local to the controller: it is neither
+// persisted nor synced. It reports whether anything changed.
+func (t *Topology) SetHealth(health map[string]Health) bool {
+	unhealthy := make(map[string]Health)
+	for id, h := range health {
+		if h == HealthDegraded || h == HealthUnreachable {
+			unhealthy[id] = h
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	if maps.Equal(unhealthy, t.health) {
+		return false
+	}
+	for id, h := range unhealthy {
+		if t.health[id] != h {
+			slog.Info("relay health changed: routing around it", "relay", id, "health", h)
+		}
+	}
+	for id := range t.health {
+		if _, ok := unhealthy[id]; !ok {
+			slog.Info("relay health changed: routing through it again", "relay", id)
+		}
+	}
+	t.health = unhealthy
+	t.generation++
+	return true
+}
+
+// Unhealthy returns the relays SetHealth last reported degraded or
+// unreachable, with their health.
+func (t *Topology) Unhealthy() map[string]Health {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return maps.Clone(t.health)
+}
+
+// unhealthy reports whether routing avoids or penalizes any relay but
+// from. Caller must hold at least a read lock.
+func (t *Topology) unhealthy(from string) bool {
+	for id, node := range t.graph.Nodes {
+		if id != from && (node.Cordoned || t.health[id] != "" || !node.Registered()) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeAround removes from g the outgoing edges of cordoned, unreachable
+// and seeded-only relays but from, and applies the DegradedPenalty to the
+// edges into degraded relays. Caller must hold at least a read lock.
+func (t *Topology) routeAround(g *Graph, from string) {
+	penalty := Cost(t.DegradedPenalty)
+	if penalty <= 0 {
+		penalty = DefaultDegradedPenalty
+	}
+	for id, node := range g.Nodes {
+		if id != from && (node.Cordoned || t.health[id] == HealthUnreachable || !node.Registered()) {
+			node.Edges = nil
+			continue
+		}
+		for i, e := range node.Edges {
+			if t.health[e.To] == HealthDegraded {
+				node.Edges[i].Cost = e.Cost * penalty
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package topology
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// diamond is a → b → d and a → c → d, through b the cheaper way.
+func diamond(t *testing.T) *Topology {
+	t.Helper()
+	topo := &Topology{}
+	require.NoError(t, topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1, "c": 2}}))
+	require.NoError(t, topo.Register(RelayInfo{Name: "b", Neighbors: map[string]float64{"d": 1}}))
+	require.NoError(t, topo.Register(RelayInfo{Name: "c", Neighbors: map[string]float64{"d": 1}}))
+	require.NoError(t, topo.Register(RelayInfo{Name: "d"}))
+	return topo
+}
+
+func TestSetHealth_Routing(t *testing.T) {
+	topo := diamond(t)
+	route := func() []string {
+		res, err := topo.Route("a", "d")
+		require.NoError(t, err)
+		return res.FullPath
+	}
+	require.Equal(t, []string{"a", "b", "d"}, route())
+
+	gen := topo.Generation()
+	assert.True(t, topo.SetHealth(map[string]Health{"b": HealthDegraded, "c": HealthHealthy}))
+	assert.Equal(t, map[string]Health{"b": HealthDegraded}, topo.Unhealthy())
+	assert.Greater(t, topo.Generation(), gen, "routes change, so cached ones must be revalidated")
+	assert.Equal(t, []string{"a", "c", "d"}, route(), "b costs 4 times more")
+
+	topo.DegradedPenalty = 1.5
+	assert.Equal(t, []string{"a", "b", "d"}, route(), "still cheaper with a milder penalty")
+
+	assert.True(t, topo.SetHealth(map[string]Health{"b": HealthUnreachable}))
+	assert.False(t, topo.SetHealth(map[string]Health{"b": HealthUnreachable, "d": HealthUnknown}))
+	assert.True(t, topo.SetHealth(map[string]Health{"b": HealthUnreachable, "c": HealthUnreachable}))
+	_, err := topo.Route("a", "d")
+	assert.Error(t, err, "neither b nor c is transited")
+	res, err := topo.Route("b", "d")
+	require.NoError(t, err, "an unreachable relay still routes from itself")
+	assert.Equal(t, []string{"b", "d"}, res.FullPath)
+
+	assert.True(t, topo.SetHealth(nil))
+	assert.Equal(t, []string{"a", "b", "d"}, route())
+}
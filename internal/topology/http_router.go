@@ -0,0 +1,132 @@
+package topology
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// defaultHTTPRouterTimeout bounds a single call to an external router.
+const defaultHTTPRouterTimeout = 500 * time.Millisecond
+
+// HTTPRouter delegates path computation to an external HTTP endpoint so
+// operators can plug in a custom routing policy without recompiling.
+//
+// For each query it POSTs an HTTPRouteRequest (the graph snapshot plus the
+// endpoints) and expects a RouteResult in response. Any failure — timeout,
+// non-2xx status, malformed body, or a path that does not follow the graph's
+// edges — falls back to Fallback.
+//
+// Example:
+//
+//	topo := &Topology{
+//	  Router: &HTTPRouter{URL: "http://policy:9000/route"},
+//	}
+type HTTPRouter struct {
+	// URL is the endpoint that receives route queries.
+	URL string
+
+	// Timeout bounds each call. Zero uses 500ms.
+	Timeout time.Duration
+
+	// Client is the HTTP client to use. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Fallback computes the route when the external router fails.
+	// If nil, Dijkstra is used.
+	Fallback Router
+}
+
+// HTTPRouteRequest is the body POSTed to an external router.
+type HTTPRouteRequest struct {
+	From  string        `json:"from"`
+	To    string        `json:"to"`
+	Graph GraphResponse `json:"graph"`
+}
+
+// Route asks the external endpoint for a path and falls back on failure.
+func (h *HTTPRouter) Route(g *Graph, from, to string) (RouteResult, error) {
+	result, err := h.query(g, from, to)
+	if err == nil {
+		return result, nil
+	}
+
+	slog.Warn("external router failed, falling back",
+		"url", h.URL, "from", from, "to", to, "error", err)
+
+	fallback := h.Fallback
+	if fallback == nil {
+		fallback = NewDijkstraRouter()
+	}
+	return fallback.Route(g, from, to)
+}
+
+// query performs one call to the external endpoint and validates the result.
+func (h *HTTPRouter) query(g *Graph, from, to string) (RouteResult, error) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPRouterTimeout
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	body, err := json.Marshal(HTTPRouteRequest{From: from, To: to, Graph: g.ToResponse()})
+	if err != nil {
+		return RouteResult{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return RouteResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return RouteResult{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return RouteResult{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var result RouteResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return RouteResult{}, fmt.Errorf("decode response: %w", err)
+	}
+
+	if err := validatePath(g, from, to, result.FullPath); err != nil {
+		return RouteResult{}, err
+	}
+
+	result.From, result.To = from, to
+	result.NextHop = from
+	if len(result.FullPath) >= 2 {
+		result.NextHop = result.FullPath[1]
+	}
+	return result, nil
+}
+
+// validatePath checks that path runs from → to along existing edges.
+func validatePath(g *Graph, from, to string, path []string) error {
+	if len(path) == 0 || path[0] != from || path[len(path)-1] != to {
+		return fmt.Errorf("path %v does not connect %s to %s", path, from, to)
+	}
+	for i := 0; i+1 < len(path); i++ {
+		node, ok := g.Nodes[path[i]]
+		if !ok || !node.hasEdgeTo(path[i+1]) {
+			return fmt.Errorf("path %v uses missing edge %s → %s", path, path[i], path[i+1])
+		}
+	}
+	return nil
+}
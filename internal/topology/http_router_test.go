@@ -0,0 +1,104 @@
+package topology
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// triangleGraph returns a → b → c with a costly direct edge a → c.
+func triangleGraph() *Graph {
+	g := newGraph()
+	for _, id := range []string{"a", "b", "c"} {
+		g.addNode(&Node{ID: id})
+	}
+	g.addEdge("a", "b", 1)
+	g.addEdge("b", "c", 1)
+	g.addEdge("a", "c", 10)
+	return g
+}
+
+func TestHTTPRouter_UsesExternalPath(t *testing.T) {
+	var got HTTPRouteRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		json.NewEncoder(w).Encode(RouteResult{FullPath: []string{"a", "c"}, Cost: 10})
+	}))
+	defer srv.Close()
+
+	router := &HTTPRouter{URL: srv.URL}
+	result, err := router.Route(triangleGraph(), "a", "c")
+	require.NoError(t, err)
+
+	assert.Equal(t, "a", got.From)
+	assert.Equal(t, "c", got.To)
+	assert.Len(t, got.Graph.Nodes, 3)
+	assert.Equal(t, []string{"a", "c"}, result.FullPath)
+	assert.Equal(t, "c", result.NextHop)
+	assert.Equal(t, 10.0, result.Cost)
+}
+
+func TestHTTPRouter_Fallback(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		"server error": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+		"malformed body": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("not json"))
+		},
+		"invalid path": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(RouteResult{FullPath: []string{"a", "x", "c"}})
+		},
+		"wrong endpoints": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(RouteResult{FullPath: []string{"b", "c"}})
+		},
+		"timeout": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		},
+	}
+
+	for name, h := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(h)
+			defer srv.Close()
+
+			router := &HTTPRouter{URL: srv.URL, Timeout: 50 * time.Millisecond}
+			result, err := router.Route(triangleGraph(), "a", "c")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a", "b", "c"}, result.FullPath, "expected Dijkstra fallback")
+		})
+	}
+}
+
+func TestHTTPRouter_Unreachable(t *testing.T) {
+	router := &HTTPRouter{URL: "http://127.0.0.1:1", Timeout: 50 * time.Millisecond}
+	result, err := router.Route(triangleGraph(), "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", result.NextHop)
+}
+
+func TestTopology_Route_HTTPRouter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(RouteResult{FullPath: []string{"relay-a", "relay-c"}, Cost: 5})
+	}))
+	defer srv.Close()
+
+	topo := &Topology{Router: &HTTPRouter{URL: srv.URL}}
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 1, "relay-c": 5}})
+	topo.Register(RelayInfo{Name: "relay-b", Neighbors: map[string]float64{"relay-c": 1}})
+	topo.Register(RelayInfo{Name: "relay-c", Address: "https://c:4433", Neighbors: map[string]float64{"relay-a": 1}})
+
+	result, err := topo.Route("relay-a", "relay-c")
+	require.NoError(t, err)
+	assert.Equal(t, "relay-c", result.NextHop)
+	assert.Equal(t, "https://c:4433", result.NextHopAddress)
+}
@@ -0,0 +1,124 @@
+package topology
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Limits a registration may exceed, as LimitError.Limit.
+const (
+	LimitNodes        = "nodes"
+	LimitEdgesPerNode = "edges_per_node"
+	LimitEdges        = "edges"
+)
+
+// GraphLimits bounds the size of the graph relays can build by
+// registering, protecting path computation and the controller's memory
+// from a runaway or malicious relay. A registration that would exceed a
+// limit is refused as a whole. Nodes and edges added otherwise, by seeding
+// or by syncing from a peer controller, are not checked but count towards
+// the limits. Zero fields are unlimited.
+type GraphLimits struct {
+	// MaxNodes bounds the nodes of the graph, including the neighbors
+	// relays name before they register themselves.
+	MaxNodes int
+
+	// MaxEdgesPerNode bounds the neighbors of one registration.
+	MaxEdgesPerNode int
+
+	// MaxEdges bounds the edges of the graph, including the reverse edges
+	// of symmetric registrations.
+	MaxEdges int
+}
+
+// LimitError reports a registration refused by GraphLimits.
+type LimitError struct {
+	Limit string // LimitNodes, LimitEdgesPerNode or LimitEdges
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("registration exceeds the controller's limit of %d %s", e.Max, e.Limit)
+}
+
+// check returns the limit registering reg would take g past, or nil.
+func (l *GraphLimits) check(g *Graph, reg RelayInfo) *LimitError {
+	if l.MaxEdgesPerNode > 0 && len(reg.Neighbors) > l.MaxEdgesPerNode {
+		return &LimitError{Limit: LimitEdgesPerNode, Max: l.MaxEdgesPerNode}
+	}
+
+	if l.MaxNodes > 0 {
+		nodes := len(g.Nodes)
+		if _, ok := g.Nodes[reg.Name]; !ok {
+			nodes++
+		}
+		for nb := range reg.Neighbors {
+			if _, ok := g.Nodes[nb]; !ok && nb != reg.Name {
+				nodes++
+			}
+		}
+		if nodes > l.MaxNodes {
+			return &LimitError{Limit: LimitNodes, Max: l.MaxNodes}
+		}
+	}
+
+	if l.MaxEdges > 0 {
+		edges := 0
+		for id, n := range g.Nodes {
+			for _, e := range n.Edges {
+				// The relay's edges are replaced by the registration's, but
+				// for reverse edges it does not list
+				if _, listed := reg.Neighbors[e.To]; id != reg.Name || e.Auto && !listed {
+					edges++
+				}
+			}
+		}
+		edges += len(reg.Neighbors)
+		if reg.Symmetric {
+			for nb := range reg.Neighbors {
+				if !g.hasEdge(nb, reg.Name) {
+					edges++ // a reverse edge to add
+				}
+			}
+		}
+		if edges > l.MaxEdges {
+			return &LimitError{Limit: LimitEdges, Max: l.MaxEdges}
+		}
+	}
+	return nil
+}
+
+// hasEdge reports whether g has an edge from one node to another.
+func (g *Graph) hasEdge(from, to string) bool {
+	n, ok := g.Nodes[from]
+	if !ok {
+		return false
+	}
+	for _, e := range n.Edges {
+		if e.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+// RejectInvalid is the Rejections reason of registrations that fail
+// Validation; the others are the GraphLimits limits.
+const RejectInvalid = "invalid"
+
+// reject counts a registration refused for reason. Caller must hold the
+// write lock.
+func (t *Topology) reject(reason string) {
+	if t.rejected == nil {
+		t.rejected = make(map[string]uint64)
+	}
+	t.rejected[reason]++
+}
+
+// Rejections returns how many registrations were refused, by reason:
+// RejectInvalid, LimitNodes, LimitEdgesPerNode or LimitEdges.
+func (t *Topology) Rejections() map[string]uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.rejected)
+}
@@ -0,0 +1,126 @@
+package topology
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopology_RegisterLimits(t *testing.T) {
+	tests := map[string]struct {
+		limits GraphLimits
+		regs   []RelayInfo // all but the last must succeed
+		limit  string      // the limit the last exceeds; "" if it fits
+	}{
+		"nodes": {
+			limits: GraphLimits{MaxNodes: 3},
+			regs: []RelayInfo{
+				{Name: "a", Neighbors: map[string]float64{"b": 1}},
+				{Name: "c", Neighbors: map[string]float64{"d": 1}},
+			},
+			limit: LimitNodes,
+		},
+		"nodes already known": {
+			limits: GraphLimits{MaxNodes: 3},
+			regs: []RelayInfo{
+				{Name: "a", Neighbors: map[string]float64{"b": 1, "c": 1}},
+				{Name: "c", Neighbors: map[string]float64{"a": 1, "b": 1}},
+			},
+		},
+		"edges per node": {
+			limits: GraphLimits{MaxEdgesPerNode: 1},
+			regs: []RelayInfo{
+				{Name: "a", Neighbors: map[string]float64{"b": 1, "c": 1}},
+			},
+			limit: LimitEdgesPerNode,
+		},
+		"edges": {
+			limits: GraphLimits{MaxEdges: 2},
+			regs: []RelayInfo{
+				{Name: "a", Neighbors: map[string]float64{"b": 1, "c": 1}},
+				{Name: "b", Neighbors: map[string]float64{"a": 1}},
+			},
+			limit: LimitEdges,
+		},
+		"edges replaced": {
+			limits: GraphLimits{MaxEdges: 2},
+			regs: []RelayInfo{
+				{Name: "a", Neighbors: map[string]float64{"b": 1, "c": 1}},
+				{Name: "a", Neighbors: map[string]float64{"c": 1, "d": 1}},
+			},
+		},
+		"symmetric edges": {
+			limits: GraphLimits{MaxEdges: 3},
+			regs: []RelayInfo{
+				{Name: "a", Neighbors: map[string]float64{"b": 1, "c": 1}, Symmetric: true},
+			},
+			limit: LimitEdges,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			topo := &Topology{Limits: &tt.limits}
+			last := len(tt.regs) - 1
+			for _, reg := range tt.regs[:last] {
+				require.NoError(t, topo.Register(reg))
+			}
+			before := topo.Snapshot()
+
+			err := topo.Register(tt.regs[last])
+			if tt.limit == "" {
+				require.NoError(t, err)
+				return
+			}
+			var limitErr *LimitError
+			require.True(t, errors.As(err, &limitErr), "got %v", err)
+			assert.Equal(t, tt.limit, limitErr.Limit)
+			assert.Equal(t, before, topo.Snapshot(), "a rejected registration must change nothing")
+			assert.Equal(t, map[string]uint64{tt.limit: 1}, topo.Rejections())
+		})
+	}
+}
+
+func TestTopology_Rejections(t *testing.T) {
+	topo := &Topology{
+		Validation: &RegistrationValidation{},
+		Limits:     &GraphLimits{MaxEdgesPerNode: 1},
+	}
+	assert.Empty(t, topo.Rejections())
+
+	assert.Error(t, topo.Register(RelayInfo{Name: "a/b"}))
+	assert.Error(t, topo.Register(RelayInfo{Name: "a/b"}))
+	assert.Error(t, topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1, "c": 1}}))
+	require.NoError(t, topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1}}))
+
+	assert.Equal(t, map[string]uint64{RejectInvalid: 2, LimitEdgesPerNode: 1}, topo.Rejections())
+}
+
+func TestNewNodeHandlerFunc_PUT_Limits(t *testing.T) {
+	topo := &Topology{Limits: &GraphLimits{MaxNodes: 2, MaxEdgesPerNode: 1}}
+	handler := NewNodeHandlerFunc(topo)
+
+	put := func(name, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/relay/"+name, bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	rec := put("relay-a", `{"neighbors":{"relay-b":1,"relay-c":1}}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "limit of 1 edges_per_node")
+
+	rec = put("relay-a", `{"neighbors":{"relay-b":1}}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = put("relay-c", `{}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "limit of 2 nodes")
+	assert.Len(t, topo.Snapshot().Nodes, 2)
+}
@@ -0,0 +1,232 @@
+package topology
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errInvalidWindow is returned for a maintenance window that does not end
+// after it starts, or has already ended.
+var errInvalidWindow = errors.New("maintenance window must end after it starts and in the future")
+
+// MaintenanceWindow is a planned outage of a relay. While it is active the
+// relay is cordoned: it carries no transit traffic, receives no new
+// publishers, subscribers or prefetches, and is told to release the
+// prefetches it holds. It is uncordoned when the window ends.
+type MaintenanceWindow struct {
+	Relay     string    `json:"relay"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Active reports whether now is within the window.
+func (w MaintenanceWindow) Active(now time.Time) bool {
+	return !now.Before(w.Start) && now.Before(w.End)
+}
+
+// ScheduleMaintenance installs or replaces the maintenance window of
+// w.Relay, which must be in the topology. A window that has already
+// started cordons the relay immediately.
+func (t *Topology) ScheduleMaintenance(w MaintenanceWindow) error {
+	now := time.Now()
+	if !w.End.After(w.Start) || !w.End.After(now) {
+		return errInvalidWindow
+	}
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = now
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	if _, ok := t.graph.Nodes[w.Relay]; !ok {
+		return errNodeNotFound
+	}
+	t.graph.Maintenance = append(t.graph.removeMaintenance(w.Relay), w)
+	sort.Slice(t.graph.Maintenance, func(i, j int) bool {
+		return t.graph.Maintenance[i].Start.Before(t.graph.Maintenance[j].Start)
+	})
+	t.recordEvent(w.Relay, EventMaintenanceScheduled, maintenanceDetail(w))
+	t.applyMaintenance(now)
+
+	t.save()
+	return nil
+}
+
+// CancelMaintenance removes the maintenance window of the named relay and
+// uncordons it. Returns false if it had none.
+func (t *Topology) CancelMaintenance(relay string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	n := len(t.graph.Maintenance)
+	t.graph.Maintenance = t.graph.removeMaintenance(relay)
+	if len(t.graph.Maintenance) == n {
+		return false
+	}
+	t.recordEvent(relay, EventMaintenanceCanceled, "")
+	t.applyMaintenance(time.Now())
+
+	t.save()
+	return true
+}
+
+// Maintenance returns the scheduled and active maintenance windows sorted
+// by start.
+func (t *Topology) Maintenance() []MaintenanceWindow {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.init()
+
+	return append([]MaintenanceWindow{}, t.graph.Maintenance...)
+}
+
+// ActiveMaintenance returns the named relay's maintenance window if it is
+// active, which means the relay is cordoned.
+func (t *Topology) ActiveMaintenance(relay string) (MaintenanceWindow, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	now := time.Now()
+	if t.graph == nil {
+		return MaintenanceWindow{}, false
+	}
+	for _, w := range t.graph.Maintenance {
+		if w.Relay == relay && w.Active(now) {
+			return w, true
+		}
+	}
+	return MaintenanceWindow{}, false
+}
+
+// StartMaintenanceScheduler runs a background goroutine that cordons
+// relays when their maintenance window starts, uncordons them when it ends
+// and drops ended windows. It stops when ctx is cancelled.
+func (t *Topology) StartMaintenanceScheduler(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				t.mu.Lock()
+				t.init()
+				if t.applyMaintenance(now) {
+					t.save()
+				}
+				t.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// applyMaintenance drops ended windows and sets Node.Cordoned from the
+// active ones, recording the transitions. It reports whether anything
+// changed. Caller must hold the write lock.
+func (t *Topology) applyMaintenance(now time.Time) bool {
+	changed := false
+	active := make(map[string]MaintenanceWindow)
+	kept := t.graph.Maintenance[:0]
+	for _, w := range t.graph.Maintenance {
+		if !now.Before(w.End) {
+			changed = true
+			continue
+		}
+		kept = append(kept, w)
+		if w.Active(now) {
+			active[w.Relay] = w
+		}
+	}
+	t.graph.Maintenance = kept
+
+	for id, node := range t.graph.Nodes {
+		w, cordon := active[id]
+		switch {
+		case cordon && !node.Cordoned:
+			node.Cordoned = true
+			t.recordEvent(id, EventCordoned, maintenanceDetail(w))
+			slog.Info("maintenance window started: relay cordoned", "relay", id, "until", w.End, "reason", w.Reason)
+		case !cordon && node.Cordoned:
+			node.Cordoned = false
+			t.recordEvent(id, EventUncordoned, "")
+			slog.Info("maintenance window ended: relay uncordoned", "relay", id)
+		default:
+			continue
+		}
+		changed = true
+	}
+	return changed
+}
+
+// transitGraph returns the graph routes are computed on: without the
+// outgoing edges of cordoned, unreachable and seeded-only relays, so they
+// are neither transited nor used as a source unless they are the route's
+// own from, and with edges into degraded relays penalized (see
+// SetHealth). Caller must hold at least a read lock.
+func (t *Topology) transitGraph(from string) *Graph {
+	if !t.unhealthy(from) {
+		return t.graph
+	}
+
+	g := t.deepCopy()
+	t.routeAround(g, from)
+	return g
+}
+
+// removeMaintenance returns g.Maintenance without relay's window.
+func (g *Graph) removeMaintenance(relay string) []MaintenanceWindow {
+	kept := make([]MaintenanceWindow, 0, len(g.Maintenance))
+	for _, w := range g.Maintenance {
+		if w.Relay != relay {
+			kept = append(kept, w)
+		}
+	}
+	return kept
+}
+
+// maintenanceDetail describes w for a NodeEvent.
+func maintenanceDetail(w MaintenanceWindow) string {
+	detail := w.Start.UTC().Format(time.RFC3339) + " to " + w.End.UTC().Format(time.RFC3339)
+	if w.Reason != "" {
+		detail += " (" + w.Reason + ")"
+	}
+	return detail
+}
+
+// WriteICalendar writes windows as an iCalendar (RFC 5545) feed that
+// calendar applications can subscribe to.
+func WriteICalendar(w io.Writer, windows []MaintenanceWindow) error {
+	const stamp = "20060102T150405Z"
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//qumo//maintenance//EN\r\n")
+	for _, mw := range windows {
+		summary := "Maintenance: " + mw.Relay
+		if mw.Reason != "" {
+			summary += " (" + mw.Reason + ")"
+		}
+		fmt.Fprintf(&b, "BEGIN:VEVENT\r\nUID:%s-%d@qumo\r\nDTSTAMP:%s\r\nDTSTART:%s\r\nDTEND:%s\r\nSUMMARY:%s\r\nEND:VEVENT\r\n",
+			icalEscape(mw.Relay), mw.Start.Unix(), mw.CreatedAt.UTC().Format(stamp),
+			mw.Start.UTC().Format(stamp), mw.End.UTC().Format(stamp), icalEscape(summary))
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// icalEscape escapes an iCalendar TEXT value.
+var icalEscape = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "").Replace
@@ -0,0 +1,161 @@
+package topology
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// maintenanceTopology is A → B → D (cost 2) and A → C → D (cost 4).
+func maintenanceTopology(t *testing.T) *Topology {
+	t.Helper()
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "A", Neighbors: map[string]float64{"B": 1, "C": 2}})
+	topo.Register(RelayInfo{Name: "B", Neighbors: map[string]float64{"D": 1}})
+	topo.Register(RelayInfo{Name: "C", Neighbors: map[string]float64{"D": 2}})
+	topo.Register(RelayInfo{Name: "D", Neighbors: map[string]float64{}})
+	return topo
+}
+
+func TestTopology_ScheduleMaintenance(t *testing.T) {
+	topo := maintenanceTopology(t)
+	now := time.Now()
+
+	require.NoError(t, topo.ScheduleMaintenance(MaintenanceWindow{Relay: "B", Start: now.Add(-time.Minute), End: now.Add(time.Hour), Reason: "kernel upgrade"}))
+
+	mw, ok := topo.ActiveMaintenance("B")
+	require.True(t, ok)
+	assert.Equal(t, "kernel upgrade", mw.Reason)
+	assert.False(t, mw.CreatedAt.IsZero())
+
+	node, _ := topo.Node("B")
+	assert.True(t, node.Cordoned)
+
+	// Routes go around the cordoned relay...
+	result, err := topo.Route("A", "D")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "C", "D"}, result.FullPath)
+
+	// ...but it can still reach others and be reached.
+	result, err = topo.Route("B", "D")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"B", "D"}, result.FullPath)
+
+	var types []string
+	for _, e := range topo.NodeEvents("B") {
+		types = append(types, e.Type)
+	}
+	assert.Contains(t, types, EventMaintenanceScheduled)
+	assert.Contains(t, types, EventCordoned)
+
+	// Rescheduling replaces the window.
+	require.NoError(t, topo.ScheduleMaintenance(MaintenanceWindow{Relay: "B", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)}))
+	require.Len(t, topo.Maintenance(), 1)
+	_, ok = topo.ActiveMaintenance("B")
+	assert.False(t, ok)
+	node, _ = topo.Node("B")
+	assert.False(t, node.Cordoned, "a future window uncordons")
+}
+
+func TestTopology_ScheduleMaintenance_Invalid(t *testing.T) {
+	topo := maintenanceTopology(t)
+	now := time.Now()
+
+	assert.ErrorIs(t, topo.ScheduleMaintenance(MaintenanceWindow{Relay: "B", Start: now, End: now}), errInvalidWindow)
+	assert.ErrorIs(t, topo.ScheduleMaintenance(MaintenanceWindow{Relay: "B", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)}), errInvalidWindow)
+	assert.ErrorIs(t, topo.ScheduleMaintenance(MaintenanceWindow{Relay: "X", Start: now, End: now.Add(time.Hour)}), errNodeNotFound)
+	assert.Empty(t, topo.Maintenance())
+}
+
+func TestTopology_MaintenanceWindowLifecycle(t *testing.T) {
+	topo := maintenanceTopology(t)
+	now := time.Now()
+	require.NoError(t, topo.ScheduleMaintenance(MaintenanceWindow{Relay: "B", Start: now.Add(time.Minute), End: now.Add(time.Hour)}))
+
+	node, _ := topo.Node("B")
+	assert.False(t, node.Cordoned)
+
+	topo.mu.Lock()
+	assert.True(t, topo.applyMaintenance(now.Add(2*time.Minute)))
+	assert.False(t, topo.applyMaintenance(now.Add(3*time.Minute)), "no transition")
+	topo.mu.Unlock()
+	node, _ = topo.Node("B")
+	assert.True(t, node.Cordoned, "cordoned when the window starts")
+
+	topo.mu.Lock()
+	assert.True(t, topo.applyMaintenance(now.Add(time.Hour)))
+	topo.mu.Unlock()
+	node, _ = topo.Node("B")
+	assert.False(t, node.Cordoned, "uncordoned when the window ends")
+	assert.Empty(t, topo.Maintenance(), "ended windows are dropped")
+
+	assert.Equal(t, EventUncordoned, topo.NodeEvents("B")[0].Type)
+}
+
+func TestTopology_CancelMaintenance(t *testing.T) {
+	topo := maintenanceTopology(t)
+	now := time.Now()
+	require.NoError(t, topo.ScheduleMaintenance(MaintenanceWindow{Relay: "B", Start: now, End: now.Add(time.Hour)}))
+
+	assert.True(t, topo.CancelMaintenance("B"))
+	assert.False(t, topo.CancelMaintenance("B"))
+
+	node, _ := topo.Node("B")
+	assert.False(t, node.Cordoned)
+	result, err := topo.Route("A", "D")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "B", "D"}, result.FullPath)
+}
+
+func TestTopology_MaintenanceRejoin(t *testing.T) {
+	topo := maintenanceTopology(t)
+	now := time.Now()
+	require.NoError(t, topo.ScheduleMaintenance(MaintenanceWindow{Relay: "B", Start: now, End: now.Add(time.Hour)}))
+
+	topo.Deregister("B", ReasonAdmin)
+	topo.Register(RelayInfo{Name: "B", Neighbors: map[string]float64{"D": 1}})
+
+	node, _ := topo.Node("B")
+	assert.True(t, node.Cordoned, "a relay restarting during its window stays cordoned")
+}
+
+func TestTopology_MaintenancePersisted(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "topology.json"))
+	topo := &Topology{Store: store}
+	topo.Register(RelayInfo{Name: "A", Neighbors: map[string]float64{"B": 1}})
+	now := time.Now()
+	require.NoError(t, topo.ScheduleMaintenance(MaintenanceWindow{Relay: "A", Start: now, End: now.Add(time.Hour), Reason: "rack move"}))
+
+	restored := &Topology{Store: store}
+	windows := restored.Maintenance()
+	require.Len(t, windows, 1)
+	assert.Equal(t, "rack move", windows[0].Reason)
+	node, ok := restored.Node("A")
+	require.True(t, ok)
+	assert.True(t, node.Cordoned)
+}
+
+func TestWriteICalendar(t *testing.T) {
+	start := time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)
+	var b strings.Builder
+	require.NoError(t, WriteICalendar(&b, []MaintenanceWindow{{
+		Relay:     "tokyo-1",
+		Start:     start,
+		End:       start.Add(2 * time.Hour),
+		Reason:    "kernel upgrade, reboot",
+		CreatedAt: start.Add(-24 * time.Hour),
+	}}))
+
+	ics := b.String()
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+	assert.Contains(t, ics, "DTSTART:20260301T020000Z\r\n")
+	assert.Contains(t, ics, "DTEND:20260301T040000Z\r\n")
+	assert.Contains(t, ics, "DTSTAMP:20260228T020000Z\r\n")
+	assert.Contains(t, ics, `SUMMARY:Maintenance: tokyo-1 (kernel upgrade\, reboot)`)
+	assert.Equal(t, 1, strings.Count(ics, "BEGIN:VEVENT"))
+}
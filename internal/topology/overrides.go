@@ -0,0 +1,150 @@
+package topology
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// errInvalidOverride is returned for an override that neither sets a
+// positive cost nor marks the edge down.
+var errInvalidOverride = errors.New("override needs a positive cost or down")
+
+// EdgeOverride is an operator's manual edit of the edge From → To. It takes
+// precedence over relay-reported and probe-measured costs until cleared.
+type EdgeOverride struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Cost pins the edge to this cost, adding the edge if the relay does
+	// not report it. Ignored when Down is set.
+	Cost float64 `json:"cost,omitempty"`
+
+	// Down removes the edge from routing.
+	Down bool `json:"down,omitempty"`
+
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SetOverride installs or replaces the override for o.From → o.To and
+// applies it immediately. Both relays must be in the topology.
+func (t *Topology) SetOverride(o EdgeOverride) error {
+	if !o.Down && o.Cost <= 0 {
+		return errInvalidOverride
+	}
+	if o.Down {
+		o.Cost = 0
+	}
+	if o.CreatedAt.IsZero() {
+		o.CreatedAt = time.Now()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	if _, ok := t.graph.Nodes[o.From]; !ok {
+		return errNodeNotFound
+	}
+	if _, ok := t.graph.Nodes[o.To]; !ok || o.From == o.To {
+		return errNodeNotFound
+	}
+
+	t.graph.Overrides = append(t.graph.removeOverride(o.From, o.To), o)
+	sort.Slice(t.graph.Overrides, func(i, j int) bool {
+		a, b := t.graph.Overrides[i], t.graph.Overrides[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	t.graph.applyOverrides()
+	t.recordEvent(o.From, EventOverrideSet, overrideDetail(o))
+
+	t.save()
+	return nil
+}
+
+// ClearOverride removes the override for from → to. The edge returns to
+// its relay-reported value on the relay's next heartbeat. Returns false if
+// there was no override.
+func (t *Topology) ClearOverride(from, to string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	n := len(t.graph.Overrides)
+	t.graph.Overrides = t.graph.removeOverride(from, to)
+	if len(t.graph.Overrides) == n {
+		return false
+	}
+	t.recordEvent(from, EventOverrideCleared, "to "+to)
+
+	t.save()
+	return true
+}
+
+// Overrides returns the active overrides sorted by From, To.
+func (t *Topology) Overrides() []EdgeOverride {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.init()
+
+	return append([]EdgeOverride{}, t.graph.Overrides...)
+}
+
+// overrideDetail describes o for a NodeEvent.
+func overrideDetail(o EdgeOverride) string {
+	detail := "to " + o.To + ": cost " + strconv.FormatFloat(o.Cost, 'g', -1, 64)
+	if o.Down {
+		detail = "to " + o.To + ": down"
+	}
+	if o.Reason != "" {
+		detail += " (" + o.Reason + ")"
+	}
+	return detail
+}
+
+// removeOverride returns g.Overrides without the entry for from → to.
+func (g *Graph) removeOverride(from, to string) []EdgeOverride {
+	kept := make([]EdgeOverride, 0, len(g.Overrides))
+	for _, o := range g.Overrides {
+		if o.From != from || o.To != to {
+			kept = append(kept, o)
+		}
+	}
+	return kept
+}
+
+// applyOverrides rewrites the edges covered by an override. It must run
+// after every change to edges so overrides keep precedence.
+func (g *Graph) applyOverrides() {
+	for _, o := range g.Overrides {
+		node, ok := g.Nodes[o.From]
+		if _, exists := g.Nodes[o.To]; !ok || !exists {
+			continue
+		}
+		idx := -1
+		for i, e := range node.Edges {
+			if e.To == o.To {
+				idx = i
+				break
+			}
+		}
+		switch {
+		case o.Down && idx >= 0:
+			node.Edges = append(node.Edges[:idx], node.Edges[idx+1:]...)
+		case o.Down:
+		case idx >= 0:
+			node.Edges[idx].Cost = Cost(o.Cost)
+			node.Edges[idx].Components = nil // pinned, not priced
+		default:
+			node.Edges = append(node.Edges, Edge{To: o.To, Cost: Cost(o.Cost)})
+		}
+	}
+}
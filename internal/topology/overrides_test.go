@@ -0,0 +1,87 @@
+package topology
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func overrideTopo() *Topology {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1, "c": 5}})
+	topo.Register(RelayInfo{Name: "b", Neighbors: map[string]float64{"c": 1}})
+	topo.Register(RelayInfo{Name: "c", Neighbors: map[string]float64{}})
+	return topo
+}
+
+func TestTopology_SetOverride_Down(t *testing.T) {
+	topo := overrideTopo()
+
+	require.NoError(t, topo.SetOverride(EdgeOverride{From: "b", To: "c", Down: true, Reason: "packet loss"}))
+	res, err := topo.Route("a", "c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, res.FullPath)
+
+	// A heartbeat reporting the edge does not bring it back.
+	topo.Register(RelayInfo{Name: "b", Neighbors: map[string]float64{"c": 1}})
+	res, err = topo.Route("a", "c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, res.FullPath)
+
+	// Cleared: the next heartbeat restores it.
+	assert.True(t, topo.ClearOverride("b", "c"))
+	assert.False(t, topo.ClearOverride("b", "c"))
+	topo.Register(RelayInfo{Name: "b", Neighbors: map[string]float64{"c": 1}})
+	res, err = topo.Route("a", "c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, res.FullPath)
+}
+
+func TestTopology_SetOverride_Cost(t *testing.T) {
+	topo := overrideTopo()
+
+	require.NoError(t, topo.SetOverride(EdgeOverride{From: "a", To: "b", Cost: 50}))
+	assert.True(t, topo.SetMeasuredCost("a", "b", 2))
+	edge, ok := edgeTo(topo.Snapshot().Nodes["a"], "b")
+	require.True(t, ok)
+	assert.Equal(t, Cost(50), edge.Cost, "override beats probe measurements")
+
+	// Pinning an edge the relay does not report adds it.
+	require.NoError(t, topo.SetOverride(EdgeOverride{From: "c", To: "a", Cost: 3}))
+	edge, ok = edgeTo(topo.Snapshot().Nodes["c"], "a")
+	require.True(t, ok)
+	assert.Equal(t, Cost(3), edge.Cost)
+
+	overrides := topo.Overrides()
+	require.Len(t, overrides, 2)
+	assert.Equal(t, "a", overrides[0].From)
+	assert.False(t, overrides[0].CreatedAt.IsZero())
+}
+
+func TestTopology_SetOverride_Errors(t *testing.T) {
+	topo := overrideTopo()
+
+	assert.ErrorIs(t, topo.SetOverride(EdgeOverride{From: "a", To: "b"}), errInvalidOverride)
+	assert.ErrorIs(t, topo.SetOverride(EdgeOverride{From: "a", To: "zz", Cost: 1}), errNodeNotFound)
+	assert.ErrorIs(t, topo.SetOverride(EdgeOverride{From: "a", To: "a", Cost: 1}), errNodeNotFound)
+	assert.Empty(t, topo.Overrides())
+}
+
+func TestTopology_Overrides_Persisted(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "topo.json"))
+	topo := &Topology{Store: store}
+	topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1}})
+	require.NoError(t, topo.SetOverride(EdgeOverride{From: "a", To: "b", Down: true}))
+
+	restored := &Topology{Store: store}
+	require.Len(t, restored.Overrides(), 1)
+	restored.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1}})
+	_, ok := edgeTo(restored.Snapshot().Nodes["a"], "b")
+	assert.False(t, ok)
+
+	// HA sync carries overrides too.
+	synced := FromResponse(topo.Snapshot().ToResponse())
+	assert.Len(t, synced.Overrides, 1)
+}
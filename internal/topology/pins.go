@@ -0,0 +1,174 @@
+package topology
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errInvalidPin is returned for a pinned path that does not lead from
+// From to To over edges of the graph.
+var errInvalidPin = errors.New("path must run from 'from' to 'to' over existing edges")
+
+// RoutePin is an operator's fixed path for routes From → To. Route returns
+// it instead of the computed shortest path until it is removed, for
+// debugging or to keep traffic on an approved path. A pin whose edges have
+// since gone is skipped, so routing falls back to the computed path.
+type RoutePin struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Path []string `json:"path"` // full path, From first and To last
+
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Broken is set in Pins when an edge of Path is no longer in the
+	// graph. Not persisted.
+	Broken bool `json:"broken,omitempty"`
+}
+
+// PinRoute installs or replaces the pin for p.From → p.To. Its path must
+// follow existing edges from p.From to p.To without visiting a relay twice.
+func (t *Topology) PinRoute(p RoutePin) error {
+	if len(p.Path) < 2 || p.Path[0] != p.From || p.Path[len(p.Path)-1] != p.To {
+		return errInvalidPin
+	}
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+	p.Broken = false
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	seen := make(map[string]bool, len(p.Path))
+	for _, id := range p.Path {
+		if _, ok := t.graph.Nodes[id]; !ok {
+			return errNodeNotFound
+		}
+		if seen[id] {
+			return errInvalidPin
+		}
+		seen[id] = true
+	}
+	if _, ok := t.graph.pathCost(p.Path); !ok {
+		return errInvalidPin
+	}
+
+	t.graph.Pins = append(t.graph.removePin(p.From, p.To), p)
+	sort.Slice(t.graph.Pins, func(i, j int) bool {
+		a, b := t.graph.Pins[i], t.graph.Pins[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	t.recordEvent(p.From, EventRoutePinned, pinDetail(p))
+
+	t.save()
+	return nil
+}
+
+// UnpinRoute removes the pin for from → to. Returns false if there was
+// none.
+func (t *Topology) UnpinRoute(from, to string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	n := len(t.graph.Pins)
+	t.graph.Pins = t.graph.removePin(from, to)
+	if len(t.graph.Pins) == n {
+		return false
+	}
+	t.recordEvent(from, EventRouteUnpinned, "to "+to)
+
+	t.save()
+	return true
+}
+
+// Pins returns the route pins sorted by From, To, with Broken set on
+// those the graph no longer supports.
+func (t *Topology) Pins() []RoutePin {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.init()
+
+	pins := append([]RoutePin{}, t.graph.Pins...)
+	for i, p := range pins {
+		_, ok := t.graph.pathCost(p.Path)
+		pins[i].Broken = !ok
+	}
+	return pins
+}
+
+// pinnedRoute returns the route along the pin for from → to, if there is
+// one the graph still supports.
+func (g *Graph) pinnedRoute(from, to string) (RouteResult, bool) {
+	for _, p := range g.Pins {
+		if p.From != from || p.To != to {
+			continue
+		}
+		cost, ok := g.pathCost(p.Path)
+		if !ok {
+			return RouteResult{}, false
+		}
+		return RouteResult{
+			From:     from,
+			To:       to,
+			NextHop:  p.Path[1],
+			FullPath: append([]string(nil), p.Path...),
+			Cost:     float64(cost),
+			Pinned:   true,
+		}, true
+	}
+	return RouteResult{}, false
+}
+
+// pathCost returns the total cost of path, or false if a hop has no edge.
+func (g *Graph) pathCost(path []string) (Cost, bool) {
+	var total Cost
+	for i := 0; i+1 < len(path); i++ {
+		node, ok := g.Nodes[path[i]]
+		if !ok {
+			return 0, false
+		}
+		found := false
+		for _, e := range node.Edges {
+			if e.To == path[i+1] {
+				total += e.Cost
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return total, true
+}
+
+// removePin returns g.Pins without the entry for from → to.
+func (g *Graph) removePin(from, to string) []RoutePin {
+	kept := make([]RoutePin, 0, len(g.Pins))
+	for _, p := range g.Pins {
+		if p.From != from || p.To != to {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// pinDetail describes p for a NodeEvent.
+func pinDetail(p RoutePin) string {
+	detail := "to " + p.To + " via " + strings.Join(p.Path, " > ")
+	if p.Reason != "" {
+		detail += " (" + p.Reason + ")"
+	}
+	return detail
+}
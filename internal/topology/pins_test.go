@@ -0,0 +1,108 @@
+package topology
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopology_PinRoute(t *testing.T) {
+	topo := overrideTopo()
+
+	res, err := topo.Route("a", "c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, res.FullPath)
+	assert.False(t, res.Pinned)
+
+	require.NoError(t, topo.PinRoute(RoutePin{From: "a", To: "c", Path: []string{"a", "c"}, Reason: "audit"}))
+	res, err = topo.Route("a", "c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, res.FullPath)
+	assert.Equal(t, "c", res.NextHop)
+	assert.Equal(t, 5.0, res.Cost)
+	assert.True(t, res.Pinned)
+
+	// Other pairs are routed as before
+	res, err = topo.Route("a", "b")
+	require.NoError(t, err)
+	assert.False(t, res.Pinned)
+
+	// An edge of the pin disappears: routing falls back
+	require.NoError(t, topo.SetOverride(EdgeOverride{From: "a", To: "c", Down: true}))
+	res, err = topo.Route("a", "c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, res.FullPath)
+	assert.False(t, res.Pinned)
+	pins := topo.Pins()
+	require.Len(t, pins, 1)
+	assert.True(t, pins[0].Broken)
+
+	assert.True(t, topo.UnpinRoute("a", "c"))
+	assert.False(t, topo.UnpinRoute("a", "c"))
+	assert.Empty(t, topo.Pins())
+}
+
+func TestTopology_PinRoute_Errors(t *testing.T) {
+	topo := overrideTopo()
+
+	assert.ErrorIs(t, topo.PinRoute(RoutePin{From: "a", To: "c", Path: []string{"a"}}), errInvalidPin)
+	assert.ErrorIs(t, topo.PinRoute(RoutePin{From: "a", To: "c", Path: []string{"b", "c"}}), errInvalidPin)
+	assert.ErrorIs(t, topo.PinRoute(RoutePin{From: "c", To: "a", Path: []string{"c", "a"}}), errInvalidPin, "no edge c -> a")
+	assert.ErrorIs(t, topo.PinRoute(RoutePin{From: "a", To: "c", Path: []string{"a", "zz", "c"}}), errNodeNotFound)
+	assert.ErrorIs(t, topo.PinRoute(RoutePin{From: "a", To: "a", Path: []string{"a", "b", "a"}}), errInvalidPin)
+	assert.Empty(t, topo.Pins())
+}
+
+func TestTopology_Pins_Persisted(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "topo.json"))
+	topo := &Topology{Store: store}
+	topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1}})
+	topo.Register(RelayInfo{Name: "b", Neighbors: map[string]float64{}})
+	require.NoError(t, topo.PinRoute(RoutePin{From: "a", To: "b", Path: []string{"a", "b"}}))
+
+	restored := &Topology{Store: store}
+	require.Len(t, restored.Pins(), 1)
+	res, err := restored.Route("a", "b")
+	require.NoError(t, err)
+	assert.True(t, res.Pinned)
+
+	// HA sync carries pins too.
+	synced := FromResponse(topo.Snapshot().ToResponse())
+	assert.Len(t, synced.Pins, 1)
+}
+
+func TestRoutePinHandlerFunc(t *testing.T) {
+	topo := overrideTopo()
+	handler := RoutePinHandlerFunc(topo)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/route/pin", `{"from":"a","to":"c","path":["a","c"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/route/pin", `{"from":"c","to":"a","path":["c","a"]}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/route/pin", `{"from":"a","to":"c","path":["a","zz","c"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/route/pin", `{"path":["a","c"]}`).Code)
+
+	rec := do(http.MethodGet, "/route/pin", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Pins  []RoutePin `json:"pins"`
+		Count int        `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, 1, body.Count)
+	assert.Equal(t, []string{"a", "c"}, body.Pins[0].Path)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/route/pin?from=a&to=c", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/route/pin?from=a&to=c", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPut, "/route/pin", "").Code)
+}
@@ -0,0 +1,693 @@
+package topology
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A topology query is a pipeline of stages separated by '|', evaluated
+// against a graph snapshot:
+//
+//	nodes(region=eu-*) | reachable_from(relay-a) | sort(cost) | limit(5)
+//
+// The first stage produces a result; later stages filter or transform it.
+//
+//	nodes(filter...)      all nodes matching the filters
+//	edges(filter...)      all edges matching the filters
+//	path(a, b)            the shortest path from a to b
+//	reachable_from(id)    nodes reachable from id, with cost = distance
+//	reaches(id)           nodes that can reach id, with cost = distance
+//	path_to(id)           shortest path from each node to id
+//	path_from(id)         shortest path from id to each node
+//	where(filter...)      keep items matching all filters
+//	sort(field)           sort ascending; sort(-field) for descending;
+//	                      paths also sort by hops
+//	limit(n)              keep the first n items
+//
+// Filters are field=glob, field!=glob, or a numeric comparison on cost
+// (cost<N, cost<=N, cost>N, cost>=N). Node fields are id, region, zone and
+// address; edge fields are from and to; path fields are from and to. Globs
+// use path.Match syntax. Arguments containing ',', '|' or parentheses can
+// be double-quoted.
+
+// maxQueryLength bounds the accepted expression.
+const maxQueryLength = 4096
+
+// Query result kinds.
+const (
+	QueryNodes = "nodes"
+	QueryEdges = "edges"
+	QueryPaths = "paths"
+)
+
+// QueryResult is the result of a topology query. Only the slice matching
+// Kind is set.
+type QueryResult struct {
+	Kind  string      `json:"kind"`
+	Nodes []QueryNode `json:"nodes,omitempty"`
+	Edges []QueryEdge `json:"edges,omitempty"`
+	Paths []QueryPath `json:"paths,omitempty"`
+	Count int         `json:"count"`
+}
+
+// QueryNode is a node in a query result. Cost is set after
+// reachable_from or reaches.
+type QueryNode struct {
+	NodeResponse
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+// QueryEdge is a directed edge in a query result.
+type QueryEdge struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Cost float64 `json:"cost"`
+}
+
+// QueryPath is a shortest path in a query result.
+type QueryPath struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Path []string `json:"path"`
+	Cost float64  `json:"cost"`
+}
+
+// QueryError reports a malformed or inapplicable query.
+type QueryError struct {
+	Stage string // empty for syntax errors
+	Msg   string
+}
+
+func (e *QueryError) Error() string {
+	if e.Stage == "" {
+		return "query: " + e.Msg
+	}
+	return fmt.Sprintf("query: %s: %s", e.Stage, e.Msg)
+}
+
+// queryStage is one parsed pipeline stage.
+type queryStage struct {
+	name string
+	args []queryArg
+}
+
+// queryArg is a positional value (op empty) or a field comparison.
+type queryArg struct {
+	field, op, value string
+}
+
+// Query evaluates expr against g.
+func (g *Graph) Query(expr string) (*QueryResult, error) {
+	stages, err := parseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &QueryResult{}
+	for i, st := range stages {
+		fn, ok := queryStages[st.name]
+		if !ok {
+			return nil, &QueryError{Stage: st.name, Msg: "unknown stage"}
+		}
+		if isSourceStage(st.name) != (i == 0) {
+			if i == 0 {
+				return nil, &QueryError{Stage: st.name, Msg: "must follow nodes(), edges() or path()"}
+			}
+			return nil, &QueryError{Stage: st.name, Msg: "must be the first stage"}
+		}
+		if err := fn(g, res, st.args); err != nil {
+			var qe *QueryError
+			if !errors.As(err, &qe) {
+				err = &QueryError{Stage: st.name, Msg: err.Error()}
+			}
+			return nil, err
+		}
+	}
+
+	switch res.Kind {
+	case QueryNodes:
+		res.Count = len(res.Nodes)
+	case QueryEdges:
+		res.Count = len(res.Edges)
+	case QueryPaths:
+		res.Count = len(res.Paths)
+	}
+	return res, nil
+}
+
+type stageFunc func(g *Graph, res *QueryResult, args []queryArg) error
+
+var queryStages = map[string]stageFunc{
+	"nodes":          stageNodes,
+	"edges":          stageEdges,
+	"path":           stagePath,
+	"reachable_from": stageReachable(false),
+	"reaches":        stageReachable(true),
+	"path_to":        stagePaths(true),
+	"path_from":      stagePaths(false),
+	"where":          stageWhere,
+	"sort":           stageSort,
+	"limit":          stageLimit,
+}
+
+func isSourceStage(name string) bool {
+	return name == "nodes" || name == "edges" || name == "path"
+}
+
+func stageNodes(g *Graph, res *QueryResult, args []queryArg) error {
+	res.Kind = QueryNodes
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := g.Nodes[id]
+		res.Nodes = append(res.Nodes, QueryNode{NodeResponse: NodeResponse{
+			ID:       n.ID,
+			Region:   n.Region,
+			Zone:     n.Zone,
+			Address:  n.Address,
+			Location: n.Location,
+			Version:  n.Version,
+		}})
+	}
+	return stageWhere(g, res, args)
+}
+
+func stageEdges(g *Graph, res *QueryResult, args []queryArg) error {
+	res.Kind = QueryEdges
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		edges := append([]Edge(nil), g.Nodes[id].Edges...)
+		sort.Slice(edges, func(i, j int) bool { return edges[i].To < edges[j].To })
+		for _, e := range edges {
+			res.Edges = append(res.Edges, QueryEdge{From: id, To: e.To, Cost: float64(e.Cost)})
+		}
+	}
+	return stageWhere(g, res, args)
+}
+
+func stagePath(g *Graph, res *QueryResult, args []queryArg) error {
+	from, to, err := twoPositional(args)
+	if err != nil {
+		return err
+	}
+	res.Kind = QueryPaths
+	p, cost, err := shortestPath(g, from, to)
+	if err != nil {
+		return err
+	}
+	res.Paths = []QueryPath{{From: from, To: to, Path: p, Cost: float64(cost)}}
+	return nil
+}
+
+// stageReachable keeps nodes reachable from (or, reversed, reaching) the
+// given node and records their distance as cost.
+func stageReachable(reversed bool) stageFunc {
+	return func(g *Graph, res *QueryResult, args []queryArg) error {
+		if res.Kind != QueryNodes {
+			return errors.New("applies to nodes")
+		}
+		id, err := onePositional(args)
+		if err != nil {
+			return err
+		}
+		if _, ok := g.Nodes[id]; !ok {
+			return errNodeNotFound
+		}
+
+		src := g
+		if reversed {
+			src = g.reversed()
+		}
+		dist := distances(src, id)
+
+		kept := res.Nodes[:0]
+		for _, n := range res.Nodes {
+			if d, ok := dist[n.ID]; ok {
+				cost := float64(d)
+				n.Cost = &cost
+				kept = append(kept, n)
+			}
+		}
+		res.Nodes = kept
+		return nil
+	}
+}
+
+// stagePaths replaces each node with its shortest path to (or from) the
+// given node. Nodes without a path are dropped.
+func stagePaths(to bool) stageFunc {
+	return func(g *Graph, res *QueryResult, args []queryArg) error {
+		if res.Kind != QueryNodes {
+			return errors.New("applies to nodes")
+		}
+		id, err := onePositional(args)
+		if err != nil {
+			return err
+		}
+		if _, ok := g.Nodes[id]; !ok {
+			return errNodeNotFound
+		}
+
+		var paths []QueryPath
+		for _, n := range res.Nodes {
+			from, dst := n.ID, id
+			if !to {
+				from, dst = id, n.ID
+			}
+			if from == dst {
+				continue
+			}
+			p, cost, err := shortestPath(g, from, dst)
+			if err != nil {
+				continue
+			}
+			paths = append(paths, QueryPath{From: from, To: dst, Path: p, Cost: float64(cost)})
+		}
+		res.Kind = QueryPaths
+		res.Nodes = nil
+		res.Paths = paths
+		return nil
+	}
+}
+
+func stageWhere(_ *Graph, res *QueryResult, args []queryArg) error {
+	for _, a := range args {
+		if a.op == "" {
+			return fmt.Errorf("expected a filter like field=value, got %q", a.value)
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	switch res.Kind {
+	case QueryNodes:
+		kept := res.Nodes[:0]
+		for _, n := range res.Nodes {
+			ok, err := matchAll(args, func(field string) (string, *float64, error) {
+				switch field {
+				case "id":
+					return n.ID, nil, nil
+				case "region":
+					return n.Region, nil, nil
+				case "zone":
+					return n.Zone, nil, nil
+				case "address":
+					return n.Address, nil, nil
+				case "cost":
+					if n.Cost == nil {
+						return "", nil, errors.New("cost is only known after reachable_from or reaches")
+					}
+					return "", n.Cost, nil
+				}
+				return "", nil, fmt.Errorf("unknown node field %q", field)
+			})
+			if err != nil {
+				return err
+			}
+			if ok {
+				kept = append(kept, n)
+			}
+		}
+		res.Nodes = kept
+	case QueryEdges:
+		kept := res.Edges[:0]
+		for _, e := range res.Edges {
+			ok, err := matchAll(args, func(field string) (string, *float64, error) {
+				switch field {
+				case "from":
+					return e.From, nil, nil
+				case "to":
+					return e.To, nil, nil
+				case "cost":
+					return "", &e.Cost, nil
+				}
+				return "", nil, fmt.Errorf("unknown edge field %q", field)
+			})
+			if err != nil {
+				return err
+			}
+			if ok {
+				kept = append(kept, e)
+			}
+		}
+		res.Edges = kept
+	case QueryPaths:
+		kept := res.Paths[:0]
+		for _, p := range res.Paths {
+			ok, err := matchAll(args, func(field string) (string, *float64, error) {
+				switch field {
+				case "from":
+					return p.From, nil, nil
+				case "to":
+					return p.To, nil, nil
+				case "cost":
+					return "", &p.Cost, nil
+				}
+				return "", nil, fmt.Errorf("unknown path field %q", field)
+			})
+			if err != nil {
+				return err
+			}
+			if ok {
+				kept = append(kept, p)
+			}
+		}
+		res.Paths = kept
+	}
+	return nil
+}
+
+// matchAll reports whether every filter matches the fields returned by
+// lookup, which yields a string or, for cost, a number.
+func matchAll(args []queryArg, lookup func(field string) (string, *float64, error)) (bool, error) {
+	for _, a := range args {
+		s, num, err := lookup(a.field)
+		if err != nil {
+			return false, err
+		}
+
+		var ok bool
+		if num != nil {
+			want, err := strconv.ParseFloat(a.value, 64)
+			if err != nil {
+				return false, fmt.Errorf("%s: %q is not a number", a.field, a.value)
+			}
+			switch a.op {
+			case "=":
+				ok = *num == want
+			case "!=":
+				ok = *num != want
+			case "<":
+				ok = *num < want
+			case "<=":
+				ok = *num <= want
+			case ">":
+				ok = *num > want
+			case ">=":
+				ok = *num >= want
+			}
+		} else {
+			if a.op != "=" && a.op != "!=" {
+				return false, fmt.Errorf("%s: %s needs a numeric field", a.field, a.op)
+			}
+			matched, err := path.Match(a.value, s)
+			if err != nil {
+				return false, fmt.Errorf("%s: bad pattern %q", a.field, a.value)
+			}
+			ok = matched == (a.op == "=")
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func stageSort(_ *Graph, res *QueryResult, args []queryArg) error {
+	field, err := onePositional(args)
+	if err != nil {
+		return err
+	}
+	desc := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+
+	// key returns a string or numeric sort key for item i.
+	var key func(i int) (string, float64, error)
+	var swap func(i, j int)
+	var n int
+	switch res.Kind {
+	case QueryNodes:
+		n, swap = len(res.Nodes), func(i, j int) { res.Nodes[i], res.Nodes[j] = res.Nodes[j], res.Nodes[i] }
+		key = func(i int) (string, float64, error) {
+			nd := res.Nodes[i]
+			switch field {
+			case "id":
+				return nd.ID, 0, nil
+			case "region":
+				return nd.Region, 0, nil
+			case "zone":
+				return nd.Zone, 0, nil
+			case "cost":
+				if nd.Cost == nil {
+					return "", 0, errors.New("cost is only known after reachable_from or reaches")
+				}
+				return "", *nd.Cost, nil
+			}
+			return "", 0, fmt.Errorf("cannot sort nodes by %q", field)
+		}
+	case QueryEdges:
+		n, swap = len(res.Edges), func(i, j int) { res.Edges[i], res.Edges[j] = res.Edges[j], res.Edges[i] }
+		key = func(i int) (string, float64, error) {
+			e := res.Edges[i]
+			switch field {
+			case "from":
+				return e.From, 0, nil
+			case "to":
+				return e.To, 0, nil
+			case "cost":
+				return "", e.Cost, nil
+			}
+			return "", 0, fmt.Errorf("cannot sort edges by %q", field)
+		}
+	case QueryPaths:
+		n, swap = len(res.Paths), func(i, j int) { res.Paths[i], res.Paths[j] = res.Paths[j], res.Paths[i] }
+		key = func(i int) (string, float64, error) {
+			p := res.Paths[i]
+			switch field {
+			case "from":
+				return p.From, 0, nil
+			case "to":
+				return p.To, 0, nil
+			case "cost":
+				return "", p.Cost, nil
+			case "hops":
+				return "", float64(len(p.Path) - 1), nil
+			}
+			return "", 0, fmt.Errorf("cannot sort paths by %q", field)
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	if _, _, err := key(0); err != nil {
+		return err
+	}
+
+	sort.Stable(funcSorter{n: n, swap: swap, less: func(i, j int) bool {
+		si, fi, _ := key(i)
+		sj, fj, _ := key(j)
+		if desc {
+			si, fi, sj, fj = sj, fj, si, fi
+		}
+		if si != sj {
+			return si < sj
+		}
+		return fi < fj
+	}})
+	return nil
+}
+
+// funcSorter adapts closures to sort.Interface so sort.Stable can reorder
+// whichever result slice is active.
+type funcSorter struct {
+	n    int
+	less func(i, j int) bool
+	swap func(i, j int)
+}
+
+func (s funcSorter) Len() int           { return s.n }
+func (s funcSorter) Less(i, j int) bool { return s.less(i, j) }
+func (s funcSorter) Swap(i, j int)      { s.swap(i, j) }
+
+func stageLimit(_ *Graph, res *QueryResult, args []queryArg) error {
+	v, err := onePositional(args)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%q is not a non-negative integer", v)
+	}
+	res.Nodes = res.Nodes[:min(n, len(res.Nodes))]
+	res.Edges = res.Edges[:min(n, len(res.Edges))]
+	res.Paths = res.Paths[:min(n, len(res.Paths))]
+	return nil
+}
+
+func onePositional(args []queryArg) (string, error) {
+	if len(args) != 1 || args[0].op != "" {
+		return "", errors.New("expects one argument")
+	}
+	return args[0].value, nil
+}
+
+func twoPositional(args []queryArg) (string, string, error) {
+	if len(args) != 2 || args[0].op != "" || args[1].op != "" {
+		return "", "", errors.New("expects two arguments")
+	}
+	return args[0].value, args[1].value, nil
+}
+
+// reversed returns a copy of g with every edge flipped.
+func (g *Graph) reversed() *Graph {
+	rev := newGraph()
+	for id := range g.Nodes {
+		rev.Nodes[id] = &Node{ID: id}
+	}
+	for id, n := range g.Nodes {
+		for _, e := range n.Edges {
+			if r, ok := rev.Nodes[e.To]; ok {
+				r.Edges = append(r.Edges, Edge{To: id, Cost: e.Cost})
+			}
+		}
+	}
+	return rev
+}
+
+// parseQuery splits expr into stages.
+func parseQuery(expr string) ([]queryStage, error) {
+	if len(expr) > maxQueryLength {
+		return nil, &QueryError{Msg: fmt.Sprintf("longer than %d bytes", maxQueryLength)}
+	}
+	p := &queryParser{s: expr}
+
+	var stages []queryStage
+	for {
+		st, err := p.stage()
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, st)
+
+		p.skipSpace()
+		if p.eof() {
+			return stages, nil
+		}
+		if !p.consume('|') {
+			return nil, p.errorf("expected '|'")
+		}
+	}
+}
+
+type queryParser struct {
+	s   string
+	pos int
+}
+
+func (p *queryParser) eof() bool { return p.pos >= len(p.s) }
+
+func (p *queryParser) skipSpace() {
+	for !p.eof() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *queryParser) consume(c byte) bool {
+	p.skipSpace()
+	if !p.eof() && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return &QueryError{Msg: fmt.Sprintf(format, args...) + fmt.Sprintf(" at offset %d", p.pos)}
+}
+
+// stage parses name(arg, ...); the parentheses are optional when there
+// are no arguments.
+func (p *queryParser) stage() (queryStage, error) {
+	p.skipSpace()
+	start := p.pos
+	for !p.eof() && (p.s[p.pos] == '_' || p.s[p.pos] >= 'a' && p.s[p.pos] <= 'z') {
+		p.pos++
+	}
+	st := queryStage{name: p.s[start:p.pos]}
+	if st.name == "" {
+		return st, p.errorf("expected a stage name")
+	}
+	if !p.consume('(') {
+		return st, nil
+	}
+	if p.consume(')') {
+		return st, nil
+	}
+	for {
+		arg, err := p.arg()
+		if err != nil {
+			return st, err
+		}
+		st.args = append(st.args, arg)
+		if p.consume(')') {
+			return st, nil
+		}
+		if !p.consume(',') {
+			return st, p.errorf("expected ',' or ')'")
+		}
+	}
+}
+
+// arg parses a value or field<op>value.
+func (p *queryParser) arg() (queryArg, error) {
+	first, err := p.value()
+	if err != nil {
+		return queryArg{}, err
+	}
+	p.skipSpace()
+	for _, op := range []string{"!=", "<=", ">=", "=", "<", ">"} {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			p.pos += len(op)
+			v, err := p.value()
+			if err != nil {
+				return queryArg{}, err
+			}
+			return queryArg{field: first, op: op, value: v}, nil
+		}
+	}
+	return queryArg{value: first}, nil
+}
+
+// value parses a bare word or a double-quoted string.
+func (p *queryParser) value() (string, error) {
+	p.skipSpace()
+	if !p.eof() && p.s[p.pos] == '"' {
+		end := p.pos + 1
+		for end < len(p.s) && p.s[end] != '"' {
+			if p.s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.s) {
+			return "", p.errorf("unterminated string")
+		}
+		v, err := strconv.Unquote(p.s[p.pos : end+1])
+		if err != nil {
+			return "", p.errorf("bad string")
+		}
+		p.pos = end + 1
+		return v, nil
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(",()|!=<> \t\n\"", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("expected a value")
+	}
+	return p.s[start:p.pos], nil
+}
@@ -0,0 +1,128 @@
+package topology
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queryGraph builds eu-a → eu-b → us-c plus an isolated ap-d.
+func queryGraph() *Graph {
+	g := newGraph()
+	g.addNode(&Node{ID: "eu-a", Region: "eu-west", Zone: "z1"})
+	g.addNode(&Node{ID: "eu-b", Region: "eu-central", Zone: "z2"})
+	g.addNode(&Node{ID: "us-c", Region: "us-east", Zone: "z3"})
+	g.addNode(&Node{ID: "ap-d", Region: "ap-south", Zone: "z4"})
+	g.addEdge("eu-a", "eu-b", 2)
+	g.addEdge("eu-b", "us-c", 5)
+	g.addEdge("eu-a", "us-c", 10)
+	return g
+}
+
+func nodeIDs(res *QueryResult) []string {
+	ids := make([]string, 0, len(res.Nodes))
+	for _, n := range res.Nodes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestQuery_Nodes(t *testing.T) {
+	g := queryGraph()
+
+	res, err := g.Query("nodes(region=eu-*)")
+	require.NoError(t, err)
+	assert.Equal(t, QueryNodes, res.Kind)
+	assert.Equal(t, []string{"eu-a", "eu-b"}, nodeIDs(res))
+	assert.Equal(t, 2, res.Count)
+
+	res, err = g.Query("nodes | where(region!=eu-*, zone=z4)")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ap-d"}, nodeIDs(res))
+}
+
+func TestQuery_ReachableSortLimit(t *testing.T) {
+	g := queryGraph()
+
+	res, err := g.Query("nodes | reachable_from(eu-a) | sort(-cost) | limit(2)")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"us-c", "eu-b"}, nodeIDs(res))
+	require.NotNil(t, res.Nodes[0].Cost)
+	assert.Equal(t, 7.0, *res.Nodes[0].Cost, "via eu-b, not the direct edge")
+
+	res, err = g.Query("nodes | reaches(us-c) | where(cost>0) | sort(cost)")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eu-b", "eu-a"}, nodeIDs(res))
+}
+
+func TestQuery_Paths(t *testing.T) {
+	g := queryGraph()
+
+	res, err := g.Query(`path(eu-a, "us-c")`)
+	require.NoError(t, err)
+	require.Len(t, res.Paths, 1)
+	assert.Equal(t, []string{"eu-a", "eu-b", "us-c"}, res.Paths[0].Path)
+	assert.Equal(t, 7.0, res.Paths[0].Cost)
+
+	res, err = g.Query("nodes | path_to(us-c) | sort(-hops)")
+	require.NoError(t, err)
+	assert.Equal(t, QueryPaths, res.Kind)
+	require.Len(t, res.Paths, 2, "ap-d has no path and us-c is the target")
+	assert.Equal(t, "eu-a", res.Paths[0].From)
+}
+
+func TestQuery_Edges(t *testing.T) {
+	res, err := queryGraph().Query("edges(from=eu-a, cost>=5)")
+	require.NoError(t, err)
+	assert.Equal(t, []QueryEdge{{From: "eu-a", To: "us-c", Cost: 10}}, res.Edges)
+}
+
+func TestQuery_Errors(t *testing.T) {
+	g := queryGraph()
+	for _, q := range []string{
+		"",
+		"nodes(",
+		"nodes | bogus",
+		"sort(id)",
+		"nodes | nodes",
+		"nodes | sort(cost)",
+		"nodes | reachable_from(missing)",
+		"edges | reachable_from(eu-a)",
+		"nodes | limit(-1)",
+		"nodes(region<eu)",
+		"nodes(color=red)",
+		`nodes(id="unterminated)`,
+	} {
+		_, err := g.Query(q)
+		var qe *QueryError
+		assert.ErrorAs(t, err, &qe, q)
+	}
+}
+
+func TestQueryHandlerFunc(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "relay-a", Region: "eu", Neighbors: map[string]float64{"relay-b": 1}})
+	topo.Register(RelayInfo{Name: "relay-b", Region: "us"})
+	handler := QueryHandlerFunc(topo)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/query?q="+url.QueryEscape("nodes | reachable_from(relay-a)"), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var res QueryResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Equal(t, 2, res.Count)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/query?q="+url.QueryEscape("nodes | bogus"), nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/query", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,156 @@
+package topology
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Seed is a planned topology loaded at startup, before any relay registers.
+// It pre-provisions sites that are not live yet, or lets the controller
+// answer route queries in planning-only mode without relays.
+//
+// Example seed file:
+//
+//	nodes:
+//	  - id: tokyo-1
+//	    region: ap-northeast
+//	    zone: apne1-az1
+//	    address: https://tokyo-1.example.net:4433
+//	    location: {lat: 35.68, lon: 139.69}
+//	  - id: osaka-1
+//	    region: ap-northeast
+//	edges:
+//	  - {from: tokyo-1, to: osaka-1, cost: 5, symmetric: true}
+type Seed struct {
+	Nodes []SeedNode `yaml:"nodes" json:"nodes"`
+	Edges []SeedEdge `yaml:"edges" json:"edges"`
+}
+
+// SeedNode is a planned relay.
+type SeedNode struct {
+	ID       string    `yaml:"id" json:"id"`
+	Region   string    `yaml:"region" json:"region,omitempty"`
+	Zone     string    `yaml:"zone" json:"zone,omitempty"`
+	Address  string    `yaml:"address" json:"address,omitempty"`
+	Location *Location `yaml:"location" json:"location,omitempty"`
+}
+
+// SeedEdge is a planned link. Cost 0 or omitted defaults to the
+// CostTemplate's cost, or 1. Symmetric also adds the reverse edge with the
+// same cost.
+type SeedEdge struct {
+	From      string  `yaml:"from" json:"from"`
+	To        string  `yaml:"to" json:"to"`
+	Cost      float64 `yaml:"cost" json:"cost,omitempty"`
+	Symmetric bool    `yaml:"symmetric" json:"symmetric,omitempty"`
+}
+
+// LoadSeedFile reads a seed from a YAML (or JSON) file and validates it.
+func LoadSeedFile(path string) (*Seed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read seed file: %w", err)
+	}
+
+	var s Seed
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse seed file: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("seed file %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// validate checks that nodes are named once and edges join declared nodes.
+func (s *Seed) validate() error {
+	ids := make(map[string]bool, len(s.Nodes))
+	for i, n := range s.Nodes {
+		if n.ID == "" {
+			return fmt.Errorf("nodes[%d]: id is required", i)
+		}
+		if ids[n.ID] {
+			return fmt.Errorf("nodes[%d]: duplicate id %q", i, n.ID)
+		}
+		ids[n.ID] = true
+	}
+	for i, e := range s.Edges {
+		switch {
+		case !ids[e.From]:
+			return fmt.Errorf("edges[%d]: unknown node %q", i, e.From)
+		case !ids[e.To]:
+			return fmt.Errorf("edges[%d]: unknown node %q", i, e.To)
+		case e.From == e.To:
+			return fmt.Errorf("edges[%d]: self-loop on %q", i, e.From)
+		case e.Cost < 0:
+			return fmt.Errorf("edges[%d]: negative cost", i)
+		}
+	}
+	return nil
+}
+
+// ApplySeed adds the seed's nodes and edges to the topology. It only fills
+// gaps: nodes and edges that were restored from the Store or registered by
+// a relay keep their state, and empty node fields are taken from the seed.
+// Seeded nodes have never sent a heartbeat, so the sweeper keeps them until
+// they register; their registration then replaces the seeded edges.
+// Returns how many nodes and edges were added.
+func (t *Topology) ApplySeed(s *Seed) (nodes, edges int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	for _, sn := range s.Nodes {
+		node, ok := t.graph.Nodes[sn.ID]
+		if !ok {
+			node = &Node{ID: sn.ID, Edges: []Edge{}}
+			t.graph.addNode(node)
+			t.recordEvent(sn.ID, EventSeeded, sn.Address)
+			nodes++
+		}
+		if node.Region == "" {
+			node.Region = sn.Region
+		}
+		if node.Zone == "" {
+			node.Zone = sn.Zone
+		}
+		if node.Address == "" {
+			node.Address = sn.Address
+		}
+		if node.Location == nil && sn.Location != nil {
+			loc := *sn.Location
+			node.Location = &loc
+		}
+	}
+
+	for _, se := range s.Edges {
+		cost := Cost(se.Cost)
+		if cost <= 0 {
+			cost = t.defaultCost(se.From, se.To)
+		}
+		if t.seedEdge(se.From, se.To, cost) {
+			edges++
+		}
+		if se.Symmetric && t.seedEdge(se.To, se.From, cost) {
+			edges++
+		}
+	}
+
+	t.graph.applyOverrides()
+	t.save()
+	return nodes, edges
+}
+
+// seedEdge adds the edge from → to unless it exists or from is live.
+// Caller must hold the write lock.
+func (t *Topology) seedEdge(from, to string, cost Cost) bool {
+	node, ok := t.graph.Nodes[from]
+	if !ok || !node.LastSeen.IsZero() || node.hasEdgeTo(to) {
+		return false
+	}
+	node.Edges = append(node.Edges, t.pricedEdge(from, to, cost))
+	return true
+}
@@ -0,0 +1,160 @@
+package topology
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSeed(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "seed.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadSeedFile(t *testing.T) {
+	seed, err := LoadSeedFile(writeSeed(t, `
+nodes:
+  - id: tokyo-1
+    region: ap-northeast
+    zone: apne1-az1
+    address: https://tokyo-1:4433
+    location: {lat: 35.68, lon: 139.69}
+  - id: osaka-1
+    region: ap-northeast
+edges:
+  - {from: tokyo-1, to: osaka-1, cost: 5, symmetric: true}
+`))
+	require.NoError(t, err)
+	require.Len(t, seed.Nodes, 2)
+	assert.Equal(t, "https://tokyo-1:4433", seed.Nodes[0].Address)
+	assert.Equal(t, &Location{Lat: 35.68, Lon: 139.69}, seed.Nodes[0].Location)
+	assert.Equal(t, []SeedEdge{{From: "tokyo-1", To: "osaka-1", Cost: 5, Symmetric: true}}, seed.Edges)
+}
+
+func TestLoadSeedFile_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"missing id":   "nodes:\n  - region: eu\n",
+		"duplicate id": "nodes:\n  - id: a\n  - id: a\n",
+		"unknown node": "nodes:\n  - id: a\nedges:\n  - {from: a, to: b}\n",
+		"self-loop":    "nodes:\n  - id: a\nedges:\n  - {from: a, to: a}\n",
+		"negative":     "nodes:\n  - id: a\n  - id: b\nedges:\n  - {from: a, to: b, cost: -1}\n",
+		"not yaml":     "nodes: [",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadSeedFile(writeSeed(t, content))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := LoadSeedFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestTopology_ApplySeed_PlanningOnly(t *testing.T) {
+	topo := &Topology{NodeTTL: time.Millisecond}
+	nodes, edges := topo.ApplySeed(&Seed{
+		Nodes: []SeedNode{
+			{ID: "a", Region: "eu", Address: "https://a:4433"},
+			{ID: "b", Region: "eu", Address: "https://b:4433"},
+			{ID: "c", Region: "us"},
+		},
+		Edges: []SeedEdge{
+			{From: "a", To: "b", Cost: 2, Symmetric: true},
+			{From: "b", To: "c"},
+		},
+	})
+	assert.Equal(t, 3, nodes)
+	assert.Equal(t, 3, edges)
+
+	// Planned relays are not routed to until they register.
+	_, err := topo.Route("a", "c")
+	assert.ErrorIs(t, err, errNoPath)
+
+	// Seeded nodes never expire.
+	time.Sleep(5 * time.Millisecond)
+	assert.Empty(t, topo.SweepStaleNodes())
+
+	require.NotEmpty(t, topo.NodeEvents("a"))
+	assert.Equal(t, EventSeeded, topo.NodeEvents("a")[0].Type)
+
+	// Applying it again adds nothing.
+	nodes, edges = topo.ApplySeed(&Seed{
+		Nodes: []SeedNode{{ID: "a"}},
+		Edges: []SeedEdge{{From: "a", To: "b"}},
+	})
+	assert.Zero(t, nodes)
+	assert.Zero(t, edges)
+}
+
+func TestTopology_ApplySeed_RoutesOnceRegistered(t *testing.T) {
+	topo := &Topology{}
+	topo.ApplySeed(&Seed{
+		Nodes: []SeedNode{{ID: "a"}, {ID: "b", Address: "https://b:4433"}, {ID: "c"}},
+		Edges: []SeedEdge{{From: "b", To: "c"}},
+	})
+	topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1}})
+	topo.Register(RelayInfo{Name: "c", Neighbors: map[string]float64{}})
+
+	// b is only planned: its seeded edge is not transited
+	_, err := topo.Route("a", "c")
+	assert.ErrorIs(t, err, errNoPath)
+
+	topo.Register(RelayInfo{Name: "b", Address: "https://b:4433", Neighbors: map[string]float64{"c": 1}})
+	result, err := topo.Route("a", "c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, result.FullPath)
+	assert.Equal(t, "https://b:4433", result.NextHopAddress)
+	assert.Equal(t, []string{"", "https://b:4433", ""}, result.FullPathAddresses)
+}
+
+func TestTopology_ApplySeed_LiveRelayTakesOver(t *testing.T) {
+	topo := &Topology{}
+	topo.ApplySeed(&Seed{
+		Nodes: []SeedNode{{ID: "a", Region: "eu", Zone: "z1"}, {ID: "b"}, {ID: "c"}},
+		Edges: []SeedEdge{{From: "a", To: "b"}},
+	})
+
+	topo.Register(RelayInfo{Name: "a", Address: "https://a:4433", Neighbors: map[string]float64{"c": 4}})
+
+	node, ok := topo.Node("a")
+	require.True(t, ok)
+	assert.Equal(t, "eu", node.Region, "seeded fields are kept")
+	assert.Equal(t, "https://a:4433", node.Address)
+	require.Len(t, node.Edges, 1, "registration replaces seeded edges")
+	assert.Equal(t, "c", node.Edges[0].To)
+
+	// A later seed leaves the live relay's edges alone.
+	_, edges := topo.ApplySeed(&Seed{
+		Nodes: []SeedNode{{ID: "a"}, {ID: "b"}},
+		Edges: []SeedEdge{{From: "a", To: "b"}},
+	})
+	assert.Zero(t, edges)
+}
+
+func TestTopology_ApplySeed_FillsStoredNodes(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "topology.json"))
+	g := newGraph()
+	g.addNode(&Node{ID: "a", Region: "stored", Edges: []Edge{{To: "b", Cost: 7}}})
+	g.addNode(&Node{ID: "b", Edges: []Edge{}})
+	require.NoError(t, store.Save(g))
+
+	topo := &Topology{Store: store}
+	nodes, edges := topo.ApplySeed(&Seed{
+		Nodes: []SeedNode{{ID: "a", Region: "seeded", Address: "https://a:4433"}, {ID: "b"}},
+		Edges: []SeedEdge{{From: "a", To: "b", Cost: 1}},
+	})
+	assert.Zero(t, nodes)
+	assert.Zero(t, edges)
+
+	node, _ := topo.Node("a")
+	assert.Equal(t, "stored", node.Region)
+	assert.Equal(t, "https://a:4433", node.Address, "the store does not keep addresses")
+	assert.Equal(t, Cost(7), node.Edges[0].Cost)
+}
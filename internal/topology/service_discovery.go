@@ -0,0 +1,88 @@
+package topology
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// defaultRelayPort is the port of a relay address that names none.
+const defaultRelayPort = "4433"
+
+// SDTargetGroup is a target group of Prometheus HTTP service discovery
+// (http_sd_configs).
+type SDTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// ServiceDiscoveryHandlerFunc returns an http.HandlerFunc that lists the
+// registered relays in the format of Prometheus HTTP service discovery, so
+// a Prometheus with
+//
+//	http_sd_configs:
+//	  - url: http://sdn:8090/sd/relays
+//
+// scrapes the /metrics of every relay:
+//
+//	GET /sd/relays
+//	GET /sd/relays?region=<region>  — only the relays of a region
+//
+// Each relay is a target group of its own: the host and port of its MoQT
+// address, where it also serves /metrics over TCP, labeled with its name
+// (relay), region, zone and version. Relays that registered no address
+// are left out.
+func ServiceDiscoveryHandlerFunc(topo *Topology) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		region := r.URL.Query().Get("region")
+		groups := []SDTargetGroup{}
+		for _, n := range topo.Snapshot().Nodes {
+			if region != "" && n.Region != region {
+				continue
+			}
+			target := HTTPHostPort(n.Address)
+			if target == "" {
+				continue
+			}
+			labels := map[string]string{"relay": n.ID}
+			for name, v := range map[string]string{"region": n.Region, "zone": n.Zone, "version": n.Version} {
+				if v != "" {
+					labels[name] = v
+				}
+			}
+			groups = append(groups, SDTargetGroup{Targets: []string{target}, Labels: labels})
+		}
+		slices.SortFunc(groups, func(a, b SDTargetGroup) int {
+			return strings.Compare(a.Labels["relay"], b.Labels["relay"])
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(groups)
+	}
+}
+
+// HTTPHostPort returns the host:port of a relay's MoQT address, where it
+// also serves HTTP (/health, /metrics) over TCP, e.g.
+// "relay-1:4433" for "https://relay-1:4433", or "" for no address.
+func HTTPHostPort(address string) string {
+	if address == "" {
+		return ""
+	}
+	host := address
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		return net.JoinHostPort(h, port)
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), defaultRelayPort)
+}
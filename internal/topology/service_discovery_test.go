@@ -0,0 +1,53 @@
+package topology
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceDiscoveryHandlerFunc(t *testing.T) {
+	topo := &Topology{}
+	require.NoError(t, topo.Register(RelayInfo{Name: "relay-b", Region: "eu", Zone: "eu-1a", Address: "https://relay-b.example:4433", Version: "v1.2.0", Neighbors: map[string]float64{"relay-x": 1}}))
+	require.NoError(t, topo.Register(RelayInfo{Name: "relay-a", Region: "us", Address: "https://relay-a.example"}))
+	require.NoError(t, topo.Register(RelayInfo{Name: "relay-c", Region: "eu"})) // no address
+	handler := ServiceDiscoveryHandlerFunc(topo)
+
+	get := func(target string) []SDTargetGroup {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var groups []SDTargetGroup
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&groups))
+		return groups
+	}
+
+	assert.Equal(t, []SDTargetGroup{
+		{Targets: []string{"relay-a.example:4433"}, Labels: map[string]string{"relay": "relay-a", "region": "us"}},
+		{Targets: []string{"relay-b.example:4433"}, Labels: map[string]string{"relay": "relay-b", "region": "eu", "zone": "eu-1a", "version": "v1.2.0"}},
+	}, get("/sd/relays"))
+	assert.Len(t, get("/sd/relays?region=eu"), 1)
+	assert.Equal(t, []SDTargetGroup{}, get("/sd/relays?region=ap"), "an empty list, not null")
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/sd/relays", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestHTTPHostPort(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                      "",
+		"https://relay-1:4433":  "relay-1:4433",
+		"https://relay-1":       "relay-1:4433",
+		"relay-1:9000":          "relay-1:9000",
+		"10.0.0.1:4433":         "10.0.0.1:4433",
+		"https://[2001:db8::1]": "[2001:db8::1]:4433",
+	} {
+		assert.Equal(t, want, HTTPHostPort(in), in)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // Store abstracts topology persistence.
@@ -32,9 +33,11 @@ func NewFileStore(path string) *FileStore {
 
 // persistNode is the JSON-serializable representation of a node.
 type persistNode struct {
-	ID     string        `json:"id"`
-	Region string        `json:"region,omitempty"`
-	Edges  []persistEdge `json:"edges,omitempty"`
+	ID       string        `json:"id"`
+	Region   string        `json:"region,omitempty"`
+	Zone     string        `json:"zone,omitempty"`
+	LastSeen time.Time     `json:"last_seen,omitzero"` // so routes resume before the relay's next heartbeat
+	Edges    []persistEdge `json:"edges,omitempty"`
 }
 
 // persistEdge is the JSON-serializable representation of an edge.
@@ -45,18 +48,30 @@ type persistEdge struct {
 
 // persistGraph is the top-level JSON structure written to disk.
 type persistGraph struct {
-	Nodes []persistNode `json:"nodes"`
+	Nodes      []persistNode            `json:"nodes"`
+	Overrides  []EdgeOverride           `json:"overrides,omitempty"`
+	Attributes []EdgeAttributesResponse `json:"attributes,omitempty"`
+
+	Maintenance []MaintenanceWindow `json:"maintenance,omitempty"`
+	Pins        []RoutePin          `json:"pins,omitempty"`
 }
 
 // Save writes the graph to the JSON file atomically (write-then-rename).
 func (s *FileStore) Save(g *Graph) error {
 	pg := persistGraph{
-		Nodes: make([]persistNode, 0, len(g.Nodes)),
+		Nodes:      make([]persistNode, 0, len(g.Nodes)),
+		Overrides:  g.Overrides,
+		Attributes: g.attributeList(),
+
+		Maintenance: g.Maintenance,
+		Pins:        g.Pins,
 	}
 	for _, n := range g.Nodes {
 		pn := persistNode{
-			ID:     n.ID,
-			Region: n.Region,
+			ID:       n.ID,
+			Region:   n.Region,
+			Zone:     n.Zone,
+			LastSeen: n.LastSeen,
 
 			Edges: make([]persistEdge, len(n.Edges)),
 		}
@@ -106,8 +121,10 @@ func (s *FileStore) Load() (*Graph, error) {
 	g := newGraph()
 	for _, pn := range pg.Nodes {
 		node := &Node{
-			ID:     pn.ID,
-			Region: pn.Region,
+			ID:       pn.ID,
+			Region:   pn.Region,
+			Zone:     pn.Zone,
+			LastSeen: pn.LastSeen,
 
 			Edges: make([]Edge, len(pn.Edges)),
 		}
@@ -116,6 +133,10 @@ func (s *FileStore) Load() (*Graph, error) {
 		}
 		g.addNode(node)
 	}
+	g.Overrides = pg.Overrides
+	g.Maintenance = pg.Maintenance
+	g.Pins = pg.Pins
+	g.setAttributeList(pg.Attributes)
 
 	return g, nil
 }
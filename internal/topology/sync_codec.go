@@ -0,0 +1,479 @@
+package topology
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// contentTypeProtobuf is the media type of the binary /sync snapshot.
+const contentTypeProtobuf = "application/x-protobuf"
+
+// The binary snapshot is a protobuf message equivalent to GraphResponse,
+// encoded by hand so no generated code is needed:
+//
+//	message Graph {
+//	  repeated Node nodes = 1;
+//	  repeated Adjacency adjacency = 2;
+//	  repeated EdgeOverride overrides = 3;
+//	  repeated EdgeAttributes attributes = 4;
+//	  repeated MaintenanceWindow maintenance = 5;
+//	  repeated RoutePin pins = 6;
+//	  int64 taken_at_unix_nano = 7;
+//	}
+//	message Node {
+//	  string id = 1; string region = 2; string zone = 3; string address = 4;
+//	  Location location = 5; int64 last_seen_unix_nano = 6; string version = 7;
+//	}
+//	message Location { double lat = 1; double lon = 2; }
+//	message Adjacency { string from = 1; repeated Edge edges = 2; }
+//	message Edge { string to = 1; double cost = 2; }
+//	message EdgeOverride {
+//	  string from = 1; string to = 2; double cost = 3; bool down = 4;
+//	  string reason = 5; int64 created_at_unix_nano = 6;
+//	}
+//	message EdgeAttributes {
+//	  string from = 1; string to = 2; double rtt_ms = 3; double loss = 4;
+//	  double utilization = 5; double weight = 6; double capacity_mbps = 7;
+//	  int64 fec_stripes = 8;
+//	}
+//	message MaintenanceWindow {
+//	  string relay = 1; int64 start_unix_nano = 2; int64 end_unix_nano = 3;
+//	  string reason = 4; int64 created_at_unix_nano = 5;
+//	}
+//	message RoutePin {
+//	  string from = 1; string to = 2; repeated string path = 3;
+//	  string reason = 4; int64 created_at_unix_nano = 5;
+//	}
+//
+// Adjacency entries are sorted by source and destination so equal graphs
+// encode to equal bytes. Unknown fields are skipped on decode.
+
+var errTruncated = errors.New("protobuf: truncated message")
+
+// MarshalProtobuf encodes resp in the binary snapshot format.
+func MarshalProtobuf(resp GraphResponse) []byte {
+	// Rough per-node estimate to avoid most regrowth on large graphs.
+	b := make([]byte, 0, 96*len(resp.Nodes))
+	var msg []byte
+	for _, n := range resp.Nodes {
+		msg = msg[:0]
+		msg = appendString(msg, 1, n.ID)
+		msg = appendString(msg, 2, n.Region)
+		msg = appendString(msg, 3, n.Zone)
+		msg = appendString(msg, 4, n.Address)
+		if n.Location != nil {
+			var loc []byte
+			loc = appendDouble(loc, 1, n.Location.Lat)
+			loc = appendDouble(loc, 2, n.Location.Lon)
+			msg = protowire.AppendTag(msg, 5, protowire.BytesType)
+			msg = protowire.AppendBytes(msg, loc)
+		}
+		msg = appendTime(msg, 6, n.LastSeen)
+		msg = appendString(msg, 7, n.Version)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+
+	sources := make([]string, 0, len(resp.Adjacency))
+	for src := range resp.Adjacency {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+	var edge []byte
+	for _, src := range sources {
+		neighbors := resp.Adjacency[src]
+		dsts := make([]string, 0, len(neighbors))
+		for dst := range neighbors {
+			dsts = append(dsts, dst)
+		}
+		sort.Strings(dsts)
+
+		msg = msg[:0]
+		msg = appendString(msg, 1, src)
+		for _, dst := range dsts {
+			edge = edge[:0]
+			edge = appendString(edge, 1, dst)
+			edge = appendDouble(edge, 2, neighbors[dst])
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendBytes(msg, edge)
+		}
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+
+	for _, o := range resp.Overrides {
+		msg = msg[:0]
+		msg = appendString(msg, 1, o.From)
+		msg = appendString(msg, 2, o.To)
+		msg = appendDouble(msg, 3, o.Cost)
+		if o.Down {
+			msg = protowire.AppendTag(msg, 4, protowire.VarintType)
+			msg = protowire.AppendVarint(msg, 1)
+		}
+		msg = appendString(msg, 5, o.Reason)
+		if !o.CreatedAt.IsZero() {
+			msg = protowire.AppendTag(msg, 6, protowire.VarintType)
+			msg = protowire.AppendVarint(msg, uint64(o.CreatedAt.UnixNano()))
+		}
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+
+	for _, a := range resp.Attributes {
+		msg = msg[:0]
+		msg = appendString(msg, 1, a.From)
+		msg = appendString(msg, 2, a.To)
+		msg = appendDouble(msg, 3, a.RTTMs)
+		msg = appendDouble(msg, 4, a.Loss)
+		msg = appendDouble(msg, 5, a.Utilization)
+		msg = appendDouble(msg, 6, a.Weight)
+		msg = appendDouble(msg, 7, a.CapacityMbps)
+		if a.FECStripes != 0 {
+			msg = protowire.AppendTag(msg, 8, protowire.VarintType)
+			msg = protowire.AppendVarint(msg, uint64(a.FECStripes))
+		}
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+
+	for _, w := range resp.Maintenance {
+		msg = msg[:0]
+		msg = appendString(msg, 1, w.Relay)
+		msg = appendTime(msg, 2, w.Start)
+		msg = appendTime(msg, 3, w.End)
+		msg = appendString(msg, 4, w.Reason)
+		msg = appendTime(msg, 5, w.CreatedAt)
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+
+	for _, p := range resp.Pins {
+		msg = msg[:0]
+		msg = appendString(msg, 1, p.From)
+		msg = appendString(msg, 2, p.To)
+		for _, id := range p.Path {
+			msg = protowire.AppendTag(msg, 3, protowire.BytesType)
+			msg = protowire.AppendString(msg, id)
+		}
+		msg = appendString(msg, 4, p.Reason)
+		msg = appendTime(msg, 5, p.CreatedAt)
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+
+	b = appendTime(b, 7, resp.TakenAt)
+	return b
+}
+
+// UnmarshalProtobuf decodes a snapshot produced by MarshalProtobuf.
+func UnmarshalProtobuf(b []byte) (GraphResponse, error) {
+	resp := GraphResponse{
+		Nodes:     []NodeResponse{},
+		Adjacency: make(map[string]map[string]float64),
+	}
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		if num == 7 && typ == protowire.VarintType {
+			resp.TakenAt = time.Unix(0, int64(x))
+		}
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			n, err := decodeNode(v)
+			if err != nil {
+				return err
+			}
+			resp.Nodes = append(resp.Nodes, n)
+		case 2:
+			return decodeAdjacency(v, resp.Adjacency)
+		case 3:
+			o, err := decodeOverride(v)
+			if err != nil {
+				return err
+			}
+			resp.Overrides = append(resp.Overrides, o)
+		case 4:
+			a, err := decodeAttributes(v)
+			if err != nil {
+				return err
+			}
+			resp.Attributes = append(resp.Attributes, a)
+		case 5:
+			w, err := decodeMaintenance(v)
+			if err != nil {
+				return err
+			}
+			resp.Maintenance = append(resp.Maintenance, w)
+		case 6:
+			p, err := decodePin(v)
+			if err != nil {
+				return err
+			}
+			resp.Pins = append(resp.Pins, p)
+		}
+		return nil
+	})
+	return resp, err
+}
+
+func decodeNode(b []byte) (NodeResponse, error) {
+	var n NodeResponse
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			n.ID = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			n.Region = string(v)
+		case num == 3 && typ == protowire.BytesType:
+			n.Zone = string(v)
+		case num == 4 && typ == protowire.BytesType:
+			n.Address = string(v)
+		case num == 5 && typ == protowire.BytesType:
+			loc := &Location{}
+			err := forEachField(v, func(num protowire.Number, typ protowire.Type, _ []byte, x uint64) error {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					loc.Lat = math.Float64frombits(x)
+				case num == 2 && typ == protowire.Fixed64Type:
+					loc.Lon = math.Float64frombits(x)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			n.Location = loc
+		case num == 6 && typ == protowire.VarintType:
+			n.LastSeen = time.Unix(0, int64(x))
+		case num == 7 && typ == protowire.BytesType:
+			n.Version = string(v)
+		}
+		return nil
+	})
+	return n, err
+}
+
+func decodeAdjacency(b []byte, adjacency map[string]map[string]float64) error {
+	var from string
+	neighbors := make(map[string]float64)
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			from = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			var to string
+			var cost float64
+			err := forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					to = string(v)
+				case num == 2 && typ == protowire.Fixed64Type:
+					cost = math.Float64frombits(x)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			neighbors[to] = cost
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(neighbors) > 0 {
+		adjacency[from] = neighbors
+	}
+	return nil
+}
+
+func decodeOverride(b []byte) (EdgeOverride, error) {
+	var o EdgeOverride
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			o.From = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			o.To = string(v)
+		case num == 3 && typ == protowire.Fixed64Type:
+			o.Cost = math.Float64frombits(x)
+		case num == 4 && typ == protowire.VarintType:
+			o.Down = x != 0
+		case num == 5 && typ == protowire.BytesType:
+			o.Reason = string(v)
+		case num == 6 && typ == protowire.VarintType:
+			o.CreatedAt = time.Unix(0, int64(x))
+		}
+		return nil
+	})
+	return o, err
+}
+
+func decodeAttributes(b []byte) (EdgeAttributesResponse, error) {
+	var a EdgeAttributesResponse
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			a.From = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			a.To = string(v)
+		case num == 3 && typ == protowire.Fixed64Type:
+			a.RTTMs = math.Float64frombits(x)
+		case num == 4 && typ == protowire.Fixed64Type:
+			a.Loss = math.Float64frombits(x)
+		case num == 5 && typ == protowire.Fixed64Type:
+			a.Utilization = math.Float64frombits(x)
+		case num == 6 && typ == protowire.Fixed64Type:
+			a.Weight = math.Float64frombits(x)
+		case num == 7 && typ == protowire.Fixed64Type:
+			a.CapacityMbps = math.Float64frombits(x)
+		case num == 8 && typ == protowire.VarintType:
+			a.FECStripes = int(x)
+		}
+		return nil
+	})
+	return a, err
+}
+
+func decodeMaintenance(b []byte) (MaintenanceWindow, error) {
+	var w MaintenanceWindow
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			w.Relay = string(v)
+		case num == 2 && typ == protowire.VarintType:
+			w.Start = time.Unix(0, int64(x))
+		case num == 3 && typ == protowire.VarintType:
+			w.End = time.Unix(0, int64(x))
+		case num == 4 && typ == protowire.BytesType:
+			w.Reason = string(v)
+		case num == 5 && typ == protowire.VarintType:
+			w.CreatedAt = time.Unix(0, int64(x))
+		}
+		return nil
+	})
+	return w, err
+}
+
+func decodePin(b []byte) (RoutePin, error) {
+	var p RoutePin
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			p.From = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			p.To = string(v)
+		case num == 3 && typ == protowire.BytesType:
+			p.Path = append(p.Path, string(v))
+		case num == 4 && typ == protowire.BytesType:
+			p.Reason = string(v)
+		case num == 5 && typ == protowire.VarintType:
+			p.CreatedAt = time.Unix(0, int64(x))
+		}
+		return nil
+	})
+	return p, err
+}
+
+// forEachField walks the fields of a protobuf message. Length-delimited
+// values are passed in v; varint and fixed64 values in x.
+func forEachField(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			x, n = protowire.ConsumeFixed64(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errTruncated
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(t.UnixNano()))
+}
+
+func appendDouble(b []byte, num protowire.Number, f float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(f))
+}
+
+// isProtobuf reports whether a Content-Type header names the binary
+// snapshot format.
+func isProtobuf(contentType string) bool {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	return mt == contentTypeProtobuf
+}
+
+// prefersProtobuf reports whether an Accept header ranks the binary
+// snapshot format above JSON. JSON wins ties and is the default.
+func prefersProtobuf(accept string) bool {
+	var pb, js float64 = -1, -1
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case contentTypeProtobuf:
+			pb = max(pb, q)
+		case "application/json", "*/*", "application/*":
+			js = max(js, q)
+		}
+	}
+	return pb > 0 && pb > js
+}
+
+// setSyncAccept asks a peer for the binary snapshot, falling back to JSON
+// for peers that predate it.
+func setSyncAccept(h http.Header) {
+	h.Set("Accept", contentTypeProtobuf+", application/json;q=0.5")
+}
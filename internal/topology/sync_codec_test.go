@@ -0,0 +1,287 @@
+package topology
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleGraphResponse() GraphResponse {
+	return GraphResponse{
+		Nodes: []NodeResponse{
+			{ID: "A", Region: "us-east-1", Zone: "use1-az1", Address: "https://a:4433", Location: &Location{Lat: 40.7, Lon: -74.0}, Version: "v0.9.0"},
+			{ID: "B", Region: "eu-west-1"},
+			{ID: "C"},
+		},
+		Adjacency: map[string]map[string]float64{
+			"A": {"B": 1.5, "C": 0.25},
+			"B": {"A": 2},
+		},
+		Overrides: []EdgeOverride{
+			{From: "A", To: "B", Cost: 9, Reason: "maintenance", CreatedAt: time.Unix(1700000000, 123).UTC()},
+			{From: "B", To: "C", Down: true},
+		},
+		Maintenance: []MaintenanceWindow{
+			{Relay: "B", Start: time.Unix(1700000000, 0).UTC(), End: time.Unix(1700003600, 0).UTC(), Reason: "kernel upgrade", CreatedAt: time.Unix(1699990000, 5).UTC()},
+		},
+		Pins: []RoutePin{
+			{From: "B", To: "C", Path: []string{"B", "A", "C"}, Reason: "data residency", CreatedAt: time.Unix(1700000000, 7).UTC()},
+		},
+		Attributes: []EdgeAttributesResponse{
+			{From: "A", To: "B", EdgeAttributes: EdgeAttributes{RTTMs: 12, Loss: 0.01, Utilization: 0.5, Weight: 2, CapacityMbps: 1000, FECStripes: 2}},
+		},
+	}
+}
+
+// largeGraphResponse builds an n-node graph with ~degree edges per node.
+func largeGraphResponse(n, degree int) GraphResponse {
+	resp := GraphResponse{
+		Nodes:     make([]NodeResponse, 0, n),
+		Adjacency: make(map[string]map[string]float64, n),
+	}
+	for i := range n {
+		id := fmt.Sprintf("relay-%05d", i)
+		resp.Nodes = append(resp.Nodes, NodeResponse{
+			ID:       id,
+			Region:   fmt.Sprintf("region-%d", i%16),
+			Zone:     fmt.Sprintf("zone-%d", i%64),
+			Address:  "https://" + id + ".example.net:4433",
+			Location: &Location{Lat: float64(i%180) - 90, Lon: float64(i%360) - 180},
+		})
+		neighbors := make(map[string]float64, degree)
+		for d := 1; d <= degree; d++ {
+			neighbors[fmt.Sprintf("relay-%05d", (i+d*7)%n)] = float64(d) + 0.5
+		}
+		resp.Adjacency[id] = neighbors
+	}
+	return resp
+}
+
+func TestProtobuf_RoundTrip(t *testing.T) {
+	want := sampleGraphResponse()
+
+	got, err := UnmarshalProtobuf(MarshalProtobuf(want))
+	require.NoError(t, err)
+
+	assert.Equal(t, want.Nodes, got.Nodes)
+	assert.Equal(t, "v0.9.0", got.Nodes[0].Version)
+	assert.Equal(t, want.Adjacency, got.Adjacency)
+	require.Len(t, got.Overrides, 2)
+	assert.True(t, want.Overrides[0].CreatedAt.Equal(got.Overrides[0].CreatedAt))
+	got.Overrides[0].CreatedAt = want.Overrides[0].CreatedAt
+	assert.Equal(t, want.Overrides, got.Overrides)
+	require.Len(t, got.Maintenance, 1)
+	assert.True(t, want.Maintenance[0].End.Equal(got.Maintenance[0].End))
+	assert.True(t, want.Maintenance[0].CreatedAt.Equal(got.Maintenance[0].CreatedAt))
+	assert.Equal(t, want.Maintenance[0].Reason, got.Maintenance[0].Reason)
+	require.Len(t, got.Pins, 1)
+	assert.True(t, want.Pins[0].CreatedAt.Equal(got.Pins[0].CreatedAt))
+	got.Pins[0].CreatedAt = want.Pins[0].CreatedAt
+	assert.Equal(t, want.Pins, got.Pins)
+}
+
+func TestProtobuf_RoundTripMatchesJSON(t *testing.T) {
+	resp := largeGraphResponse(500, 4)
+
+	fromPB, err := UnmarshalProtobuf(MarshalProtobuf(resp))
+	require.NoError(t, err)
+
+	data, err := json.Marshal(resp)
+	require.NoError(t, err)
+	var fromJSON GraphResponse
+	require.NoError(t, json.Unmarshal(data, &fromJSON))
+
+	assert.Equal(t, fromJSON.Nodes, fromPB.Nodes)
+	assert.Equal(t, fromJSON.Adjacency, fromPB.Adjacency)
+}
+
+func TestProtobuf_Deterministic(t *testing.T) {
+	resp := largeGraphResponse(100, 3)
+	assert.Equal(t, MarshalProtobuf(resp), MarshalProtobuf(resp))
+}
+
+func TestProtobuf_Empty(t *testing.T) {
+	got, err := UnmarshalProtobuf(MarshalProtobuf(GraphResponse{}))
+	require.NoError(t, err)
+	assert.Empty(t, got.Nodes)
+	assert.Empty(t, got.Adjacency)
+	assert.Empty(t, got.Overrides)
+}
+
+func TestProtobuf_Truncated(t *testing.T) {
+	data := MarshalProtobuf(sampleGraphResponse())
+
+	_, err := UnmarshalProtobuf(data[:len(data)-3])
+	assert.Error(t, err)
+}
+
+func TestProtobuf_SmallerThanJSON(t *testing.T) {
+	resp := largeGraphResponse(1000, 4)
+	data, err := json.Marshal(resp)
+	require.NoError(t, err)
+
+	assert.Less(t, len(MarshalProtobuf(resp)), len(data))
+}
+
+func TestPrefersProtobuf(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"*/*", false},
+		{"application/x-protobuf", true},
+		{"application/x-protobuf, application/json;q=0.5", true},
+		{"application/json, application/x-protobuf;q=0.5", false},
+		{"application/x-protobuf;q=0", false},
+		{"application/x-protobuf, */*", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, prefersProtobuf(tt.accept), "Accept: %q", tt.accept)
+	}
+}
+
+func TestSyncHandlerFunc_GET_Protobuf(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "A", Region: "us-east-1", Neighbors: map[string]float64{"B": 1}})
+	topo.Register(RelayInfo{Name: "B", Region: "us-west-1", Neighbors: map[string]float64{}})
+
+	req := httptest.NewRequest(http.MethodGet, "/sync", nil)
+	req.Header.Set("Accept", "application/x-protobuf")
+	rec := httptest.NewRecorder()
+	SyncHandlerFunc(topo)(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-protobuf", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Values("Vary"), "Accept")
+
+	resp, err := UnmarshalProtobuf(rec.Body.Bytes())
+	require.NoError(t, err)
+	assert.Len(t, resp.Nodes, 2)
+	assert.Equal(t, map[string]float64{"B": 1}, resp.Adjacency["A"])
+}
+
+func TestSyncHandlerFunc_PUT_Protobuf(t *testing.T) {
+	topo := &Topology{}
+
+	req := httptest.NewRequest(http.MethodPut, "/sync", bytes.NewReader(MarshalProtobuf(sampleGraphResponse())))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	rec := httptest.NewRecorder()
+	SyncHandlerFunc(topo)(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	g := topo.Snapshot()
+	assert.Len(t, g.Nodes, 3)
+	assert.Equal(t, "use1-az1", g.Nodes["A"].Zone)
+	assert.Equal(t, "v0.9.0", g.Nodes["A"].Version)
+	assert.Len(t, topo.Overrides(), 2)
+}
+
+func TestSyncHandlerFunc_PUT_InvalidProtobuf(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/sync", bytes.NewReader([]byte{0x0a, 0xff}))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	rec := httptest.NewRecorder()
+	SyncHandlerFunc(&Topology{})(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestPeerSyncer_Pull_Protobuf(t *testing.T) {
+	source := &Topology{}
+	source.Register(RelayInfo{Name: "peer-a", Region: "us-east-1", Neighbors: map[string]float64{"peer-b": 2}})
+	source.Register(RelayInfo{Name: "peer-b", Region: "us-west-1", Neighbors: map[string]float64{}})
+
+	var gotType string
+	handler := SyncHandlerFunc(source)
+	peerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r)
+		gotType = w.Header().Get("Content-Type")
+	}))
+	defer peerServer.Close()
+
+	target := &Topology{}
+	require.NoError(t, NewPeerSyncer(peerServer.URL, target, time.Second).pull())
+
+	assert.Equal(t, "application/x-protobuf", gotType)
+	g := target.Snapshot()
+	assert.Len(t, g.Nodes, 2)
+	require.Len(t, g.Nodes["peer-a"].Edges, 1)
+	assert.Equal(t, Cost(2), g.Nodes["peer-a"].Edges[0].Cost)
+}
+
+func TestPeerSyncer_Push_Protobuf(t *testing.T) {
+	source := &Topology{}
+	source.Register(RelayInfo{Name: "A", Region: "us-east-1", Neighbors: map[string]float64{"B": 1}})
+
+	var received GraphResponse
+	peerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received, err = UnmarshalProtobuf(data)
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer peerServer.Close()
+
+	syncer := NewPeerSyncer(peerServer.URL, source, time.Second)
+	syncer.Binary = true
+	require.NoError(t, syncer.Push())
+
+	assert.Len(t, received.Nodes, 2) // A and its placeholder neighbor B
+	assert.Equal(t, map[string]float64{"B": 1}, received.Adjacency["A"])
+}
+
+func BenchmarkSyncEncodeJSON10k(b *testing.B) {
+	resp := largeGraphResponse(10000, 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, _ := json.Marshal(resp)
+		b.SetBytes(int64(len(data)))
+	}
+}
+
+func BenchmarkSyncEncodeProtobuf10k(b *testing.B) {
+	resp := largeGraphResponse(10000, 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data := MarshalProtobuf(resp)
+		b.SetBytes(int64(len(data)))
+	}
+}
+
+func BenchmarkSyncDecodeJSON10k(b *testing.B) {
+	data, _ := json.Marshal(largeGraphResponse(10000, 8))
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var resp GraphResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSyncDecodeProtobuf10k(b *testing.B) {
+	data := MarshalProtobuf(largeGraphResponse(10000, 8))
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := UnmarshalProtobuf(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package topology
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,6 +20,13 @@ import (
 //	GET  /sync — export current topology snapshot for peer consumption
 //	PUT  /sync — import topology snapshot from peer controller
 //
+// Snapshots are JSON by default. Clients preferring application/x-protobuf
+// in Accept get the binary format (see MarshalProtobuf), and a PUT with that
+// Content-Type is decoded as binary.
+//
+// A PUT is applied with the topology's SyncStrategy, reported in the
+// answer, and refused with 429 while another import is in progress.
+//
 // This enables Active-Standby HA: the standby periodically pulls
 // the active's snapshot, or the active pushes on every mutation.
 type SyncHandler struct {
@@ -33,31 +43,62 @@ func (h *SyncHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // export/import behavior (GET/PUT). Keeping a HandlerFunc simplifies
 // router registration and unit testing.
 func SyncHandlerFunc(topo *Topology) http.HandlerFunc {
+	var importing atomic.Bool
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			g := topo.Snapshot()
 			resp := g.ToResponse()
+			resp.TakenAt = time.Now()
+
+			w.Header().Add("Vary", "Accept")
+			if prefersProtobuf(r.Header.Get("Accept")) {
+				data := MarshalProtobuf(resp)
+				w.Header().Set("Content-Type", contentTypeProtobuf)
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				w.WriteHeader(http.StatusOK)
+				w.Write(data)
+				return
+			}
 
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(resp)
 
 		case http.MethodPut:
+			// A snapshot waiting behind another import would be stale by
+			// the time it applies; the peer retries with a fresh one.
+			if !importing.CompareAndSwap(false, true) {
+				w.Header().Set("Retry-After", "1")
+				jsonError(w, http.StatusTooManyRequests, "a sync import is already in progress")
+				return
+			}
+			defer importing.Store(false)
+
 			var resp GraphResponse
-			if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
-				jsonError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			if isProtobuf(r.Header.Get("Content-Type")) {
+				data, err := readBody(w, r, MaxSyncBytes)
+				if err == nil {
+					resp, err = UnmarshalProtobuf(data)
+				}
+				if err != nil {
+					jsonError(w, DecodeErrorStatus(err), "invalid protobuf: "+err.Error())
+					return
+				}
+			} else if err := DecodeJSON(w, r, MaxSyncBytes, &resp); err != nil {
+				jsonError(w, DecodeErrorStatus(err), "invalid JSON: "+err.Error())
 				return
 			}
 
-			g := FromResponse(resp)
-			topo.Restore(g)
+			res := topo.Import(resp)
 
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(map[string]any{
-				"status": "synced",
-				"nodes":  len(g.Nodes),
+				"status":     "synced",
+				"nodes":      res.Nodes,
+				"strategy":   res.Strategy,
+				"kept_local": res.KeptLocal,
 			})
 
 		default:
@@ -66,13 +107,25 @@ func SyncHandlerFunc(topo *Topology) http.HandlerFunc {
 	}
 }
 
+// compressSyncMinSize is the snapshot size above which Push gzips the body.
+// The receiving controller decodes it in sdn.CompressHandler.
+const compressSyncMinSize = 1024
+
 // PeerSyncer periodically pulls topology from a peer controller.
 // Used by standby nodes to stay in sync with the active controller.
+//
+// Pulls request the binary snapshot and fall back to JSON when the peer
+// answers with it.
 type PeerSyncer struct {
 	PeerURL  string // e.g. "http://active-controller:8090"
 	Topology *Topology
 	Interval time.Duration
-	client   *http.Client
+
+	// Binary makes Push send the binary snapshot. Leave unset when the
+	// peer may predate it.
+	Binary bool
+
+	client *http.Client
 }
 
 // NewPeerSyncer creates a syncer that pulls from the given peer URL.
@@ -103,7 +156,13 @@ func (ps *PeerSyncer) Run(ctx context.Context) {
 }
 
 func (ps *PeerSyncer) pull() error {
-	resp, err := ps.client.Get(ps.PeerURL + "/sync")
+	req, err := http.NewRequest(http.MethodGet, ps.PeerURL+"/sync", nil)
+	if err != nil {
+		return fmt.Errorf("GET /sync: %w", err)
+	}
+	setSyncAccept(req.Header)
+
+	resp, err := ps.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("GET /sync: %w", err)
 	}
@@ -114,14 +173,20 @@ func (ps *PeerSyncer) pull() error {
 	}
 
 	var graphResp GraphResponse
-	if err := json.NewDecoder(resp.Body).Decode(&graphResp); err != nil {
+	data, err := readLimited(resp.Body, MaxSyncBytes)
+	if err == nil && isProtobuf(resp.Header.Get("Content-Type")) {
+		graphResp, err = UnmarshalProtobuf(data)
+	} else if err == nil {
+		err = unmarshalJSON(data, &graphResp)
+	}
+	if err != nil {
 		return fmt.Errorf("decode response: %w", err)
 	}
 
-	g := FromResponse(graphResp)
-	ps.Topology.Restore(g)
+	res := ps.Topology.Import(graphResp)
 
-	slog.Debug("synced topology from peer", "peer", ps.PeerURL, "nodes", len(g.Nodes))
+	slog.Debug("synced topology from peer", "peer", ps.PeerURL, "nodes", res.Nodes,
+		"strategy", res.Strategy, "kept_local", res.KeptLocal)
 	return nil
 }
 
@@ -130,17 +195,36 @@ func (ps *PeerSyncer) pull() error {
 func (ps *PeerSyncer) Push() error {
 	g := ps.Topology.Snapshot()
 	resp := g.ToResponse()
-
-	data, err := json.Marshal(resp)
-	if err != nil {
-		return fmt.Errorf("marshal: %w", err)
+	resp.TakenAt = time.Now()
+
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	var data []byte
+	if ps.Binary {
+		data = MarshalProtobuf(resp)
+		header.Set("Content-Type", contentTypeProtobuf)
+	} else {
+		var err error
+		if data, err = json.Marshal(resp); err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+	}
+	if len(data) >= compressSyncMinSize {
+		raw := len(data)
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+		header.Set("Content-Encoding", "gzip")
+		slog.Debug("compressed topology push", "raw_bytes", raw, "encoded_bytes", len(data))
 	}
 
 	httpResp, err := ps.client.Do(&http.Request{
-		Method: http.MethodPut,
-		URL:    mustParseURL(ps.PeerURL + "/sync"),
-		Body:   io.NopCloser(bytes.NewReader(data)),
-		Header: http.Header{"Content-Type": []string{"application/json"}},
+		Method:        http.MethodPut,
+		URL:           mustParseURL(ps.PeerURL + "/sync"),
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Header:        header,
 	})
 	if err != nil {
 		return fmt.Errorf("PUT /sync: %w", err)
@@ -2,8 +2,10 @@ package topology
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -328,3 +330,27 @@ func TestMustParseURL_Panic(t *testing.T) {
 		mustParseURL("://invalid")
 	})
 }
+
+func TestPeerSyncer_PushCompressesLargeSnapshots(t *testing.T) {
+	var encoding string
+	var nodes int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		var resp GraphResponse
+		require.NoError(t, json.NewDecoder(zr).Decode(&resp))
+		nodes = len(resp.Nodes)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	topo := &Topology{}
+	for i := range 50 {
+		topo.Register(RelayInfo{Name: fmt.Sprintf("relay-%02d", i), Region: "ap-northeast-1", Neighbors: map[string]float64{}})
+	}
+
+	require.NoError(t, NewPeerSyncer(srv.URL, topo, time.Hour).Push())
+	assert.Equal(t, "gzip", encoding)
+	assert.Equal(t, 50, nodes)
+}
@@ -0,0 +1,131 @@
+package topology
+
+import (
+	"fmt"
+	"time"
+)
+
+// SyncStrategy selects how Import applies a snapshot from a peer
+// controller to the local graph.
+type SyncStrategy string
+
+const (
+	// SyncReplace replaces the graph with the snapshot, dropping whatever
+	// registered locally since the peer took it.
+	SyncReplace SyncStrategy = "replace"
+
+	// SyncMerge takes each node from the snapshot or the local graph,
+	// whichever heard from the relay last, and keeps local nodes that
+	// registered after the snapshot was taken. Operator state (overrides,
+	// maintenance, pins and edge attributes) is taken from the snapshot.
+	SyncMerge SyncStrategy = "merge"
+)
+
+// DefaultSyncStrategy is the strategy of an empty SyncStrategy.
+const DefaultSyncStrategy = SyncMerge
+
+// ParseSyncStrategy parses "replace" or "merge"; empty is
+// DefaultSyncStrategy.
+func ParseSyncStrategy(s string) (SyncStrategy, error) {
+	switch st := SyncStrategy(s); st {
+	case "":
+		return DefaultSyncStrategy, nil
+	case SyncReplace, SyncMerge:
+		return st, nil
+	}
+	return "", fmt.Errorf("sync strategy must be replace or merge, got %q", s)
+}
+
+// OrDefault returns s, or DefaultSyncStrategy if s is empty.
+func (s SyncStrategy) OrDefault() SyncStrategy {
+	if s == "" {
+		return DefaultSyncStrategy
+	}
+	return s
+}
+
+// SyncResult reports the outcome of an Import.
+type SyncResult struct {
+	Strategy SyncStrategy `json:"strategy"`
+	Nodes    int          `json:"nodes"` // nodes of the graph after the import
+
+	// KeptLocal counts the local nodes that won over the snapshot's.
+	KeptLocal int `json:"kept_local"`
+}
+
+// Import applies a snapshot exported by a peer controller with the
+// topology's SyncStrategy. The generation only advances if the import
+// changed what /graph and /route answer from, so periodic syncs of an
+// unchanged graph keep the ETags relays revalidate with.
+func (t *Topology) Import(resp GraphResponse) SyncResult {
+	g := FromResponse(resp)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	res := SyncResult{Strategy: t.SyncStrategy.OrDefault()}
+	if res.Strategy == SyncMerge {
+		res.KeptLocal = mergeNodes(g, t.graph, resp.TakenAt)
+	}
+	before := t.stateTag()
+	t.graph = g
+	t.applyMaintenance(time.Now())
+	if t.stateTag() != before {
+		t.save()
+	} else {
+		t.persist() // newer heartbeats only
+	}
+
+	res.Nodes = len(g.Nodes)
+	return res
+}
+
+// mergeNodes copies into the snapshot g the nodes of the local graph that
+// are newer than the snapshot's: nodes heard from after their copy in g,
+// and nodes missing from g heard from after takenAt. A zero takenAt, from
+// a peer predating it, is taken as the snapshot's latest heartbeat. It
+// returns the number of nodes copied.
+func mergeNodes(g, local *Graph, takenAt time.Time) int {
+	if takenAt.IsZero() {
+		for _, n := range g.Nodes {
+			if n.LastSeen.After(takenAt) {
+				takenAt = n.LastSeen
+			}
+		}
+	}
+
+	var kept []*Node
+	for id, n := range local.Nodes {
+		if in, ok := g.Nodes[id]; ok && n.LastSeen.After(in.LastSeen) || !ok && n.LastSeen.After(takenAt) {
+			kept = append(kept, n)
+		}
+	}
+
+	for _, n := range kept {
+		g.Nodes[n.ID] = n
+		for _, e := range n.Edges {
+			// neighbors it named before they registered
+			if _, ok := g.Nodes[e.To]; !ok {
+				if nb, ok := local.Nodes[e.To]; ok {
+					g.Nodes[e.To] = nb
+				}
+			}
+		}
+	}
+
+	// Reverse edges the kept registrations added to the snapshot's nodes
+	for _, n := range local.Nodes {
+		merged, ok := g.Nodes[n.ID]
+		if !ok || merged == n {
+			continue
+		}
+		for _, e := range n.Edges {
+			if e.Auto && g.Nodes[e.To] == local.Nodes[e.To] && !g.hasEdge(n.ID, e.To) {
+				merged.Edges = append(merged.Edges, e)
+			}
+		}
+	}
+	return len(kept)
+}
@@ -0,0 +1,195 @@
+package topology
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncedGraph is a standby's view of the graph: relay-a and relay-b synced
+// from the peer a minute ago.
+func syncedGraph(t *testing.T, strategy SyncStrategy) *Topology {
+	t.Helper()
+	topo := &Topology{SyncStrategy: strategy}
+	topo.Import(GraphResponse{
+		Nodes: []NodeResponse{
+			{ID: "relay-a", Region: "old", LastSeen: time.Now().Add(-time.Minute)},
+			{ID: "relay-b", LastSeen: time.Now().Add(-time.Minute)},
+		},
+		Adjacency: map[string]map[string]float64{"relay-a": {"relay-b": 1}},
+		TakenAt:   time.Now().Add(-time.Minute),
+	})
+	return topo
+}
+
+func TestParseSyncStrategy(t *testing.T) {
+	for in, want := range map[string]SyncStrategy{"": SyncMerge, "replace": SyncReplace, "merge": SyncMerge} {
+		got, err := ParseSyncStrategy(in)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+		assert.Equal(t, want, SyncStrategy(in).OrDefault(), "unset strategies agree")
+	}
+	_, err := ParseSyncStrategy("newest")
+	assert.Error(t, err)
+}
+
+func TestImport_Merge(t *testing.T) {
+	topo := syncedGraph(t, SyncMerge)
+
+	// relay-a re-registers and relay-c joins on the standby...
+	require.NoError(t, topo.Register(RelayInfo{Name: "relay-a", Region: "new", Neighbors: map[string]float64{"relay-c": 2}}))
+	require.NoError(t, topo.Register(RelayInfo{Name: "relay-c", Neighbors: map[string]float64{"relay-d": 1}, Symmetric: true}))
+
+	// ... while a snapshot taken before arrives from the peer
+	res := topo.Import(GraphResponse{
+		Nodes: []NodeResponse{
+			{ID: "relay-a", Region: "old", LastSeen: time.Now().Add(-30 * time.Second)},
+			{ID: "relay-b", LastSeen: time.Now().Add(-30 * time.Second)},
+			{ID: "relay-d", LastSeen: time.Now().Add(-30 * time.Second)},
+		},
+		Adjacency: map[string]map[string]float64{"relay-a": {"relay-b": 1}},
+		TakenAt:   time.Now().Add(-30 * time.Second),
+	})
+
+	assert.Equal(t, SyncResult{Strategy: SyncMerge, Nodes: 4, KeptLocal: 2}, res)
+	g := topo.Snapshot()
+	assert.Equal(t, "new", g.Nodes["relay-a"].Region)
+	assert.True(t, g.hasEdge("relay-a", "relay-c"))
+	assert.False(t, g.hasEdge("relay-a", "relay-b"))
+	assert.True(t, g.hasEdge("relay-c", "relay-d"))
+	assert.True(t, g.hasEdge("relay-d", "relay-c"), "the reverse edge of relay-c's symmetric registration")
+
+	// Newer snapshot data wins, and nodes it dropped go
+	res = topo.Import(GraphResponse{
+		Nodes:   []NodeResponse{{ID: "relay-a", Region: "newer", LastSeen: time.Now().Add(time.Second)}},
+		TakenAt: time.Now().Add(time.Second),
+	})
+	assert.Equal(t, SyncResult{Strategy: SyncMerge, Nodes: 1}, res)
+	assert.Equal(t, "newer", topo.Snapshot().Nodes["relay-a"].Region)
+}
+
+func TestImport_MergeWithoutTakenAt(t *testing.T) {
+	topo := syncedGraph(t, SyncMerge)
+	require.NoError(t, topo.Register(RelayInfo{Name: "relay-c"}))
+
+	// A peer predating taken_at: its latest heartbeat stands in for it
+	res := topo.Import(GraphResponse{
+		Nodes: []NodeResponse{{ID: "relay-a", LastSeen: time.Now().Add(-30 * time.Second)}},
+	})
+	assert.Equal(t, 1, res.KeptLocal)
+	assert.Contains(t, topo.Snapshot().Nodes, "relay-c")
+	assert.NotContains(t, topo.Snapshot().Nodes, "relay-b")
+}
+
+func TestImport_DefaultMerges(t *testing.T) {
+	topo := syncedGraph(t, "")
+	require.NoError(t, topo.Register(RelayInfo{Name: "relay-a", Region: "new"}))
+
+	res := topo.Import(GraphResponse{
+		Nodes:   []NodeResponse{{ID: "relay-a", Region: "old", LastSeen: time.Now().Add(-30 * time.Second)}},
+		TakenAt: time.Now().Add(-30 * time.Second),
+	})
+	assert.Equal(t, SyncMerge, res.Strategy)
+	assert.Equal(t, "new", topo.Snapshot().Nodes["relay-a"].Region)
+}
+
+func TestImport_Replace(t *testing.T) {
+	topo := syncedGraph(t, SyncReplace)
+	require.NoError(t, topo.Register(RelayInfo{Name: "relay-a", Region: "new"}))
+
+	res := topo.Import(GraphResponse{
+		Nodes:   []NodeResponse{{ID: "relay-a", Region: "old", LastSeen: time.Now().Add(-30 * time.Second)}},
+		TakenAt: time.Now().Add(-30 * time.Second),
+	})
+	assert.Equal(t, SyncResult{Strategy: SyncReplace, Nodes: 1}, res)
+	assert.Equal(t, "old", topo.Snapshot().Nodes["relay-a"].Region)
+}
+
+func TestProtobuf_RoundTripLastSeen(t *testing.T) {
+	want := GraphResponse{
+		Nodes:   []NodeResponse{{ID: "A", LastSeen: time.Unix(1700000000, 42)}, {ID: "B"}},
+		TakenAt: time.Unix(1700000001, 0),
+	}
+	got, err := UnmarshalProtobuf(MarshalProtobuf(want))
+	require.NoError(t, err)
+	require.Len(t, got.Nodes, 2)
+	assert.True(t, want.Nodes[0].LastSeen.Equal(got.Nodes[0].LastSeen))
+	assert.True(t, got.Nodes[1].LastSeen.IsZero())
+	assert.True(t, want.TakenAt.Equal(got.TakenAt))
+}
+
+func TestSyncHandlerFunc_PUT_Strategy(t *testing.T) {
+	topo := syncedGraph(t, SyncMerge)
+	require.NoError(t, topo.Register(RelayInfo{Name: "relay-c"}))
+	handler := SyncHandlerFunc(topo)
+
+	body, err := json.Marshal(GraphResponse{
+		Nodes:   []NodeResponse{{ID: "relay-a", LastSeen: time.Now().Add(-30 * time.Second)}},
+		TakenAt: time.Now().Add(-30 * time.Second),
+	})
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPut, "/sync", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "merge", resp["strategy"])
+	assert.Equal(t, float64(1), resp["kept_local"])
+	assert.Equal(t, float64(2), resp["nodes"])
+}
+
+func TestSyncHandlerFunc_PUT_Busy(t *testing.T) {
+	handler := SyncHandlerFunc(&Topology{})
+
+	// The first import blocks reading its body
+	pr, pw := io.Pipe()
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPut, "/sync", pr))
+		done <- rec.Code
+	}()
+	pw.Write([]byte(`{"nodes":`))
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPut, "/sync", bytes.NewReader([]byte(`{}`))))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	pw.Write([]byte(`[]}`))
+	pw.Close()
+	assert.Equal(t, http.StatusOK, <-done)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPut, "/sync", bytes.NewReader([]byte(`{}`))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestTopology_ImportUnchanged(t *testing.T) {
+	topo := &Topology{}
+	require.NoError(t, topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1}}))
+	snapshot := topo.Snapshot().ToResponse()
+
+	replica := &Topology{SyncStrategy: SyncReplace}
+	replica.Import(snapshot)
+	gen, tag := replica.Generation(), replica.ETag()
+
+	// Syncing the same graph again changes nothing relays revalidate
+	require.NoError(t, topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 1}}))
+	replica.Import(topo.Snapshot().ToResponse())
+	assert.Equal(t, gen, replica.Generation())
+	assert.Equal(t, tag, replica.ETag())
+
+	require.NoError(t, topo.Register(RelayInfo{Name: "a", Neighbors: map[string]float64{"b": 2}}))
+	replica.Import(topo.Snapshot().ToResponse())
+	assert.Greater(t, replica.Generation(), gen)
+	assert.NotEqual(t, tag, replica.ETag())
+}
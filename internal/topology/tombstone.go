@@ -0,0 +1,115 @@
+package topology
+
+import (
+	"slices"
+	"time"
+)
+
+// Reasons a relay leaves the topology.
+const (
+	ReasonShutdown   = "shutdown"    // the relay deregistered itself on a graceful exit
+	ReasonTTLExpired = "ttl_expired" // no heartbeat within NodeTTL; likely a crash
+	ReasonAdmin      = "admin"       // an operator removed it
+)
+
+// DefaultTombstoneTTL is how long tombstones are kept when
+// Topology.TombstoneTTL is zero.
+const DefaultTombstoneTTL = 24 * time.Hour
+
+// ValidDeregisterReason reports whether reason may be given to Deregister.
+func ValidDeregisterReason(reason string) bool {
+	switch reason {
+	case ReasonShutdown, ReasonTTLExpired, ReasonAdmin:
+		return true
+	}
+	return false
+}
+
+// Tombstone records a relay's removal from the topology, so operators
+// auditing churn can tell graceful exits from failures.
+type Tombstone struct {
+	Relay     string    `json:"relay"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail,omitempty"`
+	RemovedAt time.Time `json:"removed_at"`
+	LastSeen  time.Time `json:"last_seen,omitzero"` // last heartbeat before removal
+	Region    string    `json:"region,omitempty"`
+	Zone      string    `json:"zone,omitempty"`
+	Address   string    `json:"address,omitempty"`
+	Version   string    `json:"version,omitempty"`
+}
+
+// RelayHistory is a relay's removals and recent events.
+type RelayHistory struct {
+	Relay      string      `json:"relay"`
+	Live       bool        `json:"live"`             // currently in the topology
+	Tombstones []Tombstone `json:"tombstones"`       // newest first
+	Events     []NodeEvent `json:"events,omitempty"` // newest first
+}
+
+// History returns the named relay's tombstones from the last TombstoneTTL
+// and its recent events. Like events, tombstones are kept in memory only
+// and are not synced to peers. ok is false if nothing is known about it.
+func (t *Topology) History(name string) (h RelayHistory, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.init()
+
+	_, live := t.graph.Nodes[name]
+	h = RelayHistory{Relay: name, Live: live, Tombstones: []Tombstone{}}
+	cutoff := time.Now().Add(-t.tombstoneTTL())
+	for _, ts := range t.tombstones[name] {
+		if ts.RemovedAt.After(cutoff) {
+			h.Tombstones = append(h.Tombstones, ts)
+		}
+	}
+	slices.Reverse(h.Tombstones)
+	h.Events = slices.Clone(t.events[name])
+	slices.Reverse(h.Events)
+
+	return h, live || len(h.Tombstones) > 0 || len(h.Events) > 0
+}
+
+// recordTombstone records node's removal and drops tombstones older than
+// TombstoneTTL. Caller must hold the write lock.
+func (t *Topology) recordTombstone(node *Node, reason, detail string) {
+	now := time.Now()
+	if t.tombstones == nil {
+		t.tombstones = make(map[string][]Tombstone)
+	}
+
+	cutoff := now.Add(-t.tombstoneTTL())
+	for name, list := range t.tombstones {
+		list = slices.DeleteFunc(list, func(ts Tombstone) bool { return !ts.RemovedAt.After(cutoff) })
+		if len(list) == 0 {
+			delete(t.tombstones, name)
+		} else {
+			t.tombstones[name] = list
+		}
+	}
+
+	list := append(t.tombstones[node.ID], Tombstone{
+		Relay:     node.ID,
+		Reason:    reason,
+		Detail:    detail,
+		RemovedAt: now,
+		LastSeen:  node.LastSeen,
+		Region:    node.Region,
+		Zone:      node.Zone,
+		Address:   node.Address,
+		Version:   node.Version,
+	})
+	if len(list) > maxNodeEvents {
+		list = slices.Clone(list[len(list)-maxNodeEvents:])
+	}
+	t.tombstones[node.ID] = list
+}
+
+// tombstoneTTL returns TombstoneTTL or its default.
+func (t *Topology) tombstoneTTL() time.Duration {
+	if t.TombstoneTTL > 0 {
+		return t.TombstoneTTL
+	}
+	return DefaultTombstoneTTL
+}
@@ -0,0 +1,72 @@
+package topology
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopology_DeregisterTombstone(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "a", Region: "eu", Zone: "z1", Address: "https://a:4433", Version: "v1.2.0"})
+
+	require.True(t, topo.Deregister("a", ReasonShutdown))
+
+	h, ok := topo.History("a")
+	require.True(t, ok)
+	assert.False(t, h.Live)
+	require.Len(t, h.Tombstones, 1)
+	ts := h.Tombstones[0]
+	assert.Equal(t, ReasonShutdown, ts.Reason)
+	assert.Equal(t, "eu", ts.Region)
+	assert.Equal(t, "https://a:4433", ts.Address)
+	assert.Equal(t, "v1.2.0", ts.Version)
+	assert.False(t, ts.LastSeen.IsZero())
+	assert.Equal(t, EventDeregistered, h.Events[0].Type)
+	assert.Equal(t, ReasonShutdown, h.Events[0].Detail)
+
+	// Tombstones outlive a rejoin, newest first.
+	topo.Register(RelayInfo{Name: "a"})
+	require.True(t, topo.Deregister("a", ReasonAdmin))
+	topo.Register(RelayInfo{Name: "a"})
+	h, _ = topo.History("a")
+	assert.True(t, h.Live)
+	require.Len(t, h.Tombstones, 2)
+	assert.Equal(t, ReasonAdmin, h.Tombstones[0].Reason)
+	assert.Equal(t, ReasonShutdown, h.Tombstones[1].Reason)
+
+	_, ok = topo.History("unknown")
+	assert.False(t, ok)
+}
+
+func TestTopology_SweepTombstone(t *testing.T) {
+	topo := &Topology{NodeTTL: time.Millisecond}
+	topo.Register(RelayInfo{Name: "a"})
+	time.Sleep(5 * time.Millisecond)
+	require.Equal(t, []string{"a"}, topo.SweepStaleNodes())
+
+	h, ok := topo.History("a")
+	require.True(t, ok)
+	require.Len(t, h.Tombstones, 1)
+	assert.Equal(t, ReasonTTLExpired, h.Tombstones[0].Reason)
+	assert.Equal(t, "no heartbeat for 1ms", h.Tombstones[0].Detail)
+}
+
+func TestTopology_TombstoneTTL(t *testing.T) {
+	topo := &Topology{TombstoneTTL: 10 * time.Millisecond}
+	topo.Register(RelayInfo{Name: "a"})
+	topo.Register(RelayInfo{Name: "b"})
+	topo.Deregister("a", ReasonAdmin)
+	time.Sleep(20 * time.Millisecond)
+
+	h, _ := topo.History("a")
+	assert.Empty(t, h.Tombstones, "expired tombstones are not served")
+
+	topo.Deregister("b", ReasonAdmin)
+	topo.mu.RLock()
+	assert.NotContains(t, topo.tombstones, "a", "expired tombstones are dropped")
+	assert.Contains(t, topo.tombstones, "b")
+	topo.mu.RUnlock()
+}
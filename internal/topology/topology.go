@@ -3,6 +3,7 @@ package topology
 import (
 	"context"
 	"log/slog"
+	"maps"
 	"sync"
 	"time"
 )
@@ -44,12 +45,22 @@ func (d *dijkstraRouter) Route(g *Graph, from, to string) (RouteResult, error) {
 
 // RelayInfo is the payload a relay sends when registering.
 // Neighbors maps neighbor relay name → edge cost.
-// If cost is 0 or omitted, default weight 1 is applied.
+// If cost is 0 or omitted, the Topology's CostTemplate or default weight 1
+// is applied.
 type RelayInfo struct {
 	Name      string             `json:"name"`
 	Region    string             `json:"region,omitempty"`
+	Zone      string             `json:"zone,omitempty"`    // failure domain
 	Address   string             `json:"address,omitempty"` // MoQT endpoint URL (e.g. "https://host:4433")
+	Location  *Location          `json:"location,omitempty"`
 	Neighbors map[string]float64 `json:"neighbors"`
+	Version   string             `json:"version,omitempty"` // relay build version
+
+	// Symmetric asks the controller to add the reverse edge neighbor → relay
+	// for every neighbor, with the same cost unless ReverseCosts overrides it.
+	// Edges a neighbor registers explicitly take precedence.
+	Symmetric    bool               `json:"symmetric,omitempty"`
+	ReverseCosts map[string]float64 `json:"reverse_costs,omitempty"`
 }
 
 // RouteResult is the response for a route query.
@@ -60,6 +71,28 @@ type RouteResult struct {
 	NextHopAddress string   `json:"next_hop_address,omitempty"` // MoQT endpoint URL of next_hop
 	FullPath       []string `json:"full_path"`
 	Cost           float64  `json:"cost"`
+
+	// FullPathAddresses are the MoQT endpoint URLs of the relays on
+	// FullPath, "" for those without one, so each hop can be told where
+	// to fetch from.
+	FullPathAddresses []string `json:"full_path_addresses,omitempty"`
+
+	// Backup fields are set by ZoneDiverseRouter.
+	BackupPath  []string `json:"backup_path,omitempty"`
+	BackupCost  float64  `json:"backup_cost,omitempty"`
+	SharedZones []string `json:"shared_zones,omitempty"` // zones transited by both paths
+
+	// NextHopFEC is the FECStripes of the edge to NextHop: how many parity
+	// frames per group to request from it. 0 disables FEC on the hop.
+	NextHopFEC int `json:"next_hop_fec,omitempty"`
+
+	// Pinned is set when FullPath is an operator's RoutePin rather than
+	// the computed path.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// Reservation fields are set by Reserve.
+	ReservationID string  `json:"reservation_id,omitempty"`
+	ReservedMbps  float64 `json:"reserved_mbps,omitempty"`
 }
 
 // Topology maintains an in-memory directed graph of relays.
@@ -86,20 +119,96 @@ type Topology struct {
 	// Zero means nodes never expire (manual deregistration only).
 	NodeTTL time.Duration
 
-	mu       sync.RWMutex
-	graph    *Graph
-	initOnce sync.Once
+	// TombstoneTTL is how long the record of a relay's removal is kept
+	// for History. Zero uses DefaultTombstoneTTL.
+	TombstoneTTL time.Duration
+
+	// OnDeregister, if set, is called with the name of each relay that
+	// leaves the topology, by Deregister or on expiry, so state kept about
+	// it elsewhere can be dropped. It runs with the topology locked and
+	// must not call back into it.
+	OnDeregister func(name string)
+
+	// CostModel, if set, prices edges that have attributes (see
+	// SetEdgeAttributes) instead of using probe-measured costs.
+	CostModel CostModel
+
+	// CostTemplate, if set, prices edges registered without a cost from
+	// the regions of their relays instead of the default weight 1.
+	CostTemplate *CostTemplate
+
+	// Validation, if set, makes Register reject malformed registrations.
+	// Nil accepts any registration.
+	Validation *RegistrationValidation
+
+	// Limits, if set, bounds the graph relays can build by registering.
+	Limits *GraphLimits
+
+	// SyncStrategy is how Import applies snapshots from peer controllers.
+	// Empty is DefaultSyncStrategy.
+	SyncStrategy SyncStrategy
+
+	// DegradedPenalty multiplies the cost of edges into relays SetHealth
+	// reports degraded. Zero uses DefaultDegradedPenalty.
+	DegradedPenalty float64
+
+	// MeasuredCostTTL is how long a cost set by SetMeasuredCost applies
+	// without a new measurement; the configured cost returns on the
+	// relay's next heartbeat after. Zero uses DefaultMeasuredCostTTL.
+	MeasuredCostTTL time.Duration
+
+	mu         sync.RWMutex
+	graph      *Graph
+	measured   map[[2]string]probeMeasurement // (from, to) → cost measured by data-plane probes
+	events     map[string][]NodeEvent         // relay → recent events, oldest first
+	tombstones map[string][]Tombstone         // relay → recent removals, oldest first
+	health     map[string]Health              // relay → degraded or unreachable; see SetHealth
+	initOnce   sync.Once
+
+	reservations   map[string]*Reservation // ID → active bandwidth reservation
+	reserved       map[[2]string]float64   // (from, to) → reserved Mbps
+	reservationSeq uint64
+
+	rejected map[string]uint64 // reason → registrations refused
+
+	generation uint64 // advanced by save; see Generation
+
+	tagMu         sync.Mutex
+	tag           string // ETag of tagGeneration
+	tagGeneration uint64
 }
 
 // Register adds or updates a relay and its edges.
 // Each call replaces the previous neighbor set for this relay.
-// Edges use the cost from the registration payload; 0/omitted defaults to 1.
-func (t *Topology) Register(reg RelayInfo) {
+// Edges use the cost from the registration payload; 0/omitted defaults to
+// the CostTemplate's cost, or 1. With Validation set, a registration that
+// fails it returns a *RegistrationError, and with Limits set, one that
+// would exceed them a *LimitError; either changes nothing.
+func (t *Topology) Register(reg RelayInfo) error {
+	var invalid error
+	if t.Validation != nil {
+		invalid = t.Validation.Validate(reg)
+	}
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	t.init()
 
+	if invalid != nil {
+		t.reject(RejectInvalid)
+		return invalid
+	}
+	if t.Limits != nil {
+		if err := t.Limits.check(t.graph, reg); err != nil {
+			t.reject(err.Limit)
+			return err
+		}
+	}
+
+	peers := t.relayPeers(reg)
+	before := t.relayState(reg.Name, peers)
+
 	// Ensure the node exists.
 	node, ok := t.graph.Nodes[reg.Name]
 	if !ok {
@@ -108,6 +217,12 @@ func (t *Topology) Register(reg RelayInfo) {
 			Edges: make([]Edge, 0, len(reg.Neighbors)),
 		}
 		t.graph.addNode(node)
+		t.applyMaintenance(time.Now()) // a relay rejoining during its window stays cordoned
+	}
+	if node.LastSeen.IsZero() {
+		t.recordEvent(reg.Name, EventRegistered, reg.Address)
+	} else if neighborsChanged(node.Edges, reg.Neighbors) {
+		t.recordEvent(reg.Name, EventNeighborsChanged, "")
 	}
 
 	// Update LastSeen on every registration (heartbeat).
@@ -118,17 +233,37 @@ func (t *Topology) Register(reg RelayInfo) {
 		node.Region = reg.Region
 	}
 
+	// Update zone if provided.
+	if reg.Zone != "" {
+		node.Zone = reg.Zone
+	}
+
 	// Update address if provided.
 	if reg.Address != "" {
 		node.Address = reg.Address
 	}
 
-	// Replace edge list with new neighbors and their costs.
+	// Update location if provided.
+	if reg.Location != nil {
+		loc := *reg.Location
+		node.Location = &loc
+	}
+
+	// Update version if provided.
+	if reg.Version != "" {
+		node.Version = reg.Version
+	}
+
+	// Replace edge list with new neighbors and their costs, keeping reverse
+	// edges added by symmetric neighbors unless listed explicitly.
+	prev := node.Edges
 	node.Edges = make([]Edge, 0, len(reg.Neighbors))
-	for nb, cost := range reg.Neighbors {
-		if cost <= 0 {
-			cost = 1 // default weight
+	for _, e := range prev {
+		if _, explicit := reg.Neighbors[e.To]; e.Auto && !explicit {
+			node.Edges = append(node.Edges, e)
 		}
+	}
+	for nb, cost := range reg.Neighbors {
 		// Auto-create neighbor node if not yet registered.
 		if _, exists := t.graph.Nodes[nb]; !exists {
 			t.graph.addNode(&Node{
@@ -136,25 +271,235 @@ func (t *Topology) Register(reg RelayInfo) {
 				Edges: []Edge{},
 			})
 		}
-		node.Edges = append(node.Edges, Edge{To: nb, Cost: Cost(cost)})
+		c := Cost(cost)
+		if cost <= 0 {
+			c = t.defaultCost(reg.Name, nb)
+		}
+		node.Edges = append(node.Edges, t.pricedEdge(reg.Name, nb, c))
+	}
+
+	t.syncReverseEdges(reg)
+	t.graph.applyOverrides()
+
+	if t.relayState(reg.Name, peers).equal(before) {
+		t.persist() // a heartbeat: only LastSeen moved
+	} else {
+		t.save()
+	}
+	return nil
+}
+
+// syncReverseEdges adds or updates automatic reverse edges for a symmetric
+// registration and removes those the relay no longer asks for.
+// Caller must hold the write lock.
+func (t *Topology) syncReverseEdges(reg RelayInfo) {
+	for id, other := range t.graph.Nodes {
+		if id == reg.Name {
+			continue
+		}
+
+		idx := -1
+		for i, e := range other.Edges {
+			if e.To == reg.Name {
+				idx = i
+				break
+			}
+		}
+
+		forward, isNeighbor := reg.Neighbors[id]
+		if !reg.Symmetric || !isNeighbor {
+			if idx >= 0 && other.Edges[idx].Auto {
+				other.Edges = append(other.Edges[:idx], other.Edges[idx+1:]...)
+			}
+			continue
+		}
+
+		cost := Cost(forward)
+		if rc, ok := reg.ReverseCosts[id]; ok {
+			cost = Cost(rc)
+		}
+		if cost <= 0 {
+			cost = t.defaultCost(id, reg.Name)
+		}
+
+		e := t.pricedEdge(id, reg.Name, cost)
+		e.Auto = true
+		switch {
+		case idx < 0:
+			other.Edges = append(other.Edges, e)
+		case other.Edges[idx].Auto:
+			other.Edges[idx] = e
+		}
+	}
+}
+
+// DefaultMeasuredCostTTL is how long a probe-measured cost applies when
+// Topology.MeasuredCostTTL is zero.
+const DefaultMeasuredCostTTL = 10 * time.Minute
+
+// probeMeasurement is a cost set by SetMeasuredCost.
+type probeMeasurement struct {
+	cost Cost
+	at   time.Time
+}
+
+// SetMeasuredCost overrides the cost of the edge from → to with a value
+// measured by data-plane probes. The override survives re-registration
+// until cleared with a cost <= 0 or until it is MeasuredCostTTL old, which
+// restores the configured cost on the relay's next heartbeat. Manual
+// overrides (SetOverride) still take precedence. Returns false if the edge
+// does not exist.
+func (t *Topology) SetMeasuredCost(from, to string, cost float64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	key := [2]string{from, to}
+	if cost <= 0 {
+		delete(t.measured, key)
+		return true
+	}
+
+	node, ok := t.graph.Nodes[from]
+	if !ok || !node.hasEdgeTo(to) {
+		return false
+	}
+
+	if t.measured == nil {
+		t.measured = make(map[[2]string]probeMeasurement)
 	}
+	t.measured[key] = probeMeasurement{cost: Cost(cost), at: time.Now()}
+	t.repriceEdge(node, to)
+	t.graph.applyOverrides()
 
 	t.save()
+	return true
 }
 
-// Deregister removes a relay and all edges pointing to it.
-func (t *Topology) Deregister(name string) bool {
+// SetEdgeAttributes applies update to the attributes of the edge from → to
+// and, with a CostModel, recomputes its cost. Attributes survive
+// re-registration, are persisted and synced to peers with the graph, and
+// are dropped when either relay deregisters. Returns false if the edge
+// does not exist.
+func (t *Topology) SetEdgeAttributes(from, to string, update func(*EdgeAttributes)) bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	t.init()
 
-	if _, ok := t.graph.Nodes[name]; !ok {
+	node, ok := t.graph.Nodes[from]
+	if !ok || !node.hasEdgeTo(to) {
+		return false
+	}
+
+	if t.graph.Attributes == nil {
+		t.graph.Attributes = make(map[[2]string]EdgeAttributes)
+	}
+	key := [2]string{from, to}
+	a := t.graph.Attributes[key]
+	update(&a)
+	t.graph.Attributes[key] = a
+
+	t.repriceEdge(node, to)
+	t.graph.applyOverrides()
+
+	t.save()
+	return true
+}
+
+// EdgeAttributes returns the attributes recorded for from → to.
+func (t *Topology) EdgeAttributes(from, to string) (EdgeAttributes, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.init()
+
+	a, ok := t.graph.Attributes[[2]string{from, to}]
+	return a, ok
+}
+
+// pricedEdge returns the edge from → to with its effective cost: the cost
+// model's if the edge has attributes, else a probe measurement that has
+// not expired, else the configured cost. Caller must hold the write lock.
+func (t *Topology) pricedEdge(from, to string, configured Cost) Edge {
+	e := Edge{To: to, Cost: configured, base: configured}
+	key := [2]string{from, to}
+	if a, ok := t.graph.Attributes[key]; ok && t.CostModel != nil {
+		e.Cost, e.Components = t.CostModel.EdgeCost(configured, a)
+	} else if m, ok := t.measured[key]; ok {
+		if time.Since(m.at) < t.measuredCostTTL() {
+			e.Cost = m.cost // probe measurements override configured costs
+		} else {
+			delete(t.measured, key)
+		}
+	}
+	return e
+}
+
+// measuredCostTTL returns MeasuredCostTTL or its default.
+func (t *Topology) measuredCostTTL() time.Duration {
+	if t.MeasuredCostTTL > 0 {
+		return t.MeasuredCostTTL
+	}
+	return DefaultMeasuredCostTTL
+}
+
+// repriceEdge recomputes node's edge to `to` after its inputs changed.
+// Caller must hold the write lock.
+func (t *Topology) repriceEdge(node *Node, to string) {
+	for i, e := range node.Edges {
+		if e.To != to {
+			continue
+		}
+		base := e.base
+		if base == 0 {
+			base = e.Cost // restored edge; corrected on the next heartbeat
+		}
+		priced := t.pricedEdge(node.ID, to, base)
+		priced.Auto = e.Auto
+		node.Edges[i] = priced
+	}
+}
+
+// forgetMeasured drops probe measurements, edge attributes and bandwidth
+// reservations involving the named relay.
+// Caller must hold the write lock.
+func (t *Topology) forgetMeasured(name string) {
+	t.dropReservations(name)
+	for key := range t.measured {
+		if key[0] == name || key[1] == name {
+			delete(t.measured, key)
+		}
+	}
+	for key := range t.graph.Attributes {
+		if key[0] == name || key[1] == name {
+			delete(t.graph.Attributes, key)
+		}
+	}
+}
+
+// Deregister removes a relay and all edges pointing to it, leaving a
+// tombstone with the reason (see ValidDeregisterReason).
+func (t *Topology) Deregister(name, reason string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.init()
+
+	node, ok := t.graph.Nodes[name]
+	if !ok {
 		return false
 	}
 
 	// Remove node.
 	delete(t.graph.Nodes, name)
+	t.forgetMeasured(name)
+	t.recordEvent(name, EventDeregistered, reason)
+	t.recordTombstone(node, reason, "")
+	if t.OnDeregister != nil {
+		t.OnDeregister(name)
+	}
 
 	// Remove dangling edges from other nodes.
 	for _, node := range t.graph.Nodes {
@@ -173,30 +518,79 @@ func (t *Topology) Deregister(name string) bool {
 
 // Route computes the shortest path from src to dst using the configured Router.
 // The returned RouteResult includes NextHopAddress if the next-hop node has a
-// registered address.
+// registered address. Cordoned and unreachable relays are not transited,
+// nor are relays only planned in a Seed, which cannot be routed to either.
+// A Router that may block, such as HTTPRouter, is called on a copy of the
+// graph without holding the lock.
 func (t *Topology) Route(from, to string) (RouteResult, error) {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-
-	t.init()
-
 	router := t.Router
 	if router == nil {
 		router = NewDijkstraRouter()
 	}
-	result, err := router.Route(t.graph, from, to)
-	if err != nil {
-		return result, err
+
+	t.mu.RLock()
+	t.init()
+
+	if n, ok := t.graph.Nodes[to]; ok && !n.Registered() {
+		t.mu.RUnlock()
+		return RouteResult{}, errNoPath
+	}
+
+	result, pinned := t.graph.pinnedRoute(from, to)
+	if !pinned {
+		g := t.transitGraph(from)
+		if blocking(router) {
+			if g == t.graph {
+				g = t.deepCopy()
+			}
+			t.mu.RUnlock()
+			var err error
+			if result, err = router.Route(g, from, to); err != nil {
+				return result, err
+			}
+			t.mu.RLock()
+		} else {
+			var err error
+			if result, err = router.Route(g, from, to); err != nil {
+				t.mu.RUnlock()
+				return result, err
+			}
+		}
 	}
+	defer t.mu.RUnlock()
 
 	// Populate NextHopAddress from the graph.
 	if nh, ok := t.graph.Nodes[result.NextHop]; ok {
 		result.NextHopAddress = nh.Address
 	}
+	result.FullPathAddresses = t.graph.addresses(result.FullPath)
+	result.NextHopFEC = t.graph.Attributes[[2]string{from, result.NextHop}].FECStripes
 
 	return result, nil
 }
 
+// blocking reports whether router may block, e.g. on the network, and so
+// must not be called with the lock held. The built-in routers compute in
+// memory and run under the lock, on the graph itself.
+func blocking(router Router) bool {
+	switch router.(type) {
+	case *dijkstraRouter, *ZoneDiverseRouter:
+		return false
+	}
+	return true
+}
+
+// addresses returns the address of each relay on path, "" if it has none.
+func (g *Graph) addresses(path []string) []string {
+	addrs := make([]string, len(path))
+	for i, id := range path {
+		if n, ok := g.Nodes[id]; ok {
+			addrs[i] = n.Address
+		}
+	}
+	return addrs
+}
+
 // Snapshot returns a deep copy of the current graph for safe read access.
 func (t *Topology) Snapshot() *Graph {
 	t.mu.RLock()
@@ -214,13 +608,21 @@ func (t *Topology) deepCopy() *Graph {
 		cpNode := &Node{
 			ID:       node.ID,
 			Region:   node.Region,
+			Zone:     node.Zone,
 			Address:  node.Address,
+			Location: node.Location,
+			Version:  node.Version,
+			Cordoned: node.Cordoned,
 			Edges:    make([]Edge, len(node.Edges)),
 			LastSeen: node.LastSeen,
 		}
 		copy(cpNode.Edges, node.Edges)
 		cp.Nodes[id] = cpNode
 	}
+	cp.Overrides = append([]EdgeOverride(nil), t.graph.Overrides...)
+	cp.Attributes = maps.Clone(t.graph.Attributes)
+	cp.Maintenance = append([]MaintenanceWindow(nil), t.graph.Maintenance...)
+	cp.Pins = append([]RoutePin(nil), t.graph.Pins...)
 	return cp
 }
 
@@ -230,6 +632,7 @@ func (t *Topology) Restore(g *Graph) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.graph = g
+	t.applyMaintenance(time.Now())
 	t.save()
 }
 
@@ -245,15 +648,24 @@ func (t *Topology) init() {
 		if t.Store != nil {
 			if g, err := t.Store.Load(); err == nil && g != nil {
 				t.graph = g
+				t.applyMaintenance(time.Now())
 				slog.Info("topology restored from store", "nodes", len(g.Nodes))
 			}
 		}
 	})
 }
 
-// save persists the current graph to the store (if configured).
-// Caller must hold at least a write lock.
+// save records a change to the graph: it advances the generation and
+// persists the graph to the store (if configured).
+// Caller must hold the write lock.
 func (t *Topology) save() {
+	t.generation++
+	t.persist()
+}
+
+// persist saves the current graph to the store (if configured).
+// Caller must hold the write lock.
+func (t *Topology) persist() {
 	if t.Store == nil {
 		return
 	}
@@ -314,7 +726,14 @@ func (t *Topology) SweepStaleNodes() []string {
 
 	// Remove stale nodes and dangling edges.
 	for _, id := range removed {
+		detail := "no heartbeat for " + t.NodeTTL.String()
+		t.recordTombstone(t.graph.Nodes[id], ReasonTTLExpired, detail)
 		delete(t.graph.Nodes, id)
+		t.forgetMeasured(id)
+		t.recordEvent(id, EventExpired, detail)
+		if t.OnDeregister != nil {
+			t.OnDeregister(id)
+		}
 	}
 	for _, node := range t.graph.Nodes {
 		filtered := node.Edges[:0]
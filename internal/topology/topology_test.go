@@ -79,7 +79,7 @@ func TestTopology_Deregister(t *testing.T) {
 		Neighbors: map[string]float64{"relay-a": 1},
 	})
 
-	removed := topo.Deregister("relay-a")
+	removed := topo.Deregister("relay-a", ReasonAdmin)
 	assert.True(t, removed, "expected relay-a to be removed")
 	assert.Equal(t, 1, getNodeCount(topo), "expected 1 node remaining")
 
@@ -95,7 +95,7 @@ func TestTopology_Deregister(t *testing.T) {
 func TestTopology_Deregister_NotFound(t *testing.T) {
 	topo := &Topology{}
 
-	removed := topo.Deregister("nonexistent")
+	removed := topo.Deregister("nonexistent", ReasonAdmin)
 	assert.False(t, removed, "expected false for nonexistent relay")
 }
 
@@ -243,6 +243,24 @@ func TestTopology_WithRouter(t *testing.T) {
 	assert.Equal(t, 42.0, result.Cost, "expected cost 42")
 }
 
+func TestTopology_RouteUnlocksForRouter(t *testing.T) {
+	// A router that may block runs on a copy, without the lock held, so a
+	// slow external router cannot stall registrations.
+	topo := &Topology{}
+	topo.Router = routerFunc(func(g *Graph, from, to string) (RouteResult, error) {
+		require.True(t, topo.mu.TryLock(), "router called with the topology lock held")
+		topo.mu.Unlock()
+		assert.NotSame(t, topo.graph, g, "router was handed the live graph")
+		return NewDijkstraRouter().Route(g, from, to)
+	})
+	topo.Register(RelayInfo{Name: "A", Address: "https://a:4433", Neighbors: map[string]float64{"B": 1}})
+	topo.Register(RelayInfo{Name: "B", Address: "https://b:4433"})
+
+	result, err := topo.Route("A", "B")
+	require.NoError(t, err)
+	assert.Equal(t, "https://b:4433", result.NextHopAddress)
+}
+
 // routerFunc adapts a function to the Router interface.
 type routerFunc func(g *Graph, from, to string) (RouteResult, error)
 
@@ -255,8 +273,9 @@ func TestTopology_Restore(t *testing.T) {
 
 	// Build a graph externally and restore it.
 	g := newGraph()
-	g.addNode(&Node{ID: "X", Region: "eu-west-1", Edges: []Edge{{To: "Y", Cost: Cost(7)}}})
-	g.addNode(&Node{ID: "Y", Edges: []Edge{}})
+	now := time.Now()
+	g.addNode(&Node{ID: "X", Region: "eu-west-1", LastSeen: now, Edges: []Edge{{To: "Y", Cost: Cost(7)}}})
+	g.addNode(&Node{ID: "Y", LastSeen: now, Edges: []Edge{}})
 
 	topo.Restore(g)
 
@@ -327,7 +346,7 @@ func TestTopology_ConcurrentRegisterAndDeregister(t *testing.T) {
 		// Deregister existing node
 		go func(id int) {
 			defer wg.Done()
-			topo.Deregister(string(rune('A' + id)))
+			topo.Deregister(string(rune('A'+id)), ReasonAdmin)
 		}(i)
 	}
 
@@ -511,6 +530,20 @@ func TestTopology_SweepStaleNodes_RemovesExpired(t *testing.T) {
 	assert.Equal(t, 0, getNodeCount(topo))
 }
 
+func TestTopology_OnDeregister(t *testing.T) {
+	var gone []string
+	topo := &Topology{NodeTTL: 50 * time.Millisecond, OnDeregister: func(name string) { gone = append(gone, name) }}
+
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{}})
+	topo.Register(RelayInfo{Name: "relay-b", Neighbors: map[string]float64{}})
+	require.True(t, topo.Deregister("relay-a", ReasonShutdown))
+	assert.Equal(t, []string{"relay-a"}, gone)
+
+	time.Sleep(60 * time.Millisecond)
+	topo.SweepStaleNodes()
+	assert.Equal(t, []string{"relay-a", "relay-b"}, gone, "expired relays leave too")
+}
+
 func TestTopology_SweepStaleNodes_KeepsFresh(t *testing.T) {
 	topo := &Topology{NodeTTL: 100 * time.Millisecond}
 
@@ -565,3 +598,161 @@ func TestTopology_StartSweeper(t *testing.T) {
 
 	assert.Equal(t, 0, getNodeCount(topo), "sweeper should have removed stale node")
 }
+
+func TestTopology_Register_Location(t *testing.T) {
+	topo := &Topology{}
+
+	topo.Register(RelayInfo{
+		Name:     "relay-a",
+		Location: &Location{Lat: 35.68, Lon: 139.69},
+	})
+	// A heartbeat without location keeps the previous value.
+	topo.Register(RelayInfo{Name: "relay-a"})
+
+	g := topo.Snapshot()
+	require.NotNil(t, g.Nodes["relay-a"].Location)
+	assert.Equal(t, 35.68, g.Nodes["relay-a"].Location.Lat)
+
+	// Location survives the /graph → /sync round trip.
+	restored := FromResponse(g.ToResponse())
+	require.NotNil(t, restored.Nodes["relay-a"].Location)
+	assert.Equal(t, 139.69, restored.Nodes["relay-a"].Location.Lon)
+}
+
+func TestTopology_Register_Version(t *testing.T) {
+	topo := &Topology{}
+
+	topo.Register(RelayInfo{Name: "relay-a", Version: "v1.2.0"})
+	// A heartbeat without version keeps the previous value.
+	topo.Register(RelayInfo{Name: "relay-a"})
+
+	g := topo.Snapshot()
+	assert.Equal(t, "v1.2.0", g.Nodes["relay-a"].Version)
+	assert.Equal(t, "v1.2.0", FromResponse(g.ToResponse()).Nodes["relay-a"].Version)
+
+	topo.Register(RelayInfo{Name: "relay-a", Version: "v1.3.0"})
+	assert.Equal(t, "v1.3.0", topo.Snapshot().Nodes["relay-a"].Version)
+}
+
+func edgeTo(n *Node, to string) (Edge, bool) {
+	for _, e := range n.Edges {
+		if e.To == to {
+			return e, true
+		}
+	}
+	return Edge{}, false
+}
+
+func TestTopology_Register_Symmetric(t *testing.T) {
+	topo := &Topology{}
+
+	topo.Register(RelayInfo{
+		Name:         "relay-a",
+		Neighbors:    map[string]float64{"relay-b": 2, "relay-c": 3},
+		Symmetric:    true,
+		ReverseCosts: map[string]float64{"relay-c": 5},
+	})
+
+	g := topo.Snapshot()
+	e, ok := edgeTo(g.Nodes["relay-b"], "relay-a")
+	require.True(t, ok, "expected reverse edge relay-b → relay-a")
+	assert.Equal(t, Cost(2), e.Cost)
+	assert.True(t, e.Auto)
+
+	e, ok = edgeTo(g.Nodes["relay-c"], "relay-a")
+	require.True(t, ok)
+	assert.Equal(t, Cost(5), e.Cost, "reverse cost override")
+
+	// relay-b's own heartbeat without neighbors keeps the automatic edge.
+	topo.Register(RelayInfo{Name: "relay-b"})
+	_, ok = edgeTo(topo.Snapshot().Nodes["relay-b"], "relay-a")
+	assert.True(t, ok)
+
+	// An explicit edge from relay-b wins over the automatic one.
+	topo.Register(RelayInfo{Name: "relay-b", Neighbors: map[string]float64{"relay-a": 9}})
+	topo.Register(RelayInfo{
+		Name:      "relay-a",
+		Neighbors: map[string]float64{"relay-b": 2, "relay-c": 3},
+		Symmetric: true,
+	})
+	e, _ = edgeTo(topo.Snapshot().Nodes["relay-b"], "relay-a")
+	assert.Equal(t, Cost(9), e.Cost)
+	assert.False(t, e.Auto)
+
+	// Dropping relay-c removes its automatic reverse edge.
+	topo.Register(RelayInfo{
+		Name:      "relay-a",
+		Neighbors: map[string]float64{"relay-b": 2},
+		Symmetric: true,
+	})
+	_, ok = edgeTo(topo.Snapshot().Nodes["relay-c"], "relay-a")
+	assert.False(t, ok)
+}
+
+func TestGraph_Asymmetries(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 1, "relay-c": 4}})
+	topo.Register(RelayInfo{Name: "relay-b", Neighbors: map[string]float64{"relay-a": 1}})
+	topo.Register(RelayInfo{Name: "relay-d", Neighbors: map[string]float64{"relay-a": 2}})
+
+	asym := topo.Snapshot().Asymmetries()
+	require.Len(t, asym, 2)
+
+	assert.Equal(t, Asymmetry{From: "relay-a", To: "relay-c", Cost: 4, Reason: "target not registered"}, asym[0])
+	assert.Equal(t, Asymmetry{From: "relay-d", To: "relay-a", Cost: 2, Reason: "reverse edge missing"}, asym[1])
+
+	// Symmetric registration resolves the one-way link.
+	topo.Register(RelayInfo{Name: "relay-d", Neighbors: map[string]float64{"relay-a": 2}, Symmetric: true})
+	asym = topo.Snapshot().Asymmetries()
+	require.Len(t, asym, 1)
+	assert.Equal(t, "relay-c", asym[0].To)
+}
+
+func TestTopology_SetMeasuredCost(t *testing.T) {
+	topo := &Topology{}
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 100}})
+
+	assert.False(t, topo.SetMeasuredCost("relay-a", "relay-x", 5), "missing edge")
+	require.True(t, topo.SetMeasuredCost("relay-a", "relay-b", 5))
+	assert.Equal(t, Cost(5), measuredCost(topo))
+
+	// Re-registration keeps the measured cost.
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 100}})
+	assert.Equal(t, Cost(5), measuredCost(topo))
+
+	// Clearing restores the configured cost on the next heartbeat.
+	require.True(t, topo.SetMeasuredCost("relay-a", "relay-b", 0))
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 100}})
+	assert.Equal(t, Cost(100), measuredCost(topo))
+
+	// Deregistration forgets measurements.
+	require.True(t, topo.SetMeasuredCost("relay-a", "relay-b", 5))
+	topo.Deregister("relay-b", ReasonAdmin)
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 100}})
+	assert.Equal(t, Cost(100), measuredCost(topo))
+}
+
+func TestTopology_MeasuredCostTTL(t *testing.T) {
+	topo := &Topology{MeasuredCostTTL: time.Hour}
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 100}})
+	require.True(t, topo.SetMeasuredCost("relay-a", "relay-b", 5))
+
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 100}})
+	assert.Equal(t, Cost(5), measuredCost(topo))
+
+	// A measurement not renewed within the TTL stops applying on the next
+	// heartbeat.
+	topo.mu.Lock()
+	m := topo.measured[[2]string{"relay-a", "relay-b"}]
+	m.at = m.at.Add(-time.Hour)
+	topo.measured[[2]string{"relay-a", "relay-b"}] = m
+	topo.mu.Unlock()
+	topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 100}})
+	assert.Equal(t, Cost(100), measuredCost(topo))
+	assert.Empty(t, topo.measured)
+}
+
+func measuredCost(topo *Topology) Cost {
+	e, _ := edgeTo(topo.Snapshot().Nodes["relay-a"], "relay-b")
+	return e.Cost
+}
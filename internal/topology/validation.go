@@ -0,0 +1,102 @@
+package topology
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+)
+
+// Defaults of RegistrationValidation.
+const (
+	DefaultMaxNeighbors = 64
+	DefaultMaxCost      = 1e6
+)
+
+// maxNameLen bounds relay names, which appear in URL paths and metric
+// labels.
+const maxNameLen = 63
+
+// RegistrationValidation makes Register reject malformed registrations
+// instead of storing them as they come. Relay names, the relay's own and
+// its neighbors', must be 1-63 letters, digits, '.', '_' or '-' starting
+// with a letter or digit; costs must be finite and between 0 (the default
+// cost) and MaxCost; the address, if any, must be an absolute URL with a
+// host; and a location must be a valid latitude and longitude.
+type RegistrationValidation struct {
+	// MaxNeighbors bounds the neighbors of a relay; 0 means
+	// DefaultMaxNeighbors.
+	MaxNeighbors int
+
+	// MaxCost bounds edge costs; 0 means DefaultMaxCost.
+	MaxCost float64
+}
+
+// RegistrationError reports a registration that fails validation.
+type RegistrationError struct {
+	Field string // the offending field of RelayInfo, e.g. "neighbors"
+	Msg   string
+}
+
+func (e *RegistrationError) Error() string {
+	return fmt.Sprintf("registration: %s: %s", e.Field, e.Msg)
+}
+
+// Validate checks reg against v, returning a *RegistrationError for the
+// first problem found.
+func (v *RegistrationValidation) Validate(reg RelayInfo) error {
+	maxNeighbors := v.MaxNeighbors
+	if maxNeighbors <= 0 {
+		maxNeighbors = DefaultMaxNeighbors
+	}
+	maxCost := v.MaxCost
+	if maxCost <= 0 {
+		maxCost = DefaultMaxCost
+	}
+
+	if !validName(reg.Name) {
+		return &RegistrationError{Field: "name", Msg: fmt.Sprintf("invalid relay name %q", reg.Name)}
+	}
+	if len(reg.Neighbors) > maxNeighbors {
+		return &RegistrationError{Field: "neighbors", Msg: fmt.Sprintf("%d neighbors exceed the limit of %d", len(reg.Neighbors), maxNeighbors)}
+	}
+	for _, costs := range []struct {
+		field string
+		costs map[string]float64
+	}{{"neighbors", reg.Neighbors}, {"reverse_costs", reg.ReverseCosts}} {
+		for nb, cost := range costs.costs {
+			switch {
+			case !validName(nb):
+				return &RegistrationError{Field: costs.field, Msg: fmt.Sprintf("invalid relay name %q", nb)}
+			case nb == reg.Name:
+				return &RegistrationError{Field: costs.field, Msg: "a relay cannot neighbor itself"}
+			case math.IsNaN(cost) || cost < 0 || cost > maxCost:
+				return &RegistrationError{Field: costs.field, Msg: fmt.Sprintf("cost of %s must be between 0 and %g", nb, maxCost)}
+			}
+		}
+	}
+	if reg.Address != "" {
+		if u, err := url.Parse(reg.Address); err != nil || u.Scheme == "" || u.Host == "" {
+			return &RegistrationError{Field: "address", Msg: fmt.Sprintf("%q is not an absolute URL", reg.Address)}
+		}
+	}
+	if loc := reg.Location; loc != nil && !(math.Abs(loc.Lat) <= 90 && math.Abs(loc.Lon) <= 180) {
+		return &RegistrationError{Field: "location", Msg: "lat must be within ±90 and lon within ±180"}
+	}
+	return nil
+}
+
+// validName reports whether name is a valid relay name.
+func validName(name string) bool {
+	if name == "" || len(name) > maxNameLen {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case (c == '.' || c == '_' || c == '-') && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package topology
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrationValidation_Validate(t *testing.T) {
+	v := &RegistrationValidation{MaxNeighbors: 2, MaxCost: 100}
+	valid := RelayInfo{
+		Name:      "relay-a.tokyo_1",
+		Address:   "https://relay-a:4433",
+		Location:  &Location{Lat: 35.7, Lon: 139.7},
+		Neighbors: map[string]float64{"relay-b": 0, "relay-c": 100},
+	}
+	require.NoError(t, v.Validate(valid))
+
+	tests := map[string]struct {
+		modify func(*RelayInfo)
+		field  string
+	}{
+		"empty name":       {func(r *RelayInfo) { r.Name = "" }, "name"},
+		"name with slash":  {func(r *RelayInfo) { r.Name = "a/b" }, "name"},
+		"leading dash":     {func(r *RelayInfo) { r.Name = "-a" }, "name"},
+		"long name":        {func(r *RelayInfo) { r.Name = strings.Repeat("a", 64) }, "name"},
+		"too many":         {func(r *RelayInfo) { r.Neighbors = map[string]float64{"b": 1, "c": 1, "d": 1} }, "neighbors"},
+		"bad neighbor":     {func(r *RelayInfo) { r.Neighbors = map[string]float64{"b c": 1} }, "neighbors"},
+		"self neighbor":    {func(r *RelayInfo) { r.Neighbors = map[string]float64{r.Name: 1} }, "neighbors"},
+		"negative cost":    {func(r *RelayInfo) { r.Neighbors = map[string]float64{"b": -1} }, "neighbors"},
+		"cost over max":    {func(r *RelayInfo) { r.Neighbors = map[string]float64{"b": 101} }, "neighbors"},
+		"NaN cost":         {func(r *RelayInfo) { r.Neighbors = map[string]float64{"b": math.NaN()} }, "neighbors"},
+		"bad reverse cost": {func(r *RelayInfo) { r.ReverseCosts = map[string]float64{"relay-b": math.Inf(1)} }, "reverse_costs"},
+		"relative address": {func(r *RelayInfo) { r.Address = "relay-a:4433" }, "address"},
+		"unparsable":       {func(r *RelayInfo) { r.Address = "https://[::1" }, "address"},
+		"latitude":         {func(r *RelayInfo) { r.Location = &Location{Lat: 91} }, "location"},
+		"longitude":        {func(r *RelayInfo) { r.Location = &Location{Lon: -181} }, "location"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := valid
+			reg.Neighbors = map[string]float64{"relay-b": 1}
+			tt.modify(&reg)
+
+			var regErr *RegistrationError
+			require.True(t, errors.As(v.Validate(reg), &regErr))
+			assert.Equal(t, tt.field, regErr.Field)
+		})
+	}
+}
+
+func TestRegistrationValidation_Defaults(t *testing.T) {
+	v := &RegistrationValidation{}
+	neighbors := make(map[string]float64)
+	for i := range DefaultMaxNeighbors {
+		neighbors[fmt.Sprintf("relay-%d", i)] = DefaultMaxCost
+	}
+	assert.NoError(t, v.Validate(RelayInfo{Name: "relay-a", Neighbors: neighbors}))
+
+	neighbors["relay-x"] = 1
+	assert.Error(t, v.Validate(RelayInfo{Name: "relay-a", Neighbors: neighbors}))
+}
+
+func TestTopology_RegisterValidation(t *testing.T) {
+	// Lenient by default
+	topo := &Topology{}
+	require.NoError(t, topo.Register(RelayInfo{Name: "a/b", Neighbors: map[string]float64{"c": -5}}))
+	assert.Contains(t, topo.Snapshot().Nodes, "a/b")
+
+	topo = &Topology{Validation: &RegistrationValidation{}}
+	err := topo.Register(RelayInfo{Name: "relay-a", Address: "not a url"})
+	var regErr *RegistrationError
+	require.True(t, errors.As(err, &regErr))
+	assert.Equal(t, "address", regErr.Field)
+	assert.Empty(t, topo.Snapshot().Nodes, "a rejected registration must change nothing")
+
+	require.NoError(t, topo.Register(RelayInfo{Name: "relay-a", Neighbors: map[string]float64{"relay-b": 2}}))
+	assert.Len(t, topo.Snapshot().Nodes, 2)
+}
+
+func TestNewNodeHandlerFunc_PUT_Validation(t *testing.T) {
+	topo := &Topology{Validation: &RegistrationValidation{}}
+	handler := NewNodeHandlerFunc(topo)
+
+	req := httptest.NewRequest(http.MethodPut, "/relay/relay-a", bytes.NewReader([]byte(`{"neighbors":{"relay-b":-1}}`)))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "registration: neighbors")
+	assert.Empty(t, topo.Snapshot().Nodes)
+}
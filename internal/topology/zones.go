@@ -0,0 +1,214 @@
+package topology
+
+import "sort"
+
+// ZoneDiverseRouter computes the shortest path plus a backup path that
+// avoids the failure domains (zones) the primary path transits, so a
+// single-zone outage cannot take out both. Endpoints are exempt: the
+// source and destination zones are shared by every path.
+//
+// Nodes without a zone are treated as their own failure domain; the backup
+// only avoids them individually.
+type ZoneDiverseRouter struct {
+	// Strict omits the backup when no zone-disjoint path exists. Otherwise
+	// the router falls back to a node-disjoint backup and reports the zones
+	// it shares with the primary in RouteResult.SharedZones.
+	Strict bool
+}
+
+// Route computes the primary path with Dijkstra and a zone-diverse backup.
+func (z *ZoneDiverseRouter) Route(g *Graph, from, to string) (RouteResult, error) {
+	result, err := NewDijkstraRouter().Route(g, from, to)
+	if err != nil || from == to {
+		return result, err
+	}
+
+	primary := result.FullPath
+	transit := primary[1 : len(primary)-1]
+
+	avoidNodes := make(map[string]bool, len(transit))
+	avoidZones := make(map[string]bool)
+	for _, id := range transit {
+		avoidNodes[id] = true
+		if zone := g.Nodes[id].Zone; zone != "" {
+			avoidZones[zone] = true
+		}
+	}
+
+	// Zone-disjoint first: drop every transit-eligible node in a primary
+	// transit zone.
+	exclude := make(map[string]bool, len(avoidNodes))
+	for id, n := range g.Nodes {
+		if id == from || id == to {
+			continue
+		}
+		if avoidNodes[id] || avoidZones[n.Zone] {
+			exclude[id] = true
+		}
+	}
+	path, cost, err := shortestPath(g.without(exclude, primary), from, to)
+	if err != nil && !z.Strict {
+		path, cost, err = shortestPath(g.without(avoidNodes, primary), from, to)
+	}
+	if err != nil {
+		return result, nil // no backup available; primary stands alone
+	}
+
+	result.BackupPath = path
+	result.BackupCost = float64(cost)
+	result.SharedZones = sharedZones(g, transit, path[1:len(path)-1])
+	return result, nil
+}
+
+// without returns a copy of g without the excluded nodes and, when primary
+// is a direct hop, without that edge so the backup differs from it.
+func (g *Graph) without(exclude map[string]bool, primary []string) *Graph {
+	cp := newGraph()
+	for id, n := range g.Nodes {
+		if exclude[id] {
+			continue
+		}
+		cpNode := &Node{ID: n.ID, Zone: n.Zone, Edges: make([]Edge, 0, len(n.Edges))}
+		for _, e := range n.Edges {
+			if exclude[e.To] {
+				continue
+			}
+			if len(primary) == 2 && id == primary[0] && e.To == primary[1] {
+				continue
+			}
+			cpNode.Edges = append(cpNode.Edges, e)
+		}
+		cp.Nodes[id] = cpNode
+	}
+	return cp
+}
+
+// sharedZones returns the zones transited by both a and b, sorted.
+func sharedZones(g *Graph, a, b []string) []string {
+	inA := make(map[string]bool, len(a))
+	for _, id := range a {
+		if zone := g.Nodes[id].Zone; zone != "" {
+			inA[zone] = true
+		}
+	}
+	seen := make(map[string]bool)
+	var shared []string
+	for _, id := range b {
+		zone := g.Nodes[id].Zone
+		if inA[zone] && !seen[zone] {
+			seen[zone] = true
+			shared = append(shared, zone)
+		}
+	}
+	sort.Strings(shared)
+	return shared
+}
+
+// ZoneSummary describes one failure domain and the impact of losing it.
+type ZoneSummary struct {
+	Zone  string   `json:"zone"`
+	Nodes []string `json:"nodes"`
+
+	// CrossZoneEdges counts edges between this zone and any other.
+	CrossZoneEdges int `json:"cross_zone_edges"`
+
+	// Isolated lists nodes outside the zone left without any edge if the
+	// zone fails.
+	Isolated []string `json:"isolated"`
+
+	// Partitions reports whether losing the zone splits the remaining
+	// nodes into more components than the graph has today.
+	Partitions bool `json:"partitions"`
+}
+
+// Zones summarizes every zone in the graph, sorted by name. Nodes without
+// a zone are not listed.
+func (g *Graph) Zones() []ZoneSummary {
+	members := make(map[string][]string)
+	for id, n := range g.Nodes {
+		if n.Zone != "" {
+			members[n.Zone] = append(members[n.Zone], id)
+		}
+	}
+
+	baseline := g.components(nil)
+
+	result := make([]ZoneSummary, 0, len(members))
+	for zone, ids := range members {
+		sort.Strings(ids)
+		down := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			down[id] = true
+		}
+
+		sum := ZoneSummary{Zone: zone, Nodes: ids, Isolated: []string{}}
+		touchesZone := make(map[string]bool)
+		keepsLink := make(map[string]bool)
+		for id, n := range g.Nodes {
+			for _, e := range n.Edges {
+				if _, ok := g.Nodes[e.To]; !ok {
+					continue
+				}
+				switch {
+				case down[id] && down[e.To]:
+				case down[id] || down[e.To]:
+					sum.CrossZoneEdges++
+					touchesZone[id], touchesZone[e.To] = true, true
+				default:
+					keepsLink[id], keepsLink[e.To] = true, true
+				}
+			}
+		}
+		for id := range touchesZone {
+			if !down[id] && !keepsLink[id] {
+				sum.Isolated = append(sum.Isolated, id)
+			}
+		}
+		sort.Strings(sum.Isolated)
+		sum.Partitions = g.components(down) > baseline
+		result = append(result, sum)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Zone < result[j].Zone })
+	return result
+}
+
+// components counts the weakly connected components of g without the
+// nodes in down.
+func (g *Graph) components(down map[string]bool) int {
+	adj := make(map[string][]string, len(g.Nodes))
+	for id, n := range g.Nodes {
+		if down[id] {
+			continue
+		}
+		for _, e := range n.Edges {
+			if _, ok := g.Nodes[e.To]; !ok || down[e.To] {
+				continue
+			}
+			adj[id] = append(adj[id], e.To)
+			adj[e.To] = append(adj[e.To], id)
+		}
+	}
+
+	seen := make(map[string]bool, len(g.Nodes))
+	count := 0
+	for id := range g.Nodes {
+		if down[id] || seen[id] {
+			continue
+		}
+		count++
+		stack := []string{id}
+		seen[id] = true
+		for len(stack) > 0 {
+			u := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, v := range adj[u] {
+				if !seen[v] {
+					seen[v] = true
+					stack = append(stack, v)
+				}
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,85 @@
+package topology
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// zonedGraph builds src → {a1, a2} (zone a) and src → b1 (zone b), all
+// reaching dst. The cheapest path runs through a1.
+func zonedGraph() *Graph {
+	g := newGraph()
+	g.addNode(&Node{ID: "src", Zone: "x"})
+	g.addNode(&Node{ID: "a1", Zone: "a"})
+	g.addNode(&Node{ID: "a2", Zone: "a"})
+	g.addNode(&Node{ID: "b1", Zone: "b"})
+	g.addNode(&Node{ID: "dst", Zone: "y"})
+	g.addEdge("src", "a1", 1)
+	g.addEdge("src", "a2", 2)
+	g.addEdge("src", "b1", 5)
+	g.addEdge("a1", "dst", 1)
+	g.addEdge("a2", "dst", 1)
+	g.addEdge("b1", "dst", 5)
+	return g
+}
+
+func TestZoneDiverseRouter_AvoidsPrimaryZones(t *testing.T) {
+	res, err := (&ZoneDiverseRouter{}).Route(zonedGraph(), "src", "dst")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"src", "a1", "dst"}, res.FullPath)
+	assert.Equal(t, []string{"src", "b1", "dst"}, res.BackupPath, "a2 is cheaper but shares zone a")
+	assert.Equal(t, 10.0, res.BackupCost)
+	assert.Empty(t, res.SharedZones)
+}
+
+func TestZoneDiverseRouter_FallsBackToNodeDisjoint(t *testing.T) {
+	g := zonedGraph()
+	g.Nodes["src"].Edges = g.Nodes["src"].Edges[:2] // drop src → b1
+
+	res, err := (&ZoneDiverseRouter{}).Route(g, "src", "dst")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src", "a2", "dst"}, res.BackupPath)
+	assert.Equal(t, []string{"a"}, res.SharedZones)
+
+	res, err = (&ZoneDiverseRouter{Strict: true}).Route(g, "src", "dst")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src", "a1", "dst"}, res.FullPath)
+	assert.Nil(t, res.BackupPath)
+}
+
+func TestZoneDiverseRouter_DirectHop(t *testing.T) {
+	g := zonedGraph()
+	g.addEdge("src", "dst", 1)
+
+	res, err := (&ZoneDiverseRouter{}).Route(g, "src", "dst")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src", "dst"}, res.FullPath)
+	assert.Equal(t, []string{"src", "a1", "dst"}, res.BackupPath, "backup must not reuse the direct edge")
+
+	_, err = (&ZoneDiverseRouter{}).Route(g, "src", "missing")
+	assert.Error(t, err)
+}
+
+func TestGraph_Zones(t *testing.T) {
+	g := zonedGraph()
+	g.addNode(&Node{ID: "leaf"}) // unzoned, only reachable through b1
+	g.addEdge("b1", "leaf", 1)
+
+	zones := g.Zones()
+	require.Len(t, zones, 4)
+
+	a := zones[0]
+	assert.Equal(t, "a", a.Zone)
+	assert.Equal(t, []string{"a1", "a2"}, a.Nodes)
+	assert.Equal(t, 4, a.CrossZoneEdges)
+	assert.Empty(t, a.Isolated)
+	assert.False(t, a.Partitions)
+
+	b := zones[1]
+	assert.Equal(t, "b", b.Zone)
+	assert.Equal(t, []string{"leaf"}, b.Isolated)
+	assert.True(t, b.Partitions)
+}
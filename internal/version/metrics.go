@@ -0,0 +1,30 @@
+package version
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// buildInfo is the constant 1 labelled with the binary's version metadata.
+var buildInfo = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+	Namespace: "qumo",
+	Name:      "build_info",
+	Help:      "Always 1; labelled with the version, commit and Go version the binary was built from.",
+	ConstLabels: prometheus.Labels{
+		"version":   version,
+		"commit":    commit,
+		"goversion": GoVersion(),
+	},
+}, func() float64 { return 1 })
+
+// RegisterMetrics registers qumo_build_info with reg. Registering it again,
+// as a relay with an embedded controller does, is not an error.
+func RegisterMetrics(reg prometheus.Registerer) error {
+	err := reg.Register(buildInfo)
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		return nil
+	}
+	return err
+}
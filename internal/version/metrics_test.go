@@ -0,0 +1,27 @@
+package version
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if err := RegisterMetrics(reg); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterMetrics(reg); err != nil {
+		t.Fatalf("second registration: %v", err)
+	}
+
+	want := `# HELP qumo_build_info Always 1; labelled with the version, commit and Go version the binary was built from.
+# TYPE qumo_build_info gauge
+qumo_build_info{commit="` + Commit() + `",goversion="` + GoVersion() + `",version="` + Version() + `"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "qumo_build_info"); err != nil {
+		t.Error(err)
+	}
+}
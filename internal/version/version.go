@@ -5,6 +5,7 @@ package version
 
 import (
 	"fmt"
+	"runtime"
 	"runtime/debug"
 )
 
@@ -24,6 +25,28 @@ func Commit() string { return commit }
 // Date returns the build date.
 func Date() string { return date }
 
+// GoVersion returns the Go version the binary was built with.
+func GoVersion() string { return runtime.Version() }
+
+// BuildInfo is the version metadata as served by the relay's
+// /admin/buildinfo.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Info returns the binary's version metadata.
+func Info() BuildInfo {
+	return BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: GoVersion(),
+	}
+}
+
 // Full returns a human-readable multi-line version string.
 func Full() string {
 	s := fmt.Sprintf("qumo %s\n  commit: %s\n  built:  %s", version, commit, date)
@@ -65,6 +65,7 @@ func Help() error {
 	fmt.Println("    mage test         - Run all tests")
 	fmt.Println("    mage testVerbose  - Run tests with verbose output")
 	fmt.Println("    mage coverage     - Run tests and write coverage.out")
+	fmt.Println("    mage soak <dur>   - Run the relay soak test for <dur> (e.g. 2h)")
 	fmt.Println("    mage fmt          - Format code with go fmt")
 	fmt.Println("    mage vet          - Run go vet for static analysis")
 	fmt.Println("    mage lint         - Run golangci-lint (if installed)")
@@ -194,6 +195,17 @@ func Coverage() error {
 	return nil
 }
 
+// Soak runs the relay soak test for duration (e.g. "2h") and fails if its
+// memory, goroutines or file descriptors trend upwards
+func Soak(duration string) error {
+	fmt.Printf("🧪 Running soak test for %s...\n", duration)
+
+	cmd := exec.Command("go", "test", "./internal/relay", "-run", "^TestSoak$", "-count=1", "-v", "-timeout", "0", "-soak", duration)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
 // Fmt formats all Go code
 func Fmt() error {
 	fmt.Println("✨ Formatting code...")
@@ -321,7 +333,8 @@ func Web() error {
 func WebBuild() error {
 	fmt.Println("🔨 Building web demo...")
 
-	cmd := exec.Command("npm", "run", "build")
+	// A relative base lets the SDN controller serve the build under /ui/.
+	cmd := exec.Command("npm", "run", "build", "--", "--base=./")
 	cmd.Dir = "solid-deno"
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -10,8 +10,11 @@ import (
 
 var (
 	// overridable command handlers for easier unit-testing
-	runRelay = cli.RunRelay
-	runSDN   = cli.RunSDN
+	runRelay   = cli.RunRelay
+	runSDN     = cli.RunSDN
+	runBench   = cli.RunBenchInternal
+	runUpgrade = cli.RunUpgrade
+	runStatus  = cli.RunStatus
 )
 
 func main() {
@@ -41,6 +44,12 @@ func run(args []string) int {
 		err = runRelay(cmdArgs)
 	case "sdn":
 		err = runSDN(cmdArgs)
+	case "bench-internal":
+		err = runBench(cmdArgs)
+	case "upgrade":
+		err = runUpgrade(cmdArgs)
+	case "status":
+		err = runStatus(cmdArgs)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", cmd)
 		printUsage()
@@ -60,9 +69,14 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "Commands:")
 	fmt.Fprintln(os.Stderr, "  relay    Start the MoQ relay server")
 	fmt.Fprintln(os.Stderr, "  sdn      Start the SDN controller")
+	fmt.Fprintln(os.Stderr, "  bench-internal  Benchmark cache/ring tuning on this machine and recommend values")
+	fmt.Fprintln(os.Stderr, "  upgrade  Hand a running relay's sockets to a new process (server.handoff)")
+	fmt.Fprintln(os.Stderr, "  status   Summarize a running relay (-addr localhost:4433, -watch to refresh)")
 	fmt.Fprintln(os.Stderr, "  version  Print version information")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Flags:")
 	fmt.Fprintln(os.Stderr, "  -config string   path to config file")
 	fmt.Fprintln(os.Stderr, "                   defaults: config.relay.yaml (relay), config.sdn.yaml (sdn)")
+	fmt.Fprintln(os.Stderr, "  -dev             relay only: localhost quickstart with a generated certificate")
+	fmt.Fprintln(os.Stderr, "                   and an embedded SDN controller; no config file")
 }
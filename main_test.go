@@ -40,15 +40,24 @@ func TestPrintUsage_WritesHelpToStderr(t *testing.T) {
 func TestRun_Unit(t *testing.T) {
 	origRelay := runRelay
 	origSDN := runSDN
+	origBench := runBench
+	origUpgrade := runUpgrade
+	origStatus := runStatus
 	defer func() {
 		runRelay = origRelay
 		runSDN = origSDN
+		runBench = origBench
+		runUpgrade = origUpgrade
+		runStatus = origStatus
 	}()
 
 	tests := map[string]struct {
 		args               []string
 		stubRelay          func([]string) error
 		stubSDN            func([]string) error
+		stubBench          func([]string) error
+		stubUpgrade        func([]string) error
+		stubStatus         func([]string) error
 		wantCode           int
 		wantStderrContains []string
 	}{
@@ -92,6 +101,30 @@ func TestRun_Unit(t *testing.T) {
 			wantCode:           1,
 			wantStderrContains: []string{"error: sdn-fail"},
 		},
+		"bench-internal passes args": {
+			args: []string{"bench-internal", "-json"},
+			stubBench: func(a []string) error {
+				assert.Equal(t, []string{"-json"}, a)
+				return nil
+			},
+			wantCode: 0,
+		},
+		"upgrade passes args": {
+			args: []string{"upgrade", "-binary", "/usr/local/bin/qumo"},
+			stubUpgrade: func(a []string) error {
+				assert.Equal(t, []string{"-binary", "/usr/local/bin/qumo"}, a)
+				return nil
+			},
+			wantCode: 0,
+		},
+		"status passes args": {
+			args: []string{"status", "-addr", "localhost:8080", "-watch"},
+			stubStatus: func(a []string) error {
+				assert.Equal(t, []string{"-addr", "localhost:8080", "-watch"}, a)
+				return nil
+			},
+			wantCode: 0,
+		},
 	}
 
 	for name, tt := range tests {
@@ -106,6 +139,21 @@ func TestRun_Unit(t *testing.T) {
 			} else {
 				runSDN = func([]string) error { return nil }
 			}
+			if tt.stubBench != nil {
+				runBench = tt.stubBench
+			} else {
+				runBench = func([]string) error { return nil }
+			}
+			if tt.stubUpgrade != nil {
+				runUpgrade = tt.stubUpgrade
+			} else {
+				runUpgrade = func([]string) error { return nil }
+			}
+			if tt.stubStatus != nil {
+				runStatus = tt.stubStatus
+			} else {
+				runStatus = func([]string) error { return nil }
+			}
 
 			// capture stderr
 			saved := os.Stderr
@@ -0,0 +1,562 @@
+// Package sdnclient is a Go client for the qumo SDN controller's HTTP API,
+// for tools and tests that talk to a controller from outside a relay.
+//
+//	c := sdnclient.New("http://sdn:8090")
+//	route, err := c.Route(ctx, "relay-tokyo", "relay-paris")
+//
+// Every method takes a context. Idempotent requests are retried with
+// exponential backoff on transport errors, 429 and 5xx responses; other
+// failures surface as a *StatusError.
+package sdnclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults used by New.
+const (
+	DefaultRetries      = 2
+	DefaultRetryBackoff = 200 * time.Millisecond
+)
+
+// Client calls one SDN controller. The zero value of each optional field is
+// usable; New fills in the retry defaults.
+type Client struct {
+	// URL is the controller's base URL, e.g. "http://sdn:8090".
+	URL string
+
+	// Token is sent as a bearer token, as required by the operator
+	// endpoints (overrides, edge attributes) when admin.token is set. A
+	// relay's token from the controller's identities instead shows the
+	// private broadcasts that relay may see.
+	Token string
+
+	// HTTPClient performs the requests. Nil means http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Retries is how many times an idempotent request is repeated after a
+	// retryable failure. RetryBackoff is the wait before the first retry
+	// and doubles after each one.
+	Retries      int
+	RetryBackoff time.Duration
+}
+
+// New returns a client for the controller at url with the default retry
+// policy.
+func New(url string) *Client {
+	return &Client{
+		URL:          url,
+		Retries:      DefaultRetries,
+		RetryBackoff: DefaultRetryBackoff,
+	}
+}
+
+// StatusError is returned when the controller answers with a non-2xx status.
+type StatusError struct {
+	Method  string
+	URL     string
+	Code    int
+	Message string // the controller's error message, if any
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s returned %d", e.Method, e.URL, e.Code)
+	}
+	return fmt.Sprintf("%s %s returned %d: %s", e.Method, e.URL, e.Code, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the controller, e.g. for an
+// unknown relay or a missing route.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusNotFound
+}
+
+// IsConflict reports whether err is a 409 from the controller, e.g. a
+// bandwidth reservation over full links.
+func IsConflict(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusConflict
+}
+
+// RegisterRelay registers info.Name with its neighbors, or refreshes it.
+// Relays call this as their heartbeat.
+func (c *Client) RegisterRelay(ctx context.Context, info RelayInfo) error {
+	if info.Name == "" {
+		return errors.New("sdnclient: relay name is required")
+	}
+	return c.do(ctx, http.MethodPut, pathOf("relay", info.Name), nil, info, nil)
+}
+
+// DeregisterRelay removes a relay from the topology.
+func (c *Client) DeregisterRelay(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, pathOf("relay", name), nil, nil, nil)
+}
+
+// RelayDetail returns everything the controller knows about a relay.
+func (c *Client) RelayDetail(ctx context.Context, name string) (*NodeDetail, error) {
+	var d NodeDetail
+	if err := c.do(ctx, http.MethodGet, pathOf("relay", name, "detail"), nil, nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ScheduleMaintenance sets the maintenance window of a relay, which is
+// cordoned while the window lasts.
+func (c *Client) ScheduleMaintenance(ctx context.Context, m MaintenanceRequest) error {
+	return c.do(ctx, http.MethodPut, pathOf("relay", m.Relay, "maintenance"), nil, m, nil)
+}
+
+// CancelMaintenance removes the maintenance window of a relay and
+// uncordons it.
+func (c *Client) CancelMaintenance(ctx context.Context, relay string) error {
+	return c.do(ctx, http.MethodDelete, pathOf("relay", relay, "maintenance"), nil, nil, nil)
+}
+
+// Maintenance lists the scheduled and active maintenance windows.
+func (c *Client) Maintenance(ctx context.Context) ([]MaintenanceWindow, error) {
+	var resp struct {
+		Maintenance []MaintenanceWindow `json:"maintenance"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/maintenance", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Maintenance, nil
+}
+
+// MaintenanceCalendar writes the maintenance windows as iCalendar to w.
+func (c *Client) MaintenanceCalendar(ctx context.Context, w io.Writer) error {
+	return c.do(ctx, http.MethodGet, "/maintenance", url.Values{"format": {"ics"}}, nil, w)
+}
+
+// Route returns the path from one relay to another.
+func (c *Client) Route(ctx context.Context, from, to string) (*RouteResult, error) {
+	var res RouteResult
+	q := url.Values{"from": {from}, "to": {to}}
+	if err := c.do(ctx, http.MethodGet, "/route", q, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Reserve returns a route with bandwidth reserved along it. It fails with
+// a 409 *StatusError (see IsConflict) when every path crosses a full link.
+func (c *Client) Reserve(ctx context.Context, req ReserveRequest) (*RouteResult, error) {
+	var res RouteResult
+	if err := c.do(ctx, http.MethodPost, "/route", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Reservations lists the bandwidth reservations and edge loads.
+func (c *Client) Reservations(ctx context.Context) (*Reservations, error) {
+	var r Reservations
+	if err := c.do(ctx, http.MethodGet, "/route/reservations", nil, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ReleaseReservation frees a reservation made with Reserve.
+func (c *Client) ReleaseReservation(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/route/reservations", url.Values{"id": {id}}, nil, nil)
+}
+
+// Graph returns the current topology.
+func (c *Client) Graph(ctx context.Context) (*GraphResponse, error) {
+	var g GraphResponse
+	if err := c.do(ctx, http.MethodGet, "/graph", nil, nil, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Asymmetries returns the one-way links in the topology.
+func (c *Client) Asymmetries(ctx context.Context) ([]Asymmetry, error) {
+	var resp struct {
+		Asymmetries []Asymmetry `json:"asymmetries"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/graph/asymmetries", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Asymmetries, nil
+}
+
+// Zones summarizes the topology's failure domains.
+func (c *Client) Zones(ctx context.Context) (*Zones, error) {
+	var z Zones
+	if err := c.do(ctx, http.MethodGet, "/graph/zones", nil, nil, &z); err != nil {
+		return nil, err
+	}
+	return &z, nil
+}
+
+// Query evaluates a topology query such as
+// "nodes(region=eu-*) | reachable_from(relay-a) | sort(cost)".
+func (c *Client) Query(ctx context.Context, q string) (*QueryResult, error) {
+	var res QueryResult
+	if err := c.do(ctx, http.MethodGet, "/query", url.Values{"q": {q}}, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Overrides lists the manual edge overrides.
+func (c *Client) Overrides(ctx context.Context) ([]EdgeOverride, error) {
+	var resp struct {
+		Overrides []EdgeOverride `json:"overrides"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/override/edge", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Overrides, nil
+}
+
+// SetOverride pins the edge o.From → o.To to o.Cost, or takes it out of
+// routing if o.Down is set.
+func (c *Client) SetOverride(ctx context.Context, o EdgeOverride) error {
+	var cost any = o.Cost
+	if o.Down {
+		cost = "down"
+	}
+	body := map[string]any{"from": o.From, "to": o.To, "cost": cost, "reason": o.Reason}
+	return c.do(ctx, http.MethodPost, "/override/edge", nil, body, nil)
+}
+
+// ClearOverride removes the override of the edge from → to.
+func (c *Client) ClearOverride(ctx context.Context, from, to string) error {
+	return c.do(ctx, http.MethodDelete, "/override/edge", url.Values{"from": {from}, "to": {to}}, nil, nil)
+}
+
+// SetEdgeAttributes updates an edge's cost model inputs and returns them.
+func (c *Client) SetEdgeAttributes(ctx context.Context, u AttributesUpdate) (*EdgeAttributes, error) {
+	var attrs EdgeAttributes
+	if err := c.do(ctx, http.MethodPost, "/graph/attributes", nil, u, &attrs); err != nil {
+		return nil, err
+	}
+	return &attrs, nil
+}
+
+// Snapshot exports the topology as served to peer controllers.
+func (c *Client) Snapshot(ctx context.Context) (*GraphResponse, error) {
+	var g GraphResponse
+	if err := c.do(ctx, http.MethodGet, "/sync", nil, nil, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Restore imports g into the controller's topology, applied with the
+// controller's sync strategy: merged relay by relay, or replacing it.
+func (c *Client) Restore(ctx context.Context, g GraphResponse) error {
+	return c.do(ctx, http.MethodPut, "/sync", nil, g, nil)
+}
+
+// Announce registers broadcastPath as held by relay. md may be nil.
+func (c *Client) Announce(ctx context.Context, relay, broadcastPath string, md *AnnounceMetadata) error {
+	body := map[string]any{"metadata": md}
+	return c.do(ctx, http.MethodPut, announcePath(relay, broadcastPath), nil, body, nil)
+}
+
+// Withdraw removes relay's announcement of broadcastPath.
+func (c *Client) Withdraw(ctx context.Context, relay, broadcastPath string) error {
+	return c.do(ctx, http.MethodDelete, announcePath(relay, broadcastPath), nil, nil, nil)
+}
+
+// Lookup returns the relays that announced broadcastPath.
+func (c *Client) Lookup(ctx context.Context, broadcastPath string) ([]AnnounceEntry, error) {
+	var resp struct {
+		Relays []AnnounceEntry `json:"relays"`
+	}
+	q := url.Values{"broadcast_path": {broadcastPath}}
+	if err := c.do(ctx, http.MethodGet, "/announce/lookup", q, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Relays, nil
+}
+
+// Announcements returns every announcement, sorted by broadcast path, then
+// relay.
+func (c *Client) Announcements(ctx context.Context) ([]AnnounceEntry, error) {
+	var resp struct {
+		Entries []AnnounceEntry `json:"entries"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/announce/export", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+// AnnouncementsSince returns the announcements that changed after version,
+// which a previous call returned. Pass 0 for the full list; the delta is
+// also Full when the controller no longer has the changes.
+func (c *Client) AnnouncementsSince(ctx context.Context, version uint64) (*AnnounceDelta, error) {
+	var d AnnounceDelta
+	q := url.Values{"since": {strconv.FormatUint(version, 10)}}
+	if err := c.do(ctx, http.MethodGet, "/announce", q, nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ExportCSV writes the announce table as CSV to w.
+func (c *Client) ExportCSV(ctx context.Context, w io.Writer) error {
+	return c.do(ctx, http.MethodGet, "/announce/export", url.Values{"format": {"csv"}}, nil, w)
+}
+
+// Coverage reports how many relays hold each broadcast against the
+// replication policy; unsatisfied limits it to hot broadcasts below target.
+func (c *Client) Coverage(ctx context.Context, unsatisfied bool) (*CoverageReport, error) {
+	var q url.Values
+	if unsatisfied {
+		q = url.Values{"unsatisfied": {"true"}}
+	}
+	var rep CoverageReport
+	if err := c.do(ctx, http.MethodGet, "/announce/coverage", q, nil, &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// announcePath returns /announce/<relay>/<broadcastPath>.
+func announcePath(relay, broadcastPath string) string {
+	segments := strings.Split(strings.TrimPrefix(broadcastPath, "/"), "/")
+	return pathOf(append([]string{"announce", relay}, segments...)...)
+}
+
+// pathOf joins segments into a URL path, escaping each, so that names
+// with reserved characters such as '?' or '#' reach the controller intact.
+func pathOf(segments ...string) string {
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteByte('/')
+		b.WriteString(url.PathEscape(s))
+	}
+	return b.String()
+}
+
+// ReportStats stores relay's latest metric summary.
+func (c *Client) ReportStats(ctx context.Context, relay string, stats RelayStats) error {
+	// The controller keeps the latest report, so repeating it is harmless
+	return c.doRetry(ctx, http.MethodPost, pathOf("stats", "relay", relay), nil, stats, nil)
+}
+
+// RelayStats returns relay's latest stored report.
+func (c *Client) RelayStats(ctx context.Context, relay string) (*RelayStatsEntry, error) {
+	var e RelayStatsEntry
+	if err := c.do(ctx, http.MethodGet, pathOf("stats", "relay", relay), nil, nil, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ClusterStats returns the fleet-wide aggregate of the latest reports.
+func (c *Client) ClusterStats(ctx context.Context) (*ClusterStats, error) {
+	var s ClusterStats
+	if err := c.do(ctx, http.MethodGet, "/stats/cluster", nil, nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ProbeStats returns the per-edge probe statistics.
+func (c *Client) ProbeStats(ctx context.Context) ([]ProbeStats, error) {
+	var resp struct {
+		Edges []ProbeStats `json:"edges"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/stats/probes", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Edges, nil
+}
+
+// ProbeTasks returns the probes relay should run now.
+func (c *Client) ProbeTasks(ctx context.Context, relay string) ([]ProbeTask, error) {
+	var resp struct {
+		Tasks []ProbeTask `json:"tasks"`
+	}
+	if err := c.do(ctx, http.MethodGet, pathOf("probes", relay), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tasks, nil
+}
+
+// ReportProbe submits the result of a probe task and returns the updated
+// statistics of its edge. Token must be the identity token of the relay
+// that ran the probe.
+func (c *Client) ReportProbe(ctx context.Context, res ProbeResult) (*ProbeStats, error) {
+	var st ProbeStats
+	if err := c.do(ctx, http.MethodPost, "/probes/results", nil, res, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// PrefetchTasks returns the broadcasts relay should prefetch.
+func (c *Client) PrefetchTasks(ctx context.Context, relay string) ([]PrefetchTask, error) {
+	var resp struct {
+		Tasks []PrefetchTask `json:"tasks"`
+	}
+	if err := c.do(ctx, http.MethodGet, pathOf("replication", relay), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tasks, nil
+}
+
+// Placement selects the ingest relay for a publisher.
+func (c *Client) Placement(ctx context.Context, req PlacementRequest) (*PlacementResult, error) {
+	var res PlacementResult
+	// Placement has no side effects
+	if err := c.doRetry(ctx, http.MethodPost, "/placement", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Edge selects the nearest relay for a subscriber at ip. An empty ip lets
+// the controller use the request's source address.
+func (c *Client) Edge(ctx context.Context, ip string) (*EdgeResponse, error) {
+	var q url.Values
+	if ip != "" {
+		q = url.Values{"ip": {ip}}
+	}
+	var res EdgeResponse
+	if err := c.do(ctx, http.MethodGet, "/edge", q, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Health reports whether the controller is serving.
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/health", nil, nil, nil)
+}
+
+// do sends a request, retrying it if the method is idempotent.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	retry := method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+	return c.send(ctx, method, path, query, in, out, retry)
+}
+
+// doRetry sends a request that is safe to retry whatever its method.
+func (c *Client) doRetry(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	return c.send(ctx, method, path, query, in, out, true)
+}
+
+// send encodes in as the JSON body, if not nil, and decodes the response
+// into out, or copies it if out is an io.Writer. A nil out discards it.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in, out any, retry bool) error {
+	target, err := url.Parse(strings.TrimSuffix(c.URL, "/") + path)
+	if err != nil {
+		return fmt.Errorf("sdnclient: invalid URL: %w", err)
+	}
+	target.RawQuery = query.Encode()
+
+	var body []byte
+	if in != nil {
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err = c.attempt(ctx, method, target.String(), body, out)
+		if err == nil || !retry || attempt >= c.Retries || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// attempt performs one request.
+func (c *Client) attempt(ctx context.Context, method, target string, body []byte, out any) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{
+			Method:  method,
+			URL:     req.URL.Redacted(),
+			Code:    resp.StatusCode,
+			Message: errorMessage(resp.Body),
+		}
+	}
+
+	switch out := out.(type) {
+	case nil:
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	case io.Writer:
+		_, err = io.Copy(out, resp.Body)
+		return err
+	default:
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("sdnclient: decode %s response: %w", req.URL.Path, err)
+		}
+		return nil
+	}
+}
+
+// errorMessage extracts the message of an error response, which is
+// {"error": "..."} from the API handlers and plain text from the auth layer.
+func errorMessage(body io.Reader) string {
+	b, _ := io.ReadAll(io.LimitReader(body, 4096))
+	var e struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(b, &e) == nil && e.Error != "" {
+		return e.Error
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// retryable reports whether err may succeed on a later attempt: transport
+// failures, 5xx and 429 are; other 4xx are not.
+func retryable(err error) bool {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	return se.Code >= 500 || se.Code == http.StatusTooManyRequests
+}
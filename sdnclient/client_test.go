@@ -0,0 +1,552 @@
+package sdnclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okdaichi/qumo/internal/sdn"
+	"github.com/okdaichi/qumo/internal/topology"
+)
+
+// newController serves the controller's handlers as cli wires them, minus
+// admin auth.
+func newController(t *testing.T) *Client {
+	t.Helper()
+	topo := &topology.Topology{}
+	announces := sdn.NewAnnounceTable(0)
+	stats := sdn.NewStatsTable(time.Minute)
+	probes := sdn.NewProbeTable(time.Minute)
+	replication := sdn.NewReplicationTable(sdn.ReplicationPolicy{}, announces, stats, topo)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/relay/", topology.NewNodeHandlerFunc(topo))
+	mux.HandleFunc("/relay/{name}/detail", sdn.NodeDetailHandlerFunc(topo, announces, stats))
+	mux.HandleFunc("/relay/{name}/maintenance", topology.MaintenanceHandlerFunc(topo))
+	mux.HandleFunc("/maintenance", topology.MaintenanceCalendarHandlerFunc(topo))
+	mux.HandleFunc("/route", topology.RouteHandlerFunc(topo))
+	mux.HandleFunc("/route/reservations", topology.ReservationsHandlerFunc(topo))
+	mux.HandleFunc("/graph", topology.GraphHandlerFunc(topo))
+	mux.HandleFunc("/graph/asymmetries", topology.AsymmetriesHandlerFunc(topo))
+	mux.HandleFunc("/graph/zones", topology.ZonesHandlerFunc(topo))
+	mux.HandleFunc("/query", topology.QueryHandlerFunc(topo))
+	mux.HandleFunc("/override/edge", topology.OverrideHandlerFunc(topo))
+	mux.HandleFunc("/graph/attributes", topology.AttributesHandlerFunc(topo))
+	mux.HandleFunc("/sync", topology.SyncHandlerFunc(topo))
+	mux.HandleFunc("/announce/lookup", sdn.LookupHandlerFunc(announces))
+	mux.HandleFunc("/announce/export", sdn.ExportHandlerFunc(announces))
+	mux.HandleFunc("/announce/coverage", sdn.CoverageHandlerFunc(replication))
+	mux.HandleFunc("/announce/", sdn.HandlerFunc(announces))
+	mux.HandleFunc("/stats/relay/", sdn.RelayStatsHandlerFunc(stats))
+	mux.HandleFunc("/stats/cluster", sdn.ClusterStatsHandlerFunc(stats))
+	mux.HandleFunc("/probes/", sdn.ProbeTasksHandlerFunc(probes, topo))
+	mux.HandleFunc("/probes/results", sdn.ProbeResultsHandlerFunc(probes, topo))
+	mux.HandleFunc("/stats/probes", sdn.ProbeReportHandlerFunc(probes))
+	mux.HandleFunc("/replication/", sdn.PrefetchTasksHandlerFunc(replication))
+	mux.HandleFunc("/placement", sdn.PlacementHandlerFunc(topo, stats))
+
+	srv := httptest.NewServer(sdn.IdentifyRelays([]sdn.RelayIdentity{{Relay: "a", Token: "token-a"}}, mux))
+	t.Cleanup(srv.Close)
+	return New(srv.URL)
+}
+
+func TestClient_Topology(t *testing.T) {
+	ctx := context.Background()
+	c := newController(t)
+
+	for _, info := range []RelayInfo{
+		{Name: "a", Region: "eu", Zone: "z1", Address: "https://a:4433", Neighbors: map[string]float64{"b": 2}, Symmetric: true},
+		{Name: "b", Region: "eu", Zone: "z2", Address: "https://b:4433", Neighbors: map[string]float64{"c": 3}},
+		{Name: "c", Region: "us", Address: "https://c:4433", Neighbors: map[string]float64{}},
+	} {
+		if err := c.RegisterRelay(ctx, info); err != nil {
+			t.Fatalf("RegisterRelay(%s): %v", info.Name, err)
+		}
+	}
+
+	route, err := c.Route(ctx, "a", "c")
+	if err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	if route.NextHop != "b" || route.Cost != 5 || route.NextHopAddress != "https://b:4433" {
+		t.Errorf("Route = %+v", route)
+	}
+	if _, err := c.Route(ctx, "c", "a"); !IsNotFound(err) {
+		t.Errorf("Route(c, a) error = %v, want not found", err)
+	}
+
+	g, err := c.Graph(ctx)
+	if err != nil {
+		t.Fatalf("Graph: %v", err)
+	}
+	if len(g.Nodes) != 3 || g.Adjacency["b"]["a"] != 2 {
+		t.Errorf("Graph = %+v", g)
+	}
+
+	asym, err := c.Asymmetries(ctx)
+	if err != nil {
+		t.Fatalf("Asymmetries: %v", err)
+	}
+	if len(asym) != 1 || asym[0].From != "b" || asym[0].To != "c" {
+		t.Errorf("Asymmetries = %+v", asym)
+	}
+
+	zones, err := c.Zones(ctx)
+	if err != nil {
+		t.Fatalf("Zones: %v", err)
+	}
+	if len(zones.Zones) != 2 || zones.Unzoned != 1 {
+		t.Errorf("Zones = %+v", zones)
+	}
+
+	res, err := c.Query(ctx, "nodes(region=eu)")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if res.Count != 2 {
+		t.Errorf("Query count = %d, want 2", res.Count)
+	}
+	var se *StatusError
+	if _, err := c.Query(ctx, "nodes("); !errors.As(err, &se) || se.Code != http.StatusBadRequest || se.Message == "" {
+		t.Errorf("invalid Query error = %v, want 400 with message", err)
+	}
+
+	snap, err := c.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if err := c.DeregisterRelay(ctx, "c"); err != nil {
+		t.Fatalf("DeregisterRelay: %v", err)
+	}
+	if err := c.DeregisterRelay(ctx, "c"); !IsNotFound(err) {
+		t.Errorf("second DeregisterRelay error = %v, want not found", err)
+	}
+	if err := c.Restore(ctx, *snap); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if _, err := c.Route(ctx, "a", "c"); err != nil {
+		t.Errorf("Route after Restore: %v", err)
+	}
+
+	util := 0.5
+	attrs, err := c.SetEdgeAttributes(ctx, AttributesUpdate{From: "a", To: "b", Utilization: &util})
+	if err != nil {
+		t.Fatalf("SetEdgeAttributes: %v", err)
+	}
+	if attrs.Utilization != 0.5 {
+		t.Errorf("Utilization = %v, want 0.5", attrs.Utilization)
+	}
+
+	capacity := 100.0
+	if _, err := c.SetEdgeAttributes(ctx, AttributesUpdate{From: "a", To: "b", CapacityMbps: &capacity}); err != nil {
+		t.Fatalf("SetEdgeAttributes: %v", err)
+	}
+	reserved, err := c.Reserve(ctx, ReserveRequest{From: "a", To: "c", Mbps: 60})
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if reserved.ReservationID == "" || reserved.ReservedMbps != 60 {
+		t.Errorf("Reserve = %+v", reserved)
+	}
+	if _, err := c.Reserve(ctx, ReserveRequest{From: "a", To: "c", Mbps: 60}); !IsConflict(err) {
+		t.Errorf("second Reserve error = %v, want conflict", err)
+	}
+	rs, err := c.Reservations(ctx)
+	if err != nil {
+		t.Fatalf("Reservations: %v", err)
+	}
+	if len(rs.Reservations) != 1 || len(rs.Edges) != 2 {
+		t.Errorf("Reservations = %+v", rs)
+	}
+	if err := c.ReleaseReservation(ctx, reserved.ReservationID); err != nil {
+		t.Fatalf("ReleaseReservation: %v", err)
+	}
+	if err := c.ReleaseReservation(ctx, reserved.ReservationID); !IsNotFound(err) {
+		t.Errorf("second ReleaseReservation error = %v, want not found", err)
+	}
+
+	if err := c.SetOverride(ctx, EdgeOverride{From: "a", To: "b", Down: true, Reason: "maintenance"}); err != nil {
+		t.Fatalf("SetOverride: %v", err)
+	}
+	overrides, err := c.Overrides(ctx)
+	if err != nil {
+		t.Fatalf("Overrides: %v", err)
+	}
+	if len(overrides) != 1 || !overrides[0].Down || overrides[0].Reason != "maintenance" {
+		t.Errorf("Overrides = %+v", overrides)
+	}
+	if err := c.ClearOverride(ctx, "a", "b"); err != nil {
+		t.Fatalf("ClearOverride: %v", err)
+	}
+
+	if err := c.ScheduleMaintenance(ctx, MaintenanceRequest{Relay: "b", DurationSec: 3600, Reason: "upgrade"}); err != nil {
+		t.Fatalf("ScheduleMaintenance: %v", err)
+	}
+	windows, err := c.Maintenance(ctx)
+	if err != nil {
+		t.Fatalf("Maintenance: %v", err)
+	}
+	if len(windows) != 1 || windows[0].Relay != "b" || windows[0].Reason != "upgrade" {
+		t.Errorf("Maintenance = %+v", windows)
+	}
+	var ics strings.Builder
+	if err := c.MaintenanceCalendar(ctx, &ics); err != nil {
+		t.Fatalf("MaintenanceCalendar: %v", err)
+	}
+	if !strings.Contains(ics.String(), "SUMMARY:Maintenance: b (upgrade)") {
+		t.Errorf("MaintenanceCalendar = %q", ics.String())
+	}
+	if err := c.CancelMaintenance(ctx, "b"); err != nil {
+		t.Fatalf("CancelMaintenance: %v", err)
+	}
+	if err := c.CancelMaintenance(ctx, "b"); !IsNotFound(err) {
+		t.Errorf("second CancelMaintenance error = %v, want not found", err)
+	}
+
+	d, err := c.RelayDetail(ctx, "a")
+	if err != nil {
+		t.Fatalf("RelayDetail: %v", err)
+	}
+	if d.Relay != "a" || d.Node == nil || d.Node.Region != "eu" || len(d.Events) == 0 {
+		t.Errorf("RelayDetail = %+v", d)
+	}
+}
+
+func TestClient_Announces(t *testing.T) {
+	ctx := context.Background()
+	c := newController(t)
+
+	md := &AnnounceMetadata{Codecs: []string{"opus"}, Bitrate: 64000}
+	if err := c.Announce(ctx, "b", "/live/x", md); err != nil {
+		t.Fatalf("Announce: %v", err)
+	}
+	if err := c.Announce(ctx, "a", "live/x", nil); err != nil {
+		t.Fatalf("Announce: %v", err)
+	}
+
+	relays, err := c.Lookup(ctx, "/live/x")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(relays) != 2 {
+		t.Fatalf("Lookup = %+v, want 2 relays", relays)
+	}
+
+	all, err := c.Announcements(ctx)
+	if err != nil {
+		t.Fatalf("Announcements: %v", err)
+	}
+	if len(all) != 2 || all[0].Relay != "a" || all[1].Metadata == nil || all[1].Metadata.Bitrate != 64000 {
+		t.Errorf("Announcements = %+v", all)
+	}
+
+	var csv strings.Builder
+	if err := c.ExportCSV(ctx, &csv); err != nil {
+		t.Fatalf("ExportCSV: %v", err)
+	}
+	if !strings.HasPrefix(csv.String(), "relay,broadcast_path,") || strings.Count(csv.String(), "\n") != 3 {
+		t.Errorf("ExportCSV = %q", csv.String())
+	}
+
+	cov, err := c.Coverage(ctx, false)
+	if err != nil {
+		t.Fatalf("Coverage: %v", err)
+	}
+	if len(cov.Paths) != 1 || cov.Paths[0].Coverage != 2 {
+		t.Errorf("Coverage = %+v", cov)
+	}
+
+	if err := c.Withdraw(ctx, "a", "/live/x"); err != nil {
+		t.Fatalf("Withdraw: %v", err)
+	}
+	if err := c.Withdraw(ctx, "a", "/live/x"); !IsNotFound(err) {
+		t.Errorf("second Withdraw error = %v, want not found", err)
+	}
+}
+
+func TestClient_Stats(t *testing.T) {
+	ctx := context.Background()
+	c := newController(t)
+
+	for _, info := range []RelayInfo{
+		{Name: "a", Address: "https://a:4433", Neighbors: map[string]float64{"b": 1}},
+		{Name: "b", Address: "https://b:4433", Neighbors: map[string]float64{}},
+	} {
+		if err := c.RegisterRelay(ctx, info); err != nil {
+			t.Fatalf("RegisterRelay(%s): %v", info.Name, err)
+		}
+	}
+
+	if err := c.ReportStats(ctx, "a", RelayStats{Sessions: 3, EgressMbps: 1.5}); err != nil {
+		t.Fatalf("ReportStats: %v", err)
+	}
+	entry, err := c.RelayStats(ctx, "a")
+	if err != nil {
+		t.Fatalf("RelayStats: %v", err)
+	}
+	if entry.Relay != "a" || entry.Sessions != 3 {
+		t.Errorf("RelayStats = %+v", entry)
+	}
+	if _, err := c.RelayStats(ctx, "b"); !IsNotFound(err) {
+		t.Errorf("RelayStats(b) error = %v, want not found", err)
+	}
+	cluster, err := c.ClusterStats(ctx)
+	if err != nil {
+		t.Fatalf("ClusterStats: %v", err)
+	}
+	if cluster.Relays != 1 || cluster.Sessions != 3 {
+		t.Errorf("ClusterStats = %+v", cluster)
+	}
+
+	tasks, err := c.ProbeTasks(ctx, "a")
+	if err != nil {
+		t.Fatalf("ProbeTasks: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].To != "b" {
+		t.Fatalf("ProbeTasks = %+v", tasks)
+	}
+	res := ProbeResult{ID: tasks[0].ID, From: "a", To: "b", LatencyMs: 20, Sent: 10, Received: 10}
+	if _, err := c.ReportProbe(ctx, res); err == nil {
+		t.Fatal("ReportProbe without the relay's token succeeded")
+	}
+	c.Token = "token-a"
+	st, err := c.ReportProbe(ctx, res)
+	if err != nil {
+		t.Fatalf("ReportProbe: %v", err)
+	}
+	if st.Samples != 1 {
+		t.Errorf("ReportProbe = %+v", st)
+	}
+	report, err := c.ProbeStats(ctx)
+	if err != nil {
+		t.Fatalf("ProbeStats: %v", err)
+	}
+	if len(report) != 1 {
+		t.Errorf("ProbeStats = %+v", report)
+	}
+
+	prefetch, err := c.PrefetchTasks(ctx, "a")
+	if err != nil {
+		t.Fatalf("PrefetchTasks: %v", err)
+	}
+	if len(prefetch) != 0 {
+		t.Errorf("PrefetchTasks = %+v, want none without a policy", prefetch)
+	}
+
+	placement, err := c.Placement(ctx, PlacementRequest{})
+	if err != nil {
+		t.Fatalf("Placement: %v", err)
+	}
+	if placement.Candidates != 2 {
+		t.Errorf("Placement = %+v", placement)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"relays": 1}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL, Retries: 2, RetryBackoff: time.Millisecond}
+	cluster, err := c.ClusterStats(context.Background())
+	if err != nil {
+		t.Fatalf("ClusterStats: %v", err)
+	}
+	if cluster.Relays != 1 || calls.Load() != 3 {
+		t.Errorf("relays = %d after %d calls, want 1 after 3", cluster.Relays, calls.Load())
+	}
+
+	// Out of retries
+	calls.Store(0)
+	c.Retries = 1
+	var se *StatusError
+	if _, err := c.ClusterStats(context.Background()); !errors.As(err, &se) || se.Code != http.StatusServiceUnavailable || se.Message != "busy" {
+		t.Errorf("error = %v, want 503 busy", err)
+	}
+
+	// Not idempotent
+	calls.Store(0)
+	if _, err := c.ReportProbe(context.Background(), ProbeResult{}); err == nil || calls.Load() != 1 {
+		t.Errorf("ReportProbe: err = %v after %d calls, want an error after 1", err, calls.Load())
+	}
+}
+
+func TestClient_RetryStopsWithContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c := &Client{URL: srv.URL, Retries: 100, RetryBackoff: time.Second}
+	start := time.Now()
+	if err := c.Health(ctx); err == nil {
+		t.Fatal("Health succeeded against a failing server")
+	}
+	if time.Since(start) > 900*time.Millisecond {
+		t.Errorf("retries outlived the context: %v", time.Since(start))
+	}
+}
+
+func TestClient_Token(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"overrides": []}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	if _, err := c.Overrides(context.Background()); err == nil {
+		t.Error("Overrides without a token succeeded")
+	}
+	c.Token = "secret"
+	if _, err := c.Overrides(context.Background()); err != nil {
+		t.Errorf("Overrides: %v", err)
+	}
+}
+
+func TestClient_AnnouncementsSince(t *testing.T) {
+	ctx := context.Background()
+	table := sdn.NewAnnounceTable(0)
+	srv := httptest.NewServer(sdn.ListHandlerFunc(table))
+	defer srv.Close()
+	c := New(srv.URL)
+
+	table.Register("a", "/live/x")
+	full, err := c.AnnouncementsSince(ctx, 0)
+	if err != nil {
+		t.Fatalf("AnnouncementsSince: %v", err)
+	}
+	if !full.Full || len(full.Entries) != 1 {
+		t.Fatalf("AnnouncementsSince(0) = %+v, want the full list", full)
+	}
+
+	table.Register("b", "/live/x")
+	table.Deregister("a", "/live/x")
+	d, err := c.AnnouncementsSince(ctx, full.Version)
+	if err != nil {
+		t.Fatalf("AnnouncementsSince: %v", err)
+	}
+	if d.Full || len(d.Added) != 1 || len(d.Removed) != 1 || d.Removed[0] != (AnnounceRef{Relay: "a", BroadcastPath: "/live/x"}) {
+		t.Errorf("AnnouncementsSince = %+v", d)
+	}
+}
+
+func TestClient_EscapesPathSegments(t *testing.T) {
+	ctx := context.Background()
+	c := newController(t)
+
+	if err := c.RegisterRelay(ctx, RelayInfo{Name: "edge #1?", Neighbors: map[string]float64{}}); err != nil {
+		t.Fatalf("RegisterRelay: %v", err)
+	}
+	if err := c.Announce(ctx, "edge #1?", "/live/50%/q?a", nil); err != nil {
+		t.Fatalf("Announce: %v", err)
+	}
+	d, err := c.RelayDetail(ctx, "edge #1?")
+	if err != nil {
+		t.Fatalf("RelayDetail: %v", err)
+	}
+	if d.Node == nil || d.Node.ID != "edge #1?" {
+		t.Errorf("RelayDetail node = %+v", d.Node)
+	}
+	relays, err := c.Lookup(ctx, "/live/50%/q?a")
+	if err != nil || len(relays) != 1 || relays[0].Relay != "edge #1?" {
+		t.Errorf("Lookup = %+v, %v", relays, err)
+	}
+}
+
+// TestTypes_MatchController checks that the client's types decode and
+// re-encode the controller's payloads without losing a field.
+func TestTypes_MatchController(t *testing.T) {
+	for _, tc := range []struct {
+		controller, client any
+	}{
+		{&topology.RelayInfo{}, &RelayInfo{}},
+		{&topology.Node{}, &Node{}},
+		{&topology.RouteResult{}, &RouteResult{}},
+		{&topology.GraphResponse{}, &GraphResponse{}},
+		{&topology.QueryResult{}, &QueryResult{}},
+		{&topology.Asymmetry{}, &Asymmetry{}},
+		{&topology.ZoneSummary{}, &ZoneSummary{}},
+		{&topology.Reservation{}, &Reservation{}},
+		{&topology.EdgeLoad{}, &EdgeLoad{}},
+		{&topology.MaintenanceWindow{}, &MaintenanceWindow{}},
+		{&sdn.NodeDetail{}, &NodeDetail{}},
+		{&sdn.AnnounceDelta{}, &AnnounceDelta{}},
+		{&sdn.ClusterStats{}, &ClusterStats{}},
+		{&sdn.ProbeTask{}, &ProbeTask{}},
+		{&sdn.ProbeStats{}, &ProbeStats{}},
+		{&sdn.PrefetchTask{}, &PrefetchTask{}},
+		{&sdn.Coverage{}, &Coverage{}},
+		{&sdn.PlacementRequest{}, &PlacementRequest{}},
+		{&sdn.EdgeResponse{}, &EdgeResponse{}},
+	} {
+		fill(reflect.ValueOf(tc.controller).Elem())
+		want, err := json.Marshal(tc.controller)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(want, tc.client); err != nil {
+			t.Fatalf("%T: %v", tc.client, err)
+		}
+		got, _ := json.Marshal(tc.client)
+		if string(got) != string(want) {
+			t.Errorf("%T encodes as\n%s\nwant\n%s", tc.client, got, want)
+		}
+	}
+}
+
+// fill sets every exported field of v to a non-zero value.
+func fill(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == reflect.TypeFor[time.Time]() {
+			v.Set(reflect.ValueOf(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)))
+			return
+		}
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				fill(v.Field(i))
+			}
+		}
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		k, e := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(k)
+		fill(e)
+		v.SetMapIndex(k, e)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float64:
+		v.SetFloat(1.5)
+	}
+}
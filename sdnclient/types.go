@@ -0,0 +1,474 @@
+package sdnclient
+
+import "time"
+
+// RelayInfo is a relay's registration, sent by RegisterRelay.
+type RelayInfo struct {
+	Name      string             `json:"name"`
+	Region    string             `json:"region,omitempty"`
+	Zone      string             `json:"zone,omitempty"`    // failure domain
+	Address   string             `json:"address,omitempty"` // MoQT endpoint URL (e.g. "https://host:4433")
+	Location  *Location          `json:"location,omitempty"`
+	Neighbors map[string]float64 `json:"neighbors"`
+	Version   string             `json:"version,omitempty"` // relay build version
+
+	// Symmetric asks the controller to add the reverse edge neighbor → relay
+	// for every neighbor, with the same cost unless ReverseCosts overrides it.
+	Symmetric    bool               `json:"symmetric,omitempty"`
+	ReverseCosts map[string]float64 `json:"reverse_costs,omitempty"`
+}
+
+// Location is a geographic position in degrees.
+type Location struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Node is a relay in the topology.
+type Node struct {
+	ID       string    `json:"id"`
+	Region   string    `json:"region"`
+	Zone     string    `json:"zone,omitempty"`
+	Address  string    `json:"address,omitempty"`
+	Location *Location `json:"location,omitempty"`
+	Version  string    `json:"version,omitempty"`
+	Cordoned bool      `json:"cordoned,omitempty"` // in a maintenance window
+	Edges    []Edge    `json:"edges"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Edge is a link from a Node to the relay To.
+type Edge struct {
+	To   string  `json:"to"`
+	Cost float64 `json:"cost"`
+
+	// Auto marks a reverse edge added for a relay that registered with
+	// Symmetric set.
+	Auto bool `json:"auto,omitempty"`
+
+	// Components is the cost model's breakdown of Cost, if one applied.
+	Components map[string]float64 `json:"components,omitempty"`
+}
+
+// NodeEvent is an entry of a relay's history in NodeDetail.
+type NodeEvent struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// RouteResult is a path between two relays.
+type RouteResult struct {
+	From           string   `json:"from"`
+	To             string   `json:"to"`
+	NextHop        string   `json:"next_hop"`
+	NextHopAddress string   `json:"next_hop_address,omitempty"` // MoQT endpoint URL of NextHop
+	FullPath       []string `json:"full_path"`
+	Cost           float64  `json:"cost"`
+
+	// FullPathAddresses are the MoQT endpoint URLs of the relays on
+	// FullPath, "" for those without one.
+	FullPathAddresses []string `json:"full_path_addresses,omitempty"`
+
+	// Backup fields are set when the controller routes zone-diverse.
+	BackupPath  []string `json:"backup_path,omitempty"`
+	BackupCost  float64  `json:"backup_cost,omitempty"`
+	SharedZones []string `json:"shared_zones,omitempty"` // zones transited by both paths
+
+	// NextHopFEC is how many parity frames per group to request from
+	// NextHop; 0 disables FEC on the hop.
+	NextHopFEC int `json:"next_hop_fec,omitempty"`
+
+	// Pinned is set when FullPath is an operator's route pin.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// Reservation fields are set by Reserve.
+	ReservationID string  `json:"reservation_id,omitempty"`
+	ReservedMbps  float64 `json:"reserved_mbps,omitempty"`
+}
+
+// GraphResponse is the topology, as returned by Graph and Snapshot and
+// accepted by Restore.
+type GraphResponse struct {
+	Nodes     []NodeResponse                `json:"nodes"`
+	Adjacency map[string]map[string]float64 `json:"adjacency"`
+	Overrides []EdgeOverride                `json:"overrides,omitempty"`
+
+	Attributes  []EdgeAttributesResponse `json:"attributes,omitempty"`
+	Maintenance []MaintenanceWindow      `json:"maintenance,omitempty"`
+	Pins        []RoutePin               `json:"pins,omitempty"`
+
+	// TakenAt is when a snapshot was taken; zero outside of Snapshot.
+	TakenAt time.Time `json:"taken_at,omitzero"`
+
+	// Costs breaks down the edges a cost model priced. It is not part of
+	// a snapshot.
+	Costs []EdgeCostResponse `json:"costs,omitempty"`
+}
+
+// NodeResponse is a relay of a GraphResponse.
+type NodeResponse struct {
+	ID       string    `json:"id"`
+	Region   string    `json:"region"`
+	Zone     string    `json:"zone,omitempty"`
+	Address  string    `json:"address,omitempty"`
+	Location *Location `json:"location,omitempty"`
+	Version  string    `json:"version,omitempty"`
+	Cordoned bool      `json:"cordoned,omitempty"`
+	LastSeen time.Time `json:"last_seen,omitzero"` // zero for seeded nodes
+}
+
+// RoutePin is an operator-chosen path from From to To.
+type RoutePin struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Path      []string  `json:"path"` // full path, From first and To last
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Broken is set when an edge of Path is no longer in the graph.
+	Broken bool `json:"broken,omitempty"`
+}
+
+// EdgeAttributesResponse is the cost model inputs of the edge From → To.
+type EdgeAttributesResponse struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	EdgeAttributes
+}
+
+// EdgeCostResponse is the cost model's breakdown of an edge's cost.
+type EdgeCostResponse struct {
+	From       string             `json:"from"`
+	To         string             `json:"to"`
+	Cost       float64            `json:"cost"`
+	Components map[string]float64 `json:"components"`
+}
+
+// Asymmetry is a one-way link.
+type Asymmetry struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Cost   float64 `json:"cost"`
+	Reason string  `json:"reason"`
+}
+
+// ZoneSummary describes a failure domain and what losing it would cut off.
+type ZoneSummary struct {
+	Zone           string   `json:"zone"`
+	Nodes          []string `json:"nodes"`
+	CrossZoneEdges int      `json:"cross_zone_edges"`
+	Isolated       []string `json:"isolated"`   // nodes left without an edge if the zone fails
+	Partitions     bool     `json:"partitions"` // losing the zone splits the graph
+}
+
+// QueryResult is the outcome of a topology query; Kind says which of
+// Nodes, Edges and Paths is set.
+type QueryResult struct {
+	Kind  string      `json:"kind"`
+	Nodes []QueryNode `json:"nodes,omitempty"`
+	Edges []QueryEdge `json:"edges,omitempty"`
+	Paths []QueryPath `json:"paths,omitempty"`
+	Count int         `json:"count"`
+}
+
+// QueryNode is a relay a query selected, with its cost from the query's
+// origin if it has one.
+type QueryNode struct {
+	NodeResponse
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+// QueryEdge is an edge a query selected.
+type QueryEdge struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Cost float64 `json:"cost"`
+}
+
+// QueryPath is a path a query computed.
+type QueryPath struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Path []string `json:"path"`
+	Cost float64  `json:"cost"`
+}
+
+// EdgeOverride pins the edge From → To to Cost, or takes it out of routing
+// if Down is set.
+type EdgeOverride struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Cost      float64   `json:"cost,omitempty"`
+	Down      bool      `json:"down,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EdgeAttributes are the per-edge signals the controller's cost model
+// combines into an edge's cost.
+type EdgeAttributes struct {
+	RTTMs        float64 `json:"rtt_ms,omitempty"`
+	Loss         float64 `json:"loss,omitempty"`        // 0..1
+	Utilization  float64 `json:"utilization,omitempty"` // 0..1
+	Weight       float64 `json:"weight,omitempty"`      // 0 means 1
+	CapacityMbps float64 `json:"capacity_mbps,omitempty"`
+	FECStripes   int     `json:"fec_stripes,omitempty"`
+}
+
+// Reservation is bandwidth reserved along a path.
+type Reservation struct {
+	ID        string    `json:"id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Path      []string  `json:"path"`
+	Mbps      float64   `json:"mbps"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// EdgeLoad is the reserved bandwidth of an edge.
+type EdgeLoad struct {
+	From         string  `json:"from"`
+	To           string  `json:"to"`
+	CapacityMbps float64 `json:"capacity_mbps,omitempty"` // 0 = unlimited
+	ReservedMbps float64 `json:"reserved_mbps"`
+}
+
+// MaintenanceWindow is a period during which Relay is cordoned.
+type MaintenanceWindow struct {
+	Relay     string    `json:"relay"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NodeDetail is everything the controller knows about a relay.
+type NodeDetail struct {
+	Relay string `json:"relay"`
+
+	// Node is the relay's place in the topology; nil once it was removed.
+	Node *Node `json:"node,omitempty"`
+
+	LastHeartbeat  *time.Time `json:"last_heartbeat,omitempty"`
+	HeartbeatAgeMs int64      `json:"heartbeat_age_ms,omitempty"`
+
+	Announces []AnnounceEntry `json:"announces"`
+
+	// Load is the relay's latest metric summary. LoadStale is set when it
+	// no longer counts in aggregates.
+	Load      *RelayStatsEntry `json:"load,omitempty"`
+	LoadStale bool             `json:"load_stale,omitempty"`
+
+	Events []NodeEvent `json:"events"`
+}
+
+// AnnounceEntry is a broadcast held by a relay.
+type AnnounceEntry struct {
+	Relay         string            `json:"relay"`
+	BroadcastPath string            `json:"broadcast_path"`
+	RegisteredAt  time.Time         `json:"registered_at"`
+	ExpiresAt     time.Time         `json:"expires_at,omitempty"`
+	AnnouncedAt   time.Time         `json:"announced_at,omitzero"` // by the relay's clock; zero if unknown
+	Metadata      *AnnounceMetadata `json:"metadata,omitempty"`
+}
+
+// AnnounceMetadata describes an announced broadcast.
+type AnnounceMetadata struct {
+	Codecs  []string `json:"codecs,omitempty"`  // e.g. "avc1.64001f", "opus"
+	Bitrate int64    `json:"bitrate,omitempty"` // nominal bitrate in bits/s
+	Labels  []string `json:"labels,omitempty"`  // free-form tags, e.g. "premium"
+
+	Visibility *Visibility `json:"visibility,omitempty"` // nil for a public broadcast
+}
+
+// Visibility limits who may see a private broadcast.
+type Visibility struct {
+	Tenant string   `json:"tenant,omitempty"` // relays and subscribers of this tenant
+	Relays []string `json:"relays,omitempty"` // relays, or subscriber identities, named here
+}
+
+// AnnounceDelta is the announcements changed since a version, or all of
+// them when Full is set.
+type AnnounceDelta struct {
+	Version uint64 `json:"version"`
+	Full    bool   `json:"full,omitempty"`
+
+	Entries []AnnounceEntry `json:"entries,omitempty"` // with Full
+	Added   []AnnounceEntry `json:"added,omitempty"`
+	Removed []AnnounceRef   `json:"removed,omitempty"`
+}
+
+// AnnounceRef names a withdrawn announcement.
+type AnnounceRef struct {
+	Relay         string `json:"relay"`
+	BroadcastPath string `json:"broadcast_path"`
+}
+
+// RelayStats is a relay's metric summary.
+type RelayStats struct {
+	Sessions    int            `json:"sessions"`
+	EgressBytes uint64         `json:"egress_bytes"` // cumulative
+	EgressMbps  float64        `json:"egress_mbps"`
+	Subscribers map[string]int `json:"subscribers,omitempty"` // broadcast path → subscribers
+
+	// Health is "healthy", or "degraded" for the reason in HealthReason.
+	// Empty leaves the relay's health to probes.
+	Health       string `json:"health,omitempty"`
+	HealthReason string `json:"health_reason,omitempty"`
+}
+
+// RelayStatsEntry is a relay's latest stored report.
+type RelayStatsEntry struct {
+	Relay      string    `json:"relay"`
+	ReceivedAt time.Time `json:"received_at"`
+	RelayStats
+}
+
+// ClusterStats is the fleet-wide aggregate of the relays' latest reports.
+type ClusterStats struct {
+	Relays           int            `json:"relays"`
+	Sessions         int            `json:"sessions"`
+	EgressMbps       float64        `json:"egress_mbps"`
+	TotalSubscribers int            `json:"total_subscribers"`
+	Subscribers      map[string]int `json:"subscribers"`
+	Timestamp        time.Time      `json:"timestamp"`
+}
+
+// ProbeTask asks relay From to probe relay To.
+type ProbeTask struct {
+	ID      string `json:"id"`
+	From    string `json:"from"`    // probing (subscribing) relay
+	To      string `json:"to"`      // probed (publishing) relay
+	Address string `json:"address"` // MoQT endpoint of To
+	Path    string `json:"path"`    // broadcast path of To's probe
+}
+
+// ProbeResult is the outcome of a ProbeTask.
+type ProbeResult struct {
+	ID        string  `json:"id"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	LatencyMs float64 `json:"latency_ms"` // subscribe → first frame
+	Sent      int     `json:"sent"`       // frames the probed relay is known to have sent
+	Received  int     `json:"received"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ProbeStats is the probe statistics of the edge From → To.
+type ProbeStats struct {
+	From         string      `json:"from"`
+	To           string      `json:"to"`
+	Samples      int         `json:"samples"`
+	Failures     int         `json:"failures"`
+	AvgLatencyMs float64     `json:"avg_latency_ms"`
+	AvgLoss      float64     `json:"avg_loss"` // 0..1
+	Cost         float64     `json:"cost"`     // edge cost fed back to the topology
+	Last         ProbeResult `json:"last"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// PrefetchTask asks a relay to prefetch Tracks of Path from Source.
+type PrefetchTask struct {
+	Path   string   `json:"path"`
+	Source string   `json:"source"` // a relay announcing Path
+	Tracks []string `json:"tracks"`
+}
+
+// Coverage is how many relays hold a broadcast against the replication
+// policy.
+type Coverage struct {
+	Path        string   `json:"path"`
+	Subscribers int      `json:"subscribers"` // cluster-wide
+	Lookups     uint64   `json:"lookups"`
+	Hot         bool     `json:"hot"`
+	Sources     []string `json:"sources"`               // announcing relays
+	Serving     []string `json:"serving,omitempty"`     // relays with subscribers
+	Prefetching []string `json:"prefetching,omitempty"` // relays told to prefetch
+	Coverage    int      `json:"coverage"`              // distinct relays above
+	Target      int      `json:"target"`                // the replication factor when hot, else 0
+	Satisfied   bool     `json:"satisfied"`
+}
+
+// PlacementRequest describes a publisher to place by Region or Location.
+type PlacementRequest struct {
+	Region   string    `json:"region,omitempty"`
+	Location *Location `json:"location,omitempty"`
+}
+
+// PlacementResult is the relay selected for a publisher or subscriber.
+type PlacementResult struct {
+	Relay      string   `json:"relay"`
+	Address    string   `json:"address"`
+	Region     string   `json:"region,omitempty"`
+	Score      float64  `json:"score"`
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+	Sessions   int      `json:"sessions"`
+	Candidates int      `json:"candidates"`
+}
+
+// GeoRecord is where the controller located an IP address.
+type GeoRecord struct {
+	Region   string    `json:"region,omitempty"`
+	Location *Location `json:"location,omitempty"`
+}
+
+// EdgeResponse is the relay selected for a subscriber.
+type EdgeResponse struct {
+	ClientIP string     `json:"client_ip"`
+	Client   *GeoRecord `json:"client,omitempty"` // nil if the IP could not be located
+	PlacementResult
+}
+
+// Zones is the response of GET /graph/zones.
+type Zones struct {
+	Zones   []ZoneSummary `json:"zones"`
+	Unzoned int           `json:"unzoned"` // nodes without a zone
+}
+
+// CoverageReport is the response of GET /announce/coverage.
+type CoverageReport struct {
+	Factor         int        `json:"factor"`
+	MinSubscribers int        `json:"min_subscribers"`
+	Paths          []Coverage `json:"paths"`
+}
+
+// AttributesUpdate sets the cost model inputs of the edge From → To.
+// Nil fields keep their current value.
+type AttributesUpdate struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	RTTMs       *float64 `json:"rtt_ms,omitempty"`
+	Loss        *float64 `json:"loss,omitempty"`
+	Utilization *float64 `json:"utilization,omitempty"`
+	Weight      *float64 `json:"weight,omitempty"`
+
+	CapacityMbps *float64 `json:"capacity_mbps,omitempty"`
+	FECStripes   *int     `json:"fec_stripes,omitempty"`
+}
+
+// MaintenanceRequest schedules a maintenance window of Relay from Start
+// (zero is now) to End, or for DurationSec seconds when End is zero.
+type MaintenanceRequest struct {
+	Relay       string    `json:"-"`
+	Start       time.Time `json:"start,omitzero"`
+	End         time.Time `json:"end,omitzero"`
+	DurationSec int       `json:"duration_sec,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// ReserveRequest asks for a route with Mbps reserved on every edge for
+// TTLSec seconds (0 uses the controller's default of an hour).
+type ReserveRequest struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Mbps   float64 `json:"reserve_mbps"`
+	TTLSec int     `json:"ttl_sec,omitempty"`
+}
+
+// Reservations is the response of GET /route/reservations.
+type Reservations struct {
+	Reservations []Reservation `json:"reservations"`
+	Edges        []EdgeLoad    `json:"edges"` // edges with a capacity or reservations
+}